@@ -0,0 +1,195 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"stable_diffusion_bot/api/stable_diffusion_api"
+	"stable_diffusion_bot/queue/stable_diffusion"
+)
+
+const (
+	// defaultStatsDays is the period /api/stats covers unless days is set
+	defaultStatsDays = 30
+	// defaultStatsLimit is how many members and checkpoints /api/stats lists unless limit is set
+	defaultStatsLimit = 10
+)
+
+// Queue is what the admin API controls, implemented by *stable_diffusion.SDQueue
+type Queue interface {
+	Status() stable_diffusion.Status
+	Items() []stable_diffusion.QueuedItem
+	Cancel(id string) error
+	SetPaused(paused bool)
+	Stats(ctx context.Context, guildID string, since time.Time, limit int) (*stable_diffusion.Stats, error)
+	RefreshCaches() (map[string]int, error)
+	Concurrency() []stable_diffusion_api.ConcurrencyStats
+}
+
+type Config struct {
+	// Addr to listen on, e.g. 127.0.0.1:8081
+	Addr string
+	// Token every request has to send as "Authorization: Bearer <token>"
+	Token string
+	Queue Queue
+}
+
+// QueueReport is the body of GET /api/queue
+type QueueReport struct {
+	Status stable_diffusion.Status       `json:"status"`
+	Items  []stable_diffusion.QueuedItem `json:"items"`
+}
+
+type server struct {
+	cfg Config
+}
+
+// Serve serves the admin API on cfg.Addr until ctx is done:
+//
+//	GET    /api/queue          the queue status and its items, the one being generated first
+//	DELETE /api/queue/{id}     cancel a queued item or interrupt the one being generated
+//	POST   /api/queue/pause    hold the queue after the current generation
+//	POST   /api/queue/resume   resume the queue
+//	GET    /api/stats          images generated, top members and checkpoints. Takes days, guild_id and limit
+//	POST   /api/cache/refresh  reload the loras, checkpoints and VAEs from the API
+//	GET    /api/backend/concurrency  requests in flight and waiting for api_max_concurrent, with their contention
+func Serve(ctx context.Context, cfg Config) error {
+	if cfg.Addr == "" {
+		return errors.New("missing admin address")
+	}
+	if cfg.Token == "" {
+		return errors.New("missing admin token")
+	}
+	if cfg.Queue == nil {
+		return errors.New("missing queue")
+	}
+
+	s := &server{cfg: cfg}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/queue", s.queue)
+	mux.HandleFunc("DELETE /api/queue/{id}", s.cancel)
+	mux.HandleFunc("POST /api/queue/pause", s.pause(true))
+	mux.HandleFunc("POST /api/queue/resume", s.pause(false))
+	mux.HandleFunc("GET /api/stats", s.stats)
+	mux.HandleFunc("POST /api/cache/refresh", s.refresh)
+	mux.HandleFunc("GET /api/backend/concurrency", s.concurrency)
+
+	srv := &http.Server{Addr: cfg.Addr, Handler: s.authenticate(mux), ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdown)
+	}()
+
+	log.Printf("Serving the admin API on %s", cfg.Addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// authenticate rejects requests without the bearer token, comparing in constant time
+func (s *server) authenticate(next http.Handler) http.Handler {
+	expected := []byte("Bearer " + s.cfg.Token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			writeError(w, http.StatusUnauthorized, errors.New("missing or invalid token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *server) queue(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, QueueReport{
+		Status: s.cfg.Queue.Status(),
+		Items:  s.cfg.Queue.Items(),
+	})
+}
+
+func (s *server) cancel(w http.ResponseWriter, r *http.Request) {
+	err := s.cfg.Queue.Cancel(r.PathValue("id"))
+	switch {
+	case errors.Is(err, stable_diffusion.ErrItemNotFound):
+		writeError(w, http.StatusNotFound, err)
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *server) pause(paused bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.cfg.Queue.SetPaused(paused)
+		writeJSON(w, http.StatusOK, s.cfg.Queue.Status())
+	}
+}
+
+func (s *server) stats(w http.ResponseWriter, r *http.Request) {
+	days, err := intParam(r, "days", defaultStatsDays)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	limit, err := intParam(r, "limit", defaultStatsLimit)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	since := time.Now().AddDate(0, 0, -days)
+	stats, err := s.cfg.Queue.Stats(r.Context(), r.URL.Query().Get("guild_id"), since, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+func (s *server) refresh(w http.ResponseWriter, r *http.Request) {
+	loaded, err := s.cfg.Queue.RefreshCaches()
+	if err != nil {
+		writeJSON(w, http.StatusBadGateway, map[string]any{"loaded": loaded, "error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"loaded": loaded})
+}
+
+func (s *server) concurrency(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.cfg.Queue.Concurrency())
+}
+
+// intParam reads a positive integer from the query, or def if it's not set
+func intParam(r *http.Request, key string, def int) (int, error) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return 0, errors.New(key + " must be a positive integer")
+	}
+	return n, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error writing admin response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -1,23 +1,32 @@
 package novelai
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"time"
 
+	"stable_diffusion_bot/apierror"
 	"stable_diffusion_bot/entities"
 )
 
 type Client struct {
-	token token
-	host  url.URL
+	token  token
+	host   url.URL
+	client *http.Client
+	retry  RetryPolicy
 }
 
-func NewNovelAIClient(key string) *Client {
+// NewNovelAIClient sends requests with transport, e.g. through a proxy. A nil transport uses http.DefaultTransport.
+// Generations NovelAI is too busy for are retried according to retry.
+func NewNovelAIClient(key string, transport http.RoundTripper, retry RetryPolicy) *Client {
 	return &Client{
-		token: token(key),
+		token:  token(key),
+		client: &http.Client{Transport: transport},
+		retry:  retry.withDefaults(),
 		host: url.URL{
 			Scheme: "https",
 			Host:   "image.novelai.net",
@@ -26,7 +35,11 @@ func NewNovelAIClient(key string) *Client {
 	}
 }
 
-func (c *Client) Inference(request *entities.NovelAIRequest) (*entities.NovelAIResponse, error) {
+// RetryPolicy returns how generations are retried, with the defaults filled in
+func (c *Client) RetryPolicy() RetryPolicy { return c.retry }
+
+// Inference generates the request, retrying while NovelAI is busy. retrying is called before each retry, it can be nil.
+func (c *Client) Inference(request *entities.NovelAIRequest, retrying RetryFunc) (*entities.NovelAIResponse, error) {
 	if request == nil {
 		return nil, errors.New("request is nil")
 	}
@@ -35,13 +48,30 @@ func (c *Client) Inference(request *entities.NovelAIRequest) (*entities.NovelAIR
 	if err != nil {
 		return nil, err
 	}
-
-	response, err := c.POST(bin)
+	// the body is sent again as it is, as Reader adds the quality tags and presets to the request each time
+	body, err := io.ReadAll(bin)
 	if err != nil {
 		return nil, err
 	}
 
-	return &entities.NovelAIResponse{Images: response}, nil
+	delay := c.retry.Delay
+	for attempt := 1; ; attempt++ {
+		response, err := c.POST(bytes.NewReader(body))
+		var busy *BusyError
+		if !errors.As(err, &busy) || attempt >= c.retry.Attempts || busy.RetryAfter > maxRetryAfter {
+			if err != nil {
+				return nil, err
+			}
+			return &entities.NovelAIResponse{Images: response}, nil
+		}
+
+		wait := max(jitter(delay), busy.RetryAfter)
+		if retrying != nil {
+			retrying(attempt+1, wait, err)
+		}
+		time.Sleep(wait)
+		delay = min(delay*2, c.retry.MaxDelay)
+	}
 }
 
 func (c *Client) POST(bin io.Reader) ([]io.Reader, error) {
@@ -53,25 +83,21 @@ func (c *Client) POST(bin io.Reader) ([]io.Reader, error) {
 	request.Header.Set("Content-Type", "application/json; charset=UTF-8")
 	c.token.setAuth(&request.Header)
 
-	client := new(http.Client)
-
-	response, err := client.Do(request)
+	response, err := c.client.Do(request)
 	if err != nil {
-		return nil, err
+		return nil, apierror.Timeout(err)
 	}
 	defer response.Body.Close()
 	if response.StatusCode != http.StatusOK {
-		errorString := "(unknown error)"
-
 		body, err := io.ReadAll(response.Body)
 		if err != nil {
 			return nil, fmt.Errorf("could not read error body: %w", err)
 		}
-		if len(body) > 0 {
-			errorString = fmt.Sprintf("\n```json\n%v\n```", string(body))
+		err = apierror.Parse(response.StatusCode, c.host.String(), body)
+		if isBusy(response.StatusCode) {
+			return nil, &BusyError{Status: response.StatusCode, RetryAfter: retryAfter(response.Header, time.Now()), Err: err}
 		}
-
-		return nil, fmt.Errorf("unexpected status code: %d %s", response.StatusCode, errorString)
+		return nil, err
 	}
 
 	contentType := response.Header.Get("Content-Type")
@@ -0,0 +1,96 @@
+package novelai
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryPolicy is how generations are retried while NovelAI is busy. It answers 429 when the account already has a
+// generation running and 500 or 503 during peak hours, before the generation started, so retrying doesn't cost twice.
+type RetryPolicy struct {
+	// Attempts is the most times a generation is sent, 1 disables retries. Default is 5
+	Attempts int
+	// Delay before the first retry, doubled after each retry with up to 50% jitter. A longer Retry-After is waited
+	// instead. Default is 2s
+	Delay time.Duration
+	// MaxDelay caps the delay between retries, except the one asked for by Retry-After. Default is 30s
+	MaxDelay time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{Attempts: 5, Delay: 2 * time.Second, MaxDelay: 30 * time.Second}
+
+// maxRetryAfter is the longest Retry-After waited for, the generation fails instead of holding the queue any longer
+const maxRetryAfter = 5 * time.Minute
+
+var busyStatuses = []int{
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusServiceUnavailable,
+}
+
+// RetryFunc is told before each retry which attempt is next, how long it waits and the error that caused it
+type RetryFunc func(attempt int, wait time.Duration, err error)
+
+// BusyError is returned when NovelAI turned the generation away without starting it
+type BusyError struct {
+	Status int
+	// RetryAfter is how long NovelAI asked to wait, 0 if it didn't say
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *BusyError) Error() string {
+	return fmt.Sprintf("NovelAI is busy (%d): %v", e.Status, e.Err)
+}
+
+func (e *BusyError) Unwrap() error { return e.Err }
+
+func (e *BusyError) Message() string {
+	return "NovelAI is too busy to take the generation right now."
+}
+
+func (e *BusyError) Fix() string {
+	return "Try again in a few minutes."
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.Attempts <= 0 {
+		p.Attempts = DefaultRetryPolicy.Attempts
+	}
+	if p.Delay <= 0 {
+		p.Delay = DefaultRetryPolicy.Delay
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = DefaultRetryPolicy.MaxDelay
+	}
+	return p
+}
+
+// retryAfter reads the Retry-After header as seconds or an HTTP date, 0 if it's missing or in the past
+func retryAfter(header http.Header, now time.Time) time.Duration {
+	value := strings.TrimSpace(header.Get("Retry-After"))
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0)
+	}
+	return 0
+}
+
+func isBusy(status int) bool {
+	return slices.Contains(busyStatuses, status)
+}
+
+// jitter waits between the upper half of delay and delay, so retries of several bots don't line up
+func jitter(delay time.Duration) time.Duration {
+	return delay/2 + rand.N(delay/2+1)
+}
@@ -0,0 +1,58 @@
+package stable_diffusion_api
+
+import (
+	"context"
+	"slices"
+	"strings"
+)
+
+// ADetailerModels are the detection models the ADetailer extension has installed, e.g. face_yolov8n.pt
+type ADetailerModels []string
+
+type adetailerModelsResponse struct {
+	Models ADetailerModels `json:"ad_model"`
+}
+
+func (c ADetailerModels) String(i int) string {
+	return c[i]
+}
+
+func (c ADetailerModels) Len() int {
+	return len(c)
+}
+
+// Has reports whether the model is installed, ignoring case
+func (c ADetailerModels) Has(model string) bool {
+	return slices.ContainsFunc(c, func(installed string) bool { return strings.EqualFold(installed, model) })
+}
+
+// ADetailerModelCache is nil until it's fetched and stays nil on backends without the ADetailer extension
+var ADetailerModelCache *ADetailerModels
+
+// GetCache returns var ADetailerModelCache *ADetailerModels as a Cacheable. Assert using cache.(*ADetailerModels)
+func (c *ADetailerModels) GetCache(api StableDiffusionAPI) (Cacheable, error) {
+	if c != nil {
+		return c, nil
+	}
+	if ADetailerModelCache != nil {
+		return ADetailerModelCache, nil
+	}
+	return c.apiGET(api)
+}
+
+// Refresh fetches the models again, the extension lists the models folder on every request
+func (c *ADetailerModels) Refresh(api StableDiffusionAPI) (Cacheable, error) {
+	return c.apiGET(api)
+}
+
+func (c *ADetailerModels) apiGET(api StableDiffusionAPI) (Cacheable, error) {
+	getURL := api.Host("/adetailer/v1/ad_model")
+
+	response, err := GET[adetailerModelsResponse](context.Background(), api.Client(), getURL)
+	if err != nil {
+		return nil, err
+	}
+	ADetailerModelCache = &response.Models
+
+	return ADetailerModelCache, nil
+}
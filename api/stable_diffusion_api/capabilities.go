@@ -0,0 +1,103 @@
+package stable_diffusion_api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Feature is something the bot needs an endpoint of the backend for
+type Feature string
+
+const (
+	FeatureTextToImage  Feature = "txt2img"
+	FeatureImageToImage Feature = "img2img"
+	FeatureOptions      Feature = "options"
+	FeatureProgress     Feature = "progress"
+	FeatureUpscale      Feature = "upscale"
+	FeatureADetailer    Feature = "ADetailer"
+	FeatureControlNet   Feature = "ControlNet"
+)
+
+// featureEndpoints are probed in order. Endpoints that only accept POST answer a GET with 405, which still shows
+// they exist.
+var featureEndpoints = []struct {
+	feature Feature
+	path    string
+}{
+	{FeatureTextToImage, "/sdapi/v1/txt2img"},
+	{FeatureImageToImage, "/sdapi/v1/img2img"},
+	{FeatureOptions, "/sdapi/v1/options"},
+	{FeatureProgress, "/sdapi/v1/progress"},
+	{FeatureUpscale, "/sdapi/v1/extra-single-image"},
+	{FeatureADetailer, "/adetailer/v1/version"},
+	{FeatureControlNet, "/controlnet/version"},
+}
+
+// Capabilities are the features the backend was found to serve. Features that couldn't be probed, e.g. because
+// the backend was down, are assumed to be available.
+type Capabilities map[Feature]bool
+
+// Has reports whether the feature can be used, which is true unless its endpoint was found missing
+func (c Capabilities) Has(feature Feature) bool {
+	available, probed := c[feature]
+	return available || !probed
+}
+
+// Missing returns the features whose endpoints were found missing
+func (c Capabilities) Missing() []Feature {
+	var missing []Feature
+	for _, endpoint := range featureEndpoints {
+		if !c.Has(endpoint.feature) {
+			missing = append(missing, endpoint.feature)
+		}
+	}
+	return missing
+}
+
+// String reports every feature on its own line, e.g. "ControlNet: missing (/controlnet/version)"
+func (c Capabilities) String() string {
+	var report strings.Builder
+	for n, endpoint := range featureEndpoints {
+		if n > 0 {
+			report.WriteByte('\n')
+		}
+		available, probed := c[endpoint.feature]
+		status := "unknown"
+		if probed && available {
+			status = "available"
+		} else if probed {
+			status = "missing"
+		}
+		fmt.Fprintf(&report, "%s: %s (%s)", endpoint.feature, status, endpoint.path)
+	}
+	return report.String()
+}
+
+// Capabilities probes the endpoint of every Feature. An endpoint is missing when the backend answers 404, features
+// are left unprobed on other errors. The error is only returned when the backend can't be reached at all.
+func (api *apiImplementation) Capabilities(ctx context.Context) (Capabilities, error) {
+	capabilities := make(Capabilities, len(featureEndpoints))
+	for _, endpoint := range featureEndpoints {
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, api.Host(endpoint.path), nil)
+		if err != nil {
+			return capabilities, err
+		}
+		response, err := api.client.Do(request)
+		if err != nil {
+			return capabilities, fmt.Errorf("error probing %s: %w", endpoint.path, err)
+		}
+		closeResponseBody(response.Body)
+
+		switch {
+		case response.StatusCode == http.StatusNotFound:
+			capabilities[endpoint.feature] = false
+		case response.StatusCode < 300,
+			response.StatusCode == http.StatusMethodNotAllowed,
+			response.StatusCode == http.StatusUnprocessableEntity:
+			capabilities[endpoint.feature] = true
+		}
+	}
+	return capabilities, nil
+}
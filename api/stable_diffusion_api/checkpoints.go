@@ -7,7 +7,11 @@
 package stable_diffusion_api
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
 )
 
 type SDModels []SDModel
@@ -31,6 +35,84 @@ type SDModel struct {
 	Config    *string `json:"config"`
 }
 
+// ModelFamily is the architecture a checkpoint was trained as, which decides the sizes it generates well at
+type ModelFamily string
+
+const (
+	FamilyUnknown ModelFamily = ""
+	FamilySD15    ModelFamily = "sd15"
+	FamilySD2     ModelFamily = "sd2"
+	FamilySDXL    ModelFamily = "sdxl"
+	FamilyFlux    ModelFamily = "flux"
+)
+
+// ParseModelFamily returns the family named s, accepting the spellings of Civitai's base models like "SD 1.5" and "Flux.1 D"
+func ParseModelFamily(s string) (ModelFamily, error) {
+	switch name := strings.ToLower(strings.NewReplacer(" ", "", ".", "", "_", "", "-", "").Replace(s)); {
+	case name == "sd15", name == "sd1", name == "sd14":
+		return FamilySD15, nil
+	case name == "sd2", name == "sd20", name == "sd21", name == "sd20768", name == "sd21768":
+		return FamilySD2, nil
+	case name == "sdxl", name == "sdxl10", name == "pony", name == "illustrious", name == "noobai":
+		return FamilySDXL, nil
+	case strings.HasPrefix(name, "flux"):
+		return FamilyFlux, nil
+	default:
+		return FamilyUnknown, fmt.Errorf("unknown model family %q, must be sd15, sd2, sdxl or flux", s)
+	}
+}
+
+var (
+	// configFamilies match the config file A1111 loaded the checkpoint with
+	configFamilies = []struct {
+		pattern *regexp.Regexp
+		family  ModelFamily
+	}{
+		{regexp.MustCompile(`(?i)flux`), FamilyFlux},
+		{regexp.MustCompile(`(?i)sd_xl|sdxl`), FamilySDXL},
+		{regexp.MustCompile(`(?i)v2-|sd2`), FamilySD2},
+		{regexp.MustCompile(`(?i)v1-|sd1`), FamilySD15},
+	}
+	// nameFamilies match the names checkpoints are usually published with
+	nameFamilies = []struct {
+		pattern *regexp.Regexp
+		family  ModelFamily
+	}{
+		{regexp.MustCompile(`(?i)flux`), FamilyFlux},
+		{regexp.MustCompile(`(?i)sd_?xl|(^|[^a-z])xl|xl([^a-z]|$)|pony|illustrious|noob`), FamilySDXL},
+		{regexp.MustCompile(`(?i)sd_?2[._-]?[01]|v2[._-]1`), FamilySD2},
+		{regexp.MustCompile(`(?i)sd_?1[._-]?5|v1[._-]5`), FamilySD15},
+	}
+)
+
+// Family guesses the family of the checkpoint from the config file it was loaded with, then from its name.
+// Checkpoints that match neither return FamilyUnknown.
+func (m SDModel) Family() ModelFamily {
+	if m.Config != nil {
+		for _, match := range configFamilies {
+			if match.pattern.MatchString(*m.Config) {
+				return match.family
+			}
+		}
+	}
+	for _, match := range nameFamilies {
+		if match.pattern.MatchString(m.Title) || match.pattern.MatchString(m.Filename) {
+			return match.family
+		}
+	}
+	return FamilyUnknown
+}
+
+// Lookup returns the checkpoint with the title or model name of name
+func (c SDModels) Lookup(name string) (SDModel, bool) {
+	for _, model := range c {
+		if model.Title == name || model.ModelName == name {
+			return model, true
+		}
+	}
+	return SDModel{}, false
+}
+
 // String is what we fuzzy match against
 func (c SDModels) String(i int) string {
 	return c[i].Title
@@ -56,7 +138,7 @@ func (c *SDModels) GetCache(api StableDiffusionAPI) (Cacheable, error) {
 func (c *SDModels) Refresh(api StableDiffusionAPI) (Cacheable, error) {
 	postURL := api.Host("/sdapi/v1/refresh-checkpoints")
 
-	err := POST[error](api.Client(), postURL, nil, nil)
+	err := POST[error](Idempotent(context.Background()), api.Client(), postURL, nil, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -67,7 +149,7 @@ func (c *SDModels) Refresh(api StableDiffusionAPI) (Cacheable, error) {
 func (c *SDModels) apiGET(api StableDiffusionAPI) (Cacheable, error) {
 	getURL := api.Host("/sdapi/v1/sd-models")
 
-	cache, err := GET[SDModels](api.Client(), getURL)
+	cache, err := GET[SDModels](context.Background(), api.Client(), getURL)
 	if err != nil {
 		return nil, err
 	}
@@ -7,13 +7,15 @@
 package stable_diffusion_api
 
 import (
+	"context"
+
 	"stable_diffusion_bot/entities"
 )
 
 func (api *apiImplementation) GetConfig() (*entities.Config, error) {
 	getURL := "/sdapi/v1/options"
 
-	config, err := GET[entities.Config](api.Client(), api.Host(getURL))
+	config, err := GET[entities.Config](context.Background(), api.optionsClient, api.Host(getURL))
 	if err != nil {
 		return nil, err
 	}
@@ -6,7 +6,10 @@
 
 package stable_diffusion_api
 
-import "encoding/json"
+import (
+	"context"
+	"encoding/json"
+)
 
 func UnmarshalControlnetTypes(data []byte) (ControlnetTypes, error) {
 	var r ControlnetTypes
@@ -64,7 +67,7 @@ func (c *ControlnetTypes) GetCache(api StableDiffusionAPI) (Cacheable, error) {
 }
 
 func (c *ControlnetTypes) apiGET(api StableDiffusionAPI) (Cacheable, error) {
-	cache, err := GET[ControlnetTypes](api.Client(), api.Host("/controlnet/control_types"))
+	cache, err := GET[ControlnetTypes](context.Background(), api.Client(), api.Host("/controlnet/control_types"))
 	if err != nil {
 		return nil, err
 	}
@@ -7,6 +7,7 @@
 package stable_diffusion_api
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 )
@@ -71,7 +72,7 @@ func (c *EmbeddingModels) Refresh(api StableDiffusionAPI) (Cacheable, error) {
 func (c *EmbeddingModels) apiGET(api StableDiffusionAPI) (Cacheable, error) {
 	getURL := api.Host("/sdapi/v1/embeddings")
 
-	embeddingResponse, err := GET[EmbeddingResponse](api.Client(), getURL)
+	embeddingResponse, err := GET[EmbeddingResponse](context.Background(), api.Client(), getURL)
 	if err != nil {
 		return nil, err
 	}
@@ -7,6 +7,7 @@
 package stable_diffusion_api
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 )
@@ -57,7 +58,7 @@ func (c *HypernetworkModels) Refresh(api StableDiffusionAPI) (Cacheable, error)
 func (c *HypernetworkModels) apiGET(api StableDiffusionAPI) (Cacheable, error) {
 	getURL := api.Host("/sdapi/v1/hypernetworks")
 
-	cache, err := GET[HypernetworkModels](api.Client(), getURL)
+	cache, err := GET[HypernetworkModels](context.Background(), api.Client(), getURL)
 	if err != nil {
 		return nil, err
 	}
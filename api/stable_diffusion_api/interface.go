@@ -1,6 +1,7 @@
 package stable_diffusion_api
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/sahilm/fuzzy"
@@ -13,11 +14,11 @@ type StableDiffusionAPI interface {
 	RefreshCache(cache Cacheable) (Cacheable, error)
 	CachePreview(c Cacheable) (Cacheable, error)
 
-	TextToImageRequest(req *entities.TextToImageRequest) (*entities.TextToImageResponse, error)
-	TextToImageRaw(req []byte) (*entities.TextToImageResponse, error)
-	ImageToImageRequest(req *entities.ImageToImageRequest) (*entities.ImageToImageResponse, error)
-	UpscaleImage(upscaleReq *UpscaleRequest) (*UpscaleResponse, error)
-	GetCurrentProgress() (*ProgressResponse, error)
+	TextToImageRequest(ctx context.Context, req *entities.TextToImageRequest) (*entities.TextToImageResponse, error)
+	TextToImageRaw(ctx context.Context, req []byte) (*entities.TextToImageResponse, error)
+	ImageToImageRequest(ctx context.Context, req *entities.ImageToImageRequest) (*entities.ImageToImageResponse, error)
+	UpscaleImage(ctx context.Context, upscaleReq *UpscaleRequest) (*UpscaleResponse, error)
+	GetCurrentProgress(ctx context.Context) (*ProgressResponse, error)
 	GetProgress() (*Progress, error)
 
 	UpdateConfiguration(config entities.Config) error
@@ -27,12 +28,18 @@ type StableDiffusionAPI interface {
 	GetVAE() (*string, error)
 	GetHypernetwork() (*string, error)
 
-	GetMemory() (*entities.Memory, error)
-	GetMemoryReadable() (*entities.ReadableMemory, error)
-	GetVRAMReadable() (*entities.ReadableMemory, error)
+	GetMemory(ctx context.Context) (*entities.Memory, error)
+	GetMemoryReadable(ctx context.Context) (*entities.ReadableMemory, error)
+	GetVRAMReadable(ctx context.Context) (*entities.ReadableMemory, error)
+
+	// Capabilities probes which features the backend serves
+	Capabilities(ctx context.Context) (Capabilities, error)
+	// Concurrency reports the contention of the requests limited by Config.MaxConcurrent
+	Concurrency() []ConcurrencyStats
 
 	Client() *http.Client
 	Host(...string) string
+	SetHost(host string)
 
 	Interrupt() error
 }
@@ -0,0 +1,128 @@
+package stable_diffusion_api
+
+import (
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ConcurrencyStats describe how requests to a host queued for a slot, see Config.MaxConcurrent
+type ConcurrencyStats struct {
+	Host     string `json:"host"`
+	Limit    int    `json:"limit"`
+	InFlight int    `json:"in_flight"`
+	Waiting  int    `json:"waiting"`
+	// Requests is how many requests were sent, Contended how many of them had to wait for a slot
+	Requests  int64 `json:"requests"`
+	Contended int64 `json:"contended"`
+	// WaitTime is the total time requests waited for a slot, MaxWait the longest single wait
+	WaitTime time.Duration `json:"wait_time_ns"`
+	MaxWait  time.Duration `json:"max_wait_ns"`
+}
+
+// limitTransport allows at most limit requests in flight per host, the others wait for a slot in the order they
+// came. A slot is held until the response body is closed, so a streamed generation counts until it's read.
+type limitTransport struct {
+	base  http.RoundTripper
+	limit int
+
+	mu    sync.Mutex
+	hosts map[string]*hostSlots
+}
+
+type hostSlots struct {
+	slots   chan struct{}
+	waiting atomic.Int64
+
+	requests  atomic.Int64
+	contended atomic.Int64
+	waitTime  atomic.Int64
+	maxWait   atomic.Int64
+}
+
+func newLimitTransport(base http.RoundTripper, limit int) *limitTransport {
+	return &limitTransport{base: base, limit: limit, hosts: make(map[string]*hostSlots)}
+}
+
+func (t *limitTransport) slotsOf(host string) *hostSlots {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	h, ok := t.hosts[host]
+	if !ok {
+		h = &hostSlots{slots: make(chan struct{}, t.limit)}
+		t.hosts[host] = h
+	}
+	return h
+}
+
+func (t *limitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	h := t.slotsOf(req.URL.Host)
+	h.requests.Add(1)
+
+	select {
+	case h.slots <- struct{}{}:
+	default:
+		h.contended.Add(1)
+		h.waiting.Add(1)
+		start := time.Now()
+		select {
+		case h.slots <- struct{}{}:
+			h.waiting.Add(-1)
+		case <-req.Context().Done():
+			h.waiting.Add(-1)
+			return nil, req.Context().Err()
+		}
+		waited := int64(time.Since(start))
+		h.waitTime.Add(waited)
+		for current := h.maxWait.Load(); waited > current && !h.maxWait.CompareAndSwap(current, waited); {
+			current = h.maxWait.Load()
+		}
+	}
+
+	var once sync.Once
+	release := func() { once.Do(func() { <-h.slots }) }
+
+	response, err := t.base.RoundTrip(req)
+	if err != nil || response.Body == nil {
+		release()
+		return response, err
+	}
+	response.Body = &releaseBody{ReadCloser: response.Body, release: release}
+	return response, nil
+}
+
+// Stats returns the contention of every host requests were sent to, sorted by host
+func (t *limitTransport) Stats() []ConcurrencyStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stats := make([]ConcurrencyStats, 0, len(t.hosts))
+	for host, h := range t.hosts {
+		stats = append(stats, ConcurrencyStats{
+			Host:      host,
+			Limit:     t.limit,
+			InFlight:  len(h.slots),
+			Waiting:   int(h.waiting.Load()),
+			Requests:  h.requests.Load(),
+			Contended: h.contended.Load(),
+			WaitTime:  time.Duration(h.waitTime.Load()),
+			MaxWait:   time.Duration(h.maxWait.Load()),
+		})
+	}
+	slices.SortFunc(stats, func(a, b ConcurrencyStats) int { return strings.Compare(a.Host, b.Host) })
+	return stats
+}
+
+// releaseBody frees the slot of its request once the body is closed
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releaseBody) Close() error {
+	defer b.release()
+	return b.ReadCloser.Close()
+}
@@ -8,6 +8,7 @@ package stable_diffusion_api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"regexp"
@@ -457,7 +458,7 @@ func (c *LoraModels) GetCache(api StableDiffusionAPI) (Cacheable, error) {
 func (c *LoraModels) Refresh(api StableDiffusionAPI) (Cacheable, error) {
 	postURL := api.Host("/sdapi/v1/refresh-loras")
 
-	err := POST[error](api.Client(), postURL, nil, nil)
+	err := POST[error](Idempotent(context.Background()), api.Client(), postURL, nil, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -468,7 +469,7 @@ func (c *LoraModels) Refresh(api StableDiffusionAPI) (Cacheable, error) {
 func (c *LoraModels) apiGET(api StableDiffusionAPI) (Cacheable, error) {
 	getURL := api.Host("/sdapi/v1/loras")
 
-	lora, err := GET[LoraModels](api.Client(), getURL)
+	lora, err := GET[LoraModels](context.Background(), api.Client(), getURL)
 	if err != nil {
 		return nil, err
 	}
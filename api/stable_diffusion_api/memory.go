@@ -1,15 +1,17 @@
 package stable_diffusion_api
 
 import (
+	"context"
+
 	"github.com/shirou/gopsutil/mem"
 
 	"stable_diffusion_bot/entities"
 )
 
-func (api *apiImplementation) GetMemory() (*entities.Memory, error) {
+func (api *apiImplementation) GetMemory(ctx context.Context) (*entities.Memory, error) {
 	getURL := "/sdapi/v1/memory"
 
-	memory, err := GET[entities.Memory](api.Client(), api.Host(getURL))
+	memory, err := GET[entities.Memory](ctx, api.progressClient, api.Host(getURL))
 	if err != nil {
 		return nil, err
 	}
@@ -17,8 +19,8 @@ func (api *apiImplementation) GetMemory() (*entities.Memory, error) {
 	return memory, nil
 }
 
-func (api *apiImplementation) GetMemoryReadable() (*entities.ReadableMemory, error) {
-	memory, err := api.GetMemory()
+func (api *apiImplementation) GetMemoryReadable(ctx context.Context) (*entities.ReadableMemory, error) {
+	memory, err := api.GetMemory(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -26,13 +28,14 @@ func (api *apiImplementation) GetMemoryReadable() (*entities.ReadableMemory, err
 	return memory.RAM.Readable(), nil
 }
 
-func (api *apiImplementation) GetVRAMReadable() (*entities.ReadableMemory, error) {
-	memory, err := api.GetMemory()
+// GetVRAMReadable returns nil when the backend doesn't report the memory of its GPU, like on DirectML and MPS
+func (api *apiImplementation) GetVRAMReadable(ctx context.Context) (*entities.ReadableMemory, error) {
+	memory, err := api.GetMemory(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	return memory.Cuda.System.Readable(), nil
+	return memory.Cuda.Readable(), nil
 }
 
 // GetMemory returns the current memory usage of the system and the GPU as returned by the system, not the API.
@@ -6,7 +6,10 @@
 
 package stable_diffusion_api
 
-import "encoding/json"
+import (
+	"context"
+	"encoding/json"
+)
 
 func UnmarshalProgress(data []byte) (Progress, error) {
 	var r Progress
@@ -42,7 +45,7 @@ type State struct {
 }
 
 func (api *apiImplementation) GetProgress() (*Progress, error) {
-	progress, err := GET[Progress](api.Client(), api.Host("/progress"))
+	progress, err := GET[Progress](context.Background(), api.progressClient, api.Host("/progress"))
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,139 @@
+package stable_diffusion_api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// RetryPolicy is how requests to the API are retried. GET requests and requests marked with Idempotent are retried
+// on connection errors and on 429, 502, 503 and 504. Other POST requests, like generations, are only retried when
+// the connection failed before the request reached the API, so a generation is never started twice.
+type RetryPolicy struct {
+	// Attempts is the most times a request is sent, 1 disables retries. Default is 3
+	Attempts int
+	// Delay before the first retry, doubled after each retry with up to 50% jitter. Default is 500ms
+	Delay time.Duration
+	// MaxDelay caps the delay between retries. Default is 10s
+	MaxDelay time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{Attempts: 3, Delay: 500 * time.Millisecond, MaxDelay: 10 * time.Second}
+
+var retryStatuses = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+type idempotentKey struct{}
+type retriesKey struct{}
+
+// Idempotent marks POST requests made with ctx as safe to send again, like refreshing caches or setting options
+func Idempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, idempotentKey{}, true)
+}
+
+// withRetryCount counts the retries of the requests made with the returned context in *retries
+func withRetryCount(ctx context.Context, retries *int) context.Context {
+	return context.WithValue(ctx, retriesKey{}, retries)
+}
+
+// retryTransport retries requests according to policy
+type retryTransport struct {
+	base   http.RoundTripper
+	policy RetryPolicy
+}
+
+func newRetryTransport(base http.RoundTripper, policy RetryPolicy) *retryTransport {
+	if policy.Attempts <= 0 {
+		policy.Attempts = DefaultRetryPolicy.Attempts
+	}
+	if policy.Delay <= 0 {
+		policy.Delay = DefaultRetryPolicy.Delay
+	}
+	if policy.MaxDelay <= 0 {
+		policy.MaxDelay = DefaultRetryPolicy.MaxDelay
+	}
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &retryTransport{base: base, policy: policy}
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	idempotent := req.Method == http.MethodGet || req.Method == http.MethodHead || ctx.Value(idempotentKey{}) != nil
+	retries, _ := ctx.Value(retriesKey{}).(*int)
+
+	delay := t.policy.Delay
+	for attempt := 1; ; attempt++ {
+		response, err := t.base.RoundTrip(req)
+
+		retry := attempt < t.policy.Attempts && (req.Body == nil || req.GetBody != nil)
+		switch {
+		case err != nil:
+			retry = retry && (idempotent || notSent(err)) && ctx.Err() == nil
+		case slices.Contains(retryStatuses, response.StatusCode):
+			retry = retry && idempotent
+		default:
+			retry = false
+		}
+		if !retry {
+			return response, err
+		}
+
+		if response != nil {
+			io.Copy(io.Discard, response.Body)
+			response.Body.Close()
+		}
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(ctx)
+			req.Body = body
+		}
+
+		// full jitter on the upper half so concurrent retries spread out without retrying too early
+		wait := delay/2 + rand.N(delay/2+1)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+		delay = min(delay*2, t.policy.MaxDelay)
+		if retries != nil {
+			*retries++
+		}
+	}
+}
+
+// notSent reports whether err happened before the request reached the API, so even a generation is safe to retry
+func notSent(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// retriedError adds the number of retries to err
+func retriedError(err error, retries int) error {
+	if err == nil || retries == 0 {
+		return err
+	}
+	return fmt.Errorf("%w (after %d %s)", err, retries, plural(retries, "retry", "retries"))
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
@@ -0,0 +1,213 @@
+package stable_diffusion_api
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sahilm/fuzzy"
+)
+
+// SamplerName is a sampler the backend serves, see ParseSampler
+type SamplerName string
+
+// SchedulerName is a scheduler the backend serves, see ParseScheduler
+type SchedulerName string
+
+type Sampler struct {
+	Name    string            `json:"name"`
+	Aliases []string          `json:"aliases"`
+	Options map[string]string `json:"options"`
+}
+
+type Samplers []Sampler
+
+func (c Samplers) String(i int) string {
+	return c[i].Name
+}
+
+func (c Samplers) Len() int {
+	return len(c)
+}
+
+var SamplerCache *Samplers
+
+// GetCache returns var SamplerCache *Samplers as a Cacheable. Assert using cache.(*Samplers)
+func (c *Samplers) GetCache(api StableDiffusionAPI) (Cacheable, error) {
+	if c != nil {
+		return c, nil
+	}
+	if SamplerCache != nil {
+		return SamplerCache, nil
+	}
+	return c.apiGET(api)
+}
+
+// Refresh fetches the samplers again, the API has no endpoint to reload them
+func (c *Samplers) Refresh(api StableDiffusionAPI) (Cacheable, error) {
+	return c.apiGET(api)
+}
+
+func (c *Samplers) apiGET(api StableDiffusionAPI) (Cacheable, error) {
+	getURL := api.Host("/sdapi/v1/samplers")
+
+	samplers, err := GET[Samplers](context.Background(), api.Client(), getURL)
+	if err != nil {
+		return nil, err
+	}
+	SamplerCache = samplers
+
+	return SamplerCache, nil
+}
+
+type Scheduler struct {
+	Name           string   `json:"name"`
+	Label          string   `json:"label"`
+	Aliases        []string `json:"aliases"`
+	DefaultRho     float64  `json:"default_rho"`
+	NeedInnerModel bool     `json:"need_inner_model"`
+}
+
+type Schedulers []Scheduler
+
+func (c Schedulers) String(i int) string {
+	return c[i].Label
+}
+
+func (c Schedulers) Len() int {
+	return len(c)
+}
+
+// SchedulerCache is nil on backends older than 1.9, which pick the scheduler from the sampler name
+var SchedulerCache *Schedulers
+
+// GetCache returns var SchedulerCache *Schedulers as a Cacheable. Assert using cache.(*Schedulers)
+func (c *Schedulers) GetCache(api StableDiffusionAPI) (Cacheable, error) {
+	if c != nil {
+		return c, nil
+	}
+	if SchedulerCache != nil {
+		return SchedulerCache, nil
+	}
+	return c.apiGET(api)
+}
+
+// Refresh fetches the schedulers again, the API has no endpoint to reload them
+func (c *Schedulers) Refresh(api StableDiffusionAPI) (Cacheable, error) {
+	return c.apiGET(api)
+}
+
+func (c *Schedulers) apiGET(api StableDiffusionAPI) (Cacheable, error) {
+	getURL := api.Host("/sdapi/v1/schedulers")
+
+	schedulers, err := GET[Schedulers](context.Background(), api.Client(), getURL)
+	if err != nil {
+		return nil, err
+	}
+	SchedulerCache = schedulers
+
+	return SchedulerCache, nil
+}
+
+// UnknownValueError is returned for a sampler or scheduler the backend doesn't serve
+type UnknownValueError struct {
+	Kind        string
+	Value       string
+	Suggestions []string
+}
+
+func (e *UnknownValueError) Error() string {
+	if len(e.Suggestions) == 0 {
+		return fmt.Sprintf("unknown %s `%s`", e.Kind, e.Value)
+	}
+	return fmt.Sprintf("unknown %s `%s`, did you mean `%s`?", e.Kind, e.Value, strings.Join(e.Suggestions, "`, `"))
+}
+
+// maxSuggestions is how many close names an UnknownValueError suggests
+const maxSuggestions = 3
+
+func suggest(kind, value string, source fuzzy.Source) *UnknownValueError {
+	err := &UnknownValueError{Kind: kind, Value: value}
+	for _, match := range fuzzy.FindFrom(value, source) {
+		if len(err.Suggestions) == maxSuggestions {
+			break
+		}
+		err.Suggestions = append(err.Suggestions, match.Str)
+	}
+	if len(err.Suggestions) == 0 {
+		for i := 0; i < source.Len() && i < maxSuggestions; i++ {
+			err.Suggestions = append(err.Suggestions, source.String(i))
+		}
+	}
+	return err
+}
+
+// ParseSampler returns the name the backend uses for a sampler name or alias, ignoring case.
+// Any name is accepted until the samplers are cached.
+func ParseSampler(name string) (SamplerName, error) {
+	if SamplerCache == nil {
+		return SamplerName(name), nil
+	}
+	for _, sampler := range *SamplerCache {
+		if strings.EqualFold(sampler.Name, name) {
+			return SamplerName(sampler.Name), nil
+		}
+		for _, alias := range sampler.Aliases {
+			if strings.EqualFold(alias, name) {
+				return SamplerName(sampler.Name), nil
+			}
+		}
+	}
+	return "", suggest("sampler", name, *SamplerCache)
+}
+
+// ParseScheduler returns the name the backend uses for a scheduler name, label or alias, ignoring case.
+// Any name is accepted until the schedulers are cached.
+func ParseScheduler(name string) (SchedulerName, error) {
+	if SchedulerCache == nil {
+		return SchedulerName(name), nil
+	}
+	if scheduler, ok := SchedulerCache.lookup(name); ok {
+		return SchedulerName(scheduler.Name), nil
+	}
+	return "", suggest("scheduler", name, *SchedulerCache)
+}
+
+func (c Schedulers) lookup(name string) (Scheduler, bool) {
+	for _, scheduler := range c {
+		if strings.EqualFold(scheduler.Name, name) || strings.EqualFold(scheduler.Label, name) {
+			return scheduler, true
+		}
+		for _, alias := range scheduler.Aliases {
+			if strings.EqualFold(alias, name) {
+				return scheduler, true
+			}
+		}
+	}
+	return Scheduler{}, false
+}
+
+// SplitSampler splits the names from before 1.9 that end with their scheduler, e.g. "DPM++ 2M Karras" into
+// "DPM++ 2M" and "karras". ok is false if the name doesn't end with a scheduler label or the schedulers aren't cached.
+func SplitSampler(name string) (SamplerName, SchedulerName, bool) {
+	if SchedulerCache == nil {
+		return "", "", false
+	}
+	for _, scheduler := range *SchedulerCache {
+		for _, suffix := range append([]string{scheduler.Label}, scheduler.Aliases...) {
+			if suffix == "" || len(name) <= len(suffix)+1 {
+				continue
+			}
+			prefix, found := strings.CutSuffix(strings.ToLower(name), " "+strings.ToLower(suffix))
+			if !found {
+				continue
+			}
+			sampler, err := ParseSampler(name[:len(prefix)])
+			if err != nil {
+				continue
+			}
+			return sampler, SchedulerName(scheduler.Name), true
+		}
+	}
+	return "", "", false
+}
@@ -2,6 +2,7 @@ package stable_diffusion_api
 
 import (
 	"bytes"
+	"cmp"
 	"context"
 	"encoding/json"
 	"errors"
@@ -11,19 +12,60 @@ import (
 	"net/http"
 	"slices"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"stable_diffusion_bot/apierror"
 	"stable_diffusion_bot/discord_bot/handlers"
 	"stable_diffusion_bot/entities"
 )
 
 type apiImplementation struct {
-	host   string
-	client *http.Client
+	host atomic.Pointer[string]
+
+	// limit bounds the requests in flight, nil if they aren't limited
+	limit *limitTransport
+
+	// client is used for requests that aren't progress, options or generations
+	client           *http.Client
+	progressClient   *http.Client
+	optionsClient    *http.Client
+	generationClient *http.Client
 }
 
 type Config struct {
 	Host string
+	// Retry is how failed requests are retried. Default is DefaultRetryPolicy
+	Retry RetryPolicy
+	// Timeouts of each kind of request, including retries. Default is DefaultTimeouts
+	Timeouts Timeouts
+	// Auth is the user:password of an API started with --api-auth, sent with every request. Default sends none
+	Auth string
+	// Transport sends the requests, e.g. through a proxy. Default is http.DefaultTransport
+	Transport http.RoundTripper
+	// MaxConcurrent is the most requests in flight to the host at once, including progress polls. Default is 0,
+	// which doesn't limit them
+	MaxConcurrent int
+}
+
+// Timeouts bound requests by what they do, so a dead backend is noticed by the next progress poll instead of
+// after a timeout long enough for a generation
+type Timeouts struct {
+	// Request is the timeout of requests not covered below, like listing models. Default is 30s
+	Request time.Duration
+	// Progress is the timeout of progress and memory polling. Default is 5s
+	Progress time.Duration
+	// Options is the timeout of reading and changing options, which includes loading another checkpoint. Default is 1m
+	Options time.Duration
+	// Generation is the timeout of text to image, image to image and upscale requests. Default is 10m
+	Generation time.Duration
+}
+
+var DefaultTimeouts = Timeouts{
+	Request:    30 * time.Second,
+	Progress:   5 * time.Second,
+	Options:    time.Minute,
+	Generation: 10 * time.Minute,
 }
 
 func New(cfg Config) (StableDiffusionAPI, error) {
@@ -31,21 +73,73 @@ func New(cfg Config) (StableDiffusionAPI, error) {
 		return nil, errors.New("missing host")
 	}
 
-	return &apiImplementation{
-		host: cfg.Host,
-		client: &http.Client{
-			Timeout: 10 * time.Minute,
-		},
-	}, nil
+	timeouts := cfg.Timeouts
+	timeouts.Request = cmp.Or(timeouts.Request, DefaultTimeouts.Request)
+	timeouts.Progress = cmp.Or(timeouts.Progress, DefaultTimeouts.Progress)
+	timeouts.Options = cmp.Or(timeouts.Options, DefaultTimeouts.Options)
+	timeouts.Generation = cmp.Or(timeouts.Generation, DefaultTimeouts.Generation)
+
+	base := cfg.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if cfg.Auth != "" {
+		user, password, _ := strings.Cut(cfg.Auth, ":")
+		base = &basicAuthTransport{base: base, user: user, password: password}
+	}
+	// under the retries, so a request waiting to be retried doesn't hold a slot
+	var limit *limitTransport
+	if cfg.MaxConcurrent > 0 {
+		limit = newLimitTransport(base, cfg.MaxConcurrent)
+		base = limit
+	}
+
+	// the clients share the transport and its connections
+	transport := newRetryTransport(base, cfg.Retry)
+	api := &apiImplementation{
+		limit:            limit,
+		client:           &http.Client{Timeout: timeouts.Request, Transport: transport},
+		progressClient:   &http.Client{Timeout: timeouts.Progress, Transport: transport},
+		optionsClient:    &http.Client{Timeout: timeouts.Options, Transport: transport},
+		generationClient: &http.Client{Timeout: timeouts.Generation, Transport: transport},
+	}
+	api.host.Store(&cfg.Host)
+	return api, nil
+}
+
+// Concurrency returns how requests queued for a slot of MaxConcurrent, nil if they aren't limited
+func (api *apiImplementation) Concurrency() []ConcurrencyStats {
+	if api.limit == nil {
+		return nil
+	}
+	return api.limit.Stats()
+}
+
+// basicAuthTransport sends the credentials of --api-auth with every request
+type basicAuthTransport struct {
+	base           http.RoundTripper
+	user, password string
+}
+
+func (t *basicAuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.SetBasicAuth(t.user, t.password)
+	return t.base.RoundTrip(req)
 }
 
 func (api *apiImplementation) Client() *http.Client { return api.client }
 func (api *apiImplementation) Host(url ...string) string {
+	host := *api.host.Load()
 	if len(url) > 0 {
-		url = slices.Insert(url, 0, api.host)
+		url = slices.Insert(url, 0, host)
 		return strings.Join(url, "")
 	}
-	return api.host
+	return host
+}
+
+// SetHost points the API at another host, requests already sent finish on the previous one
+func (api *apiImplementation) SetHost(host string) {
+	api.host.Store(&host)
 }
 
 // Deprecated: Use the entities.ImageToImageResponse instead
@@ -112,8 +206,10 @@ func (api *apiImplementation) PopulateCache() (errors []error) {
 		VAECache,
 		HypernetworkCache,
 		EmbeddingCache,
+		SamplerCache,
+		SchedulerCache,
 	}
-	if !handlers.CheckAPIAlive(api.host) {
+	if !handlers.CheckAPIAlive(api.Host()) {
 		return []error{fmt.Errorf("could not populate caches: %s", handlers.DeadAPI)}
 	}
 	for _, cache := range caches {
@@ -137,17 +233,17 @@ func (api *apiImplementation) RefreshCache(cache Cacheable) (Cacheable, error) {
 	return cache.Refresh(api)
 }
 
-func (api *apiImplementation) TextToImageRequest(req *entities.TextToImageRequest) (*entities.TextToImageResponse, error) {
+func (api *apiImplementation) TextToImageRequest(ctx context.Context, req *entities.TextToImageRequest) (*entities.TextToImageResponse, error) {
 	jsonData, err := req.Marshal()
 	if err != nil {
 		return nil, err
 	}
 
-	return api.TextToImageRaw(jsonData)
+	return api.TextToImageRaw(ctx, jsonData)
 }
 
-func (api *apiImplementation) TextToImageRaw(req []byte) (*entities.TextToImageResponse, error) {
-	if !handlers.CheckAPIAlive(api.host) {
+func (api *apiImplementation) TextToImageRaw(ctx context.Context, req []byte) (*entities.TextToImageResponse, error) {
+	if !handlers.CheckAPIAlive(api.Host()) {
 		return nil, errors.New(handlers.DeadAPI)
 	}
 	if req == nil {
@@ -155,7 +251,7 @@ func (api *apiImplementation) TextToImageRaw(req []byte) (*entities.TextToImageR
 	}
 
 	out := new(bytes.Buffer)
-	err := Do(api.client, http.MethodPost, api.Host("/sdapi/v1/txt2img"), bytes.NewReader(req), out)
+	err := Do(ctx, api.generationClient, http.MethodPost, api.Host("/sdapi/v1/txt2img"), bytes.NewReader(req), out)
 	if err != nil {
 		return nil, err
 	}
@@ -163,8 +259,8 @@ func (api *apiImplementation) TextToImageRaw(req []byte) (*entities.TextToImageR
 	return entities.JSONToTextToImageResponse(out.Bytes())
 }
 
-func (api *apiImplementation) ImageToImageRequest(req *entities.ImageToImageRequest) (*entities.ImageToImageResponse, error) {
-	if !handlers.CheckAPIAlive(api.host) {
+func (api *apiImplementation) ImageToImageRequest(ctx context.Context, req *entities.ImageToImageRequest) (*entities.ImageToImageResponse, error) {
+	if !handlers.CheckAPIAlive(api.Host()) {
 		return nil, errors.New(handlers.DeadAPI)
 	}
 	if req == nil {
@@ -172,7 +268,7 @@ func (api *apiImplementation) ImageToImageRequest(req *entities.ImageToImageRequ
 	}
 
 	response := new(entities.ImageToImageResponse)
-	err := POST(api.client, api.Host("/sdapi/v1/img2img"), req, response)
+	err := POST(ctx, api.generationClient, api.Host("/sdapi/v1/img2img"), req, response)
 	if err != nil {
 		return nil, err
 	}
@@ -196,10 +292,14 @@ type upscaleJSONRequest struct {
 
 type UpscaleResponse struct {
 	Image string `json:"image"`
+	// Infotext is the parameters of the regenerated image followed by the upscale parameters
+	Infotext string `json:"-"`
+	// Original is the base64 encoded regenerated image before upscaling
+	Original string `json:"-"`
 }
 
-func (api *apiImplementation) UpscaleImage(upscaleReq *UpscaleRequest) (*UpscaleResponse, error) {
-	if !handlers.CheckAPIAlive(api.host) {
+func (api *apiImplementation) UpscaleImage(ctx context.Context, upscaleReq *UpscaleRequest) (*UpscaleResponse, error) {
+	if !handlers.CheckAPIAlive(api.Host()) {
 		return nil, errors.New(handlers.DeadAPI)
 	}
 	if upscaleReq == nil {
@@ -212,7 +312,7 @@ func (api *apiImplementation) UpscaleImage(upscaleReq *UpscaleRequest) (*Upscale
 	}
 	regenerateRequest.NIter = 1
 
-	regeneratedImage, err := api.TextToImageRequest(regenerateRequest)
+	regeneratedImage, err := api.TextToImageRequest(ctx, regenerateRequest)
 	if err != nil {
 		return nil, err
 	}
@@ -229,23 +329,31 @@ func (api *apiImplementation) UpscaleImage(upscaleReq *UpscaleRequest) (*Upscale
 	}
 
 	upscaleResponse := new(UpscaleResponse)
-	err = POST(api.client, api.Host("/sdapi/v1/extra-single-image"), jsonReq, upscaleResponse)
+	err = POST(ctx, api.generationClient, api.Host("/sdapi/v1/extra-single-image"), jsonReq, upscaleResponse)
 	if err != nil {
 		return nil, err
 	}
 
+	upscaleResponse.Original = regeneratedImage.Images[0]
+	if infotexts := regeneratedImage.Info.Infotexts; len(infotexts) > 0 {
+		upscaleResponse.Infotext = fmt.Sprintf("%s, Postprocess upscale by: %d, Postprocess upscaler: %s",
+			infotexts[0], upscaleReq.UpscalingResize, upscaleReq.Upscaler1)
+	}
+
 	return upscaleResponse, nil
 }
 
 type ProgressResponse struct {
 	Progress    float64 `json:"progress"`
 	EtaRelative float64 `json:"eta_relative"`
+	// CurrentImage is the base64 encoded live preview, only set if live previews are enabled in the WebUI
+	CurrentImage *string `json:"current_image"`
 }
 
-func (api *apiImplementation) GetCurrentProgress() (*ProgressResponse, error) {
+func (api *apiImplementation) GetCurrentProgress(ctx context.Context) (*ProgressResponse, error) {
 	getURL := api.Host("/sdapi/v1/progress")
 
-	progress, err := GET[ProgressResponse](api.client, getURL)
+	progress, err := GET[ProgressResponse](ctx, api.progressClient, getURL)
 	if err != nil {
 		return nil, err
 	}
@@ -260,9 +368,9 @@ type POSTConfig struct {
 
 // GET is a generic function to make a GET request to the API
 // It returns the response body as the specified type
-func GET[T any](client *http.Client, url string) (*T, error) {
+func GET[T any](ctx context.Context, client *http.Client, url string) (*T, error) {
 	v := new(T)
-	err := Do(client, http.MethodGet, url, nil, v)
+	err := Do(ctx, client, http.MethodGet, url, nil, v)
 	if err != nil {
 		return nil, err
 	}
@@ -271,9 +379,9 @@ func GET[T any](client *http.Client, url string) (*T, error) {
 
 // POST is a generic function to make a POST request to the API
 // It writes to v the response body as the specified type
-func POST[T any](client *http.Client, url string, body any, v *T) error {
+func POST[T any](ctx context.Context, client *http.Client, url string, body any, v *T) error {
 	if body == nil {
-		return Do(client, http.MethodPost, url, nil, v)
+		return Do(ctx, client, http.MethodPost, url, nil, v)
 	}
 	var reader io.Reader
 	switch body := body.(type) {
@@ -288,14 +396,14 @@ func POST[T any](client *http.Client, url string, body any, v *T) error {
 		}
 		reader = writer
 	}
-	return Do(client, http.MethodPost, url, reader, v)
+	return Do(ctx, client, http.MethodPost, url, reader, v)
 }
 
-func Do(client *http.Client, method string, url string, body io.Reader, v any) error {
-	timeout, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
-	defer cancel()
-
-	request, err := http.NewRequestWithContext(timeout, method, url, body)
+// Do sends the request and decodes the response into v. Cancelling ctx aborts the request, the client timeout
+// still applies. Requests are retried by the transport of the client according to its RetryPolicy.
+func Do(ctx context.Context, client *http.Client, method string, url string, body io.Reader, v any) error {
+	var retries int
+	request, err := http.NewRequestWithContext(withRetryCount(ctx, &retries), method, url, body)
 	if err != nil {
 		return err
 	}
@@ -305,17 +413,13 @@ func Do(client *http.Client, method string, url string, body io.Reader, v any) e
 
 	response, err := client.Do(request)
 	if err != nil {
-		return err
+		return retriedError(apierror.Timeout(err), retries)
 	}
 	defer closeResponseBody(response.Body)
 
 	if response.StatusCode != http.StatusOK {
-		responseString := " (unknown error)"
 		body, _ := io.ReadAll(response.Body)
-		if len(body) > 0 {
-			responseString = fmt.Sprintf("\n```json\n%s\n```", body)
-		}
-		return fmt.Errorf("unexpected status code: `%s`%s", response.Status, responseString)
+		return retriedError(apierror.Parse(response.StatusCode, url, body), retries)
 	}
 
 	if v == nil {
@@ -339,11 +443,11 @@ func Do(client *http.Client, method string, url string, body io.Reader, v any) e
 }
 
 func (api *apiImplementation) UpdateConfiguration(config entities.Config) error {
-	if !handlers.CheckAPIAlive(api.host) {
+	if !handlers.CheckAPIAlive(api.Host()) {
 		return errors.New(handlers.DeadAPI)
 	}
 
-	err := POST(api.client, api.Host("/sdapi/v1/options"), config, (*map[string]any)(nil))
+	err := POST(Idempotent(context.Background()), api.optionsClient, api.Host("/sdapi/v1/options"), config, (*map[string]any)(nil))
 	if err != nil {
 		return err
 	}
@@ -359,11 +463,11 @@ func closeResponseBody(closer io.Closer) {
 
 // interrupt by posting to /sdapi/v1/interrupt using the POST() function
 func (api *apiImplementation) Interrupt() error {
-	if !handlers.CheckAPIAlive(api.host) {
+	if !handlers.CheckAPIAlive(api.Host()) {
 		return errors.New(handlers.DeadAPI)
 	}
 
-	err := POST[error](api.client, api.Host("/sdapi/v1/interrupt"), nil, nil)
+	err := POST[error](Idempotent(context.Background()), api.client, api.Host("/sdapi/v1/interrupt"), nil, nil)
 	if err != nil {
 		return err
 	}
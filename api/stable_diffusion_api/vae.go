@@ -7,6 +7,7 @@
 package stable_diffusion_api
 
 import (
+	"context"
 	"encoding/json"
 )
 
@@ -51,7 +52,7 @@ func (c *VAEModels) GetCache(api StableDiffusionAPI) (Cacheable, error) {
 func (c *VAEModels) Refresh(api StableDiffusionAPI) (Cacheable, error) {
 	postURL := api.Host("/sdapi/v1/refresh-vae")
 
-	err := POST[error](api.Client(), postURL, nil, nil)
+	err := POST[error](Idempotent(context.Background()), api.Client(), postURL, nil, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -62,7 +63,7 @@ func (c *VAEModels) Refresh(api StableDiffusionAPI) (Cacheable, error) {
 func (c *VAEModels) apiGET(api StableDiffusionAPI) (Cacheable, error) {
 	getURL := api.Host("/sdapi/v1/sd-vae")
 
-	vae, err := GET[VAEModels](api.Client(), getURL)
+	vae, err := GET[VAEModels](context.Background(), api.Client(), getURL)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,233 @@
+package apierror
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Error is a failure the backend explained. The error handlers show its Message and Fix instead of the response.
+type Error interface {
+	error
+	// Message tells members what went wrong
+	Message() string
+	// Fix suggests what to change, empty if there's nothing they can do
+	Fix() string
+}
+
+// FieldError is a field of the request the backend rejected
+type FieldError struct {
+	Field  string
+	Reason string
+}
+
+// ValidationError is returned when the backend rejects the values of a request
+type ValidationError struct {
+	Status int
+	Fields []FieldError
+	// Detail is the reason given without a field
+	Detail string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("backend rejected the request (%d): %s", e.Status, e.reasons())
+}
+
+func (e *ValidationError) reasons() string {
+	if len(e.Fields) == 0 {
+		return e.Detail
+	}
+	reasons := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		reasons[i] = fmt.Sprintf("`%s` %s", field.Field, field.Reason)
+	}
+	return strings.Join(reasons, "; ")
+}
+
+func (e *ValidationError) Message() string {
+	return "The backend rejected the request: " + e.reasons()
+}
+
+func (e *ValidationError) Fix() string {
+	if len(e.Fields) == 0 {
+		return "Check the options of the command and try again."
+	}
+	return "Change the fields above and try again."
+}
+
+// ExtensionMissingError is returned for scripts and routes of an extension the backend doesn't have
+type ExtensionMissingError struct {
+	Extension string
+}
+
+func (e *ExtensionMissingError) Error() string {
+	return fmt.Sprintf("backend is missing the %s extension", e.Extension)
+}
+
+func (e *ExtensionMissingError) Message() string {
+	return fmt.Sprintf("The backend doesn't have the `%s` extension.", e.Extension)
+}
+
+func (e *ExtensionMissingError) Fix() string {
+	return "Generate without the options of the extension, or ask the bot owner to install it."
+}
+
+// OutOfMemoryError is returned when the GPU of the backend ran out of memory
+type OutOfMemoryError struct {
+	Detail string
+}
+
+func (e *OutOfMemoryError) Error() string {
+	return "backend ran out of memory: " + e.Detail
+}
+
+func (e *OutOfMemoryError) Message() string {
+	return "The backend ran out of GPU memory."
+}
+
+func (e *OutOfMemoryError) Fix() string {
+	return "Try a smaller size, fewer images or a lower hires fix scale."
+}
+
+// TimeoutError is returned when the backend, or a proxy in front of it, gave up waiting for the generation
+type TimeoutError struct {
+	// Status is 0 when the bot stopped waiting
+	Status int
+}
+
+func (e *TimeoutError) Error() string {
+	if e.Status == 0 {
+		return "timed out waiting for the backend"
+	}
+	return fmt.Sprintf("backend timed out (%d)", e.Status)
+}
+
+func (e *TimeoutError) Message() string {
+	return "The backend took too long to respond."
+}
+
+func (e *TimeoutError) Fix() string {
+	return "Try again with fewer steps or a smaller size."
+}
+
+// StatusError is any other response that wasn't successful
+type StatusError struct {
+	Status int
+	// Detail is the reason given by the backend, or the body if it gave none
+	Detail string
+}
+
+func (e *StatusError) Error() string {
+	if e.Detail == "" {
+		return fmt.Sprintf("unexpected status code: `%d %s` (unknown error)", e.Status, http.StatusText(e.Status))
+	}
+	return fmt.Sprintf("unexpected status code: `%d %s`\n```\n%s\n```", e.Status, http.StatusText(e.Status), e.Detail)
+}
+
+// body holds the fields of the error responses of A1111 and NovelAI. A1111 returns FastAPI's
+// {"detail": [{"loc": [...], "msg": ...}]} for invalid requests, {"detail": "..."} for HTTP errors and
+// {"error": "OutOfMemoryError", "errors": "..."} for exceptions. NovelAI returns {"statusCode": 400, "message": "..."}.
+type body struct {
+	Detail  json.RawMessage `json:"detail"`
+	Error   string          `json:"error"`
+	Errors  string          `json:"errors"`
+	Message string          `json:"message"`
+}
+
+type fieldDetail struct {
+	Loc []any  `json:"loc"`
+	Msg string `json:"msg"`
+}
+
+// missingScript matches the reasons A1111 gives for scripts it doesn't have
+var missingScript = regexp.MustCompile(`(?i)(?:always on )?script '?([^']+?)'? not found`)
+
+// apiRoutes are served by the backend itself, other routes that aren't found belong to an extension
+var apiRoutes = []string{"/sdapi/", "/internal/", "/ai/"}
+
+// Parse returns the typed error for the response to rawURL
+func Parse(status int, rawURL string, data []byte) error {
+	var b body
+	_ = json.Unmarshal(data, &b)
+
+	var fields []fieldDetail
+	var detail string
+	if json.Unmarshal(b.Detail, &fields) != nil {
+		_ = json.Unmarshal(b.Detail, &detail)
+	}
+	reason := firstOf(b.Errors, detail, b.Message)
+
+	switch {
+	case status == http.StatusRequestTimeout, status == http.StatusGatewayTimeout, status == 524:
+		return &TimeoutError{Status: status}
+	case strings.EqualFold(b.Error, "OutOfMemoryError"), strings.Contains(strings.ToLower(reason), "out of memory"):
+		return &OutOfMemoryError{Detail: reason}
+	case missingScript.MatchString(reason):
+		return &ExtensionMissingError{Extension: missingScript.FindStringSubmatch(reason)[1]}
+	case status == http.StatusNotFound && extensionRoute(rawURL) != "":
+		return &ExtensionMissingError{Extension: extensionRoute(rawURL)}
+	case len(fields) > 0:
+		invalid := &ValidationError{Status: status}
+		for _, field := range fields {
+			invalid.Fields = append(invalid.Fields, FieldError{Field: fieldName(field.Loc), Reason: field.Msg})
+		}
+		return invalid
+	case (status == http.StatusBadRequest || status == http.StatusUnprocessableEntity) && reason != "":
+		return &ValidationError{Status: status, Detail: reason}
+	case reason != "":
+		return &StatusError{Status: status, Detail: reason}
+	default:
+		return &StatusError{Status: status, Detail: strings.TrimSpace(string(data))}
+	}
+}
+
+// Timeout returns a TimeoutError in place of err when the bot stopped waiting for the backend
+func Timeout(err error) error {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout() {
+		return fmt.Errorf("%w: %w", &TimeoutError{}, err)
+	}
+	return err
+}
+
+// extensionRoute returns the first segment of the path of rawURL when it isn't a route of the backend itself
+func extensionRoute(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	for _, route := range apiRoutes {
+		if strings.HasPrefix(parsed.Path, route) {
+			return ""
+		}
+	}
+	segment, _, _ := strings.Cut(strings.TrimPrefix(parsed.Path, "/"), "/")
+	return segment
+}
+
+// fieldName joins the location of a FastAPI error without the leading "body"
+func fieldName(loc []any) string {
+	var parts []string
+	for i, part := range loc {
+		if i == 0 && part == "body" && len(loc) > 1 {
+			continue
+		}
+		parts = append(parts, fmt.Sprint(part))
+	}
+	return strings.Join(parts, ".")
+}
+
+func firstOf(values ...string) string {
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			return value
+		}
+	}
+	return ""
+}
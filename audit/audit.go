@@ -0,0 +1,132 @@
+package audit
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// pendingEvents is how many events wait to be posted before new ones are dropped, so a slow channel can't hold up
+// generations
+const pendingEvents = 64
+
+type Kind string
+
+const (
+	ModelSwitched  Kind = "Model switched"
+	ConfigChanged  Kind = "Config changed"
+	QueuePaused    Kind = "Queue paused"
+	QueueResumed   Kind = "Queue resumed"
+	QuotaExceeded  Kind = "Quota exceeded"
+	ContentBlocked Kind = "Content blocked"
+
+	MaintenanceStarted Kind = "Maintenance started"
+	MaintenanceEnded   Kind = "Maintenance ended"
+)
+
+var colors = map[Kind]int{
+	ModelSwitched:  0x5865f2,
+	ConfigChanged:  0x5865f2,
+	QueuePaused:    0xfee75c,
+	QueueResumed:   0x57f287,
+	QuotaExceeded:  0xfee75c,
+	ContentBlocked: 0xed4245,
+
+	MaintenanceStarted: 0xfee75c,
+	MaintenanceEnded:   0x57f287,
+}
+
+// Event is something admins of a shared server should be able to look back on
+type Event struct {
+	Kind Kind
+	// Description is shown under the title, e.g. what was changed
+	Description string
+	// UserID of the member that caused the event, if any
+	UserID string
+	// GuildID the event happened in, if any
+	GuildID string
+	Fields  []*discordgo.MessageEmbedField
+}
+
+// auditLog posts events to the audit channel from a single goroutine
+type auditLog struct {
+	mu        sync.Mutex
+	session   *discordgo.Session
+	channelID string
+	events    chan Event
+	once      sync.Once
+}
+
+var audit = &auditLog{events: make(chan Event, pendingEvents)}
+
+// SetSession sets the session events are posted with, they're dropped until it's set
+func SetSession(session *discordgo.Session) {
+	audit.mu.Lock()
+	defer audit.mu.Unlock()
+	audit.session = session
+}
+
+// SetChannel sets the channel events are posted to, an empty ID disables the audit log
+func SetChannel(channelID string) {
+	audit.mu.Lock()
+	defer audit.mu.Unlock()
+	if channelID != audit.channelID && channelID != "" {
+		log.Printf("Posting audit events to channel %s", channelID)
+	}
+	audit.channelID = channelID
+}
+
+// Post queues event to be posted to the audit channel, it's only logged while no channel is set
+func Post(event Event) {
+	log.Printf("Audit: %s %s", event.Kind, event.Description)
+
+	audit.mu.Lock()
+	enabled := audit.session != nil && audit.channelID != ""
+	audit.mu.Unlock()
+	if !enabled {
+		return
+	}
+
+	audit.once.Do(func() { go audit.post() })
+	select {
+	case audit.events <- event:
+	default:
+		log.Printf("Dropping audit event %q, %d events are still waiting to be posted", event.Kind, pendingEvents)
+	}
+}
+
+func (a *auditLog) post() {
+	for event := range a.events {
+		a.mu.Lock()
+		session, channelID := a.session, a.channelID
+		a.mu.Unlock()
+		if session == nil || channelID == "" {
+			continue
+		}
+
+		if _, err := session.ChannelMessageSendEmbed(channelID, embed(event)); err != nil {
+			log.Printf("Error posting audit event %q to channel %s: %v", event.Kind, channelID, err)
+		}
+	}
+}
+
+func embed(event Event) *discordgo.MessageEmbed {
+	fields := slices.Clone(event.Fields)
+	if event.UserID != "" {
+		fields = append(fields, &discordgo.MessageEmbedField{Name: "Member", Value: fmt.Sprintf("<@%s>", event.UserID), Inline: true})
+	}
+	if event.GuildID != "" {
+		fields = append(fields, &discordgo.MessageEmbedField{Name: "Guild", Value: event.GuildID, Inline: true})
+	}
+	return &discordgo.MessageEmbed{
+		Title:       string(event.Kind),
+		Description: event.Description,
+		Color:       colors[event.Kind],
+		Fields:      fields,
+		Timestamp:   time.Now().Format(time.RFC3339),
+	}
+}
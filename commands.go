@@ -0,0 +1,323 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"stable_diffusion_bot/api/stable_diffusion_api"
+	"stable_diffusion_bot/config"
+	"stable_diffusion_bot/databases/sqlite"
+	"stable_diffusion_bot/discord_bot/handlers"
+	"stable_diffusion_bot/entities"
+	"stable_diffusion_bot/repositories/image_generations"
+	"stable_diffusion_bot/version"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Every subcommand reads the settings the same way as the bot: the config file, .env, the environment and the
+// flags after the subcommand, e.g. "migrate -db bot.sqlite", see config.Load.
+
+// program is the name usage and the flag sets of the subcommands are printed under
+const program = "stable_diffusion_bot"
+
+// subcommand is run when its name is the first argument, with the arguments after it
+type subcommand struct {
+	name  string
+	short string
+	run   func(name string, args []string) error
+}
+
+var subcommands = []subcommand{
+	{"run", "Start the bot", run},
+	{"register-commands", "Register the slash commands without starting the bot", func(name string, args []string) error {
+		return withApp(name, args, func(a *app) error { return a.bot.RegisterCommands() })
+	}},
+	{"deregister-commands", "Delete every registered slash command, in the guild if one is set or globally", func(name string, args []string) error {
+		return withApp(name, args, func(a *app) error { return a.bot.DeregisterCommands() })
+	}},
+	{"migrate", "Run the database migrations and exit", migrate},
+	{"export", "Export generations as JSON Lines, oldest first, skipping deleted ones", export},
+	{"version", "Print the version, commit and build date", printVersion},
+	{"doctor", "Check the configuration, database, Discord token and backends", doctor},
+}
+
+// execute runs the subcommand named by the first argument. Without one the bot is started like with run, so
+// existing flags keep working.
+func execute(args []string) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "help", "-h", "-help", "--help":
+			printUsage(os.Stdout)
+			return nil
+		}
+		for _, command := range subcommands {
+			if command.name == args[0] {
+				return command.run(program+" "+command.name, args[1:])
+			}
+		}
+		if !strings.HasPrefix(args[0], "-") {
+			printUsage(os.Stderr)
+			return fmt.Errorf("unknown command %q", args[0])
+		}
+	}
+	return run(program, args)
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, "Discord bot for Stable Diffusion, NovelAI and LLMs.\n\nUsage:\n  %s [command] [flags]\n\nCommands:\n", program)
+	for _, command := range subcommands {
+		fmt.Fprintf(w, "  %-20s %s\n", command.name, command.short)
+	}
+	fmt.Fprintln(w, "\nWithout a command the bot is started like with run. Pass -h after a command to list the settings it reads.")
+}
+
+func printVersion(name string, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("%s takes no arguments", name)
+	}
+	info := version.Get()
+	fmt.Printf("%s %s\ncommit: %s\nbuilt: %s\n%s\n",
+		program, info.Version, cmp.Or(info.Commit, "unknown"), cmp.Or(info.Date, "unknown"), info.Go)
+	return nil
+}
+
+// withApp loads the configuration and builds the bot without connecting to the gateway or the API
+func withApp(name string, args []string, fn func(*app) error) error {
+	cfg, err := config.Load(name, args)
+	if err != nil {
+		return fmt.Errorf("invalid configuration:\n%w", err)
+	}
+
+	a, err := newApp(context.Background(), cfg)
+	if err != nil {
+		return err
+	}
+	defer a.db.Close()
+
+	return fn(a)
+}
+
+func migrate(name string, args []string) error {
+	cfg, err := config.LoadDatabase(name, args, nil)
+	if err != nil {
+		return fmt.Errorf("invalid configuration:\n%w", err)
+	}
+
+	ctx := context.Background()
+	db, err := openDatabase(ctx, cfg, false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	current, _, err := sqlite.Version(ctx, db)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Database is at version %d\n", current)
+	return nil
+}
+
+func export(name string, args []string) error {
+	var out, guildID, memberID string
+	var since time.Duration
+	cfg, err := config.LoadDatabase(name, args, func(flags *flag.FlagSet) {
+		flags.StringVar(&out, "out", "-", "File to write the generations to, - writes to stdout")
+		flags.StringVar(&guildID, "export-guild", "", "Only export generations made in this guild")
+		flags.StringVar(&memberID, "export-member", "", "Only export generations made by this member")
+		flags.DurationVar(&since, "since", 0, "Only export generations made in this long, e.g. 720h. Default exports all")
+	})
+	if err != nil {
+		return fmt.Errorf("invalid configuration:\n%w", err)
+	}
+
+	ctx := context.Background()
+	db, err := openDatabase(ctx, cfg, false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	repo, err := image_generations.NewRepository(&image_generations.Config{DB: db})
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if out != "-" {
+		file, err := os.Create(out)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	opts := image_generations.ExportOptions{GuildID: guildID, MemberID: memberID}
+	if since > 0 {
+		opts.Since = time.Now().Add(-since)
+	}
+
+	var exported int
+	encoder := json.NewEncoder(w)
+	err = repo.Export(ctx, opts, func(generation *entities.ImageGenerationRequest) error {
+		exported++
+		return encoder.Encode(generation)
+	})
+	if err != nil {
+		return fmt.Errorf("error exporting generations: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Exported %d generations\n", exported)
+	return nil
+}
+
+// doctor runs every check and reports each one, failing if any did
+func doctor(name string, args []string) error {
+	cfg, err := config.Load(name, args)
+	if err != nil {
+		fmt.Printf("FAIL  configuration\n%v\n", err)
+		return errors.New("invalid configuration")
+	}
+	fmt.Println("ok    configuration")
+
+	ctx := context.Background()
+	if transport, err := newAPITransport(cfg); err == nil {
+		handlers.SetAPITransport(transport)
+	}
+	checks := []struct {
+		name  string
+		check func() (string, error)
+	}{
+		{"database", func() (string, error) { return checkDatabase(ctx, cfg) }},
+		{"discord token", func() (string, error) { return checkDiscord(cfg) }},
+		{"stable diffusion API", func() (string, error) {
+			if !handlers.CheckAPIAlive(cfg.APIHost) {
+				return "", fmt.Errorf("%s is not responding", cfg.APIHost)
+			}
+			return cfg.APIHost, nil
+		}},
+		{"backend features", func() (string, error) { return checkCapabilities(ctx, cfg) }},
+		{"LLM host", func() (string, error) { return checkOptionalHost(ctx, cfg.LLMHost) }},
+		{"log file", func() (string, error) { return checkLogFile(cfg.Logging.File) }},
+	}
+
+	var failed int
+	for _, c := range checks {
+		detail, err := c.check()
+		if err != nil {
+			failed++
+			fmt.Printf("FAIL  %s: %v\n", c.name, err)
+			continue
+		}
+		fmt.Printf("ok    %s: %s\n", c.name, detail)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(checks)+1)
+	}
+	return nil
+}
+
+// checkDatabase opens the database without migrating it and reports whether it's up to date
+func checkDatabase(ctx context.Context, cfg *config.Config) (string, error) {
+	db, err := openDatabase(ctx, cfg, true)
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+
+	current, required, err := sqlite.Version(ctx, db)
+	if err != nil {
+		return "", err
+	}
+	if current < required {
+		return fmt.Sprintf("at version %d of %d, run migrate or start the bot to update it", current, required), nil
+	}
+	return fmt.Sprintf("at version %d", current), nil
+}
+
+func checkDiscord(cfg *config.Config) (string, error) {
+	session, err := discordgo.New("Bot " + cfg.BotToken)
+	if err != nil {
+		return "", err
+	}
+	user, err := session.User("@me")
+	if err != nil {
+		return "", err
+	}
+	if cfg.GuildID != "" {
+		if _, err := session.Guild(cfg.GuildID); err != nil {
+			return "", fmt.Errorf("logged in as %s but can't access guild %s: %w", user.Username, cfg.GuildID, err)
+		}
+	}
+	return "logged in as " + user.Username, nil
+}
+
+// checkCapabilities reports the features the backend doesn't serve, which the bot turns off instead of failing
+func checkCapabilities(ctx context.Context, cfg *config.Config) (string, error) {
+	transport, err := newAPITransport(cfg)
+	if err != nil {
+		return "", err
+	}
+	api, err := stable_diffusion_api.New(stable_diffusion_api.Config{Host: cfg.APIHost, Auth: cfg.APIAuth, Transport: transport})
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	capabilities, err := api.Capabilities(ctx)
+	if err != nil {
+		return "", err
+	}
+	if missing := capabilities.Missing(); len(missing) > 0 {
+		return fmt.Sprintf("%v will be turned off, the backend doesn't serve them", missing), nil
+	}
+	return "all available", nil
+}
+
+func checkOptionalHost(ctx context.Context, host string) (string, error) {
+	if host == "" {
+		return "not set", nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, host, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return fmt.Sprintf("%s answered %s", host, resp.Status), nil
+}
+
+func checkLogFile(path string) (string, error) {
+	if path == "" {
+		return "not set, logging to stderr", nil
+	}
+	// like logging.Setup, which creates the directory of the log file
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return "", err
+	}
+	return path + " is writable", file.Close()
+}
@@ -0,0 +1,167 @@
+package composite_renderer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+)
+
+// AnimateOptions configures Animate.
+type AnimateOptions struct {
+	// Delay between frames in 100ths of a second. Default is 10
+	Delay int
+	// HoldLast is how long the last frame is shown in 100ths of a second. Default is 100
+	HoldLast int
+	// MaxSide scales frames down so the longest side is at most MaxSide pixels. Default is 512
+	MaxSide int
+	// FFmpeg is the path to the ffmpeg binary AnimateWebM runs. Default looks it up on the PATH
+	FFmpeg string
+}
+
+func (opts *AnimateOptions) defaults() {
+	if opts.Delay <= 0 {
+		opts.Delay = 10
+	}
+	if opts.HoldLast <= 0 {
+		opts.HoldLast = 100
+	}
+	if opts.MaxSide <= 0 {
+		opts.MaxSide = 512
+	}
+}
+
+// Animate renders frames into a looping GIF. Frames are scaled to the size of the first frame.
+func Animate(frames []io.Reader, opts AnimateOptions) (io.Reader, error) {
+	if len(frames) == 0 {
+		return nil, errors.New("no frames provided")
+	}
+	opts.defaults()
+
+	images, err := decodeAll(frames)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := fitRect(images[0].Bounds(), opts.MaxSide)
+	anim := &gif.GIF{
+		Image: make([]*image.Paletted, len(images)),
+		Delay: make([]int, len(images)),
+	}
+	_ = ForEach(len(images), func(i int) error {
+		paletted := image.NewPaletted(bounds, palette.Plan9)
+		draw.FloydSteinberg.Draw(paletted, bounds, scaleNearest(images[i], bounds), image.Point{})
+		anim.Image[i] = paletted
+		anim.Delay[i] = opts.Delay
+		return nil
+	})
+	anim.Delay[len(anim.Delay)-1] = opts.HoldLast
+
+	buf := new(bytes.Buffer)
+	if err := gif.EncodeAll(buf, anim); err != nil {
+		return nil, err
+	}
+
+	return buf, nil
+}
+
+// AnimateWebM renders frames into a VP9 WebM with ffmpeg, which keeps the full color of the previews that a GIF
+// palette loses. Frames are scaled to the size of the first frame. It returns an error if ffmpeg can't be found.
+func AnimateWebM(ctx context.Context, frames []io.Reader, opts AnimateOptions) (io.Reader, error) {
+	if len(frames) == 0 {
+		return nil, errors.New("no frames provided")
+	}
+	opts.defaults()
+
+	binary := opts.FFmpeg
+	if binary == "" {
+		binary = "ffmpeg"
+	}
+	binary, err := exec.LookPath(binary)
+	if err != nil {
+		return nil, fmt.Errorf("could not find ffmpeg: %w", err)
+	}
+
+	images, err := decodeAll(frames)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "sd-animation-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	bounds := fitRect(images[0].Bounds(), opts.MaxSide)
+	err = ForEach(len(images), func(i int) error {
+		buf := new(bytes.Buffer)
+		if err := encodePNG(buf, scaleNearest(images[i], bounds)); err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(dir, fmt.Sprintf("%d.png", i)), buf.Bytes(), 0o600)
+	})
+	if err != nil {
+		return nil, err
+	}
+	const output = "animation.webm"
+
+	ctx, cancel := context.WithTimeout(ctx, externalTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, binary,
+		"-hide_banner", "-loglevel", "error", "-y",
+		"-framerate", strconv.FormatFloat(100/float64(opts.Delay), 'f', -1, 64),
+		"-i", "%d.png",
+		// the last frame is held by cloning it, and yuv420p needs even dimensions
+		"-vf", fmt.Sprintf("tpad=stop_mode=clone:stop_duration=%s,pad=ceil(iw/2)*2:ceil(ih/2)*2",
+			strconv.FormatFloat(float64(opts.HoldLast)/100, 'f', -1, 64)),
+		"-c:v", "libvpx-vp9", "-pix_fmt", "yuv420p", "-b:v", "0", "-crf", "32",
+		output,
+	)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("%w: %s", err, bytes.TrimSpace(out))
+	}
+
+	video, err := os.ReadFile(filepath.Join(dir, output))
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(video), nil
+}
+
+// fitRect returns a rectangle at the origin with the aspect ratio of r and its longest side at most maxSide.
+func fitRect(r image.Rectangle, maxSide int) image.Rectangle {
+	width, height := r.Dx(), r.Dy()
+	if longest := max(width, height); longest > maxSide {
+		width = max(width*maxSide/longest, 1)
+		height = max(height*maxSide/longest, 1)
+	}
+	return image.Rect(0, 0, width, height)
+}
+
+// scaleNearest resizes img to bounds using nearest neighbor sampling.
+func scaleNearest(img image.Image, bounds image.Rectangle) image.Image {
+	src := img.Bounds()
+	if src.Size() == bounds.Size() {
+		return img
+	}
+
+	dst := image.NewRGBA(bounds)
+	for y := 0; y < bounds.Dy(); y++ {
+		sy := src.Min.Y + y*src.Dy()/bounds.Dy()
+		for x := 0; x < bounds.Dx(); x++ {
+			dst.Set(x, y, img.At(src.Min.X+x*src.Dx()/bounds.Dx(), sy))
+		}
+	}
+	return dst
+}
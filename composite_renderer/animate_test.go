@@ -0,0 +1,41 @@
+package composite_renderer
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"io"
+	"os/exec"
+	"testing"
+)
+
+func TestAnimateWebM(t *testing.T) {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("ffmpeg is not installed")
+	}
+
+	frames := make([]io.Reader, 3)
+	for i := range frames {
+		img := image.NewNRGBA(image.Rect(0, 0, 33, 17))
+		img.Set(i, i, color.NRGBA{R: 255, A: 255})
+		buf := new(bytes.Buffer)
+		if err := encodePNG(buf, img); err != nil {
+			t.Fatal(err)
+		}
+		frames[i] = buf
+	}
+
+	out, err := AnimateWebM(context.Background(), frames, AnimateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every WebM starts with the EBML header
+	if !bytes.HasPrefix(data, []byte{0x1a, 0x45, 0xdf, 0xa3}) {
+		t.Errorf("output doesn't start with an EBML header: % x", data[:min(len(data), 4)])
+	}
+}
@@ -0,0 +1,233 @@
+package composite_renderer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Backend selects what tiles images together.
+type Backend string
+
+const (
+	// BackendGo is the pure-Go compositor. It needs no dependencies
+	BackendGo Backend = "go"
+	// BackendImageMagick runs ImageMagick's montage, which is faster on large grids
+	BackendImageMagick Backend = "imagemagick"
+	// BackendVips runs the libvips command line tool, the fastest and lightest on memory
+	BackendVips Backend = "vips"
+)
+
+// externalTimeout bounds how long an external renderer may take for one grid
+const externalTimeout = time.Minute
+
+// NewRenderer returns the compositor for cfg.Backend. External backends need their binary on the PATH, or at
+// cfg.BackendBinary. They fall back to the Go compositor for labeled grids and whenever the binary fails.
+func NewRenderer(cfg CompositorConfig) (Renderer, error) {
+	fallback := &compositor{encoding: cfg.Encoding, collage: cfg.Collage}
+
+	var candidates []string
+	switch cfg.Backend {
+	case "", BackendGo:
+		return fallback, nil
+	case BackendImageMagick:
+		// ImageMagick 7 ships a single magick binary, 6 has montage on its own
+		candidates = []string{"magick", "montage"}
+	case BackendVips:
+		candidates = []string{"vips"}
+	default:
+		return nil, fmt.Errorf("unknown renderer backend %q", cfg.Backend)
+	}
+	if cfg.BackendBinary != "" {
+		candidates = []string{cfg.BackendBinary}
+	}
+
+	for _, candidate := range candidates {
+		binary, err := exec.LookPath(candidate)
+		if err == nil {
+			return &externalRenderer{compositor: fallback, backend: cfg.Backend, binary: binary}, nil
+		}
+	}
+	return nil, fmt.Errorf("could not find %s for the %s renderer backend", strings.Join(candidates, " or "), cfg.Backend)
+}
+
+type externalRenderer struct {
+	*compositor
+	backend Backend
+	binary  string
+}
+
+func (r *externalRenderer) TileImages(imageBufs []io.Reader) (io.Reader, error) {
+	return r.TileLabeledImages(imageBufs, nil)
+}
+
+func (r *externalRenderer) TileLabeledImages(imageBufs []io.Reader, opts *LabelOptions) (io.Reader, error) {
+	if len(imageBufs) == 0 {
+		return nil, errors.New("no images provided")
+	}
+	// the external backends don't draw labels or frames
+	if len(imageBufs) == 1 || opts != nil || r.collage.Border > 0 || r.collage.CornerRadius > 0 {
+		return r.compositor.TileLabeledImages(imageBufs, opts)
+	}
+
+	data := make([][]byte, len(imageBufs))
+	for i, buf := range imageBufs {
+		var err error
+		data[i], err = io.ReadAll(buf)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tiled, err := r.tile(data)
+	if err != nil {
+		log.Printf("Error tiling images with %s, using the Go compositor instead: %v", r.backend, err)
+		readers := make([]io.Reader, len(data))
+		for i := range data {
+			readers[i] = bytes.NewReader(data[i])
+		}
+		return r.compositor.TileLabeledImages(readers, nil)
+	}
+	return tiled, nil
+}
+
+// tile writes the images to a temporary directory and runs the backend binary on them
+func (r *externalRenderer) tile(data [][]byte) (io.Reader, error) {
+	sizes := make([]image.Rectangle, len(data))
+	var deep bool
+	for i := range data {
+		config, _, err := image.DecodeConfig(bytes.NewReader(data[i]))
+		if err != nil {
+			return nil, err
+		}
+		sizes[i] = image.Rect(0, 0, config.Width, config.Height)
+		deep = deep || is16BitModel(config.ColorModel)
+	}
+	rows, cols := determineLayout(len(data), sizes, r.collage.Columns, r.collage.AspectRatio)
+
+	// the backends get the images the way the Go compositor sees them, see normalize
+	data, profile, err := normalize(data, deep)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "sd-grid-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	// the names are relative to dir, so a space in the temporary directory doesn't split vips' list of inputs
+	inputs := make([]string, len(data))
+	for i := range data {
+		inputs[i] = fmt.Sprintf("%d.img", i)
+		if err := os.WriteFile(filepath.Join(dir, inputs[i]), data[i], 0o600); err != nil {
+			return nil, err
+		}
+	}
+	const output = "grid.png"
+
+	gutter := max(r.collage.Gutter, 0)
+	var args []string
+	switch r.backend {
+	case BackendImageMagick:
+		if filepath.Base(r.binary) != "montage" && !strings.HasPrefix(filepath.Base(r.binary), "montage.") {
+			args = append(args, "montage")
+		}
+		// montage spaces each side of a tile, so half the gutter on each side
+		args = append(args, inputs...)
+		args = append(args,
+			"-tile", fmt.Sprintf("%dx%d", cols, rows),
+			"-geometry", fmt.Sprintf("+%d+%d", gutter/2, gutter/2),
+			"-background", magickColor(r.collage.Background),
+		)
+		if deep {
+			args = append(args, "-depth", "16")
+		}
+		args = append(args, output)
+	case BackendVips:
+		args = []string{
+			"arrayjoin", strings.Join(inputs, " "), output,
+			"--across", strconv.Itoa(cols),
+			"--shim", strconv.Itoa(gutter),
+			"--halign", "centre",
+			"--valign", "centre",
+		}
+		if r.collage.Background != nil {
+			bg := color.NRGBAModel.Convert(r.collage.Background).(color.NRGBA)
+			args = append(args, "--background", fmt.Sprintf("%d %d %d %d", bg.R, bg.G, bg.B, bg.A))
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), externalTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, r.binary, args...)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("%w: %s", err, bytes.TrimSpace(out))
+	}
+
+	grid, err := os.ReadFile(filepath.Join(dir, output))
+	if err != nil {
+		return nil, err
+	}
+	grid, err = profile.apply(grid)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(grid), nil
+}
+
+// normalize returns the color profile the grid gets, the first one of the images like the Go compositor, and
+// converts 8-bit images to 16-bit PNGs if deep is set, so the backends don't tile at the lowest depth
+func normalize(data [][]byte, deep bool) ([][]byte, colorProfile, error) {
+	profile := commonProfile(data)
+	if !deep {
+		return data, profile, nil
+	}
+
+	out := make([][]byte, len(data))
+	err := ForEach(len(data), func(i int) error {
+		img, _, err := image.Decode(bytes.NewReader(data[i]))
+		if err != nil {
+			return err
+		}
+		if is16Bit(img) {
+			out[i] = data[i]
+			return nil
+		}
+		converted := image.NewNRGBA64(img.Bounds())
+		draw.Draw(converted, converted.Bounds(), img, img.Bounds().Min, draw.Src)
+		buf := new(bytes.Buffer)
+		if err := encodePNG(buf, converted); err != nil {
+			return err
+		}
+		out[i] = buf.Bytes()
+		return nil
+	})
+	if err != nil {
+		return nil, colorProfile{}, err
+	}
+	return out, profile, nil
+}
+
+// magickColor formats c as an ImageMagick color, nil is transparent
+func magickColor(c color.Color) string {
+	if c == nil {
+		return "none"
+	}
+	nrgba := color.NRGBAModel.Convert(c).(color.NRGBA)
+	return fmt.Sprintf("#%02x%02x%02x%02x", nrgba.R, nrgba.G, nrgba.B, nrgba.A)
+}
@@ -0,0 +1,33 @@
+package composite_renderer
+
+import (
+	"bytes"
+	"image"
+	"testing"
+)
+
+func TestNormalizeDeepImages(t *testing.T) {
+	encode := func(img image.Image) []byte {
+		buf := new(bytes.Buffer)
+		if err := encodePNG(buf, img); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	shallow := encode(image.NewNRGBA(image.Rect(0, 0, 8, 8)))
+	deep := encode(image.NewNRGBA64(image.Rect(0, 0, 8, 8)))
+
+	out, _, err := normalize([][]byte{shallow, deep}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, data := range out {
+		config, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !is16BitModel(config.ColorModel) {
+			t.Errorf("image %d is still 8-bit", i)
+		}
+	}
+}
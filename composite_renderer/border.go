@@ -0,0 +1,60 @@
+package composite_renderer
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// roundedRect is an alpha mask of a rectangle with rounded corners, antialiased along the curve
+type roundedRect struct {
+	rect   image.Rectangle
+	radius int
+}
+
+func (m roundedRect) ColorModel() color.Model { return color.AlphaModel }
+
+func (m roundedRect) Bounds() image.Rectangle { return m.rect }
+
+func (m roundedRect) At(x, y int) color.Color {
+	if !image.Pt(x, y).In(m.rect) {
+		return color.Transparent
+	}
+	radius := float64(min(m.radius, m.rect.Dx()/2, m.rect.Dy()/2))
+
+	// distance from the pixel center to the center of the nearest corner circle, if it's in a corner
+	px, py := float64(x)+0.5, float64(y)+0.5
+	cx := math.Max(float64(m.rect.Min.X)+radius, math.Min(px, float64(m.rect.Max.X)-radius))
+	cy := math.Max(float64(m.rect.Min.Y)+radius, math.Min(py, float64(m.rect.Max.Y)-radius))
+	coverage := radius - math.Hypot(px-cx, py-cy) + 0.5
+	if px == cx || py == cy || coverage >= 1 {
+		return color.Opaque
+	}
+	return color.Alpha{A: uint8(math.Max(coverage, 0) * 0xff)}
+}
+
+// drawFramedTile draws img in tile with rounded corners, surrounded by a border of the given width
+func (o CollageOptions) drawFramedTile(dst draw.Image, tile image.Rectangle, img image.Image) {
+	border := max(o.Border, 0)
+	radius := max(o.CornerRadius, 0)
+
+	if border > 0 {
+		frame := tile.Inset(-border)
+		borderColor := o.BorderColor
+		if borderColor == nil {
+			borderColor = color.White
+		}
+		outerRadius := radius
+		if radius > 0 {
+			outerRadius += border
+		}
+		draw.DrawMask(dst, frame, image.NewUniform(borderColor), image.Point{}, roundedRect{frame, outerRadius}, frame.Min, draw.Over)
+	}
+
+	if radius == 0 {
+		draw.Draw(dst, tile, img, img.Bounds().Min, draw.Over)
+		return
+	}
+	draw.DrawMask(dst, tile, img, img.Bounds().Min, roundedRect{tile, radius}, tile.Min, draw.Over)
+}
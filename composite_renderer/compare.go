@@ -0,0 +1,125 @@
+package composite_renderer
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+)
+
+// CompareMode is how Compare lays out the before and after crops.
+type CompareMode string
+
+const (
+	CompareNone       CompareMode = "none"
+	CompareSideBySide CompareMode = "side"
+	CompareDiagonal   CompareMode = "diagonal"
+)
+
+// CompareOptions configures Compare.
+type CompareOptions struct {
+	// Mode defaults to CompareSideBySide
+	Mode CompareMode
+	// CropSize is the side of the square crop in upscaled pixels. Default is 512, or smaller if the image is smaller
+	CropSize int
+	// Gap is the space in pixels between side by side crops. Default is 8
+	Gap int
+}
+
+// Compare crops the center of the upscaled image at 100% zoom and the same region of the original, enlarged with
+// nearest neighbor sampling so individual pixels stay visible. The crops are labeled "BEFORE" and "AFTER".
+func Compare(original, upscaled io.Reader, opts CompareOptions) (io.Reader, error) {
+	if opts.Mode == CompareNone {
+		return nil, errors.New("comparison is disabled")
+	}
+
+	before, _, err := image.Decode(original)
+	if err != nil {
+		return nil, err
+	}
+	after, _, err := image.Decode(upscaled)
+	if err != nil {
+		return nil, err
+	}
+
+	beforeBounds, afterBounds := before.Bounds(), after.Bounds()
+	if beforeBounds.Empty() || afterBounds.Empty() {
+		return nil, errors.New("empty image")
+	}
+
+	cropSize := opts.CropSize
+	if cropSize <= 0 {
+		cropSize = 512
+	}
+	cropSize = min(cropSize, afterBounds.Dx(), afterBounds.Dy())
+
+	// center crop of the upscaled image and the matching region of the original
+	afterCrop := image.Rect(0, 0, cropSize, cropSize).Add(afterBounds.Min).Add(image.Pt(
+		(afterBounds.Dx()-cropSize)/2, (afterBounds.Dy()-cropSize)/2))
+	beforeCrop := image.Rect(
+		beforeBounds.Min.X+(afterCrop.Min.X-afterBounds.Min.X)*beforeBounds.Dx()/afterBounds.Dx(),
+		beforeBounds.Min.Y+(afterCrop.Min.Y-afterBounds.Min.Y)*beforeBounds.Dy()/afterBounds.Dy(),
+		beforeBounds.Min.X+(afterCrop.Max.X-afterBounds.Min.X)*beforeBounds.Dx()/afterBounds.Dx(),
+		beforeBounds.Min.Y+(afterCrop.Max.Y-afterBounds.Min.Y)*beforeBounds.Dy()/afterBounds.Dy(),
+	)
+
+	tile := image.Rect(0, 0, cropSize, cropSize)
+	beforeTile := scaleNearest(subImage(before, beforeCrop), tile)
+	afterTile := subImage(after, afterCrop)
+
+	labels := &LabelOptions{Labels: []string{"BEFORE", "AFTER"}}
+
+	var canvas *image.RGBA
+	switch opts.Mode {
+	case CompareDiagonal:
+		canvas = image.NewRGBA(tile)
+		draw.Draw(canvas, tile, afterTile, afterTile.Bounds().Min, draw.Src)
+		draw.DrawMask(canvas, tile, beforeTile, beforeTile.Bounds().Min, upperLeftTriangle(cropSize), image.Point{}, draw.Over)
+		labels.drawLabel(canvas, tile, 0)
+		labels.drawLabelInCorner(canvas, tile, 1, CornerBottomRight)
+	default:
+		gap := opts.Gap
+		if gap <= 0 {
+			gap = 8
+		}
+		canvas = image.NewRGBA(image.Rect(0, 0, cropSize*2+gap, cropSize))
+		draw.Draw(canvas, canvas.Bounds(), image.NewUniform(color.Black), image.Point{}, draw.Src)
+		draw.Draw(canvas, tile, beforeTile, beforeTile.Bounds().Min, draw.Src)
+		labels.drawLabel(canvas, tile, 0)
+		afterRect := tile.Add(image.Pt(cropSize+gap, 0))
+		draw.Draw(canvas, afterRect, afterTile, afterTile.Bounds().Min, draw.Src)
+		labels.drawLabel(canvas, afterRect, 1)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := encodePNG(buf, canvas); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+type subImager interface {
+	SubImage(r image.Rectangle) image.Image
+}
+
+func subImage(img image.Image, r image.Rectangle) image.Image {
+	if sub, ok := img.(subImager); ok {
+		return sub.SubImage(r)
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, r.Min, draw.Src)
+	return dst
+}
+
+// upperLeftTriangle returns an opaque mask above the diagonal from the bottom left to the top right corner
+func upperLeftTriangle(size int) image.Image {
+	mask := image.NewAlpha(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size-y; x++ {
+			mask.SetAlpha(x, y, color.Alpha{A: 0xff})
+		}
+	}
+	return mask
+}
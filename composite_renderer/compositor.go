@@ -1,122 +1,202 @@
 package composite_renderer
 
 import (
-	"bytes"
 	"errors"
+	"fmt"
 	"image"
+	"image/color"
 	"image/draw"
-	"image/png"
 	"io"
 	"math"
+	"strconv"
+	"strings"
 )
 
-type compositor struct{}
+type compositor struct {
+	encoding EncodeOptions
+	collage  CollageOptions
+}
+
+// CollageOptions configures how the compositor lays out tiles.
+type CollageOptions struct {
+	// Columns fixes the number of columns, e.g. for X/Y plots. Default picks rows and columns from the image count and aspect ratio
+	Columns int
+	// AspectRatio is the width over height of the canvas the layout aims for. Default is 16:9, the shape Discord
+	// previews images in, so tall images are laid out in a row instead of shrunk into a square grid
+	AspectRatio float64
+	// Gutter is the space in pixels between tiles
+	Gutter int
+	// Background fills the gutter and empty cells. Default is transparent
+	Background color.Color
+	// Border is the width in pixels of the frame drawn around each tile, in BorderColor. Default is no border
+	Border int
+	// BorderColor defaults to white
+	BorderColor color.Color
+	// CornerRadius rounds the corners of each tile and its border. Default is square corners
+	CornerRadius int
+}
+
+// CompositorConfig configures NewCompositor.
+type CompositorConfig struct {
+	Encoding EncodeOptions
+	Collage  CollageOptions
+	// Backend is only used by NewRenderer. Default is BackendGo
+	Backend Backend
+	// BackendBinary is the path to the binary of an external backend. Default looks it up on the PATH
+	BackendBinary string
+}
+
+// NewCompositor returns the layout aware compositor with the given options.
+func NewCompositor(cfg CompositorConfig) Renderer {
+	return &compositor{encoding: cfg.Encoding, collage: cfg.Collage}
+}
 
 func (c *compositor) TileImages(imageBufs []io.Reader) (io.Reader, error) {
+	return c.TileLabeledImages(imageBufs, nil)
+}
+
+func (c *compositor) TileLabeledImages(imageBufs []io.Reader, opts *LabelOptions) (io.Reader, error) {
 	numImages := len(imageBufs)
 	if numImages == 0 {
 		return nil, errors.New("no images provided")
 	}
 
-	if numImages == 1 {
+	if numImages == 1 && opts == nil {
 		return imageBufs[0], nil
 	}
 
-	images := make([]image.Image, numImages)
-	var totalWidth, totalHeight int
-	for i, buf := range imageBufs {
-		img, _, err := image.Decode(buf)
-		if err != nil {
-			return nil, err
-		}
-		images[i] = img
-		bounds := img.Bounds()
-		totalWidth += bounds.Dx()
-		totalHeight += bounds.Dy()
+	imageBufs, profile, err := readWithProfile(imageBufs)
+	if err != nil {
+		return nil, err
+	}
+	images, err := decodeAll(imageBufs)
+	if err != nil {
+		return nil, err
 	}
 
-	rows, cols := determineLayout(numImages, images)
-
-	canvasWidth, canvasHeight := calculateCanvasSize(images, rows, cols)
-
-	retImage := image.NewRGBA(image.Rect(0, 0, canvasWidth, canvasHeight))
-
-	var x, y, maxHeightInRow int
+	// cells fit the tile and its border
+	border := max(c.collage.Border, 0)
+	sizes := make([]image.Rectangle, numImages)
 	for i, img := range images {
-		if i%cols == 0 && i != 0 {
-			x = 0
-			y += maxHeightInRow
-			maxHeightInRow = 0
-		}
+		sizes[i] = img.Bounds().Inset(-border)
+	}
+	rows, cols := determineLayout(numImages, sizes, c.collage.Columns, c.collage.AspectRatio)
 
-		bounds := img.Bounds()
-		maxHeightInRow = max(maxHeightInRow, bounds.Dy())
-		draw.Draw(retImage, image.Rect(x, y, x+bounds.Dx(), y+bounds.Dy()), img, bounds.Min, draw.Over)
-		x += bounds.Dx()
+	columnWidths, rowHeights := cellSizes(sizes, rows, cols)
+	gutter := max(c.collage.Gutter, 0)
+	canvasWidth, canvasHeight := gutter*(cols-1), gutter*(rows-1)
+	for _, w := range columnWidths {
+		canvasWidth += w
+	}
+	for _, h := range rowHeights {
+		canvasHeight += h
 	}
 
-	imageBuf := new(bytes.Buffer)
-	err := png.Encode(imageBuf, retImage)
-	if err != nil {
-		return nil, err
+	retImage := newCanvas(image.Rect(0, 0, canvasWidth, canvasHeight), images...)
+	if c.collage.Background != nil {
+		draw.Draw(retImage, retImage.Bounds(), image.NewUniform(c.collage.Background), image.Point{}, draw.Src)
 	}
 
-	return imageBuf, nil
+	var y int
+	for row := range rows {
+		var x int
+		for col := range cols {
+			i := row*cols + col
+			if i >= numImages {
+				break
+			}
+
+			// center the image in its cell
+			bounds := images[i].Bounds()
+			offset := image.Pt((columnWidths[col]-bounds.Dx())/2, (rowHeights[row]-bounds.Dy())/2)
+			tile := image.Rectangle{Max: bounds.Size()}.Add(image.Pt(x, y).Add(offset))
+			c.collage.drawFramedTile(retImage, tile, images[i])
+			opts.drawLabel(retImage, tile, i)
+
+			x += columnWidths[col] + gutter
+		}
+		y += rowHeights[row] + gutter
+	}
+
+	return encodePNGWithProfile(retImage, profile)
 }
 
-func determineLayout(numImages int, images []image.Image) (rows, cols int) {
-	if numImages == 1 {
+// emptyCellPenalty weighs an empty cell against how far the canvas is from the target aspect ratio
+const emptyCellPenalty = 0.25
+
+// defaultAspectRatio is the canvas shape layouts aim for when CollageOptions.AspectRatio is not set
+const defaultAspectRatio = 16.0 / 9.0
+
+// determineLayout returns a fixed number of columns if set, otherwise it picks the grid whose canvas is closest to
+// the target aspect ratio with the fewest empty cells, preferring wider grids on ties.
+func determineLayout(numImages int, sizes []image.Rectangle, columns int, target float64) (rows, cols int) {
+	if numImages <= 1 {
 		return 1, 1
 	}
 
-	// Basic heuristic: prefer more columns than rows to minimize empty space
-	cols = int(math.Ceil(math.Sqrt(float64(numImages))))
-	rows = int(math.Ceil(float64(numImages) / float64(cols)))
+	if columns > 0 {
+		cols = min(columns, numImages)
+		return int(math.Ceil(float64(numImages) / float64(cols))), cols
+	}
+
+	var totalWidth, totalHeight int
+	for _, size := range sizes {
+		totalWidth += size.Dx()
+		totalHeight += size.Dy()
+	}
+	aspect := float64(max(totalWidth, 1)) / float64(max(totalHeight, 1))
+	if target <= 0 {
+		target = defaultAspectRatio
+	}
 
-	// Adjust for aspect ratios
-	portraitCount, landscapeCount, squareCount := countImageTypes(images)
-	if landscapeCount > portraitCount && landscapeCount > squareCount {
-		rows, cols = cols, rows // Prefer wider layout for mostly landscape images
+	bestScore := math.Inf(1)
+	for c := 1; c <= numImages; c++ {
+		r := int(math.Ceil(float64(numImages) / float64(c)))
+		empty := r*c - numImages
+		if empty >= c {
+			continue // a whole row would be empty
+		}
+		score := math.Abs(math.Log(float64(c)*aspect/float64(r)/target)) + emptyCellPenalty*float64(empty)
+		if score <= bestScore {
+			bestScore, rows, cols = score, r, c
+		}
 	}
 
 	return
 }
 
-func calculateCanvasSize(images []image.Image, rows, cols int) (width, height int) {
-	maxWidthPerColumn := make([]int, cols)
-	maxHeightPerRow := make([]int, rows)
+// cellSizes returns the widest image of each column and the tallest of each row
+func cellSizes(sizes []image.Rectangle, rows, cols int) (columnWidths, rowHeights []int) {
+	columnWidths = make([]int, cols)
+	rowHeights = make([]int, rows)
 
-	for i, img := range images {
+	for i, size := range sizes {
 		row := i / cols
 		col := i % cols
-		bounds := img.Bounds()
-		maxWidthPerColumn[col] = max(maxWidthPerColumn[col], bounds.Dx())
-		maxHeightPerRow[row] = max(maxHeightPerRow[row], bounds.Dy())
-	}
-
-	for _, w := range maxWidthPerColumn {
-		width += w
-	}
-	for _, h := range maxHeightPerRow {
-		height += h
+		columnWidths[col] = max(columnWidths[col], size.Dx())
+		rowHeights[row] = max(rowHeights[row], size.Dy())
 	}
 
 	return
 }
 
-func countImageTypes(images []image.Image) (portrait, landscape, square int) {
-	for _, img := range images {
-		bounds := img.Bounds()
-		width := bounds.Dx()
-		height := bounds.Dy()
-
-		if width > height {
-			landscape++
-		} else if width < height {
-			portrait++
-		} else {
-			square++
-		}
+// ParseHexColor parses #rgb, #rrggbb or #rrggbbaa, with or without the leading #.
+func ParseHexColor(s string) (color.Color, error) {
+	s = strings.TrimPrefix(s, "#")
+	if len(s) == 3 {
+		s = string([]byte{s[0], s[0], s[1], s[1], s[2], s[2]})
 	}
-	return
+	if len(s) == 6 {
+		s += "ff"
+	}
+	if len(s) != 8 {
+		return nil, fmt.Errorf("invalid hex color %q", s)
+	}
+
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex color %q: %w", s, err)
+	}
+
+	return color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil
 }
@@ -0,0 +1,139 @@
+package composite_renderer
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"math"
+	"strings"
+)
+
+// ContactSheetOptions configures ContactSheet.
+type ContactSheetOptions struct {
+	// Columns defaults to the square root of the image count, rounded up
+	Columns int
+	// TileSize is the longest side in pixels of each image. Default is 384
+	TileSize int
+	// Gap is the space in pixels around each tile and its caption. Default is 16
+	Gap int
+	// CaptionLines is the most lines of caption under each tile, longer captions are cut off. Default is 3
+	CaptionLines int
+	// Font defaults to BitmapFont with a scale of 2
+	Font Font
+	// Background defaults to white and Color defaults to black, so the sheet prints well
+	Background color.Color
+	Color      color.Color
+}
+
+// ContactSheet renders the images on a grid of equal cells with the caption of the same index wrapped under each one.
+func ContactSheet(images []io.Reader, captions []string, opts ContactSheetOptions) (io.Reader, error) {
+	if len(images) == 0 {
+		return nil, errors.New("no images for the contact sheet")
+	}
+
+	tileSize := opts.TileSize
+	if tileSize <= 0 {
+		tileSize = 384
+	}
+	gap := opts.Gap
+	if gap <= 0 {
+		gap = 16
+	}
+	lines := opts.CaptionLines
+	if lines <= 0 {
+		lines = 3
+	}
+	font := opts.Font
+	if font == nil {
+		font = BitmapFont{Scale: 2}
+	}
+	bg := opts.Background
+	if bg == nil {
+		bg = color.White
+	}
+	fg := opts.Color
+	if fg == nil {
+		fg = color.Black
+	}
+	columns := opts.Columns
+	if columns <= 0 {
+		columns = int(math.Ceil(math.Sqrt(float64(len(images)))))
+	}
+	columns = min(columns, len(images))
+	rows := (len(images) + columns - 1) / columns
+
+	_, lineHeight := font.Measure("X")
+	lineHeight += lineHeight / 2
+	cell := image.Rect(0, 0, tileSize+gap, tileSize+gap+lines*lineHeight)
+
+	canvas := image.NewRGBA(image.Rect(0, 0, columns*cell.Dx()+gap, rows*cell.Dy()+gap))
+	draw.Draw(canvas, canvas.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+
+	for i, r := range images {
+		origin := image.Pt(gap+(i%columns)*cell.Dx(), gap+(i/columns)*cell.Dy())
+
+		img, _, err := image.Decode(r)
+		if err != nil {
+			return nil, err
+		}
+		bounds := fitRect(img.Bounds(), tileSize)
+		tile := Resize(img, bounds.Dx(), bounds.Dy())
+		// center the image in its square
+		offset := image.Pt((tileSize-bounds.Dx())/2, (tileSize-bounds.Dy())/2)
+		draw.Draw(canvas, bounds.Add(origin).Add(offset), tile, image.Point{}, draw.Over)
+
+		if i >= len(captions) {
+			continue
+		}
+		for line, text := range wrapText(font, captions[i], tileSize, lines) {
+			pt := origin.Add(image.Pt(0, tileSize+gap/2+line*lineHeight))
+			font.Draw(canvas, pt, text, fg)
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := encodePNG(buf, canvas); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// wrapText splits s on spaces into at most maxLines lines no wider than width, ending with "..." if cut off
+func wrapText(font Font, s string, width, maxLines int) []string {
+	var lines []string
+	var line string
+	for _, word := range strings.Fields(s) {
+		candidate := strings.TrimSpace(line + " " + word)
+		if w, _ := font.Measure(candidate); w <= width || line == "" {
+			line = candidate
+			continue
+		}
+		lines = append(lines, line)
+		line = word
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+
+	for i, l := range lines {
+		// cut words that are wider than a whole line
+		runes := []rune(l)
+		for w, _ := font.Measure(string(runes)); w > width && len(runes) > 1; w, _ = font.Measure(string(runes)) {
+			runes = runes[:len(runes)-1]
+		}
+		lines[i] = string(runes)
+	}
+
+	if len(lines) > maxLines {
+		lines = lines[:maxLines]
+		last := []rune(lines[maxLines-1])
+		for w, _ := font.Measure(string(last) + "..."); w > width && len(last) > 0; w, _ = font.Measure(string(last) + "...") {
+			last = last[:len(last)-1]
+		}
+		lines[maxLines-1] = string(last) + "..."
+	}
+	return lines
+}
@@ -0,0 +1,246 @@
+package composite_renderer
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"log"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/HugoSmits86/nativewebp"
+)
+
+// DiscordUploadLimit is the total attachment size Discord accepts per message without boosts.
+const DiscordUploadLimit = 10 << 20
+
+// Encoder encodes an image in a single format. Lossless encoders can ignore quality.
+type Encoder interface {
+	Encode(w io.Writer, img image.Image, quality int) error
+}
+
+// EncoderFunc adapts a function to an Encoder.
+type EncoderFunc func(w io.Writer, img image.Image, quality int) error
+
+func (f EncoderFunc) Encode(w io.Writer, img image.Image, quality int) error {
+	return f(w, img, quality)
+}
+
+// Format describes a registered output format.
+type Format struct {
+	Name        string
+	Extension   string
+	ContentType string
+	// Lossy formats are searched for the highest quality that fits the size limit
+	Lossy   bool
+	Encoder Encoder
+}
+
+var (
+	formatsMu sync.RWMutex
+	formats   = map[string]Format{
+		"png": {Name: "png", Extension: "png", ContentType: "image/png", Encoder: EncoderFunc(func(w io.Writer, img image.Image, _ int) error {
+			return encodePNG(w, img)
+		})},
+		"jpeg": {Name: "jpeg", Extension: "jpg", ContentType: "image/jpeg", Lossy: true, Encoder: EncoderFunc(func(w io.Writer, img image.Image, quality int) error {
+			return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+		})},
+		// the pure-Go encoder is lossless, so WebP that doesn't fit the budget falls back to JPEG like PNG does
+		"webp": {Name: "webp", Extension: "webp", ContentType: "image/webp", Encoder: EncoderFunc(func(w io.Writer, img image.Image, _ int) error {
+			return nativewebp.Encode(w, img, nil)
+		})},
+	}
+)
+
+// RegisterFormat adds or replaces an output format.
+// AVIF has no pure-Go encoder, so it's only accepted once one is registered as "avif" before the config is validated.
+func RegisterFormat(format Format) {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+	formats[format.Name] = format
+}
+
+// LookupFormat returns the registered format with the given name.
+func LookupFormat(name string) (Format, bool) {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	format, ok := formats[name]
+	return format, ok
+}
+
+// FormatNames returns the names of the registered formats, sorted
+func FormatNames() []string {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	names := slices.Collect(maps.Keys(formats))
+	slices.Sort(names)
+	return names
+}
+
+// EncodeOptions configures how outbound images are re-encoded.
+type EncodeOptions struct {
+	// Format is the preferred output format, e.g. "jpeg". Default keeps the source format until it's too large
+	Format string
+	// MaxBytes caps the total size of all images in a message. Default is the upload limit of the guild,
+	// or DiscordUploadLimit if it's unknown
+	MaxBytes int
+	// MinQuality is the lowest quality tried by the quality search. Default is 50
+	MinQuality int
+}
+
+// Reencoder is a Renderer that can re-encode outbound images to fit a size budget.
+type Reencoder interface {
+	Renderer
+	Reencode(r io.Reader, maxBytes int) (io.Reader, Format, error)
+	EncodeOptions() EncodeOptions
+}
+
+func (c *compositor) EncodeOptions() EncodeOptions {
+	opts := c.encoding
+	if opts.MinQuality <= 0 {
+		opts.MinQuality = 50
+	}
+	return opts
+}
+
+// Reencode returns r unchanged if it fits in maxBytes and is already in the preferred format, or the preferred format
+// is unregistered. Otherwise, it is encoded with the highest quality that fits, falling back to JPEG if the preferred format is
+// unregistered or lossless. If it still doesn't fit at the minimum quality, it is progressively downscaled.
+// maxBytes <= 0 means no limit.
+func (c *compositor) Reencode(r io.Reader, maxBytes int) (io.Reader, Format, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, Format{}, err
+	}
+
+	out, format, err := c.reencode(data, maxBytes)
+	if err != nil {
+		return nil, Format{}, err
+	}
+
+	// the encoders drop the color profile of the source
+	profile := readColorProfile(data)
+	if profile.empty() {
+		return out, format, nil
+	}
+	encoded, err := io.ReadAll(out)
+	if err != nil {
+		return nil, Format{}, err
+	}
+	if readColorProfile(encoded).equal(profile) {
+		return bytes.NewReader(encoded), format, nil
+	}
+	withProfile, err := profile.apply(encoded)
+	if err != nil {
+		return nil, Format{}, err
+	}
+	return bytes.NewReader(withProfile), format, nil
+}
+
+func (c *compositor) reencode(data []byte, maxBytes int) (io.Reader, Format, error) {
+	opts := c.EncodeOptions()
+
+	_, sourceFormat, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, Format{}, err
+	}
+
+	fits := maxBytes <= 0 || len(data) <= maxBytes
+	if _, ok := LookupFormat(opts.Format); fits && (!ok || opts.Format == sourceFormat) {
+		if format, ok := LookupFormat(sourceFormat); ok {
+			return bytes.NewBuffer(data), format, nil
+		}
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, Format{}, err
+	}
+
+	target := opts.Format
+	if target == "" {
+		target = sourceFormat
+	}
+	format, ok := LookupFormat(target)
+	if !ok {
+		log.Printf("No encoder registered for %q, falling back to jpeg", target)
+		format, _ = LookupFormat("jpeg")
+	}
+
+	if !format.Lossy && (fits || format.Name != sourceFormat) {
+		buf := new(bytes.Buffer)
+		if err := format.Encoder.Encode(buf, img, 100); err != nil {
+			return nil, Format{}, err
+		}
+		if maxBytes <= 0 || buf.Len() <= maxBytes {
+			return buf, format, nil
+		}
+	}
+	if !format.Lossy {
+		format, _ = LookupFormat("jpeg")
+	}
+
+	buf, err := searchQuality(img, format, maxBytes, opts.MinQuality)
+	if err != nil {
+		return nil, Format{}, err
+	}
+
+	for range maxDownscales {
+		if maxBytes <= 0 || buf.Len() <= maxBytes {
+			break
+		}
+		bounds := img.Bounds()
+		img = Resize(img, bounds.Dx()*3/4, bounds.Dy()*3/4)
+		log.Printf("Downscaling image from %v to %v to fit %d bytes", bounds.Size(), img.Bounds().Size(), maxBytes)
+
+		buf, err = searchQuality(img, format, maxBytes, opts.MinQuality)
+		if err != nil {
+			return nil, Format{}, err
+		}
+	}
+
+	return buf, format, nil
+}
+
+// maxDownscales is how many times Reencode shrinks an image by a quarter before giving up
+const maxDownscales = 6
+
+// searchQuality binary searches for the highest quality between minQuality and 100 that fits in maxBytes.
+// If nothing fits, the minQuality encoding is returned.
+func searchQuality(img image.Image, format Format, maxBytes, minQuality int) (*bytes.Buffer, error) {
+	encode := func(quality int) (*bytes.Buffer, error) {
+		buf := new(bytes.Buffer)
+		if err := format.Encoder.Encode(buf, img, quality); err != nil {
+			return nil, fmt.Errorf("error encoding %s at quality %d: %w", format.Name, quality, err)
+		}
+		return buf, nil
+	}
+
+	best, err := encode(minQuality)
+	if err != nil {
+		return nil, err
+	}
+	if maxBytes > 0 && best.Len() > maxBytes {
+		return best, nil
+	}
+
+	low, high := minQuality+1, 100
+	for low <= high {
+		quality := (low + high) / 2
+		buf, err := encode(quality)
+		if err != nil {
+			return nil, err
+		}
+		if maxBytes <= 0 || buf.Len() <= maxBytes {
+			best = buf
+			low = quality + 1
+		} else {
+			high = quality - 1
+		}
+	}
+
+	return best, nil
+}
@@ -0,0 +1,41 @@
+package composite_renderer
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"io"
+	"testing"
+)
+
+func TestReencodeWebP(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 48))
+	for x := range 64 {
+		img.Set(x, x%48, color.NRGBA{R: uint8(x * 4), G: 128, B: 255, A: 255})
+	}
+	source := new(bytes.Buffer)
+	if err := encodePNG(source, img); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &compositor{encoding: EncodeOptions{Format: "webp"}}
+	out, format, err := c.Reencode(source, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format.Name != "webp" || format.ContentType != "image/webp" {
+		t.Errorf("format = %+v, want webp", format)
+	}
+
+	data, err := io.ReadAll(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, name, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decoding the re-encoded image: %v", err)
+	}
+	if name != "webp" || config.Width != 64 || config.Height != 48 {
+		t.Errorf("decoded %s %dx%d, want webp 64x48", name, config.Width, config.Height)
+	}
+}
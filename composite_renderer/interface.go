@@ -8,6 +8,12 @@ type Renderer interface {
 	TileImages(imageBufs []io.Reader) (io.Reader, error)
 }
 
+// LabelRenderer is a Renderer that can draw a label on each tile.
+type LabelRenderer interface {
+	Renderer
+	TileLabeledImages(imageBufs []io.Reader, opts *LabelOptions) (io.Reader, error)
+}
+
 // New returns a new Renderer. Set yonsai to true if you have 4 images to render, false if you have n images to render.
 func New(yonsai bool) Renderer {
 	if yonsai {
@@ -0,0 +1,81 @@
+package composite_renderer
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"strconv"
+)
+
+// LabelOptions configures the per-tile labels drawn by LabelRenderer.TileLabeledImages.
+type LabelOptions struct {
+	// Labels are drawn on the tile with the same index. Tiles without a label, or with an empty one, are left as is
+	Labels []string
+	// Font defaults to BitmapFont with a scale relative to the tile size
+	Font Font
+	// Margin is the distance in pixels between the label and the tile corner. Default is 8
+	Margin int
+	// Padding is the space in pixels between the label text and its background. Default is 4
+	Padding int
+	// Color defaults to white and Background defaults to translucent black
+	Color      color.Color
+	Background color.Color
+}
+
+// IndexLabels returns "1" to "n", matching the numbered upscale and variation buttons.
+func IndexLabels(n int) []string {
+	labels := make([]string, n)
+	for i := range labels {
+		labels[i] = strconv.Itoa(i + 1)
+	}
+	return labels
+}
+
+func (o *LabelOptions) drawLabel(dst draw.Image, tile image.Rectangle, index int) {
+	o.drawLabelInCorner(dst, tile, index, CornerTopLeft)
+}
+
+func (o *LabelOptions) drawLabelInCorner(dst draw.Image, tile image.Rectangle, index int, corner Corner) {
+	if o == nil || index >= len(o.Labels) || o.Labels[index] == "" {
+		return
+	}
+	label := o.Labels[index]
+
+	font := o.Font
+	if font == nil {
+		// roughly 1/25th of the tile height, so labels stay readable on both thumbnails and full size images
+		font = BitmapFont{Scale: max(tile.Dy()/(glyphHeight*25), 1)}
+	}
+	margin := o.Margin
+	if margin <= 0 {
+		margin = 8
+	}
+	padding := o.Padding
+	if padding <= 0 {
+		padding = 4
+	}
+	fg := o.Color
+	if fg == nil {
+		fg = color.White
+	}
+	bg := o.Background
+	if bg == nil {
+		bg = color.NRGBA{A: 160}
+	}
+
+	width, height := font.Measure(label)
+	box := image.Rect(0, 0, width+2*padding, height+2*padding)
+	switch corner {
+	case CornerTopRight:
+		box = box.Add(image.Pt(tile.Max.X-box.Dx()-margin, tile.Min.Y+margin))
+	case CornerBottomLeft:
+		box = box.Add(image.Pt(tile.Min.X+margin, tile.Max.Y-box.Dy()-margin))
+	case CornerBottomRight:
+		box = box.Add(tile.Max.Sub(box.Size()).Sub(image.Pt(margin, margin)))
+	default:
+		box = box.Add(tile.Min.Add(image.Pt(margin, margin)))
+	}
+	box = box.Intersect(tile)
+	draw.Draw(dst, box, image.NewUniform(bg), image.Point{}, draw.Over)
+	font.Draw(dst, box.Min.Add(image.Pt(padding, padding)), label, fg)
+}
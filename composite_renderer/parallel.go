@@ -0,0 +1,69 @@
+package composite_renderer
+
+import (
+	"image"
+	"image/png"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// pngEncoder reuses its compression buffers between encodes, which are large enough to matter for big batches
+var pngEncoder = &png.Encoder{BufferPool: new(pngBufferPool)}
+
+type pngBufferPool struct {
+	pool sync.Pool
+}
+
+func (p *pngBufferPool) Get() *png.EncoderBuffer {
+	buf, _ := p.pool.Get().(*png.EncoderBuffer)
+	return buf
+}
+
+func (p *pngBufferPool) Put(buf *png.EncoderBuffer) {
+	p.pool.Put(buf)
+}
+
+func encodePNG(w io.Writer, img image.Image) error {
+	return pngEncoder.Encode(w, img)
+}
+
+// ForEach calls fn for 0 to n-1 on up to GOMAXPROCS goroutines and returns the error of the lowest index.
+// It's shared through utils.ForEach, which can't be imported here as utils imports this package.
+func ForEach(n int, fn func(i int) error) error {
+	errs := make([]error, n)
+	sem := make(chan struct{}, runtime.GOMAXPROCS(0))
+
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			errs[i] = fn(i)
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeAll decodes the images concurrently
+func decodeAll(readers []io.Reader) ([]image.Image, error) {
+	images := make([]image.Image, len(readers))
+	err := ForEach(len(readers), func(i int) error {
+		img, _, err := image.Decode(readers[i])
+		images[i] = img
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return images, nil
+}
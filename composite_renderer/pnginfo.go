@@ -0,0 +1,148 @@
+package composite_renderer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"unicode/utf8"
+)
+
+// ParametersKey is the text chunk keyword the WebUI reads generation parameters from.
+const ParametersKey = "parameters"
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+var errNotPNG = errors.New("not a png")
+
+type pngChunk struct {
+	typ  string
+	data []byte
+}
+
+// SetTextChunk returns a copy of the PNG in data with the text chunk key set to value, replacing any previous value.
+// ASCII values are written as tEXt, anything else as uncompressed UTF-8 iTXt.
+func SetTextChunk(data []byte, key, value string) ([]byte, error) {
+	chunks, err := readChunks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	chunk := pngChunk{typ: "tEXt", data: append(append([]byte(key), 0), value...)}
+	if !isASCII(value) {
+		// keyword, null, compression flag, compression method, empty language tag and translated keyword
+		chunk = pngChunk{typ: "iTXt", data: append(append([]byte(key), 0, 0, 0, 0, 0), value...)}
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)+len(chunk.data)+12))
+	out.Write(pngSignature)
+	for i, c := range chunks {
+		if textKey(c) == key {
+			continue
+		}
+		writeChunk(out, c)
+		if i == 0 { // IHDR must come first
+			writeChunk(out, chunk)
+		}
+	}
+
+	return out.Bytes(), nil
+}
+
+// TextChunks returns the uncompressed tEXt and iTXt chunks of the PNG in data.
+func TextChunks(data []byte) (map[string]string, error) {
+	chunks, err := readChunks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	texts := make(map[string]string)
+	for _, c := range chunks {
+		key := textKey(c)
+		if key == "" {
+			continue
+		}
+		value := c.data[len(key)+1:]
+		switch c.typ {
+		case "tEXt":
+			texts[key] = string(value)
+		case "iTXt":
+			// skip compressed values, the bot never writes them
+			if len(value) < 2 || value[0] != 0 {
+				continue
+			}
+			// skip the language tag and translated keyword
+			rest := value[2:]
+			for range 2 {
+				i := bytes.IndexByte(rest, 0)
+				if i < 0 {
+					rest = nil
+					break
+				}
+				rest = rest[i+1:]
+			}
+			texts[key] = string(rest)
+		}
+	}
+
+	return texts, nil
+}
+
+func readChunks(data []byte) ([]pngChunk, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, errNotPNG
+	}
+
+	var chunks []pngChunk
+	for rest := data[len(pngSignature):]; len(rest) > 0; {
+		if len(rest) < 12 {
+			return nil, errors.New("truncated png chunk")
+		}
+		length := int(binary.BigEndian.Uint32(rest[:4]))
+		if len(rest) < 12+length {
+			return nil, errors.New("truncated png chunk")
+		}
+		chunks = append(chunks, pngChunk{typ: string(rest[4:8]), data: rest[8 : 8+length]})
+		rest = rest[12+length:]
+	}
+
+	if len(chunks) == 0 || chunks[0].typ != "IHDR" {
+		return nil, errNotPNG
+	}
+	return chunks, nil
+}
+
+func writeChunk(buf *bytes.Buffer, c pngChunk) {
+	var header [8]byte
+	binary.BigEndian.PutUint32(header[:4], uint32(len(c.data)))
+	copy(header[4:], c.typ)
+	buf.Write(header[:])
+	buf.Write(c.data)
+
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write(c.data)
+	binary.BigEndian.PutUint32(header[:4], crc.Sum32())
+	buf.Write(header[:4])
+}
+
+// textKey returns the keyword of a tEXt or iTXt chunk
+func textKey(c pngChunk) string {
+	if c.typ != "tEXt" && c.typ != "iTXt" {
+		return ""
+	}
+	i := bytes.IndexByte(c.data, 0)
+	if i <= 0 {
+		return ""
+	}
+	return string(c.data[:i])
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,276 @@
+package composite_renderer
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"log"
+	"slices"
+)
+
+// colorProfile is the color space of an encoded image: an embedded ICC profile, and for PNGs the sRGB, gAMA and
+// cHRM chunks. Go's decoders ignore it, so it has to be carried over by hand or wide gamut images look washed out.
+type colorProfile struct {
+	name   string
+	icc    []byte
+	chunks []pngChunk
+}
+
+// colorChunks are the PNG chunks besides iCCP that describe the color space
+var colorChunks = []string{"sRGB", "gAMA", "cHRM"}
+
+// jpegICCMarker prefixes each APP2 segment that holds part of an ICC profile
+var jpegICCMarker = []byte("ICC_PROFILE\x00")
+
+// maxJPEGICCChunk is the most profile bytes that fit in one APP2 segment
+const maxJPEGICCChunk = 0xffff - 2 - 14
+
+func (p colorProfile) empty() bool {
+	return len(p.icc) == 0 && len(p.chunks) == 0
+}
+
+func (p colorProfile) equal(o colorProfile) bool {
+	return bytes.Equal(p.icc, o.icc) && slices.EqualFunc(p.chunks, o.chunks, func(a, b pngChunk) bool {
+		return a.typ == b.typ && bytes.Equal(a.data, b.data)
+	})
+}
+
+// readColorProfile returns the color profile of a PNG or JPEG. Other formats and malformed profiles return an empty one.
+func readColorProfile(data []byte) colorProfile {
+	var profile colorProfile
+	switch {
+	case bytes.HasPrefix(data, pngSignature):
+		chunks, err := readChunks(data)
+		if err != nil {
+			return profile
+		}
+		for _, c := range chunks {
+			switch {
+			case c.typ == "iCCP":
+				// profile name, null, compression method and the zlib compressed profile
+				i := bytes.IndexByte(c.data, 0)
+				if i <= 0 || i+2 > len(c.data) {
+					continue
+				}
+				reader, err := zlib.NewReader(bytes.NewReader(c.data[i+2:]))
+				if err != nil {
+					continue
+				}
+				icc, err := io.ReadAll(reader)
+				if err != nil {
+					continue
+				}
+				profile.name, profile.icc = string(c.data[:i]), icc
+			case slices.Contains(colorChunks, c.typ):
+				profile.chunks = append(profile.chunks, c)
+			}
+		}
+	case bytes.HasPrefix(data, []byte{0xff, 0xd8}):
+		var parts [][]byte
+		for _, segment := range jpegSegments(data) {
+			if segment[1] != 0xe2 || len(segment) < 4+len(jpegICCMarker)+2 || !bytes.HasPrefix(segment[4:], jpegICCMarker) {
+				continue
+			}
+			header := segment[4+len(jpegICCMarker):]
+			sequence, count := int(header[0]), int(header[1])
+			if sequence < 1 || sequence > count {
+				continue
+			}
+			if parts == nil {
+				parts = make([][]byte, count)
+			}
+			if sequence <= len(parts) {
+				parts[sequence-1] = header[2:]
+			}
+		}
+		if len(parts) > 0 && !slices.ContainsFunc(parts, func(part []byte) bool { return part == nil }) {
+			profile.icc = bytes.Join(parts, nil)
+		}
+	}
+	return profile
+}
+
+// apply returns a copy of the PNG or JPEG in data with its color profile replaced by p.
+// Other formats are returned as is, and JPEGs only keep the ICC profile.
+func (p colorProfile) apply(data []byte) ([]byte, error) {
+	if p.empty() {
+		return data, nil
+	}
+
+	switch {
+	case bytes.HasPrefix(data, pngSignature):
+		chunks, err := readChunks(data)
+		if err != nil {
+			return nil, err
+		}
+
+		var profileChunks []pngChunk
+		if len(p.icc) > 0 {
+			compressed := new(bytes.Buffer)
+			writer := zlib.NewWriter(compressed)
+			if _, err := writer.Write(p.icc); err != nil {
+				return nil, err
+			}
+			if err := writer.Close(); err != nil {
+				return nil, err
+			}
+			name := p.name
+			if name == "" {
+				name = "ICC profile"
+			}
+			profileChunks = append(profileChunks, pngChunk{typ: "iCCP", data: append(append([]byte(name), 0, 0), compressed.Bytes()...)})
+		}
+		for _, c := range p.chunks {
+			// sRGB and iCCP must not both be present
+			if c.typ == "sRGB" && len(p.icc) > 0 {
+				continue
+			}
+			profileChunks = append(profileChunks, c)
+		}
+
+		out := bytes.NewBuffer(make([]byte, 0, len(data)+len(p.icc)))
+		out.Write(pngSignature)
+		for i, c := range chunks {
+			if c.typ == "iCCP" || slices.Contains(colorChunks, c.typ) {
+				continue
+			}
+			writeChunk(out, c)
+			if i == 0 { // after IHDR, color chunks must come before PLTE and IDAT
+				for _, profileChunk := range profileChunks {
+					writeChunk(out, profileChunk)
+				}
+			}
+		}
+		return out.Bytes(), nil
+	case bytes.HasPrefix(data, []byte{0xff, 0xd8}):
+		if len(p.icc) == 0 {
+			return data, nil
+		}
+
+		segments := jpegSegments(data)
+		out := bytes.NewBuffer(make([]byte, 0, len(data)+len(p.icc)))
+		out.Write(data[:2])
+		var written, end int
+		for _, segment := range segments {
+			end += len(segment)
+			// keep the JFIF header first
+			if segment[1] == 0xe0 {
+				out.Write(segment)
+				continue
+			}
+			if segment[1] == 0xe2 && bytes.HasPrefix(segment[4:], jpegICCMarker) {
+				continue
+			}
+			if written == 0 {
+				writeJPEGICC(out, p.icc)
+				written++
+			}
+			out.Write(segment)
+		}
+		out.Write(data[2+end:])
+		return out.Bytes(), nil
+	default:
+		return data, nil
+	}
+}
+
+// writeJPEGICC writes profile as numbered APP2 segments
+func writeJPEGICC(out *bytes.Buffer, profile []byte) {
+	count := (len(profile) + maxJPEGICCChunk - 1) / maxJPEGICCChunk
+	for i := range count {
+		part := profile[i*maxJPEGICCChunk : min((i+1)*maxJPEGICCChunk, len(profile))]
+		var header [4]byte
+		header[0], header[1] = 0xff, 0xe2
+		binary.BigEndian.PutUint16(header[2:], uint16(2+len(jpegICCMarker)+2+len(part)))
+		out.Write(header[:])
+		out.Write(jpegICCMarker)
+		out.Write([]byte{byte(i + 1), byte(count)})
+		out.Write(part)
+	}
+}
+
+// jpegSegments returns the marker segments between the start of image and the start of scan, without the image data
+func jpegSegments(data []byte) [][]byte {
+	var segments [][]byte
+	for rest := data[2:]; len(rest) >= 4 && rest[0] == 0xff && rest[1] != 0xda; {
+		// the length counts itself, so anything below 2 is corrupt
+		length := int(binary.BigEndian.Uint16(rest[2:4])) + 2
+		if length < 4 || length > len(rest) {
+			break
+		}
+		segments = append(segments, rest[:length])
+		rest = rest[length:]
+	}
+	return segments
+}
+
+// is16Bit reports whether img has 16 bits per channel, so compositing it on an 8-bit canvas would lose precision
+func is16Bit(img image.Image) bool {
+	return is16BitModel(img.ColorModel())
+}
+
+// is16BitModel is is16Bit for the color model image.DecodeConfig reports
+func is16BitModel(model color.Model) bool {
+	switch model {
+	case color.RGBA64Model, color.NRGBA64Model, color.Gray16Model:
+		return true
+	}
+	return false
+}
+
+// readWithProfile reads the images and returns them with their common profile, see commonProfile
+func readWithProfile(readers []io.Reader) ([]io.Reader, colorProfile, error) {
+	data := make([][]byte, len(readers))
+	out := make([]io.Reader, len(readers))
+	for i, r := range readers {
+		var err error
+		data[i], err = io.ReadAll(r)
+		if err != nil {
+			return nil, colorProfile{}, err
+		}
+		out[i] = bytes.NewReader(data[i])
+	}
+	return out, commonProfile(data), nil
+}
+
+// commonProfile returns the color profile of the first image that has one.
+// Images are assumed to share a profile, converting between profiles needs a color management library.
+func commonProfile(data [][]byte) colorProfile {
+	var profile colorProfile
+	for i := range data {
+		p := readColorProfile(data[i])
+		switch {
+		case p.empty():
+		case profile.empty():
+			profile = p
+		case !profile.equal(p):
+			log.Printf("Image %d has a different color profile than the first, keeping the first", i)
+		}
+	}
+	return profile
+}
+
+// encodePNGWithProfile encodes img as a PNG with the color profile p
+func encodePNGWithProfile(img image.Image, p colorProfile) (io.Reader, error) {
+	buf := new(bytes.Buffer)
+	if err := encodePNG(buf, img); err != nil {
+		return nil, err
+	}
+	data, err := p.apply(buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+// newCanvas returns a 16-bit canvas if any of the images is 16-bit, and an 8-bit one otherwise
+func newCanvas(r image.Rectangle, images ...image.Image) draw.Image {
+	if slices.ContainsFunc(images, is16Bit) {
+		return image.NewRGBA64(r)
+	}
+	return image.NewRGBA(r)
+}
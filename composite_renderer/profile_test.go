@@ -0,0 +1,41 @@
+package composite_renderer
+
+import (
+	"testing"
+)
+
+func TestReadColorProfileMalformedJPEG(t *testing.T) {
+	app2 := func(length uint16, body ...byte) []byte {
+		return append([]byte{0xff, 0xe2, byte(length >> 8), byte(length)}, body...)
+	}
+	jpeg := func(segments ...[]byte) []byte {
+		data := []byte{0xff, 0xd8}
+		for _, segment := range segments {
+			data = append(data, segment...)
+		}
+		return append(data, 0xff, 0xda)
+	}
+	icc := append([]byte(nil), jpegICCMarker...)
+
+	for _, tt := range []struct {
+		name string
+		data []byte
+	}{
+		{"zero length", jpeg(app2(0))},
+		{"length below its own size", jpeg(app2(1))},
+		{"length without a body", []byte{0xff, 0xd8, 0xff, 0xe2, 0x00, 0x02}},
+		{"length past the end", jpeg(app2(200, icc...))},
+		{"marker without sequence", jpeg(app2(uint16(2+len(icc)), icc...))},
+		{"truncated marker", jpeg(app2(6, 'I', 'C', 'C', '_'))},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			profile := readColorProfile(tt.data)
+			if !profile.empty() {
+				t.Errorf("read a profile from a malformed APP2 segment: %+v", profile)
+			}
+			if _, err := (colorProfile{icc: []byte("profile")}).apply(tt.data); err != nil {
+				t.Errorf("applying a profile: %v", err)
+			}
+		})
+	}
+}
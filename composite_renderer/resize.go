@@ -0,0 +1,80 @@
+package composite_renderer
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"io"
+)
+
+// Resize scales img to width by height. Downscaling averages the source pixels covered by each output pixel,
+// upscaling uses nearest neighbor sampling.
+func Resize(img image.Image, width, height int) image.Image {
+	bounds := img.Bounds()
+	if width <= 0 || height <= 0 {
+		return image.NewRGBA(image.Rect(0, 0, max(width, 0), max(height, 0)))
+	}
+	if width >= bounds.Dx() || height >= bounds.Dy() {
+		return scaleNearest(img, image.Rect(0, 0, width, height))
+	}
+
+	src, ok := img.(*image.RGBA)
+	if !ok || src.Bounds().Min != (image.Point{}) {
+		src = image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+		draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+	}
+
+	srcWidth, srcHeight := src.Bounds().Dx(), src.Bounds().Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		y0, y1 := y*srcHeight/height, max((y+1)*srcHeight/height, y*srcHeight/height+1)
+		for x := range width {
+			x0, x1 := x*srcWidth/width, max((x+1)*srcWidth/width, x*srcWidth/width+1)
+
+			var r, g, b, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride+x0*4 : sy*src.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					r += uint32(row[i])
+					g += uint32(row[i+1])
+					b += uint32(row[i+2])
+					a += uint32(row[i+3])
+					n++
+				}
+			}
+
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(b / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+
+	return dst
+}
+
+// Thumbnail downscales the image in r so its longest side is at most maxSide, keeping the aspect ratio.
+// Images that are already small enough are returned as is.
+func Thumbnail(r io.Reader, maxSide int) (io.Reader, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if maxSide <= 0 || max(config.Width, config.Height) <= maxSide {
+		return bytes.NewReader(data), nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	bounds := fitRect(img.Bounds(), maxSide)
+
+	return encodePNGWithProfile(Resize(img, bounds.Dx(), bounds.Dy()), readColorProfile(data))
+}
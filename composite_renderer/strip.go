@@ -0,0 +1,78 @@
+package composite_renderer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+)
+
+// metadataChunks are the PNG chunks removed by StripMetadata
+var metadataChunks = map[string]bool{
+	"tEXt": true,
+	"iTXt": true,
+	"zTXt": true,
+	"eXIf": true,
+	"tIME": true,
+}
+
+// StripMetadata removes text chunks, EXIF and comments from a PNG or JPEG, keeping color profiles.
+// Other formats are decoded and re-encoded as a PNG, which drops all metadata.
+func StripMetadata(data []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(data, pngSignature):
+		chunks, err := readChunks(data)
+		if err != nil {
+			return nil, err
+		}
+
+		out := bytes.NewBuffer(make([]byte, 0, len(data)))
+		out.Write(pngSignature)
+		for _, c := range chunks {
+			if !metadataChunks[c.typ] {
+				writeChunk(out, c)
+			}
+		}
+		return out.Bytes(), nil
+	case bytes.HasPrefix(data, []byte{0xff, 0xd8}):
+		return stripJPEG(data)
+	default:
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		out := new(bytes.Buffer)
+		if err := encodePNG(out, img); err != nil {
+			return nil, err
+		}
+		return out.Bytes(), nil
+	}
+}
+
+// stripJPEG removes APP1 (EXIF, XMP), APP13 (IPTC) and comment segments before the image data
+func stripJPEG(data []byte) ([]byte, error) {
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:2])
+
+	for rest := data[2:]; ; {
+		if len(rest) < 4 || rest[0] != 0xff {
+			return nil, errors.New("malformed jpeg segment")
+		}
+		marker := rest[1]
+		if marker == 0xda { // start of scan, the rest is image data
+			out.Write(rest)
+			return out.Bytes(), nil
+		}
+
+		length := int(binary.BigEndian.Uint16(rest[2:4])) + 2
+		if len(rest) < length {
+			return nil, errors.New("truncated jpeg segment")
+		}
+		switch marker {
+		case 0xe1, 0xed, 0xfe:
+		default:
+			out.Write(rest[:length])
+		}
+		rest = rest[length:]
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"errors"
 	"image"
 	"image/draw"
-	"image/png"
 	"io"
 	"math"
 )
@@ -18,13 +17,9 @@ func (r *tilerImpl) TileImages(imageBufs []io.Reader) (io.Reader, error) {
 		return nil, errors.New("no images provided")
 	}
 
-	images := make([]image.Image, numImages)
-	for i, buf := range imageBufs {
-		img, _, err := image.Decode(buf)
-		if err != nil {
-			return nil, err
-		}
-		images[i] = img
+	images, err := decodeAll(imageBufs)
+	if err != nil {
+		return nil, err
 	}
 
 	firstBounds := images[0].Bounds()
@@ -46,8 +41,7 @@ func (r *tilerImpl) TileImages(imageBufs []io.Reader) (io.Reader, error) {
 	}
 
 	imageBuf := new(bytes.Buffer)
-	err := png.Encode(imageBuf, retImage)
-	if err != nil {
+	if err := encodePNG(imageBuf, retImage); err != nil {
 		return nil, err
 	}
 
@@ -0,0 +1,103 @@
+package composite_renderer
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+)
+
+// Corner is where a watermark is placed.
+type Corner string
+
+const (
+	CornerTopLeft     Corner = "top_left"
+	CornerTopRight    Corner = "top_right"
+	CornerBottomLeft  Corner = "bottom_left"
+	CornerBottomRight Corner = "bottom_right"
+)
+
+// Watermark is a text or image overlay drawn in a corner of outbound images.
+type Watermark struct {
+	// Text is drawn when Image is nil
+	Text string
+	// Image is scaled down to at most a fifth of the image width
+	Image image.Image
+	// Corner defaults to CornerBottomRight
+	Corner Corner
+	// Opacity is between 0 and 1. Default is 0.5
+	Opacity float64
+	// Margin is the distance in pixels from the edges. Default is 2% of the shortest side
+	Margin int
+	// Font defaults to BitmapFont with a scale relative to the image size
+	Font Font
+}
+
+// ApplyWatermark draws wm on the image in r and returns it as a PNG. r is returned as is if wm is nil or empty.
+func ApplyWatermark(r io.Reader, wm *Watermark) (io.Reader, error) {
+	if wm == nil || (wm.Text == "" && wm.Image == nil) {
+		return r, nil
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	dst := newCanvas(image.Rect(0, 0, bounds.Dx(), bounds.Dy()), img)
+	draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Src)
+
+	mark := wm.overlay(dst.Bounds())
+	size := mark.Bounds().Size()
+
+	margin := wm.Margin
+	if margin <= 0 {
+		margin = min(dst.Bounds().Dx(), dst.Bounds().Dy()) / 50
+	}
+
+	var pt image.Point
+	switch wm.Corner {
+	case CornerTopLeft:
+		pt = image.Pt(margin, margin)
+	case CornerTopRight:
+		pt = image.Pt(dst.Bounds().Dx()-size.X-margin, margin)
+	case CornerBottomLeft:
+		pt = image.Pt(margin, dst.Bounds().Dy()-size.Y-margin)
+	default:
+		pt = image.Pt(dst.Bounds().Dx()-size.X-margin, dst.Bounds().Dy()-size.Y-margin)
+	}
+
+	opacity := wm.Opacity
+	if opacity <= 0 || opacity > 1 {
+		opacity = 0.5
+	}
+	mask := image.NewUniform(color.Alpha{A: uint8(opacity * 255)})
+	draw.DrawMask(dst, image.Rectangle{Min: pt, Max: pt.Add(size)}, mark, mark.Bounds().Min, mask, image.Point{}, draw.Over)
+
+	return encodePNGWithProfile(dst, readColorProfile(data))
+}
+
+// overlay returns the watermark at full opacity, sized for an image with the given bounds
+func (wm *Watermark) overlay(bounds image.Rectangle) image.Image {
+	if wm.Image != nil {
+		return scaleNearest(wm.Image, fitRect(wm.Image.Bounds(), max(bounds.Dx()/5, 1)))
+	}
+
+	font := wm.Font
+	if font == nil {
+		font = BitmapFont{Scale: max(min(bounds.Dx(), bounds.Dy())/(glyphHeight*25), 1)}
+	}
+
+	// draw the text with a one pixel shadow so it is readable on light and dark images
+	width, height := font.Measure(wm.Text)
+	overlay := image.NewRGBA(image.Rect(0, 0, width+1, height+1))
+	font.Draw(overlay, image.Pt(1, 1), wm.Text, color.Black)
+	font.Draw(overlay, image.Point{}, wm.Text, color.White)
+	return overlay
+}
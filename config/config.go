@@ -0,0 +1,491 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"stable_diffusion_bot/api/stable_diffusion_api"
+	"stable_diffusion_bot/composite_renderer"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Config is everything the bot reads at startup. Each setting is layered: its default, then the config file,
+// then its environment variable, then its command line flag. Settings tagged secret can also be read from the file
+// named by their environment variable with a _FILE suffix, like Docker secrets.
+type Config struct {
+	BotToken       string `yaml:"bot_token" env:"BOT_TOKEN" flag:"token" secret:"true" usage:"Bot access token"`
+	GuildID        string `yaml:"guild_id" env:"GUILD_ID" flag:"guild" usage:"Guild ID. If not passed - bot registers commands globally"`
+	OwnerID        string `yaml:"owner_id" env:"OWNER_ID" flag:"owner" usage:"User ID of the bot owner. If not passed - the application owner is used"`
+	ImagineCommand string `yaml:"imagine_command" env:"IMAGINE_COMMAND" flag:"imagine" usage:"Imagine command name"`
+	RemoveCommands bool   `yaml:"remove_commands" env:"REMOVE_COMMANDS" flag:"remove" usage:"Delete all commands when bot exits"`
+	AuditChannel   string `yaml:"audit_channel" env:"AUDIT_CHANNEL" flag:"audit-channel" usage:"Channel ID to post model switches, config changes and queue pauses to. Default doesn't post them"`
+	HealthAddr     string `yaml:"health_addr" env:"HEALTH_ADDR" flag:"health-addr" usage:"Address to serve /healthz and /livez on, e.g. :8080. Default doesn't serve health checks"`
+	PprofAddr      string `yaml:"pprof_addr" env:"PPROF_ADDR" flag:"pprof-addr" usage:"Address to serve net/http/pprof profiles on, e.g. 127.0.0.1:6060. Default doesn't serve them"`
+
+	APIHost          string      `yaml:"api_host" env:"API_HOST" flag:"host" usage:"Host for the Automatic1111 API"`
+	APIHosts         string      `yaml:"api_hosts" env:"API_HOSTS" flag:"hosts" usage:"More Automatic1111 APIs with the same models as api_host, separated by commas. Generations run on whichever is idle, one at a time on each. Default only uses api_host"`
+	APIAuth          string      `yaml:"api_auth" env:"API_AUTH" flag:"api-auth" secret:"true" usage:"Credentials of an Automatic1111 API started with --api-auth, as user:password"`
+	APIProxy         string      `yaml:"api_proxy" env:"API_PROXY" flag:"api-proxy" secret:"true" usage:"http, https or socks5 proxy to reach the Automatic1111 API through. Default uses HTTP_PROXY, HTTPS_PROXY and NO_PROXY"`
+	APIHeaders       string      `yaml:"api_headers" env:"API_HEADERS" flag:"api-headers" secret:"true" usage:"Headers sent with every request to the Automatic1111 API, as Name: value separated by semicolons, e.g. for Cloudflare Access"`
+	UserAgent        string      `yaml:"user_agent" env:"USER_AGENT" flag:"user-agent" usage:"User-Agent of requests to the Automatic1111 API and NovelAI. Default is Go's"`
+	LLMHost          string      `yaml:"llm_host" env:"LLM_HOST" flag:"llm" usage:"LLM model to use"`
+	NovelAIToken     string      `yaml:"novelai_token" env:"NOVELAI_TOKEN" flag:"novelai" secret:"true" usage:"NovelAI API token"`
+	NovelAIProxy     string      `yaml:"novelai_proxy" env:"NOVELAI_PROXY" flag:"novelai-proxy" secret:"true" usage:"http, https or socks5 proxy to reach NovelAI through. Default uses HTTP_PROXY, HTTPS_PROXY and NO_PROXY"`
+	APIRetry         APIRetry    `yaml:"api_retry"`
+	APITimeouts      APITimeouts `yaml:"api_timeouts"`
+	APIMaxConcurrent int         `yaml:"api_max_concurrent" env:"API_MAX_CONCURRENT" flag:"api-max-concurrent" usage:"Most requests in flight to the Automatic1111 API at once, including progress polls, at least 2. Default doesn't limit them"`
+
+	MaxMegapixels        float64 `yaml:"max_megapixels" env:"MAX_MEGAPIXELS" flag:"max-megapixels" usage:"Largest image in megapixels asked of the Automatic1111 API, including hires fix. Larger requests are scaled down, except the bot owner's. Default doesn't limit them"`
+	NovelAIMaxMegapixels float64 `yaml:"novelai_max_megapixels" env:"NOVELAI_MAX_MEGAPIXELS" flag:"novelai-max-megapixels" usage:"Largest image in megapixels asked of NovelAI. Larger requests are scaled down, except the bot owner's. Default doesn't limit them"`
+	NovelAIDailyAnlas    int     `yaml:"novelai_daily_anlas" env:"NOVELAI_DAILY_ANLAS" flag:"novelai-daily-anlas" usage:"Anlas each member can spend on NovelAI per UTC day, except the bot owner. Paid requests past it are made at the free size or refused. Default doesn't limit them"`
+	NovelAIMonthlyAnlas  int     `yaml:"novelai_monthly_anlas" env:"NOVELAI_MONTHLY_ANLAS" flag:"novelai-monthly-anlas" usage:"Anlas each member can spend on NovelAI per UTC month, except the bot owner. Default doesn't limit them"`
+	ModelFamilies        string  `yaml:"model_families" env:"MODEL_FAMILIES" flag:"model-families" usage:"Families of checkpoints their names don't give away, as checkpoint=family separated by commas, e.g. myMerge=sdxl. Family is sd15, sd2, sdxl or flux. Default guesses from the names"`
+
+	Database      Database      `yaml:"database"`
+	DryRun        bool          `yaml:"dry_run" env:"DRY_RUN" flag:"dry-run" usage:"Post the request JSON of generations back instead of sending them to the API"`
+	TimingFooter  bool          `yaml:"timing_footer" env:"TIMING_FOOTER" flag:"timing-footer" usage:"Append how long each phase of a generation took to its embed footer"`
+	RestoreWindow time.Duration `yaml:"restore_window" env:"RESTORE_WINDOW" flag:"restore-window" usage:"How long deleted generations can be restored by an admin"`
+	Images        Images        `yaml:"images"`
+	Grid          Grid          `yaml:"grid"`
+	Logging       Logging       `yaml:"logging"`
+	Shards        Shards        `yaml:"shards"`
+	Gateway       Gateway       `yaml:"gateway"`
+	Admin         Admin         `yaml:"admin"`
+	Reporting     Reporting     `yaml:"reporting"`
+	NovelAIRetry  NovelAIRetry  `yaml:"novelai_retry"`
+
+	// path is the config file the settings were read from, if any
+	path string
+}
+
+type APIRetry struct {
+	Attempts int           `yaml:"attempts" env:"API_RETRY_ATTEMPTS" flag:"api-retry-attempts" usage:"Most times a request to the Automatic1111 API is sent, 1 disables retries. Default is 3"`
+	Delay    time.Duration `yaml:"delay" env:"API_RETRY_DELAY" flag:"api-retry-delay" usage:"Delay before retrying a request to the API, doubled after each retry. Default is 500ms"`
+	MaxDelay time.Duration `yaml:"max_delay" env:"API_RETRY_MAX_DELAY" flag:"api-retry-max-delay" usage:"Longest delay between retries. Default is 10s"`
+}
+
+type NovelAIRetry struct {
+	Attempts int           `yaml:"attempts" env:"NOVELAI_RETRY_ATTEMPTS" flag:"novelai-retry-attempts" usage:"Most times a generation is sent to NovelAI while it's busy, 1 disables retries. Default is 5"`
+	Delay    time.Duration `yaml:"delay" env:"NOVELAI_RETRY_DELAY" flag:"novelai-retry-delay" usage:"Delay before retrying a generation NovelAI was busy for, doubled after each retry. A longer Retry-After is waited instead. Default is 2s"`
+	MaxDelay time.Duration `yaml:"max_delay" env:"NOVELAI_RETRY_MAX_DELAY" flag:"novelai-retry-max-delay" usage:"Longest delay between retries of NovelAI generations. Default is 30s"`
+}
+
+type APITimeouts struct {
+	Request    time.Duration `yaml:"request" env:"API_TIMEOUT" flag:"api-timeout" usage:"Timeout of requests to the API like listing models. Default is 30s"`
+	Progress   time.Duration `yaml:"progress" env:"API_PROGRESS_TIMEOUT" flag:"api-progress-timeout" usage:"Timeout of progress polling, a dead API is noticed after this long. Default is 5s"`
+	Options    time.Duration `yaml:"options" env:"API_OPTIONS_TIMEOUT" flag:"api-options-timeout" usage:"Timeout of changing options, including loading another checkpoint. Default is 1m"`
+	Generation time.Duration `yaml:"generation" env:"API_GENERATION_TIMEOUT" flag:"api-generation-timeout" usage:"Timeout of generations and upscales. Default is 10m"`
+}
+
+type Shards struct {
+	Count int    `yaml:"count" env:"SHARD_COUNT" flag:"shard-count" usage:"Total number of gateway shards across every process. Default is a single connection"`
+	Auto  bool   `yaml:"auto" env:"SHARD_AUTO" flag:"shard-auto" usage:"Use the number of shards recommended by Discord instead of count"`
+	IDs   string `yaml:"ids" env:"SHARD_IDS" flag:"shard-ids" usage:"Comma separated IDs of the shards this process runs, e.g. 0,1. Default runs every shard"`
+}
+
+// ParseIDs returns the shard IDs of ids, or nil when this process runs every shard
+func (s Shards) ParseIDs() ([]int, error) {
+	if s.IDs == "" {
+		return nil, nil
+	}
+	var ids []int
+	for _, field := range strings.Split(s.IDs, ",") {
+		id, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || id < 0 {
+			return nil, fmt.Errorf("%q is not a shard ID", field)
+		}
+		if slices.Contains(ids, id) {
+			return nil, fmt.Errorf("shard %d is listed twice", id)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// ParseAPIHeaders returns the headers of api_headers, "Name: value; Other: value", with the user agent
+func (c *Config) ParseAPIHeaders() (http.Header, error) {
+	header := make(http.Header)
+	for _, field := range strings.Split(c.APIHeaders, ";") {
+		if strings.TrimSpace(field) == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(field, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("%q is not a Name: value header", strings.TrimSpace(name))
+		}
+		header.Add(name, strings.TrimSpace(value))
+	}
+	if c.UserAgent != "" {
+		header.Set("User-Agent", c.UserAgent)
+	}
+	return header, nil
+}
+
+// ParseAPIHosts returns the hosts of api_hosts, "http://gpu1:7860, http://gpu2:7860", without their trailing slash
+func (c *Config) ParseAPIHosts() ([]string, error) {
+	var hosts []string
+	for _, field := range strings.Split(c.APIHosts, ",") {
+		host := strings.TrimSuffix(strings.TrimSpace(field), "/")
+		if host == "" {
+			continue
+		}
+		if u, err := url.Parse(host); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("%q is not an http or https URL", host)
+		}
+		if host == c.APIHost || slices.Contains(hosts, host) {
+			return nil, fmt.Errorf("%s is listed more than once", host)
+		}
+		hosts = append(hosts, host)
+	}
+	return hosts, nil
+}
+
+// ParseModelFamilies returns the families of model_families, "checkpoint=family, other=family", by checkpoint
+func (c *Config) ParseModelFamilies() (map[string]string, error) {
+	families := make(map[string]string)
+	for _, field := range strings.Split(c.ModelFamilies, ",") {
+		if strings.TrimSpace(field) == "" {
+			continue
+		}
+		checkpoint, family, ok := strings.Cut(field, "=")
+		checkpoint, family = strings.TrimSpace(checkpoint), strings.TrimSpace(family)
+		if !ok || checkpoint == "" || family == "" {
+			return nil, fmt.Errorf("%q is not a checkpoint=family pair", strings.TrimSpace(field))
+		}
+		// parsed like the stable_diffusion queue does, so a typo is reported with the other invalid settings
+		if _, err := stable_diffusion_api.ParseModelFamily(family); err != nil {
+			return nil, fmt.Errorf("checkpoint %q: %w", checkpoint, err)
+		}
+		families[checkpoint] = family
+	}
+	return families, nil
+}
+
+type Gateway struct {
+	Intents string `yaml:"intents" env:"GATEWAY_INTENTS" flag:"gateway-intents" usage:"Comma separated gateway intents to request, e.g. guilds,guild_messages. Default is guilds, commands and buttons need no intent"`
+	Cache   string `yaml:"cache" env:"GATEWAY_CACHE" flag:"gateway-cache" usage:"What the gateway session keeps in memory: guilds, all or none. Default is guilds"`
+}
+
+// gatewayIntents are the intents by the names Discord documents them under
+var gatewayIntents = map[string]discordgo.Intent{
+	"guilds":                        discordgo.IntentGuilds,
+	"guild_members":                 discordgo.IntentGuildMembers,
+	"guild_moderation":              discordgo.IntentGuildModeration,
+	"guild_emojis_and_stickers":     discordgo.IntentGuildEmojis,
+	"guild_integrations":            discordgo.IntentGuildIntegrations,
+	"guild_webhooks":                discordgo.IntentGuildWebhooks,
+	"guild_invites":                 discordgo.IntentGuildInvites,
+	"guild_voice_states":            discordgo.IntentGuildVoiceStates,
+	"guild_presences":               discordgo.IntentGuildPresences,
+	"guild_messages":                discordgo.IntentGuildMessages,
+	"guild_message_reactions":       discordgo.IntentGuildMessageReactions,
+	"guild_message_typing":          discordgo.IntentGuildMessageTyping,
+	"direct_messages":               discordgo.IntentDirectMessages,
+	"direct_message_reactions":      discordgo.IntentDirectMessageReactions,
+	"direct_message_typing":         discordgo.IntentDirectMessageTyping,
+	"message_content":               discordgo.IntentMessageContent,
+	"guild_scheduled_events":        discordgo.IntentGuildScheduledEvents,
+	"auto_moderation_configuration": discordgo.IntentAutoModerationConfiguration,
+	"auto_moderation_execution":     discordgo.IntentAutoModerationExecution,
+}
+
+// ParseIntents returns the intents of intents, or only guilds when none are set
+func (g Gateway) ParseIntents() (discordgo.Intent, error) {
+	if strings.TrimSpace(g.Intents) == "" {
+		return discordgo.IntentGuilds, nil
+	}
+	var intents discordgo.Intent
+	for _, field := range strings.Split(g.Intents, ",") {
+		intent, ok := gatewayIntents[strings.ToLower(strings.TrimSpace(field))]
+		if !ok {
+			return 0, fmt.Errorf("%q is not a gateway intent", field)
+		}
+		intents |= intent
+	}
+	return intents, nil
+}
+
+type Admin struct {
+	Addr  string `yaml:"addr" env:"ADMIN_ADDR" flag:"admin-addr" usage:"Address to serve the admin API on, e.g. 127.0.0.1:8081. Default doesn't serve it"`
+	Token string `yaml:"token" env:"ADMIN_TOKEN" flag:"admin-token" secret:"true" usage:"Bearer token required by every request to the admin API"`
+}
+
+type Reporting struct {
+	SentryDSN   string `yaml:"sentry_dsn" env:"SENTRY_DSN" flag:"sentry-dsn" secret:"true" usage:"Report panics and failed generations to Sentry"`
+	WebhookURL  string `yaml:"webhook_url" env:"ERROR_WEBHOOK_URL" flag:"error-webhook" secret:"true" usage:"Report panics and failed generations by POSTing them as JSON to this URL"`
+	Environment string `yaml:"environment" env:"REPORTING_ENVIRONMENT" flag:"reporting-environment" usage:"Environment attached to error reports, e.g. production"`
+}
+
+type Database struct {
+	Path        string        `yaml:"path" env:"DB_PATH" flag:"db" usage:"Path to the SQLite database, or :memory: for an ephemeral database. Default is sd_discord_bot.sqlite"`
+	Driver      string        `yaml:"driver" env:"DB_DRIVER" flag:"db-driver" usage:"SQLite driver to use. Default is the pure-Go \"sqlite\" driver, \"sqlite3\" needs a build with -tags sqlite_cgo"`
+	MaxConns    int           `yaml:"max_conns" env:"DB_MAX_CONNS" flag:"db-max-conns" usage:"Maximum open connections to the database. Default is 4"`
+	BusyTimeout time.Duration `yaml:"busy_timeout" env:"DB_BUSY_TIMEOUT" flag:"db-busy-timeout" usage:"How long to wait for a database lock. Default is 5s"`
+}
+
+// Validate reports the invalid database settings, the only ones the offline subcommands like migrate need
+func (d Database) Validate() error {
+	var errs []error
+	if d.MaxConns < 0 {
+		errs = append(errs, fmt.Errorf("database.max_conns: cannot be negative, got %d", d.MaxConns))
+	}
+	if d.BusyTimeout < 0 {
+		errs = append(errs, fmt.Errorf("database.busy_timeout: cannot be negative, got %s", d.BusyTimeout))
+	}
+	return errors.Join(errs...)
+}
+
+type Images struct {
+	Format         string `yaml:"format" env:"IMAGE_FORMAT" flag:"image-format" usage:"Preferred output format: png, jpeg or webp. Default keeps png until images are too large"`
+	UploadLimit    int    `yaml:"upload_limit" env:"UPLOAD_LIMIT" flag:"upload-limit" usage:"Upload budget per message in MiB, images are re-encoded to fit. Default is the upload limit of the server"`
+	UpscaleCompare string `yaml:"upscale_compare" env:"UPSCALE_COMPARE" flag:"upscale-compare" usage:"Before and after crop added to upscales: side, diagonal or none. Default is side"`
+	Renderer       string `yaml:"renderer" env:"RENDERER" flag:"renderer" usage:"Backend that tiles grids: go, imagemagick or vips. Default is go"`
+	RendererBinary string `yaml:"renderer_binary" env:"RENDERER_BINARY" flag:"renderer-binary" usage:"Path to the imagemagick or vips binary. Default looks it up on the PATH"`
+	PreviewSize    int    `yaml:"preview_size" env:"PREVIEW_SIZE" flag:"preview-size" usage:"Longest side in pixels of the images shown in a generation, full resolution images are sent with a button. Default shows full resolution images"`
+	ArchiveGrids   bool   `yaml:"archive_grids" env:"ARCHIVE_GRIDS" flag:"archive-grids" usage:"Attach the full resolution images of grids as a ZIP when it fits the upload limit"`
+	StealthPNGInfo bool   `yaml:"stealth_pnginfo" env:"STEALTH_PNGINFO" flag:"stealth-pnginfo" usage:"Also hide generation parameters in the alpha channel of uploaded PNGs"`
+}
+
+type Grid struct {
+	Columns      int     `yaml:"columns" env:"GRID_COLUMNS" flag:"grid-columns" usage:"Number of columns of grids with more than four images. Default picks from the image count"`
+	AspectRatio  float64 `yaml:"aspect_ratio" env:"GRID_ASPECT_RATIO" flag:"grid-aspect-ratio" usage:"Width over height that grid layouts aim for, e.g. 1 for square grids. Default is 16:9"`
+	Gutter       int     `yaml:"gutter" env:"GRID_GUTTER" flag:"grid-gutter" usage:"Space in pixels between grid tiles. Default is 0"`
+	Background   string  `yaml:"background" env:"GRID_BACKGROUND" flag:"grid-background" usage:"Hex color of the grid gutter, e.g. #1e1f22. Default is transparent"`
+	Border       int     `yaml:"border" env:"GRID_BORDER" flag:"grid-border" usage:"Width in pixels of the border around each grid tile. Default is no border"`
+	BorderColor  string  `yaml:"border_color" env:"GRID_BORDER_COLOR" flag:"grid-border-color" usage:"Hex color of grid tile borders. Default is white"`
+	CornerRadius int     `yaml:"corner_radius" env:"GRID_CORNER_RADIUS" flag:"grid-corner-radius" usage:"Radius in pixels of the rounded corners of grid tiles. Default is square corners"`
+	Labels       string  `yaml:"labels" env:"GRID_LABELS" flag:"grid-labels" usage:"Label drawn on each tile of a grid: index, seed or model. Default is no labels"`
+	LabelScale   int     `yaml:"label_scale" env:"GRID_LABEL_SCALE" flag:"grid-label-scale" usage:"Font scale of grid labels. Default scales with the image size"`
+	LabelMargin  int     `yaml:"label_margin" env:"GRID_LABEL_MARGIN" flag:"grid-label-margin" usage:"Distance in pixels between grid labels and the tile corner. Default is 8"`
+}
+
+type Logging struct {
+	File       string        `yaml:"file" env:"LOG_FILE" flag:"log-file" usage:"Also write logs to this file, rotated when it gets too large or too old. Default only logs to stderr"`
+	MaxSize    int           `yaml:"max_size" env:"LOG_MAX_SIZE" flag:"log-max-size" usage:"Size in MiB at which the log file is rotated. Default is 10"`
+	MaxAge     time.Duration `yaml:"max_age" env:"LOG_MAX_AGE" flag:"log-max-age" usage:"Age at which the log file is rotated, e.g. 24h. Default only rotates by size"`
+	MaxBackups int           `yaml:"max_backups" env:"LOG_MAX_BACKUPS" flag:"log-max-backups" usage:"Number of rotated log files to keep. Default is 5"`
+}
+
+// placeholderToken is the bot token of the example .env
+const placeholderToken = "YOUR_BOT_TOKEN_HERE"
+
+// Default returns the settings used when neither the config file, the environment nor flags set them
+func Default() *Config {
+	return &Config{
+		ImagineCommand: "imagine",
+	}
+}
+
+// Validate reports every invalid setting at once, so they can all be fixed before the next start
+func (c *Config) Validate() error {
+	var errs []error
+	invalid := func(key string, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+	}
+
+	if err := c.Database.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+
+	switch c.BotToken {
+	case "":
+		invalid("bot_token", "is required, set it in the config file, BOT_TOKEN or -token")
+	case placeholderToken:
+		invalid("bot_token", "is still the example %s, set your token in the config file, BOT_TOKEN or -token", placeholderToken)
+	}
+
+	if c.APIHost == "" {
+		invalid("api_host", "is required, e.g. http://localhost:7860")
+	} else if u, err := url.Parse(c.APIHost); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		invalid("api_host", "%q is not an http or https URL", c.APIHost)
+	}
+	if _, err := c.ParseAPIHosts(); err != nil {
+		invalid("api_hosts", "%v", err)
+	}
+	if c.APIAuth != "" {
+		if user, password, ok := strings.Cut(c.APIAuth, ":"); !ok || user == "" || password == "" {
+			invalid("api_auth", "must be user:password")
+		}
+	}
+	if c.APIMaxConcurrent == 1 {
+		invalid("api_max_concurrent", "must be at least 2, progress polls and interrupts would wait for the generation to finish")
+	}
+	if _, err := c.ParseAPIHeaders(); err != nil {
+		invalid("api_headers", "%v", err)
+	}
+	for key, proxy := range map[string]string{"api_proxy": c.APIProxy, "novelai_proxy": c.NovelAIProxy} {
+		if proxy == "" {
+			continue
+		}
+		if u, err := url.Parse(proxy); err != nil || u.Host == "" {
+			invalid(key, "is not a URL, e.g. socks5://127.0.0.1:1080")
+		} else if !slices.Contains([]string{"http", "https", "socks5", "socks5h"}, u.Scheme) {
+			invalid(key, "%q must be an http, https, socks5 or socks5h URL", u.Scheme)
+		}
+	}
+	if c.LLMHost != "" {
+		if _, err := url.Parse(c.LLMHost); err != nil {
+			invalid("llm_host", "%q is not a URL: %v", c.LLMHost, err)
+		}
+	}
+
+	if c.HealthAddr != "" {
+		if _, _, err := net.SplitHostPort(c.HealthAddr); err != nil {
+			invalid("health_addr", "%q is not a host:port address: %v", c.HealthAddr, err)
+		}
+	}
+
+	if c.PprofAddr != "" {
+		if _, _, err := net.SplitHostPort(c.PprofAddr); err != nil {
+			invalid("pprof_addr", "%q is not a host:port address: %v", c.PprofAddr, err)
+		}
+	}
+
+	if c.Shards.Auto && c.Shards.Count != 0 {
+		invalid("shards.auto", "cannot be combined with shards.count, the count is picked by Discord")
+	}
+	if ids, err := c.Shards.ParseIDs(); err != nil {
+		invalid("shards.ids", "%v", err)
+	} else if len(ids) > 0 {
+		switch {
+		case !c.Shards.Auto && c.Shards.Count == 0:
+			invalid("shards.ids", "needs shards.count or shards.auto")
+		case c.Shards.Count > 0 && slices.Max(ids) >= c.Shards.Count:
+			invalid("shards.ids", "%d is out of range of %d shards, IDs start at 0", slices.Max(ids), c.Shards.Count)
+		}
+	}
+
+	if _, err := c.Gateway.ParseIntents(); err != nil {
+		invalid("gateway.intents", "%v", err)
+	}
+
+	if c.Admin.Addr != "" {
+		if _, _, err := net.SplitHostPort(c.Admin.Addr); err != nil {
+			invalid("admin.addr", "%q is not a host:port address: %v", c.Admin.Addr, err)
+		}
+		if c.Admin.Token == "" {
+			invalid("admin.token", "is required to serve the admin API, set it in the config file, ADMIN_TOKEN or -admin-token")
+		}
+	}
+
+	if c.Reporting.WebhookURL != "" {
+		if u, err := url.Parse(c.Reporting.WebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			invalid("reporting.webhook_url", "%q is not an http or https URL", c.Reporting.WebhookURL)
+		}
+	}
+
+	if c.ImagineCommand == "" {
+		invalid("imagine_command", "cannot be empty")
+	} else if c.ImagineCommand != strings.ToLower(c.ImagineCommand) || strings.ContainsAny(c.ImagineCommand, " \t") {
+		invalid("imagine_command", "%q must be lowercase without spaces to be a Discord command", c.ImagineCommand)
+	}
+
+	nonNegative := map[string]int{
+		"api_retry.attempts":  c.APIRetry.Attempts,
+		"api_max_concurrent":  c.APIMaxConcurrent,
+		"shards.count":        c.Shards.Count,
+		"images.upload_limit": c.Images.UploadLimit,
+		"images.preview_size": c.Images.PreviewSize,
+		"grid.columns":        c.Grid.Columns,
+		"grid.gutter":         c.Grid.Gutter,
+		"grid.border":         c.Grid.Border,
+		"grid.corner_radius":  c.Grid.CornerRadius,
+		"grid.label_scale":    c.Grid.LabelScale,
+		"grid.label_margin":   c.Grid.LabelMargin,
+		"logging.max_size":    c.Logging.MaxSize,
+		"logging.max_backups": c.Logging.MaxBackups,
+	}
+	for key, value := range nonNegative {
+		if value < 0 {
+			invalid(key, "cannot be negative, got %d", value)
+		}
+	}
+	durations := map[string]time.Duration{
+		"api_timeouts.request":    c.APITimeouts.Request,
+		"api_timeouts.progress":   c.APITimeouts.Progress,
+		"api_timeouts.options":    c.APITimeouts.Options,
+		"api_timeouts.generation": c.APITimeouts.Generation,
+	}
+	for key, value := range durations {
+		if value < 0 {
+			invalid(key, "cannot be negative, got %s", value)
+		}
+	}
+	if c.APIRetry.Delay < 0 {
+		invalid("api_retry.delay", "cannot be negative, got %s", c.APIRetry.Delay)
+	}
+	if c.APIRetry.MaxDelay < 0 {
+		invalid("api_retry.max_delay", "cannot be negative, got %s", c.APIRetry.MaxDelay)
+	}
+	if c.NovelAIRetry.Attempts < 0 {
+		invalid("novelai_retry.attempts", "cannot be negative, got %d", c.NovelAIRetry.Attempts)
+	}
+	if c.NovelAIRetry.Delay < 0 {
+		invalid("novelai_retry.delay", "cannot be negative, got %s", c.NovelAIRetry.Delay)
+	}
+	if c.NovelAIRetry.MaxDelay < 0 {
+		invalid("novelai_retry.max_delay", "cannot be negative, got %s", c.NovelAIRetry.MaxDelay)
+	}
+	if c.RestoreWindow < 0 {
+		invalid("restore_window", "cannot be negative, got %s", c.RestoreWindow)
+	}
+	if c.Logging.MaxAge < 0 {
+		invalid("logging.max_age", "cannot be negative, got %s", c.Logging.MaxAge)
+	}
+	if c.Grid.AspectRatio < 0 {
+		invalid("grid.aspect_ratio", "cannot be negative, got %g", c.Grid.AspectRatio)
+	}
+	if c.MaxMegapixels < 0 {
+		invalid("max_megapixels", "cannot be negative, got %g", c.MaxMegapixels)
+	}
+	if c.NovelAIMaxMegapixels < 0 {
+		invalid("novelai_max_megapixels", "cannot be negative, got %g", c.NovelAIMaxMegapixels)
+	}
+	if c.NovelAIDailyAnlas < 0 {
+		invalid("novelai_daily_anlas", "cannot be negative, got %d", c.NovelAIDailyAnlas)
+	}
+	if c.NovelAIMonthlyAnlas < 0 {
+		invalid("novelai_monthly_anlas", "cannot be negative, got %d", c.NovelAIMonthlyAnlas)
+	}
+	if _, err := c.ParseModelFamilies(); err != nil {
+		invalid("model_families", "%v", err)
+	}
+
+	oneOf := func(key, value string, allowed ...string) {
+		if value != "" && !slices.Contains(allowed, value) {
+			invalid(key, "%q must be one of %s", value, strings.Join(allowed, ", "))
+		}
+	}
+	oneOf("images.upscale_compare", c.Images.UpscaleCompare, string(composite_renderer.CompareSideBySide), string(composite_renderer.CompareDiagonal), string(composite_renderer.CompareNone))
+	oneOf("gateway.cache", c.Gateway.Cache, "guilds", "all", "none")
+	// formats without an encoder would silently fall back to JPEG
+	oneOf("images.format", c.Images.Format, composite_renderer.FormatNames()...)
+	oneOf("images.renderer", c.Images.Renderer, string(composite_renderer.BackendGo), string(composite_renderer.BackendImageMagick), string(composite_renderer.BackendVips))
+	oneOf("grid.labels", c.Grid.Labels, "index", "seed", "model")
+
+	colors := map[string]string{
+		"grid.background":   c.Grid.Background,
+		"grid.border_color": c.Grid.BorderColor,
+	}
+	for key, value := range colors {
+		if value == "" {
+			continue
+		}
+		if _, err := composite_renderer.ParseHexColor(value); err != nil {
+			invalid(key, "%v, use #rgb, #rrggbb or #rrggbbaa", err)
+		}
+	}
+
+	// report in the order of the keys so the output is stable
+	slices.SortFunc(errs, func(a, b error) int { return strings.Compare(a.Error(), b.Error()) })
+	return errors.Join(errs...)
+}
@@ -0,0 +1,265 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultPath is the config file read when neither -config nor CONFIG_FILE is set. It's optional.
+const DefaultPath = "config.yaml"
+
+// setting is a leaf of Config that can be set from the environment or a flag
+type setting struct {
+	field reflect.Value
+	key   string
+	env   string
+	flag  string
+	usage string
+	// secret settings can be read from the file named by $<env>_FILE and are scrubbed from messages, see Secrets
+	secret bool
+}
+
+// flagValue collects the raw value of a flag, it's applied after the config file and the environment
+type flagValue struct {
+	value  string
+	isBool bool
+}
+
+func (f *flagValue) String() string     { return f.value }
+func (f *flagValue) Set(s string) error { f.value = s; return nil }
+func (f *flagValue) IsBoolFlag() bool   { return f.isBool }
+
+// Load reads the configuration from the config file, the .env file and environment variables, and the command
+// line in args, each overriding the last. The result is validated.
+func Load(name string, args []string) (*Config, error) {
+	return LoadWith(name, args, nil)
+}
+
+// LoadWith is Load with extra flags of a subcommand, defined by register on the same flag set as the settings
+func LoadWith(name string, args []string, register func(*flag.FlagSet)) (*Config, error) {
+	return load(name, args, register, (*Config).Validate)
+}
+
+// LoadDatabase is LoadWith for the subcommands that only open the database, so only the database settings are
+// validated and they run without a bot token or API host
+func LoadDatabase(name string, args []string, register func(*flag.FlagSet)) (*Config, error) {
+	return load(name, args, register, func(c *Config) error { return c.Database.Validate() })
+}
+
+func load(name string, args []string, register func(*flag.FlagSet), validate func(*Config) error) (*Config, error) {
+	cfg := Default()
+	settings := settingsOf(reflect.ValueOf(cfg).Elem(), "")
+
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	configPath := flags.String("config", "", "Path to a YAML config file. Default is "+DefaultPath+" if it exists")
+	values := make(map[string]*flagValue, len(settings))
+	for _, s := range settings {
+		value := &flagValue{isBool: s.field.Kind() == reflect.Bool}
+		values[s.flag] = value
+		env := "$" + s.env
+		if s.secret {
+			env += " or $" + s.env + "_FILE"
+		}
+		flags.Var(value, s.flag, fmt.Sprintf("%s (%s, %s)", s.usage, s.key, env))
+	}
+	if register != nil {
+		register(flags)
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if err := godotenv.Load(); err != nil {
+		log.Printf("Error loading .env file: %v", err)
+	} else {
+		log.Println(".env file loaded successfully")
+	}
+
+	var err error
+	path := *configPath
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	cfg.path, err = readFile(cfg, path)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	for _, s := range settings {
+		env, source, err := s.lookupEnv()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if env != "" {
+			if err := s.set(env); err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid %s %q: %w", s.key, source, env, err))
+			}
+		}
+	}
+	flags.Visit(func(f *flag.Flag) {
+		for _, s := range settings {
+			if s.flag == f.Name {
+				if err := s.set(values[f.Name].value); err != nil {
+					errs = append(errs, fmt.Errorf("%s: invalid -%s %q: %w", s.key, s.flag, values[f.Name].value, err))
+				}
+			}
+		}
+	})
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	cfg.APIHost = strings.TrimSuffix(cfg.APIHost, "/")
+
+	if err := validate(cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// readFile decodes the YAML file at path into cfg and returns the path it read. An empty path reads DefaultPath
+// if it exists. Unknown keys are an error so typos don't silently fall back to defaults.
+func readFile(cfg *Config, path string) (string, error) {
+	explicit := path != ""
+	if !explicit {
+		path = DefaultPath
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !explicit && errors.Is(err, fs.ErrNotExist) {
+			return "", nil
+		}
+		return "", fmt.Errorf("error reading config file: %w", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+	log.Printf("Config file %s loaded successfully", path)
+	return path, nil
+}
+
+// settingsOf walks the struct v for fields tagged with env and flag, prefixing their keys with the parent's yaml key
+func settingsOf(v reflect.Value, prefix string) []setting {
+	var settings []setting
+	for i := range v.NumField() {
+		field := v.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		key := prefix + field.Tag.Get("yaml")
+		if field.Type.Kind() == reflect.Struct && field.Type != reflect.TypeFor[time.Duration]() {
+			settings = append(settings, settingsOf(v.Field(i), key+".")...)
+			continue
+		}
+		settings = append(settings, setting{
+			field:  v.Field(i),
+			key:    key,
+			env:    field.Tag.Get("env"),
+			flag:   field.Tag.Get("flag"),
+			usage:  field.Tag.Get("usage"),
+			secret: field.Tag.Get("secret") == "true",
+		})
+	}
+	return settings
+}
+
+// lookupEnv returns the value of the environment variable of the setting and where it was read from. A secret
+// setting without its variable is read from the file named by $<env>_FILE instead, e.g.
+// BOT_TOKEN_FILE=/run/secrets/bot_token, the variable itself wins if both are set.
+func (s setting) lookupEnv() (value, source string, err error) {
+	if value := os.Getenv(s.env); value != "" {
+		if s.secret && os.Getenv(s.env+"_FILE") != "" {
+			log.Printf("Both $%s and $%s_FILE are set, using $%s", s.env, s.env, s.env)
+		}
+		return value, "$" + s.env, nil
+	}
+	if !s.secret {
+		return "", "", nil
+	}
+
+	path := os.Getenv(s.env + "_FILE")
+	if path == "" {
+		return "", "", nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: error reading $%s_FILE: %w", s.key, s.env, err)
+	}
+	return strings.TrimSpace(string(data)), "$" + s.env + "_FILE", nil
+}
+
+// Secrets returns the value of every secret setting that is set, like the bot token, so they can be scrubbed from
+// messages. The password of api_auth is included on its own as it can show up without the user.
+func (c *Config) Secrets() []string {
+	var secrets []string
+	for _, s := range settingsOf(reflect.ValueOf(c).Elem(), "") {
+		if s.secret && s.field.String() != "" {
+			secrets = append(secrets, s.field.String())
+		}
+	}
+	if _, password, ok := strings.Cut(c.APIAuth, ":"); ok && password != "" {
+		secrets = append(secrets, password)
+	}
+	if header, err := c.ParseAPIHeaders(); err == nil {
+		for name, values := range header {
+			if name != "User-Agent" {
+				secrets = append(secrets, values...)
+			}
+		}
+	}
+	return secrets
+}
+
+// set parses s into the field according to its type
+func (s setting) set(value string) error {
+	switch {
+	case s.field.Type() == reflect.TypeFor[time.Duration]():
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		s.field.SetInt(int64(d))
+	case s.field.Kind() == reflect.String:
+		s.field.SetString(value)
+	case s.field.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		s.field.SetBool(b)
+	case s.field.Kind() == reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		s.field.SetInt(int64(n))
+	case s.field.Kind() == reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		s.field.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported setting type %s", s.field.Type())
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"context"
+	"log"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+// WatchInterval is how often Watch checks the config file for changes
+const WatchInterval = 5 * time.Second
+
+// Watch reloads the configuration whenever the config file that current was loaded from changes, and passes it to
+// apply. Invalid configurations are logged and skipped so the bot keeps running with the last good one. Settings
+// that are only read at startup, like the bot token and database, are logged as needing a restart.
+// It returns when ctx is done, or right away if current wasn't loaded from a file.
+func Watch(ctx context.Context, current *Config, name string, args []string, apply func(*Config) error) {
+	if current.path == "" {
+		return
+	}
+
+	last, err := os.Stat(current.path)
+	if err != nil {
+		log.Printf("Not watching config file %s: %v", current.path, err)
+		return
+	}
+	log.Printf("Watching config file %s for changes", current.path)
+	startup := current
+
+	ticker := time.NewTicker(WatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(current.path)
+		if err != nil || (info.ModTime().Equal(last.ModTime()) && info.Size() == last.Size()) {
+			continue
+		}
+		last = info
+
+		next, err := Load(name, args)
+		if err != nil {
+			log.Printf("Not reloading config file %s, keeping the current settings:\n%v", current.path, err)
+			continue
+		}
+		if changed := startup.restartRequired(next); len(changed) > 0 {
+			log.Printf("Restart the bot to apply changes to %s", strings.Join(changed, ", "))
+		}
+		if err := apply(next); err != nil {
+			log.Printf("Error applying config file %s: %v", current.path, err)
+			continue
+		}
+		log.Printf("Reloaded config file %s", current.path)
+	}
+}
+
+// Changes returns the keys of every setting that differs in next, in the order they're declared
+func (c *Config) Changes(next *Config) []string {
+	before := settingsOf(reflect.ValueOf(c).Elem(), "")
+	after := settingsOf(reflect.ValueOf(next).Elem(), "")
+
+	var changed []string
+	for i := range before {
+		if !reflect.DeepEqual(before[i].field.Interface(), after[i].field.Interface()) {
+			changed = append(changed, before[i].key)
+		}
+	}
+	return changed
+}
+
+// restartRequired returns the keys of the settings only read at startup that differ in next
+func (c *Config) restartRequired(next *Config) []string {
+	var changed []string
+	for key, differs := range map[string]bool{
+		"bot_token":              c.BotToken != next.BotToken,
+		"guild_id":               c.GuildID != next.GuildID,
+		"owner_id":               c.OwnerID != next.OwnerID,
+		"imagine_command":        c.ImagineCommand != next.ImagineCommand,
+		"remove_commands":        c.RemoveCommands != next.RemoveCommands,
+		"health_addr":            c.HealthAddr != next.HealthAddr,
+		"pprof_addr":             c.PprofAddr != next.PprofAddr,
+		"api_hosts":              c.APIHosts != next.APIHosts,
+		"api_auth":               c.APIAuth != next.APIAuth,
+		"api_proxy":              c.APIProxy != next.APIProxy,
+		"api_headers":            c.APIHeaders != next.APIHeaders,
+		"user_agent":             c.UserAgent != next.UserAgent,
+		"novelai_proxy":          c.NovelAIProxy != next.NovelAIProxy,
+		"llm_host":               c.LLMHost != next.LLMHost,
+		"novelai_token":          c.NovelAIToken != next.NovelAIToken,
+		"novelai_max_megapixels": c.NovelAIMaxMegapixels != next.NovelAIMaxMegapixels,
+		"novelai_daily_anlas":    c.NovelAIDailyAnlas != next.NovelAIDailyAnlas,
+		"novelai_monthly_anlas":  c.NovelAIMonthlyAnlas != next.NovelAIMonthlyAnlas,
+		"api_retry":              c.APIRetry != next.APIRetry,
+		"api_timeouts":           c.APITimeouts != next.APITimeouts,
+		"novelai_retry":          c.NovelAIRetry != next.NovelAIRetry,
+		"api_max_concurrent":     c.APIMaxConcurrent != next.APIMaxConcurrent,
+		"database":               c.Database != next.Database,
+		"logging":                c.Logging != next.Logging,
+		"shards":                 c.Shards != next.Shards,
+		"gateway":                c.Gateway != next.Gateway,
+		"admin":                  c.Admin != next.Admin,
+		"reporting":              c.Reporting != next.Reporting,
+	} {
+		if differs {
+			changed = append(changed, key)
+		}
+	}
+	slices.Sort(changed)
+	return changed
+}
@@ -0,0 +1,6 @@
+//go:build sqlite_cgo
+
+package sqlite
+
+// The cgo driver is only linked into binaries built with -tags sqlite_cgo, so the default build needs no C toolchain.
+import _ "github.com/mattn/go-sqlite3"
@@ -3,10 +3,13 @@ package sqlite
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"log"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	_ "modernc.org/sqlite"
 )
@@ -106,6 +109,229 @@ const addHypernetworkQuery string = `
 ALTER TABLE image_generations ADD COLUMN hypernetwork TEXT;
 `
 
+const createFailedGenerationsTableIfNotExistsQuery string = `
+CREATE TABLE IF NOT EXISTS failed_generations (
+id INTEGER NOT NULL PRIMARY KEY,
+interaction_id TEXT NOT NULL,
+member_id TEXT NOT NULL,
+backend TEXT NOT NULL,
+request TEXT NOT NULL,
+error TEXT NOT NULL,
+created_at DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS failed_generations_created_index
+ON failed_generations(created_at);
+`
+
+const addFailedGenerationLogColumnQuery string = `
+ALTER TABLE failed_generations ADD COLUMN log TEXT NOT NULL DEFAULT '';
+`
+
+const addGuildChannelColumnsQuery string = `
+ALTER TABLE image_generations ADD COLUMN guild_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE image_generations ADD COLUMN channel_id TEXT NOT NULL DEFAULT '';
+`
+
+const addProvenanceColumnsQuery string = `
+ALTER TABLE image_generations ADD COLUMN checkpoint_hash TEXT;
+ALTER TABLE image_generations ADD COLUMN checkpoint_sha256 TEXT;
+ALTER TABLE image_generations ADD COLUMN vae_hash TEXT;
+ALTER TABLE image_generations ADD COLUMN extra_networks TEXT NOT NULL DEFAULT '[]';
+`
+
+const createMemberIndexIfNotExistsQuery string = `
+CREATE INDEX IF NOT EXISTS generation_member_index
+ON image_generations(member_id, created_at);
+`
+
+const createUsageTableIfNotExistsQuery string = `
+CREATE TABLE IF NOT EXISTS usage (
+member_id TEXT NOT NULL,
+day TEXT NOT NULL,
+backend TEXT NOT NULL,
+images INTEGER NOT NULL DEFAULT 0,
+megapixels REAL NOT NULL DEFAULT 0,
+gpu_seconds REAL NOT NULL DEFAULT 0,
+anlas INTEGER NOT NULL DEFAULT 0,
+PRIMARY KEY (member_id, day, backend)
+);`
+
+const addRawColumnsQuery string = `
+ALTER TABLE image_generations ADD COLUMN raw_request TEXT;
+ALTER TABLE image_generations ADD COLUMN raw_info TEXT;
+`
+
+const createDeletedMessagesTableIfNotExistsQuery string = `
+ALTER TABLE image_generations ADD COLUMN deleted_at DATETIME;
+CREATE TABLE IF NOT EXISTS deleted_messages (
+message_id TEXT NOT NULL PRIMARY KEY,
+guild_id TEXT NOT NULL,
+channel_id TEXT NOT NULL,
+member_id TEXT NOT NULL,
+deleted_by TEXT NOT NULL,
+content TEXT NOT NULL,
+embeds TEXT NOT NULL,
+deleted_at DATETIME NOT NULL
+);
+CREATE TABLE IF NOT EXISTS deleted_message_files (
+id INTEGER NOT NULL PRIMARY KEY,
+message_id TEXT NOT NULL,
+name TEXT NOT NULL,
+content_type TEXT NOT NULL,
+data BLOB NOT NULL
+);
+CREATE INDEX IF NOT EXISTS deleted_message_files_message_index
+ON deleted_message_files(message_id);
+`
+
+const addParentColumnsQuery string = `
+ALTER TABLE image_generations ADD COLUMN parent_id INTEGER;
+ALTER TABLE image_generations ADD COLUMN upscaler TEXT;
+ALTER TABLE image_generations ADD COLUMN upscale_factor REAL;
+CREATE INDEX IF NOT EXISTS generation_parent_index
+ON image_generations(parent_id);
+`
+
+// createDailyStatsTableIfNotExistsQuery backfills the rollup from existing generations.
+// Only rows that represent an image are counted: sub-generations and upscales, not the sort order 0 parent.
+const createDailyStatsTableIfNotExistsQuery string = `
+CREATE TABLE IF NOT EXISTS daily_stats (
+day TEXT NOT NULL,
+guild_id TEXT NOT NULL,
+member_id TEXT NOT NULL,
+checkpoint TEXT NOT NULL,
+images INTEGER NOT NULL DEFAULT 0,
+PRIMARY KEY (day, guild_id, member_id, checkpoint)
+);
+CREATE INDEX IF NOT EXISTS daily_stats_guild_index
+ON daily_stats(guild_id, day);
+INSERT INTO daily_stats (day, guild_id, member_id, checkpoint, images)
+SELECT ` + utcDay + `, guild_id, member_id, COALESCE(checkpoint, ''), COUNT(*) FROM image_generations
+WHERE sort_order > 0 OR parent_id IS NOT NULL
+GROUP BY 1, guild_id, member_id, COALESCE(checkpoint, '');
+`
+
+// utcDay is the UTC day of created_at, the day new generations are counted under. The times are stored with their
+// offset, either as "2006-01-02 15:04:05.999999999 -0700 MST", which date doesn't parse, or as RFC 3339.
+const utcDay string = `COALESCE(date(created_at), date(substr(created_at, 1, 19), printf('%+d minutes',
+(CASE substr(created_at, instr(substr(created_at, 20), ' ') + 20, 1) WHEN '-' THEN 1 ELSE -1 END) *
+(CAST(substr(created_at, instr(substr(created_at, 20), ' ') + 21, 2) AS INTEGER) * 60 +
+CAST(substr(created_at, instr(substr(created_at, 20), ' ') + 23, 2) AS INTEGER)))))`
+
+const createSeedBookmarksTableIfNotExistsQuery string = `
+CREATE TABLE IF NOT EXISTS seed_bookmarks (
+member_id TEXT NOT NULL,
+name TEXT NOT NULL,
+seed INTEGER NOT NULL,
+created_at DATETIME NOT NULL,
+PRIMARY KEY (member_id, name)
+);`
+
+const createMemberLorasTableIfNotExistsQuery string = `
+CREATE TABLE IF NOT EXISTS member_loras (
+member_id TEXT NOT NULL,
+name TEXT NOT NULL,
+weight REAL NOT NULL DEFAULT 1,
+uses INTEGER NOT NULL DEFAULT 0,
+pinned BOOLEAN NOT NULL DEFAULT FALSE,
+last_used_at DATETIME NOT NULL,
+PRIMARY KEY (member_id, name)
+);`
+
+const createGuildWatermarksTableIfNotExistsQuery string = `
+CREATE TABLE IF NOT EXISTS guild_watermarks (
+guild_id TEXT NOT NULL PRIMARY KEY,
+text TEXT NOT NULL DEFAULT '',
+image BLOB,
+corner TEXT NOT NULL,
+opacity REAL NOT NULL,
+updated_at DATETIME NOT NULL
+);`
+
+const createPrivacySettingsTableIfNotExistsQuery string = `
+CREATE TABLE IF NOT EXISTS privacy_settings (
+scope TEXT NOT NULL,
+scope_id TEXT NOT NULL,
+strip_metadata BOOLEAN NOT NULL DEFAULT FALSE,
+updated_at DATETIME NOT NULL,
+PRIMARY KEY (scope, scope_id)
+);`
+
+const createLayoutSettingsTableIfNotExistsQuery string = `
+CREATE TABLE IF NOT EXISTS layout_settings (
+scope TEXT NOT NULL,
+scope_id TEXT NOT NULL,
+individual BOOLEAN NOT NULL DEFAULT FALSE,
+updated_at DATETIME NOT NULL,
+PRIMARY KEY (scope, scope_id)
+);`
+
+const createGuildQuietHoursTableIfNotExistsQuery string = `
+CREATE TABLE IF NOT EXISTS guild_quiet_hours (
+guild_id TEXT NOT NULL PRIMARY KEY,
+start_minute INTEGER NOT NULL,
+end_minute INTEGER NOT NULL,
+timezone TEXT NOT NULL,
+mode TEXT NOT NULL,
+updated_at DATETIME NOT NULL
+);`
+
+const addNegativeEmbeddingsColumnQuery string = `
+ALTER TABLE default_settings ADD COLUMN negative_embeddings TEXT NOT NULL DEFAULT '';
+`
+
+// addGenerationSchemaVersionColumnQuery marks existing rows as version 0, the shape before records were versioned
+const addGenerationSchemaVersionColumnQuery string = `
+ALTER TABLE image_generations ADD COLUMN schema_version INTEGER NOT NULL DEFAULT 0;
+`
+
+// addGenerationBackendColumnsQuery marks existing rows as Stable Diffusion, the only backend recorded before
+const addGenerationBackendColumnsQuery string = `
+ALTER TABLE image_generations ADD COLUMN backend TEXT NOT NULL DEFAULT 'stable_diffusion';
+ALTER TABLE image_generations ADD COLUMN anlas INTEGER;
+`
+
+const createPromptSnippetsTableIfNotExistsQuery string = `
+CREATE TABLE IF NOT EXISTS prompt_snippets (
+guild_id TEXT NOT NULL,
+name TEXT NOT NULL,
+text TEXT NOT NULL,
+updated_at DATETIME NOT NULL,
+PRIMARY KEY (guild_id, name)
+);`
+
+const createChannelDefaultsTableIfNotExistsQuery string = `
+CREATE TABLE IF NOT EXISTS channel_defaults (
+channel_id TEXT NOT NULL PRIMARY KEY,
+guild_id TEXT NOT NULL,
+checkpoint TEXT NOT NULL DEFAULT '',
+vae TEXT NOT NULL DEFAULT '',
+style TEXT NOT NULL DEFAULT '',
+updated_at DATETIME NOT NULL
+);`
+
+const createRefineStepsTableIfNotExistsQuery string = `
+CREATE TABLE IF NOT EXISTS refine_steps (
+message_id TEXT NOT NULL PRIMARY KEY,
+guild_id TEXT NOT NULL DEFAULT '',
+channel_id TEXT NOT NULL DEFAULT '',
+parent_message_id TEXT NOT NULL,
+parent_sort_order INTEGER NOT NULL DEFAULT 0,
+root_message_id TEXT NOT NULL,
+step INTEGER NOT NULL,
+denoising_strength REAL NOT NULL,
+created_at DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS refine_steps_root_index
+ON refine_steps(root_message_id);
+`
+
+const addFailedGenerationGuildColumnQuery string = `
+ALTER TABLE failed_generations ADD COLUMN guild_id TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS failed_generations_guild_index
+ON failed_generations(guild_id, created_at);
+`
+
 type migration struct {
 	migrationName  string
 	migrationQuery string
@@ -126,24 +352,113 @@ var migrations = []migration{
 	{migrationName: "add checkpoint column", migrationQuery: addCheckpointQuery},
 	{migrationName: "add vae column", migrationQuery: addVAEQuery},
 	{migrationName: "add hypernetwork column", migrationQuery: addHypernetworkQuery},
+	{migrationName: "create failed generations table", migrationQuery: createFailedGenerationsTableIfNotExistsQuery},
+	{migrationName: "add guild and channel columns", migrationQuery: addGuildChannelColumnsQuery},
+	{migrationName: "add model provenance columns", migrationQuery: addProvenanceColumnsQuery},
+	{migrationName: "add generation member index", migrationQuery: createMemberIndexIfNotExistsQuery},
+	{migrationName: "create usage table", migrationQuery: createUsageTableIfNotExistsQuery},
+	{migrationName: "add raw request columns", migrationQuery: addRawColumnsQuery},
+	{migrationName: "create deleted messages table", migrationQuery: createDeletedMessagesTableIfNotExistsQuery},
+	{migrationName: "add generation parent columns", migrationQuery: addParentColumnsQuery},
+	{migrationName: "create daily stats table", migrationQuery: createDailyStatsTableIfNotExistsQuery},
+	{migrationName: "create seed bookmarks table", migrationQuery: createSeedBookmarksTableIfNotExistsQuery},
+	{migrationName: "create member loras table", migrationQuery: createMemberLorasTableIfNotExistsQuery},
+	{migrationName: "create guild watermarks table", migrationQuery: createGuildWatermarksTableIfNotExistsQuery},
+	{migrationName: "create privacy settings table", migrationQuery: createPrivacySettingsTableIfNotExistsQuery},
+	{migrationName: "create layout settings table", migrationQuery: createLayoutSettingsTableIfNotExistsQuery},
+	{migrationName: "add failed generation log column", migrationQuery: addFailedGenerationLogColumnQuery},
+	{migrationName: "create guild quiet hours table", migrationQuery: createGuildQuietHoursTableIfNotExistsQuery},
+	{migrationName: "add negative embeddings column", migrationQuery: addNegativeEmbeddingsColumnQuery},
+	{migrationName: "add generation schema version column", migrationQuery: addGenerationSchemaVersionColumnQuery},
+	{migrationName: "add generation backend columns", migrationQuery: addGenerationBackendColumnsQuery},
+	{migrationName: "create prompt snippets table", migrationQuery: createPromptSnippetsTableIfNotExistsQuery},
+	{migrationName: "create channel defaults table", migrationQuery: createChannelDefaultsTableIfNotExistsQuery},
+	{migrationName: "create refine steps table", migrationQuery: createRefineStepsTableIfNotExistsQuery},
+	{migrationName: "add failed generation guild column", migrationQuery: addFailedGenerationGuildColumnQuery},
 }
 
-func New(ctx context.Context) (*sql.DB, error) {
-	filename, err := DBFilename()
-	if err != nil {
-		return nil, err
+type Config struct {
+	// Path to the database file. Default is sd_discord_bot.sqlite in the working directory.
+	// Use MemoryPath for an ephemeral database that is discarded on exit
+	Path string
+	// Driver is the database/sql driver name. Default is the pure-Go "sqlite" driver.
+	// The cgo "sqlite3" driver is linked into binaries built with -tags sqlite_cgo, otherwise New falls back to the default
+	Driver string
+	// BusyTimeout is how long a connection waits for a lock before returning "database is locked". Default is 5s
+	BusyTimeout time.Duration
+	// MaxOpenConns limits the connection pool. Default is 4
+	MaxOpenConns int
+	// MaxIdleConns defaults to MaxOpenConns
+	MaxIdleConns int
+	// SkipMigrations opens the database as is, see Version to check whether it's up to date
+	SkipMigrations bool
+}
+
+const (
+	defaultBusyTimeout  = 5 * time.Second
+	defaultMaxOpenConns = 4
+	defaultDriver       = "sqlite"
+	cgoDriver           = "sqlite3"
+
+	MemoryPath = ":memory:"
+)
+
+func New(ctx context.Context, cfg Config) (*sql.DB, error) {
+	filename := cfg.Path
+	if filename == "" {
+		var err error
+		filename, err = DBFilename()
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	err = touchDBFile(filename)
-	if err != nil {
-		return nil, err
+	if filename == MemoryPath {
+		// every connection would otherwise open its own empty database
+		cfg.MaxOpenConns = 1
+		cfg.MaxIdleConns = 1
+	} else {
+		err := touchDBFile(filename)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.Driver == "" {
+		cfg.Driver = defaultDriver
+	}
+	if !slices.Contains(sql.Drivers(), cfg.Driver) {
+		log.Printf("SQLite driver %q is not available, falling back to %q", cfg.Driver, defaultDriver)
+		cfg.Driver = defaultDriver
+	}
+
+	if cfg.BusyTimeout <= 0 {
+		cfg.BusyTimeout = defaultBusyTimeout
+	}
+	if cfg.MaxOpenConns <= 0 {
+		cfg.MaxOpenConns = defaultMaxOpenConns
+	}
+	if cfg.MaxIdleConns <= 0 {
+		cfg.MaxIdleConns = cfg.MaxOpenConns
 	}
 
-	db, err := sql.Open("sqlite", filename)
+	db, err := sql.Open(cfg.Driver, dsn(filename, cfg))
 	if err != nil {
 		return nil, err
 	}
 
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	if filename == MemoryPath {
+		// closing the only connection discards the database
+		db.SetConnMaxLifetime(0)
+		db.SetConnMaxIdleTime(0)
+	}
+
+	if cfg.SkipMigrations {
+		return db, nil
+	}
+
 	err = migrate(ctx, db)
 	if err != nil {
 		return nil, err
@@ -152,6 +467,24 @@ func New(ctx context.Context) (*sql.DB, error) {
 	return db, nil
 }
 
+// Version returns the migration the database is at and the one the bot requires
+func Version(ctx context.Context, db *sql.DB) (current, required int, err error) {
+	err = db.QueryRowContext(ctx, getCurrentMigration).Scan(&current)
+	return current, len(migrations), err
+}
+
+// dsn applies the pragmas to every connection in the pool.
+// WAL lets readers proceed while a write is in progress, and busy_timeout waits for the lock instead of failing.
+// The cgo driver spells the same options differently.
+func dsn(filename string, cfg Config) string {
+	if cfg.Driver == cgoDriver {
+		return fmt.Sprintf("file:%s?_journal_mode=WAL&_busy_timeout=%d&_synchronous=NORMAL&_txlock=immediate",
+			filename, cfg.BusyTimeout.Milliseconds())
+	}
+	return fmt.Sprintf("file:%s?_pragma=journal_mode(WAL)&_pragma=busy_timeout(%d)&_pragma=synchronous(NORMAL)&_txlock=immediate",
+		filename, cfg.BusyTimeout.Milliseconds())
+}
+
 func migrate(ctx context.Context, db *sql.DB) error {
 	var currentMigration int
 
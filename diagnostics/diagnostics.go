@@ -0,0 +1,99 @@
+package diagnostics
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	rpprof "runtime/pprof"
+	"time"
+)
+
+// Serve serves the net/http/pprof profiles under /debug/pprof/ on addr until ctx is done. The profiles expose the
+// internals of the process, keep addr on a private interface like 127.0.0.1:6060.
+func Serve(ctx context.Context, addr string) error {
+	if addr == "" {
+		return errors.New("missing pprof address")
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	// no write timeout, CPU profiles and traces stream for as long as they're asked to
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdown)
+	}()
+
+	log.Printf("Serving pprof on %s", addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Goroutines returns the number of goroutines and their stacks, with identical stacks grouped and counted
+func Goroutines() (int, []byte, error) {
+	var dump bytes.Buffer
+	if err := rpprof.Lookup("goroutine").WriteTo(&dump, 1); err != nil {
+		return 0, nil, err
+	}
+	return runtime.NumGoroutine(), dump.Bytes(), nil
+}
+
+// HeapSummary describes the memory held by the process, like the numbers of runtime.MemStats that grow with a leak
+func HeapSummary() string {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+
+	var lastGC string
+	if stats.LastGC > 0 {
+		lastGC = time.Since(time.Unix(0, int64(stats.LastGC))).Round(time.Second).String() + " ago"
+	} else {
+		lastGC = "never"
+	}
+
+	return fmt.Sprintf("Heap in use: %s of %s allocated from the OS\n"+
+		"Live objects: %d\n"+
+		"Total allocated: %s\n"+
+		"Stacks: %s\n"+
+		"Garbage collections: %d, last %s, paused %s in total",
+		bytesString(stats.HeapInuse), bytesString(stats.HeapSys),
+		stats.HeapObjects,
+		bytesString(stats.TotalAlloc),
+		bytesString(stats.StackInuse),
+		stats.NumGC, lastGC, time.Duration(stats.PauseTotalNs).Round(time.Microsecond))
+}
+
+// HeapProfile returns the heap profile, to be read with go tool pprof
+func HeapProfile() ([]byte, error) {
+	var profile bytes.Buffer
+	if err := rpprof.Lookup("heap").WriteTo(&profile, 0); err != nil {
+		return nil, err
+	}
+	return profile.Bytes(), nil
+}
+
+func bytesString(n uint64) string {
+	const unit = 1 << 10
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,148 @@
+package discord_bot
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// commandSpec is the part of a command the bot sets. Registered commands carry defaults and IDs filled in by
+// Discord, so both sides are reduced to this before comparing.
+type commandSpec struct {
+	Type                     discordgo.ApplicationCommandType `json:"type,omitempty"`
+	Name                     string                           `json:"name"`
+	Description              string                           `json:"description,omitempty"`
+	DefaultMemberPermissions *int64                           `json:"default_member_permissions,string,omitempty"`
+	NSFW                     bool                             `json:"nsfw,omitempty"`
+	Options                  []optionSpec                     `json:"options,omitempty"`
+}
+
+type optionSpec struct {
+	Type         discordgo.ApplicationCommandOptionType `json:"type"`
+	Name         string                                 `json:"name"`
+	Description  string                                 `json:"description,omitempty"`
+	ChannelTypes []discordgo.ChannelType                `json:"channel_types,omitempty"`
+	Required     bool                                   `json:"required,omitempty"`
+	Options      []optionSpec                           `json:"options,omitempty"`
+	Autocomplete bool                                   `json:"autocomplete,omitempty"`
+	Choices      []choiceSpec                           `json:"choices,omitempty"`
+	MinValue     *float64                               `json:"min_value,omitempty"`
+	MaxValue     float64                                `json:"max_value,omitempty"`
+	MinLength    *int                                   `json:"min_length,omitempty"`
+	MaxLength    int                                    `json:"max_length,omitempty"`
+}
+
+type choiceSpec struct {
+	Name  string `json:"name"`
+	Value any    `json:"value"`
+}
+
+// specOf reduces command to the fields the bot sets, as JSON so numbers and empty lists compare the same
+func specOf(command *discordgo.ApplicationCommand) ([]byte, error) {
+	raw, err := json.Marshal(command)
+	if err != nil {
+		return nil, err
+	}
+	var spec commandSpec
+	if err := json.Unmarshal(raw, &spec); err != nil {
+		return nil, err
+	}
+	if spec.Type == 0 {
+		spec.Type = discordgo.ChatApplicationCommand
+	}
+	return json.Marshal(spec)
+}
+
+// sameCommand reports whether the registered command already matches the desired one
+func sameCommand(desired, registered *discordgo.ApplicationCommand) bool {
+	a, err := specOf(desired)
+	if err != nil {
+		return false
+	}
+	b, err := specOf(registered)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(a, b)
+}
+
+// commandKey identifies a registered command. A chat command and a message or user command may share a name, so
+// the type is part of the key.
+type commandKey struct {
+	Type discordgo.ApplicationCommandType
+	Name string
+}
+
+func keyOf(command *discordgo.ApplicationCommand) commandKey {
+	key := commandKey{command.Type, command.Name}
+	if key.Type == 0 {
+		key.Type = discordgo.ChatApplicationCommand
+	}
+	return key
+}
+
+// syncCommands makes the registered commands of the application match desired: new commands are created, changed
+// ones edited and ones the bot no longer has deleted. Unchanged commands aren't sent at all, so restarts don't use
+// up the daily command creation limit.
+func (b *botImpl) syncCommands(appID string, desired []*discordgo.ApplicationCommand) error {
+	registered, err := b.botSession.ApplicationCommands(appID, b.config.GuildID)
+	if err != nil {
+		return fmt.Errorf("error listing registered commands: %w", err)
+	}
+
+	existing := make(map[commandKey]*discordgo.ApplicationCommand, len(registered))
+	for _, command := range registered {
+		existing[keyOf(command)] = command
+	}
+
+	var created, updated, unchanged, deleted []string
+	for _, command := range desired {
+		current, ok := existing[keyOf(command)]
+		delete(existing, keyOf(command))
+
+		switch {
+		case !ok:
+			cmd, err := b.botSession.ApplicationCommandCreate(appID, b.config.GuildID, command)
+			if err != nil {
+				return fmt.Errorf("cannot create '%s' command: %w", command.Name, err)
+			}
+			b.registeredCommands[command.Name] = cmd
+			created = append(created, command.Name)
+		case !sameCommand(command, current):
+			cmd, err := b.botSession.ApplicationCommandEdit(appID, b.config.GuildID, current.ID, command)
+			if err != nil {
+				return fmt.Errorf("cannot update '%s' command: %w", command.Name, err)
+			}
+			b.registeredCommands[command.Name] = cmd
+			updated = append(updated, command.Name)
+		default:
+			b.registeredCommands[command.Name] = current
+			unchanged = append(unchanged, command.Name)
+		}
+	}
+
+	// commands that were renamed or removed would otherwise linger in the command list
+	for key, command := range existing {
+		if err := b.botSession.ApplicationCommandDelete(appID, b.config.GuildID, command.ID); err != nil {
+			return fmt.Errorf("cannot delete stale '%s' command: %w", key.Name, err)
+		}
+		deleted = append(deleted, key.Name)
+	}
+
+	log.Printf("Commands: %d created, %d updated, %d deleted, %d unchanged", len(created), len(updated), len(deleted), len(unchanged))
+	for _, changed := range []struct {
+		action string
+		names  []string
+	}{{"Created", created}, {"Updated", updated}, {"Deleted", deleted}} {
+		if len(changed.names) > 0 {
+			slices.Sort(changed.names)
+			log.Printf("%s /%s", changed.action, strings.Join(changed.names, ", /"))
+		}
+	}
+	return nil
+}
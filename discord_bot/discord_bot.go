@@ -11,11 +11,13 @@ import (
 	"sync"
 	"time"
 
+	"stable_diffusion_bot/audit"
 	"stable_diffusion_bot/discord_bot/handlers"
 	"stable_diffusion_bot/queue"
 	"stable_diffusion_bot/queue/llm"
 	"stable_diffusion_bot/queue/novelai"
 	"stable_diffusion_bot/queue/stable_diffusion"
+	"stable_diffusion_bot/reporting"
 	"stable_diffusion_bot/utils"
 
 	"github.com/bwmarrin/discordgo"
@@ -23,6 +25,10 @@ import (
 
 type botImpl struct {
 	botSession *discordgo.Session
+	sessions   []*discordgo.Session // one per shard run by this process, starting with botSession
+
+	mu        sync.Mutex
+	connected map[int]bool // by shard ID
 
 	registeredCommands map[handlers.Command]*discordgo.ApplicationCommand
 	config             *Config
@@ -36,10 +42,23 @@ type botImpl struct {
 type Config struct {
 	BotToken       string
 	GuildID        string
+	OwnerID        string
 	ImagineQueue   queue.Queue[*stable_diffusion.SDQueueItem]
 	NovelAIQueue   queue.Queue[*novelai.NAIQueueItem]
 	LLMQueue       queue.Queue[*llm.LLMItem]
 	RemoveCommands bool
+
+	// ShardCount is the total number of shards, or the number Discord recommends with ShardAuto. Default is a
+	// single connection
+	ShardCount int
+	ShardAuto  bool
+	// ShardIDs are the shards run by this process. Default runs every shard
+	ShardIDs []int
+
+	// Intents requested from the gateway. Default is none, which still receives interactions
+	Intents discordgo.Intent
+	// Cache is what each session keeps in memory. Default is CacheGuilds
+	Cache CacheMode
 }
 
 func New(cfg *Config) (Bot, error) {
@@ -47,7 +66,8 @@ func New(cfg *Config) (Bot, error) {
 		return nil, errors.New("missing bot token")
 	}
 
-	handlers.Token = &cfg.BotToken
+	handlers.AddSecrets(cfg.BotToken)
+	handlers.OwnerID = cfg.OwnerID
 
 	if cfg.GuildID == "" {
 		// return nil, errors.New("missing guild ID")
@@ -72,12 +92,15 @@ func New(cfg *Config) (Bot, error) {
 
 	bot := &botImpl{
 		botSession:         botSession,
+		connected:          make(map[int]bool),
 		registeredCommands: make(map[handlers.Command]*discordgo.ApplicationCommand),
 		config:             cfg,
 		queues:             queues,
 		handlers:           make(queue.CommandHandlers),
 		components:         handlers.ComponentHandlers,
 	}
+	bot.configureSession(botSession)
+	bot.logGateway()
 
 	return bot, nil
 }
@@ -96,7 +119,9 @@ func (b *botImpl) registerHandlers() {
 		maps.Copy(b.components, q.Components())
 	}
 
-	b.botSession.AddHandler(func(session *discordgo.Session, i *discordgo.InteractionCreate) {
+	b.addHandler(func(session *discordgo.Session, i *discordgo.InteractionCreate) {
+		defer reporting.Repanic(map[string]string{"goroutine": "interaction", "guild_id": i.GuildID})
+
 		var handler queue.Handler
 		var ok bool
 		if i.Type == discordgo.InteractionMessageComponent {
@@ -109,7 +134,11 @@ func (b *botImpl) registerHandlers() {
 				return
 			}
 
-			handler, ok = handles[i.ApplicationCommandData().Name]
+			if i.Type == discordgo.InteractionModalSubmit {
+				handler, ok = handles[i.ModalSubmitData().CustomID]
+			} else {
+				handler, ok = handles[i.ApplicationCommandData().Name]
+			}
 		}
 
 		if !ok || handler == nil {
@@ -157,41 +186,102 @@ func (b *botImpl) registerHandlers() {
 	})
 }
 
+// applicationID returns the ID commands are registered under, which is the ID of the bot user. It's looked up over
+// REST when the gateway isn't open.
+func (b *botImpl) applicationID() (string, error) {
+	if b.botSession.State.User != nil {
+		return b.botSession.State.User.ID, nil
+	}
+	user, err := b.botSession.User("@me")
+	if err != nil {
+		return "", fmt.Errorf("error getting the bot user: %w", err)
+	}
+	return user.ID, nil
+}
+
+// RegisterCommands registers the commands of every queue without connecting to the gateway, only sending the ones
+// that changed
+func (b *botImpl) RegisterCommands() error {
+	return b.registerCommands()
+}
+
+// DeregisterCommands deletes every command registered by the application in the guild, or globally without one,
+// including commands the bot no longer has
+func (b *botImpl) DeregisterCommands() error {
+	appID, err := b.applicationID()
+	if err != nil {
+		return err
+	}
+
+	commands, err := b.botSession.ApplicationCommands(appID, b.config.GuildID)
+	if err != nil {
+		return fmt.Errorf("error listing registered commands: %w", err)
+	}
+	for _, command := range commands {
+		if err := b.botSession.ApplicationCommandDelete(appID, b.config.GuildID, command.ID); err != nil {
+			return fmt.Errorf("cannot delete '%s' command: %w", command.Name, err)
+		}
+		log.Printf("Deleted /%s", command.Name)
+	}
+	log.Printf("Deleted %d commands", len(commands))
+
+	return nil
+}
+
 func (b *botImpl) registerCommands() error {
 	b.registeredCommands = make(map[handlers.Command]*discordgo.ApplicationCommand)
 
+	appID, err := b.applicationID()
+	if err != nil {
+		return err
+	}
+
+	var desired []*discordgo.ApplicationCommand
 	for _, q := range b.queues {
 		if q == nil {
 			continue
 		}
-
-		for _, command := range q.Commands() {
-			cmd, err := b.botSession.ApplicationCommandCreate(b.botSession.State.User.ID, b.config.GuildID, command)
-			if err != nil {
-				return fmt.Errorf("cannot create '%s' command: %w", command.Name, err)
-			}
-
-			b.registeredCommands[command.Name] = cmd
-			log.Printf("Registered %v command as: /%v", command.Name, cmd.Name)
-		}
+		desired = append(desired, q.Commands()...)
 	}
 
-	return nil
+	return b.syncCommands(appID, desired)
 }
 
 func (b *botImpl) Start() error {
-	b.botSession.AddHandler(func(s *discordgo.Session, r *discordgo.Ready) {
-		log.Printf("Logged in as: %v#%v", s.State.User.Username, s.State.User.Discriminator)
+	if err := b.setupShards(); err != nil {
+		return err
+	}
+	b.addHandler(func(s *discordgo.Session, r *discordgo.Ready) {
+		log.Printf("Logged in as: %v#%v on shard %d", s.State.User.Username, s.State.User.Discriminator, s.ShardID)
+		b.setConnected(s, true)
 	})
+	b.addHandler(func(s *discordgo.Session, r *discordgo.Resumed) { b.setConnected(s, true) })
+	b.addHandler(func(s *discordgo.Session, d *discordgo.Disconnect) { b.setConnected(s, false) })
+	b.addHandler(handlers.OnRateLimit)
+	audit.SetSession(b.botSession)
 
-	err := b.botSession.Open()
+	err := b.openShards()
 	if err != nil {
 		return fmt.Errorf("error opening connection to Discord: %w", err)
 	}
 
-	err = b.registerCommands()
-	if err != nil {
-		return fmt.Errorf("error registering commands: %w", err)
+	if handlers.OwnerID == "" {
+		application, err := b.botSession.Application("@me")
+		if err != nil {
+			log.Printf("Could not retrieve the bot owner: %v", err)
+		} else if application.Owner != nil {
+			handlers.OwnerID = application.Owner.ID
+			log.Printf("Bot owner set to %v", application.Owner.Username)
+		}
+	}
+
+	if b.ownsCommands() {
+		err = b.registerCommands()
+		if err != nil {
+			return fmt.Errorf("error registering commands: %w", err)
+		}
+	} else {
+		log.Printf("Leaving the commands to the process running shard 0")
 	}
 
 	b.registerHandlers()
@@ -207,7 +297,10 @@ func (b *botImpl) Start() error {
 
 	queues = slices.DeleteFunc(queues, IsNil)
 	for _, q := range queues {
-		go q.Start(b.botSession)
+		go func() {
+			defer reporting.Repanic(map[string]string{"goroutine": fmt.Sprintf("%T", q)})
+			q.Start(b.botSession)
+		}()
 	}
 
 	if len(queues) == 0 {
@@ -253,7 +346,7 @@ func stopQueue(q queue.StartStop, wg *sync.WaitGroup) {
 
 func (b *botImpl) teardown() error {
 	// Delete all commands added by the bot
-	if b.config.RemoveCommands {
+	if b.config.RemoveCommands && b.ownsCommands() {
 		log.Printf("Removing all commands added by bot...")
 
 		for key, v := range b.registeredCommands {
@@ -266,5 +359,5 @@ func (b *botImpl) teardown() error {
 		}
 	}
 
-	return b.botSession.Close()
+	return b.closeShards()
 }
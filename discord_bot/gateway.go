@@ -0,0 +1,62 @@
+package discord_bot
+
+import (
+	"log"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// CacheMode is what the gateway session keeps in memory from the events it receives
+type CacheMode string
+
+const (
+	// CacheGuilds keeps the guilds without their channels, members, roles, emojis or messages, which is all the bot
+	// reads, e.g. the boost tier for the upload limit
+	CacheGuilds CacheMode = "guilds"
+	// CacheAll keeps everything discordgo tracks by default
+	CacheAll CacheMode = "all"
+	// CacheNone keeps only the bot user, guilds are fetched over REST when needed
+	CacheNone CacheMode = "none"
+)
+
+// privilegedIntents have to be enabled for the application in the developer portal, or Discord closes the gateway
+var privilegedIntents = map[discordgo.Intent]string{
+	discordgo.IntentGuildMembers:   "guild_members",
+	discordgo.IntentGuildPresences: "guild_presences",
+	discordgo.IntentMessageContent: "message_content",
+}
+
+// configureSession sets the intents and state cache of a session before it connects. Commands and buttons arrive as
+// interactions, which don't need any intent.
+func (b *botImpl) configureSession(session *discordgo.Session) {
+	session.Identify.Intents = b.config.Intents
+
+	state := session.State
+	switch b.config.Cache {
+	case CacheAll:
+	case CacheNone:
+		session.StateEnabled = false
+	default:
+		state.TrackChannels = false
+		state.TrackThreads = false
+		state.TrackEmojis = false
+		state.TrackMembers = false
+		state.TrackThreadMembers = false
+		state.TrackRoles = false
+		state.TrackVoice = false
+		state.TrackPresences = false
+		state.MaxMessageCount = 0
+	}
+}
+
+// logGateway reports the intents that need approval and the features that fall back to REST without them
+func (b *botImpl) logGateway() {
+	for intent, name := range privilegedIntents {
+		if b.config.Intents&intent != 0 {
+			log.Printf("Requesting the privileged %s intent, it has to be enabled in the developer portal", name)
+		}
+	}
+	if b.config.Intents&discordgo.IntentGuilds == 0 || b.config.Cache == CacheNone {
+		log.Printf("Guilds aren't cached, their upload limit is looked up over REST")
+	}
+}
@@ -28,28 +28,10 @@ var ComponentHandlers = queue.Components{
 			return err
 		}
 
-		var originalInteractionUser string
-
-		switch u := utils.GetUser(i.Message.InteractionMetadata); {
-		case u != nil:
-			originalInteractionUser = u.ID
-		case len(i.Message.Mentions) > 0:
-			log.Printf("WARN: Using mentions to determine original interaction user")
-			originalInteractionUser = i.Message.Mentions[0].ID
-		default:
-			err := ErrorEdit(s, i.Interaction, "Unable to determine original interaction user")
-			if err != nil {
-				return err
-			}
-			log.Printf("Unable to determine original interaction user: %#v", i)
-			byteArr, _ := json.MarshalIndent(i, "", "  ")
-			log.Printf("Interaction: %v", string(byteArr))
+		if !CheckGenerationOwner(s, i) {
 			return nil
 		}
 
-		if utils.GetUser(i.Interaction).ID != originalInteractionUser {
-			return ErrorEdit(s, i.Interaction, "You can only delete your own generations")
-		}
 		err := s.ChannelMessageDelete(i.ChannelID, i.Message.ID)
 		if err != nil {
 			return ErrorEdit(s, i.Interaction, fmt.Errorf("error deleting message: %w", err))
@@ -74,3 +56,42 @@ var ComponentHandlers = queue.Components{
 		return nil
 	},
 }
+
+// GenerationOwner returns the ID of the user who requested the generation in message, or an empty string if it cannot be determined.
+func GenerationOwner(message *discordgo.Message) string {
+	switch u := utils.GetUser(message.InteractionMetadata); {
+	case u != nil:
+		return u.ID
+	case len(message.Mentions) > 0:
+		log.Printf("WARN: Using mentions to determine original interaction user")
+		return message.Mentions[0].ID
+	default:
+		return ""
+	}
+}
+
+// CheckGenerationOwner reports whether the user pressing a component owns the generation it is attached to.
+// If not, the deferred response is edited with the reason.
+func CheckGenerationOwner(s *discordgo.Session, i *discordgo.InteractionCreate) bool {
+	originalInteractionUser := GenerationOwner(i.Message)
+	if originalInteractionUser == "" {
+		err := ErrorEdit(s, i.Interaction, "Unable to determine original interaction user")
+		if err != nil {
+			log.Printf("Error editing interaction: %v", err)
+		}
+		log.Printf("Unable to determine original interaction user: %#v", i)
+		byteArr, _ := json.MarshalIndent(i, "", "  ")
+		log.Printf("Interaction: %v", string(byteArr))
+		return false
+	}
+
+	if utils.GetUser(i.Interaction).ID != originalInteractionUser {
+		err := ErrorEdit(s, i.Interaction, "You can only delete your own generations")
+		if err != nil {
+			log.Printf("Error editing interaction: %v", err)
+		}
+		return false
+	}
+
+	return true
+}
@@ -26,6 +26,11 @@ const (
 	CancelDisabled    Component = "cancel_disabled"
 	InterruptDisabled Component = "interrupt_disabled"
 
+	// TryOnNovelAI is shown on Stable Diffusion results and handled by the NovelAI queue, TryOnStableDiffusion the
+	// other way around
+	TryOnNovelAI         Component = "try_on_novelai"
+	TryOnStableDiffusion Component = "try_on_stable_diffusion"
+
 	roleSelect = "role_select"
 )
 
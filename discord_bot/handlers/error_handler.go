@@ -1,24 +1,66 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
 
+	"stable_diffusion_bot/apierror"
+	"stable_diffusion_bot/maintenance"
 	"stable_diffusion_bot/utils"
+	"stable_diffusion_bot/version"
 )
 
-var Token *string
+// secrets are scrubbed from the errors shown in Discord, see AddSecrets
+var secrets struct {
+	mu     sync.RWMutex
+	values []string
+}
+
+// minSecretLength is the shortest secret scrubbed, shorter values like a header set to "1" would mangle unrelated text
+const minSecretLength = 8
+
+// AddSecrets registers tokens, passwords and keys to replace with [...] in the errors shown in Discord and in reports
+func AddSecrets(values ...string) {
+	secrets.mu.Lock()
+	defer secrets.mu.Unlock()
+	for _, value := range values {
+		if value == "" {
+			continue
+		}
+		if len(value) < minSecretLength {
+			log.Printf("WARNING: a secret is shorter than %d characters and won't be scrubbed", minSecretLength)
+			continue
+		}
+		if !slices.Contains(secrets.values, value) {
+			secrets.values = append(secrets.values, value)
+		}
+	}
+}
+
+// aliveClient bounds CheckAPIAlive so a hung API reads as down instead of blocking the caller
+var aliveClient = &http.Client{Timeout: 10 * time.Second}
+
+// SetAPITransport makes CheckAPIAlive reach the API with transport, like the API client, e.g. through its proxy.
+// Call it before the bot starts.
+func SetAPITransport(transport http.RoundTripper) {
+	aliveClient.Transport = transport
+}
 
 func CheckAPIAlive(apiHost string) bool {
-	resp, err := http.Get(apiHost)
-	if err != nil || resp.StatusCode != http.StatusOK {
+	resp, err := aliveClient.Get(apiHost)
+	if err != nil {
 		return false
 	}
-	return true
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
 }
 
 const DeadAPI = "API is not running"
@@ -95,8 +137,10 @@ func formatError(errorContent ...any) string {
 			errors = append(errors, content)
 		case []string:
 			errors = append(errors, content...)
+		case apierror.Error:
+			errors = append(errors, content.Message())
 		case error:
-			errors = append(errors, content.Error())
+			errors = append(errors, describe(content))
 		case []any:
 			errors = append(errors, formatError(content...)) // Recursively format the error
 		// case any:
@@ -114,7 +158,71 @@ func formatError(errorContent ...any) string {
 	return errorString
 }
 
+// describe shows the message of the backend error wrapped by err in place of its own, without the response the
+// backend sent
+func describe(err error) string {
+	var backend apierror.Error
+	if !errors.As(err, &backend) {
+		return err.Error()
+	}
+	message := backend.Message()
+	if prefix, _, found := strings.Cut(err.Error(), backend.Error()); found && prefix != "" {
+		message = strings.TrimSuffix(strings.TrimSpace(prefix), ":") + ": " + message
+	}
+	return message
+}
+
+// backendError finds the first error the backend explained among the error content
+func backendError(errorContent ...any) apierror.Error {
+	for _, content := range errorContent {
+		switch content := content.(type) {
+		case error:
+			var backend apierror.Error
+			if errors.As(content, &backend) {
+				return backend
+			}
+		case []any:
+			if backend := backendError(content...); backend != nil {
+				return backend
+			}
+		}
+	}
+	return nil
+}
+
+// maintenanceError finds the error returned by a queue during maintenance among the error content
+func maintenanceError(errorContent ...any) *maintenance.Error {
+	for _, content := range errorContent {
+		switch content := content.(type) {
+		case error:
+			var notice *maintenance.Error
+			if errors.As(content, &notice) {
+				return notice
+			}
+		case []any:
+			if notice := maintenanceError(content...); notice != nil {
+				return notice
+			}
+		}
+	}
+	return nil
+}
+
 func errorEmbed(i *discordgo.Interaction, errorContent ...any) ([]*discordgo.MessageEmbed, string) {
+	// requests rejected for maintenance aren't errors, show members the notice on its own
+	if notice := maintenanceError(errorContent...); notice != nil {
+		title := notice.Title
+		if title == "" {
+			title = maintenance.DefaultTitle
+		}
+		return []*discordgo.MessageEmbed{{
+			Type:        discordgo.EmbedTypeRich,
+			Title:       title,
+			Description: notice.Notice(),
+			Color:       0xfee75c,
+		}}, ""
+	}
+
 	errorString := formatError(errorContent)
 
 	// decode ED4245 to int = 15548997
@@ -131,8 +239,16 @@ func errorEmbed(i *discordgo.Interaction, errorContent ...any) ([]*discordgo.Mes
 				},
 			},
 			Color: 15548997,
+			// so reports of the error say which build it happened on
+			Footer: &discordgo.MessageEmbedFooter{Text: version.String()},
 		},
 	}
+	if backend := backendError(errorContent...); backend != nil && backend.Fix() != "" {
+		embed[0].Fields = append(embed[0].Fields, &discordgo.MessageEmbedField{
+			Name:  "Suggested fix",
+			Value: backend.Fix(),
+		})
+	}
 
 	var toPrint strings.Builder
 	// Could not run the [command] `command` on message https://discord.com/channels/123456789012345678/1234567890123456789/1234567890123456789
@@ -160,18 +276,21 @@ func sanitizeToken(errorString *string) *string {
 	if errorString == nil {
 		return errorString
 	}
-	if Token == nil {
-		log.Println("WARNING: Token is nil")
-		return errorString
-	}
-	if strings.Contains(*errorString, *Token) {
-		// log.Println("WARNING: Bot token was found in the error message. Replacing it with \"Bot Token\"")
-		// log.Println("Error message:", errorString)
-		log.Printf("WARNING: Bot token was found in the error message. Replacing it with \"Bot Token\": %v", *errorString)
-		sanitizedString := strings.ReplaceAll(*errorString, *Token, "[...]")
-		errorString = &sanitizedString
+	sanitizedString := Scrub(*errorString)
+	return &sanitizedString
+}
+
+// Scrub replaces the secrets registered with AddSecrets in s with [...]
+func Scrub(s string) string {
+	secrets.mu.RLock()
+	defer secrets.mu.RUnlock()
+	for _, secret := range secrets.values {
+		if strings.Contains(s, secret) {
+			log.Printf("WARNING: A secret was found in the error message, replacing it with \"[...]\"")
+			s = strings.ReplaceAll(s, secret, "[...]")
+		}
 	}
-	return errorString
+	return s
 }
 
 func logError(errorString string, i *discordgo.Interaction) {
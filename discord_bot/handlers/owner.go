@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"github.com/bwmarrin/discordgo"
+
+	"stable_diffusion_bot/utils"
+)
+
+// OwnerID is the bot owner, who is allowed to view data across all guilds
+var OwnerID string
+
+// IsOwner reports whether the interaction was made by the bot owner
+func IsOwner(i *discordgo.Interaction) bool {
+	if OwnerID == "" {
+		return false
+	}
+	user := utils.GetUser(i)
+	return user != nil && user.ID == OwnerID
+}
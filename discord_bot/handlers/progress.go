@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// progressInterval is the least time between two progress edits of the same message, well under the 5 edits
+	// per 5 seconds Discord allows per interaction
+	progressInterval = 2 * time.Second
+	// progressExpiry is how long an interaction token is valid, progress of older interactions is forgotten
+	progressExpiry = 15 * time.Minute
+)
+
+type progressState struct {
+	token    string
+	sent     string
+	sentAt   time.Time
+	paused   time.Time
+	interval time.Duration
+}
+
+// progressLimiter coalesces progress edits: edits that come too soon after the last one, or while its route is
+// rate limited, are dropped since the next update carries newer progress anyway
+type progressLimiter struct {
+	mu       sync.Mutex
+	messages map[string]*progressState
+}
+
+var progress = &progressLimiter{messages: make(map[string]*progressState)}
+
+// EditProgress edits the response of the interaction with its current progress. Unchanged content is skipped and
+// edits are rate limited per interaction, so it's safe to call on every progress poll.
+func EditProgress(bot *discordgo.Session, i *discordgo.Interaction, content string) error {
+	if !progress.allow(i, content) {
+		return nil
+	}
+	_, err := bot.InteractionResponseEdit(i, &discordgo.WebhookEdit{Content: &content})
+	return Wrap(err)
+}
+
+func (l *progressLimiter) allow(i *discordgo.Interaction, content string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	for id, state := range l.messages {
+		if now.Sub(state.sentAt) > progressExpiry {
+			delete(l.messages, id)
+		}
+	}
+
+	state, ok := l.messages[i.ID]
+	if !ok {
+		state = &progressState{token: i.Token, interval: progressInterval}
+		l.messages[i.ID] = state
+	}
+
+	switch {
+	case state.sent == content:
+		return false
+	case now.Before(state.paused):
+		return false
+	case now.Sub(state.sentAt) < state.interval:
+		return false
+	}
+
+	state.sent, state.sentAt = content, now
+	return true
+}
+
+// OnRateLimit backs off progress edits when Discord answers with 429: progress of the rate limited interaction
+// waits out the retry and is edited less often from then on
+func OnRateLimit(_ *discordgo.Session, r *discordgo.RateLimit) {
+	if r.TooManyRequests == nil {
+		return
+	}
+	progress.mu.Lock()
+	defer progress.mu.Unlock()
+
+	for _, state := range progress.messages {
+		if state.token != "" && strings.Contains(r.URL, state.token) {
+			state.paused = time.Now().Add(r.RetryAfter)
+			state.interval = min(state.interval*2, time.Minute)
+		}
+	}
+}
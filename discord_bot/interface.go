@@ -2,4 +2,10 @@ package discord_bot
 
 type Bot interface {
 	Start() error
+	// Connected reports whether the gateway connection to Discord is up
+	Connected() bool
+	// RegisterCommands registers the slash commands without starting the bot
+	RegisterCommands() error
+	// DeregisterCommands deletes every slash command of the application in the guild, or the global ones
+	DeregisterCommands() error
 }
@@ -0,0 +1,128 @@
+package discord_bot
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// identifyInterval is how long Discord wants between two shards connecting
+const identifyInterval = 5 * time.Second
+
+// setupShards creates a session for each shard this process runs. The first one is botSession, which is also used
+// for every REST call like responding to interactions, the others only receive the events of their guilds.
+func (b *botImpl) setupShards() error {
+	sessions := []*discordgo.Session{b.botSession}
+	defer func() {
+		b.mu.Lock()
+		b.sessions = sessions
+		b.mu.Unlock()
+	}()
+
+	count := b.config.ShardCount
+	if b.config.ShardAuto {
+		gateway, err := b.botSession.GatewayBot()
+		if err != nil {
+			return fmt.Errorf("error getting the recommended shard count: %w", err)
+		}
+		count = gateway.Shards
+		log.Printf("Discord recommends %d shards", count)
+	}
+	if count <= 1 {
+		return nil
+	}
+
+	ids := b.config.ShardIDs
+	if len(ids) == 0 {
+		ids = make([]int, count)
+		for i := range ids {
+			ids[i] = i
+		}
+	}
+
+	for n, id := range ids {
+		if id >= count {
+			return fmt.Errorf("shard %d is out of range of %d shards", id, count)
+		}
+		session := b.botSession
+		if n > 0 {
+			var err error
+			session, err = discordgo.New("Bot " + b.config.BotToken)
+			if err != nil {
+				return err
+			}
+			// the shards share the REST rate limits of the bot, so they have to share the buckets too
+			session.Ratelimiter = b.botSession.Ratelimiter
+			b.configureSession(session)
+			sessions = append(sessions, session)
+		}
+		session.ShardID, session.ShardCount = id, count
+	}
+	log.Printf("Running shards %v of %d", ids, count)
+	return nil
+}
+
+// addHandler adds the event handler to the session of every shard
+func (b *botImpl) addHandler(handler any) {
+	for _, session := range b.sessions {
+		session.AddHandler(handler)
+	}
+}
+
+// openShards connects every shard to the gateway one after the other
+func (b *botImpl) openShards() error {
+	for n, session := range b.sessions {
+		if n > 0 {
+			time.Sleep(identifyInterval)
+		}
+		if err := session.Open(); err != nil {
+			return fmt.Errorf("error opening shard %d: %w", session.ShardID, err)
+		}
+	}
+	return nil
+}
+
+func (b *botImpl) closeShards() error {
+	var errs []error
+	for _, session := range b.sessions {
+		if err := session.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("error closing shard %d: %w", session.ShardID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ownsCommands reports whether this process registers and removes the commands. With shards spread over
+// processes only the one running shard 0 does, so they don't race each other.
+func (b *botImpl) ownsCommands() bool {
+	for _, session := range b.sessions {
+		if session.ShardID == 0 {
+			return true
+		}
+	}
+	return len(b.sessions) == 0
+}
+
+func (b *botImpl) setConnected(s *discordgo.Session, connected bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.connected[s.ShardID] = connected
+}
+
+// Connected reports whether every shard is connected to the gateway
+func (b *botImpl) Connected() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.sessions) == 0 {
+		return false
+	}
+	for _, session := range b.sessions {
+		if !b.connected[session.ShardID] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,14 @@
+package entities
+
+import "time"
+
+// ChannelDefault is the checkpoint, VAE and style used for /imagine in a channel when the member doesn't choose one.
+// Empty fields keep the default of the bot.
+type ChannelDefault struct {
+	GuildID    string    `json:"guild_id"`
+	ChannelID  string    `json:"channel_id"`
+	Checkpoint string    `json:"checkpoint"`
+	VAE        string    `json:"vae"`
+	Style      string    `json:"style"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
@@ -18,6 +18,9 @@ func (config *Config) Marshal() ([]byte, error) {
 	return json.Marshal(config)
 }
 
+// Config are the options of the backend. The options the bot changes or overrides, like CLIP skip, ENSD, the face
+// restorer, the live previews and the VAE overrides, are pointers so an update only sends the ones that are set, even
+// to false or 0. The others are left out of an update when they're zero.
 type Config struct {
 	SamplesSave                           bool     `json:"samples_save,omitempty"`
 	SamplesFormat                         string   `json:"samples_format,omitempty"`
@@ -75,9 +78,9 @@ type Config struct {
 	ESRGANTileOverlap                     float64  `json:"ESRGAN_tile_overlap,omitempty"`
 	RealesrganEnabledModels               []string `json:"realesrgan_enabled_models,omitempty"`
 	UpscalerForImg2Img                    string   `json:"upscaler_for_img2img,omitempty"`
-	FaceRestoration                       bool     `json:"face_restoration,omitempty"`
-	FaceRestorationModel                  string   `json:"face_restoration_model,omitempty"`
-	CodeFormerWeight                      float64  `json:"code_former_weight,omitempty"`
+	FaceRestoration                       *bool    `json:"face_restoration,omitempty"`
+	FaceRestorationModel                  *string  `json:"face_restoration_model,omitempty"`
+	CodeFormerWeight                      *float64 `json:"code_former_weight,omitempty"`
 	FaceRestorationUnload                 bool     `json:"face_restoration_unload,omitempty"`
 	AutoLaunchBrowser                     string   `json:"auto_launch_browser,omitempty"`
 	EnableConsolePrompts                  bool     `json:"enable_console_prompts,omitempty"`
@@ -115,7 +118,7 @@ type Config struct {
 	EnableEmphasis                        bool     `json:"enable_emphasis,omitempty"`
 	EnableBatchSeeds                      bool     `json:"enable_batch_seeds,omitempty"`
 	CommaPaddingBacktrack                 float64  `json:"comma_padding_backtrack,omitempty"`
-	CLIPStopAtLastLayers                  float64  `json:"CLIP_stop_at_last_layers,omitempty"`
+	CLIPStopAtLastLayers                  *float64 `json:"CLIP_stop_at_last_layers,omitempty"`
 	UpcastAttn                            bool     `json:"upcast_attn,omitempty"`
 	RandnSource                           string   `json:"randn_source,omitempty"`
 	Tiling                                bool     `json:"tiling,omitempty"`
@@ -127,7 +130,8 @@ type Config struct {
 	SDVaeExplanation                      string   `json:"sd_vae_explanation,omitempty"`
 	SDVaeCheckpointCache                  float64  `json:"sd_vae_checkpoint_cache,omitempty"`
 	SDVae                                 *string  `json:"sd_vae,omitempty"`
-	SDVaeOverridesPerModelPreferences     bool     `json:"sd_vae_overrides_per_model_preferences,omitempty"`
+	SDVaeAsDefault                        *bool    `json:"sd_vae_as_default,omitempty"` // replaced by sd_vae_overrides_per_model_preferences in 1.6
+	SDVaeOverridesPerModelPreferences     *bool    `json:"sd_vae_overrides_per_model_preferences,omitempty"`
 	AutoVaePrecision                      bool     `json:"auto_vae_precision,omitempty"`
 	SDVaeEncodeMethod                     string   `json:"sd_vae_encode_method,omitempty"`
 	SDVaeDecodeMethod                     string   `json:"sd_vae_decode_method,omitempty"`
@@ -219,16 +223,16 @@ type Config struct {
 	AddVersionToInfotext                  bool     `json:"add_version_to_infotext,omitempty"`
 	DisableWeightsAutoSwap                bool     `json:"disable_weights_auto_swap,omitempty"`
 	InfotextStyles                        string   `json:"infotext_styles,omitempty"`
-	ShowProgressbar                       bool     `json:"show_progressbar,omitempty"`
-	LivePreviewsEnable                    bool     `json:"live_previews_enable,omitempty"`
-	LivePreviewsImageFormat               string   `json:"live_previews_image_format,omitempty"`
-	ShowProgressGrid                      bool     `json:"show_progress_grid,omitempty"`
-	ShowProgressEveryNSteps               float64  `json:"show_progress_every_n_steps,omitempty"`
-	ShowProgressType                      string   `json:"show_progress_type,omitempty"`
-	LivePreviewAllowLowvramFull           bool     `json:"live_preview_allow_lowvram_full,omitempty"`
-	LivePreviewContent                    string   `json:"live_preview_content,omitempty"`
-	LivePreviewRefreshPeriod              float64  `json:"live_preview_refresh_period,omitempty"`
-	LivePreviewFastInterrupt              bool     `json:"live_preview_fast_interrupt,omitempty"`
+	ShowProgressbar                       *bool    `json:"show_progressbar,omitempty"`
+	LivePreviewsEnable                    *bool    `json:"live_previews_enable,omitempty"`
+	LivePreviewsImageFormat               *string  `json:"live_previews_image_format,omitempty"`
+	ShowProgressGrid                      *bool    `json:"show_progress_grid,omitempty"`
+	ShowProgressEveryNSteps               *float64 `json:"show_progress_every_n_steps,omitempty"`
+	ShowProgressType                      *string  `json:"show_progress_type,omitempty"`
+	LivePreviewAllowLowvramFull           *bool    `json:"live_preview_allow_lowvram_full,omitempty"`
+	LivePreviewContent                    *string  `json:"live_preview_content,omitempty"`
+	LivePreviewRefreshPeriod              *float64 `json:"live_preview_refresh_period,omitempty"`
+	LivePreviewFastInterrupt              *bool    `json:"live_preview_fast_interrupt,omitempty"`
 	HideSamplers                          []string `json:"hide_samplers,omitempty"`
 	EtaDdim                               float64  `json:"eta_ddim,omitempty"`
 	EtaAncestral                          float64  `json:"eta_ancestral,omitempty"`
@@ -241,7 +245,7 @@ type Config struct {
 	SigmaMin                              float64  `json:"sigma_min,omitempty"`
 	SigmaMax                              float64  `json:"sigma_max,omitempty"`
 	Rho                                   float64  `json:"rho,omitempty"`
-	EtaNoiseSeedDelta                     float64  `json:"eta_noise_seed_delta,omitempty"`
+	EtaNoiseSeedDelta                     *float64 `json:"eta_noise_seed_delta,omitempty"`
 	AlwaysDiscardNextToLastSigma          bool     `json:"always_discard_next_to_last_sigma,omitempty"`
 	SgmNoiseMultiplier                    bool     `json:"sgm_noise_multiplier,omitempty"`
 	UniPCVariant                          string   `json:"uni_pc_variant,omitempty"`
@@ -0,0 +1,106 @@
+package entities
+
+import (
+	"strings"
+
+	"stable_diffusion_bot/utils"
+)
+
+// webUISamplers are the names the WebUI gives the samplers NovelAI has
+var webUISamplers = map[sampler]string{
+	SamplerEuler:          "Euler",
+	SamplerEulerAncestral: "Euler a",
+	SamplerDPM2SAncestral: "DPM++ 2S a",
+	SamplerDPM2M:          "DPM++ 2M",
+	SamplerDPM2MSDE:       "DPM++ 2M SDE",
+	SamplerDPMSDE:         "DPM++ SDE",
+	SamplerDDIM:           "DDIM",
+}
+
+// webUISchedulers are the names the WebUI gives the noise schedules NovelAI has, native is the WebUI's automatic one
+var webUISchedulers = map[schedule]string{
+	ScheduleKarras:          "Karras",
+	ScheduleExponential:     "Exponential",
+	SchedulePolyexponential: "Polyexponential",
+}
+
+// ApplyToNovelAI translates the prompt, size, steps, guidance, sampler and seed of r, made with Stable Diffusion, onto
+// request. The size keeps its aspect ratio at the area of NovelAI's default size, as both were made for the size of
+// their model. The seed is kept if NovelAI accepts it.
+func (r *TextToImageRequest) ApplyToNovelAI(request *NovelAIRequest) {
+	request.Input = NovelAIWeights(r.Prompt)
+	request.Parameters.NegativePrompt = NovelAIWeights(r.NegativePrompt)
+
+	if r.Width > 0 && r.Height > 0 {
+		megapixels := utils.Megapixels(int(ResolutionNormalSquare[0]), int(ResolutionNormalSquare[1]))
+		width, height := utils.ScaleMegapixels(r.Width, r.Height, megapixels, 64)
+		request.Parameters.ResolutionPreset = nil
+		request.Parameters.Width, request.Parameters.Height = int64(width), int64(height)
+	}
+	if r.Steps >= 1 {
+		request.Parameters.Steps = int64(min(r.Steps, 50))
+	}
+	if r.CFGScale > 0 {
+		request.Parameters.Scale = min(r.CFGScale, 10)
+	}
+
+	// names from before the WebUI 1.9 end with their scheduler, e.g. "DPM++ 2M Karras"
+	var matched string
+	for novelAI, webUI := range webUISamplers {
+		if len(webUI) > len(matched) && len(r.SamplerName) >= len(webUI) && strings.EqualFold(r.SamplerName[:len(webUI)], webUI) {
+			matched, request.Parameters.Sampler = webUI, novelAI
+		}
+	}
+	scheduler := strings.TrimSpace(r.SamplerName[len(matched):])
+	if r.Scheduler != nil && *r.Scheduler != "" {
+		scheduler = *r.Scheduler
+	}
+	for novelAI, webUI := range webUISchedulers {
+		if strings.EqualFold(webUI, scheduler) {
+			request.Parameters.NoiseSchedule = novelAI
+		}
+	}
+	if request.Parameters.CheckSampling(request.Model) != nil {
+		request.Parameters.Sampler, request.Parameters.NoiseSchedule = SamplerDefault, ScheduleDefault
+	}
+
+	if r.Seed > 0 && r.Seed <= 4294967295-7 {
+		request.Parameters.Seed = r.Seed
+	} else {
+		// Init picks a new seed
+		request.Parameters.Seed = 0
+	}
+}
+
+// ApplyToWebUI translates the prompt, size, steps, guidance, sampler and seed of r, made with NovelAI, onto request.
+// The size keeps its aspect ratio at the area request already has, the default size of the checkpoint. NovelAI's
+// seeds are always accepted by the WebUI.
+func (r *NovelAIRequest) ApplyToWebUI(request *TextToImageRequest) {
+	request.Prompt = WebUIWeights(r.Input)
+	if r.Parameters.NegativePrompt != "" {
+		request.NegativePrompt = WebUIWeights(r.Parameters.NegativePrompt)
+	}
+
+	if width, height := r.Parameters.Size(); width > 0 && height > 0 && request.Width > 0 && request.Height > 0 {
+		request.Width, request.Height = utils.ScaleMegapixels(int(width), int(height), utils.Megapixels(request.Width, request.Height), 8)
+	}
+	if r.Parameters.Steps > 0 {
+		request.Steps = int(r.Parameters.Steps)
+	}
+	if r.Parameters.Scale > 0 {
+		request.CFGScale = r.Parameters.Scale
+	}
+	if name, ok := webUISamplers[r.Parameters.Sampler]; ok {
+		request.SamplerName = name
+		if scheduler, ok := webUISchedulers[r.Parameters.NoiseSchedule]; ok {
+			request.Scheduler = &scheduler
+		}
+	}
+	if r.Parameters.ImageCount > 0 {
+		request.BatchSize, request.NIter = int(min(r.Parameters.ImageCount, 4)), 1
+	}
+
+	if r.Parameters.Seed > 0 {
+		request.Seed = r.Parameters.Seed
+	}
+}
@@ -6,4 +6,6 @@ type DefaultSettings struct {
 	Height     int    `json:"height"`
 	BatchCount int    `json:"batch_count"`
 	BatchSize  int    `json:"batch_size"`
+	// NegativeEmbeddings are appended to the negative prompt, separated by commas
+	NegativeEmbeddings string `json:"negative_embeddings"`
 }
@@ -0,0 +1,26 @@
+package entities
+
+import (
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// DeletedMessage is a soft-deleted generation message, archived with its attachments so an admin can restore it
+type DeletedMessage struct {
+	MessageID string                    `json:"message_id"`
+	GuildID   string                    `json:"guild_id"`
+	ChannelID string                    `json:"channel_id"`
+	MemberID  string                    `json:"member_id"`
+	DeletedBy string                    `json:"deleted_by"`
+	Content   string                    `json:"content"`
+	Embeds    []*discordgo.MessageEmbed `json:"embeds"`
+	Files     []DeletedFile             `json:"-"`
+	DeletedAt time.Time                 `json:"deleted_at"`
+}
+
+type DeletedFile struct {
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+	Data        []byte `json:"-"`
+}
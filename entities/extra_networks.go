@@ -0,0 +1,67 @@
+package entities
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	ExtraNetworkLora      = "lora"
+	ExtraNetworkEmbedding = "embedding"
+)
+
+// ExtraNetwork is a LoRA or textual inversion embedding that was used in a generation
+type ExtraNetwork struct {
+	Type   string   `json:"type"`
+	Name   string   `json:"name"`
+	Hash   string   `json:"hash,omitempty"`
+	Weight *float64 `json:"weight,omitempty"`
+}
+
+// loraPromptRegex matches <lora:name> and <lora:name:weight>, weights can be negative
+var loraPromptRegex = regexp.MustCompile(`<lora:([^:>]+)(?::(-?[\d.]+))?>`)
+
+// ExtraNetworks returns the LoRAs and embeddings reported in the response info block.
+// LoRA weights are taken from the prompt when present.
+func (i Info) ExtraNetworks() []ExtraNetwork {
+	if i.ExtraGenerationParams == nil {
+		return nil
+	}
+
+	weights := make(map[string]float64)
+	for _, match := range loraPromptRegex.FindAllStringSubmatch(i.Prompt, -1) {
+		if match[2] == "" {
+			continue
+		}
+		if weight, err := strconv.ParseFloat(match[2], 64); err == nil {
+			weights[match[1]] = weight
+		}
+	}
+
+	networks := parseNetworkHashes(ExtraNetworkLora, i.ExtraGenerationParams.LoraHashes)
+	for idx, network := range networks {
+		if weight, ok := weights[network.Name]; ok {
+			networks[idx].Weight = &weight
+		}
+	}
+
+	return append(networks, parseNetworkHashes(ExtraNetworkEmbedding, i.ExtraGenerationParams.TIHashes)...)
+}
+
+// parseNetworkHashes parses the "name: hash, name: hash" format used by the A1111 infotext
+func parseNetworkHashes(networkType, hashes string) []ExtraNetwork {
+	var networks []ExtraNetwork
+	for _, pair := range strings.Split(strings.Trim(hashes, `"`), ",") {
+		name, hash, ok := strings.Cut(pair, ":")
+		if !ok {
+			continue
+		}
+		networks = append(networks, ExtraNetwork{
+			Type: networkType,
+			Name: strings.TrimSpace(name),
+			Hash: strings.TrimSpace(hash),
+		})
+	}
+	return networks
+}
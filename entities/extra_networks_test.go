@@ -0,0 +1,34 @@
+package entities
+
+import (
+	"testing"
+)
+
+func TestExtraNetworksWeights(t *testing.T) {
+	for _, tt := range []struct {
+		prompt string
+		weight *float64
+	}{
+		{"1girl, <lora:style:0.8>", ptr(0.8)},
+		{"1girl, <lora:style:-0.5>", ptr(-0.5)},
+		{"1girl, <lora:style>", nil},
+	} {
+		t.Run(tt.prompt, func(t *testing.T) {
+			info := Info{Prompt: tt.prompt, ExtraGenerationParams: &ExtraGenerationParams{LoraHashes: "style: abc123"}}
+			networks := info.ExtraNetworks()
+			if len(networks) != 1 || networks[0].Name != "style" {
+				t.Fatalf("networks = %+v, want the style lora", networks)
+			}
+			switch got := networks[0].Weight; {
+			case tt.weight == nil && got != nil:
+				t.Errorf("weight = %v, want none", *got)
+			case tt.weight != nil && (got == nil || *got != *tt.weight):
+				t.Errorf("weight = %v, want %v", got, *tt.weight)
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
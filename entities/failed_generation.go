@@ -0,0 +1,17 @@
+package entities
+
+import "time"
+
+// FailedGeneration is a generation that errored out, kept around to diagnose recurring backend errors
+type FailedGeneration struct {
+	ID            int64  `json:"id"`
+	InteractionID string `json:"interaction_id"`
+	GuildID       string `json:"guild_id"`
+	MemberID      string `json:"member_id"`
+	Backend       string `json:"backend"`
+	Request       string `json:"request"`
+	Error         string `json:"error"`
+	// Log is what was logged while the generation was processed
+	Log       string    `json:"log"`
+	CreatedAt time.Time `json:"created_at"`
+}
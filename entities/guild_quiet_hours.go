@@ -0,0 +1,55 @@
+package entities
+
+import "time"
+
+const (
+	// QuietHoursOff rejects generations during quiet hours
+	QuietHoursOff = "off"
+	// QuietHoursHold queues generations during quiet hours and runs them once the window ends
+	QuietHoursHold = "hold"
+)
+
+// GuildQuietHours is a daily window during which generation in a guild is disabled or held.
+// Start and End are minutes since midnight in Timezone, the window wraps past midnight when End is before Start.
+type GuildQuietHours struct {
+	GuildID   string    `json:"guild_id"`
+	Start     int       `json:"start"`
+	End       int       `json:"end"`
+	Timezone  string    `json:"timezone"`
+	Mode      string    `json:"mode"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Location is the timezone of the window, UTC if it can't be loaded
+func (q *GuildQuietHours) Location() *time.Location {
+	location, err := time.LoadLocation(q.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// Until returns when the window now falls in ends, false if now is outside quiet hours
+func (q *GuildQuietHours) Until(now time.Time) (time.Time, bool) {
+	if q.Start == q.End {
+		return time.Time{}, false
+	}
+	local := now.In(q.Location())
+	minute := local.Hour()*60 + local.Minute()
+
+	var inside bool
+	if q.Start < q.End {
+		inside = minute >= q.Start && minute < q.End
+	} else {
+		inside = minute >= q.Start || minute < q.End
+	}
+	if !inside {
+		return time.Time{}, false
+	}
+
+	day := local.Day()
+	if minute >= q.End {
+		day++
+	}
+	return time.Date(local.Year(), local.Month(), day, q.End/60, q.End%60, 0, 0, local.Location()), true
+}
@@ -0,0 +1,13 @@
+package entities
+
+import "time"
+
+// GuildWatermark is drawn on the images generated in a guild. Image is a PNG and takes precedence over Text
+type GuildWatermark struct {
+	GuildID   string    `json:"guild_id"`
+	Text      string    `json:"text"`
+	Image     []byte    `json:"image"`
+	Corner    string    `json:"corner"`
+	Opacity   float64   `json:"opacity"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
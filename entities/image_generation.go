@@ -41,6 +41,10 @@ type ImageGeneration struct {
 	Hypernetwork      *string   `json:"hypernetwork,omitempty"`
 }
 
+// GenerationSchemaVersion is the shape ImageGenerationRequest is stored in. Raise it along with an upgrade in
+// repositories/image_generations whenever a stored field changes shape, so older rows can still be read.
+const GenerationSchemaVersion = 1
+
 type ImageGenerationRequest struct {
 	GenerationInfo
 	*TextToImageRequest
@@ -49,6 +53,8 @@ type ImageGenerationRequest struct {
 type GenerationInfo struct {
 	ID            int64     `json:"id"`
 	InteractionID string    `json:"interaction_id"`
+	GuildID       string    `json:"guild_id"`
+	ChannelID     string    `json:"channel_id"`
 	MessageID     string    `json:"message_id"`
 	MemberID      string    `json:"member_id"`
 	SortOrder     int       `json:"sort_order"`
@@ -57,6 +63,30 @@ type GenerationInfo struct {
 	VAE           *string   `json:"vae,omitempty"`
 	Hypernetwork  *string   `json:"hypernetwork,omitempty"`
 	CreatedAt     time.Time `json:"created_at"`
+
+	// SchemaVersion is the GenerationSchemaVersion the record was stored with, rows are upgraded to the current one
+	// when they are read
+	SchemaVersion int `json:"schema_version"`
+
+	// Backend is the queue that made the generation, BackendStableDiffusion or BackendNovelAI. Anlas is what a
+	// NovelAI generation cost, recorded on its parent row
+	Backend string `json:"backend,omitempty"`
+	Anlas   *int64 `json:"anlas,omitempty"`
+
+	// Provenance of the models used, captured from the response info block
+	CheckpointHash   *string        `json:"checkpoint_hash,omitempty"`
+	CheckpointSHA256 *string        `json:"checkpoint_sha256,omitempty"`
+	VAEHash          *string        `json:"vae_hash,omitempty"`
+	ExtraNetworks    []ExtraNetwork `json:"extra_networks,omitempty"`
+
+	// RawRequest and RawInfo are only stored for raw JSON generations
+	RawRequest *string `json:"raw_request,omitempty"`
+	RawInfo    *string `json:"raw_info,omitempty"`
+
+	// ParentID is the generation this one was derived from, along with the upscaler and scale if it is an upscale
+	ParentID      *int64   `json:"parent_id,omitempty"`
+	Upscaler      *string  `json:"upscaler,omitempty"`
+	UpscaleFactor *float64 `json:"upscale_factor,omitempty"`
 }
 
 func NewGeneration() *ImageGeneration {
@@ -8,6 +8,7 @@ package entities
 
 import (
 	"encoding/json"
+	"fmt"
 
 	"github.com/bwmarrin/discordgo"
 
@@ -29,8 +30,34 @@ func (r *ImageToImageRequest) Marshal() ([]byte, error) {
 	return json.Marshal(r)
 }
 
+// NewImageToImageRequest copies every field textToImage shares with img2img, matched by its json name, and starts
+// from initImages. Fields only txt2img has, like the hires fix, are left out.
+func NewImageToImageRequest(textToImage *TextToImageRequest, initImages ...string) (*ImageToImageRequest, error) {
+	data, err := json.Marshal(textToImage)
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling txt2img request: %w", err)
+	}
+
+	var img2img ImageToImageRequest
+	if err := json.Unmarshal(data, &img2img); err != nil {
+		return nil, fmt.Errorf("error converting txt2img request to img2img: %w", err)
+	}
+	img2img.InitImages = append(img2img.InitImages, initImages...)
+	return &img2img, nil
+}
+
+// InpaintingFill is what the masked area starts as before it's inpainted
+type InpaintingFill int64
+
+const (
+	InpaintingFillFill          InpaintingFill = iota // the blurred colours around the mask
+	InpaintingFillOriginal                            // the init image as it is
+	InpaintingFillLatentNoise                         // noise, for content unrelated to the init image
+	InpaintingFillLatentNothing                       // an empty latent
+)
+
 type ImageToImageRequest struct {
-	Scripts                           `json:"alwayson_scripts,omitempty"`
+	Scripts                           Scripts                `json:"alwayson_scripts,omitempty"`
 	BatchSize                         int                    `json:"batch_size,omitempty"`
 	CFGScale                          *float64               `json:"cfg_scale,omitempty"`
 	Comments                          map[string]interface{} `json:"comments,omitempty"`
@@ -39,20 +66,24 @@ type ImageToImageRequest struct {
 	DoNotSaveGrid                     *bool                  `json:"do_not_save_grid,omitempty"`
 	DoNotSaveSamples                  *bool                  `json:"do_not_save_samples,omitempty"`
 	Eta                               *float64               `json:"eta,omitempty"`
+	FirstpassImage                    *string                `json:"firstpass_image,omitempty"` // base64 image to use as the first pass instead of generating one
+	ForceTaskID                       *string                `json:"force_task_id,omitempty"`
 	Height                            *int                   `json:"height,omitempty"`
-	ImageCFGScale                     *float64               `json:"image_cfg_scale,omitempty"`
+	ImageCFGScale                     *float64               `json:"image_cfg_scale,omitempty"` // how closely instruct-pix2pix follows the init image
 	IncludeInitImages                 *bool                  `json:"include_init_images,omitempty"`
+	Infotext                          *string                `json:"infotext,omitempty"`
 	InitImages                        []string               `json:"init_images,omitempty"`
 	InitialNoiseMultiplier            *float64               `json:"initial_noise_multiplier,omitempty"`
 	InpaintFullRes                    *bool                  `json:"inpaint_full_res,omitempty"`
 	InpaintFullResPadding             *int64                 `json:"inpaint_full_res_padding,omitempty"`
-	InpaintingFill                    *int64                 `json:"inpainting_fill,omitempty"`
+	InpaintingFill                    *InpaintingFill        `json:"inpainting_fill,omitempty"`
 	InpaintingMaskInvert              *int64                 `json:"inpainting_mask_invert,omitempty"`
 	LatentMask                        *string                `json:"latent_mask,omitempty"`
 	Mask                              *string                `json:"mask,omitempty"`
 	MaskBlur                          *int64                 `json:"mask_blur,omitempty"`
 	MaskBlurX                         *int64                 `json:"mask_blur_x,omitempty"`
 	MaskBlurY                         *int64                 `json:"mask_blur_y,omitempty"`
+	MaskRound                         *bool                  `json:"mask_round,omitempty"`
 	NIter                             int                    `json:"n_iter,omitempty"`
 	NegativePrompt                    *string                `json:"negative_prompt,omitempty"`
 	OverrideSettings                  Config                 `json:"override_settings,omitempty"`
@@ -70,7 +101,8 @@ type ImageToImageRequest struct {
 	SamplerIndex                      *string                `json:"sampler_index,omitempty"`
 	SamplerName                       *string                `json:"sampler_name,omitempty"`
 	SaveImages                        *bool                  `json:"save_images,omitempty"`
-	ScriptArgs                        []string               `json:"script_args,omitempty"`
+	Scheduler                         *string                `json:"scheduler,omitempty"`
+	ScriptArgs                        []any                  `json:"script_args,omitempty"`
 	ScriptName                        *string                `json:"script_name,omitempty"`
 	Seed                              *int64                 `json:"seed,omitempty"`
 	SeedResizeFromH                   *int64                 `json:"seed_resize_from_h,omitempty"`
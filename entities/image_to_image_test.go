@@ -0,0 +1,115 @@
+package entities
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// img2imgProperties are the properties of StableDiffusionProcessingImg2Img in the A1111 API schema
+var img2imgProperties = []string{
+	"prompt", "negative_prompt", "styles", "seed", "subseed", "subseed_strength", "seed_resize_from_h",
+	"seed_resize_from_w", "sampler_name", "scheduler", "batch_size", "n_iter", "steps", "cfg_scale", "width",
+	"height", "restore_faces", "tiling", "do_not_save_samples", "do_not_save_grid", "eta", "denoising_strength",
+	"s_min_uncond", "s_churn", "s_tmax", "s_tmin", "s_noise", "override_settings",
+	"override_settings_restore_afterwards", "refiner_checkpoint", "refiner_switch_at", "disable_extra_networks",
+	"firstpass_image", "comments", "init_images", "resize_mode", "image_cfg_scale", "mask", "mask_blur_x",
+	"mask_blur_y", "mask_blur", "mask_round", "inpainting_fill", "inpaint_full_res", "inpaint_full_res_padding",
+	"inpainting_mask_invert", "initial_noise_multiplier", "latent_mask", "force_task_id", "sampler_index",
+	"include_init_images", "script_name", "script_args", "send_images", "save_images", "alwayson_scripts",
+	"infotext",
+}
+
+func TestImageToImageRequestFields(t *testing.T) {
+	fields := jsonFields(reflect.TypeFor[ImageToImageRequest]())
+	for _, property := range img2imgProperties {
+		if !fields[property] {
+			t.Errorf("ImageToImageRequest is missing %q", property)
+		}
+	}
+}
+
+func TestNewImageToImageRequestCopiesSharedFields(t *testing.T) {
+	textToImage, err := UnmarshalTextToImageRequest([]byte(fullTextToImageRequest))
+	if err != nil {
+		t.Fatalf("error unmarshalling request: %v", err)
+	}
+
+	img2img, err := NewImageToImageRequest(&textToImage)
+	if err != nil {
+		t.Fatalf("error converting request: %v", err)
+	}
+
+	var want, got map[string]any
+	marshalled, err := textToImage.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(marshalled, &want); err != nil {
+		t.Fatal(err)
+	}
+	if marshalled, err = img2img.Marshal(); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(marshalled, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	shared := jsonFields(reflect.TypeFor[ImageToImageRequest]())
+	for key, value := range want {
+		if !shared[key] {
+			if _, ok := got[key]; ok {
+				t.Errorf("%s only exists in txt2img but was copied", key)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(got[key], value) {
+			t.Errorf("%s = %v after converting, want %v", key, got[key], value)
+		}
+	}
+}
+
+func TestNewImageToImageRequestInitImages(t *testing.T) {
+	textToImage := &TextToImageRequest{
+		Prompt: "a cat",
+		Scripts: Scripts{
+			CFGRescale: &CFGRescale{},
+			Extensions: map[string]json.RawMessage{"Dynamic Prompts v2.17.1": json.RawMessage(`{"args":[true]}`)},
+		},
+	}
+
+	img2img, err := NewImageToImageRequest(textToImage, "first", "second")
+	if err != nil {
+		t.Fatalf("error converting request: %v", err)
+	}
+	if !reflect.DeepEqual(img2img.InitImages, []string{"first", "second"}) {
+		t.Errorf("init_images = %v, want [first second]", img2img.InitImages)
+	}
+	if img2img.Prompt != "a cat" {
+		t.Errorf("prompt = %v, want a cat", img2img.Prompt)
+	}
+	if img2img.Scripts.CFGRescale == nil {
+		t.Error("CFG Rescale script wasn't copied")
+	}
+	if _, ok := img2img.Scripts.Extensions["Dynamic Prompts v2.17.1"]; !ok {
+		t.Errorf("extension scripts = %v, want Dynamic Prompts", img2img.Scripts.Extensions)
+	}
+}
+
+func TestNewImageToImageRequestDoesNotShareFields(t *testing.T) {
+	textToImage := &TextToImageRequest{Width: 512, Height: 768, Styles: []string{"style"}}
+
+	img2img, err := NewImageToImageRequest(textToImage)
+	if err != nil {
+		t.Fatalf("error converting request: %v", err)
+	}
+	*img2img.Width, *img2img.Height = 1024, 1024
+	img2img.Styles[0] = "changed"
+
+	if textToImage.Width != 512 || textToImage.Height != 768 {
+		t.Errorf("txt2img size changed to %dx%d", textToImage.Width, textToImage.Height)
+	}
+	if textToImage.Styles[0] != "style" {
+		t.Errorf("txt2img styles changed to %v", textToImage.Styles)
+	}
+}
@@ -0,0 +1,12 @@
+package entities
+
+import "time"
+
+// LayoutSetting chooses how generations are posted, set by a member for their own or by an admin for a guild
+type LayoutSetting struct {
+	Scope   string `json:"scope"`
+	ScopeID string `json:"scope_id"`
+	// Individual uploads each image as its own attachment instead of tiling them into a grid
+	Individual bool      `json:"individual"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
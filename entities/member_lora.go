@@ -0,0 +1,13 @@
+package entities
+
+import "time"
+
+// MemberLora is a LoRA in a member's quick list. Uses are counted automatically, pinned LoRAs keep their weight
+type MemberLora struct {
+	MemberID   string    `json:"member_id"`
+	Name       string    `json:"name"`
+	Weight     float64   `json:"weight"`
+	Uses       int       `json:"uses"`
+	Pinned     bool      `json:"pinned"`
+	LastUsedAt time.Time `json:"last_used_at"`
+}
@@ -27,7 +27,10 @@ type Memory struct {
 	Cuda Cuda `json:"cuda"`
 }
 
+// Cuda is only reported by CUDA and ROCm backends. DirectML and MPS backends, and ROCm builds without memory stats,
+// report Error in its place.
 type Cuda struct {
+	Error     string `json:"error,omitempty"`
 	System    RAM    `json:"system"`
 	Active    Active `json:"active"`
 	Allocated Active `json:"allocated"`
@@ -47,6 +50,7 @@ type Events struct {
 }
 
 type RAM struct {
+	Error string  `json:"error,omitempty"`
 	Free  float64 `json:"free"`
 	Used  float64 `json:"used"`
 	Total float64 `json:"total"`
@@ -58,7 +62,16 @@ type ReadableMemory struct {
 	Total string `json:"total"`
 }
 
+// Available reports whether the memory was measured
+func (mem *RAM) Available() bool {
+	return mem != nil && mem.Error == "" && mem.Total > 0
+}
+
+// Readable returns nil when the memory isn't Available
 func (mem *RAM) Readable() *ReadableMemory {
+	if !mem.Available() {
+		return nil
+	}
 	return &ReadableMemory{
 		Free:  readableMemory(mem.Free),
 		Used:  readableMemory(mem.Used),
@@ -66,7 +79,16 @@ func (mem *RAM) Readable() *ReadableMemory {
 	}
 }
 
+// Available reports whether the backend measured the memory of its GPU
+func (mem *Cuda) Available() bool {
+	return mem != nil && mem.Error == "" && mem.System.Available()
+}
+
+// Readable returns nil when the memory isn't Available
 func (mem *Cuda) Readable() *ReadableMemory {
+	if !mem.Available() {
+		return nil
+	}
 	return mem.System.Readable()
 }
 
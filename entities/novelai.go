@@ -13,6 +13,7 @@ import (
 	"math"
 	"math/rand"
 	"reflect"
+	"strings"
 
 	"github.com/ellypaws/novelai-metadata/pkg/meta"
 
@@ -47,15 +48,11 @@ type Parameters struct {
 	// [Decrisper]: https://docs.novelai.net/image/stepsguidance.html#decrisper
 	Decrisper bool `json:"dynamic_thresholding,omitempty"`
 
-	// QualityToggle adds AdditionalPositive to the prompt if set to true.
+	// QualityToggle adds the QualityTags of the model to the prompt if set to true.
 	QualityToggle bool `json:"qualityToggle,omitempty"`
 
 	// UcPreset aka Undesired Content preset.
-	// The presets are as follows:
-	// 0: HeavyNegative
-	// 1: LightNegative
-	// 2: HumanFocusNegative
-	// 3: None
+	// The presets are UCHeavy, UCLight, UCHumanFocus, UCNone and UCFurryFocus, see UCPresetTags
 	UcPreset *int64 `json:"ucPreset,omitempty"`
 
 	// ImageCount is the number of images to generate.
@@ -84,6 +81,13 @@ type Parameters struct {
 	ReferenceStrength                     float64   `json:"reference_strength,omitempty"`
 	ReferenceStrengthMultiple             []float64 `json:"reference_strength_multiple,omitempty"`
 
+	// Director references are used by V4.5 models for character reference, see SetCharacterReference
+	DirectorReferenceImages                  []*async                       `json:"director_reference_images,omitempty"`
+	DirectorReferenceDescriptions            []DirectorReferenceDescription `json:"director_reference_descriptions,omitempty"`
+	DirectorReferenceInformationExtracted    []float64                      `json:"director_reference_information_extracted,omitempty"`
+	DirectorReferenceStrengthValues          []float64                      `json:"director_reference_strength_values,omitempty"`
+	DirectorReferenceSecondaryStrengthValues []float64                      `json:"director_reference_secondary_strength_values,omitempty"`
+
 	ParamsVersion  int64 `json:"params_version,omitempty"`
 	Legacy         bool  `json:"legacy,omitempty"`
 	LegacyV3Extend bool  `json:"legacy_v3_extend,omitempty"`
@@ -100,6 +104,12 @@ type Parameters struct {
 	V4Prompt          V4Prompt `json:"v4_prompt"`          // Prompt for ModelV4Full
 }
 
+// DirectorReferenceDescription says what a director reference image is used for
+type DirectorReferenceDescription struct {
+	Caption  Caption `json:"caption"`
+	LegacyUC bool    `json:"legacy_uc"`
+}
+
 type V4Prompt struct {
 	Caption   Caption `json:"caption"`
 	UseCoords bool    `json:"use_coords"`
@@ -130,19 +140,13 @@ type async = utils.Image
 type sampler = string
 type schedule = string
 
+// Undesired content presets of the official UI, see UCPresetTags
 const (
 	UCHeavy = iota
 	UCLight
 	UCHumanFocus
-
-	HeavyNegative      = ", lowres, {bad}, error, fewer, extra, missing, worst quality, jpeg artifacts, bad quality, watermark, unfinished, displeasing, chromatic aberration, signature, extra digits, artistic error, username, scan, [abstract]"
-	LightNegative      = ", lowres, jpeg artifacts, worst quality, watermark, blurry, very displeasing"
-	HumanFocusNegative = ", lowres, {bad}, error, fewer, extra, missing, worst quality, jpeg artifacts, bad quality, watermark, unfinished, displeasing, chromatic aberration, signature, extra digits, artistic error, username, scan, [abstract], bad anatomy, bad hands, @_@, mismatched pupils, heart-shaped pupils, glowing eyes"
-
-	HeavyNegativeFurry = ", {{worst quality}}, [displeasing], {unusual pupils}, guide lines, {{unfinished}}, {bad}, url, artist name, {{tall image}}, mosaic, {sketch page}, comic panel, impact (font), [dated], {logo}, ych, {what}, {where is your god now}, {distorted text}, repeated text, {floating head}, {1994}, {widescreen}, absolutely everyone, sequence, {compression artifacts}, hard translated, {cropped}, {commissioner name}, unknown text, high contrast"
-	LightNegativeFurry = ", {worst quality}, guide lines, unfinished, bad, url, tall image, widescreen, compression artifacts, unknown text"
-
-	AdditionalPositive = ", best quality, amazing quality, very aesthetic, absurdres"
+	UCNone
+	UCFurryFocus
 )
 
 func UnmarshalNovelAIRequest(data []byte) (NovelAIRequest, error) {
@@ -193,7 +197,7 @@ func (r *NovelAIRequest) Reader() (io.Reader, error) {
 }
 
 func DefaultNovelAIRequest() *NovelAIRequest {
-	uc := int64(2)
+	uc := int64(UCHeavy)
 	return &NovelAIRequest{
 		Action: ActionGenerate,
 		Model:  ModelV4Full,
@@ -236,41 +240,22 @@ func (r *NovelAIRequest) Init() {
 	}
 
 	if r.Parameters.QualityToggle {
-		r.Input += AdditionalPositive
+		r.Input += QualityTags(r.Model)
 	}
 
 	if r.Parameters.Seed <= 0 {
 		r.Parameters.Seed = rand.Int63n(4294967295 - 7)
 	}
 
+	// the official UI puts the preset before the member's own undesired content
 	if r.Parameters.UcPreset != nil {
-		switch r.Model {
-		case ModelFurryV3, MovelFurryV3Inp:
-			switch *r.Parameters.UcPreset {
-			case UCHeavy:
-				r.Parameters.NegativePrompt += HeavyNegativeFurry
-			case UCLight:
-				r.Parameters.NegativePrompt += LightNegativeFurry
-			case UCHumanFocus:
-			default:
-			}
-		case ModelV4Full, ModelV4Preview, ModelV3, ModelV3Inp:
-			fallthrough
-		default:
-			switch *r.Parameters.UcPreset {
-			case UCHeavy:
-				r.Parameters.NegativePrompt += HeavyNegative
-			case UCLight:
-				r.Parameters.NegativePrompt += LightNegative
-			case UCHumanFocus:
-				r.Parameters.NegativePrompt += HumanFocusNegative
-			default:
-			}
+		if preset := UCPresetTags(r.Model, *r.Parameters.UcPreset); preset != "" {
+			r.Parameters.NegativePrompt = strings.TrimSuffix(preset+", "+r.Parameters.NegativePrompt, ", ")
 		}
 	}
 
 	switch r.Model {
-	case ModelV4Full, ModelV4Preview:
+	case ModelV45Full, ModelV45Curated, ModelV4Full, ModelV4Preview:
 		r.Parameters.V4Prompt = V4Prompt{
 			Caption: Caption{
 				BaseCaption:  cmp.Or(r.Input, r.Parameters.Prompt),
@@ -297,9 +282,31 @@ func (r *NovelAIRequest) Init() {
 
 	if r.Parameters.Img2Img != nil {
 		r.Parameters.Strength = cmp.Or(r.Parameters.Strength, 0.6)
+		r.Parameters.ClampImg2Img()
 	}
 }
 
+// Size returns the width and height of the image, from the resolution preset if it's set
+func (p *Parameters) Size() (width, height int64) {
+	if preset := p.ResolutionPreset; preset != nil {
+		return preset[0], preset[1]
+	}
+	return p.Width, p.Height
+}
+
+// Img2img strength and noise NovelAI accepts. A strength of 0 would keep the image as it is and 1 ignore it.
+const (
+	MinImg2ImgStrength = 0.01
+	MaxImg2ImgStrength = 0.99
+	MaxImg2ImgNoise    = 0.99
+)
+
+// ClampImg2Img keeps the img2img strength and noise in the range NovelAI accepts
+func (p *Parameters) ClampImg2Img() {
+	p.Strength = min(max(p.Strength, MinImg2ImgStrength), MaxImg2ImgStrength)
+	p.Noise = min(max(p.Noise, 0), MaxImg2ImgNoise)
+}
+
 // Deprecated: Use cmp.Or
 func ifUnset[T interface{ ~float64 | int }](a *T, b T) {
 	if a == nil {
@@ -333,6 +340,8 @@ func (r *NovelAIRequest) GetMaxNSamples() uint8 {
 type models = string
 
 const (
+	ModelV45Full    models = "nai-diffusion-4-5-full"
+	ModelV45Curated models = "nai-diffusion-4-5-curated"
 	ModelV3         models = "nai-diffusion-3"
 	ModelV4Preview  models = "nai-diffusion-4-curated-preview"
 	ModelV4Full     models = "nai-diffusion-4-full"
@@ -422,14 +431,15 @@ const (
 	SamplerEulerAncestral sampler = "k_euler_ancestral"    // Euler Ancestral (recommended for V4)
 	SamplerDPM2SAncestral sampler = "k_dpmpp_2s_ancestral" // DPM++ 2S Ancestral
 	SamplerDPM2M          sampler = "k_dpmpp_2m"           // DPM++ 2M
+	SamplerDPM2MSDE       sampler = "k_dpmpp_2m_sde"       // DPM++ 2M SDE (V4 and later)
 	SamplerDPMSDE         sampler = "k_dpmpp_sde"          // DPM++ SDE
-	SamplerDDIM           sampler = "ddim"                 // DDIM
+	SamplerDDIM           sampler = "ddim_v3"              // DDIM (V3 only)
 )
 
 const (
 	ScheduleDefault = ScheduleKarras
 
-	ScheduleNative          schedule = "native"
+	ScheduleNative          schedule = "native" // (V3 only)
 	ScheduleKarras          schedule = "karras" // (recommended)
 	ScheduleExponential     schedule = "exponential"
 	SchedulePolyexponential schedule = "polyexponential"
@@ -493,6 +503,8 @@ func GetDimensions(option string) resolutionPreset {
 		return ResolutionNormalSquare
 	}
 }
+
+// CalculateCost returns the Anlas the request costs. With opus, one image of up to 1024x1024 and 28 steps is free
 func (r *NovelAIRequest) CalculateCost(opus bool) int64 {
 	steps := r.Parameters.Steps
 	nSamples := r.Parameters.ImageCount
@@ -508,7 +520,8 @@ func (r *NovelAIRequest) CalculateCost(opus bool) int64 {
 		smeaFactor = 1.2
 	}
 
-	resolution := max(r.Parameters.Width*r.Parameters.Height, 65536)
+	width, height := r.Parameters.Size()
+	resolution := max(width*height, 65536)
 	if resolution > ResolutionNormalPortrait[0]*ResolutionNormalPortrait[1] && resolution <= ResolutionNormalSquare[0]*ResolutionNormalSquare[1] {
 		resolution = ResolutionNormalPortrait[0] * ResolutionNormalPortrait[1]
 	}
@@ -520,8 +533,34 @@ func (r *NovelAIRequest) CalculateCost(opus bool) int64 {
 		perSample = int64(math.Ceil(float64(perSample) * 1.3))
 	}
 
-	if opus && steps <= 28 && resolution <= ResolutionNormalSquare[0]*ResolutionNormalSquare[1] {
+	// character reference is paid for every image, even the one Opus makes for free
+	var references int64
+	if len(r.Parameters.DirectorReferenceImages) > 0 {
+		references = CharacterReferenceCost * int64(r.Parameters.ImageCount)
+	}
+
+	if opus && nSamples > 0 && steps <= 28 && resolution <= ResolutionNormalSquare[0]*ResolutionNormalSquare[1] {
 		nSamples -= 1
 	}
-	return perSample * int64(max(1, nSamples))
+	return perSample*int64(nSamples) + references
+}
+
+// CharacterReferenceCost is the Anlas a character reference adds to each image
+const CharacterReferenceCost = 5
+
+// SupportsCharacterReference reports whether model can use a character reference
+func SupportsCharacterReference(model string) bool {
+	return model == ModelV45Full || model == ModelV45Curated
+}
+
+// SetCharacterReference uses image as the character reference of the request. Fidelity from 0 to 1 is how closely
+// the details of the character are kept, beyond its overall look.
+func (r *NovelAIRequest) SetCharacterReference(image *utils.Image, fidelity float64) {
+	r.Parameters.DirectorReferenceImages = []*async{image}
+	r.Parameters.DirectorReferenceDescriptions = []DirectorReferenceDescription{{
+		Caption: Caption{BaseCaption: "character&style", CharCaptions: make([]CharCaption, 0)},
+	}}
+	r.Parameters.DirectorReferenceInformationExtracted = []float64{1}
+	r.Parameters.DirectorReferenceStrengthValues = []float64{1}
+	r.Parameters.DirectorReferenceSecondaryStrengthValues = []float64{1 - min(max(fidelity, 0), 1)}
 }
@@ -0,0 +1,148 @@
+package entities
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Quality tags the official UI appends to the prompt of each model when the quality toggle is on
+const (
+	QualityTagsV45Full    = ", very aesthetic, masterpiece, no text"
+	QualityTagsV45Curated = ", very aesthetic, masterpiece, no text, -0.8::feet::, rating:general"
+	QualityTagsV4Full     = ", no text, best quality, very aesthetic, absurdres"
+	QualityTagsV4Curated  = ", rating:general, amazing quality, very aesthetic, absurdres"
+	QualityTagsV3         = ", best quality, amazing quality, very aesthetic, absurdres"
+	QualityTagsFurryV3    = ", {best quality}, {amazing quality}"
+)
+
+// ucPresets are the undesired content the official UI puts before the negative prompt, by model and preset
+var ucPresets = map[string]map[int64]string{
+	ModelV45Full: {
+		UCHeavy:      "lowres, artistic error, film grain, scan artifacts, worst quality, bad quality, jpeg artifacts, very displeasing, chromatic aberration, dithering, halftone, screentone, multiple views, logo, too many watermarks, negative space, blank page",
+		UCLight:      "lowres, artistic error, scan artifacts, worst quality, bad quality, jpeg artifacts, multiple views, very displeasing, too many watermarks, negative space, blank page",
+		UCHumanFocus: "lowres, artistic error, film grain, scan artifacts, worst quality, bad quality, jpeg artifacts, very displeasing, chromatic aberration, dithering, halftone, screentone, multiple views, logo, too many watermarks, negative space, blank page, @_@, mismatched pupils, glowing eyes, bad anatomy",
+		UCFurryFocus: "{worst quality}, distracting watermark, unfinished, bad quality, {widescreen}, upscale, {sequence}, {{grandfathered content}}, blurred foreground, chromatic aberration, sketch, everyone, [sketch background], simple, [flat colors], ych (character), outline, multiple scenes, [[horror (theme)]], comic",
+	},
+	ModelV45Curated: {
+		UCHeavy:      "blurry, lowres, upscaled, artistic error, film grain, scan artifacts, worst quality, bad quality, jpeg artifacts, very displeasing, chromatic aberration, halftone, multiple views, logo, too many watermarks, negative space, blank page",
+		UCLight:      "blurry, lowres, upscaled, artistic error, scan artifacts, jpeg artifacts, logo, too many watermarks, negative space, blank page",
+		UCHumanFocus: "blurry, lowres, upscaled, artistic error, film grain, scan artifacts, bad anatomy, bad hands, worst quality, bad quality, jpeg artifacts, very displeasing, chromatic aberration, halftone, multiple views, logo, too many watermarks, @_@, mismatched pupils, glowing eyes, negative space, blank page",
+		UCFurryFocus: "{worst quality}, distracting watermark, unfinished, bad quality, {widescreen}, upscale, {sequence}, {{grandfathered content}}, blurred foreground, chromatic aberration, sketch, everyone, [sketch background], simple, [flat colors], ych (character), outline, multiple scenes, [[horror (theme)]], comic",
+	},
+	ModelV4Full: {
+		UCHeavy: "blurry, lowres, error, film grain, scan artifacts, worst quality, bad quality, jpeg artifacts, very displeasing, chromatic aberration, multiple views, logo, too many watermarks, white blank page, blank page",
+		UCLight: "blurry, lowres, error, worst quality, bad quality, jpeg artifacts, very displeasing, white blank page, blank page",
+	},
+	ModelV4Preview: {
+		UCHeavy: "blurry, lowres, error, film grain, scan artifacts, worst quality, bad quality, jpeg artifacts, very displeasing, chromatic aberration, logo, dated, signature, multiple views, gigantic breasts, white blank page, blank page",
+		UCLight: "blurry, lowres, error, worst quality, bad quality, jpeg artifacts, very displeasing, logo, dated, signature, white blank page, blank page",
+	},
+	ModelV3: {
+		UCHeavy:      "lowres, {bad}, error, fewer, extra, missing, worst quality, jpeg artifacts, bad quality, watermark, unfinished, displeasing, chromatic aberration, signature, extra digits, artistic error, username, scan, [abstract]",
+		UCLight:      "lowres, jpeg artifacts, worst quality, watermark, blurry, very displeasing",
+		UCHumanFocus: "lowres, {bad}, error, fewer, extra, missing, worst quality, jpeg artifacts, bad quality, watermark, unfinished, displeasing, chromatic aberration, signature, extra digits, artistic error, username, scan, [abstract], bad anatomy, bad hands, @_@, mismatched pupils, heart-shaped pupils, glowing eyes",
+	},
+	ModelFurryV3: {
+		UCHeavy: "{{worst quality}}, [displeasing], {unusual pupils}, guide lines, {{unfinished}}, {bad}, url, artist name, {{tall image}}, mosaic, {sketch page}, comic panel, impact (font), [dated], {logo}, ych, {what}, {where is your god now}, {distorted text}, repeated text, {floating head}, {1994}, {widescreen}, absolutely everyone, sequence, {compression artifacts}, hard translated, {cropped}, {commissioner name}, unknown text, high contrast",
+		UCLight: "{worst quality}, guide lines, unfinished, bad, url, tall image, widescreen, compression artifacts, unknown text",
+	},
+}
+
+// presetModel returns the model whose presets model uses, as inpainting models share them with their base model
+func presetModel(model string) string {
+	switch model {
+	case "":
+		return ModelV4Full
+	case ModelV3Inp:
+		return ModelV3
+	case MovelFurryV3Inp:
+		return ModelFurryV3
+	default:
+		return model
+	}
+}
+
+// QualityTags returns the tags the official UI appends to the prompt of model when the quality toggle is on
+func QualityTags(model string) string {
+	switch presetModel(model) {
+	case ModelV45Full:
+		return QualityTagsV45Full
+	case ModelV45Curated:
+		return QualityTagsV45Curated
+	case ModelV4Full:
+		return QualityTagsV4Full
+	case ModelV4Preview:
+		return QualityTagsV4Curated
+	case ModelFurryV3:
+		return QualityTagsFurryV3
+	default:
+		return QualityTagsV3
+	}
+}
+
+// UCPresetTags returns the undesired content the official UI puts before the negative prompt for preset with model.
+// It's empty for UCNone and the presets model doesn't have, like UCHumanFocus for V4.
+func UCPresetTags(model string, preset int64) string {
+	presets, ok := ucPresets[presetModel(model)]
+	if !ok {
+		presets = ucPresets[ModelV3]
+	}
+	return presets[preset]
+}
+
+// HasUCPreset reports whether the official UI has preset for model
+func HasUCPreset(model string, preset int64) bool {
+	return preset == UCNone || UCPresetTags(model, preset) != ""
+}
+
+// isV4 reports whether model is V4 or later, which dropped DDIM, the native noise schedule and SMEA
+func isV4(model string) bool {
+	switch presetModel(model) {
+	case ModelV45Full, ModelV45Curated, ModelV4Full, ModelV4Preview:
+		return true
+	default:
+		return false
+	}
+}
+
+// Samplers returns the samplers the official UI offers for model
+func Samplers(model string) []sampler {
+	if isV4(model) {
+		return []sampler{SamplerEuler, SamplerEulerAncestral, SamplerDPM2SAncestral, SamplerDPM2MSDE, SamplerDPM2M, SamplerDPMSDE}
+	}
+	return []sampler{SamplerEuler, SamplerEulerAncestral, SamplerDPM2SAncestral, SamplerDPM2M, SamplerDPMSDE, SamplerDDIM}
+}
+
+// NoiseSchedules returns the noise schedules the official UI offers for model
+func NoiseSchedules(model string) []schedule {
+	if isV4(model) {
+		return []schedule{ScheduleKarras, ScheduleExponential, SchedulePolyexponential}
+	}
+	return []schedule{ScheduleNative, ScheduleKarras, ScheduleExponential, SchedulePolyexponential}
+}
+
+// SupportsSMEA reports whether model can use SMEA and DYN
+func SupportsSMEA(model string) bool {
+	return !isV4(model)
+}
+
+// CheckSampling returns why the sampler, noise schedule or SMEA of p can't be used with model, nil if they can.
+// An empty sampler or noise schedule is left to NovelAI's default.
+func (p *Parameters) CheckSampling(model string) error {
+	if p.Sampler != "" && !slices.Contains(Samplers(model), p.Sampler) {
+		return fmt.Errorf("%s can't use the %s sampler", model, p.Sampler)
+	}
+	if p.NoiseSchedule != "" && !slices.Contains(NoiseSchedules(model), p.NoiseSchedule) {
+		return fmt.Errorf("%s can't use the %s noise schedule", model, p.NoiseSchedule)
+	}
+	if p.Smea || p.SmeaDyn {
+		if !SupportsSMEA(model) {
+			return fmt.Errorf("%s can't use SMEA or DYN", model)
+		}
+		if p.Sampler == SamplerDDIM {
+			return errors.New("SMEA and DYN can't be used with DDIM")
+		}
+	}
+	return nil
+}
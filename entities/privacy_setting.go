@@ -0,0 +1,17 @@
+package entities
+
+import "time"
+
+// Scopes of settings that can be chosen by a member for themselves or by an admin for a guild
+const (
+	SettingScopeMember = "member"
+	SettingScopeGuild  = "guild"
+)
+
+// PrivacySetting is set by a member for their own generations, or by an admin for every generation in a guild
+type PrivacySetting struct {
+	Scope         string    `json:"scope"`
+	ScopeID       string    `json:"scope_id"`
+	StripMetadata bool      `json:"strip_metadata"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
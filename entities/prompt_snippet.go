@@ -0,0 +1,11 @@
+package entities
+
+import "time"
+
+// PromptSnippet is text of a guild that prompts include with {snippet:name}
+type PromptSnippet struct {
+	GuildID   string    `json:"guild_id"`
+	Name      string    `json:"name"`
+	Text      string    `json:"text"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,177 @@
+package entities
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// webUIEmphasis is the weight each () multiplies by and each [] divides by in the WebUI
+	webUIEmphasis = 1.1
+	// novelAIEmphasis is the weight each {} multiplies by and each [] divides by in NovelAI
+	novelAIEmphasis = 1.05
+	// maxNovelAIBrackets keeps a weight of 0 or less from nesting forever
+	maxNovelAIBrackets = 20
+)
+
+// weightedText is a part of a prompt and the weight it's given
+type weightedText struct {
+	text   string
+	weight float64
+}
+
+// webUIAttention matches the tokens of the WebUI attention syntax, as in its prompt_parser
+var webUIAttention = regexp.MustCompile(`\\\(|\\\)|\\\[|\\]|\\\\|\\|\(|\[|:\s*([+-]?[.\d]+)\s*\)|\)|]|[^\\()\[\]:]+|:`)
+
+// extraNetworkRegex matches the WebUI's <lora:name:weight> and similar tags, which NovelAI would read as text
+var extraNetworkRegex = regexp.MustCompile(`<[a-z]+:[^>]*>`)
+
+// NovelAIWeights converts the WebUI's (word:1.3), (word) and [word] weights in prompt to NovelAI's {} and [], the
+// nearest number of brackets to the same weight. LoRA and other extra network tags are removed.
+func NovelAIWeights(prompt string) string {
+	var b strings.Builder
+	for _, part := range parseWebUIAttention(extraNetworkRegex.ReplaceAllString(prompt, "")) {
+		brackets := maxNovelAIBrackets
+		if part.weight > 0 {
+			brackets = int(math.Round(math.Abs(math.Log(part.weight) / math.Log(novelAIEmphasis))))
+		}
+		brackets = min(brackets, maxNovelAIBrackets)
+		open, close := "{", "}"
+		if part.weight < 1 {
+			open, close = "[", "]"
+		}
+		b.WriteString(strings.Repeat(open, brackets))
+		b.WriteString(part.text)
+		b.WriteString(strings.Repeat(close, brackets))
+	}
+	return b.String()
+}
+
+// WebUIWeights converts NovelAI's {} and [] weights in prompt to the WebUI's (word:1.16), escaping the parentheses
+// and brackets the WebUI would otherwise read as weights
+func WebUIWeights(prompt string) string {
+	var b strings.Builder
+	for _, part := range parseNovelAIBrackets(prompt) {
+		text := escapeWebUIAttention(part.text)
+		if part.weight == 1 {
+			b.WriteString(text)
+			continue
+		}
+		// keep the spaces around the weighted text outside of it
+		trimmed := strings.TrimSpace(text)
+		if trimmed == "" {
+			b.WriteString(text)
+			continue
+		}
+		start := strings.Index(text, trimmed)
+		b.WriteString(text[:start])
+		b.WriteString("(" + trimmed + ":" + strconv.FormatFloat(math.Round(part.weight*100)/100, 'f', -1, 64) + ")")
+		b.WriteString(text[start+len(trimmed):])
+	}
+	return b.String()
+}
+
+// parseWebUIAttention splits prompt into the parts with the same weight, following the WebUI's
+// parse_prompt_attention. Unclosed parentheses and brackets weigh the rest of the prompt.
+func parseWebUIAttention(prompt string) []weightedText {
+	var parts []weightedText
+	var round, square []int
+	multiply := func(start int, weight float64) {
+		for i := start; i < len(parts); i++ {
+			parts[i].weight *= weight
+		}
+	}
+
+	for _, match := range webUIAttention.FindAllStringSubmatch(prompt, -1) {
+		token, weight := match[0], match[1]
+		switch {
+		case strings.HasPrefix(token, `\`) && len(token) > 1:
+			parts = append(parts, weightedText{token[1:], 1})
+		case token == "(":
+			round = append(round, len(parts))
+		case token == "[":
+			square = append(square, len(parts))
+		case weight != "" && len(round) > 0:
+			value, err := strconv.ParseFloat(weight, 64)
+			if err != nil {
+				value = webUIEmphasis
+			}
+			multiply(round[len(round)-1], value)
+			round = round[:len(round)-1]
+		case token == ")" && len(round) > 0:
+			multiply(round[len(round)-1], webUIEmphasis)
+			round = round[:len(round)-1]
+		case token == "]" && len(square) > 0:
+			multiply(square[len(square)-1], 1/webUIEmphasis)
+			square = square[:len(square)-1]
+		default:
+			parts = append(parts, weightedText{token, 1})
+		}
+	}
+	for _, start := range round {
+		multiply(start, webUIEmphasis)
+	}
+	for _, start := range square {
+		multiply(start, 1/webUIEmphasis)
+	}
+
+	return mergeWeights(parts)
+}
+
+// parseNovelAIBrackets splits prompt into the parts with the same weight. Unclosed brackets weigh the rest of the
+// prompt and unmatched closing ones are left out, as NovelAI does.
+func parseNovelAIBrackets(prompt string) []weightedText {
+	var parts []weightedText
+	var curly, square int
+	start := 0
+	flush := func(end int) {
+		if end > start {
+			weight := math.Pow(novelAIEmphasis, float64(curly-square))
+			parts = append(parts, weightedText{prompt[start:end], weight})
+		}
+	}
+
+	for i, r := range prompt {
+		switch r {
+		case '{', '}', '[', ']':
+		default:
+			continue
+		}
+		flush(i)
+		start = i + 1
+		switch {
+		case r == '{':
+			curly++
+		case r == '}' && curly > 0:
+			curly--
+		case r == '[':
+			square++
+		case r == ']' && square > 0:
+			square--
+		}
+	}
+	flush(len(prompt))
+
+	return mergeWeights(parts)
+}
+
+// mergeWeights joins neighbouring parts of the same weight
+func mergeWeights(parts []weightedText) []weightedText {
+	var merged []weightedText
+	for _, part := range parts {
+		if last := len(merged) - 1; last >= 0 && math.Abs(merged[last].weight-part.weight) < 1e-9 {
+			merged[last].text += part.text
+			continue
+		}
+		merged = append(merged, part)
+	}
+	return merged
+}
+
+var webUIEscaper = strings.NewReplacer(`\`, `\\`, `(`, `\(`, `)`, `\)`, `[`, `\[`, `]`, `\]`)
+
+func escapeWebUIAttention(text string) string {
+	return webUIEscaper.Replace(text)
+}
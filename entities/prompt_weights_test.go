@@ -0,0 +1,44 @@
+package entities
+
+import "testing"
+
+func TestNovelAIWeights(t *testing.T) {
+	tests := []struct {
+		prompt string
+		want   string
+	}{
+		{"1girl, solo", "1girl, solo"},
+		{"(blue eyes:1.3), hair", "{{{{{blue eyes}}}}}, hair"},
+		{"(smile), [hat]", "{{smile}}, [[hat]]"},
+		{"((smile))", "{{{{smile}}}}"},
+		{"(smile:0.9)", "[[smile]]"},
+		{`\(cat\)`, "(cat)"},
+		{"1girl <lora:style:0.8>, solo", "1girl , solo"},
+		{"(unclosed", "{{unclosed}}"},
+	}
+	for _, test := range tests {
+		if got := NovelAIWeights(test.prompt); got != test.want {
+			t.Errorf("NovelAIWeights(%q) = %q, want %q", test.prompt, got, test.want)
+		}
+	}
+}
+
+func TestWebUIWeights(t *testing.T) {
+	tests := []struct {
+		prompt string
+		want   string
+	}{
+		{"1girl, solo", "1girl, solo"},
+		{"{blue eyes}, hair", "(blue eyes:1.05), hair"},
+		{"{{{{{blue eyes}}}}}, [hat]", "(blue eyes:1.28), (hat:0.95)"},
+		{"{ smile }", " (smile:1.05) "},
+		{"{smile [hat]}", "(smile:1.05) hat"},
+		{"(cat)", `\(cat\)`},
+		{"hat]", "hat"},
+	}
+	for _, test := range tests {
+		if got := WebUIWeights(test.prompt); got != test.want {
+			t.Errorf("WebUIWeights(%q) = %q, want %q", test.prompt, got, test.want)
+		}
+	}
+}
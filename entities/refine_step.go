@@ -0,0 +1,17 @@
+package entities
+
+import "time"
+
+// RefineStep is a generation made by refining an image of another one with img2img. The steps refined from the same
+// generation make up a chain that starts at RootMessageID.
+type RefineStep struct {
+	MessageID         string    `json:"message_id"`
+	GuildID           string    `json:"guild_id"`
+	ChannelID         string    `json:"channel_id"`
+	ParentMessageID   string    `json:"parent_message_id"`
+	ParentSortOrder   int       `json:"parent_sort_order"`
+	RootMessageID     string    `json:"root_message_id"`
+	Step              int       `json:"step"`
+	DenoisingStrength float64   `json:"denoising_strength"`
+	CreatedAt         time.Time `json:"created_at"`
+}
@@ -1,9 +1,72 @@
 package entities
 
+import (
+	"encoding/json"
+	"strings"
+)
+
 type Scripts struct {
 	ADetailer  *ADetailer  `json:"ADetailer,omitempty"`
 	ControlNet *ControlNet `json:"ControlNet,omitempty"`
 	CFGRescale *CFGRescale `json:"CFG Rescale Extension,omitempty"`
+	// Extensions are the scripts of other extensions by their title, kept as they were given
+	Extensions map[string]json.RawMessage `json:"-"`
+}
+
+// typedScripts are the titles of the scripts with a field in Scripts
+var typedScripts = []string{"ADetailer", "ControlNet", "CFG Rescale Extension"}
+
+func isTypedScript(title string) bool {
+	for _, typed := range typedScripts {
+		// encoding/json matches field names ignoring case
+		if strings.EqualFold(typed, title) {
+			return true
+		}
+	}
+	return false
+}
+
+// MarshalJSON writes the typed scripts alongside the extensions, the typed field wins if both have the same title
+func (s Scripts) MarshalJSON() ([]byte, error) {
+	type plain Scripts
+	typed, err := json.Marshal(plain(s))
+	if err != nil || len(s.Extensions) == 0 {
+		return typed, err
+	}
+
+	scripts := make(map[string]json.RawMessage, len(s.Extensions)+len(typedScripts))
+	for title, args := range s.Extensions {
+		scripts[title] = args
+	}
+	if err := json.Unmarshal(typed, &scripts); err != nil {
+		return nil, err
+	}
+	return json.Marshal(scripts)
+}
+
+// UnmarshalJSON fills the typed scripts and keeps every other script in Extensions. Typed scripts that are already
+// set and missing from data are kept.
+func (s *Scripts) UnmarshalJSON(data []byte) error {
+	type plain Scripts
+	if err := json.Unmarshal(data, (*plain)(s)); err != nil {
+		return err
+	}
+
+	var scripts map[string]json.RawMessage
+	if err := json.Unmarshal(data, &scripts); err != nil {
+		return err
+	}
+	s.Extensions = nil
+	for title, args := range scripts {
+		if isTypedScript(title) {
+			continue
+		}
+		if s.Extensions == nil {
+			s.Extensions = make(map[string]json.RawMessage)
+		}
+		s.Extensions[title] = args
+	}
+	return nil
 }
 
 // Deprecated: use ImageGenerationRequest.NewScripts() instead
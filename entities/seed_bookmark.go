@@ -0,0 +1,11 @@
+package entities
+
+import "time"
+
+// SeedBookmark is a seed a member saved under a name to reuse in /imagine with seed:name:<name>
+type SeedBookmark struct {
+	MemberID  string    `json:"member_id"`
+	Name      string    `json:"name"`
+	Seed      int64     `json:"seed"`
+	CreatedAt time.Time `json:"created_at"`
+}
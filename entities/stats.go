@@ -0,0 +1,7 @@
+package entities
+
+// StatsEntry is a row of a leaderboard, keyed by member ID or checkpoint name
+type StatsEntry struct {
+	Key    string `json:"key"`
+	Images int    `json:"images"`
+}
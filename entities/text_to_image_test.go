@@ -0,0 +1,148 @@
+package entities
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// txt2imgProperties are the properties of StableDiffusionProcessingTxt2Img in the A1111 API schema
+var txt2imgProperties = []string{
+	"prompt", "negative_prompt", "styles", "seed", "subseed", "subseed_strength", "seed_resize_from_h",
+	"seed_resize_from_w", "sampler_name", "scheduler", "batch_size", "n_iter", "steps", "cfg_scale", "width",
+	"height", "restore_faces", "tiling", "do_not_save_samples", "do_not_save_grid", "eta", "denoising_strength",
+	"s_min_uncond", "s_churn", "s_tmax", "s_tmin", "s_noise", "override_settings",
+	"override_settings_restore_afterwards", "refiner_checkpoint", "refiner_switch_at", "disable_extra_networks",
+	"comments", "enable_hr", "firstphase_width", "firstphase_height", "hr_scale", "hr_upscaler",
+	"hr_second_pass_steps", "hr_resize_x", "hr_resize_y", "hr_checkpoint_name", "hr_sampler_name", "hr_scheduler",
+	"hr_prompt", "hr_negative_prompt", "force_task_id", "sampler_index", "script_name", "script_args",
+	"send_images", "save_images", "alwayson_scripts", "infotext",
+}
+
+func jsonFields(t reflect.Type) map[string]bool {
+	fields := make(map[string]bool, t.NumField())
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			fields[name] = true
+		}
+	}
+	return fields
+}
+
+func TestTextToImageRequestFields(t *testing.T) {
+	fields := jsonFields(reflect.TypeFor[TextToImageRequest]())
+	for _, property := range txt2imgProperties {
+		if !fields[property] {
+			t.Errorf("TextToImageRequest is missing %q", property)
+		}
+	}
+}
+
+const fullTextToImageRequest = `{
+	"alwayson_scripts": {},
+	"batch_size": 2,
+	"cfg_scale": 7.5,
+	"comments": {"note": "round trip", "count": 1},
+	"denoising_strength": 0.4,
+	"disable_extra_networks": true,
+	"do_not_save_grid": true,
+	"do_not_save_samples": true,
+	"enable_hr": true,
+	"eta": 0.67,
+	"firstphase_height": 512,
+	"firstphase_width": 512,
+	"force_task_id": "task(abc)",
+	"height": 768,
+	"hr_checkpoint_name": "model.safetensors",
+	"hr_negative_prompt": "blurry",
+	"hr_prompt": "a cat, detailed",
+	"hr_resize_x": 1024,
+	"hr_resize_y": 1536,
+	"hr_sampler_name": "Euler a",
+	"hr_scale": 2,
+	"hr_scheduler": "Karras",
+	"hr_second_pass_steps": 10,
+	"hr_upscaler": "Latent",
+	"infotext": "a cat\nSteps: 20",
+	"n_iter": 3,
+	"negative_prompt": "blurry",
+	"override_settings": {},
+	"override_settings_restore_afterwards": false,
+	"prompt": "a cat",
+	"refiner_checkpoint": "refiner.safetensors",
+	"refiner_switch_at": 0.8,
+	"restore_faces": true,
+	"s_churn": 0.1,
+	"s_min_uncond": 0.2,
+	"s_noise": 1.003,
+	"s_tmax": 10,
+	"s_tmin": 0.05,
+	"sampler_index": "Euler",
+	"sampler_name": "DPM++ 2M",
+	"save_images": true,
+	"scheduler": "Karras",
+	"script_args": [1, "two", true],
+	"script_name": "x/y/z plot",
+	"seed": 1234,
+	"seed_resize_from_h": 512,
+	"seed_resize_from_w": 512,
+	"send_images": true,
+	"steps": 20,
+	"styles": ["style one", "style two"],
+	"subseed": 5678,
+	"subseed_strength": 0.3,
+	"tiling": false,
+	"width": 512
+}`
+
+func TestTextToImageRequestRoundTrip(t *testing.T) {
+	request, err := UnmarshalTextToImageRequest([]byte(fullTextToImageRequest))
+	if err != nil {
+		t.Fatalf("error unmarshalling request: %v", err)
+	}
+
+	marshalled, err := request.Marshal()
+	if err != nil {
+		t.Fatalf("error marshalling request: %v", err)
+	}
+
+	var want, got map[string]any
+	if err := json.Unmarshal([]byte(fullTextToImageRequest), &want); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(marshalled, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	for key, value := range want {
+		if !reflect.DeepEqual(got[key], value) {
+			t.Errorf("%s = %v after a round trip, want %v", key, got[key], value)
+		}
+	}
+	for key := range got {
+		if _, ok := want[key]; !ok {
+			t.Errorf("unexpected %s = %v after a round trip", key, got[key])
+		}
+	}
+}
+
+func TestTextToImageRawKeepsFields(t *testing.T) {
+	raw, err := UnmarshalTextToImageRaw([]byte(fullTextToImageRequest))
+	if err != nil {
+		t.Fatalf("error unmarshalling raw request: %v", err)
+	}
+	if raw.TextToImageRequest == nil {
+		t.Fatal("raw request has no TextToImageRequest")
+	}
+	if raw.Scheduler == nil || *raw.Scheduler != "Karras" {
+		t.Errorf("scheduler = %v, want Karras", raw.Scheduler)
+	}
+	if raw.Eta == nil || *raw.Eta != 0.67 {
+		t.Errorf("eta = %v, want 0.67", raw.Eta)
+	}
+	if len(raw.Styles) != 2 {
+		t.Errorf("styles = %v, want 2 styles", raw.Styles)
+	}
+}
@@ -0,0 +1,42 @@
+package entities
+
+import "math"
+
+// Usage is the aggregated cost of a member's generations for a single day and backend
+type Usage struct {
+	MemberID   string  `json:"member_id"`
+	Day        string  `json:"day"` // UTC, formatted as 2006-01-02
+	Backend    string  `json:"backend"`
+	Images     int     `json:"images"`
+	Megapixels float64 `json:"megapixels"`
+	GPUSeconds float64 `json:"gpu_seconds"`
+	Anlas      int64   `json:"anlas"`
+}
+
+const (
+	BackendStableDiffusion = "stable_diffusion"
+	BackendNovelAI         = "novelai"
+)
+
+// AnlasBudget is the Anlas each member can spend on NovelAI in a UTC day and month. Zero doesn't limit them
+type AnlasBudget struct {
+	Daily   int64 `json:"daily,omitempty"`
+	Monthly int64 `json:"monthly,omitempty"`
+}
+
+// Limited reports whether either budget is set
+func (b AnlasBudget) Limited() bool {
+	return b.Daily > 0 || b.Monthly > 0
+}
+
+// Remaining returns the Anlas left after spending today and month, the smaller of the two budgets that are set
+func (b AnlasBudget) Remaining(today, month int64) int64 {
+	remaining := int64(math.MaxInt64)
+	if b.Daily > 0 {
+		remaining = min(remaining, b.Daily-today)
+	}
+	if b.Monthly > 0 {
+		remaining = min(remaining, b.Monthly-month)
+	}
+	return max(remaining, 0)
+}
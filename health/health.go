@@ -0,0 +1,133 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// backendTimeout bounds the backend check so a hung API can't stall a probe
+	backendTimeout = 3 * time.Second
+	// backendCacheTTL reuses the last backend check so frequent probes don't add load to the API
+	backendCacheTTL = 5 * time.Second
+)
+
+type Config struct {
+	// Addr to listen on, e.g. :8080
+	Addr string
+	// Gateway reports whether the bot is connected to Discord
+	Gateway func() bool
+	// BackendHost returns the host of the Stable Diffusion API
+	BackendHost func() string
+	// Queue returns a snapshot of the queue, it's reported as is
+	Queue func() any
+	// Transport reaches the backend, e.g. through its proxy. Default is http.DefaultTransport
+	Transport http.RoundTripper
+}
+
+// Report is the body of /healthz
+type Report struct {
+	Status  string `json:"status"`
+	Gateway bool   `json:"gateway"`
+	Backend bool   `json:"backend"`
+	Queue   any    `json:"queue,omitempty"`
+	Checked string `json:"checked"`
+}
+
+type server struct {
+	cfg    Config
+	client *http.Client
+
+	mu          sync.Mutex
+	backend     bool
+	backendHost string
+	checkedAt   time.Time
+}
+
+// Serve serves /healthz and /livez on cfg.Addr until ctx is done.
+// /healthz answers 503 while Discord or the backend is down and is meant for readiness probes.
+// /livez answers 200 as long as the process serves requests and is meant for liveness probes, since the gateway
+// reconnects on its own and a down backend isn't fixed by restarting the bot.
+func Serve(ctx context.Context, cfg Config) error {
+	if cfg.Addr == "" {
+		return errors.New("missing health address")
+	}
+	if cfg.Gateway == nil || cfg.BackendHost == nil {
+		return errors.New("missing health checks")
+	}
+
+	s := &server{cfg: cfg, client: &http.Client{Timeout: backendTimeout, Transport: cfg.Transport}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", s.healthz)
+	mux.HandleFunc("GET /livez", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	srv := &http.Server{Addr: cfg.Addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdown)
+	}()
+
+	log.Printf("Serving health checks on %s", cfg.Addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s *server) healthz(w http.ResponseWriter, r *http.Request) {
+	report := Report{
+		Gateway: s.cfg.Gateway(),
+		Backend: s.backendAlive(r.Context()),
+		Checked: time.Now().UTC().Format(time.RFC3339),
+	}
+	if s.cfg.Queue != nil {
+		report.Queue = s.cfg.Queue()
+	}
+
+	status := http.StatusOK
+	report.Status = "ok"
+	if !report.Gateway || !report.Backend {
+		status = http.StatusServiceUnavailable
+		report.Status = "unavailable"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		log.Printf("Error writing health report: %v", err)
+	}
+}
+
+// backendAlive checks the API like handlers.CheckAPIAlive, with a timeout and reusing recent results
+func (s *server) backendAlive(ctx context.Context) bool {
+	host := s.cfg.BackendHost()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if host == s.backendHost && time.Since(s.checkedAt) < backendCacheTTL {
+		return s.backend
+	}
+
+	alive := false
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, host, nil)
+	if err == nil {
+		resp, err := s.client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+			alive = resp.StatusCode == http.StatusOK
+		}
+	}
+
+	s.backend, s.backendHost, s.checkedAt = alive, host, time.Now()
+	return alive
+}
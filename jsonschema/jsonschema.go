@@ -0,0 +1,295 @@
+// Package jsonschema generates a JSON Schema from the json tags of a struct and validates documents against it,
+// reporting every unknown field and wrong type with its path
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/sahilm/fuzzy"
+)
+
+const draft = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema is the subset of JSON Schema needed to describe Go types
+type Schema struct {
+	Title      string             `json:"title,omitempty"`
+	Types      []string           `json:"-"`
+	Properties map[string]*Schema `json:"properties,omitempty"`
+	Items      *Schema            `json:"items,omitempty"`
+	// Values is the schema of the values of maps
+	Values *Schema `json:"-"`
+	// Closed rejects properties that aren't listed
+	Closed bool `json:"-"`
+
+	root bool
+}
+
+func (s *Schema) MarshalJSON() ([]byte, error) {
+	type plain Schema
+	out := struct {
+		Draft string `json:"$schema,omitempty"`
+		Type  any    `json:"type,omitempty"`
+		*plain
+		AdditionalProperties any `json:"additionalProperties,omitempty"`
+	}{plain: (*plain)(s)}
+
+	if s.root {
+		out.Draft = draft
+	}
+	switch len(s.Types) {
+	case 0:
+	case 1:
+		out.Type = s.Types[0]
+	default:
+		out.Type = s.Types
+	}
+	if s.Values != nil {
+		out.AdditionalProperties = s.Values
+	} else if s.Closed {
+		out.AdditionalProperties = false
+	}
+	return json.Marshal(out)
+}
+
+// Generate describes t from its json tags like encoding/json would marshal it. Only the top level object is closed,
+// nested objects accept properties they don't list so they keep up with the backend.
+func Generate(t reflect.Type) *Schema {
+	schema := generate(t, make(map[reflect.Type]bool))
+	schema.root = true
+	schema.Closed = schema.Properties != nil
+	return schema
+}
+
+func generate(t reflect.Type, seen map[reflect.Type]bool) *Schema {
+	nullable := false
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+		nullable = true
+	}
+
+	schema := new(Schema)
+	switch t.Kind() {
+	case reflect.Bool:
+		schema.Types = []string{"boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		schema.Types = []string{"integer"}
+	case reflect.Float32, reflect.Float64:
+		schema.Types = []string{"number"}
+	case reflect.String:
+		schema.Types = []string{"string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// encoding/json encodes []byte as base64
+			schema.Types = []string{"string"}
+		} else {
+			schema.Types = []string{"array"}
+			schema.Items = generate(t.Elem(), seen)
+		}
+		nullable = nullable || t.Kind() == reflect.Slice
+	case reflect.Map:
+		schema.Types = []string{"object"}
+		schema.Values = generate(t.Elem(), seen)
+		nullable = true
+	case reflect.Struct:
+		schema.Types = []string{"object"}
+		if seen[t] {
+			return schema
+		}
+		seen[t] = true
+		schema.Properties = make(map[string]*Schema)
+		addFields(schema, t, seen)
+		delete(seen, t)
+	default:
+		// interfaces and anything else accept any value
+		return schema
+	}
+
+	if nullable {
+		schema.Types = append(schema.Types, "null")
+	}
+	return schema
+}
+
+// addFields adds the fields of t, then those of its embedded structs that aren't shadowed by a shallower field
+func addFields(schema *Schema, t reflect.Type, seen map[reflect.Type]bool) {
+	var embedded []reflect.Type
+	for i := range t.NumField() {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			fieldType := field.Type
+			if fieldType.Kind() == reflect.Pointer {
+				fieldType = fieldType.Elem()
+			}
+			if fieldType.Kind() == reflect.Struct {
+				embedded = append(embedded, fieldType)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if _, ok := schema.Properties[name]; !ok {
+			schema.Properties[name] = generate(field.Type, seen)
+		}
+	}
+
+	for _, fieldType := range embedded {
+		addFields(schema, fieldType, seen)
+	}
+}
+
+// Validate returns the problems of the JSON document, e.g. "unknown field `stpes`, did you mean `steps`?" or
+// "`steps` should be integer, not string"
+func (s *Schema) Validate(data []byte) []string {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return []string{fmt.Sprintf("invalid JSON: %v", err)}
+	}
+
+	var problems []string
+	s.validate("", value, &problems)
+	return problems
+}
+
+func (s *Schema) validate(path string, value any, problems *[]string) {
+	if len(s.Types) == 0 {
+		return
+	}
+
+	kind := kindOf(value)
+	if !s.accepts(kind) {
+		*problems = append(*problems, fmt.Sprintf("`%s` should be %s, not %s", displayPath(path), strings.Join(s.Types, " or "), kind))
+		return
+	}
+
+	switch value := value.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+
+		for _, key := range keys {
+			child := key
+			if path != "" {
+				child = path + "." + key
+			}
+			switch property, ok := s.Properties[key]; {
+			case ok:
+				property.validate(child, value[key], problems)
+			case s.Values != nil:
+				s.Values.validate(child, value[key], problems)
+			case s.Closed:
+				*problems = append(*problems, s.unknown(child, key))
+			}
+		}
+	case []any:
+		if s.Items == nil {
+			return
+		}
+		for i, item := range value {
+			s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, problems)
+		}
+	}
+}
+
+func (s *Schema) accepts(kind string) bool {
+	return slices.Contains(s.Types, kind) || kind == "integer" && slices.Contains(s.Types, "number")
+}
+
+// unknown reports a field that isn't a property, suggesting the closest property
+func (s *Schema) unknown(path, key string) string {
+	names := make([]string, 0, len(s.Properties))
+	for name := range s.Properties {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	if matches := fuzzy.Find(key, names); len(matches) > 0 {
+		return fmt.Sprintf("unknown field `%s`, did you mean `%s`?", path, matches[0].Str)
+	}
+	normalized := strings.ToLower(strings.ReplaceAll(key, "_", ""))
+	closest, best := "", maxTypos+1
+	for _, name := range names {
+		if distance := typos(strings.ToLower(strings.ReplaceAll(name, "_", "")), normalized); distance < best {
+			closest, best = name, distance
+		}
+	}
+	if closest != "" {
+		return fmt.Sprintf("unknown field `%s`, did you mean `%s`?", path, closest)
+	}
+	return fmt.Sprintf("unknown field `%s`", path)
+}
+
+// maxTypos is how many typos a field can have to still be suggested
+const maxTypos = 2
+
+// typos counts the insertions, deletions, substitutions and swaps of adjacent letters between a and b
+func typos(a, b string) int {
+	x, y := []rune(a), []rune(b)
+	rows := make([][]int, len(x)+1)
+	for i := range rows {
+		rows[i] = make([]int, len(y)+1)
+		rows[i][0] = i
+	}
+	for j := range rows[0] {
+		rows[0][j] = j
+	}
+	for i := 1; i <= len(x); i++ {
+		for j := 1; j <= len(y); j++ {
+			cost := 1
+			if x[i-1] == y[j-1] {
+				cost = 0
+			}
+			rows[i][j] = min(rows[i-1][j]+1, rows[i][j-1]+1, rows[i-1][j-1]+cost)
+			if i > 1 && j > 1 && x[i-1] == y[j-2] && x[i-2] == y[j-1] {
+				rows[i][j] = min(rows[i][j], rows[i-2][j-2]+1)
+			}
+		}
+	}
+	return rows[len(x)][len(y)]
+}
+
+func kindOf(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		if strings.ContainsAny(value.String(), ".eE") {
+			return "number"
+		}
+		return "integer"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+func displayPath(path string) string {
+	if path == "" {
+		return "the request"
+	}
+	return path
+}
@@ -0,0 +1,65 @@
+package logging
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+)
+
+// maxCaptureSize bounds a capture so a chatty generation can't grow it without limit, the first lines are kept
+const maxCaptureSize = 64 << 10
+
+// Capture collects the log lines of one generation, to attach to its error report. Only the lines logged through
+// the capture are collected, so generations running at the same time don't end up in each other's reports.
+type Capture struct {
+	logger *log.Logger
+
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	stopped bool
+}
+
+// StartCapture returns a capture that logs to the standard logger and collects the lines until Stop is called.
+// It needs Setup to have been called so the lines still reach the log file.
+func StartCapture() *Capture {
+	c := &Capture{}
+	c.logger = log.New(io.MultiWriter(log.Writer(), c), log.Prefix(), log.Flags())
+	return c
+}
+
+func (c *Capture) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if room := maxCaptureSize - c.buf.Len(); !c.stopped && room > 0 {
+		c.buf.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
+
+// Printf logs like log.Printf and collects the line. A nil capture only logs.
+func (c *Capture) Printf(format string, v ...any) {
+	if c == nil {
+		log.Output(2, fmt.Sprintf(format, v...))
+		return
+	}
+	c.logger.Output(2, fmt.Sprintf(format, v...))
+}
+
+// Println logs like log.Println and collects the line. A nil capture only logs.
+func (c *Capture) Println(v ...any) {
+	if c == nil {
+		log.Output(2, fmt.Sprintln(v...))
+		return
+	}
+	c.logger.Output(2, fmt.Sprintln(v...))
+}
+
+// Stop ends the capture and returns the collected lines. Lines logged afterwards still reach the standard logger.
+func (c *Capture) Stop() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stopped = true
+	return c.buf.String()
+}
@@ -0,0 +1,24 @@
+package logging
+
+import (
+	"io"
+	"log"
+	"os"
+)
+
+// Setup sends the standard logger to stderr and to the rotating file at path if set.
+// The returned closer closes the log file.
+func Setup(path string, opts RotateOptions) (io.Closer, error) {
+	writers := []io.Writer{os.Stderr}
+	var closer io.Closer = io.NopCloser(nil)
+	if path != "" {
+		file, err := NewRotatingFile(path, opts)
+		if err != nil {
+			return nil, err
+		}
+		writers = append(writers, file)
+		closer = file
+	}
+	log.SetOutput(io.MultiWriter(writers...))
+	return closer, nil
+}
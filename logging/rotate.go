@@ -0,0 +1,144 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat is appended to the name of rotated files, sortable and safe on every filesystem
+const backupTimeFormat = "2006-01-02T15-04-05"
+
+// RotateOptions configures NewRotatingFile.
+type RotateOptions struct {
+	// MaxSize rotates the file before it grows past this many bytes. Default is 10 MiB
+	MaxSize int64
+	// MaxAge rotates the file once it's been written to for this long. Default is never
+	MaxAge time.Duration
+	// MaxBackups is how many rotated files are kept, the oldest are deleted. Default is 5
+	MaxBackups int
+}
+
+// RotatingFile is a log file that is renamed with a timestamp and started over when it gets too large or too old.
+type RotatingFile struct {
+	mu       sync.Mutex
+	path     string
+	opts     RotateOptions
+	file     *os.File
+	size     int64
+	openedAt time.Time
+}
+
+// NewRotatingFile opens or creates the log file at path, appending to it
+func NewRotatingFile(path string, opts RotateOptions) (*RotatingFile, error) {
+	if path == "" {
+		return nil, errors.New("missing log file path")
+	}
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = 10 << 20
+	}
+	if opts.MaxBackups <= 0 {
+		opts.MaxBackups = 5
+	}
+
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+
+	r := &RotatingFile{path: path, opts: opts}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RotatingFile) open() error {
+	file, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	r.file, r.size, r.openedAt = file, info.Size(), info.ModTime()
+	if r.size == 0 {
+		r.openedAt = time.Now()
+	}
+	return nil
+}
+
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	tooLarge := r.size > 0 && r.size+int64(len(p)) > r.opts.MaxSize
+	tooOld := r.opts.MaxAge > 0 && time.Since(r.openedAt) > r.opts.MaxAge
+	if tooLarge || tooOld {
+		if err := r.rotate(); err != nil {
+			// keep logging to the current file rather than losing lines
+			fmt.Fprintf(os.Stderr, "Error rotating log file %s: %v\n", r.path, err)
+		}
+	}
+
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// rotate renames the current file with the time it was rotated and opens a new one
+func (r *RotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	backup := fmt.Sprintf("%s.%s", r.path, time.Now().Format(backupTimeFormat))
+	if err := os.Rename(r.path, backup); err != nil {
+		return errors.Join(err, r.open())
+	}
+	if err := r.open(); err != nil {
+		return err
+	}
+	return r.prune()
+}
+
+// prune deletes the oldest rotated files beyond MaxBackups
+func (r *RotatingFile) prune() error {
+	backups, err := filepath.Glob(r.path + ".*")
+	if err != nil {
+		return err
+	}
+	backups = slices.DeleteFunc(backups, func(name string) bool {
+		_, err := time.Parse(backupTimeFormat, strings.TrimPrefix(name, r.path+"."))
+		return err != nil
+	})
+	slices.Sort(backups)
+
+	var errs []error
+	for len(backups) > r.opts.MaxBackups {
+		errs = append(errs, os.Remove(backups[0]))
+		backups = backups[1:]
+	}
+	return errors.Join(errs...)
+}
+
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return os.ErrClosed
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
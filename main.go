@@ -2,180 +2,264 @@ package main
 
 import (
 	"context"
-	"flag"
+	"database/sql"
+	"fmt"
 	"log"
+	"net/http"
 	"net/url"
 	"os"
 	"strings"
+	"time"
 
+	"stable_diffusion_bot/admin"
+	novelaiapi "stable_diffusion_bot/api/novelai"
 	"stable_diffusion_bot/api/stable_diffusion_api"
+	"stable_diffusion_bot/audit"
+	"stable_diffusion_bot/composite_renderer"
+	"stable_diffusion_bot/config"
 	"stable_diffusion_bot/databases/sqlite"
+	"stable_diffusion_bot/diagnostics"
 	"stable_diffusion_bot/discord_bot"
 	"stable_diffusion_bot/discord_bot/handlers"
+	"stable_diffusion_bot/entities"
+	"stable_diffusion_bot/health"
+	"stable_diffusion_bot/logging"
+	"stable_diffusion_bot/queue"
 	"stable_diffusion_bot/queue/llm"
 	"stable_diffusion_bot/queue/novelai"
 	"stable_diffusion_bot/queue/stable_diffusion"
+	"stable_diffusion_bot/reporting"
+	"stable_diffusion_bot/repositories/channel_defaults"
 	"stable_diffusion_bot/repositories/default_settings"
+	"stable_diffusion_bot/repositories/deleted_messages"
+	"stable_diffusion_bot/repositories/failed_generations"
+	"stable_diffusion_bot/repositories/guild_quiet_hours"
+	"stable_diffusion_bot/repositories/guild_watermarks"
 	"stable_diffusion_bot/repositories/image_generations"
-
+	"stable_diffusion_bot/repositories/layout_settings"
+	"stable_diffusion_bot/repositories/member_loras"
+	"stable_diffusion_bot/repositories/privacy_settings"
+	"stable_diffusion_bot/repositories/prompt_snippets"
+	"stable_diffusion_bot/repositories/refine_steps"
+	"stable_diffusion_bot/repositories/seed_bookmarks"
+	"stable_diffusion_bot/repositories/stats"
+	"stable_diffusion_bot/repositories/usage"
+	"stable_diffusion_bot/utils"
+	"stable_diffusion_bot/version"
+
+	"github.com/bwmarrin/discordgo"
 	openai "github.com/ellypaws/inkbunny-sd/llm"
-	"github.com/joho/godotenv"
 )
 
-// Bot parameters
-var (
-	guildID            = flag.String("guild", "", "Guild ID. If not passed - bot registers commands globally")
-	botToken           = flag.String("token", "", "Bot access token")
-	apiHost            = flag.String("host", "", "Host for the Automatic1111 API")
-	imagineCommand     = flag.String("imagine", "imagine", "Imagine command name. Default is \"imagine\"")
-	removeCommandsFlag = flag.Bool("remove", false, "Delete all commands when bot exits")
+func main() {
+	if err := execute(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
 
-	llmHost      = flag.String("llm", "", "LLM model to use")
-	novelAIToken = flag.String("novelai", "", "NovelAI API token")
-)
+// app is the bot with its API, database and queues, built the same way for every subcommand that needs them
+type app struct {
+	cfg                *config.Config
+	stableDiffusionAPI stable_diffusion_api.StableDiffusionAPI
+	db                 *sql.DB
+	imagineQueue       *stable_diffusion.SDQueue
+	bot                discord_bot.Bot
+	// apiTransport reaches the Stable Diffusion API, through api_proxy if set
+	apiTransport http.RoundTripper
+}
 
-func init() {
-	if err := godotenv.Load(); err != nil {
-		log.Printf("Error loading .env file: %v", err)
-	}
-	log.Println(".env file loaded successfully")
+func newApp(ctx context.Context, cfg *config.Config) (*app, error) {
+	handlers.AddSecrets(cfg.Secrets()...)
 
-	if botToken == nil || *botToken == "" {
-		tokenEnv := os.Getenv("BOT_TOKEN")
-		if tokenEnv == "YOUR_BOT_TOKEN_HERE" {
-			log.Fatalf("Invalid bot token from .env file: %v\n"+
-				"Did you edit the .env or run the program with -token ?", tokenEnv)
-		}
-		if tokenEnv != "" {
-			botToken = &tokenEnv
-		}
+	apiTransport, err := newAPITransport(cfg)
+	if err != nil {
+		return nil, err
 	}
-
-	if apiHost == nil || *apiHost == "" {
-		hostEnv := os.Getenv("API_HOST")
-		if hostEnv != "" {
-			apiHost = &hostEnv
-		}
+	handlers.SetAPITransport(apiTransport)
+	novelAIProxy, err := utils.ProxyTransport(cfg.NovelAIProxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid novelai_proxy: %w", err)
 	}
-
-	if apiHost != nil && *apiHost != "" {
-		sanitized := strings.TrimSuffix(*apiHost, "/")
-		apiHost = &sanitized
+	var novelAITransport http.RoundTripper = novelAIProxy
+	if cfg.UserAgent != "" {
+		novelAITransport = utils.HeaderTransport(novelAIProxy, http.Header{"User-Agent": {cfg.UserAgent}})
 	}
 
-	if guildID == nil || *guildID == "" {
-		guildEnv := os.Getenv("GUILD_ID")
-		if guildEnv != "" {
-			guildID = &guildEnv
-		}
+	newStableDiffusionAPI := func(host string) (stable_diffusion_api.StableDiffusionAPI, error) {
+		return stable_diffusion_api.New(stable_diffusion_api.Config{
+			Host: host,
+			Retry: stable_diffusion_api.RetryPolicy{
+				Attempts: cfg.APIRetry.Attempts,
+				Delay:    cfg.APIRetry.Delay,
+				MaxDelay: cfg.APIRetry.MaxDelay,
+			},
+			Timeouts: stable_diffusion_api.Timeouts{
+				Request:    cfg.APITimeouts.Request,
+				Progress:   cfg.APITimeouts.Progress,
+				Options:    cfg.APITimeouts.Options,
+				Generation: cfg.APITimeouts.Generation,
+			},
+			Auth:          cfg.APIAuth,
+			Transport:     apiTransport,
+			MaxConcurrent: cfg.APIMaxConcurrent,
+		})
 	}
-
-	if imagineCommand == nil || *imagineCommand == "" {
-		imagineEnv := os.Getenv("IMAGINE_COMMAND")
-		if imagineEnv != "" {
-			*imagineCommand = imagineEnv
-		}
+	stableDiffusionAPI, err := newStableDiffusionAPI(cfg.APIHost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Stable Diffusion API: %w", err)
 	}
-
-	if llmHost == nil || *llmHost == "" {
-		llmHostEnv := os.Getenv("LLM_HOST")
-		if llmHostEnv != "" {
-			llmHost = &llmHostEnv
+	hosts, err := cfg.ParseAPIHosts()
+	if err != nil {
+		return nil, fmt.Errorf("invalid api_hosts: %w", err)
+	}
+	var backends []stable_diffusion_api.StableDiffusionAPI
+	for _, host := range hosts {
+		backend, err := newStableDiffusionAPI(host)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Stable Diffusion API for %s: %w", host, err)
 		}
+		backends = append(backends, backend)
 	}
 
-	if novelAIToken == nil || *novelAIToken == "" {
-		novelAITokenEnv := os.Getenv("NOVELAI_TOKEN")
-		if novelAITokenEnv != "" {
-			novelAIToken = &novelAITokenEnv
-		}
+	sqliteDB, err := openDatabase(ctx, cfg, false)
+	if err != nil {
+		return nil, err
 	}
 
-	if removeCommandsFlag == nil || !*removeCommandsFlag {
-		removeCommandsEnv := os.Getenv("REMOVE_COMMANDS")
-		if removeCommandsEnv != "" {
-			removeCommandsFlag = new(bool)
-			*removeCommandsFlag = removeCommandsEnv == "true"
-		}
+	generationRepo, err := image_generations.NewRepository(&image_generations.Config{DB: sqliteDB})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create image generation repository: %w", err)
 	}
-}
 
-func main() {
-	flag.Parse()
+	defaultSettingsRepo, err := default_settings.NewRepository(&default_settings.Config{DB: sqliteDB})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create default settings repository: %w", err)
+	}
 
-	// if guildID == nil || *guildID == "" {
-	//	log.Fatalf("Guild ID flag is required")
-	// }
+	failedGenerationRepo, err := failed_generations.NewRepository(&failed_generations.Config{DB: sqliteDB})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create failed generation repository: %w", err)
+	}
 
-	if botToken == nil || *botToken == "" {
-		log.Fatalf("Bot token flag is required")
+	usageRepo, err := usage.NewRepository(&usage.Config{DB: sqliteDB})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create usage repository: %w", err)
 	}
 
-	if apiHost == nil || *apiHost == "" {
-		log.Fatalf("API host flag is required")
+	deletedMessageRepo, err := deleted_messages.NewRepository(&deleted_messages.Config{DB: sqliteDB})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create deleted message repository: %w", err)
 	}
 
-	alive := handlers.CheckAPIAlive(*apiHost)
-	if !alive {
-		log.Printf("API (%v) is not running! Continuing anyway...", *apiHost)
+	statsRepo, err := stats.NewRepository(&stats.Config{DB: sqliteDB})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stats repository: %w", err)
 	}
 
-	if imagineCommand == nil || *imagineCommand == "" {
-		log.Fatalf("Imagine command flag is required")
+	seedBookmarkRepo, err := seed_bookmarks.NewRepository(&seed_bookmarks.Config{DB: sqliteDB})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create seed bookmark repository: %w", err)
 	}
 
-	var removeCommands bool
+	memberLoraRepo, err := member_loras.NewRepository(&member_loras.Config{DB: sqliteDB})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create member lora repository: %w", err)
+	}
 
-	if removeCommandsFlag != nil && *removeCommandsFlag {
-		removeCommands = *removeCommandsFlag
+	guildWatermarkRepo, err := guild_watermarks.NewRepository(&guild_watermarks.Config{DB: sqliteDB})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create guild watermark repository: %w", err)
 	}
 
-	stableDiffusionAPI, err := stable_diffusion_api.New(stable_diffusion_api.Config{
-		Host: *apiHost,
-	})
+	guildQuietHoursRepo, err := guild_quiet_hours.NewRepository(&guild_quiet_hours.Config{DB: sqliteDB})
 	if err != nil {
-		log.Fatalf("Failed to create Stable Diffusion API: %v", err)
+		return nil, fmt.Errorf("failed to create guild quiet hours repository: %w", err)
 	}
 
-	errors := stableDiffusionAPI.PopulateCache()
-	for _, err := range errors {
-		log.Printf("Failed to populate cache: %v", err)
+	privacySettingRepo, err := privacy_settings.NewRepository(&privacy_settings.Config{DB: sqliteDB})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create privacy setting repository: %w", err)
 	}
 
-	ctx := context.Background()
+	layoutSettingRepo, err := layout_settings.NewRepository(&layout_settings.Config{DB: sqliteDB})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create layout setting repository: %w", err)
+	}
 
-	sqliteDB, err := sqlite.New(ctx)
+	promptSnippetRepo, err := prompt_snippets.NewRepository(&prompt_snippets.Config{DB: sqliteDB})
 	if err != nil {
-		log.Fatalf("Failed to create sqlite database: %v", err)
+		return nil, fmt.Errorf("failed to create prompt snippet repository: %w", err)
 	}
 
-	generationRepo, err := image_generations.NewRepository(&image_generations.Config{DB: sqliteDB})
+	channelDefaultRepo, err := channel_defaults.NewRepository(&channel_defaults.Config{DB: sqliteDB})
 	if err != nil {
-		log.Fatalf("Failed to create image generation repository: %v", err)
+		return nil, fmt.Errorf("failed to create channel default repository: %w", err)
 	}
 
-	defaultSettingsRepo, err := default_settings.NewRepository(&default_settings.Config{DB: sqliteDB})
+	refineStepRepo, err := refine_steps.NewRepository(&refine_steps.Config{DB: sqliteDB})
 	if err != nil {
-		log.Fatalf("Failed to create default settings repository: %v", err)
+		return nil, fmt.Errorf("failed to create refine step repository: %w", err)
 	}
 
-	imagineQueue, err := stable_diffusion.New(stable_diffusion.Config{
-		StableDiffusionAPI:  stableDiffusionAPI,
+	anlasBudget := entities.AnlasBudget{Daily: int64(cfg.NovelAIDailyAnlas), Monthly: int64(cfg.NovelAIMonthlyAnlas)}
+	imagineConfig, err := imagineSettings(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid grid settings: %w", err)
+	}
+	imagineConfig.StableDiffusionAPI = stableDiffusionAPI
+	imagineConfig.Backends = backends
+	imagineConfig.ImageGenerationRepo = generationRepo
+	imagineConfig.DefaultSettingsRepo = defaultSettingsRepo
+	imagineConfig.FailedGenerationRepo = failedGenerationRepo
+	imagineConfig.UsageRepo = usageRepo
+	imagineConfig.DeletedMessageRepo = deletedMessageRepo
+	imagineConfig.StatsRepo = statsRepo
+	imagineConfig.SeedBookmarkRepo = seedBookmarkRepo
+	imagineConfig.MemberLoraRepo = memberLoraRepo
+	imagineConfig.GuildWatermarkRepo = guildWatermarkRepo
+	imagineConfig.GuildQuietHoursRepo = guildQuietHoursRepo
+	imagineConfig.PrivacySettingRepo = privacySettingRepo
+	imagineConfig.LayoutSettingRepo = layoutSettingRepo
+	imagineConfig.PromptSnippetRepo = promptSnippetRepo
+	imagineConfig.ChannelDefaultRepo = channelDefaultRepo
+	imagineConfig.RefineStepRepo = refineStepRepo
+	imagineConfig.AnlasBudget = anlasBudget
+
+	novelAIQueue := novelai.New(novelai.Config{
+		Token:               &cfg.NovelAIToken,
+		UsageRepo:           usageRepo,
 		ImageGenerationRepo: generationRepo,
-		DefaultSettingsRepo: defaultSettingsRepo,
+		Transport:           novelAITransport,
+		MaxMegapixels:       cfg.NovelAIMaxMegapixels,
+		AnlasBudget:         anlasBudget,
+		PromptSnippetRepo:   promptSnippetRepo,
+		Retry: novelaiapi.RetryPolicy{
+			Attempts: cfg.NovelAIRetry.Attempts,
+			Delay:    cfg.NovelAIRetry.Delay,
+			MaxDelay: cfg.NovelAIRetry.MaxDelay,
+		},
 	})
+	if summarizer, ok := novelAIQueue.(queue.Summarizer); ok {
+		imagineConfig.NovelAIQueue = summarizer
+	}
+	if referencer, ok := novelAIQueue.(queue.Referencer); ok {
+		imagineConfig.NovelAIReferencer = referencer
+	}
+
+	imagineQueue, err := stable_diffusion.New(imagineConfig)
 	if err != nil {
-		log.Fatalf("Failed to create imagine queue: %v", err)
+		return nil, fmt.Errorf("failed to create imagine queue: %w", err)
 	}
 
 	var llmConfig *openai.Config
-	if llmHost != nil && *llmHost != "" {
-		endpoint, err := url.Parse(*llmHost)
+	if cfg.LLMHost != "" {
+		endpoint, err := url.Parse(cfg.LLMHost)
 		if err != nil {
-			log.Fatalf("Failed to parse LLM host: %v", err)
+			return nil, fmt.Errorf("failed to parse LLM host: %w", err)
 		}
 		llmConfig = &openai.Config{
-			Host:     *llmHost,
+			Host:     cfg.LLMHost,
 			APIKey:   "", // TODO: Add API key
 			Endpoint: *endpoint,
 		}
@@ -184,21 +268,265 @@ func main() {
 		log.Printf("LLM host is not set, LLM commands will be disabled")
 	}
 
+	// validated by config.Load
+	shardIDs, _ := cfg.Shards.ParseIDs()
+	intents, _ := cfg.Gateway.ParseIntents()
 	bot, err := discord_bot.New(&discord_bot.Config{
-		BotToken:       *botToken,
-		GuildID:        *guildID,
+		BotToken:       cfg.BotToken,
+		GuildID:        cfg.GuildID,
+		OwnerID:        cfg.OwnerID,
 		ImagineQueue:   imagineQueue,
-		NovelAIQueue:   novelai.New(novelAIToken),
+		NovelAIQueue:   novelAIQueue,
 		LLMQueue:       llm.New(llmConfig),
-		RemoveCommands: removeCommands,
+		RemoveCommands: cfg.RemoveCommands,
+		ShardCount:     cfg.Shards.Count,
+		ShardAuto:      cfg.Shards.Auto,
+		ShardIDs:       shardIDs,
+		Intents:        intents,
+		Cache:          discord_bot.CacheMode(cfg.Gateway.Cache),
 	})
 	if err != nil {
-		log.Fatalf("Error creating Discord bot: %v", err)
+		return nil, fmt.Errorf("error creating Discord bot: %w", err)
 	}
 
-	if err := bot.Start(); err != nil {
+	return &app{
+		cfg:                cfg,
+		stableDiffusionAPI: stableDiffusionAPI,
+		db:                 sqliteDB,
+		imagineQueue:       imagineQueue.(*stable_diffusion.SDQueue),
+		bot:                bot,
+		apiTransport:       apiTransport,
+	}, nil
+}
+
+// newAPITransport returns the transport to the Stable Diffusion API, through api_proxy with the headers of
+// api_headers and user_agent
+func newAPITransport(cfg *config.Config) (http.RoundTripper, error) {
+	proxy, err := utils.ProxyTransport(cfg.APIProxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid api_proxy: %w", err)
+	}
+	header, err := cfg.ParseAPIHeaders()
+	if err != nil {
+		return nil, fmt.Errorf("invalid api_headers: %w", err)
+	}
+	return utils.HeaderTransport(proxy, header), nil
+}
+
+func openDatabase(ctx context.Context, cfg *config.Config, skipMigrations bool) (*sql.DB, error) {
+	db, err := sqlite.New(ctx, sqlite.Config{
+		Path:           cfg.Database.Path,
+		Driver:         cfg.Database.Driver,
+		BusyTimeout:    cfg.Database.BusyTimeout,
+		MaxOpenConns:   cfg.Database.MaxConns,
+		SkipMigrations: skipMigrations,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sqlite database: %w", err)
+	}
+	return db, nil
+}
+
+// run starts the bot with the configuration in args until it's interrupted
+func run(name string, args []string) error {
+	cfg, err := config.Load(name, args)
+	if err != nil {
+		return fmt.Errorf("invalid configuration:\n%w", err)
+	}
+
+	logFile, err := logging.Setup(cfg.Logging.File, logging.RotateOptions{
+		MaxSize:    int64(cfg.Logging.MaxSize) << 20,
+		MaxAge:     cfg.Logging.MaxAge,
+		MaxBackups: cfg.Logging.MaxBackups,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	defer logFile.Close()
+
+	err = reporting.Setup(reporting.Config{
+		SentryDSN:   cfg.Reporting.SentryDSN,
+		WebhookURL:  cfg.Reporting.WebhookURL,
+		Environment: cfg.Reporting.Environment,
+		Release:     version.Version,
+		Scrub:       handlers.Scrub,
+	})
+	if err != nil {
+		return err
+	}
+	defer reporting.Flush(5 * time.Second)
+	defer reporting.Repanic(map[string]string{"goroutine": "main"})
+
+	log.Printf("Starting stable_diffusion_bot %s", version.String())
+
+	ctx := context.Background()
+
+	a, err := newApp(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer a.db.Close()
+
+	alive := handlers.CheckAPIAlive(cfg.APIHost)
+	if !alive {
+		log.Printf("API (%v) is not running! Continuing anyway...", cfg.APIHost)
+	}
+
+	errors := a.stableDiffusionAPI.PopulateCache()
+	for _, err := range errors {
+		log.Printf("Failed to populate cache: %v", err)
+	}
+
+	a.probeCapabilities(ctx)
+
+	audit.SetChannel(cfg.AuditChannel)
+
+	// Apply changes to the config file without restarting, the queue keeps its pending generations
+	watchCtx, stopWatching := context.WithCancel(ctx)
+	current := cfg
+	go config.Watch(watchCtx, cfg, name, args, func(next *config.Config) error {
+		imagineConfig, err := imagineSettings(next)
+		if err != nil {
+			return err
+		}
+		if err := a.imagineQueue.Reconfigure(imagineConfig); err != nil {
+			return err
+		}
+		if next.APIHost != a.stableDiffusionAPI.Host() {
+			a.stableDiffusionAPI.SetHost(next.APIHost)
+			log.Printf("Stable Diffusion API host set to %s", next.APIHost)
+		}
+		audit.SetChannel(next.AuditChannel)
+		if changed := current.Changes(next); len(changed) > 0 {
+			audit.Post(audit.Event{
+				Kind:        audit.ConfigChanged,
+				Description: "The config file was reloaded",
+				Fields:      []*discordgo.MessageEmbedField{{Name: "Settings", Value: "`" + strings.Join(changed, "`, `") + "`"}},
+			})
+		}
+		current = next
+		return nil
+	})
+
+	healthCtx, stopHealth := context.WithCancel(ctx)
+	if cfg.HealthAddr != "" {
+		go func() {
+			err := health.Serve(healthCtx, health.Config{
+				Addr:        cfg.HealthAddr,
+				Gateway:     a.bot.Connected,
+				BackendHost: func() string { return a.stableDiffusionAPI.Host() },
+				Queue:       func() any { return a.imagineQueue.Status() },
+				Transport:   a.apiTransport,
+			})
+			if err != nil {
+				log.Printf("Error serving health checks: %v", err)
+			}
+		}()
+	}
+
+	pprofCtx, stopPprof := context.WithCancel(ctx)
+	if cfg.PprofAddr != "" {
+		go func() {
+			if err := diagnostics.Serve(pprofCtx, cfg.PprofAddr); err != nil {
+				log.Printf("Error serving pprof: %v", err)
+			}
+		}()
+	}
+
+	adminCtx, stopAdmin := context.WithCancel(ctx)
+	if cfg.Admin.Addr != "" {
+		go func() {
+			err := admin.Serve(adminCtx, admin.Config{
+				Addr:  cfg.Admin.Addr,
+				Token: cfg.Admin.Token,
+				Queue: a.imagineQueue,
+			})
+			if err != nil {
+				log.Printf("Error serving the admin API: %v", err)
+			}
+		}()
+	}
+
+	if err := a.bot.Start(); err != nil {
 		panic(err)
 	}
+	stopWatching()
+	stopHealth()
+	stopPprof()
+	stopAdmin()
 
 	log.Println("Gracefully shutting down.")
+	return nil
+}
+
+// probeCapabilities reports which features the backend serves and turns off the missing ones before their
+// commands are registered
+func (a *app) probeCapabilities(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	capabilities, err := a.stableDiffusionAPI.Capabilities(ctx)
+	if err != nil {
+		log.Printf("Error probing the backend, features that weren't probed are assumed to be available: %v", err)
+	}
+	log.Printf("Backend capabilities:\n%s", capabilities)
+	if missing := capabilities.Missing(); len(missing) > 0 {
+		log.Printf("Turning off %v, the backend doesn't serve them", missing)
+	}
+	a.imagineQueue.SetCapabilities(capabilities)
+}
+
+// imagineSettings returns the settings of the imagine queue that can be changed while it's running, without its
+// API and repositories
+func imagineSettings(cfg *config.Config) (stable_diffusion.Config, error) {
+	gridLabelStyle := composite_renderer.LabelOptions{Margin: cfg.Grid.LabelMargin}
+	if cfg.Grid.LabelScale > 0 {
+		gridLabelStyle.Font = composite_renderer.BitmapFont{Scale: cfg.Grid.LabelScale}
+	}
+
+	collage := composite_renderer.CollageOptions{
+		Columns:      cfg.Grid.Columns,
+		AspectRatio:  cfg.Grid.AspectRatio,
+		Gutter:       cfg.Grid.Gutter,
+		Border:       cfg.Grid.Border,
+		CornerRadius: cfg.Grid.CornerRadius,
+	}
+	var err error
+	if cfg.Grid.Background != "" {
+		collage.Background, err = composite_renderer.ParseHexColor(cfg.Grid.Background)
+		if err != nil {
+			return stable_diffusion.Config{}, fmt.Errorf("invalid grid background: %w", err)
+		}
+	}
+	if cfg.Grid.BorderColor != "" {
+		collage.BorderColor, err = composite_renderer.ParseHexColor(cfg.Grid.BorderColor)
+		if err != nil {
+			return stable_diffusion.Config{}, fmt.Errorf("invalid grid border color: %w", err)
+		}
+	}
+	modelFamilies, err := cfg.ParseModelFamilies()
+	if err != nil {
+		return stable_diffusion.Config{}, fmt.Errorf("invalid model families: %w", err)
+	}
+
+	return stable_diffusion.Config{
+		RestoreWindow:     cfg.RestoreWindow,
+		GridLabels:        stable_diffusion.GridLabelMode(cfg.Grid.Labels),
+		GridLabelStyle:    gridLabelStyle,
+		UpscaleComparison: composite_renderer.CompareMode(cfg.Images.UpscaleCompare),
+		StealthPNGInfo:    cfg.Images.StealthPNGInfo,
+		PreviewSize:       cfg.Images.PreviewSize,
+		ArchiveGrids:      cfg.Images.ArchiveGrids,
+		DryRun:            cfg.DryRun,
+		TimingFooter:      cfg.TimingFooter,
+		MaxMegapixels:     cfg.MaxMegapixels,
+		ModelFamilies:     modelFamilies,
+		Renderer:          composite_renderer.Backend(cfg.Images.Renderer),
+		RendererBinary:    cfg.Images.RendererBinary,
+		Collage:           collage,
+		Encoding: composite_renderer.EncodeOptions{
+			Format:   cfg.Images.Format,
+			MaxBytes: cfg.Images.UploadLimit << 20,
+		},
+	}, nil
 }
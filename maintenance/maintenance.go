@@ -0,0 +1,91 @@
+package maintenance
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultMessage is shown to members when maintenance is turned on without a message
+const DefaultMessage = "The bot is down for maintenance, please try again later."
+
+// State is the maintenance in progress
+type State struct {
+	// Message shown to members instead of queueing their request
+	Message string
+	// Until is when maintenance is expected to end, zero if unknown
+	Until time.Time
+	// Since is when maintenance was turned on
+	Since time.Time
+}
+
+// Notice is the message shown to members, with the expected end as a Discord timestamp
+func (s State) Notice() string {
+	if s.Until.IsZero() {
+		return s.Message
+	}
+	return fmt.Sprintf("%s\nExpected back <t:%d:R>.", s.Message, s.Until.Unix())
+}
+
+// Error is returned when adding to a queue during maintenance. The error handlers show its notice instead of an error.
+type Error struct {
+	State
+	// Title is shown above the notice, DefaultTitle if empty
+	Title string
+}
+
+// DefaultTitle is the title of the notice shown for an Error
+const DefaultTitle = "Down for maintenance"
+
+func (e *Error) Error() string { return e.Notice() }
+
+var current struct {
+	mu    sync.RWMutex
+	state *State
+}
+
+// Start turns maintenance on, new requests are rejected while the items already queued keep being processed
+func Start(message string, eta time.Duration) State {
+	state := State{Message: message, Since: time.Now()}
+	if state.Message == "" {
+		state.Message = DefaultMessage
+	}
+	if eta > 0 {
+		state.Until = state.Since.Add(eta)
+	}
+
+	current.mu.Lock()
+	defer current.mu.Unlock()
+	current.state = &state
+	return state
+}
+
+// Stop turns maintenance off and returns the state it ended, if it was on
+func Stop() (State, bool) {
+	current.mu.Lock()
+	defer current.mu.Unlock()
+	if current.state == nil {
+		return State{}, false
+	}
+	state := *current.state
+	current.state = nil
+	return state, true
+}
+
+// Current returns the maintenance in progress, if any
+func Current() (State, bool) {
+	current.mu.RLock()
+	defer current.mu.RUnlock()
+	if current.state == nil {
+		return State{}, false
+	}
+	return *current.state, true
+}
+
+// Check returns an *Error while maintenance is on, call it before queueing a request
+func Check() error {
+	if state, ok := Current(); ok {
+		return &Error{State: state}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package prompt_template
+
+import (
+	"context"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"stable_diffusion_bot/repositories/prompt_snippets"
+	"stable_diffusion_bot/utils"
+)
+
+// InteractionVars are the variables of a prompt sent with i. Snippets are looked up in the guild of i
+func InteractionVars(i *discordgo.Interaction, snippets prompt_snippets.Repository) Vars {
+	vars := Vars{Now: time.Now()}
+	if i == nil {
+		return vars
+	}
+
+	if user := utils.GetUser(i); user != nil {
+		vars.User = user.Username
+		if user.GlobalName != "" {
+			vars.User = user.GlobalName
+		}
+	}
+	if i.Member != nil && i.Member.Nick != "" {
+		vars.User = i.Member.Nick
+	}
+
+	if i.GuildID != "" && snippets != nil {
+		guildID := i.GuildID
+		// each snippet is looked up once, however many times the prompts use it
+		type lookup struct {
+			text string
+			err  error
+		}
+		looked := make(map[string]lookup)
+		vars.Snippet = func(name string) (string, error) {
+			if found, ok := looked[name]; ok {
+				return found.text, found.err
+			}
+			var found lookup
+			snippet, err := snippets.Get(context.Background(), guildID, name)
+			if err != nil {
+				found.err = err
+			} else {
+				found.text = snippet.Text
+			}
+			looked[name] = found
+			return found.text, found.err
+		}
+	}
+
+	return vars
+}
+
+// ExpandAll expands each of prompts in place with the same vars, so {date} and the snippets agree between them
+func ExpandAll(vars Vars, prompts ...*string) error {
+	for _, prompt := range prompts {
+		if prompt == nil || *prompt == "" {
+			continue
+		}
+		expanded, err := Expand(*prompt, vars)
+		if err != nil {
+			return err
+		}
+		*prompt = expanded
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package prompt_template
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// maxDepth is how deeply snippets can use other snippets, which also stops snippets that use themselves
+	maxDepth = 5
+	// maxSnippets is how many snippets a prompt can use in all, counting the ones used by other snippets
+	maxSnippets = 50
+	// maxLength is the longest a prompt can get once expanded
+	maxLength = 10_000
+)
+
+// variable matches {user}, {date}, {random:a|b|c} and {snippet:name}. Other braces are left as they are, as NovelAI
+// weighs words with them and the negative prompt of /imagine has {DEFAULT}.
+var variable = regexp.MustCompile(`\{(user|date|random|snippet)(?::([^{}]*))?}`)
+
+// Vars are what the variables of a prompt expand to
+type Vars struct {
+	// User is the name of the member, for {user}
+	User string
+	// Now is the time of the request, {date} is its day in UTC
+	Now time.Time
+	// Snippet returns the text of a snippet of the guild, for {snippet:name}. Nil if the prompt isn't from a guild
+	Snippet func(name string) (string, error)
+}
+
+// Expand replaces the variables in prompt. Snippets are expanded in turn, so they can use variables and other
+// snippets. Prompts without variables are returned as they are.
+func Expand(prompt string, vars Vars) (string, error) {
+	expanded, err := (&expansion{vars: vars}).expand(prompt, 0)
+	if err != nil {
+		return "", err
+	}
+	if len(expanded) > maxLength {
+		return "", fmt.Errorf("the prompt is longer than %d characters once expanded", maxLength)
+	}
+	return expanded, nil
+}
+
+// expansion counts what a prompt expanded to so far, so snippets using several others can't grow without bound
+type expansion struct {
+	vars     Vars
+	snippets int
+	length   int
+}
+
+func (e *expansion) expand(prompt string, depth int) (string, error) {
+	if depth > maxDepth {
+		return "", fmt.Errorf("snippets can only use other snippets %d deep", maxDepth)
+	}
+	vars := e.vars
+
+	var errs []error
+	expanded := variable.ReplaceAllStringFunc(prompt, func(match string) string {
+		groups := variable.FindStringSubmatch(match)
+		name, argument := groups[1], strings.TrimSpace(groups[2])
+		switch name {
+		case "user":
+			return vars.User
+		case "date":
+			return vars.Now.UTC().Format(time.DateOnly)
+		case "random":
+			choices := strings.Split(argument, "|")
+			return strings.TrimSpace(choices[rand.N(len(choices))])
+		case "snippet":
+			if argument == "" {
+				errs = append(errs, errors.New("name the snippet to use, e.g. {snippet:style}"))
+				return match
+			}
+			if vars.Snippet == nil {
+				errs = append(errs, fmt.Errorf("snippets can only be used in a server, {snippet:%s}", argument))
+				return match
+			}
+			if len(errs) > 0 {
+				return match
+			}
+			if e.snippets++; e.snippets > maxSnippets {
+				errs = append(errs, fmt.Errorf("a prompt can only use %d snippets, including the ones snippets use", maxSnippets))
+				return match
+			}
+			text, err := vars.Snippet(strings.ToLower(argument))
+			if err != nil {
+				errs = append(errs, fmt.Errorf("error using {snippet:%s}: %w", argument, err))
+				return match
+			}
+			text, err = e.expand(text, depth+1)
+			if err != nil {
+				errs = append(errs, err)
+				return match
+			}
+			if e.length += len(text); e.length > maxLength {
+				errs = append(errs, fmt.Errorf("the prompt is longer than %d characters once expanded", maxLength))
+				return match
+			}
+			return text
+		default:
+			return match
+		}
+	})
+
+	return expanded, errors.Join(errs...)
+}
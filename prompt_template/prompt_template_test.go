@@ -0,0 +1,66 @@
+package prompt_template
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpand(t *testing.T) {
+	snippets := map[string]string{
+		"style": "watercolor, by {user}",
+		"loop":  "{snippet:loop}",
+		"fan":   strings.Repeat("{snippet:fan2}", 10),
+		"fan2":  strings.Repeat("{snippet:fan3}", 10),
+		"fan3":  "cat",
+		"long":  strings.Repeat("{snippet:big}", 20),
+		"big":   strings.Repeat("a", 1000),
+	}
+	vars := Vars{
+		User: "elly",
+		Now:  time.Date(2024, 5, 6, 23, 0, 0, 0, time.FixedZone("", -4*60*60)),
+		Snippet: func(name string) (string, error) {
+			text, ok := snippets[name]
+			if !ok {
+				return "", fmt.Errorf("no snippet named %s", name)
+			}
+			return text, nil
+		},
+	}
+
+	tests := []struct {
+		prompt  string
+		want    string
+		wantErr bool
+	}{
+		{"1girl, {{blue eyes}}", "1girl, {{blue eyes}}", false},
+		{"{DEFAULT}, blurry", "{DEFAULT}, blurry", false},
+		{"made by {user} on {date}", "made by elly on 2024-05-07", false},
+		{"{random:cat}", "cat", false},
+		{"cat, {snippet:Style}", "cat, watercolor, by elly", false},
+		{"{snippet:missing}", "", true},
+		{"{snippet:loop}", "", true},
+		{"{snippet:}", "", true},
+		{"{snippet:fan}", "", true},
+		{"{snippet:long}", "", true},
+		{strings.Repeat("a", maxLength+1), "", true},
+	}
+	for _, test := range tests {
+		got, err := Expand(test.prompt, vars)
+		if (err != nil) != test.wantErr {
+			t.Errorf("Expand(%q) error = %v, want error %v", test.prompt, err, test.wantErr)
+			continue
+		}
+		if !test.wantErr && got != test.want {
+			t.Errorf("Expand(%q) = %q, want %q", test.prompt, got, test.want)
+		}
+	}
+
+	for range 20 {
+		got, err := Expand("{random:a| b |c}", vars)
+		if err != nil || (got != "a" && got != "b" && got != "c") {
+			t.Fatalf("Expand(random) = %q, %v", got, err)
+		}
+	}
+}
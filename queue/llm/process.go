@@ -3,11 +3,21 @@ package llm
 import (
 	"fmt"
 	"log"
+	"runtime/debug"
 
 	"stable_diffusion_bot/discord_bot/handlers"
+	"stable_diffusion_bot/reporting"
 )
 
 func (q *LLMQueue) next() error {
+	// a panic fails the item instead of stopping the queue
+	var item *LLMItem
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			q.failPanicked(item, recovered)
+		}
+	}()
+
 	for len(q.queue) > 0 {
 		if q.current != nil {
 			log.Printf("WARNING: we're trying to pull the next item in the queue, but currentImagine is not yet nil")
@@ -15,6 +25,7 @@ func (q *LLMQueue) next() error {
 		}
 		select {
 		case q.current = <-q.queue:
+			item = q.current
 			if q.current.DiscordInteraction == nil {
 				log.Panicf("DiscordInteraction is nil! Make sure to set it before adding to the queue. Example: queue.DiscordInteraction = i.Interaction\n%v", q.current)
 			}
@@ -40,6 +51,21 @@ func (q *LLMQueue) next() error {
 	return nil
 }
 
+// failPanicked reports the panic, tells the member their item failed and clears it so the next item can start
+func (q *LLMQueue) failPanicked(item *LLMItem, recovered any) {
+	log.Printf("Recovered from panic while processing item: %v\n%s", recovered, debug.Stack())
+	q.done()
+
+	tags := map[string]string{"queue": "llm"}
+	if item == nil || item.DiscordInteraction == nil {
+		reporting.Panic(recovered, tags, nil)
+		return
+	}
+	tags["type"] = item.Type
+	reporting.Panic(recovered, tags, map[string]any{"interaction_id": item.DiscordInteraction.ID, "guild_id": item.DiscordInteraction.GuildID})
+	_ = handlers.ErrorEdit(q.botSession, item.DiscordInteraction, fmt.Errorf("error processing current item: panic: %v", recovered))
+}
+
 func (q *LLMQueue) done() {
 	q.mu.Lock()
 	q.current = nil
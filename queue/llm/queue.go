@@ -11,6 +11,7 @@ import (
 	"github.com/ellypaws/inkbunny-sd/llm"
 
 	"stable_diffusion_bot/composite_renderer"
+	"stable_diffusion_bot/maintenance"
 	"stable_diffusion_bot/queue"
 )
 
@@ -68,6 +69,9 @@ Polling:
 }
 
 func (q *LLMQueue) Add(item *LLMItem) (int, error) {
+	if err := maintenance.Check(); err != nil {
+		return -1, err
+	}
 	if len(q.queue) == cap(q.queue) {
 		return -1, errors.New("queue is full")
 	}
@@ -0,0 +1,105 @@
+package novelai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"stable_diffusion_bot/audit"
+	"stable_diffusion_bot/discord_bot/handlers"
+	"stable_diffusion_bot/utils"
+)
+
+// maxUnbudgetedCost is the Anlas from which requests are refused when no budget is set
+const maxUnbudgetedCost = 10
+
+// freeMegapixels and freeSteps are the most Opus generates one image with for free
+const (
+	freeMegapixels = 1024 * 1024 / 1_000_000.0
+	freeSteps      = 28
+)
+
+var errOverBudget = errors.New("over the Anlas budget")
+
+// withinBudget returns the cost of the item once it fits the Anlas the member has left this day and month. Paid
+// requests past the budget are made as a single image of the size Opus generates for free, and errOverBudget is
+// returned if even that costs too much. The bot owner isn't limited.
+func (q *NAIQueue) withinBudget(item *NAIQueueItem, cost int64) (int64, error) {
+	if !q.anlasBudget.Limited() {
+		if cost >= maxUnbudgetedCost {
+			return cost, fmt.Errorf("cost is %d", cost)
+		}
+		return cost, nil
+	}
+	if cost == 0 || handlers.IsOwner(item.DiscordInteraction) {
+		return cost, nil
+	}
+	if q.usageRepo == nil {
+		return cost, errors.New("the Anlas spent can't be read without a usage repository")
+	}
+
+	user := utils.GetUser(item.DiscordInteraction)
+	today, month, err := q.usageRepo.AnlasSpent(context.Background(), user.ID, time.Now())
+	if err != nil {
+		return cost, fmt.Errorf("error reading the Anlas spent: %w", err)
+	}
+	remaining := q.anlasBudget.Remaining(today, month)
+	if cost <= remaining {
+		return cost, nil
+	}
+
+	downgraded := *item.Request
+	parameters := &downgraded.Parameters
+	width, height := parameters.Size()
+	fitWidth, fitHeight := utils.FitMegapixels(int(width), int(height), freeMegapixels, 64)
+	parameters.ResolutionPreset = nil
+	parameters.Width, parameters.Height = int64(fitWidth), int64(fitHeight)
+	parameters.Steps = min(parameters.Steps, freeSteps)
+	parameters.ImageCount = 1
+
+	if downgradedCost := downgraded.CalculateCost(true); downgradedCost <= remaining {
+		*item.Request = downgraded
+		item.requested.Parameters.Steps = parameters.Steps
+		item.requested.Parameters.ImageCount = parameters.ImageCount
+		log.Printf("Made %v at the free size as %s is over the Anlas budget", item.DiscordInteraction.ID, user.Username)
+		_, err := handlers.EphemeralFollowup(q.botSession, item.DiscordInteraction,
+			fmt.Sprintf("This would cost `%d` Anlas and you have `%d` left, %s. It was made as one image of `%d x %d` at `%d` steps instead.",
+				cost, remaining, q.resetsIn(today, month), fitWidth, fitHeight, parameters.Steps),
+			discordgo.MessageFlagsEphemeral,
+		)
+		if err != nil {
+			log.Printf("Error sending budget notice: %v", err)
+		}
+		return downgradedCost, nil
+	}
+
+	audit.Post(audit.Event{
+		Kind:        audit.QuotaExceeded,
+		Description: fmt.Sprintf("A NovelAI request costing %d Anlas was refused, %d were left", cost, remaining),
+		UserID:      user.ID,
+		GuildID:     item.DiscordInteraction.GuildID,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Spent today", Value: fmt.Sprintf("`%d`", today), Inline: true},
+			{Name: "Spent this month", Value: fmt.Sprintf("`%d`", month), Inline: true},
+		},
+	})
+	err = handlers.ErrorEdit(q.botSession, item.DiscordInteraction, fmt.Sprintf(
+		"This costs `%d` Anlas and you have `%d` left, %s. Requests of one image up to `1024 x 1024` at `%d` steps are free.",
+		cost, remaining, q.resetsIn(today, month), freeSteps))
+	if err != nil {
+		log.Printf("Error sending budget refusal: %v", err)
+	}
+	return cost, errOverBudget
+}
+
+// resetsIn says when the budget that ran out is renewed
+func (q *NAIQueue) resetsIn(today, month int64) string {
+	if q.anlasBudget.Monthly > 0 && q.anlasBudget.Monthly-month <= q.anlasBudget.Remaining(today, month) {
+		return "your budget renews at the start of next month (UTC)"
+	}
+	return "your budget renews at midnight UTC"
+}
@@ -0,0 +1,67 @@
+package novelai
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+
+	"stable_diffusion_bot/composite_renderer"
+	"stable_diffusion_bot/utils"
+)
+
+// CharacterReference is an image of a character to keep in the generation, unlike vibe transfer which carries over
+// the style and composition of an image
+type CharacterReference struct {
+	Image *utils.Image
+	// Fidelity from 0 to 1 is how closely the details of the character are kept. Default is 1
+	Fidelity float64
+}
+
+// characterReferenceSizes are the canvases NovelAI takes character references in
+var characterReferenceSizes = struct{ portrait, landscape, square image.Point }{
+	portrait:  image.Pt(1024, 1536),
+	landscape: image.Pt(1536, 1024),
+	square:    image.Pt(1472, 1472),
+}
+
+// applyCharacterReference adds the character reference of the item to its request, letterboxed to the canvas NovelAI
+// expects for its aspect ratio
+func applyCharacterReference(item *NAIQueueItem) error {
+	reference := item.CharacterReference
+	if reference == nil || reference.Image == nil {
+		return nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(reference.Image.Bytes()))
+	if err != nil {
+		return fmt.Errorf("error reading the character reference: %w", err)
+	}
+
+	bounds := img.Bounds()
+	canvas := characterReferenceSizes.square
+	switch {
+	case bounds.Dy()*4 > bounds.Dx()*5:
+		canvas = characterReferenceSizes.portrait
+	case bounds.Dx()*4 > bounds.Dy()*5:
+		canvas = characterReferenceSizes.landscape
+	}
+
+	scale := min(float64(canvas.X)/float64(bounds.Dx()), float64(canvas.Y)/float64(bounds.Dy()))
+	width, height := max(1, int(float64(bounds.Dx())*scale)), max(1, int(float64(bounds.Dy())*scale))
+	resized := composite_renderer.Resize(img, width, height)
+
+	padded := image.NewRGBA(image.Rectangle{Max: canvas})
+	draw.Draw(padded, padded.Bounds(), image.Black, image.Point{}, draw.Src)
+	offset := image.Pt((canvas.X-width)/2, (canvas.Y-height)/2)
+	draw.Draw(padded, image.Rectangle{Min: offset, Max: offset.Add(image.Pt(width, height))}, resized, resized.Bounds().Min, draw.Src)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, padded); err != nil {
+		return fmt.Errorf("error encoding the character reference: %w", err)
+	}
+
+	item.Request.SetCharacterReference(utils.ImageFromBytes(buf.Bytes()), reference.Fidelity)
+	return nil
+}
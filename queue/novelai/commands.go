@@ -28,12 +28,19 @@ func (q *NAIQueue) commands() []*discordgo.ApplicationCommand {
 				commandOptions[novelaiVibeTransfer],
 				commandOptions[novelaiInformation],
 				commandOptions[novelaiReference],
+				commandOptions[novelaiCharacterReference],
+				commandOptions[novelaiCharacterFidelity],
 				commandOptions[img2imgOption],
 				commandOptions[novelaiImg2ImgStr],
+				commandOptions[novelaiImg2ImgNoise],
 				commandOptions[novelaiSMEAOption],
 				commandOptions[novelaiSMEADynOption],
 			},
 		},
+		{
+			Name: RemixCommand,
+			Type: discordgo.MessageApplicationCommand,
+		},
 	}
 }
 
@@ -41,8 +48,8 @@ var commandOptions = map[string]*discordgo.ApplicationCommandOption{
 	promptOption: {
 		Type:        discordgo.ApplicationCommandOptionString,
 		Name:        promptOption,
-		Description: "The text prompt to imagine",
-		Required:    true,
+		Description: "The text prompt to imagine, read from the img2img or vibe transfer image if NovelAI made it",
+		Required:    false,
 	},
 	negativeOption: {
 		Type:        discordgo.ApplicationCommandOptionString,
@@ -85,6 +92,14 @@ var commandOptions = map[string]*discordgo.ApplicationCommandOption{
 		Description: "The model to use for NovelAI. Default is V3. Older versions are not recommended.",
 		Required:    false,
 		Choices: []*discordgo.ApplicationCommandOptionChoice{
+			{
+				Name:  "NAI Diffusion V4.5 Full",
+				Value: entities.ModelV45Full,
+			},
+			{
+				Name:  "NAI Diffusion V4.5 Curated",
+				Value: entities.ModelV45Curated,
+			},
 			{
 				Name:  "NAI Diffusion Anime V4 (Default)",
 				Value: entities.ModelV4Full,
@@ -199,12 +214,16 @@ var commandOptions = map[string]*discordgo.ApplicationCommandOption{
 				Name:  "DPM++ 2M",
 				Value: entities.SamplerDPM2M,
 			},
+			{
+				Name:  "DPM++ 2M SDE (V4 and V4.5)",
+				Value: entities.SamplerDPM2MSDE,
+			},
 			{
 				Name:  "DPM++ SDE",
 				Value: entities.SamplerDPMSDE,
 			},
 			{
-				Name:  "DDIM",
+				Name:  "DDIM (V3)",
 				Value: entities.SamplerDDIM,
 			},
 		},
@@ -213,24 +232,28 @@ var commandOptions = map[string]*discordgo.ApplicationCommandOption{
 	novelaiUCPresetOption: {
 		Type:        discordgo.ApplicationCommandOptionInteger,
 		Name:        novelaiUCPresetOption,
-		Description: "The preset to use for Undesired Content",
+		Description: "Undesired content added before the negative prompt, as in NovelAI. Default is Heavy",
 		Required:    false,
 		Choices: []*discordgo.ApplicationCommandOptionChoice{
 			{
 				Name:  "Heavy",
-				Value: 0,
+				Value: entities.UCHeavy,
 			},
 			{
 				Name:  "Light",
-				Value: 1,
+				Value: entities.UCLight,
+			},
+			{
+				Name:  "Human Focus (V3 and V4.5)",
+				Value: entities.UCHumanFocus,
 			},
 			{
-				Name:  "Human Focus",
-				Value: 2,
+				Name:  "Furry Focus (V4.5)",
+				Value: entities.UCFurryFocus,
 			},
 			{
 				Name:  "None",
-				Value: 3,
+				Value: entities.UCNone,
 			},
 		},
 	},
@@ -238,14 +261,14 @@ var commandOptions = map[string]*discordgo.ApplicationCommandOption{
 	novelaiQualityOption: {
 		Type:        discordgo.ApplicationCommandOptionBoolean,
 		Name:        novelaiQualityOption,
-		Description: "Tags to increase quality will be prepended to the prompt. Default is true",
+		Description: "Add the quality tags NovelAI uses for the model to the prompt. Default is true",
 		Required:    false,
 	},
 
 	novelaiScheduleOption: {
 		Type:        discordgo.ApplicationCommandOptionString,
 		Name:        novelaiScheduleOption,
-		Description: "The scheduler when sampling. Default is Karras.",
+		Description: "The noise schedule when sampling. Default is Karras",
 		Required:    false,
 		Choices: []*discordgo.ApplicationCommandOptionChoice{
 			{
@@ -253,7 +276,7 @@ var commandOptions = map[string]*discordgo.ApplicationCommandOption{
 				Value: entities.ScheduleDefault,
 			},
 			{
-				Name:  "Native",
+				Name:  "Native (V3)",
 				Value: entities.ScheduleNative,
 			},
 			{
@@ -274,14 +297,14 @@ var commandOptions = map[string]*discordgo.ApplicationCommandOption{
 	novelaiSMEAOption: {
 		Type:        discordgo.ApplicationCommandOptionBoolean,
 		Name:        novelaiSMEAOption,
-		Description: "Smea versions of samplers are modified to perform better at high resolutions. Default is off",
+		Description: "Smea versions of samplers perform better at high resolutions, V3 only. Default is off",
 		Required:    false,
 	},
 
 	novelaiSMEADynOption: {
 		Type:        discordgo.ApplicationCommandOptionBoolean,
 		Name:        novelaiSMEADynOption,
-		Description: "Dyn variants of Smea often lead to more varied output, but may fail at very high resolutions.",
+		Description: "Dyn variants of Smea give more varied output, but may fail at very high resolutions. V3 only",
 		Required:    false,
 	},
 
@@ -313,7 +336,33 @@ var commandOptions = map[string]*discordgo.ApplicationCommandOption{
 	novelaiImg2ImgStr: {
 		Type:        discordgo.ApplicationCommandOptionNumber,
 		Name:        novelaiImg2ImgStr,
-		Description: "The strength of the img2img. Default is 0.7",
+		Description: "How much of the img2img image to change. Default is 0.7",
 		Required:    false,
+		MinValue:    &minImg2ImgStrength,
+		MaxValue:    entities.MaxImg2ImgStrength,
+	},
+	novelaiCharacterReference: {
+		Type:        discordgo.ApplicationCommandOptionAttachment,
+		Name:        novelaiCharacterReference,
+		Description: "Attach an image of a character to keep in the image. Uses V4.5 unless another model is chosen",
+		Required:    false,
+	},
+	novelaiCharacterFidelity: {
+		Type:        discordgo.ApplicationCommandOptionNumber,
+		Name:        novelaiCharacterFidelity,
+		Description: "How closely the details of the character are kept. Default is 1",
+		Required:    false,
+		MinValue:    new(float64),
+		MaxValue:    1,
+	},
+	novelaiImg2ImgNoise: {
+		Type:        discordgo.ApplicationCommandOptionNumber,
+		Name:        novelaiImg2ImgNoise,
+		Description: "How much noise to add to the img2img image, for new details. Default is 0",
+		Required:    false,
+		MinValue:    new(float64),
+		MaxValue:    entities.MaxImg2ImgNoise,
 	},
 }
+
+var minImg2ImgStrength float64 = entities.MinImg2ImgStrength
@@ -1,21 +1,34 @@
 package novelai
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
+	"strconv"
+	"strings"
 
 	"github.com/bwmarrin/discordgo"
 
 	"stable_diffusion_bot/discord_bot/handlers"
+	"stable_diffusion_bot/entities"
 	"stable_diffusion_bot/utils"
 )
 
 type Handler = func(*discordgo.Session, *discordgo.InteractionCreate) error
 
 const (
-	prefix = "novelai_"
-	cancel = prefix + "cancel"
+	prefix    = "novelai_"
+	cancel    = prefix + "cancel"
+	reroll    = prefix + "reroll"
+	variation = prefix + "variation"
+	generate  = prefix + "generate"
+	discard   = prefix + "discard"
 )
 
+// variationStrength is how much of the image a variation repaints
+const variationStrength = 0.5
+
 var components = map[string]discordgo.MessageComponent{
 	cancel: discordgo.ActionsRow{
 		Components: []discordgo.MessageComponent{
@@ -26,12 +39,180 @@ var components = map[string]discordgo.MessageComponent{
 			},
 		},
 	},
+	generate: discordgo.ActionsRow{
+		Components: []discordgo.MessageComponent{
+			discordgo.Button{
+				Label:    "Generate",
+				Style:    discordgo.SuccessButton,
+				CustomID: generate,
+			},
+			discordgo.Button{
+				Label:    "Cancel",
+				Style:    discordgo.DangerButton,
+				CustomID: discard,
+			},
+		},
+	},
 }
 
 func (q *NAIQueue) components() map[string]Handler {
-	return map[string]Handler{
+	h := map[string]Handler{
 		cancel: q.removeImagineFromQueue,
+		reroll: q.processReroll,
+
+		generate: q.generateConfirmed,
+		discard:  q.discardConfirmed,
+
+		handlers.TryOnNovelAI: q.processTryOnNovelAI,
+	}
+
+	for i := range 4 {
+		h[variation+"_"+strconv.Itoa(i+1)] = q.variationComponentHandler
 	}
+
+	return h
+}
+
+// finalComponents returns the buttons of a finished generation. Text to image generations that were recorded get a
+// variation button for each of up to four images, a re-roll button and a button to try them on Stable Diffusion,
+// unless their character reference would be lost.
+func finalComponents(item *NAIQueueItem, images int, recorded bool) *[]discordgo.MessageComponent {
+	if !recorded || item.Type != ItemTypeImage || item.CharacterReference != nil {
+		return &[]discordgo.MessageComponent{handlers.Components[handlers.DeleteGeneration]}
+	}
+
+	var buttons []discordgo.MessageComponent
+	// more than four images are tiled into one attachment, there's no single image to vary
+	if images <= 4 {
+		for i := 1; i <= images; i++ {
+			buttons = append(buttons, discordgo.Button{
+				Label:    strconv.Itoa(i),
+				Style:    discordgo.SecondaryButton,
+				CustomID: fmt.Sprintf("%s_%d", variation, i),
+				Emoji: &discordgo.ComponentEmoji{
+					Name: "♻️",
+				},
+			})
+		}
+	}
+	buttons = append(buttons, discordgo.Button{
+		Label:    "Re-roll",
+		Style:    discordgo.PrimaryButton,
+		CustomID: reroll,
+		Emoji: &discordgo.ComponentEmoji{
+			Name: "🎲",
+		},
+	})
+
+	return &[]discordgo.MessageComponent{
+		discordgo.ActionsRow{Components: buttons},
+		discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.Button{
+				Label:    "Try on SD",
+				Style:    discordgo.SecondaryButton,
+				CustomID: handlers.TryOnStableDiffusion,
+				Emoji: &discordgo.ComponentEmoji{
+					Name: "🔀",
+				},
+			},
+		}},
+		handlers.Components[handlers.DeleteGeneration],
+	}
+}
+
+func (q *NAIQueue) processReroll(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	return q.queuePrevious(s, i, 0)
+}
+
+func (q *NAIQueue) variationComponentHandler(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	index, err := strconv.Atoi(strings.TrimPrefix(i.MessageComponentData().CustomID, variation+"_"))
+	if err != nil {
+		return handlers.ErrorEphemeral(s, i.Interaction, "error parsing interaction index", err)
+	}
+
+	return q.queuePrevious(s, i, index)
+}
+
+// queuePrevious queues the generation recorded for the message again with a new seed, or as a variation of image
+// index of the message if index is above 0
+func (q *NAIQueue) queuePrevious(s *discordgo.Session, i *discordgo.InteractionCreate, index int) error {
+	if err := handlers.ThinkResponse(s, i); err != nil {
+		return err
+	}
+
+	request, err := q.previousRequest(i.Message.ID)
+	if err != nil {
+		return handlers.ErrorEdit(s, i.Interaction, "Could not find the generation of this message.", err)
+	}
+
+	item := q.NewItem(i.Interaction)
+	item.Request = request
+	if index == 0 {
+		// Init picks a new seed
+		item.Request.Parameters.Seed = 0
+		return q.enqueue(s, item)
+	}
+
+	attachments := generatedAttachments(i.Message)
+	if index > len(attachments) {
+		return handlers.ErrorEdit(s, i.Interaction, fmt.Sprintf("Could not find image %d of this message.", index))
+	}
+	image, err := utils.DownloadAttachment(attachments[index-1], utils.AttachmentLimits{})
+	var attachmentErr *utils.AttachmentError
+	if errors.As(err, &attachmentErr) {
+		return handlers.ErrorEdit(s, i.Interaction, attachmentErr.Error())
+	}
+	if err != nil {
+		return handlers.ErrorEdit(s, i.Interaction, "Error getting the image.", err)
+	}
+
+	item.Type = ItemTypeImg2Img
+	item.Request.Action = entities.ActionImg2Img
+	item.Request.Parameters.Img2Img = image
+	item.Request.Parameters.Strength = variationStrength
+	// keep the seed the image was made with
+	item.Request.Parameters.Seed += int64(index - 1)
+
+	return q.enqueue(s, item)
+}
+
+// processTryOnNovelAI queues the Stable Diffusion generation of the message with NovelAI, to compare the two
+func (q *NAIQueue) processTryOnNovelAI(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	if err := handlers.ThinkResponse(s, i); err != nil {
+		return err
+	}
+	if q.imageGenerationRepo == nil {
+		return handlers.ErrorEdit(s, i.Interaction, "Generations are not recorded, so this one can't be tried on NovelAI.")
+	}
+
+	generation, err := q.imageGenerationRepo.GetByMessageAndSort(context.Background(), i.Message.ID, 0)
+	if err != nil {
+		return handlers.ErrorEdit(s, i.Interaction, "Could not find the generation of this message.", err)
+	}
+	if generation.Backend == entities.BackendNovelAI || generation.TextToImageRequest == nil {
+		return handlers.ErrorEdit(s, i.Interaction, "This generation was already made with NovelAI.")
+	}
+
+	item := q.NewItem(i.Interaction)
+	item.Type = ItemTypeImage
+	generation.TextToImageRequest.ApplyToNovelAI(item.Request)
+	if strings.TrimSpace(item.Request.Input) == "" {
+		return handlers.ErrorEdit(s, i.Interaction, "The prompt of this generation is empty without its LoRAs.")
+	}
+
+	return q.enqueue(s, item)
+}
+
+// generatedAttachments returns the images of a generation message, without the thumbnail of its input images
+func generatedAttachments(message *discordgo.Message) []*discordgo.MessageAttachment {
+	var attachments []*discordgo.MessageAttachment
+	for _, attachment := range message.Attachments {
+		if strings.HasPrefix(attachment.Filename, "thumbnail.") {
+			continue
+		}
+		attachments = append(attachments, attachment)
+	}
+	return attachments
 }
 
 func (q *NAIQueue) removeImagineFromQueue(s *discordgo.Session, i *discordgo.InteractionCreate) error {
@@ -50,3 +231,41 @@ func (q *NAIQueue) removeImagineFromQueue(s *discordgo.Session, i *discordgo.Int
 
 	return handlers.UpdateFromComponent(s, i.Interaction, "Generation cancelled", handlers.Components[handlers.DeleteButton])
 }
+
+// generateConfirmed queues the settings read from an image once the member confirms them
+func (q *NAIQueue) generateConfirmed(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	if utils.GetUser(i.Interaction).ID != i.Message.InteractionMetadata.User.ID {
+		return handlers.ErrorEphemeral(s, i.Interaction, "You can only generate your own settings")
+	}
+
+	item := q.takeConfirming(i.Message.InteractionMetadata.ID)
+	if item == nil {
+		return handlers.UpdateFromComponent(s, i.Interaction, "These settings expired, run the command again.", handlers.Components[handlers.DeleteButton])
+	}
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{Type: discordgo.InteractionResponseDeferredMessageUpdate})
+	if err != nil {
+		return handlers.Wrap(err)
+	}
+
+	return q.enqueue(s, item)
+}
+
+func (q *NAIQueue) discardConfirmed(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	if utils.GetUser(i.Interaction).ID != i.Message.InteractionMetadata.User.ID {
+		return handlers.ErrorEphemeral(s, i.Interaction, "You can only cancel your own generations")
+	}
+
+	q.takeConfirming(i.Message.InteractionMetadata.ID)
+	return handlers.UpdateFromComponent(s, i.Interaction, "Generation cancelled", handlers.Components[handlers.DeleteButton])
+}
+
+// takeConfirming removes and returns the item waiting to be confirmed for the interaction, or nil if it expired
+func (q *NAIQueue) takeConfirming(id string) *NAIQueueItem {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	item := q.confirming[id]
+	delete(q.confirming, id)
+	return item
+}
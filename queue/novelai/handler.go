@@ -1,8 +1,11 @@
 package novelai
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"strings"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
 
@@ -12,7 +15,10 @@ import (
 	"stable_diffusion_bot/utils"
 )
 
-const NovelAICommand = "novelai"
+const (
+	NovelAICommand = "novelai"
+	RemixCommand   = "Remix with NovelAI"
+)
 
 const (
 	promptOption   = "prompt"
@@ -34,6 +40,10 @@ const (
 	novelaiInformation  = "information_extracted"
 	novelaiReference    = "reference_strength"
 	novelaiImg2ImgStr   = "img2img_strength"
+	novelaiImg2ImgNoise = "img2img_noise"
+
+	novelaiCharacterReference = "character_reference"
+	novelaiCharacterFidelity  = "character_fidelity"
 
 	novelaiVariety = "variety"
 
@@ -45,6 +55,7 @@ func (q *NAIQueue) handlers() queue.CommandHandlers {
 	return queue.CommandHandlers{
 		discordgo.InteractionApplicationCommand: {
 			NovelAICommand: q.processNovelAICommand,
+			RemixCommand:   q.processRemixCommand,
 		},
 	}
 }
@@ -55,14 +66,30 @@ func (q *NAIQueue) processNovelAICommand(s *discordgo.Session, i *discordgo.Inte
 	}
 
 	optionMap := utils.GetOpts(i.ApplicationCommandData())
-	option, ok := optionMap[promptOption]
-	if !ok {
-		return handlers.ErrorEdit(s, i.Interaction, "You need to provide a prompt.")
+
+	attachments, err := utils.GetAttachments(i)
+	var attachmentErr *utils.AttachmentError
+	if errors.As(err, &attachmentErr) {
+		return handlers.ErrorEdit(s, i.Interaction, attachmentErr.Error())
+	}
+	if err != nil {
+		return handlers.ErrorEdit(s, i.Interaction, "Error getting attachments.", err)
 	}
 
-	item := q.NewItem(i.Interaction, WithPrompt(option.StringValue()))
+	item := q.NewItem(i.Interaction)
 	item.Type = ItemTypeImage
 
+	// an image made by NovelAI or the WebUI fills in the settings it was made with, the options below override them
+	prefilled := prefillFromAttachments(item, optionMap, attachments)
+
+	option, ok := optionMap[promptOption]
+	if ok {
+		item.Request.Input = option.StringValue()
+	}
+	if item.Request.Input == "" {
+		return handlers.ErrorEdit(s, i.Interaction, "You need to provide a prompt.")
+	}
+
 	if option, ok = optionMap[negativeOption]; ok {
 		item.Request.Parameters.NegativePrompt = option.StringValue()
 	}
@@ -90,6 +117,8 @@ func (q *NAIQueue) processNovelAICommand(s *discordgo.Session, i *discordgo.Inte
 
 	if option, ok = optionMap[novelaiSMEADynOption]; ok {
 		item.Request.Parameters.SmeaDyn = option.BoolValue()
+		// DYN is a variant of SMEA, NovelAI ignores it without
+		item.Request.Parameters.Smea = item.Request.Parameters.Smea || item.Request.Parameters.SmeaDyn
 	}
 
 	if option, ok = optionMap[novelaiUCPresetOption]; ok {
@@ -109,11 +138,6 @@ func (q *NAIQueue) processNovelAICommand(s *discordgo.Session, i *discordgo.Inte
 		item.Request.Parameters.NoiseSchedule = option.StringValue()
 	}
 
-	attachments, err := utils.GetAttachments(i)
-	if err != nil {
-		return handlers.ErrorEdit(s, i.Interaction, "Error getting attachments.", err)
-	}
-
 	if option, ok := optionMap[novelaiVibeTransfer]; ok {
 		attachment, ok := attachments[option.Value.(string)]
 		if !ok {
@@ -135,6 +159,27 @@ func (q *NAIQueue) processNovelAICommand(s *discordgo.Session, i *discordgo.Inte
 		}
 	}
 
+	if option, ok := optionMap[novelaiCharacterReference]; ok {
+		attachment, ok := attachments[option.Value.(string)]
+		if !ok {
+			return handlers.ErrorEdit(s, i.Interaction, "You need to provide an image of the character.")
+		}
+		if item.Type == ItemTypeVibeTransfer {
+			return handlers.ErrorEdit(s, i.Interaction, "Character reference can't be used with vibe transfer.")
+		}
+		if _, ok := optionMap[novelaiModelOption]; !ok {
+			item.Request.Model = entities.ModelV45Full
+		}
+		if !entities.SupportsCharacterReference(item.Request.Model) {
+			return handlers.ErrorEdit(s, i.Interaction, "Character reference is only supported by V4.5 models.")
+		}
+
+		item.CharacterReference = &CharacterReference{Image: attachment.Image, Fidelity: 1}
+		if option, ok := optionMap[novelaiCharacterFidelity]; ok {
+			item.CharacterReference.Fidelity = min(max(option.FloatValue(), 0), 1)
+		}
+	}
+
 	if option, ok := optionMap[img2imgOption]; ok {
 		image, ok := attachments[option.Value.(string)]
 		if !ok {
@@ -148,6 +193,11 @@ func (q *NAIQueue) processNovelAICommand(s *discordgo.Session, i *discordgo.Inte
 		if option, ok := optionMap[novelaiImg2ImgStr]; ok {
 			item.Request.Parameters.Strength = option.FloatValue()
 		}
+
+		if option, ok := optionMap[novelaiImg2ImgNoise]; ok {
+			item.Request.Parameters.Noise = option.FloatValue()
+		}
+		item.Request.Parameters.ClampImg2Img()
 	}
 
 	if option, ok := optionMap[novelaiVariety]; ok {
@@ -157,12 +207,118 @@ func (q *NAIQueue) processNovelAICommand(s *discordgo.Session, i *discordgo.Inte
 		}
 	}
 
-	_, err = q.Add(item)
+	if preset := item.Request.Parameters.UcPreset; preset != nil && !entities.HasUCPreset(item.Request.Model, *preset) {
+		return handlers.ErrorEdit(s, i.Interaction, fmt.Sprintf("`%s` doesn't have that undesired content preset, pick Heavy, Light or None.", item.Request.Model))
+	}
+
+	if err := item.Request.Parameters.CheckSampling(item.Request.Model); err != nil {
+		return handlers.ErrorEdit(s, i.Interaction, "The sampler settings don't work with this model.", err)
+	}
+
+	if prefilled {
+		return q.confirm(s, item)
+	}
+
+	return q.enqueue(s, item)
+}
+
+// prefillFromAttachments fills item with the parameters of the img2img or vibe transfer image if NovelAI or the WebUI
+// made it
+func prefillFromAttachments(item *NAIQueueItem, optionMap map[string]*discordgo.ApplicationCommandInteractionDataOption, attachments map[string]utils.AttachmentImage) bool {
+	for _, name := range []string{img2imgOption, novelaiVibeTransfer} {
+		option, ok := optionMap[name]
+		if !ok {
+			continue
+		}
+		attachment, ok := attachments[option.Value.(string)]
+		if !ok || attachment.Image == nil {
+			continue
+		}
+
+		if err := prefill(item.Request, attachment.Image.Bytes()); err != nil {
+			if !errors.Is(err, errNoParameters) {
+				log.Printf("Error reading the parameters of %v: %v", attachment.Attachment.Filename, err)
+			}
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// processRemixCommand reads the parameters of the first image made by NovelAI or the WebUI in the message and offers
+// to generate them with NovelAI
+func (q *NAIQueue) processRemixCommand(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	if err := handlers.ThinkResponse(s, i); err != nil {
+		return err
+	}
+
+	data := i.ApplicationCommandData()
+	var message *discordgo.Message
+	if data.Resolved != nil {
+		message = data.Resolved.Messages[data.TargetID]
+	}
+	if message == nil {
+		return handlers.ErrorEdit(s, i.Interaction, "Could not find the message.")
+	}
+
+	for _, attachment := range message.Attachments {
+		if !strings.HasPrefix(attachment.ContentType, "image") {
+			continue
+		}
+
+		image, err := utils.DownloadAttachment(attachment, utils.AttachmentLimits{})
+		if err != nil {
+			log.Printf("Error downloading %v: %v", attachment.Filename, err)
+			continue
+		}
+
+		item := q.NewItem(i.Interaction)
+		err = prefill(item.Request, image.Bytes())
+		if errors.Is(err, errNoParameters) {
+			continue
+		}
+		if err != nil {
+			return handlers.ErrorEdit(s, i.Interaction, fmt.Sprintf("Error reading the parameters of %s.", attachment.Filename), err)
+		}
+		return q.confirm(s, item)
+	}
+
+	return handlers.ErrorEdit(s, i.Interaction, "This message has no images made by NovelAI or Stable Diffusion.")
+}
+
+// confirmTimeout is how long settings read from an image wait to be confirmed, within the 15 minutes a response can
+// still be edited
+const confirmTimeout = 14 * time.Minute
+
+// confirm shows the settings of item and holds it until the member generates or cancels it
+func (q *NAIQueue) confirm(s *discordgo.Session, item *NAIQueueItem) error {
+	id := item.DiscordInteraction.ID
+	q.mu.Lock()
+	q.confirming[id] = item
+	q.mu.Unlock()
+	time.AfterFunc(confirmTimeout, func() {
+		q.mu.Lock()
+		delete(q.confirming, id)
+		q.mu.Unlock()
+	})
+
+	_, err := handlers.EditInteractionResponse(s, item.DiscordInteraction,
+		"I read these settings from the image, should I generate them?",
+		&discordgo.WebhookEdit{Embeds: &[]*discordgo.MessageEmbed{parametersEmbed(item)}},
+		components[generate],
+	)
+	return err
+}
+
+// enqueue adds item to the queue and shows its position in the deferred response to its interaction
+func (q *NAIQueue) enqueue(s *discordgo.Session, item *NAIQueueItem) error {
+	_, err := q.Add(item)
 	if err != nil {
-		return handlers.ErrorEdit(s, i.Interaction, "Error adding imagine to queue.", err)
+		return handlers.ErrorEdit(s, item.DiscordInteraction, "Error adding imagine to queue.", err)
 	}
 
-	message, err := handlers.EditInteractionResponse(s, i.Interaction,
+	message, err := handlers.EditInteractionResponse(s, item.DiscordInteraction,
 		q.positionString(item),
 		components[cancel],
 	)
@@ -180,16 +336,22 @@ func (q *NAIQueue) processNovelAICommand(s *discordgo.Session, i *discordgo.Inte
 
 func (q *NAIQueue) positionString(item *NAIQueueItem) string {
 	snowflake := utils.GetUser(item.DiscordInteraction).ID
+	var wait string
+	if item.eta > 0 {
+		wait = fmt.Sprintf(" Your turn is in about %s.", item.eta.Round(time.Second))
+	}
 	if item.pos <= 0 {
 		return fmt.Sprintf(
-			"I'm dreaming something up for you. You are next in line.\n<@%s> asked me to imagine \n```\n%s\n```",
+			"I'm dreaming something up for you. You are next in line.%s\n<@%s> asked me to imagine \n```\n%s\n```",
+			wait,
 			snowflake,
 			item.Request.Input,
 		)
 	} else {
 		return fmt.Sprintf(
-			"I'm dreaming something up for you. You are currently #%d in line.\n<@%s> asked me to imagine \n```\n%s\n```",
+			"I'm dreaming something up for you. You are currently #%d in line.%s\n<@%s> asked me to imagine \n```\n%s\n```",
 			item.pos,
+			wait,
 			snowflake,
 			item.Request.Input,
 		)
@@ -0,0 +1,115 @@
+package novelai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"stable_diffusion_bot/entities"
+	"stable_diffusion_bot/utils"
+)
+
+// snapshot copies request as the member asked for it, before Init adds the quality tags and undesired content
+// presets. Images are left out as they are too large to store.
+func snapshot(request *entities.NovelAIRequest) entities.NovelAIRequest {
+	requested := *request
+	requested.Parameters.Img2Img = nil
+	requested.Parameters.VibeTransferImage = nil
+	requested.Parameters.ReferenceImageMultiple = nil
+	requested.Parameters.DirectorReferenceImages = nil
+	return requested
+}
+
+// recordGeneration stores the item in image_generations as a parent row with the Anlas spent and what was requested
+// as its raw request, and a row per image, so /lookup, /stats and the re-roll and variation buttons read NovelAI
+// generations the same as Stable Diffusion ones.
+func (q *NAIQueue) recordGeneration(item *NAIQueueItem) error {
+	if q.imageGenerationRepo == nil {
+		return nil
+	}
+	interaction := item.DiscordInteraction
+	if interaction.Message == nil {
+		return fmt.Errorf("interaction %v has no message", interaction.ID)
+	}
+
+	// the seed and size are only known after Init
+	parameters := item.Request.Parameters
+	requested := item.requested
+	requested.Parameters.ResolutionPreset = nil
+	requested.Parameters.Width, requested.Parameters.Height = parameters.Width, parameters.Height
+	requested.Parameters.Seed = parameters.Seed
+	raw, err := json.Marshal(requested)
+	if err != nil {
+		return err
+	}
+	rawRequest := string(raw)
+
+	model := item.Request.Model
+	if model == "" {
+		model = entities.ModelV4Full
+	}
+	info := entities.GenerationInfo{
+		InteractionID: interaction.ID,
+		GuildID:       interaction.GuildID,
+		ChannelID:     interaction.ChannelID,
+		MessageID:     interaction.Message.ID,
+		MemberID:      utils.GetUser(interaction).ID,
+		Processed:     true,
+		Checkpoint:    &model,
+		CreatedAt:     item.Created,
+		Backend:       entities.BackendNovelAI,
+	}
+	textToImage := entities.TextToImageRequest{
+		Prompt:         requested.Input,
+		NegativePrompt: requested.Parameters.NegativePrompt,
+		Width:          int(parameters.Width),
+		Height:         int(parameters.Height),
+		Steps:          int(parameters.Steps),
+		Seed:           parameters.Seed,
+		SamplerName:    parameters.Sampler,
+		CFGScale:       parameters.Scale,
+		NIter:          1,
+		BatchSize:      int(parameters.ImageCount),
+	}
+	if item.Type == ItemTypeImg2Img {
+		textToImage.DenoisingStrength = parameters.Strength
+	}
+
+	parent := &entities.ImageGenerationRequest{GenerationInfo: info, TextToImageRequest: &textToImage}
+	parent.RawRequest = &rawRequest
+	parent.Anlas = &item.cost
+	if _, err := q.imageGenerationRepo.Create(context.Background(), parent); err != nil {
+		return err
+	}
+
+	// NovelAI makes each image of a batch with the next seed
+	images := make([]*entities.ImageGenerationRequest, parameters.ImageCount)
+	for idx := range images {
+		image := textToImage
+		image.Seed = parameters.Seed + int64(idx)
+		images[idx] = &entities.ImageGenerationRequest{GenerationInfo: info, TextToImageRequest: &image}
+		images[idx].SortOrder = idx + 1
+	}
+	_, err = q.imageGenerationRepo.CreateBatch(context.Background(), images)
+	return err
+}
+
+// previousRequest returns the request recorded for the generation posted in messageID
+func (q *NAIQueue) previousRequest(messageID string) (*entities.NovelAIRequest, error) {
+	if q.imageGenerationRepo == nil {
+		return nil, fmt.Errorf("generations are not recorded")
+	}
+	generation, err := q.imageGenerationRepo.GetByMessageAndSort(context.Background(), messageID, 0)
+	if err != nil {
+		return nil, err
+	}
+	if generation.Backend != entities.BackendNovelAI || generation.RawRequest == nil {
+		return nil, fmt.Errorf("generation %d was not made with NovelAI", generation.ID)
+	}
+
+	request, err := entities.UnmarshalNovelAIRequest([]byte(*generation.RawRequest))
+	if err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
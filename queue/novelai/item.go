@@ -1,6 +1,7 @@
 package novelai
 
 import (
+	"sync/atomic"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
@@ -21,6 +22,8 @@ type NAIQueueItem struct {
 	Type ItemType
 
 	Request *entities.NovelAIRequest
+	// CharacterReference is added to the request when it's processed
+	CharacterReference *CharacterReference
 
 	Created            time.Time
 	InteractionIndex   int
@@ -29,6 +32,17 @@ type NAIQueueItem struct {
 
 	pos  int
 	user *discordgo.User
+	// eta is how long the item is estimated to wait before it's processed, 0 if it can't be told yet
+	eta time.Duration
+
+	// requested is the request as it was made, before Init, and cost the Anlas it spends
+	requested entities.NovelAIRequest
+	cost      int64
+
+	// retrying is shown with the progress while NovelAI is too busy for the item, and retried is sent how long each
+	// retry waits so the item isn't timed out meanwhile
+	retrying atomic.Pointer[string]
+	retried  chan time.Duration
 }
 
 func (q *NAIQueueItem) Interaction() *discordgo.Interaction {
@@ -0,0 +1,59 @@
+package novelai
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"stable_diffusion_bot/utils"
+)
+
+// latencySamples is how many of the most recent generations the wait in line is estimated from
+const latencySamples = 20
+
+// latencies are the seconds per unit of work the most recent generations took. They follow how fast NovelAI is for
+// the tier of the account and how busy it is, which vary too much for a fixed estimate.
+type latencies struct {
+	mu    sync.Mutex
+	rates []float64
+}
+
+// work is how much generating item takes, its images by megapixels by steps
+func work(item *NAIQueueItem) float64 {
+	if item.Request == nil {
+		return 0
+	}
+	parameters := item.Request.Parameters
+	width, height := parameters.Size()
+	return float64(max(parameters.ImageCount, 1)) * utils.Megapixels(int(width), int(height)) * float64(max(parameters.Steps, 1))
+}
+
+// record adds how long a generation of work took, from the start of processing to the images being posted
+func (l *latencies) record(work float64, elapsed time.Duration) {
+	if work <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rates = append(l.rates, elapsed.Seconds()/work)
+	if len(l.rates) > latencySamples {
+		l.rates = l.rates[len(l.rates)-latencySamples:]
+	}
+}
+
+// estimate returns how long work should take by the median of the recent generations, 0 before there are any
+func (l *latencies) estimate(work float64) time.Duration {
+	l.mu.Lock()
+	rates := slices.Clone(l.rates)
+	l.mu.Unlock()
+	if len(rates) == 0 {
+		return 0
+	}
+
+	slices.Sort(rates)
+	median := rates[len(rates)/2]
+	if len(rates)%2 == 0 {
+		median = (rates[len(rates)/2-1] + median) / 2
+	}
+	return time.Duration(median * work * float64(time.Second))
+}
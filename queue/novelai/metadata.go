@@ -0,0 +1,253 @@
+package novelai
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/ellypaws/novelai-metadata/pkg/meta"
+
+	"stable_diffusion_bot/composite_renderer"
+	"stable_diffusion_bot/entities"
+	"stable_diffusion_bot/utils"
+)
+
+var errNoParameters = errors.New("image has no NovelAI parameters")
+
+// imageParameters reads the parameters NovelAI stores in the images it makes, from the PNG text chunks or the
+// stealth alpha channel. It returns errNoParameters for images made elsewhere.
+func imageParameters(data []byte) (*meta.Metadata, error) {
+	var stored struct {
+		Description string
+		Source      string
+		Comment     string
+	}
+	if texts, err := composite_renderer.TextChunks(data); err == nil && texts["Comment"] != "" {
+		stored.Description, stored.Source, stored.Comment = texts["Description"], texts["Source"], texts["Comment"]
+	} else {
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, errNoParameters
+		}
+		info, err := utils.DecodeStealthInfo(img)
+		if errors.Is(err, utils.ErrNoStealthInfo) {
+			return nil, errNoParameters
+		}
+		if err != nil {
+			return nil, err
+		}
+		// the stealth-pnginfo extension stores the WebUI parameters as text instead
+		if json.Unmarshal([]byte(info), &stored) != nil || stored.Comment == "" {
+			return nil, errNoParameters
+		}
+	}
+
+	var comment meta.Comment
+	if err := json.Unmarshal([]byte(stored.Comment), &comment); err != nil {
+		return nil, fmt.Errorf("error reading NovelAI parameters: %w", err)
+	}
+	return &meta.Metadata{Comment: &comment, Description: stored.Description, Source: stored.Source}, nil
+}
+
+// applyParameters fills request with the parameters of an image made by NovelAI. The stored prompts already include
+// the quality tags and undesired content preset, so both are turned off.
+func applyParameters(request *entities.NovelAIRequest, metadata *meta.Metadata) {
+	comment := metadata.Comment
+	request.Input = cmp.Or(comment.Prompt, metadata.Description)
+	request.Parameters.NegativePrompt = comment.Uc
+	request.Parameters.QualityToggle = false
+	none := int64(entities.UCNone)
+	request.Parameters.UcPreset = &none
+
+	if model := sourceModel(metadata.Source); model != "" {
+		request.Model = model
+	}
+	if comment.Width > 0 && comment.Height > 0 {
+		request.Parameters.ResolutionPreset = nil
+		request.Parameters.Width, request.Parameters.Height = comment.Width, comment.Height
+	}
+	if comment.Steps > 0 {
+		request.Parameters.Steps = comment.Steps
+	}
+	if comment.Scale > 0 {
+		request.Parameters.Scale = comment.Scale
+	}
+	if comment.Seed > 0 {
+		request.Parameters.Seed = comment.Seed
+	}
+	if comment.Sampler != "" {
+		request.Parameters.Sampler = comment.Sampler
+	}
+	if comment.NoiseSchedule != nil {
+		request.Parameters.NoiseSchedule = *comment.NoiseSchedule
+	}
+	request.Parameters.Smea = comment.Sm
+	request.Parameters.SmeaDyn = comment.SmDyn
+	if comment.Strength != nil {
+		request.Parameters.Strength = *comment.Strength
+	}
+	if comment.Noise != nil {
+		request.Parameters.Noise = *comment.Noise
+	}
+}
+
+// webUIInfotext reads the parameters the WebUI stores in the images it makes, from the parameters text chunk or the
+// stealth alpha channel. It returns errNoParameters for images without them.
+func webUIInfotext(data []byte) (string, error) {
+	if texts, err := composite_renderer.TextChunks(data); err == nil && texts[composite_renderer.ParametersKey] != "" {
+		return texts[composite_renderer.ParametersKey], nil
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", errNoParameters
+	}
+	info, err := utils.DecodeStealthInfo(img)
+	if errors.Is(err, utils.ErrNoStealthInfo) || strings.HasPrefix(info, "{") {
+		return "", errNoParameters
+	}
+	return info, err
+}
+
+// infotextParam matches a "Name: value" setting of the last line of an infotext, as in the WebUI's
+// parse_generation_parameters
+var infotextParam = regexp.MustCompile(`\s*(\w[\w \-/]+):\s*("(?:\\.|[^\\"])+"|[^,]*)(?:,|$)`)
+
+// parseInfotext splits an infotext of the WebUI into its prompt, negative prompt and settings
+func parseInfotext(infotext string) (prompt, negative string, settings map[string]string) {
+	lines := strings.Split(strings.TrimSpace(infotext), "\n")
+	settings = make(map[string]string)
+	if last := lines[len(lines)-1]; strings.HasPrefix(last, "Steps: ") {
+		for _, match := range infotextParam.FindAllStringSubmatch(last, -1) {
+			settings[strings.TrimSpace(match[1])] = strings.Trim(match[2], `"`)
+		}
+		lines = lines[:len(lines)-1]
+	}
+
+	var prompts, negatives []string
+	for _, line := range lines {
+		if after, ok := strings.CutPrefix(line, "Negative prompt:"); ok {
+			negatives = append(negatives, strings.TrimSpace(after))
+			continue
+		}
+		if len(negatives) > 0 {
+			negatives = append(negatives, line)
+		} else {
+			prompts = append(prompts, line)
+		}
+	}
+	return strings.Join(prompts, "\n"), strings.Join(negatives, "\n"), settings
+}
+
+// applyInfotext fills request with the parameters of an image made by the WebUI. Its prompt weights are converted to
+// NovelAI's, and settings NovelAI doesn't allow, like more than 50 steps, are skipped.
+func applyInfotext(request *entities.NovelAIRequest, infotext string) {
+	prompt, negative, settings := parseInfotext(infotext)
+	request.Input = entities.NovelAIWeights(prompt)
+	request.Parameters.NegativePrompt = entities.NovelAIWeights(negative)
+
+	if width, height, ok := strings.Cut(settings["Size"], "x"); ok {
+		width, errWidth := strconv.ParseInt(width, 10, 64)
+		height, errHeight := strconv.ParseInt(height, 10, 64)
+		if errWidth == nil && errHeight == nil && width >= 64 && height >= 64 {
+			request.Parameters.ResolutionPreset = nil
+			request.Parameters.Width, request.Parameters.Height = width/64*64, height/64*64
+		}
+	}
+	if steps, err := strconv.ParseInt(settings["Steps"], 10, 64); err == nil && steps >= 1 && steps <= 50 {
+		request.Parameters.Steps = steps
+	}
+	if scale, err := strconv.ParseFloat(settings["CFG scale"], 64); err == nil && scale >= 0 && scale <= 10 {
+		request.Parameters.Scale = scale
+	}
+	if seed, err := strconv.ParseInt(settings["Seed"], 10, 64); err == nil && seed > 0 && seed <= 4294967295-7 {
+		request.Parameters.Seed = seed
+	}
+}
+
+// prefill fills request with the parameters stored in an image made by NovelAI or the WebUI. It returns
+// errNoParameters for images without them.
+func prefill(request *entities.NovelAIRequest, data []byte) error {
+	metadata, err := imageParameters(data)
+	if err == nil {
+		applyParameters(request, metadata)
+		return nil
+	}
+	if !errors.Is(err, errNoParameters) {
+		return err
+	}
+
+	infotext, err := webUIInfotext(data)
+	if err != nil {
+		return err
+	}
+	applyInfotext(request, infotext)
+	return nil
+}
+
+// sourceModel returns the model named by the Source NovelAI stores, e.g. "NovelAI Diffusion V4 4F49EC75", or "" if
+// it isn't known
+func sourceModel(source string) string {
+	switch {
+	case strings.Contains(source, "V4.5") && strings.Contains(source, "Curated"):
+		return entities.ModelV45Curated
+	case strings.Contains(source, "V4.5"):
+		return entities.ModelV45Full
+	case strings.Contains(source, "V4") && strings.Contains(source, "Curated"):
+		return entities.ModelV4Preview
+	case strings.Contains(source, "V4"):
+		return entities.ModelV4Full
+	case strings.Contains(source, "Stable Diffusion XL 9CC2F394"):
+		return entities.ModelFurryV3
+	case strings.Contains(source, "Stable Diffusion XL"):
+		return entities.ModelV3
+	default:
+		return ""
+	}
+}
+
+// parametersEmbed shows the settings read from an image so the member can check them before they're generated
+func parametersEmbed(item *NAIQueueItem) *discordgo.MessageEmbed {
+	parameters := item.Request.Parameters
+	width, height := parameters.Width, parameters.Height
+	if preset := parameters.ResolutionPreset; preset != nil {
+		width, height = preset[0], preset[1]
+	}
+
+	fields := []*discordgo.MessageEmbedField{
+		{Name: "Model", Value: fmt.Sprintf("`%s`", item.Request.Model)},
+		{Name: "Size", Value: fmt.Sprintf("`%d x %d`", width, height), Inline: true},
+		{Name: "Steps", Value: fmt.Sprintf("`%d`", parameters.Steps), Inline: true},
+		{Name: "Scale", Value: fmt.Sprintf("`%0.1f`", parameters.Scale), Inline: true},
+		{Name: "Seed", Value: fmt.Sprintf("`%d`", parameters.Seed), Inline: true},
+		{Name: "Sampler", Value: fmt.Sprintf("`%s`", parameters.Sampler), Inline: true},
+	}
+	if parameters.Img2Img != nil {
+		fields = append(fields, img2imgFields(parameters)...)
+	}
+	if parameters.NegativePrompt != "" {
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:  "Negative prompt",
+			Value: fmt.Sprintf("```\n%s\n```", shortenTo(parameters.NegativePrompt, 1000)),
+		})
+	}
+
+	return &discordgo.MessageEmbed{
+		Title:       fmt.Sprintf("%s from the parameters of the image", item.Type),
+		Description: fmt.Sprintf("```\n%s\n```", shortenTo(item.Request.Input, 4000)),
+		Fields:      fields,
+	}
+}
+
+func shortenTo(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n-3] + "..."
+}
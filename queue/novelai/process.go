@@ -3,12 +3,14 @@ package novelai
 import (
 	"fmt"
 	"log"
+	"runtime/debug"
 	"sync"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
 
 	"stable_diffusion_bot/discord_bot/handlers"
+	"stable_diffusion_bot/reporting"
 )
 
 func (q *NAIQueue) next() error {
@@ -22,9 +24,19 @@ func (q *NAIQueue) next() error {
 	}
 	q.current = <-q.queue
 	defer q.done()
+
+	// a panic fails the item instead of stopping the queue, it runs before done clears current
+	item := q.current
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			q.failPanicked(item, recovered)
+		}
+	}()
 	requireInteraction(q.current.DiscordInteraction)
 
 	q.mu.Lock()
+	q.queuedWork = max(q.queuedWork-work(q.current), 0)
+	q.currentStarted = time.Now()
 	if q.cancelled[q.current.DiscordInteraction.ID] {
 		// If the item is cancelled, skip it
 		delete(q.cancelled, q.current.DiscordInteraction.ID)
@@ -32,11 +44,14 @@ func (q *NAIQueue) next() error {
 		return nil
 	}
 	q.mu.Unlock()
+	q.waits.Record(time.Since(q.current.Created))
 
 	switch q.current.Type {
 	case ItemTypeImage, ItemTypeVibeTransfer, ItemTypeImg2Img:
 		interaction, err := q.processCurrentItem()
 		if err != nil {
+			reporting.Error(err, map[string]string{"queue": "novelai", "type": q.current.Type},
+				map[string]any{"interaction_id": q.current.DiscordInteraction.ID, "guild_id": q.current.DiscordInteraction.GuildID})
 			if interaction == nil {
 				return err
 			}
@@ -49,6 +64,19 @@ func (q *NAIQueue) next() error {
 	return nil
 }
 
+// failPanicked reports the panic and tells the member their item failed, so the queue moves on to the next item
+func (q *NAIQueue) failPanicked(item *NAIQueueItem, recovered any) {
+	log.Printf("Recovered from panic while processing item: %v\n%s", recovered, debug.Stack())
+
+	tags := map[string]string{"queue": "novelai", "type": item.Type}
+	if item.DiscordInteraction == nil {
+		reporting.Panic(recovered, tags, nil)
+		return
+	}
+	reporting.Panic(recovered, tags, map[string]any{"interaction_id": item.DiscordInteraction.ID, "guild_id": item.DiscordInteraction.GuildID})
+	_ = handlers.ErrorEdit(q.botSession, item.DiscordInteraction, fmt.Errorf("error processing current item: panic: %v", recovered))
+}
+
 func requireInteraction(i *discordgo.Interaction) {
 	if i != nil {
 		return
@@ -63,10 +91,11 @@ func (q *NAIQueue) done() {
 	q.mu.Unlock()
 }
 
-// updateWaiting updates all queued items with their new position
+// updateWaiting updates all queued items with their new position and how long they're estimated to wait
 func (q *NAIQueue) updateWaiting() {
 	items := len(q.queue)
 
+	q.queuedWork = 0
 	if items == 0 {
 		return
 	}
@@ -83,6 +112,8 @@ func (q *NAIQueue) updateWaiting() {
 		}
 		item.pos = position
 		position++
+		item.eta = q.latencies.estimate(q.queuedWork)
+		q.queuedWork += work(item)
 		finished <- item
 
 		updated.Add(1)
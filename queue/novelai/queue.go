@@ -3,6 +3,7 @@ package novelai
 import (
 	"errors"
 	"log"
+	"net/http"
 	"os"
 	"sync"
 	"time"
@@ -11,18 +12,52 @@ import (
 
 	"stable_diffusion_bot/api/novelai"
 	"stable_diffusion_bot/composite_renderer"
+	"stable_diffusion_bot/entities"
+	"stable_diffusion_bot/maintenance"
+	"stable_diffusion_bot/prompt_template"
 	"stable_diffusion_bot/queue"
+	"stable_diffusion_bot/repositories/image_generations"
+	"stable_diffusion_bot/repositories/prompt_snippets"
+	"stable_diffusion_bot/repositories/usage"
 )
 
-func New(token *string) queue.Queue[*NAIQueueItem] {
-	if token == nil {
+type Config struct {
+	Token     *string
+	UsageRepo usage.Repository
+	// ImageGenerationRepo records the generations so they can be looked up, counted in /stats and re-rolled
+	ImageGenerationRepo image_generations.Repository
+	// Transport sends the requests to NovelAI, e.g. through a proxy. Default is http.DefaultTransport
+	Transport http.RoundTripper
+	// MaxMegapixels is the largest image requested for members other than the bot owner. Default is 0, which doesn't
+	// limit them
+	MaxMegapixels float64
+	// AnlasBudget is what members other than the bot owner can spend per day and month. Without one, requests
+	// costing 10 Anlas or more are refused
+	AnlasBudget entities.AnlasBudget
+	// Retry is how generations are retried while NovelAI is busy. Default is novelai.DefaultRetryPolicy
+	Retry novelai.RetryPolicy
+	// PromptSnippetRepo looks up the snippets of {snippet:name} in prompts. Without one, only the other variables
+	// are expanded
+	PromptSnippetRepo prompt_snippets.Repository
+}
+
+func New(cfg Config) queue.Queue[*NAIQueueItem] {
+	if cfg.Token == nil {
 		return nil
 	}
 	return &NAIQueue{
-		client:     novelai.NewNovelAIClient(*token),
+		client:     novelai.NewNovelAIClient(*cfg.Token, cfg.Transport, cfg.Retry),
 		queue:      make(chan *NAIQueueItem, 24),
 		cancelled:  make(map[string]bool),
+		confirming: make(map[string]*NAIQueueItem),
 		compositor: composite_renderer.Compositor(),
+		usageRepo:  cfg.UsageRepo,
+
+		imageGenerationRepo: cfg.ImageGenerationRepo,
+		promptSnippetRepo:   cfg.PromptSnippetRepo,
+
+		maxMegapixels: cfg.MaxMegapixels,
+		anlasBudget:   cfg.AnlasBudget,
 	}
 }
 
@@ -34,10 +69,24 @@ type NAIQueue struct {
 	queue     chan *NAIQueueItem
 	current   *NAIQueueItem
 	cancelled map[string]bool
-	mu        sync.Mutex
+	// queuedWork is the work of the items in the queue, see work, and currentStarted when current was taken from it
+	queuedWork     float64
+	currentStarted time.Time
+	latencies      latencies
+	waits          queue.Waits
+	// confirming are the items read from an image, waiting for the member to confirm them
+	confirming map[string]*NAIQueueItem
+	mu         sync.Mutex
 
 	compositor composite_renderer.Renderer
 
+	usageRepo           usage.Repository
+	imageGenerationRepo image_generations.Repository
+	promptSnippetRepo   prompt_snippets.Repository
+
+	maxMegapixels float64
+	anlasBudget   entities.AnlasBudget
+
 	stop chan os.Signal
 }
 
@@ -68,6 +117,17 @@ Polling:
 }
 
 func (q *NAIQueue) Add(item *NAIQueueItem) (int, error) {
+	if err := maintenance.Check(); err != nil {
+		return -1, err
+	}
+	if request := item.Request; request != nil {
+		err := prompt_template.ExpandAll(prompt_template.InteractionVars(item.DiscordInteraction, q.promptSnippetRepo),
+			&request.Input, &request.Parameters.Prompt, &request.Parameters.NegativePrompt)
+		if err != nil {
+			return -1, err
+		}
+	}
+
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
@@ -76,6 +136,11 @@ func (q *NAIQueue) Add(item *NAIQueueItem) (int, error) {
 	}
 
 	item.pos = len(q.queue)
+	item.eta = q.latencies.estimate(q.queuedWork)
+	if current := q.current; current != nil {
+		item.eta += max(q.latencies.estimate(work(current))-time.Since(q.currentStarted), 0)
+	}
+	q.queuedWork += work(item)
 	q.queue <- item
 
 	return item.pos, nil
@@ -108,6 +173,21 @@ func (q *NAIQueue) Interrupt(i *discordgo.Interaction) error {
 	return nil
 }
 
+func (q *NAIQueue) Summary() queue.Summary {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	summary := queue.Summary{
+		Name:        "NovelAI",
+		Depth:       len(q.queue),
+		AverageWait: q.waits.Average(),
+	}
+	if q.current != nil {
+		summary.Current = q.current.user
+		summary.Started = q.currentStarted
+	}
+	return summary
+}
+
 func (q *NAIQueue) Stop() {
 	if q.stop == nil {
 		q.stop = make(chan os.Signal)
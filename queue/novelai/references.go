@@ -0,0 +1,30 @@
+package novelai
+
+import (
+	"github.com/bwmarrin/discordgo"
+
+	"stable_diffusion_bot/discord_bot/handlers"
+	"stable_diffusion_bot/entities"
+	"stable_diffusion_bot/queue"
+)
+
+// GenerateFromReferences vibe transfers every reference at once, each with its own strength
+func (q *NAIQueue) GenerateFromReferences(s *discordgo.Session, i *discordgo.Interaction, prompt, negative string, references []queue.Reference) error {
+	item := q.NewItem(i, WithPrompt(prompt))
+	if item.Request.Model == entities.ModelV4Preview {
+		return handlers.ErrorEdit(s, i, "Vibe transfer is not yet supported for V4 models.")
+	}
+	if negative != "" {
+		item.Request.Parameters.NegativePrompt = negative
+	}
+
+	item.Type = ItemTypeVibeTransfer
+	parameters := &item.Request.Parameters
+	for _, reference := range references {
+		parameters.ReferenceImageMultiple = append(parameters.ReferenceImageMultiple, reference.Image)
+		parameters.ReferenceStrengthMultiple = append(parameters.ReferenceStrengthMultiple, reference.Strength)
+		parameters.ReferenceInformationExtractedMultiple = append(parameters.ReferenceInformationExtractedMultiple, 1)
+	}
+
+	return q.enqueue(s, item)
+}
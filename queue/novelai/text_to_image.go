@@ -1,6 +1,7 @@
 package novelai
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -33,11 +34,25 @@ func (q *NAIQueue) processCurrentItem() (*discordgo.Interaction, error) {
 		return item.DiscordInteraction, errors.New("request is nil")
 	}
 
-	cost := request.CalculateCost(true)
-	if cost >= 10 {
-		return item.DiscordInteraction, fmt.Errorf("cost is %d", cost)
+	q.fitMegapixels(item)
+	item.requested = snapshot(request)
+
+	if err := applyCharacterReference(item); err != nil {
+		return item.DiscordInteraction, err
 	}
 
+	cost, err := q.withinBudget(item, request.CalculateCost(true))
+	if errors.Is(err, errOverBudget) {
+		// the member was already told
+		return nil, nil
+	}
+	if err != nil {
+		return item.DiscordInteraction, err
+	}
+	item.cost = cost
+
+	start := time.Now()
+	item.retried = make(chan time.Duration, 1)
 	promise := make(chan error)
 	go func() {
 		promise <- q.processImagineGrid(item)
@@ -45,20 +60,80 @@ func (q *NAIQueue) processCurrentItem() (*discordgo.Interaction, error) {
 	}()
 
 	timeout := time.NewTimer(time.Minute)
-	select {
-	case err := <-promise:
-		if err != nil {
-			return item.DiscordInteraction, err
+Waiting:
+	for {
+		select {
+		case err := <-promise:
+			if err != nil {
+				return item.DiscordInteraction, err
+			}
+			drain(timeout)
+			q.recordUsage(item, cost, time.Since(start))
+			q.latencies.record(work(item), time.Since(start))
+			break Waiting
+		case wait := <-item.retried:
+			// the wait for NovelAI doesn't count towards the timeout
+			timeout.Reset(wait + time.Minute)
+		case <-timeout.C:
+			log.Printf("Timeout processing item %s for %s", item.DiscordInteraction.ID, item.user.Username)
+			return item.DiscordInteraction, errors.New("timeout")
 		}
-		drain(timeout)
-	case <-timeout.C:
-		log.Printf("Timeout processing item %s for %s", item.DiscordInteraction.ID, item.user.Username)
-		return item.DiscordInteraction, errors.New("timeout")
 	}
 
 	return item.DiscordInteraction, nil
 }
 
+// fitMegapixels scales the size of the item down to the novelai_max_megapixels budget, a multiple of 64 as NovelAI
+// expects. The bot owner's requests are left as they are.
+func (q *NAIQueue) fitMegapixels(item *NAIQueueItem) {
+	if q.maxMegapixels <= 0 || handlers.IsOwner(item.DiscordInteraction) {
+		return
+	}
+
+	parameters := &item.Request.Parameters
+	beforeWidth, beforeHeight := int(parameters.Width), int(parameters.Height)
+	if preset := parameters.ResolutionPreset; preset != nil {
+		beforeWidth, beforeHeight = int(preset[0]), int(preset[1])
+	}
+	width, height := utils.FitMegapixels(beforeWidth, beforeHeight, q.maxMegapixels, 64)
+	if width == beforeWidth && height == beforeHeight {
+		return
+	}
+
+	parameters.ResolutionPreset = nil
+	parameters.Width, parameters.Height = int64(width), int64(height)
+	log.Printf("Scaled %v down from %dx%d to %dx%d to fit %g megapixels", item.DiscordInteraction.ID, beforeWidth, beforeHeight, width, height, q.maxMegapixels)
+	_, err := handlers.EphemeralFollowup(q.botSession, item.DiscordInteraction,
+		fmt.Sprintf("Your image was scaled down from `%d x %d` to `%d x %d`, the largest this bot makes is %g megapixels.",
+			beforeWidth, beforeHeight, width, height, q.maxMegapixels),
+		discordgo.MessageFlagsEphemeral,
+	)
+	if err != nil {
+		log.Printf("Error sending megapixel notice: %v", err)
+	}
+}
+
+// recordUsage adds the generation and the Anlas spent to the member's daily usage ledger
+func (q *NAIQueue) recordUsage(item *NAIQueueItem, cost int64, elapsed time.Duration) {
+	if q.usageRepo == nil || item.user == nil {
+		return
+	}
+
+	parameters := item.Request.Parameters
+	images := int(parameters.ImageCount)
+	err := q.usageRepo.Record(context.Background(), &entities.Usage{
+		MemberID:   item.user.ID,
+		Backend:    entities.BackendNovelAI,
+		Images:     images,
+		Megapixels: float64(parameters.Width*parameters.Height*int64(images)) / 1_000_000,
+		GPUSeconds: elapsed.Seconds(),
+		Anlas:      cost,
+	})
+	if err != nil {
+		log.Printf("Error recording usage: %v", err)
+	}
+}
+
 func (q *NAIQueue) processImagineGrid(item *NAIQueueItem) error {
 	embed, err := q.showInitialMessage(item)
 	if err != nil {
@@ -72,12 +147,26 @@ func (q *NAIQueue) processImagineGrid(item *NAIQueueItem) error {
 	switch item.Type {
 	case ItemTypeImage, ItemTypeVibeTransfer, ItemTypeImg2Img:
 		item.Created = time.Now()
-		images, err := q.client.Inference(item.Request)
+		images, err := q.client.Inference(item.Request, func(attempt int, wait time.Duration, err error) {
+			log.Printf("Retrying %v in %s as NovelAI is busy: %v", item.DiscordInteraction.ID, wait, err)
+			notice := fmt.Sprintf("NovelAI is busy, trying again in %s (attempt %d of %d)", wait.Round(time.Second), attempt, q.client.RetryPolicy().Attempts)
+			item.retrying.Store(&notice)
+			select {
+			case item.retried <- wait:
+			default:
+			}
+		})
 		generationDone <- true
 		if err != nil {
 			return fmt.Errorf("error generating image: %w", err)
 		}
 
+		recorded := q.imageGenerationRepo != nil
+		if err := q.recordGeneration(item); err != nil {
+			log.Printf("Error recording generation: %v", err)
+			recorded = false
+		}
+
 		message := fmt.Sprintf("%s\n\nUploading image...", imagineMessageSimple(item.Request, item.user))
 		_, err = q.botSession.InteractionResponseEdit(item.DiscordInteraction, &discordgo.WebhookEdit{
 			Content: &message,
@@ -86,7 +175,7 @@ func (q *NAIQueue) processImagineGrid(item *NAIQueueItem) error {
 			return err
 		}
 
-		return q.showFinalMessage(item, images, embed)
+		return q.showFinalMessage(item, images, embed, recorded)
 	default:
 		return fmt.Errorf("unknown item type: %s", item.Type)
 	}
@@ -144,9 +233,10 @@ Ticker:
 
 			elapsed = tick.Sub(start).Round(time.Second).String()
 			progress := fmt.Sprintf("\r%s\n\n%s Time elapsed: %s", message, visual[frame], elapsed)
-			_, progressErr := q.botSession.InteractionResponseEdit(item.DiscordInteraction, &discordgo.WebhookEdit{
-				Content: &progress,
-			})
+			if notice := item.retrying.Load(); notice != nil {
+				progress += "\n" + *notice
+			}
+			progressErr := handlers.EditProgress(q.botSession, item.DiscordInteraction, progress)
 			if progressErr != nil {
 				log.Printf("Error editing progress: %v", progressErr)
 				break Ticker
@@ -165,7 +255,7 @@ func nextFrame(current, length int) int {
 	return (current + 1) % length
 }
 
-func (q *NAIQueue) showFinalMessage(item *NAIQueueItem, response *entities.NovelAIResponse, embed *discordgo.MessageEmbed) error {
+func (q *NAIQueue) showFinalMessage(item *NAIQueueItem, response *entities.NovelAIResponse, embed *discordgo.MessageEmbed, recorded bool) error {
 	request := item.Request
 	totalImages := int(request.Parameters.ImageCount)
 
@@ -181,7 +271,7 @@ func (q *NAIQueue) showFinalMessage(item *NAIQueueItem, response *entities.Novel
 	mention := fmt.Sprintf("<@%v>", user.ID)
 	webhook := &discordgo.WebhookEdit{
 		Content:    &mention,
-		Components: &[]discordgo.MessageComponent{handlers.Components[handlers.DeleteGeneration]},
+		Components: finalComponents(item, min(len(imageBuffers), totalImages), recorded),
 	}
 
 	embed = generationEmbedDetails(embed, item, getMetadata(response), item.Interrupt != nil, len(item.Request.Input) > 200)
@@ -204,10 +294,18 @@ func retrieveImagesFromResponse(response *entities.NovelAIResponse, item *NAIQue
 		thumbnails = append(thumbnails, image)
 	}
 
+	for _, image := range item.Request.Parameters.ReferenceImageMultiple {
+		thumbnails = append(thumbnails, image)
+	}
+
 	if image := item.Request.Parameters.Img2Img; image != nil {
 		thumbnails = append(thumbnails, image)
 	}
 
+	if reference := item.CharacterReference; reference != nil && reference.Image != nil {
+		thumbnails = append(thumbnails, reference.Image)
+	}
+
 	// if there are more images than requested, move the rest to thumbnails
 	if len(response.Images) > int(item.Request.Parameters.ImageCount) {
 		thumbnails = append(thumbnails, response.Images[item.Request.Parameters.ImageCount:]...)
@@ -287,6 +385,10 @@ func generationEmbedDetails(embed *discordgo.MessageEmbed, item *NAIQueueItem, m
 		switch request.Model {
 		case "":
 			break
+		case entities.ModelV45Full:
+			model = "NAI Diffusion V4.5 Full"
+		case entities.ModelV45Curated:
+			model = "NAI Diffusion V4.5 Curated"
 		case entities.ModelV4Full:
 			model = "NAI Diffusion Anime V4 Full"
 		case entities.ModelV4Preview:
@@ -342,9 +444,28 @@ func generationEmbedDetails(embed *discordgo.MessageEmbed, item *NAIQueueItem, m
 		}
 	}
 
+	if request.Parameters.Img2Img != nil {
+		embed.Fields = append(embed.Fields, img2imgFields(request.Parameters)...)
+	}
+	if reference := item.CharacterReference; reference != nil {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:   "Character reference",
+			Value:  fmt.Sprintf("fidelity: `%0.2f`", reference.Fidelity),
+			Inline: true,
+		})
+	}
+
 	return embed
 }
 
+// img2imgFields show the strength and noise an img2img item was made with
+func img2imgFields(parameters entities.Parameters) []*discordgo.MessageEmbedField {
+	return []*discordgo.MessageEmbedField{
+		{Name: "Strength", Value: fmt.Sprintf("`%0.2f`", parameters.Strength), Inline: true},
+		{Name: "Noise", Value: fmt.Sprintf("`%0.2f`", parameters.Noise), Inline: true},
+	}
+}
+
 func safeDereference(s *string) string {
 	if s == nil {
 		return "unknown"
@@ -372,28 +493,19 @@ func imagineMessageSimple(request *entities.NovelAIRequest, user *discordgo.User
 	return message.String()
 }
 
-// storeMessageInteraction stores the message interaction in the database to keep track of the message ID to recreate the message
+// storeMessageInteraction keeps the message of the item so its generation is recorded with the message ID
 func (q *NAIQueue) storeMessageInteraction(item *NAIQueueItem, message *discordgo.Message) (err error) {
-	// request := item.Request
-	//
-	// if item.DiscordInteraction == nil {
-	// 	return fmt.Errorf("item.DiscordInteraction is nil")
-	// }
-	//
-	// if message == nil {
-	// 	message, err = q.botSession.InteractionResponse(item.DiscordInteraction)
-	// 	if err != nil {
-	// 		return err
-	// 	}
-	// }
-	//
-	// // store message ID in c.DiscordInteraction.Message
-	// item.DiscordInteraction.Message = message
-	//
-	// request.InteractionID = item.DiscordInteraction.ID
-	// request.MessageID = item.DiscordInteraction.Message.ID
-	// request.MemberID = item.DiscordInteraction.Member.User.ID
-	// request.SortOrder = 0
-	// request.Processed = true
+	if item.DiscordInteraction == nil {
+		return fmt.Errorf("item.DiscordInteraction is nil")
+	}
+
+	if message == nil {
+		message, err = q.botSession.InteractionResponse(item.DiscordInteraction)
+		if err != nil {
+			return err
+		}
+	}
+
+	item.DiscordInteraction.Message = message
 	return nil
 }
@@ -0,0 +1,20 @@
+package queue
+
+import (
+	"github.com/bwmarrin/discordgo"
+
+	"stable_diffusion_bot/utils"
+)
+
+// Reference is an attached image a generation should look like, see Referencer
+type Reference struct {
+	Image *utils.Image
+	// Strength is how much the image guides the generation, from 0 to 1
+	Strength float64
+}
+
+// Referencer generates images like the references with the mechanism of its backend, e.g. NovelAI's vibe transfer.
+// The interaction has already been deferred.
+type Referencer interface {
+	GenerateFromReferences(s *discordgo.Session, i *discordgo.Interaction, prompt, negative string, references []Reference) error
+}
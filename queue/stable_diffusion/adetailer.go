@@ -0,0 +1,66 @@
+package stable_diffusion
+
+import (
+	"fmt"
+	"strings"
+
+	"stable_diffusion_bot/api/stable_diffusion_api"
+	"stable_diffusion_bot/discord_bot/handlers"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/sahilm/fuzzy"
+)
+
+// checkADetailerModels returns an error for the models of the ad_model option the extension doesn't have. Any model
+// is accepted until the models are cached.
+func checkADetailerModels(models string) error {
+	if models == "" || stable_diffusion_api.ADetailerModelCache == nil {
+		return nil
+	}
+	installed := *stable_diffusion_api.ADetailerModelCache
+	for _, model := range strings.Split(models, ",") {
+		if model = strings.TrimSpace(model); !installed.Has(model) {
+			return fmt.Errorf("the ADetailer model `%s` isn't installed", model)
+		}
+	}
+	return nil
+}
+
+// autocompleteADetailer suggests the installed models for the last model of the comma separated ad_model option,
+// keeping the models chosen before it
+func (q *SDQueue) autocompleteADetailer(i *discordgo.InteractionCreate, opt *discordgo.ApplicationCommandInteractionDataOption) error {
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	if q.hasFeature(stable_diffusion_api.FeatureADetailer) {
+		cache, err := stable_diffusion_api.ADetailerModelCache.GetCache(q.stableDiffusionAPI)
+		if err != nil {
+			return fmt.Errorf("error retrieving %v cache: %w", opt.Name, err)
+		}
+		models := *cache.(*stable_diffusion_api.ADetailerModels)
+
+		input := opt.StringValue()
+		chosen, last := "", strings.TrimSpace(input)
+		if index := strings.LastIndex(input, ","); index >= 0 {
+			chosen, last = input[:index+1], strings.TrimSpace(input[index+1:])
+		}
+
+		matches := models
+		if last != "" {
+			matches = nil
+			for _, match := range fuzzy.FindFrom(last, models) {
+				matches = append(matches, match.Str)
+			}
+		}
+		for _, model := range matches {
+			if value := chosen + model; len(value) <= 100 {
+				choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: value, Value: value})
+			}
+		}
+	}
+
+	return handlers.Wrap(q.botSession.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{
+			Choices: choices[:min(25, len(choices))],
+		},
+	}))
+}
@@ -0,0 +1,196 @@
+package stable_diffusion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"stable_diffusion_bot/api/stable_diffusion_api"
+	"stable_diffusion_bot/audit"
+	"stable_diffusion_bot/discord_bot/handlers"
+	"stable_diffusion_bot/entities"
+	"stable_diffusion_bot/utils"
+)
+
+// ErrItemNotFound is returned when cancelling an item that is neither queued nor being generated
+var ErrItemNotFound = errors.New("item is not in the queue")
+
+// QueuedItem describes an item in the queue for the admin API
+type QueuedItem struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	MemberID   string    `json:"member_id,omitempty"`
+	GuildID    string    `json:"guild_id,omitempty"`
+	ChannelID  string    `json:"channel_id,omitempty"`
+	Prompt     string    `json:"prompt,omitempty"`
+	Queued     time.Time `json:"queued"`
+	Processing bool      `json:"processing"`
+}
+
+// Stats is a summary of the generations since a day, for the admin API
+type Stats struct {
+	Since          time.Time              `json:"since"`
+	Images         int                    `json:"images"`
+	TopMembers     []*entities.StatsEntry `json:"top_members"`
+	TopCheckpoints []*entities.StatsEntry `json:"top_checkpoints"`
+}
+
+var itemTypeNames = map[ItemType]string{
+	ItemTypeImagine:   "imagine",
+	ItemTypeReroll:    "reroll",
+	ItemTypeUpscale:   "upscale",
+	ItemTypeVariation: "variation",
+	ItemTypeImg2Img:   "img2img",
+	ItemTypeRaw:       "raw",
+}
+
+// Items returns the item being generated followed by the queued items, oldest first
+func (q *SDQueue) Items() []QueuedItem {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	items := make([]QueuedItem, 0, len(q.pending)+len(q.backends))
+	for _, item := range q.runningItems() {
+		if item.DiscordInteraction != nil {
+			items = append(items, describeItem(item, true))
+		}
+	}
+
+	var pending []QueuedItem
+	for _, item := range q.pending {
+		pending = append(pending, describeItem(item, false))
+	}
+	slices.SortFunc(pending, func(a, b QueuedItem) int { return a.Queued.Compare(b.Queued) })
+
+	return append(items, pending...)
+}
+
+func describeItem(item *SDQueueItem, processing bool) QueuedItem {
+	described := QueuedItem{
+		ID:         item.DiscordInteraction.ID,
+		Type:       itemTypeNames[item.Type],
+		GuildID:    item.DiscordInteraction.GuildID,
+		ChannelID:  item.DiscordInteraction.ChannelID,
+		Queued:     item.queued,
+		Processing: processing,
+	}
+	if user := utils.GetUser(item.DiscordInteraction); user != nil {
+		described.MemberID = user.ID
+	}
+	if item.ImageGenerationRequest != nil && item.TextToImageRequest != nil {
+		described.Prompt = item.Prompt
+	}
+	return described
+}
+
+// Cancel removes a queued item, or interrupts it if it's being generated, and tells the member it was cancelled
+func (q *SDQueue) Cancel(id string) error {
+	q.mu.Lock()
+	for _, current := range q.runningItems() {
+		if current.DiscordInteraction == nil || current.DiscordInteraction.ID != id {
+			continue
+		}
+		interaction, interrupted := current.DiscordInteraction, current.Context().Err() != nil
+		q.mu.Unlock()
+		if interrupted {
+			return nil
+		}
+		return q.Interrupt(interaction)
+	}
+
+	item, ok := q.pending[id]
+	if !ok {
+		q.mu.Unlock()
+		return ErrItemNotFound
+	}
+	q.cancelledItems[id] = true
+	delete(q.pending, id)
+	q.mu.Unlock()
+
+	log.Printf("Generation #%s was cancelled through the admin API", id)
+	_, err := handlers.EditInteractionResponse(q.botSession, item.DiscordInteraction,
+		"Generation cancelled by an admin", handlers.Components[handlers.DeleteButton])
+	return err
+}
+
+// SetPaused holds the queue until it's resumed, the generation in progress is finished
+func (q *SDQueue) SetPaused(paused bool) {
+	q.mu.Lock()
+	changed := q.paused != paused
+	q.paused = paused
+	q.mu.Unlock()
+
+	switch {
+	case changed && paused:
+		audit.Post(audit.Event{Kind: audit.QueuePaused, Description: "The imagine queue was paused through the admin API"})
+	case changed:
+		audit.Post(audit.Event{Kind: audit.QueueResumed, Description: "The imagine queue was resumed through the admin API"})
+	}
+}
+
+func (q *SDQueue) isPaused() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.paused
+}
+
+// Stats returns how many images were generated since the day of since and by whom, across every guild if guildID
+// is empty
+func (q *SDQueue) Stats(ctx context.Context, guildID string, since time.Time, limit int) (*Stats, error) {
+	images, err := q.statsRepo.CountImages(ctx, guildID, "", since)
+	if err != nil {
+		return nil, fmt.Errorf("error counting images: %w", err)
+	}
+	members, err := q.statsRepo.TopMembers(ctx, guildID, since, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error getting top members: %w", err)
+	}
+	checkpoints, err := q.statsRepo.TopCheckpoints(ctx, guildID, "", since, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error getting top checkpoints: %w", err)
+	}
+	return &Stats{Since: since, Images: images, TopMembers: members, TopCheckpoints: checkpoints}, nil
+}
+
+// RefreshCaches reloads the loras, checkpoints, VAEs, samplers, schedulers and ADetailer models from the API like
+// /refresh all, returning how many of each were loaded
+func (q *SDQueue) RefreshCaches() (map[string]int, error) {
+	caches := map[string]stable_diffusion_api.Cacheable{
+		"loras":       stable_diffusion_api.LoraCache,
+		"checkpoints": stable_diffusion_api.CheckpointCache,
+		"vaes":        stable_diffusion_api.VAECache,
+		"samplers":    stable_diffusion_api.SamplerCache,
+		"schedulers":  stable_diffusion_api.SchedulerCache,
+	}
+	if q.hasFeature(stable_diffusion_api.FeatureADetailer) {
+		caches["adetailer models"] = stable_diffusion_api.ADetailerModelCache
+	}
+
+	loaded := make(map[string]int, len(caches))
+	var errs []error
+	for name, cache := range caches {
+		refreshed, err := q.stableDiffusionAPI.RefreshCache(cache)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error refreshing %s: %w", name, err))
+			continue
+		}
+		if refreshed == nil {
+			errs = append(errs, fmt.Errorf("error refreshing %s: no cache returned", name))
+			continue
+		}
+		loaded[name] = refreshed.Len()
+	}
+	return loaded, errors.Join(errs...)
+}
+
+// Concurrency reports the requests to each backend in flight and waiting for a slot of api_max_concurrent
+func (q *SDQueue) Concurrency() []stable_diffusion_api.ConcurrencyStats {
+	var stats []stable_diffusion_api.ConcurrencyStats
+	for _, b := range q.backends {
+		stats = append(stats, b.api.Concurrency()...)
+	}
+	return stats
+}
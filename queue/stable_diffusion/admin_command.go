@@ -0,0 +1,214 @@
+package stable_diffusion
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"stable_diffusion_bot/audit"
+	"stable_diffusion_bot/diagnostics"
+	"stable_diffusion_bot/discord_bot/handlers"
+	"stable_diffusion_bot/maintenance"
+	"stable_diffusion_bot/utils"
+)
+
+// Subcommand groups and subcommands of /admin
+const (
+	adminDebugGroup       = "debug"
+	adminGoroutinesOption = "goroutines"
+	adminHeapOption       = "heap"
+
+	adminMaintenanceGroup = "maintenance"
+	adminOnOption         = "on"
+	adminOffOption        = "off"
+	maintenanceMessage    = "message"
+	maintenanceETA        = "eta"
+
+	adminBackendGroup       = "backend"
+	adminCapabilitiesOption = "capabilities"
+	adminConcurrencyOption  = "concurrency"
+)
+
+// adminOptions are the subcommands of /admin, which act on the whole bot and are only run for the bot owner
+func adminOptions() []*discordgo.ApplicationCommandOption {
+	return []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommandGroup,
+			Name:        adminDebugGroup,
+			Description: "Diagnose a stuck queue or growing memory",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        adminGoroutinesOption,
+					Description: "Count the goroutines and attach their stacks",
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        adminHeapOption,
+					Description: "Summarize the memory in use and attach a heap profile",
+				},
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommandGroup,
+			Name:        adminMaintenanceGroup,
+			Description: "Reject new requests while the queued ones finish, e.g. to upgrade the backend",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        adminOnOption,
+					Description: "Turn maintenance on, or change its message",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        maintenanceMessage,
+							Description: "Shown to members instead of queueing their request",
+							MaxLength:   1000,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Name:        maintenanceETA,
+							Description: "Minutes until the bot is expected back",
+							MinValue:    new(float64),
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        adminOffOption,
+					Description: "Turn maintenance off and accept requests again",
+				},
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommandGroup,
+			Name:        adminBackendGroup,
+			Description: "Inspect the Stable Diffusion backend",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        adminCapabilitiesOption,
+					Description: "Probe which features the backend serves and turn off the missing ones",
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        adminConcurrencyOption,
+					Description: "Show the requests in flight and how long they waited for api_max_concurrent",
+				},
+			},
+		},
+	}
+}
+
+func (q *SDQueue) processAdminCommand(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	if err := handlers.EphemeralThink(s, i); err != nil {
+		return err
+	}
+	if !handlers.IsOwner(i.Interaction) {
+		return handlers.ErrorEdit(s, i.Interaction, "Only the bot owner can use this command.")
+	}
+
+	data := i.ApplicationCommandData()
+	if len(data.Options) == 0 || len(data.Options[0].Options) == 0 {
+		return handlers.ErrorEdit(s, i.Interaction, "You need to choose a subcommand.")
+	}
+	group, subcommand := data.Options[0], data.Options[0].Options[0]
+
+	switch group.Name + " " + subcommand.Name {
+	case adminDebugGroup + " " + adminGoroutinesOption:
+		count, dump, err := diagnostics.Goroutines()
+		if err != nil {
+			return handlers.ErrorEdit(s, i.Interaction, "Error dumping goroutines.", err)
+		}
+		content := fmt.Sprintf("**Goroutines**: `%d`, identical stacks are grouped in the attachment.\n**Queue**: `%+v`", count, q.Status())
+		_, err = handlers.EditInteractionResponse(s, i.Interaction, &discordgo.WebhookEdit{
+			Content: &content,
+			Files: []*discordgo.File{{
+				Name:        "goroutines.txt",
+				ContentType: "text/plain",
+				Reader:      bytes.NewReader(dump),
+			}},
+		})
+		return err
+	case adminDebugGroup + " " + adminHeapOption:
+		profile, err := diagnostics.HeapProfile()
+		if err != nil {
+			return handlers.ErrorEdit(s, i.Interaction, "Error writing the heap profile.", err)
+		}
+		content := fmt.Sprintf("```\n%s\n```Open the profile with `go tool pprof heap.pprof`.", diagnostics.HeapSummary())
+		_, err = handlers.EditInteractionResponse(s, i.Interaction, &discordgo.WebhookEdit{
+			Content: &content,
+			Files: []*discordgo.File{{
+				Name:        "heap.pprof",
+				ContentType: "application/octet-stream",
+				Reader:      bytes.NewReader(profile),
+			}},
+		})
+		return err
+	case adminMaintenanceGroup + " " + adminOnOption:
+		var message string
+		var eta time.Duration
+		for _, option := range subcommand.Options {
+			switch option.Name {
+			case maintenanceMessage:
+				message = option.StringValue()
+			case maintenanceETA:
+				eta = time.Duration(option.IntValue()) * time.Minute
+			}
+		}
+		state := maintenance.Start(message, eta)
+		audit.Post(audit.Event{
+			Kind:        audit.MaintenanceStarted,
+			Description: state.Notice(),
+			UserID:      utils.GetUser(i.Interaction).ID,
+		})
+		_, err := handlers.EditInteractionResponse(s, i.Interaction, fmt.Sprintf(
+			"Maintenance is on, %d queued items will still be processed. Members now see:\n>>> %s", q.Status().Pending, state.Notice()))
+		return err
+	case adminMaintenanceGroup + " " + adminOffOption:
+		state, ok := maintenance.Stop()
+		if !ok {
+			_, err := handlers.EditInteractionResponse(s, i.Interaction, "Maintenance is already off.")
+			return err
+		}
+		audit.Post(audit.Event{
+			Kind:        audit.MaintenanceEnded,
+			Description: fmt.Sprintf("After %s", time.Since(state.Since).Round(time.Second)),
+			UserID:      utils.GetUser(i.Interaction).ID,
+		})
+		_, err := handlers.EditInteractionResponse(s, i.Interaction, "Maintenance is off, new requests are accepted again.")
+		return err
+	case adminBackendGroup + " " + adminCapabilitiesOption:
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		capabilities, err := q.stableDiffusionAPI.Capabilities(ctx)
+		if err != nil {
+			return handlers.ErrorEdit(s, i.Interaction, "Error probing the backend.", err)
+		}
+		q.SetCapabilities(capabilities)
+		content := fmt.Sprintf("```\n%s\n```Missing features are rejected from now on, their /%s options are removed on the next restart.",
+			capabilities, ImagineCommand)
+		_, err = handlers.EditInteractionResponse(s, i.Interaction, content)
+		return err
+	case adminBackendGroup + " " + adminConcurrencyOption:
+		stats := q.Concurrency()
+		if len(stats) == 0 {
+			_, err := handlers.EditInteractionResponse(s, i.Interaction, "Requests to the backend aren't limited, set api_max_concurrent to limit them.")
+			return err
+		}
+		var content strings.Builder
+		for _, host := range stats {
+			fmt.Fprintf(&content, "**%s**: `%d/%d` in flight, `%d` waiting\n", host.Host, host.InFlight, host.Limit, host.Waiting)
+			fmt.Fprintf(&content, "`%d` of `%d` requests waited for a slot, `%s` in total, `%s` at most\n",
+				host.Contended, host.Requests, host.WaitTime.Round(time.Millisecond), host.MaxWait.Round(time.Millisecond))
+		}
+		_, err := handlers.EditInteractionResponse(s, i.Interaction, content.String())
+		return err
+	default:
+		return handlers.ErrorEdit(s, i.Interaction, fmt.Sprintf("Unknown subcommand: %s %s", group.Name, subcommand.Name))
+	}
+}
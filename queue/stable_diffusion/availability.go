@@ -0,0 +1,135 @@
+package stable_diffusion
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"stable_diffusion_bot/discord_bot/handlers"
+	"stable_diffusion_bot/utils"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// backendCheckInterval is how often the backends are checked, both to notice one going down and to use it again once
+// it's back
+const backendCheckInterval = 15 * time.Second
+
+// backendAvailable reports whether the last check found any backend up. The queue is held while they're all down.
+func (q *SDQueue) backendAvailable() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return !q.backendDown
+}
+
+// checkBackend checks each backend, items aren't dispatched to the ones that are down. The channels of queued
+// generations are notified when every backend is down, and the members waiting on them once one is back.
+func (q *SDQueue) checkBackend() {
+	var alive bool
+	for _, b := range q.backends {
+		up := handlers.CheckAPIAlive(b.api.Host())
+		alive = alive || up
+
+		q.mu.Lock()
+		wasDown := b.down
+		b.down = !up
+		q.mu.Unlock()
+
+		if len(q.backends) == 1 {
+			continue
+		}
+		switch {
+		case !up && !wasDown:
+			log.Printf("Stable Diffusion API at %s is not responding, generations go to the other backends", b.api.Host())
+		case up && wasDown:
+			log.Printf("Stable Diffusion API at %s is back, generations are sent to it again", b.api.Host())
+		}
+	}
+
+	q.mu.Lock()
+	wasDown := q.backendDown
+	q.backendDown = !alive
+
+	var held, resumed []*discordgo.Interaction
+	switch {
+	case !alive:
+		// items queued during the outage are told they're held too
+		for id, item := range q.pending {
+			if _, ok := q.held[id]; !ok {
+				q.held[id] = item.DiscordInteraction
+				held = append(held, item.DiscordInteraction)
+			}
+		}
+	case wasDown:
+		for id, interaction := range q.held {
+			if _, ok := q.pending[id]; ok {
+				resumed = append(resumed, interaction)
+			}
+		}
+		clear(q.held)
+	}
+	q.mu.Unlock()
+
+	switch {
+	case !alive && !wasDown:
+		log.Printf("Stable Diffusion API at %s is not responding, holding the queue", q.backendHosts())
+	case alive && wasDown:
+		log.Printf("Stable Diffusion API at %s is back, resuming the queue", q.backendHosts())
+	}
+
+	for channelID, members := range byChannel(held) {
+		q.sendStatus(channelID, fmt.Sprintf(
+			"The Stable Diffusion backend is offline. Queued generations by %s are on hold and will start automatically once it's back.",
+			strings.Join(members, ", ")), false)
+	}
+	for channelID, members := range byChannel(resumed) {
+		q.sendStatus(channelID, fmt.Sprintf(
+			"The Stable Diffusion backend is back online, resuming queued generations for %s.",
+			strings.Join(members, ", ")), true)
+	}
+}
+
+// backendHosts lists the hosts of the backends for logs
+func (q *SDQueue) backendHosts() string {
+	hosts := make([]string, len(q.backends))
+	for n, b := range q.backends {
+		hosts[n] = b.api.Host()
+	}
+	return strings.Join(hosts, ", ")
+}
+
+// byChannel groups the mentions of the members of interactions by the channel they were made in
+func byChannel(interactions []*discordgo.Interaction) map[string][]string {
+	channels := make(map[string][]string)
+	for _, interaction := range interactions {
+		user := utils.GetUser(interaction)
+		if user == nil {
+			continue
+		}
+		mention := fmt.Sprintf("<@%s>", user.ID)
+		if !slices.Contains(channels[interaction.ChannelID], mention) {
+			channels[interaction.ChannelID] = append(channels[interaction.ChannelID], mention)
+		}
+	}
+	for _, mentions := range channels {
+		slices.Sort(mentions)
+	}
+	return channels
+}
+
+// sendStatus posts a notice in the channel, only pinging the mentioned members if ping is set
+func (q *SDQueue) sendStatus(channelID, content string, ping bool) {
+	allowed := &discordgo.MessageAllowedMentions{}
+	if ping {
+		allowed.Parse = []discordgo.AllowedMentionType{discordgo.AllowedMentionTypeUsers}
+	}
+	_, err := q.botSession.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+		Content:         content,
+		AllowedMentions: allowed,
+	})
+	if err != nil {
+		log.Printf("Error posting backend status in channel %s: %v", channelID, err)
+	}
+}
@@ -0,0 +1,134 @@
+package stable_diffusion
+
+import (
+	"log"
+	"slices"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"stable_diffusion_bot/api/stable_diffusion_api"
+)
+
+// backend is an API items are generated on, one at a time. Its fields are guarded by SDQueue.mu.
+type backend struct {
+	api     stable_diffusion_api.StableDiffusionAPI
+	current *SDQueueItem // the item being generated, nil while idle
+	down    bool         // the last check found the API not responding
+}
+
+// api returns the API the item was dispatched to, or the first backend before it was
+func (q *SDQueue) api(item *SDQueueItem) stable_diffusion_api.StableDiffusionAPI {
+	if item.backend != nil {
+		return item.backend.api
+	}
+	return q.stableDiffusionAPI
+}
+
+// dispatch starts the queued items on the idle backends that are up, in the order they were queued
+func (q *SDQueue) dispatch() {
+	for {
+		q.mu.Lock()
+		idle := q.idleBackend()
+		if idle == nil || len(q.retries)+len(q.queue) == 0 {
+			q.mu.Unlock()
+			return
+		}
+		var item *SDQueueItem
+		if len(q.retries) > 0 {
+			item, q.retries = q.retries[0], q.retries[1:]
+		} else {
+			// dispatch is the only receiver, so the queue can't be emptied in between
+			item = <-q.queue
+		}
+		item.backend, idle.current = idle, item
+		item.started = time.Now()
+		q.mu.Unlock()
+
+		q.workers.Add(1)
+		go func() {
+			defer q.workers.Done()
+			if err := q.next(item); err != nil {
+				log.Printf("Error processing next item: %v", err)
+			}
+		}()
+	}
+}
+
+// retry puts the item back at the head of the queue after its backend died mid-generation, so it runs on one that's
+// up instead of failing. Items are only retried once per other backend and never while they're all down.
+func (q *SDQueue) retry(item *SDQueueItem) bool {
+	if !retryable(item.Type) {
+		return false
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.backendDown || item.attempts >= len(q.backends)-1 {
+		return false
+	}
+	if q.cancelledItems[item.DiscordInteraction.ID] {
+		return false
+	}
+	item.attempts++
+	item.backend.down = true
+	item.backend = nil
+	q.pending[item.DiscordInteraction.ID] = item
+	q.retries = append(q.retries, item)
+	return true
+}
+
+// retryable reports whether items of the type can start over, variations and upscales look up the message they were
+// made on, which was replaced by the first attempt
+func retryable(itemType ItemType) bool {
+	return itemType == ItemTypeImagine || itemType == ItemTypeRaw || itemType == ItemTypeImg2Img
+}
+
+// idleBackend returns the first backend that's up and not generating, nil if there is none. q.mu must be held.
+func (q *SDQueue) idleBackend() *backend {
+	for _, b := range q.backends {
+		if b.current == nil && !b.down {
+			return b
+		}
+	}
+	return nil
+}
+
+// runningItems returns the items being generated, the earliest started first. q.mu must be held.
+func (q *SDQueue) runningItems() []*SDQueueItem {
+	var items []*SDQueueItem
+	for _, b := range q.backends {
+		if b.current != nil {
+			items = append(items, b.current)
+		}
+	}
+	slices.SortFunc(items, func(a, b *SDQueueItem) int { return a.started.Compare(b.started) })
+	return items
+}
+
+// runningItem returns the item being generated for the interaction, or for the message the interaction was made
+// on. The only item being generated is returned if none matches. q.mu must be held.
+func (q *SDQueue) runningItem(i *discordgo.Interaction) *SDQueueItem {
+	items := q.runningItems()
+	for _, item := range items {
+		interaction := item.DiscordInteraction
+		if interaction == nil {
+			continue
+		}
+		if interaction.ID == i.ID {
+			return item
+		}
+		if i.Message == nil {
+			continue
+		}
+		if interaction.Message != nil && interaction.Message.ID == i.Message.ID {
+			return item
+		}
+		if i.Message.InteractionMetadata != nil && i.Message.InteractionMetadata.ID == interaction.ID {
+			return item
+		}
+	}
+	if len(items) == 1 {
+		return items[0]
+	}
+	return nil
+}
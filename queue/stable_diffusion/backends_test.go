@@ -0,0 +1,56 @@
+package stable_diffusion
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestRetryOnAnotherBackend(t *testing.T) {
+	dead, live := &backend{}, &backend{}
+	q := &SDQueue{
+		backends:       []*backend{dead, live},
+		pending:        make(map[string]*SDQueueItem),
+		cancelledItems: make(map[string]bool),
+	}
+	item := &SDQueueItem{Type: ItemTypeImagine, DiscordInteraction: &discordgo.Interaction{ID: "1"}, backend: dead}
+	dead.current = item
+
+	if !q.retry(item) {
+		t.Fatal("item wasn't retried while another backend is up")
+	}
+	if !dead.down || item.backend != nil {
+		t.Errorf("backend down = %v, item backend = %v, want the dead backend marked down and the item unassigned", dead.down, item.backend)
+	}
+	if len(q.retries) != 1 || q.pending["1"] != item {
+		t.Errorf("item isn't queued for a retry: retries %d, pending %v", len(q.retries), q.pending["1"])
+	}
+	if idle := q.idleBackend(); idle != live {
+		t.Errorf("idle backend = %p, want the live one %p", idle, live)
+	}
+
+	item.backend = live
+	if q.retry(item) {
+		t.Error("item was retried more often than there are other backends")
+	}
+}
+
+func TestRetryWhileEveryBackendIsDown(t *testing.T) {
+	b := &backend{}
+	q := &SDQueue{
+		backends:       []*backend{b, {}},
+		pending:        make(map[string]*SDQueueItem),
+		cancelledItems: make(map[string]bool),
+		backendDown:    true,
+	}
+	item := &SDQueueItem{Type: ItemTypeImagine, DiscordInteraction: &discordgo.Interaction{ID: "1"}, backend: b}
+	if q.retry(item) {
+		t.Error("item was retried while every backend is down")
+	}
+
+	q.backendDown = false
+	item.Type = ItemTypeVariation
+	if q.retry(item) {
+		t.Error("variation was retried, it looks up the message replaced by the first attempt")
+	}
+}
@@ -0,0 +1,55 @@
+package stable_diffusion
+
+import (
+	"bytes"
+	"io"
+
+	"stable_diffusion_bot/composite_renderer"
+	"stable_diffusion_bot/discord_bot/handlers"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// maxBatchMessages is how many recent generations keep their batch images in memory to animate
+	maxBatchMessages = 16
+	// batchFrameDelay is how long each image of an animated batch is shown in 100ths of a second
+	batchFrameDelay = 80
+)
+
+// processAnimateBatchButton renders the images of a batch, the same prompt with different seeds, into a looping GIF
+func (q *SDQueue) processAnimateBatchButton(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	if err := handlers.EphemeralThink(s, i); err != nil {
+		return err
+	}
+
+	if i.Message == nil {
+		return handlers.ErrorEdit(s, i.Interaction, "Could not find the generation to animate.")
+	}
+
+	batch, ok := q.batches.get(i.Message.ID)
+	if !ok || len(batch) < 2 {
+		return handlers.ErrorEdit(s, i.Interaction, "Batch images are only kept for recent generations while the bot is running.")
+	}
+
+	frames := make([]io.Reader, len(batch))
+	for index, image := range batch {
+		frames[index] = bytes.NewReader(image)
+	}
+	animation, err := composite_renderer.Animate(frames, composite_renderer.AnimateOptions{
+		Delay:    batchFrameDelay,
+		HoldLast: batchFrameDelay,
+	})
+	if err != nil {
+		return handlers.ErrorEdit(s, i.Interaction, "Error animating batch.", err)
+	}
+
+	_, err = handlers.EditInteractionResponse(s, i.Interaction, &discordgo.WebhookEdit{
+		Files: []*discordgo.File{{
+			Name:        "batch.gif",
+			ContentType: "image/gif",
+			Reader:      animation,
+		}},
+	})
+	return err
+}
@@ -0,0 +1,38 @@
+package stable_diffusion
+
+import "sync"
+
+// recentCache keeps a value for each of the most recent messages, evicting the oldest when full
+type recentCache[T any] struct {
+	mu    sync.Mutex
+	size  int
+	items map[string]T
+	order []string
+}
+
+func newRecentCache[T any](size int) *recentCache[T] {
+	return &recentCache[T]{size: size, items: make(map[string]T, size)}
+}
+
+func (c *recentCache[T]) store(key string, value T) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.items[key]; !ok {
+		c.order = append(c.order, key)
+	}
+	c.items[key] = value
+
+	for len(c.order) > c.size {
+		delete(c.items, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+func (c *recentCache[T]) get(key string) (T, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	value, ok := c.items[key]
+	return value, ok
+}
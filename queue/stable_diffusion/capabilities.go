@@ -0,0 +1,84 @@
+package stable_diffusion
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/bwmarrin/discordgo"
+
+	"stable_diffusion_bot/api/stable_diffusion_api"
+	"stable_diffusion_bot/entities"
+)
+
+// featureOptions are the /imagine options dropped when the backend doesn't serve their feature
+var featureOptions = map[stable_diffusion_api.Feature][]CommandOption{
+	stable_diffusion_api.FeatureImageToImage: {img2imgOption, denoisingOption},
+	stable_diffusion_api.FeatureADetailer:    {adModelOption},
+	stable_diffusion_api.FeatureControlNet: {
+		controlnetImage,
+		controlnetControlMode,
+		controlnetType,
+		controlnetResizeMode,
+		controlnetPreprocessor,
+		controlnetModel,
+	},
+}
+
+// SetCapabilities turns off the features the backend was found not to serve. Set it before the bot starts so
+// their command options aren't registered.
+func (q *SDQueue) SetCapabilities(capabilities stable_diffusion_api.Capabilities) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.capabilities = capabilities
+}
+
+func (q *SDQueue) hasFeature(feature stable_diffusion_api.Feature) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.capabilities.Has(feature)
+}
+
+// withoutMissingFeatures removes the options of the features the backend doesn't serve
+func (q *SDQueue) withoutMissingFeatures(options []*discordgo.ApplicationCommandOption) []*discordgo.ApplicationCommandOption {
+	for feature, names := range featureOptions {
+		if q.hasFeature(feature) {
+			continue
+		}
+		options = slices.DeleteFunc(options, func(option *discordgo.ApplicationCommandOption) bool {
+			return slices.Contains(names, option.Name)
+		})
+	}
+	return options
+}
+
+// checkFeatures returns an error if the item needs a feature the backend doesn't serve, so it's rejected before
+// it's queued instead of failing when it's processed
+func (q *SDQueue) checkFeatures(item *SDQueueItem) error {
+	var needed []stable_diffusion_api.Feature
+	switch item.Type {
+	case ItemTypeImg2Img:
+		needed = append(needed, stable_diffusion_api.FeatureImageToImage)
+	case ItemTypeUpscale:
+		needed = append(needed, stable_diffusion_api.FeatureUpscale)
+	case ItemTypeRaw:
+		return nil
+	}
+	// rerolls and variations carry the scripts of the generation they're made from
+	var scripts entities.Scripts
+	if item.ImageGenerationRequest != nil && item.TextToImageRequest != nil {
+		scripts = item.Scripts
+	}
+	if item.ADetailerString != "" || scripts.ADetailer != nil {
+		needed = append(needed, stable_diffusion_api.FeatureADetailer)
+	}
+	if item.ControlnetItem.Enabled || scripts.ControlNet != nil {
+		needed = append(needed, stable_diffusion_api.FeatureControlNet)
+	}
+
+	for _, feature := range needed {
+		if !q.hasFeature(feature) {
+			return fmt.Errorf("%s isn't available, the backend doesn't serve it", feature)
+		}
+	}
+	return checkADetailerModels(item.ADetailerString)
+}
@@ -0,0 +1,239 @@
+package stable_diffusion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+
+	"stable_diffusion_bot/api/stable_diffusion_api"
+	"stable_diffusion_bot/discord_bot/handlers"
+	"stable_diffusion_bot/entities"
+	"stable_diffusion_bot/repositories"
+)
+
+// Subcommands and options of /channel-defaults. The checkpoint and vae options share their names with /imagine
+const (
+	channelDefaultsSetOption   = "channel_defaults_set"
+	channelDefaultsClearOption = "channel_defaults_clear"
+	channelDefaultsListOption  = "channel_defaults_list"
+
+	channelDefaultsChannelOption = "channel"
+	channelDefaultsStyleOption   = "style"
+)
+
+func channelDefaultsOptions() []*discordgo.ApplicationCommandOption {
+	channelOption := &discordgo.ApplicationCommandOption{
+		Type:         discordgo.ApplicationCommandOptionChannel,
+		Name:         channelDefaultsChannelOption,
+		Description:  "Channel to change. Default is this channel",
+		ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText, discordgo.ChannelTypeGuildForum},
+	}
+	return []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        strings.TrimPrefix(channelDefaultsSetOption, "channel_defaults_"),
+			Description: "Set what /imagine uses in a channel when members don't choose it, replacing the previous defaults",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:         discordgo.ApplicationCommandOptionString,
+					Name:         checkpointOption,
+					Description:  "Checkpoint to use",
+					Autocomplete: true,
+				},
+				{
+					Type:         discordgo.ApplicationCommandOptionString,
+					Name:         vaeOption,
+					Description:  "VAE to use",
+					Autocomplete: true,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        channelDefaultsStyleOption,
+					Description: "Name of a style saved in the web UI, added to the prompts",
+					MaxLength:   100,
+				},
+				channelOption,
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        strings.TrimPrefix(channelDefaultsClearOption, "channel_defaults_"),
+			Description: "Go back to the defaults of the bot in a channel",
+			Options:     []*discordgo.ApplicationCommandOption{channelOption},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        strings.TrimPrefix(channelDefaultsListOption, "channel_defaults_"),
+			Description: "List the channels of this server with their own defaults",
+		},
+	}
+}
+
+// channelDefaults returns the defaults of the channel, or nil if it has none
+func (q *SDQueue) channelDefaults(channelID string) *entities.ChannelDefault {
+	if channelID == "" {
+		return nil
+	}
+
+	defaults, err := q.channelDefaultRepo.GetByChannelID(context.Background(), channelID)
+	if err != nil {
+		var notFound *repositories.NotFoundError
+		if !errors.As(err, &notFound) {
+			log.Printf("Error getting defaults for channel %s: %v", channelID, err)
+		}
+		return nil
+	}
+
+	return defaults
+}
+
+// applyChannelDefaults sets the checkpoint, VAE and style of the channel of item that the member didn't choose
+// themselves, keeping which ones were applied so they're shown in the embed
+func (q *SDQueue) applyChannelDefaults(item *SDQueueItem, chosen func(option string) bool) {
+	if item.DiscordInteraction == nil {
+		return
+	}
+	defaults := q.channelDefaults(item.DiscordInteraction.ChannelID)
+	if defaults == nil {
+		return
+	}
+
+	if defaults.Checkpoint != "" && !chosen(checkpointOption) {
+		checkpoint := defaults.Checkpoint
+		item.Checkpoint = &checkpoint
+		item.channelDefaults = append(item.channelDefaults, "checkpoint")
+	}
+	if defaults.VAE != "" && !chosen(vaeOption) {
+		vae := defaults.VAE
+		item.VAE = &vae
+		item.channelDefaults = append(item.channelDefaults, "VAE")
+	}
+	if defaults.Style != "" && len(item.Styles) == 0 {
+		item.Styles = []string{defaults.Style}
+		item.channelDefaults = append(item.channelDefaults, "style")
+	}
+}
+
+func (q *SDQueue) processChannelDefaultsCommand(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	if err := handlers.EphemeralThink(s, i); err != nil {
+		return err
+	}
+
+	if i.GuildID == "" || i.Member == nil {
+		return handlers.ErrorEdit(s, i.Interaction, "Channel defaults can only be set in a server.")
+	}
+	if i.Member.Permissions&discordgo.PermissionAdministrator == 0 {
+		return handlers.ErrorEdit(s, i.Interaction, "Only administrators can change the channel defaults of this server.")
+	}
+
+	data := i.ApplicationCommandData()
+	if len(data.Options) == 0 {
+		return handlers.ErrorEdit(s, i.Interaction, "You need to choose a subcommand.")
+	}
+
+	subcommand := data.Options[0]
+	optionMap := make(map[string]*discordgo.ApplicationCommandInteractionDataOption, len(subcommand.Options))
+	for _, opt := range subcommand.Options {
+		optionMap[opt.Name] = opt
+	}
+
+	channelID := i.ChannelID
+	if option, ok := optionMap[channelDefaultsChannelOption]; ok {
+		channelID = option.Value.(string)
+	}
+
+	switch "channel_defaults_" + subcommand.Name {
+	case channelDefaultsSetOption:
+		defaults := &entities.ChannelDefault{
+			GuildID:   i.GuildID,
+			ChannelID: channelID,
+		}
+		if option, ok := optionMap[checkpointOption]; ok {
+			defaults.Checkpoint = strings.TrimSpace(option.StringValue())
+		}
+		if option, ok := optionMap[vaeOption]; ok {
+			defaults.VAE = strings.TrimSpace(option.StringValue())
+		}
+		if option, ok := optionMap[channelDefaultsStyleOption]; ok {
+			defaults.Style = strings.TrimSpace(option.StringValue())
+		}
+		if defaults.Checkpoint == "" && defaults.VAE == "" && defaults.Style == "" {
+			return handlers.ErrorEdit(s, i.Interaction, "You need to provide a checkpoint, VAE or style.")
+		}
+
+		if _, err := q.channelDefaultRepo.Upsert(context.Background(), defaults); err != nil {
+			return handlers.ErrorEdit(s, i.Interaction, "Error saving channel defaults.", err)
+		}
+
+		_, err := handlers.EditInteractionResponse(s, i.Interaction,
+			fmt.Sprintf("/%s in <#%s> now uses these when members don't choose them:\n%s", ImagineCommand, channelID, channelDefaultsString(defaults)))
+		return err
+	case channelDefaultsClearOption:
+		err := q.channelDefaultRepo.Delete(context.Background(), i.GuildID, channelID)
+		var notFound *repositories.NotFoundError
+		if errors.As(err, &notFound) {
+			return handlers.ErrorEdit(s, i.Interaction, fmt.Sprintf("<#%s> doesn't have its own defaults.", channelID))
+		}
+		if err != nil {
+			return handlers.ErrorEdit(s, i.Interaction, "Error clearing channel defaults.", err)
+		}
+		_, err = handlers.EditInteractionResponse(s, i.Interaction, fmt.Sprintf("<#%s> uses the defaults of the bot again.", channelID))
+		return err
+	case channelDefaultsListOption:
+		list, err := q.channelDefaultRepo.ListByGuildID(context.Background(), i.GuildID)
+		if err != nil {
+			return handlers.ErrorEdit(s, i.Interaction, "Error retrieving channel defaults.", err)
+		}
+		if len(list) == 0 {
+			_, err = handlers.EditInteractionResponse(s, i.Interaction, "No channel in this server has its own defaults.")
+			return err
+		}
+		var out strings.Builder
+		for _, defaults := range list {
+			out.WriteString(fmt.Sprintf("<#%s>\n%s\n", defaults.ChannelID, channelDefaultsString(defaults)))
+		}
+		_, err = handlers.EditInteractionResponse(s, i.Interaction, shortenTo(out.String(), 2000))
+		return err
+	default:
+		return handlers.ErrorEdit(s, i.Interaction, fmt.Sprintf("Unknown subcommand: %s", subcommand.Name))
+	}
+}
+
+func channelDefaultsString(defaults *entities.ChannelDefault) string {
+	var lines []string
+	if defaults.Checkpoint != "" {
+		lines = append(lines, fmt.Sprintf("**Checkpoint**: `%s`", defaults.Checkpoint))
+	}
+	if defaults.VAE != "" {
+		lines = append(lines, fmt.Sprintf("**VAE**: `%s`", defaults.VAE))
+	}
+	if defaults.Style != "" {
+		lines = append(lines, fmt.Sprintf("**Style**: `%s`", defaults.Style))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (q *SDQueue) processChannelDefaultsAutocomplete(_ *discordgo.Session, i *discordgo.InteractionCreate) error {
+	data := i.ApplicationCommandData()
+	if len(data.Options) == 0 {
+		return nil
+	}
+
+	for _, opt := range data.Options[0].Options {
+		if !opt.Focused {
+			continue
+		}
+		switch opt.Name {
+		case checkpointOption:
+			return q.autocompleteModels(i, opt, stable_diffusion_api.CheckpointCache)
+		case vaeOption:
+			return q.autocompleteModels(i, opt, stable_diffusion_api.VAECache)
+		}
+	}
+
+	return nil
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/bwmarrin/discordgo"
 
 	"stable_diffusion_bot/api/stable_diffusion_api"
+	"stable_diffusion_bot/composite_renderer"
 	"stable_diffusion_bot/entities"
 )
 
@@ -18,7 +19,7 @@ func (q *SDQueue) commands() []*discordgo.ApplicationCommand {
 		{
 			Name:        ImagineCommand,
 			Description: "Ask the bot to imagine something",
-			Options:     imagineOptions(),
+			Options:     q.withoutMissingFeatures(imagineOptions()),
 			Type:        discordgo.ChatApplicationCommand,
 		},
 		{
@@ -44,11 +45,224 @@ func (q *SDQueue) commands() []*discordgo.ApplicationCommand {
 				commandOptions[jsonFile],
 				commandOptions[useDefaults],
 				commandOptions[unsafeOption],
+				commandOptions[dryRunOption],
+				commandOptions[schemaOption],
 			},
 		},
+		{
+			Name:                     ErrorsCommand,
+			Description:              "Show the most recent failed generations",
+			Type:                     discordgo.ChatApplicationCommand,
+			DefaultMemberPermissions: &adminPermission,
+			Options: []*discordgo.ApplicationCommandOption{
+				commandOptions[errorsLimitOption],
+			},
+		},
+		{
+			Name:        LookupCommand,
+			Description: "Look up the generation parameters from a message link",
+			Type:        discordgo.ChatApplicationCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				commandOptions[messageLinkOption],
+			},
+		},
+		{
+			Name:        UsageCommand,
+			Description: "Show your generation usage",
+			Type:        discordgo.ChatApplicationCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				commandOptions[usageDaysOption],
+			},
+		},
+		{
+			Name:        StatsCommand,
+			Description: "Show how many images were generated in this server",
+			Type:        discordgo.ChatApplicationCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				commandOptions[statsUserOption],
+				commandOptions[usageDaysOption],
+			},
+		},
+		{
+			Name:        LeaderboardCommand,
+			Description: "Show the members with the most generated images in this server",
+			Type:        discordgo.ChatApplicationCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				commandOptions[usageDaysOption],
+			},
+		},
+		{
+			Name:        SeedCommand,
+			Description: "Save seeds under a name to reuse them with /imagine",
+			Type:        discordgo.ChatApplicationCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				commandOptions[seedSaveOption],
+				commandOptions[seedListOption],
+				commandOptions[seedDeleteOption],
+			},
+		},
+		{
+			Name:        LorasCommand,
+			Description: "Manage the loras that are suggested first and applied with my_loras",
+			Type:        discordgo.ChatApplicationCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				commandOptions[lorasPinOption],
+				commandOptions[lorasUnpinOption],
+				commandOptions[lorasListOption],
+			},
+		},
+		{
+			Name:                     RestoreCommand,
+			Description:              "Restore a deleted generation from its message link",
+			Type:                     discordgo.ChatApplicationCommand,
+			DefaultMemberPermissions: &adminPermission,
+			Options: []*discordgo.ApplicationCommandOption{
+				commandOptions[messageLinkOption],
+			},
+		},
+		{
+			Name:                     WatermarkCommand,
+			Description:              "Draw a watermark on images generated in this server",
+			Type:                     discordgo.ChatApplicationCommand,
+			DefaultMemberPermissions: &adminPermission,
+			Options: []*discordgo.ApplicationCommandOption{
+				commandOptions[watermarkSetOption],
+				commandOptions[watermarkClearOption],
+			},
+		},
+		{
+			Name:                     QuietHoursCommand,
+			Description:              "Disable or hold generations in this server during set hours",
+			Type:                     discordgo.ChatApplicationCommand,
+			DefaultMemberPermissions: &adminPermission,
+			Options: []*discordgo.ApplicationCommandOption{
+				commandOptions[quietHoursSetOption],
+				commandOptions[quietHoursShowOption],
+				commandOptions[quietHoursClearOption],
+			},
+		},
+		{
+			Name:        PrivacyCommand,
+			Description: "Choose whether generation parameters are embedded in uploaded images",
+			Type:        discordgo.ChatApplicationCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				commandOptions[privacyMeOption],
+				commandOptions[privacyServerOption],
+			},
+		},
+		{
+			Name:        LayoutCommand,
+			Description: "Choose whether large batches are tiled into a grid or posted as separate images",
+			Type:        discordgo.ChatApplicationCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				commandOptions[layoutMeOption],
+				commandOptions[layoutServerOption],
+			},
+		},
+		{
+			Name:        NegativeEmbeddingsCommand,
+			Description: "Choose the negative embeddings added to every negative prompt",
+			Type:        discordgo.ChatApplicationCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				commandOptions[negativeEmbeddingsMeOption],
+				commandOptions[negativeEmbeddingsServerOption],
+			},
+		},
+		{
+			Name:        SeedTravelCommand,
+			Description: "Generate frames that blend smoothly from one seed into another",
+			Type:        discordgo.ChatApplicationCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				commandOptions[promptOption],
+				commandOptions[seedOption],
+				commandOptions[seedTravelToOption],
+				commandOptions[seedTravelFramesOption],
+				commandOptions[negativeOption],
+				commandOptions[samplerOption],
+				commandOptions[stepOption],
+				commandOptions[cfgScaleOption],
+				commandOptions[aspectRatio],
+				commandOptions[seedResizeWidthOption],
+				commandOptions[seedResizeHeightOption],
+			},
+		},
+		{
+			Name:        ContactSheetCommand,
+			Description: "Render your generations into a captioned contact sheet",
+			Type:        discordgo.ChatApplicationCommand,
+			Options: []*discordgo.ApplicationCommandOption{
+				commandOptions[contactSheetCountOption],
+				commandOptions[contactSheetLinksOption],
+				commandOptions[contactSheetColumnsOption],
+			},
+		},
+		{
+			Name:                     AdminCommand,
+			Description:              "Manage the bot, only for the bot owner",
+			Type:                     discordgo.ChatApplicationCommand,
+			DefaultMemberPermissions: &adminPermission,
+			Options:                  adminOptions(),
+		},
+		{
+			Name:        VersionCommand,
+			Description: "Show the version of the bot, to include when reporting a bug",
+			Type:        discordgo.ChatApplicationCommand,
+		},
+		{
+			Name:        StatusCommand,
+			Description: "Show the state of the bot",
+			Type:        discordgo.ChatApplicationCommand,
+			Options:     statusOptions(),
+		},
+		{
+			Name:        SnippetsCommand,
+			Description: "Manage the snippets of this server, used in prompts as {snippet:name} next to {user} and {date}",
+			Type:        discordgo.ChatApplicationCommand,
+			Options:     snippetsOptions(),
+		},
+		{
+			Name:                     ChannelDefaultsCommand,
+			Description:              "Set the checkpoint, VAE and style /imagine uses in a channel",
+			Type:                     discordgo.ChatApplicationCommand,
+			DefaultMemberPermissions: &adminPermission,
+			Options:                  channelDefaultsOptions(),
+		},
+		{
+			Name:        ReferenceCommand,
+			Description: "Generate something like the attached images",
+			Type:        discordgo.ChatApplicationCommand,
+			Options:     referenceOptions(),
+		},
+		{
+			Name: GenerationDetailsCommand,
+			Type: discordgo.MessageApplicationCommand,
+		},
 	}
 }
 
+var adminPermission int64 = discordgo.PermissionAdministrator
+
+var stripMetadataCommandOption = &discordgo.ApplicationCommandOption{
+	Type:        discordgo.ApplicationCommandOptionBoolean,
+	Name:        stripMetadataOption,
+	Description: "Remove prompts, parameters and EXIF from uploaded images",
+	Required:    false,
+}
+
+var negativeEmbeddingsCommandOption = &discordgo.ApplicationCommandOption{
+	Type:        discordgo.ApplicationCommandOptionString,
+	Name:        negativeEmbeddingsOption,
+	Description: "Embeddings separated by commas, e.g. easynegative. none adds none, clear uses the server's",
+	Required:    false,
+}
+
+var individualCommandOption = &discordgo.ApplicationCommandOption{
+	Type:        discordgo.ApplicationCommandOptionBoolean,
+	Name:        individualOption,
+	Description: "Upload each image as its own attachment at full quality instead of a grid",
+	Required:    false,
+}
+
 func imagineOptions() (options []*discordgo.ApplicationCommandOption) {
 	options = []*discordgo.ApplicationCommandOption{
 		commandOptions[promptOption],
@@ -77,6 +291,7 @@ func imagineOptions() (options []*discordgo.ApplicationCommandOption) {
 		commandOptions[controlnetResizeMode],
 		commandOptions[controlnetPreprocessor],
 		commandOptions[controlnetModel],
+		commandOptions[myLorasOption],
 	}
 
 	for i := 0; i < min(extraLoras, 25-len(options)); i++ {
@@ -116,9 +331,10 @@ var commandOptions = map[CommandOption]*discordgo.ApplicationCommandOption{
 		Required:    false,
 	},
 	seedOption: {
-		Type:        discordgo.ApplicationCommandOptionInteger,
-		Name:        seedOption,
-		Description: "Seed to use for sampling. Default is random (-1)",
+		Type:         discordgo.ApplicationCommandOptionString,
+		Name:         seedOption,
+		Description:  "Seed to use for sampling, or name:<bookmark> for a saved seed. Default is random (-1)",
+		Autocomplete: true,
 	},
 	checkpointOption: {
 		Type:         discordgo.ApplicationCommandOptionString,
@@ -192,44 +408,11 @@ var commandOptions = map[CommandOption]*discordgo.ApplicationCommandOption{
 		Autocomplete: true,
 	},
 	samplerOption: {
-		Type:        discordgo.ApplicationCommandOptionString,
-		Name:        samplerOption,
-		Description: "sampler",
-		Required:    false,
-		Choices: []*discordgo.ApplicationCommandOptionChoice{
-			{
-				Name:  "Euler a",
-				Value: "Euler a",
-			},
-			{
-				Name:  "DDIM",
-				Value: "DDIM",
-			},
-			{
-				Name:  "UniPC",
-				Value: "UniPC",
-			},
-			{
-				Name:  "Euler",
-				Value: "Euler",
-			},
-			{
-				Name:  "DPM2 a Karras",
-				Value: "DPM2 a Karras",
-			},
-			{
-				Name:  "DPM++ 2S a Karras",
-				Value: "DPM++ 2S a Karras",
-			},
-			{
-				Name:  "DPM++ 2M Karras",
-				Value: "DPM++ 2M Karras",
-			},
-			{
-				Name:  "DPM++ 3M SDE Karras",
-				Value: "DPM++ 3M SDE Karras",
-			},
-		},
+		Type:         discordgo.ApplicationCommandOptionString,
+		Name:         samplerOption,
+		Description:  "The sampler, optionally followed by the scheduler, e.g. DPM++ 2M Karras",
+		Required:     false,
+		Autocomplete: true,
 	},
 	batchCountOption: {
 		Type:        discordgo.ApplicationCommandOptionInteger,
@@ -334,24 +517,11 @@ var commandOptions = map[CommandOption]*discordgo.ApplicationCommandOption{
 		},
 	},
 	adModelOption: {
-		Type:        discordgo.ApplicationCommandOptionString,
-		Name:        adModelOption,
-		Description: "The model to use for adetailer",
-		Required:    false,
-		Choices: []*discordgo.ApplicationCommandOptionChoice{
-			{
-				Name:  "Face",
-				Value: "face_yolov8n.pt",
-			},
-			{
-				Name:  "Body",
-				Value: "person_yolov8n-seg.pt",
-			},
-			{
-				Name:  "Both",
-				Value: "person_yolov8n-seg.pt,face_yolov8n.pt",
-			},
-		},
+		Type:         discordgo.ApplicationCommandOptionString,
+		Name:         adModelOption,
+		Description:  "The ADetailer models to use, separated by commas",
+		Required:     false,
+		Autocomplete: true,
 	},
 	refreshLoraOption: {
 		Type:        discordgo.ApplicationCommandOptionSubCommand,
@@ -469,8 +639,359 @@ var commandOptions = map[CommandOption]*discordgo.ApplicationCommandOption{
 		Description: "Process the json file without validation. This is set to False by default",
 		Required:    false,
 	},
+	schemaOption: {
+		Type:        discordgo.ApplicationCommandOptionBoolean,
+		Name:        schemaOption,
+		Description: "Send the JSON Schema of raw requests instead of generating",
+		Required:    false,
+	},
+
+	dryRunOption: {
+		Type:        discordgo.ApplicationCommandOptionBoolean,
+		Name:        dryRunOption,
+		Description: "Post back the request JSON without sending it to the backend. This is set to False by default",
+		Required:    false,
+	},
+
+	errorsLimitOption: {
+		Type:        discordgo.ApplicationCommandOptionInteger,
+		Name:        errorsLimitOption,
+		Description: "Number of failed generations to show. Default is 5",
+		Required:    false,
+		MinValue:    &minErrorsLimit,
+		MaxValue:    maxErrorsLimit,
+	},
+
+	usageDaysOption: {
+		Type:        discordgo.ApplicationCommandOptionInteger,
+		Name:        usageDaysOption,
+		Description: "Number of days to include. Default is 30",
+		Required:    false,
+		MinValue:    &minUsageDays,
+		MaxValue:    365,
+	},
+
+	statsUserOption: {
+		Type:        discordgo.ApplicationCommandOptionUser,
+		Name:        statsUserOption,
+		Description: "Only count the images of this user",
+		Required:    false,
+	},
+
+	seedSaveOption: {
+		Type:        discordgo.ApplicationCommandOptionSubCommand,
+		Name:        strings.TrimPrefix(seedSaveOption, "seed_"),
+		Description: "Save a seed under a name. Defaults to the seed of your last generation.",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        seedNameOption,
+				Description: "Name of the seed, e.g. good-face-seed",
+				Required:    true,
+				MaxLength:   32,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionInteger,
+				Name:        seedValueOption,
+				Description: "The seed to save",
+				Required:    false,
+				MinValue:    new(float64),
+			},
+		},
+	},
+	seedListOption: {
+		Type:        discordgo.ApplicationCommandOptionSubCommand,
+		Name:        strings.TrimPrefix(seedListOption, "seed_"),
+		Description: "List your saved seeds.",
+	},
+	seedDeleteOption: {
+		Type:        discordgo.ApplicationCommandOptionSubCommand,
+		Name:        strings.TrimPrefix(seedDeleteOption, "seed_"),
+		Description: "Delete a saved seed.",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:         discordgo.ApplicationCommandOptionString,
+				Name:         seedNameOption,
+				Description:  "Name of the seed",
+				Required:     true,
+				Autocomplete: true,
+			},
+		},
+	},
+
+	myLorasOption: {
+		Type:        discordgo.ApplicationCommandOptionBoolean,
+		Name:        myLorasOption,
+		Description: "Apply your pinned loras, or your most used ones if none are pinned",
+		Required:    false,
+	},
+	lorasPinOption: {
+		Type:        discordgo.ApplicationCommandOptionSubCommand,
+		Name:        strings.TrimPrefix(lorasPinOption, "loras_"),
+		Description: "Pin a lora with a default weight.",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:         discordgo.ApplicationCommandOptionString,
+				Name:         loraOption,
+				Description:  "The lora to pin",
+				Required:     true,
+				Autocomplete: true,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionNumber,
+				Name:        loraWeightOption,
+				Description: "Default weight of the lora. Default is 1",
+				Required:    false,
+			},
+		},
+	},
+	lorasUnpinOption: {
+		Type:        discordgo.ApplicationCommandOptionSubCommand,
+		Name:        strings.TrimPrefix(lorasUnpinOption, "loras_"),
+		Description: "Unpin a lora.",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:         discordgo.ApplicationCommandOptionString,
+				Name:         loraOption,
+				Description:  "The lora to unpin",
+				Required:     true,
+				Autocomplete: true,
+			},
+		},
+	},
+	lorasListOption: {
+		Type:        discordgo.ApplicationCommandOptionSubCommand,
+		Name:        strings.TrimPrefix(lorasListOption, "loras_"),
+		Description: "List your pinned and most used loras.",
+	},
+
+	watermarkSetOption: {
+		Type:        discordgo.ApplicationCommandOptionSubCommand,
+		Name:        strings.TrimPrefix(watermarkSetOption, "watermark_"),
+		Description: "Set the watermark drawn on images generated in this server.",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        watermarkTextOption,
+				Description: "Text of the watermark",
+				Required:    false,
+				MaxLength:   64,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionAttachment,
+				Name:        watermarkImageOption,
+				Description: "A small PNG to use instead of text",
+				Required:    false,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        watermarkCornerOption,
+				Description: "Corner of the watermark. Default is bottom right",
+				Required:    false,
+				Choices: []*discordgo.ApplicationCommandOptionChoice{
+					{Name: "Top left", Value: composite_renderer.CornerTopLeft},
+					{Name: "Top right", Value: composite_renderer.CornerTopRight},
+					{Name: "Bottom left", Value: composite_renderer.CornerBottomLeft},
+					{Name: "Bottom right", Value: composite_renderer.CornerBottomRight},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionNumber,
+				Name:        watermarkOpacityOption,
+				Description: "Opacity between 0.05 and 1. Default is 0.5",
+				Required:    false,
+				MinValue:    &minWatermarkOpacity,
+				MaxValue:    1,
+			},
+		},
+	},
+	watermarkClearOption: {
+		Type:        discordgo.ApplicationCommandOptionSubCommand,
+		Name:        strings.TrimPrefix(watermarkClearOption, "watermark_"),
+		Description: "Remove the watermark of this server.",
+	},
+
+	quietHoursSetOption: {
+		Type:        discordgo.ApplicationCommandOptionSubCommand,
+		Name:        strings.TrimPrefix(quietHoursSetOption, "quiet_hours_"),
+		Description: "Set the daily quiet hours of this server.",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        quietHoursStartOption,
+				Description: "When quiet hours start, as HH:MM",
+				Required:    true,
+				MaxLength:   5,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        quietHoursEndOption,
+				Description: "When quiet hours end, as HH:MM. Can be before the start to span midnight",
+				Required:    true,
+				MaxLength:   5,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        quietHoursTimezoneOption,
+				Description: "Timezone of the hours, e.g. Europe/Berlin. Default is UTC",
+				Required:    false,
+				MaxLength:   64,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        quietHoursModeOption,
+				Description: "What happens to generations during quiet hours. Default is hold",
+				Required:    false,
+				Choices: []*discordgo.ApplicationCommandOptionChoice{
+					{Name: "Hold until quiet hours end", Value: entities.QuietHoursHold},
+					{Name: "Disable generation", Value: entities.QuietHoursOff},
+				},
+			},
+		},
+	},
+	quietHoursShowOption: {
+		Type:        discordgo.ApplicationCommandOptionSubCommand,
+		Name:        strings.TrimPrefix(quietHoursShowOption, "quiet_hours_"),
+		Description: "Show the quiet hours of this server.",
+	},
+	quietHoursClearOption: {
+		Type:        discordgo.ApplicationCommandOptionSubCommand,
+		Name:        strings.TrimPrefix(quietHoursClearOption, "quiet_hours_"),
+		Description: "Remove the quiet hours of this server.",
+	},
+
+	privacyMeOption: {
+		Type:        discordgo.ApplicationCommandOptionSubCommand,
+		Name:        strings.TrimPrefix(privacyMeOption, "privacy_"),
+		Description: "Show or change the privacy of your own generations.",
+		Options: []*discordgo.ApplicationCommandOption{
+			stripMetadataCommandOption,
+		},
+	},
+	privacyServerOption: {
+		Type:        discordgo.ApplicationCommandOptionSubCommand,
+		Name:        strings.TrimPrefix(privacyServerOption, "privacy_"),
+		Description: "Show or change the privacy of every generation in this server. Administrators only.",
+		Options: []*discordgo.ApplicationCommandOption{
+			stripMetadataCommandOption,
+		},
+	},
+
+	layoutMeOption: {
+		Type:        discordgo.ApplicationCommandOptionSubCommand,
+		Name:        strings.TrimPrefix(layoutMeOption, "layout_"),
+		Description: "Show or change how your own generations are posted.",
+		Options: []*discordgo.ApplicationCommandOption{
+			individualCommandOption,
+		},
+	},
+	layoutServerOption: {
+		Type:        discordgo.ApplicationCommandOptionSubCommand,
+		Name:        strings.TrimPrefix(layoutServerOption, "layout_"),
+		Description: "Show or change how generations in this server are posted. Administrators only.",
+		Options: []*discordgo.ApplicationCommandOption{
+			individualCommandOption,
+		},
+	},
+
+	negativeEmbeddingsMeOption: {
+		Type:        discordgo.ApplicationCommandOptionSubCommand,
+		Name:        strings.TrimPrefix(negativeEmbeddingsMeOption, "negative_embeddings_"),
+		Description: "Show or change the negative embeddings added to your own generations.",
+		Options: []*discordgo.ApplicationCommandOption{
+			negativeEmbeddingsCommandOption,
+		},
+	},
+	negativeEmbeddingsServerOption: {
+		Type:        discordgo.ApplicationCommandOptionSubCommand,
+		Name:        strings.TrimPrefix(negativeEmbeddingsServerOption, "negative_embeddings_"),
+		Description: "Show or change the negative embeddings added to generations in this server. Administrators only.",
+		Options: []*discordgo.ApplicationCommandOption{
+			negativeEmbeddingsCommandOption,
+		},
+	},
+
+	contactSheetCountOption: {
+		Type:        discordgo.ApplicationCommandOptionInteger,
+		Name:        contactSheetCountOption,
+		Description: "Number of your latest generations to include. Default is 12",
+		Required:    false,
+		MinValue:    &minContactSheetCount,
+		MaxValue:    maxContactSheetCount,
+	},
+	contactSheetLinksOption: {
+		Type:        discordgo.ApplicationCommandOptionString,
+		Name:        contactSheetLinksOption,
+		Description: "Message links of the generations to include instead, separated by spaces",
+		Required:    false,
+	},
+	contactSheetColumnsOption: {
+		Type:        discordgo.ApplicationCommandOptionInteger,
+		Name:        contactSheetColumnsOption,
+		Description: "Number of columns. Default makes the sheet roughly square",
+		Required:    false,
+		MinValue:    &minContactSheetCount,
+		MaxValue:    maxContactSheetColumns,
+	},
+
+	seedTravelToOption: {
+		Type:         discordgo.ApplicationCommandOptionString,
+		Name:         seedTravelToOption,
+		Description:  "Seed to end on, or name:<bookmark> for a saved seed. Default is random (-1)",
+		Autocomplete: true,
+	},
+	seedTravelFramesOption: {
+		Type:        discordgo.ApplicationCommandOptionInteger,
+		Name:        seedTravelFramesOption,
+		Description: fmt.Sprintf("Number of frames, including both seeds. Default is %d", defaultSeedTravelFrames),
+		Required:    false,
+		MinValue:    &minSeedTravelFramesValue,
+		MaxValue:    maxBatchImages,
+	},
+	seedResizeWidthOption: {
+		Type:        discordgo.ApplicationCommandOptionInteger,
+		Name:        seedResizeWidthOption,
+		Description: "Width the seeds were found at, to keep their composition at another size",
+		Required:    false,
+		MinValue:    &minDimensionValue,
+		MaxValue:    maxDimension,
+	},
+	seedResizeHeightOption: {
+		Type:        discordgo.ApplicationCommandOptionInteger,
+		Name:        seedResizeHeightOption,
+		Description: "Height the seeds were found at, to keep their composition at another size",
+		Required:    false,
+		MinValue:    &minDimensionValue,
+		MaxValue:    maxDimension,
+	},
+
+	messageLinkOption: {
+		Type:        discordgo.ApplicationCommandOptionString,
+		Name:        messageLinkOption,
+		Description: "The link to the message of the generation",
+		Required:    true,
+	},
 }
 
+var (
+	minErrorsLimit float64 = 1
+	minUsageDays   float64 = 1
+
+	minWatermarkOpacity = 0.05
+
+	minContactSheetCount float64 = 1
+
+	minSeedTravelFramesValue float64 = minSeedTravelFrames
+	minDimensionValue        float64 = minDimension
+)
+
+const (
+	maxErrorsLimit = 10
+
+	maxContactSheetCount   = 36
+	maxContactSheetColumns = 8
+)
+
 func controlTypes() []*discordgo.ApplicationCommandOptionChoice {
 	// ControlType is an alias for string
 	type ControlType = string
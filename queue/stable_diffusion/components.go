@@ -1,6 +1,7 @@
 package stable_diffusion
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
@@ -27,12 +28,21 @@ const (
 	BatchSizeSelect    customID = "imagine_batch_size_setting_menu"
 
 	JSONInput customID = "raw"
+
+	SaveSeedModal  customID = "imagine_save_seed_modal"
+	SeedNameInput  customID = "imagine_seed_name"
+	SeedImageInput customID = "imagine_seed_image"
 )
 
 const (
 	RerollButton  customID = "imagine_reroll"
 	UpscaleButton customID = "imagine_upscale"
 	VariantButton customID = "imagine_variation"
+
+	SaveSeedButton     customID = "imagine_save_seed"
+	TimelapseButton    customID = "imagine_timelapse"
+	FullResButton      customID = "imagine_full_res"
+	AnimateBatchButton customID = "imagine_animate_batch"
 )
 
 var components = map[customID]discordgo.MessageComponent{
@@ -124,6 +134,33 @@ var components = map[customID]discordgo.MessageComponent{
 		},
 	},
 
+	SeedNameInput: discordgo.ActionsRow{
+		Components: []discordgo.MessageComponent{
+			discordgo.TextInput{
+				CustomID:    SeedNameInput,
+				Label:       "Name",
+				Style:       discordgo.TextInputShort,
+				Placeholder: "good-face-seed",
+				Required:    true,
+				MinLength:   1,
+				MaxLength:   32,
+			},
+		},
+	},
+
+	SeedImageInput: discordgo.ActionsRow{
+		Components: []discordgo.MessageComponent{
+			discordgo.TextInput{
+				CustomID:    SeedImageInput,
+				Label:       "Image number",
+				Style:       discordgo.TextInputShort,
+				Placeholder: "1",
+				Required:    false,
+				MaxLength:   2,
+			},
+		},
+	},
+
 	JSONInput: discordgo.ActionsRow{
 		Components: []discordgo.MessageComponent{
 			discordgo.TextInput{
@@ -252,12 +289,24 @@ func (q *SDQueue) components() map[string]queue.Handler {
 			return q.processImagineBatchSetting(s, i, batchCountInt, batchSizeInt)
 		},
 
-		RerollButton:  q.processImagineReroll,
-		UpscaleButton: q.upscaleComponentHandler,
-		VariantButton: q.variantComponentHandler,
+		RerollButton:       q.processImagineReroll,
+		SaveSeedButton:     q.processSaveSeedButton,
+		TimelapseButton:    q.processTimelapseButton,
+		FullResButton:      q.processFullResButton,
+		AnimateBatchButton: q.processAnimateBatchButton,
+		UpscaleButton:      q.upscaleComponentHandler,
+		VariantButton:      q.variantComponentHandler,
+
+		RefineButton:         q.processRefineButton,
+		RefineSelect:         q.processRefineSelect,
+		RefineTimelineButton: q.processRefineTimelineButton,
 
 		handlers.Cancel:    q.removeImagineFromQueue, // Cancel button is used when still in queue
 		handlers.Interrupt: q.interrupt,              // Interrupt button is used when currently generating, using the api.Interrupt() method
+
+		handlers.DeleteGeneration: q.processDeleteGeneration, // Archive the message so it can be restored
+
+		handlers.TryOnStableDiffusion: q.processTryOnStableDiffusion,
 	}
 
 	for i := range 4 {
@@ -293,7 +342,7 @@ func (q *SDQueue) variantComponentHandler(s *discordgo.Session, i *discordgo.Int
 }
 
 func (q *SDQueue) processImagineReroll(s *discordgo.Session, i *discordgo.InteractionCreate) error {
-	position, queueError := q.Add(&SDQueueItem{
+	item := &SDQueueItem{
 		ImageGenerationRequest: &entities.ImageGenerationRequest{
 			GenerationInfo: entities.GenerationInfo{
 				InteractionID: i.Interaction.ID,
@@ -305,7 +354,8 @@ func (q *SDQueue) processImagineReroll(s *discordgo.Session, i *discordgo.Intera
 		},
 		Type:               ItemTypeReroll,
 		DiscordInteraction: i.Interaction,
-	})
+	}
+	position, queueError := q.Add(item)
 	if queueError != nil {
 		return handlers.ErrorEphemeral(s, i.Interaction, "Error adding imagine to queue", queueError)
 	}
@@ -313,7 +363,7 @@ func (q *SDQueue) processImagineReroll(s *discordgo.Session, i *discordgo.Intera
 	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
 		Data: &discordgo.InteractionResponseData{
-			Content: fmt.Sprintf("I'm reimagining that for you... You are currently #%d in line.", position),
+			Content: "I'm reimagining that for you... " + linePosition(item, position),
 		},
 	})
 	if err != nil {
@@ -324,11 +374,12 @@ func (q *SDQueue) processImagineReroll(s *discordgo.Session, i *discordgo.Intera
 }
 
 func (q *SDQueue) processImagineUpscale(s *discordgo.Session, i *discordgo.InteractionCreate, upscaleIndex int) error {
-	position, err := q.Add(&SDQueueItem{
+	item := &SDQueueItem{
 		Type:               ItemTypeUpscale,
 		InteractionIndex:   upscaleIndex,
 		DiscordInteraction: i.Interaction,
-	})
+	}
+	position, err := q.Add(item)
 	if err != nil {
 		return handlers.ErrorEphemeral(s, i.Interaction, "Error adding imagine to queue", err)
 	}
@@ -336,13 +387,13 @@ func (q *SDQueue) processImagineUpscale(s *discordgo.Session, i *discordgo.Inter
 	return handlers.Wrap(s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
 		Data: &discordgo.InteractionResponseData{
-			Content: fmt.Sprintf("I'm upscaling that for you... You are currently #%d in line.", position),
+			Content: "I'm upscaling that for you... " + linePosition(item, position),
 		},
 	}))
 }
 
 func (q *SDQueue) processImagineVariation(s *discordgo.Session, i *discordgo.InteractionCreate, variationIndex int) error {
-	position, queueError := q.Add(&SDQueueItem{
+	item := &SDQueueItem{
 		ImageGenerationRequest: &entities.ImageGenerationRequest{
 			GenerationInfo: entities.GenerationInfo{
 				InteractionID: i.Interaction.ID,
@@ -356,19 +407,67 @@ func (q *SDQueue) processImagineVariation(s *discordgo.Session, i *discordgo.Int
 		Type:               ItemTypeVariation,
 		InteractionIndex:   variationIndex,
 		DiscordInteraction: i.Interaction,
-	})
+	}
+	position, queueError := q.Add(item)
 	if queueError != nil {
-		return handlers.ErrorEphemeral(s, i.Interaction, "Error adding imagine to queue")
+		return handlers.ErrorEphemeral(s, i.Interaction, "Error adding imagine to queue", queueError)
 	}
 
 	return handlers.Wrap(s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
 		Data: &discordgo.InteractionResponseData{
-			Content: fmt.Sprintf("I'm imagining more variations for you... You are currently #%d in line.", position),
+			Content: "I'm imagining more variations for you... " + linePosition(item, position),
 		},
 	}))
 }
 
+// processTryOnStableDiffusion queues the NovelAI generation of the message with Stable Diffusion and the current
+// checkpoint, to compare the two
+func (q *SDQueue) processTryOnStableDiffusion(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	if err := handlers.ThinkResponse(s, i); err != nil {
+		return err
+	}
+
+	generation, err := q.imageGenerationRepo.GetByMessageAndSort(context.Background(), i.Message.ID, 0)
+	if err != nil {
+		return handlers.ErrorEdit(s, i.Interaction, "Could not find the generation of this message.", err)
+	}
+	if generation.Backend != entities.BackendNovelAI || generation.RawRequest == nil {
+		return handlers.ErrorEdit(s, i.Interaction, "This generation was not made with NovelAI.")
+	}
+	request, err := entities.UnmarshalNovelAIRequest([]byte(*generation.RawRequest))
+	if err != nil {
+		return handlers.ErrorEdit(s, i.Interaction, "Error reading the generation of this message.", err)
+	}
+
+	item := q.NewItem(i.Interaction, WithCurrentModels(q.stableDiffusionAPI))
+	item.Type = ItemTypeImagine
+	sampler, scheduler := item.SamplerName, item.Scheduler
+	request.ApplyToWebUI(item.TextToImageRequest)
+	if checkSampler(item) != nil {
+		// the backend doesn't have the sampler NovelAI used
+		item.SamplerName, item.Scheduler = sampler, scheduler
+	}
+
+	position, err := q.Add(item)
+	var invalid *ValidationError
+	if errors.As(err, &invalid) {
+		return errorInvalid(s, i.Interaction, invalid)
+	}
+	if err != nil {
+		return handlers.ErrorEdit(s, i.Interaction, "Error adding imagine to queue.", err)
+	}
+
+	queueString := fmt.Sprintf(
+		"I'm trying that on Stable Diffusion for you. %s\n<@%s> asked me to imagine \n```\n%s\n```",
+		linePosition(item, position),
+		utils.GetUser(i.Interaction).ID,
+		item.Prompt,
+	)
+	_, err = handlers.EditInteractionResponse(s, i.Interaction, queueString, handlers.Components[handlers.Cancel])
+	return err
+}
+
 // check if the user using the cancel button is the same user that started the generation, then remove it from the queue
 func (q *SDQueue) removeImagineFromQueue(s *discordgo.Session, i *discordgo.InteractionCreate) error {
 	if utils.GetUser(i.Interaction).ID != i.Message.InteractionMetadata.User.ID {
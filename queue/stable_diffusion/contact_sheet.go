@@ -0,0 +1,137 @@
+package stable_diffusion
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"stable_diffusion_bot/composite_renderer"
+	"stable_diffusion_bot/discord_bot/handlers"
+	"stable_diffusion_bot/entities"
+	"stable_diffusion_bot/repositories/image_generations"
+	"stable_diffusion_bot/utils"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const defaultContactSheetCount = 12
+
+// processContactSheetCommand renders the latest or linked generations with their prompts under each image
+func (q *SDQueue) processContactSheetCommand(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	if err := handlers.EphemeralThink(s, i); err != nil {
+		return err
+	}
+
+	optionMap := utils.GetOpts(i.ApplicationCommandData())
+	user := utils.GetUser(i.Interaction)
+
+	var generations []*entities.ImageGenerationRequest
+	if option, ok := optionMap[contactSheetLinksOption]; ok {
+		for _, link := range strings.Fields(option.StringValue()) {
+			linked, err := q.imageGenerationRepo.ResolveMessageLink(context.Background(), link)
+			if err != nil {
+				return handlers.ErrorEdit(s, i.Interaction, fmt.Sprintf("Could not find a generation for %s.", link), err)
+			}
+			// generations from other guilds are only visible to the bot owner
+			if guildID := linked[0].GuildID; guildID != "" && guildID != i.GuildID && !handlers.IsOwner(i.Interaction) {
+				return handlers.ErrorEdit(s, i.Interaction, "You can only add generations from this server.")
+			}
+			generations = append(generations, linked...)
+		}
+	} else {
+		count := defaultContactSheetCount
+		if option, ok := optionMap[contactSheetCountOption]; ok {
+			count = int(option.IntValue())
+		}
+		var err error
+		generations, err = q.imageGenerationRepo.GetByMemberID(context.Background(), user.ID, image_generations.ListOptions{
+			Limit:   count,
+			GuildID: i.GuildID,
+		})
+		if err != nil {
+			return handlers.ErrorEdit(s, i.Interaction, "Error retrieving your generations.", err)
+		}
+	}
+
+	images, captions := q.contactSheetImages(s, generations[:min(len(generations), maxContactSheetCount)])
+	if len(images) == 0 {
+		return handlers.ErrorEdit(s, i.Interaction, "Could not find the images of your generations, their messages may have been deleted.")
+	}
+
+	opts := composite_renderer.ContactSheetOptions{}
+	if option, ok := optionMap[contactSheetColumnsOption]; ok {
+		opts.Columns = int(option.IntValue())
+	}
+	sheet, err := composite_renderer.ContactSheet(images, captions, opts)
+	if err != nil {
+		return handlers.ErrorEdit(s, i.Interaction, "Error rendering the contact sheet.", err)
+	}
+
+	format := composite_renderer.Format{Extension: "png", ContentType: "image/png"}
+	if reencoder, ok := q.settings().compositor.(composite_renderer.Reencoder); ok {
+		limit := utils.UploadLimit(s, i.GuildID)
+		sheet, format, err = reencoder.Reencode(sheet, limit-limit/20)
+		if err != nil {
+			return handlers.ErrorEdit(s, i.Interaction, "Error encoding the contact sheet.", err)
+		}
+	}
+
+	_, err = handlers.EditInteractionResponse(s, i.Interaction, &discordgo.WebhookEdit{
+		Files: []*discordgo.File{{
+			Name:        "contact-sheet." + format.Extension,
+			ContentType: format.ContentType,
+			Reader:      sheet,
+		}},
+	})
+	return err
+}
+
+// contactSheetImages downloads the image of each generation from its message. A grid posted as a single image is
+// only added once. Generations whose message or image can't be found are skipped.
+func (q *SDQueue) contactSheetImages(s *discordgo.Session, generations []*entities.ImageGenerationRequest) ([]io.Reader, []string) {
+	var images []io.Reader
+	var captions []string
+
+	attachments := make(map[string][]*discordgo.MessageAttachment)
+	for _, generation := range generations {
+		messageAttachments, ok := attachments[generation.MessageID]
+		if !ok {
+			message, err := s.ChannelMessage(generation.ChannelID, generation.MessageID)
+			if err != nil {
+				log.Printf("Error retrieving message %s for the contact sheet: %v", generation.MessageID, err)
+			} else {
+				for _, attachment := range message.Attachments {
+					if strings.HasPrefix(attachment.ContentType, "image") && !strings.HasPrefix(attachment.Filename, "thumbnail") {
+						messageAttachments = append(messageAttachments, attachment)
+					}
+				}
+			}
+			attachments[generation.MessageID] = messageAttachments
+		}
+
+		var attachment *discordgo.MessageAttachment
+		switch {
+		case len(messageAttachments) > 1 && generation.SortOrder < len(messageAttachments):
+			attachment = messageAttachments[generation.SortOrder]
+		case len(messageAttachments) == 1:
+			attachment = messageAttachments[0]
+			// the rest of the grid shares this image
+			attachments[generation.MessageID] = nil
+		default:
+			continue
+		}
+
+		data, err := utils.GetDataFromUrl(attachment.URL)
+		if err != nil {
+			log.Printf("Error downloading %s for the contact sheet: %v", attachment.URL, err)
+			continue
+		}
+		images = append(images, bytes.NewReader(data))
+		captions = append(captions, fmt.Sprintf("#%d %s", generation.ID, generation.Prompt))
+	}
+
+	return images, captions
+}
@@ -88,42 +88,6 @@ func (q *SDQueue) GetBotDefaultSettings() (*entities.DefaultSettings, error) {
 	return defaultSettings, nil
 }
 
-func (q *SDQueue) defaultWidth() (int, error) {
-	defaultSettings, err := q.GetBotDefaultSettings()
-	if err != nil {
-		return 0, err
-	}
-
-	return defaultSettings.Width, nil
-}
-
-func (q *SDQueue) defaultHeight() (int, error) {
-	defaultSettings, err := q.GetBotDefaultSettings()
-	if err != nil {
-		return 0, err
-	}
-
-	return defaultSettings.Height, nil
-}
-
-func (q *SDQueue) defaultBatchCount() (int, error) {
-	defaultSettings, err := q.GetBotDefaultSettings()
-	if err != nil {
-		return 0, err
-	}
-
-	return defaultSettings.BatchCount, nil
-}
-
-func (q *SDQueue) defaultBatchSize() (int, error) {
-	defaultSettings, err := q.GetBotDefaultSettings()
-	if err != nil {
-		return 0, err
-	}
-
-	return defaultSettings.BatchSize, nil
-}
-
 func (q *SDQueue) UpdateDefaultDimensions(width, height int) (*entities.DefaultSettings, error) {
 	defaultSettings, err := q.GetBotDefaultSettings()
 	if err != nil {
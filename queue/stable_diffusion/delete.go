@@ -0,0 +1,185 @@
+package stable_diffusion
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"stable_diffusion_bot/discord_bot/handlers"
+	"stable_diffusion_bot/entities"
+	"stable_diffusion_bot/utils"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// DefaultRestoreWindow is how long a deleted generation can be restored before it is purged
+const DefaultRestoreWindow = 7 * 24 * time.Hour
+
+// processDeleteGeneration archives the message and soft-deletes its generations before removing it from the channel.
+// It replaces handlers.ComponentHandlers[handlers.DeleteGeneration].
+func (q *SDQueue) processDeleteGeneration(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	if err := handlers.EphemeralThink(s, i); err != nil {
+		return err
+	}
+
+	if !handlers.CheckGenerationOwner(s, i) {
+		return nil
+	}
+
+	archive := &entities.DeletedMessage{
+		MessageID: i.Message.ID,
+		GuildID:   i.GuildID,
+		ChannelID: i.ChannelID,
+		MemberID:  handlers.GenerationOwner(i.Message),
+		DeletedBy: utils.GetUser(i.Interaction).ID,
+		Content:   i.Message.Content,
+		Embeds:    i.Message.Embeds,
+	}
+
+	// the files are archived as they are, the bot couldn't have uploaded them over the upload limit
+	limit := utils.UploadLimit(s, i.GuildID)
+	for _, attachment := range i.Message.Attachments {
+		data, err := utils.DownloadAttachmentData(attachment, limit)
+		if err != nil {
+			return handlers.ErrorEdit(s, i.Interaction, fmt.Errorf("error archiving attachment %s: %w", attachment.Filename, err))
+		}
+		archive.Files = append(archive.Files, entities.DeletedFile{
+			Name:        attachment.Filename,
+			ContentType: attachment.ContentType,
+			Data:        data,
+		})
+
+		// point the embeds back to the archived file so they render when reposted
+		for _, embed := range archive.Embeds {
+			if embed.Image != nil && embed.Image.URL == attachment.URL {
+				embed.Image.URL = "attachment://" + attachment.Filename
+			}
+			if embed.Thumbnail != nil && embed.Thumbnail.URL == attachment.URL {
+				embed.Thumbnail.URL = "attachment://" + attachment.Filename
+			}
+		}
+	}
+
+	if _, err := q.deletedMessageRepo.Create(context.Background(), archive); err != nil {
+		return handlers.ErrorEdit(s, i.Interaction, "Error archiving generation.", err)
+	}
+
+	if err := q.imageGenerationRepo.SoftDeleteByMessage(context.Background(), i.Message.ID); err != nil {
+		return handlers.ErrorEdit(s, i.Interaction, "Error deleting generation.", err)
+	}
+
+	err := s.ChannelMessageDelete(i.ChannelID, i.Message.ID)
+	if err != nil {
+		return handlers.ErrorEdit(s, i.Interaction, fmt.Errorf("error deleting message: %w", err))
+	}
+
+	_, err = handlers.EditInteractionResponse(s, i.Interaction,
+		fmt.Sprintf("Generation deleted. An admin can restore it within %s.", formatDays(q.settings().restoreWindow)))
+	return err
+}
+
+func (q *SDQueue) processRestoreCommand(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	if err := handlers.EphemeralThink(s, i); err != nil {
+		return err
+	}
+
+	option, ok := utils.GetOpts(i.ApplicationCommandData())[messageLinkOption]
+	if !ok {
+		return handlers.ErrorEdit(s, i.Interaction, "You need to provide a message link.")
+	}
+
+	_, _, messageID, err := utils.ParseMessageLink(option.StringValue())
+	if err != nil {
+		return handlers.ErrorEdit(s, i.Interaction, "Invalid message link.", err)
+	}
+
+	archive, err := q.deletedMessageRepo.Get(context.Background(), messageID)
+	if err != nil {
+		return handlers.ErrorEdit(s, i.Interaction, "Could not find a deleted generation for this message.", err)
+	}
+
+	if archive.GuildID != i.GuildID && !handlers.IsOwner(i.Interaction) {
+		return handlers.ErrorEdit(s, i.Interaction, "You can only restore generations from this server.")
+	}
+
+	if window := q.settings().restoreWindow; time.Since(archive.DeletedAt) > window {
+		return handlers.ErrorEdit(s, i.Interaction,
+			fmt.Sprintf("This generation was deleted more than %s ago and can no longer be restored.", formatDays(window)))
+	}
+
+	message := &discordgo.MessageSend{
+		Content: archive.Content,
+		Embeds:  archive.Embeds,
+		Components: []discordgo.MessageComponent{
+			handlers.Components[handlers.DeleteGeneration],
+		},
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	}
+	for _, file := range archive.Files {
+		message.Files = append(message.Files, &discordgo.File{
+			Name:        file.Name,
+			ContentType: file.ContentType,
+			Reader:      bytes.NewReader(file.Data),
+		})
+	}
+
+	restored, err := s.ChannelMessageSendComplex(archive.ChannelID, message)
+	if err != nil {
+		return handlers.ErrorEdit(s, i.Interaction, "Error reposting generation.", err)
+	}
+
+	if err := q.imageGenerationRepo.RestoreByMessage(context.Background(), archive.MessageID, restored.ID); err != nil {
+		return handlers.ErrorEdit(s, i.Interaction, "Generation was reposted but could not be restored in the database.", err)
+	}
+
+	if err := q.deletedMessageRepo.Delete(context.Background(), archive.MessageID); err != nil {
+		log.Printf("Error removing archive of restored message %s: %v", archive.MessageID, err)
+	}
+
+	_, err = handlers.EditInteractionResponse(s, i.Interaction,
+		fmt.Sprintf("Generation by <@%s> restored: https://discord.com/channels/%s/%s/%s",
+			archive.MemberID, guildOrMe(archive.GuildID), restored.ChannelID, restored.ID))
+	return err
+}
+
+// purgeDeleted permanently removes generations that can no longer be restored
+func (q *SDQueue) purgeDeleted() {
+	before := time.Now().Add(-q.settings().restoreWindow)
+
+	purged, err := q.imageGenerationRepo.PurgeDeleted(context.Background(), before)
+	if err != nil {
+		log.Printf("Error purging deleted generations: %v", err)
+		return
+	}
+
+	if _, err := q.deletedMessageRepo.Purge(context.Background(), before); err != nil {
+		log.Printf("Error purging deleted messages: %v", err)
+		return
+	}
+
+	if purged > 0 {
+		log.Printf("Purged %d deleted generations", purged)
+	}
+}
+
+func formatDays(d time.Duration) string {
+	days := int(d.Hours() / 24)
+	if days == 1 {
+		return "1 day"
+	}
+	if days < 1 {
+		return strings.TrimSuffix(d.String(), "0s")
+	}
+	return fmt.Sprintf("%d days", days)
+}
+
+// guildOrMe returns the guild segment of a message link, which is @me for direct messages
+func guildOrMe(guildID string) string {
+	if guildID == "" {
+		return "@me"
+	}
+	return guildID
+}
@@ -0,0 +1,122 @@
+package stable_diffusion
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"stable_diffusion_bot/discord_bot/handlers"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// secretKey matches the keys whose values are never posted back or logged
+var secretKey = regexp.MustCompile(`(?i)(token|secret|password|passwd|api_?key|authorization|credential)`)
+
+// base64Threshold is the length above which strings are assumed to be images and shortened
+const base64Threshold = 256
+
+// isDryRun reports whether the item should be posted back instead of sent, either because the member asked for it
+// or because dry runs are enabled for everyone
+func (q *SDQueue) isDryRun(item *SDQueueItem) bool {
+	return item.DryRun || q.settings().dryRun
+}
+
+// dryRunPayload builds the JSON the item would send to the API and the endpoint it would be sent to
+func (q *SDQueue) dryRunPayload(item *SDQueueItem) (endpoint string, payload []byte, err error) {
+	switch item.Type {
+	case ItemTypeRaw:
+		payload, err = rawPayload(item.Raw)
+		return "/sdapi/v1/txt2img", payload, err
+	case ItemTypeImg2Img:
+		img2img, err := img2imgRequest(item)
+		if err != nil {
+			return "", nil, err
+		}
+		payload, err = img2img.Marshal()
+		return "/sdapi/v1/img2img", payload, err
+	case ItemTypeUpscale:
+		payload, err = json.Marshal(upscaleRequest(item.ImageGenerationRequest))
+		return "/sdapi/v1/extra-single-image", payload, err
+	default:
+		payload, err = item.TextToImageRequest.Marshal()
+		return "/sdapi/v1/txt2img", payload, err
+	}
+}
+
+// postDryRun records the request the item would have sent and posts it back to the member
+func (q *SDQueue) postDryRun(item *SDQueueItem) error {
+	endpoint, payload, err := q.dryRunPayload(item)
+	if err != nil {
+		return handlers.ErrorEdit(q.botSession, item.DiscordInteraction, "Error building the request.", err)
+	}
+
+	redacted, err := redactSecrets(payload)
+	if err != nil {
+		return handlers.ErrorEdit(q.botSession, item.DiscordInteraction, "Error formatting the request.", err)
+	}
+
+	item.logs.Printf("Dry run #%s to %s: %s", item.DiscordInteraction.ID, endpoint, redacted)
+
+	content := fmt.Sprintf("Dry run, this request was not sent to `%s`.", endpoint)
+	_, err = handlers.EditInteractionResponse(q.botSession, item.DiscordInteraction, &discordgo.WebhookEdit{
+		Content: &content,
+		Files: []*discordgo.File{{
+			Name:        "request.json",
+			ContentType: "application/json",
+			Reader:      bytes.NewReader(redacted),
+		}},
+	}, handlers.Components[handlers.DeleteButton])
+	return err
+}
+
+// redactSecrets pretty prints payload with the values of secret keys replaced and base64 images shortened
+func redactSecrets(payload []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+
+	var v any
+	if err := decoder.Decode(&v); err != nil {
+		return nil, fmt.Errorf("error decoding request: %w", err)
+	}
+
+	return json.MarshalIndent(redact(v), "", "  ")
+}
+
+func redact(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if secretKey.MatchString(key) {
+				v[key] = "[redacted]"
+				continue
+			}
+			v[key] = redact(value)
+		}
+		return v
+	case []any:
+		for i, value := range v {
+			v[i] = redact(value)
+		}
+		return v
+	case string:
+		if len(v) > base64Threshold && isBase64(v) {
+			return fmt.Sprintf("[base64, %d bytes]", len(v))
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+func isBase64(s string) bool {
+	for _, r := range s {
+		switch {
+		case 'A' <= r && r <= 'Z', 'a' <= r && r <= 'z', '0' <= r && r <= '9', r == '+', r == '/', r == '=':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -3,6 +3,8 @@ package stable_diffusion
 import (
 	"fmt"
 	"log"
+	"maps"
+	"slices"
 	"strings"
 	"time"
 
@@ -78,6 +80,7 @@ func generationEmbedDetails(embed *discordgo.MessageEmbed, queue *SDQueueItem, i
 		if request.Scripts.CFGRescale != nil {
 			scripts = append(scripts, "CFGRescale")
 		}
+		scripts = append(scripts, slices.Sorted(maps.Keys(request.Scripts.Extensions))...)
 	} else {
 		for script := range queue.Raw.RawScripts {
 			scripts = append(scripts, script)
@@ -88,8 +91,16 @@ func generationEmbedDetails(embed *discordgo.MessageEmbed, queue *SDQueueItem, i
 		embed.Description += fmt.Sprintf("\n**Scripts**: [`%v`]", strings.Join(scripts, ", "))
 	}
 
-	if request.OverrideSettings.CLIPStopAtLastLayers > 1 {
-		embed.Description += fmt.Sprintf("\n**CLIPSkip**: `%v`", request.OverrideSettings.CLIPStopAtLastLayers)
+	if clipSkip := request.OverrideSettings.CLIPStopAtLastLayers; clipSkip != nil && *clipSkip > 1 {
+		embed.Description += fmt.Sprintf("\n**CLIPSkip**: `%v`", *clipSkip)
+	}
+
+	if len(request.Styles) > 0 {
+		embed.Description += fmt.Sprintf("\n**Styles**: [`%v`]", strings.Join(request.Styles, ", "))
+	}
+
+	if len(queue.channelDefaults) > 0 {
+		embed.Description += fmt.Sprintf("\n**Channel defaults**: %s", strings.Join(queue.channelDefaults, ", "))
 	}
 
 	// store as "2015-12-31T12:00:00.000Z"
@@ -130,7 +141,7 @@ func generationEmbedDetails(embed *discordgo.MessageEmbed, queue *SDQueueItem, i
 // rerollVariationComponents returns a buttons with discordgo.MessageComponent with a specified image count.
 // A maximum of 4 buttons will be returned (due to Discord's limit) plus one "Re-roll" or "Delete" button.
 // If disable is true, the Variation and Upscale buttons will be disabled.
-func rerollVariationComponents(amount int, disable bool) *[]discordgo.MessageComponent {
+func rerollVariationComponents(amount int, disable bool, timelapse bool, fullRes bool, animate bool, novelAI bool) *[]discordgo.MessageComponent {
 	amount = min(amount, 4)
 
 	var actionsRow []discordgo.ActionsRow
@@ -194,6 +205,71 @@ func rerollVariationComponents(amount int, disable bool) *[]discordgo.MessageCom
 		Components: secondRow,
 	})
 
+	// Third Row: "Save seed", "Timelapse", "Full res", "Animate batch" and "Try on NovelAI" buttons
+	thirdRow := []discordgo.MessageComponent{
+		discordgo.Button{
+			Label:    "Save seed",
+			Style:    discordgo.SecondaryButton,
+			Disabled: false,
+			CustomID: SaveSeedButton,
+			Emoji: &discordgo.ComponentEmoji{
+				Name: "🔖",
+			},
+		},
+	}
+
+	if timelapse {
+		thirdRow = append(thirdRow, discordgo.Button{
+			Label:    "Timelapse",
+			Style:    discordgo.SecondaryButton,
+			Disabled: false,
+			CustomID: TimelapseButton,
+			Emoji: &discordgo.ComponentEmoji{
+				Name: "🎞️",
+			},
+		})
+	}
+
+	if fullRes {
+		thirdRow = append(thirdRow, discordgo.Button{
+			Label:    "Get full res",
+			Style:    discordgo.SecondaryButton,
+			Disabled: false,
+			CustomID: FullResButton,
+			Emoji: &discordgo.ComponentEmoji{
+				Name: "🖼️",
+			},
+		})
+	}
+
+	if animate {
+		thirdRow = append(thirdRow, discordgo.Button{
+			Label:    "Animate batch",
+			Style:    discordgo.SecondaryButton,
+			Disabled: false,
+			CustomID: AnimateBatchButton,
+			Emoji: &discordgo.ComponentEmoji{
+				Name: "🔁",
+			},
+		})
+	}
+
+	if novelAI {
+		thirdRow = append(thirdRow, discordgo.Button{
+			Label:    "Try on NovelAI",
+			Style:    discordgo.SecondaryButton,
+			Disabled: false,
+			CustomID: handlers.TryOnNovelAI,
+			Emoji: &discordgo.ComponentEmoji{
+				Name: "🔀",
+			},
+		})
+	}
+
+	actionsRow = append(actionsRow, discordgo.ActionsRow{
+		Components: thirdRow,
+	})
+
 	// Create the ActionsRows
 	var rows []discordgo.MessageComponent
 	for _, row := range actionsRow {
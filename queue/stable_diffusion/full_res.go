@@ -0,0 +1,95 @@
+package stable_diffusion
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+
+	"stable_diffusion_bot/composite_renderer"
+	"stable_diffusion_bot/discord_bot/handlers"
+	"stable_diffusion_bot/utils"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// maxFullResMessages is how many recent generations keep their full resolution images in memory
+	maxFullResMessages = 16
+	// maxFilesPerMessage is the attachment limit of a Discord message
+	maxFilesPerMessage = 10
+)
+
+// readOriginals reads the images so they can be kept for the full resolution button, returning new readers to upload
+func readOriginals(images []io.Reader) ([][]byte, []io.Reader) {
+	var originals [][]byte
+	for i, img := range images {
+		if img == nil {
+			continue
+		}
+		data, err := io.ReadAll(img)
+		if err != nil {
+			log.Printf("Error reading image %d for full resolution: %v", i, err)
+		}
+		originals = append(originals, data)
+		images[i] = bytes.NewReader(data)
+	}
+	return originals, images
+}
+
+// processFullResButton sends the full resolution images of a generation that was posted with previews
+func (q *SDQueue) processFullResButton(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	if err := handlers.EphemeralThink(s, i); err != nil {
+		return err
+	}
+
+	if i.Message == nil {
+		return handlers.ErrorEdit(s, i.Interaction, "Could not find the generation to send the images of.")
+	}
+
+	originals, ok := q.fullRes.get(i.Message.ID)
+	if !ok || len(originals) == 0 {
+		return handlers.ErrorEdit(s, i.Interaction, "Full resolution images are only kept for recent generations while the bot is running.")
+	}
+
+	reencoder, _ := q.settings().compositor.(composite_renderer.Reencoder)
+	limit := utils.UploadLimit(s, i.GuildID)
+	filesPerMessage := min(len(originals), maxFilesPerMessage)
+	budget := (limit - limit/20) / filesPerMessage
+
+	var files []*discordgo.File
+	for index, original := range originals {
+		var image io.Reader = bytes.NewReader(original)
+		format := composite_renderer.Format{Extension: "png", ContentType: "image/png"}
+		if reencoder != nil {
+			var err error
+			image, format, err = reencoder.Reencode(image, budget)
+			if err != nil {
+				return handlers.ErrorEdit(s, i.Interaction, "Error encoding full resolution image.", err)
+			}
+		}
+		files = append(files, &discordgo.File{
+			Name:        fmt.Sprintf("%s-%d.%s", i.Message.ID, index, format.Extension),
+			ContentType: format.ContentType,
+			Reader:      image,
+		})
+	}
+
+	if _, err := handlers.EditInteractionResponse(s, i.Interaction, &discordgo.WebhookEdit{
+		Files: files[:filesPerMessage],
+	}); err != nil {
+		return err
+	}
+
+	for start := filesPerMessage; start < len(files); start += maxFilesPerMessage {
+		_, err := s.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{
+			Files: files[start:min(start+maxFilesPerMessage, len(files))],
+			Flags: discordgo.MessageFlagsEphemeral,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
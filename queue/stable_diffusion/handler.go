@@ -1,6 +1,8 @@
 package stable_diffusion
 
 import (
+	"cmp"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -11,11 +13,13 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"stable_diffusion_bot/api/stable_diffusion_api"
 	"stable_diffusion_bot/discord_bot/handlers"
 	"stable_diffusion_bot/entities"
 	"stable_diffusion_bot/queue"
+	"stable_diffusion_bot/repositories"
 	"stable_diffusion_bot/utils"
 
 	"github.com/bwmarrin/discordgo"
@@ -23,10 +27,33 @@ import (
 )
 
 const (
-	ImagineCommand         Command = "imagine"
-	ImagineSettingsCommand Command = "imagine_settings"
-	RefreshCommand         Command = "refresh"
-	RawCommand             Command = JSONInput
+	ImagineCommand            Command = "imagine"
+	ImagineSettingsCommand    Command = "imagine_settings"
+	RefreshCommand            Command = "refresh"
+	RawCommand                Command = JSONInput
+	ErrorsCommand             Command = "errors"
+	LookupCommand             Command = "lookup"
+	UsageCommand              Command = "usage"
+	RestoreCommand            Command = "restore"
+	StatsCommand              Command = "stats"
+	LeaderboardCommand        Command = "leaderboard"
+	SeedCommand               Command = "seed"
+	LorasCommand              Command = "loras"
+	WatermarkCommand          Command = "watermark"
+	PrivacyCommand            Command = "privacy"
+	LayoutCommand             Command = "layout"
+	NegativeEmbeddingsCommand Command = "negative-embeddings"
+	ContactSheetCommand       Command = "contact-sheet"
+	SeedTravelCommand         Command = "seed-travel"
+	QuietHoursCommand         Command = "quiet-hours"
+	AdminCommand              Command = "admin"
+	VersionCommand            Command = "version"
+	StatusCommand             Command = "status"
+	SnippetsCommand           Command = "snippets"
+	ChannelDefaultsCommand    Command = "channel-defaults"
+	ReferenceCommand          Command = "reference"
+
+	GenerationDetailsCommand Command = "Generation details"
 )
 
 const (
@@ -72,23 +99,144 @@ const (
 	jsonFile     = "json_file"
 	useDefaults  = "use_defaults"
 	unsafeOption = "unsafe"
+	dryRunOption = "dry_run"
+	schemaOption = "schema"
+
+	errorsLimitOption = "limit"
+	messageLinkOption = "link"
+	usageDaysOption   = "days"
+	statsUserOption   = "user"
+
+	seedSaveOption   = "seed_save"
+	seedListOption   = "seed_list"
+	seedDeleteOption = "seed_delete"
+	seedNameOption   = "name"
+	seedValueOption  = "value"
+
+	myLorasOption    = "my_loras"
+	lorasPinOption   = "loras_pin"
+	lorasUnpinOption = "loras_unpin"
+	lorasListOption  = "loras_list"
+	loraWeightOption = "weight"
+
+	watermarkSetOption     = "watermark_set"
+	watermarkClearOption   = "watermark_clear"
+	watermarkTextOption    = "text"
+	watermarkImageOption   = "image"
+	watermarkCornerOption  = "corner"
+	watermarkOpacityOption = "opacity"
+
+	quietHoursSetOption      = "quiet_hours_set"
+	quietHoursClearOption    = "quiet_hours_clear"
+	quietHoursShowOption     = "quiet_hours_show"
+	quietHoursStartOption    = "start"
+	quietHoursEndOption      = "end"
+	quietHoursTimezoneOption = "timezone"
+	quietHoursModeOption     = "mode"
+
+	privacyMeOption     = "privacy_me"
+	privacyServerOption = "privacy_server"
+	stripMetadataOption = "strip_metadata"
+
+	layoutMeOption     = "layout_me"
+	layoutServerOption = "layout_server"
+
+	negativeEmbeddingsMeOption     = "negative_embeddings_me"
+	negativeEmbeddingsServerOption = "negative_embeddings_server"
+	negativeEmbeddingsOption       = "embeddings"
+	individualOption               = "individual"
+
+	contactSheetCountOption   = "count"
+	contactSheetLinksOption   = "messages"
+	contactSheetColumnsOption = "columns"
+
+	subseedOption          = "subseed"
+	subseedStrengthOption  = "subseed_strength"
+	seedResizeWidthOption  = "seed_resize_from_w"
+	seedResizeHeightOption = "seed_resize_from_h"
+	seedTravelToOption     = "to_seed"
+	seedTravelFramesOption = "frames"
 
 	extraLoras = 2
 )
 
+// promptParameters are the names /imagine takes from the prompt as --key value or key=value, mapped to the option
+// they set. The short names are how other generators spell them, e.g. steps=30 cfg=6 ar=2:3.
+var promptParameters = map[string]CommandOption{
+	negativeOption:     negativeOption,
+	samplerOption:      samplerOption,
+	stepOption:         stepOption,
+	seedOption:         seedOption,
+	restoreFacesOption: restoreFacesOption,
+	adModelOption:      adModelOption,
+	dryRunOption:       dryRunOption,
+	checkpointOption:   checkpointOption,
+	vaeOption:          vaeOption,
+	hypernetworkOption: hypernetworkOption,
+	aspectRatio:        aspectRatio,
+	hiresFixSize:       hiresFixSize,
+	hiresFixOption:     hiresFixOption,
+	cfgScaleOption:     cfgScaleOption,
+	batchCountOption:   batchCountOption,
+	batchSizeOption:    batchSizeOption,
+	clipSkipOption:     clipSkipOption,
+	cfgRescaleOption:   cfgRescaleOption,
+
+	subseedOption:          subseedOption,
+	subseedStrengthOption:  subseedStrengthOption,
+	seedResizeWidthOption:  seedResizeWidthOption,
+	seedResizeHeightOption: seedResizeHeightOption,
+
+	"negative": negativeOption,
+	"sampler":  samplerOption,
+	"steps":    stepOption,
+	"cfg":      cfgScaleOption,
+	"ar":       aspectRatio,
+	"hires":    hiresFixOption,
+	"count":    batchCountOption,
+}
+
 func (q *SDQueue) handlers() map[discordgo.InteractionType]map[string]queue.Handler {
 	return queue.CommandHandlers{
 		discordgo.InteractionApplicationCommand: {
-			ImagineCommand:         q.processImagineCommand,
-			ImagineSettingsCommand: q.processImagineSettingsCommand,
-			RefreshCommand:         q.processRefreshCommand,
-			RawCommand:             q.processRawCommand,
+			ImagineCommand:            q.processImagineCommand,
+			SeedTravelCommand:         q.processSeedTravelCommand,
+			ImagineSettingsCommand:    q.processImagineSettingsCommand,
+			RefreshCommand:            q.processRefreshCommand,
+			RawCommand:                q.processRawCommand,
+			ErrorsCommand:             q.processErrorsCommand,
+			LookupCommand:             q.processLookupCommand,
+			UsageCommand:              q.processUsageCommand,
+			RestoreCommand:            q.processRestoreCommand,
+			StatsCommand:              q.processStatsCommand,
+			LeaderboardCommand:        q.processLeaderboardCommand,
+			SeedCommand:               q.processSeedCommand,
+			LorasCommand:              q.processLorasCommand,
+			WatermarkCommand:          q.processWatermarkCommand,
+			PrivacyCommand:            q.processPrivacyCommand,
+			LayoutCommand:             q.processLayoutCommand,
+			NegativeEmbeddingsCommand: q.processNegativeEmbeddingsCommand,
+			ContactSheetCommand:       q.processContactSheetCommand,
+			QuietHoursCommand:         q.processQuietHoursCommand,
+			AdminCommand:              q.processAdminCommand,
+			VersionCommand:            q.processVersionCommand,
+			StatusCommand:             q.processStatusCommand,
+			SnippetsCommand:           q.processSnippetsCommand,
+			ChannelDefaultsCommand:    q.processChannelDefaultsCommand,
+			ReferenceCommand:          q.processReferenceCommand,
+
+			GenerationDetailsCommand: q.processGenerationDetailsCommand,
 		},
 		discordgo.InteractionApplicationCommandAutocomplete: {
-			ImagineCommand: q.processImagineAutocomplete,
+			ImagineCommand:         q.processImagineAutocomplete,
+			SeedTravelCommand:      q.processImagineAutocomplete,
+			SeedCommand:            q.processSeedAutocomplete,
+			LorasCommand:           q.processLorasAutocomplete,
+			ChannelDefaultsCommand: q.processChannelDefaultsAutocomplete,
 		},
 		discordgo.InteractionModalSubmit: {
-			RawCommand: q.processRawModal,
+			RawCommand:    q.processRawModal,
+			SaveSeedModal: q.processSaveSeedModal,
 		},
 	}
 }
@@ -106,25 +254,29 @@ func (q *SDQueue) processImagineCommand(s *discordgo.Session, i *discordgo.Inter
 	if option, ok := optionMap[promptOption]; !ok {
 		return handlers.ErrorEdit(s, i.Interaction, "You need to provide a prompt.")
 	} else {
-		parameters, sanitized := utils.ExtractKeyValuePairsFromPrompt(option.StringValue())
+		parameters, sanitized := utils.ExtractKeyValuePairsFromPrompt(option.StringValue(), promptParameters)
 		item = q.NewItem(i.Interaction, WithPrompt(sanitized))
 		item.Type = ItemTypeImagine
 
-		if _, ok := interfaceConvertAuto[string, string](&item.NegativePrompt, negativeOption, optionMap, parameters); ok {
+		if _, ok := utils.InterfaceConvertAuto[string, string](&item.NegativePrompt, negativeOption, optionMap, parameters); ok {
 			item.NegativePrompt = strings.ReplaceAll(item.NegativePrompt, "{DEFAULT}", DefaultNegative)
 		}
 
-		interfaceConvertAuto[string, string](&item.SamplerName, samplerOption, optionMap, parameters)
+		utils.InterfaceConvertAuto[string, string](&item.SamplerName, samplerOption, optionMap, parameters)
 
-		if floatVal, ok := interfaceConvertAuto[int, float64](&item.Steps, stepOption, optionMap, parameters); ok {
+		if floatVal, ok := utils.InterfaceConvertAuto[int, float64](&item.Steps, stepOption, optionMap, parameters); ok {
 			item.Steps = int(*floatVal)
 		}
 
-		if floatVal, ok := interfaceConvertAuto[int64, float64](&item.Seed, seedOption, optionMap, parameters); ok {
-			item.Seed = int64(*floatVal)
+		if value, ok := utils.InterfaceConvertAuto[int64, string](nil, seedOption, optionMap, parameters); ok {
+			seed, err := q.resolveSeed(utils.GetUser(i.Interaction).ID, *value)
+			if err != nil {
+				return handlers.ErrorEdit(s, i.Interaction, "Invalid seed.", err)
+			}
+			item.Seed = seed
 		}
 
-		if boolVal, ok := interfaceConvertAuto[bool, string](&item.RestoreFaces, restoreFacesOption, optionMap, parameters); ok {
+		if boolVal, ok := utils.InterfaceConvertAuto[bool, string](&item.RestoreFaces, restoreFacesOption, optionMap, parameters); ok {
 			boolean, err := strconv.ParseBool(*boolVal)
 			if err != nil {
 				log.Printf("Error parsing restoreFaces value: %v.", err)
@@ -133,7 +285,30 @@ func (q *SDQueue) processImagineCommand(s *discordgo.Session, i *discordgo.Inter
 			}
 		}
 
-		interfaceConvertAuto[string, string](&item.ADetailerString, adModelOption, optionMap, parameters)
+		utils.InterfaceConvertAuto[string, string](&item.ADetailerString, adModelOption, optionMap, parameters)
+
+		// imagine is at the option limit, so subseeds are only taken from the prompt, e.g. subseed=1234
+		if value, ok := parameters[subseedOption]; ok {
+			subseed, err := q.resolveSeed(utils.GetUser(i.Interaction).ID, value)
+			if err != nil {
+				return handlers.ErrorEdit(s, i.Interaction, "Invalid subseed.", err)
+			}
+			item.Subseed = subseed
+		}
+		utils.InterfaceConvertAuto[float64, string](&item.SubseedStrength, subseedStrengthOption, optionMap, parameters)
+		var seedResize int64
+		if _, ok := utils.InterfaceConvertAuto[int64, string](&seedResize, seedResizeWidthOption, optionMap, parameters); ok {
+			item.SeedResizeFromW = &seedResize
+		}
+		var seedResizeHeight int64
+		if _, ok := utils.InterfaceConvertAuto[int64, string](&seedResizeHeight, seedResizeHeightOption, optionMap, parameters); ok {
+			item.SeedResizeFromH = &seedResizeHeight
+		}
+
+		// imagine has no room for another option, so a dry run is asked for with --dry_run in the prompt
+		if value, ok := parameters[dryRunOption]; ok {
+			item.DryRun = value == "" || value == "true"
+		}
 
 		if config, err := q.stableDiffusionAPI.GetConfig(); err != nil {
 			_ = handlers.ErrorEdit(s, i.Interaction, "Error retrieving config.", err)
@@ -142,16 +317,22 @@ func (q *SDQueue) processImagineCommand(s *discordgo.Session, i *discordgo.Inter
 			item.VAE = config.SDVae
 			item.Hypernetwork = config.SDHypernetwork
 		}
+		q.applyChannelDefaults(item, func(option string) bool {
+			_, inOptions := optionMap[option]
+			_, inPrompt := parameters[option]
+			return inOptions || inPrompt
+		})
 
-		interfaceConvertAuto[string, string](item.Checkpoint, checkpointOption, optionMap, parameters)
-		interfaceConvertAuto[string, string](item.VAE, vaeOption, optionMap, parameters)
-		interfaceConvertAuto[string, string](item.Hypernetwork, hypernetworkOption, optionMap, parameters)
+		utils.InterfaceConvertAuto[string, string](item.Checkpoint, checkpointOption, optionMap, parameters)
+		utils.InterfaceConvertAuto[string, string](item.VAE, vaeOption, optionMap, parameters)
+		utils.InterfaceConvertAuto[string, string](item.Hypernetwork, hypernetworkOption, optionMap, parameters)
 
 		if option, ok := optionMap[embeddingOption]; ok {
 			item.Prompt += " " + option.StringValue()
 			log.Printf("Adding embedding: %v", option.StringValue())
 		}
 
+		var usedLoras []string
 		for i := 0; i < extraLoras+1; i++ {
 			loraKey := loraOption
 			if i != 0 {
@@ -165,7 +346,7 @@ func (q *SDQueue) processImagineCommand(s *discordgo.Session, i *discordgo.Inter
 					loraValue = sanitizeTooltip(loraValue)
 
 					// add :1 if no strength is specified
-					strength := regexp.MustCompile(`:([\d.]+)$`)
+					strength := regexp.MustCompile(`:(-?[\d.]+)$`)
 					if !strength.MatchString(loraValue) {
 						loraValue += ":1"
 					}
@@ -174,13 +355,33 @@ func (q *SDQueue) processImagineCommand(s *discordgo.Session, i *discordgo.Inter
 					lora := ", <lora:" + loraValue + ">"
 					log.Println("Adding lora: ", lora)
 					item.Prompt += lora
+					usedLoras = append(usedLoras, loraValue)
+				}
+			}
+		}
+
+		memberID := utils.GetUser(i.Interaction).ID
+		if option, ok := optionMap[myLorasOption]; ok && option.BoolValue() {
+			loras, err := q.myLoras(memberID)
+			if err != nil {
+				log.Printf("Error retrieving loras of %v: %v", memberID, err)
+			}
+			for _, lora := range loras {
+				if strings.Contains(item.Prompt, "<lora:"+lora.Name+":") {
+					continue
 				}
+				loraValue := fmt.Sprintf("%s:%s", lora.Name, strconv.FormatFloat(lora.Weight, 'f', -1, 64))
+				log.Println("Adding lora from quick list: ", loraValue)
+				item.Prompt += ", <lora:" + loraValue + ">"
+				usedLoras = append(usedLoras, loraValue)
 			}
 		}
+		// recorded once the generation succeeds, see recordUsage
+		item.loras = usedLoras
 
-		interfaceConvertAuto[string, string](&item.AspectRatio, aspectRatio, optionMap, parameters)
+		utils.InterfaceConvertAuto[string, string](&item.AspectRatio, aspectRatio, optionMap, parameters)
 
-		if floatVal, ok := interfaceConvertAuto[float64, string](&item.HrScale, hiresFixSize, optionMap, parameters); ok {
+		if floatVal, ok := utils.InterfaceConvertAuto[float64, string](&item.HrScale, hiresFixSize, optionMap, parameters); ok {
 			float, err := strconv.ParseFloat(*floatVal, 64)
 			if err != nil {
 				log.Printf("Error parsing hiresUpscaleRate: %v", err)
@@ -190,7 +391,7 @@ func (q *SDQueue) processImagineCommand(s *discordgo.Session, i *discordgo.Inter
 			}
 		}
 
-		if boolVal, ok := interfaceConvertAuto[bool, string](&item.EnableHr, hiresFixOption, optionMap, parameters); ok {
+		if boolVal, ok := utils.InterfaceConvertAuto[bool, string](&item.EnableHr, hiresFixOption, optionMap, parameters); ok {
 			boolean, err := strconv.ParseBool(*boolVal)
 			if err != nil {
 				log.Printf("Error parsing hiresFix value: %v.", err)
@@ -199,17 +400,17 @@ func (q *SDQueue) processImagineCommand(s *discordgo.Session, i *discordgo.Inter
 			}
 		}
 
-		interfaceConvertAuto[float64, float64](&item.CFGScale, cfgScaleOption, optionMap, parameters)
+		utils.InterfaceConvertAuto[float64, float64](&item.CFGScale, cfgScaleOption, optionMap, parameters)
 
 		// calculate batch count and batch size. prefer batch size to be the bigger number, both numbers should add up to 4.
 		// if batch size is 4, then batch count should be 1. if both are 4, set batch size to 4 and batch count to 1.
 		// if batch size is 1, then batch count *can* be 4, but it can also be 1.
 
-		if floatVal, ok := interfaceConvertAuto[int, float64](&item.NIter, batchCountOption, optionMap, parameters); ok {
+		if floatVal, ok := utils.InterfaceConvertAuto[int, float64](&item.NIter, batchCountOption, optionMap, parameters); ok {
 			item.NIter = int(*floatVal)
 		}
 
-		if intVal, ok := interfaceConvertAuto[int, float64](&item.BatchSize, batchSizeOption, optionMap, parameters); ok {
+		if intVal, ok := utils.InterfaceConvertAuto[int, float64](&item.BatchSize, batchSizeOption, optionMap, parameters); ok {
 			item.BatchSize = int(*intVal)
 		}
 
@@ -217,7 +418,7 @@ func (q *SDQueue) processImagineCommand(s *discordgo.Session, i *discordgo.Inter
 		item.BatchSize = between(item.BatchSize, 1, maxImages)
 		item.NIter = min(maxImages/item.BatchSize, item.NIter)
 
-		if boolVal, ok := interfaceConvertAuto[bool, string](&item.RestoreFaces, restoreFacesOption, optionMap, parameters); ok {
+		if boolVal, ok := utils.InterfaceConvertAuto[bool, string](&item.RestoreFaces, restoreFacesOption, optionMap, parameters); ok {
 			boolean, err := strconv.ParseBool(*boolVal)
 			if err != nil {
 				log.Printf("Error parsing restoreFaces value: %v.", err)
@@ -226,7 +427,16 @@ func (q *SDQueue) processImagineCommand(s *discordgo.Session, i *discordgo.Inter
 			}
 		}
 
+		var invalid *ValidationError
+		if err := validateAttachments(i, img2imgOption, controlnetImage); errors.As(err, &invalid) {
+			return errorInvalid(s, i.Interaction, invalid)
+		}
+
 		attachments, err := utils.GetAttachments(i)
+		var attachmentErr *utils.AttachmentError
+		if errors.As(err, &attachmentErr) {
+			return errorInvalid(s, i.Interaction, &ValidationError{Problems: []string{attachmentErr.Error()}})
+		}
 		if err != nil {
 			return handlers.ErrorEdit(s, i.Interaction, "Error getting attachments.", err)
 		}
@@ -255,17 +465,17 @@ func (q *SDQueue) processImagineCommand(s *discordgo.Session, i *discordgo.Inter
 			item.ControlnetItem.Enabled = true
 		}
 
-		if controlVal, ok := interfaceConvertAuto[entities.ControlMode, string](&item.ControlnetItem.ControlMode, controlnetControlMode, optionMap, parameters); ok {
+		if controlVal, ok := utils.InterfaceConvertAuto[entities.ControlMode, string](&item.ControlnetItem.ControlMode, controlnetControlMode, optionMap, parameters); ok {
 			item.ControlnetItem.ControlMode = entities.ControlMode(*controlVal)
 			item.ControlnetItem.Enabled = true
 		}
 
-		if resizeVal, ok := interfaceConvertAuto[entities.ResizeMode, string](&item.ControlnetItem.ResizeMode, controlnetResizeMode, optionMap, parameters); ok {
+		if resizeVal, ok := utils.InterfaceConvertAuto[entities.ResizeMode, string](&item.ControlnetItem.ResizeMode, controlnetResizeMode, optionMap, parameters); ok {
 			item.ControlnetItem.ResizeMode = entities.ResizeMode(*resizeVal)
 			item.ControlnetItem.Enabled = true
 		}
 
-		if _, ok := interfaceConvertAuto[string, string](&item.ControlnetItem.Type, controlnetType, optionMap, parameters); ok {
+		if _, ok := utils.InterfaceConvertAuto[string, string](&item.ControlnetItem.Type, controlnetType, optionMap, parameters); ok {
 			log.Printf("Controlnet type: %v", item.ControlnetItem.Type)
 			cache, err := stable_diffusion_api.ControlnetTypesCache.GetCache(q.stableDiffusionAPI)
 			if err != nil {
@@ -280,20 +490,22 @@ func (q *SDQueue) processImagineCommand(s *discordgo.Session, i *discordgo.Inter
 			item.ControlnetItem.Enabled = true
 		}
 
-		if _, ok := interfaceConvertAuto[string, string](&item.ControlnetItem.Preprocessor, controlnetPreprocessor, optionMap, parameters); ok {
+		if _, ok := utils.InterfaceConvertAuto[string, string](&item.ControlnetItem.Preprocessor, controlnetPreprocessor, optionMap, parameters); ok {
 			// queue.ControlnetItem.Preprocessor = *preprocessor
 			item.ControlnetItem.Enabled = true
 		}
 
-		if _, ok := interfaceConvertAuto[string, string](&item.ControlnetItem.Model, controlnetModel, optionMap, parameters); ok {
+		if _, ok := utils.InterfaceConvertAuto[string, string](&item.ControlnetItem.Model, controlnetModel, optionMap, parameters); ok {
 			// queue.ControlnetItem.Model = *model
 			item.ControlnetItem.Enabled = true
 		}
 
-		interfaceConvertAuto[float64, float64](&item.OverrideSettings.CLIPStopAtLastLayers, clipSkipOption, optionMap, parameters)
+		if clipSkip, ok := utils.InterfaceConvertAuto[float64, float64](nil, clipSkipOption, optionMap, parameters); ok {
+			item.OverrideSettings.CLIPStopAtLastLayers = clipSkip
+		}
 
-		if floatVal, ok := interfaceConvertAuto[float64, float64](nil, cfgRescaleOption, optionMap, parameters); ok {
-			item.CFGRescale = &entities.CFGRescale{
+		if floatVal, ok := utils.InterfaceConvertAuto[float64, float64](nil, cfgRescaleOption, optionMap, parameters); ok {
+			item.Scripts.CFGRescale = &entities.CFGRescale{
 				Args: entities.CFGRescaleParameters{
 					CfgRescale:   *floatVal,
 					AutoColorFix: false,
@@ -304,14 +516,17 @@ func (q *SDQueue) processImagineCommand(s *discordgo.Session, i *discordgo.Inter
 		}
 
 		position, err = q.Add(item)
+		if errors.As(err, &invalid) {
+			return errorInvalid(s, i.Interaction, invalid)
+		}
 		if err != nil {
 			return handlers.ErrorEdit(s, i.Interaction, "Error adding imagine to queue.", err)
 		}
 	}
 
 	queueString := fmt.Sprintf(
-		"I'm dreaming something up for you. You are currently #%d in line.\n<@%s> asked me to imagine \n```\n%s\n```",
-		position,
+		"I'm dreaming something up for you. %s\n<@%s> asked me to imagine \n```\n%s\n```",
+		linePosition(item, position),
 		utils.GetUser(i.Interaction).ID,
 		item.Prompt,
 	)
@@ -328,7 +543,7 @@ func (q *SDQueue) processImagineCommand(s *discordgo.Session, i *discordgo.Inter
 	return nil
 }
 
-var weightRegex = regexp.MustCompile(`.+\\|\.(?:safetensors|ckpt|pth?)|(:[\d.]+$)`)
+var weightRegex = regexp.MustCompile(`.+\\|\.(?:safetensors|ckpt|pth?)|(:-?[\d.]+$)`)
 
 func (q *SDQueue) processImagineAutocomplete(_ *discordgo.Session, i *discordgo.InteractionCreate) error {
 	data := i.ApplicationCommandData()
@@ -347,10 +562,16 @@ func (q *SDQueue) processImagineAutocomplete(_ *discordgo.Session, i *discordgo.
 			return q.autocompleteModels(i, opt, stable_diffusion_api.CheckpointCache)
 		case vaeOption:
 			return q.autocompleteModels(i, opt, stable_diffusion_api.VAECache)
+		case samplerOption:
+			return q.autocompleteSampler(i, opt)
+		case adModelOption:
+			return q.autocompleteADetailer(i, opt)
 		case hypernetworkOption:
 			return q.autocompleteModels(i, opt, stable_diffusion_api.HypernetworkCache)
 		case embeddingOption:
 			return q.autocompleteModels(i, opt, stable_diffusion_api.EmbeddingCache)
+		case seedOption, seedTravelToOption:
+			return q.autocompleteSeed(i, opt, seedBookmarkPrefix)
 		case controlnetPreprocessor:
 			return q.autocompleteControlnet(i, opt, stable_diffusion_api.ControlnetModulesCache)
 		case controlnetModel:
@@ -431,13 +652,14 @@ func (q *SDQueue) autocompleteLora(i *discordgo.InteractionCreate, opt *discordg
 			Name:  tooltip,
 			Value: input,
 		})
+
+		// the member's own loras come first
+		choices = append(q.quickListChoices(utils.GetUser(i.Interaction).ID, sanitized), choices...)
 	} else {
-		choices = []*discordgo.ApplicationCommandOptionChoice{
-			{
-				Name:  "Type a lora name. Add a colon after to specify the strength. (e.g. \"clay:0.5\")",
-				Value: "placeholder",
-			},
-		}
+		choices = append(q.quickListChoices(utils.GetUser(i.Interaction).ID, ""), &discordgo.ApplicationCommandOptionChoice{
+			Name:  "Type a lora name. Add a colon after to specify the strength. (e.g. \"clay:0.5\")",
+			Value: "placeholder",
+		})
 	}
 
 	// make sure we're under 100 char limit and under 25 choices
@@ -731,7 +953,12 @@ func (q *SDQueue) processImagineModelSetting(s *discordgo.Session, i *discordgo.
 		return err
 	}
 
-	err = q.stableDiffusionAPI.UpdateConfiguration(config)
+	// every backend loads the default, so generations don't switch models depending on where they run
+	for _, b := range q.backends {
+		if err = b.api.UpdateConfiguration(config); err != nil {
+			break
+		}
+	}
 	if err != nil {
 		log.Printf("error updating sd model name settings: %v", err)
 		return handlers.ErrorEphemeral(s, i.Interaction,
@@ -956,6 +1183,11 @@ func (q *SDQueue) processRefreshCommand(s *discordgo.Session, i *discordgo.Inter
 			stable_diffusion_api.LoraCache,
 			stable_diffusion_api.CheckpointCache,
 			stable_diffusion_api.VAECache,
+			stable_diffusion_api.SamplerCache,
+			stable_diffusion_api.SchedulerCache,
+		}
+		if q.hasFeature(stable_diffusion_api.FeatureADetailer) {
+			toRefresh = append(toRefresh, stable_diffusion_api.ADetailerModelCache)
 		}
 	}
 
@@ -981,10 +1213,406 @@ func (q *SDQueue) processRefreshCommand(s *discordgo.Session, i *discordgo.Inter
 	return err
 }
 
-// processRawCommand responds with a Modal to receive a json blob from the user to pass to the api
+// processErrorsCommand lists the most recent failed generations with their errors, attaching the logs captured for each
+func (q *SDQueue) processErrorsCommand(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	if err := handlers.EphemeralThink(s, i); err != nil {
+		return err
+	}
+
+	limit := 5
+	if option, ok := utils.GetOpts(i.ApplicationCommandData())[errorsLimitOption]; ok {
+		limit = int(option.IntValue())
+	}
+
+	// failures of every guild, and of DMs, are only visible to the bot owner
+	guildID := i.GuildID
+	if handlers.IsOwner(i.Interaction) {
+		guildID = ""
+	} else if guildID == "" {
+		return handlers.ErrorEdit(s, i.Interaction, "You can only list failed generations in a server.")
+	}
+
+	failures, err := q.failedGenerationRepo.GetRecent(context.Background(), guildID, limit)
+	if err != nil {
+		return handlers.ErrorEdit(s, i.Interaction, "Error retrieving failed generations.", err)
+	}
+
+	if len(failures) == 0 {
+		_, err = handlers.EditInteractionResponse(s, i.Interaction, "No failed generations recorded.")
+		return err
+	}
+
+	var embeds []*discordgo.MessageEmbed
+	var files []*discordgo.File
+	for _, failure := range failures {
+		if failure.Log != "" {
+			files = append(files, &discordgo.File{
+				Name:        fmt.Sprintf("failure-%d.log", failure.ID),
+				ContentType: "text/plain",
+				Reader:      strings.NewReader(failure.Log),
+			})
+		}
+		embeds = append(embeds, &discordgo.MessageEmbed{
+			Title:       fmt.Sprintf("Failed generation #%d", failure.ID),
+			Description: fmt.Sprintf("```\n%s\n```", shortenTo(failure.Error, 1000)),
+			Timestamp:   failure.CreatedAt.Format(time.RFC3339),
+			Color:       0xff0000,
+			Fields: []*discordgo.MessageEmbedField{
+				{
+					Name:   "User",
+					Value:  fmt.Sprintf("<@%s>", failure.MemberID),
+					Inline: true,
+				},
+				{
+					Name:   "Backend",
+					Value:  fmt.Sprintf("`%s`", failure.Backend),
+					Inline: true,
+				},
+				{
+					Name:  "Request",
+					Value: fmt.Sprintf("```json\n%s\n```", shortenTo(failure.Request, 900)),
+				},
+			},
+		})
+	}
+
+	webhook := &discordgo.WebhookEdit{Embeds: &embeds, Files: files}
+	_, err = handlers.EditInteractionResponse(s, i.Interaction, webhook)
+	return err
+}
+
+func (q *SDQueue) processLookupCommand(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	if err := handlers.EphemeralThink(s, i); err != nil {
+		return err
+	}
+
+	option, ok := utils.GetOpts(i.ApplicationCommandData())[messageLinkOption]
+	if !ok {
+		return handlers.ErrorEdit(s, i.Interaction, "You need to provide a message link.")
+	}
+
+	generations, err := q.imageGenerationRepo.ResolveMessageLink(context.Background(), option.StringValue())
+	if err != nil {
+		return handlers.ErrorEdit(s, i.Interaction, "Could not find a generation for this message.", err)
+	}
+
+	// generations from other guilds are only visible to the bot owner
+	if guildID := generations[0].GuildID; guildID != "" && guildID != i.GuildID && !handlers.IsOwner(i.Interaction) {
+		return handlers.ErrorEdit(s, i.Interaction, "You can only look up generations from this server.")
+	}
+
+	return q.showGenerationDetails(s, i, generations)
+}
+
+func (q *SDQueue) processGenerationDetailsCommand(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	if err := handlers.EphemeralThink(s, i); err != nil {
+		return err
+	}
+
+	generations, err := q.imageGenerationRepo.GetAllByMessage(context.Background(), i.ApplicationCommandData().TargetID)
+	var notFound *repositories.NotFoundError
+	if errors.As(err, &notFound) {
+		return q.showImageMetadata(s, i)
+	}
+	if err != nil {
+		return handlers.ErrorEdit(s, i.Interaction, "Could not find a generation for this message.", err)
+	}
+
+	return q.showGenerationDetails(s, i, generations)
+}
+
+func (q *SDQueue) showGenerationDetails(s *discordgo.Session, i *discordgo.InteractionCreate, generations []*entities.ImageGenerationRequest) error {
+	var embeds []*discordgo.MessageEmbed
+	for _, generation := range generations[:min(len(generations), 10)] {
+		fields := []*discordgo.MessageEmbedField{
+			{
+				Name:  "Checkpoint",
+				Value: fmt.Sprintf("`%v` `%v`", safeDereference(generation.Checkpoint), safeDereference(generation.CheckpointHash)),
+			},
+		}
+		if generation.Anlas != nil {
+			fields = append(fields, &discordgo.MessageEmbedField{
+				Name:  "Anlas",
+				Value: fmt.Sprintf("`%d`", *generation.Anlas),
+			})
+		}
+		if len(generation.ExtraNetworks) > 0 {
+			var networks []string
+			for _, network := range generation.ExtraNetworks {
+				networks = append(networks, fmt.Sprintf("%s `%s` `%s`", network.Type, network.Name, network.Hash))
+			}
+			fields = append(fields, &discordgo.MessageEmbedField{
+				Name:  "Extra networks",
+				Value: shortenTo(strings.Join(networks, "\n"), 1000),
+			})
+		}
+
+		if generation.ParentID != nil {
+			var factor float64
+			if generation.UpscaleFactor != nil {
+				factor = *generation.UpscaleFactor
+			}
+			fields = append(fields, &discordgo.MessageEmbedField{
+				Name: "Upscale",
+				Value: fmt.Sprintf("Upscaled generation #%d with `%v` (`%gx`)",
+					*generation.ParentID, safeDereference(generation.Upscaler), factor),
+			})
+		}
+		if upscales, err := q.imageGenerationRepo.GetChildren(context.Background(), generation.ID); err != nil {
+			log.Printf("Error retrieving upscales of generation %d: %v", generation.ID, err)
+		} else if len(upscales) > 0 {
+			var links []string
+			for _, upscale := range upscales {
+				links = append(links, fmt.Sprintf("https://discord.com/channels/%s/%s/%s",
+					guildOrMe(upscale.GuildID), upscale.ChannelID, upscale.MessageID))
+			}
+			fields = append(fields, &discordgo.MessageEmbedField{
+				Name:  "Upscales",
+				Value: shortenTo(strings.Join(links, "\n"), 1000),
+			})
+		}
+
+		embeds = append(embeds, &discordgo.MessageEmbed{
+			Title: fmt.Sprintf("Generation #%d (image %d)", generation.ID, generation.SortOrder),
+			Description: fmt.Sprintf("<@%s> generated `%d x %d`, `%d` steps, cfg: `%0.1f`, seed: `%d`, sampler: `%s`\n```\n%s\n```",
+				generation.MemberID, generation.Width, generation.Height, generation.Steps,
+				generation.CFGScale, generation.Seed, generation.SamplerName, shortenTo(generation.Prompt, 1000)),
+			Timestamp: generation.CreatedAt.Format(time.RFC3339),
+			Fields:    fields,
+		})
+	}
+
+	webhook := &discordgo.WebhookEdit{Embeds: &embeds}
+
+	// raw JSON generations also include exactly what was sent to and returned by the API
+	for _, generation := range generations {
+		if generation.RawRequest == nil {
+			continue
+		}
+		webhook.Files = append(webhook.Files, &discordgo.File{
+			Name:        "request.json",
+			ContentType: "application/json",
+			Reader:      strings.NewReader(*generation.RawRequest),
+		})
+		if generation.RawInfo != nil {
+			webhook.Files = append(webhook.Files, &discordgo.File{
+				Name:        "info.json",
+				ContentType: "application/json",
+				Reader:      strings.NewReader(*generation.RawInfo),
+			})
+		}
+		break
+	}
+
+	_, err := handlers.EditInteractionResponse(s, i.Interaction, webhook)
+	return err
+}
+
+func (q *SDQueue) processUsageCommand(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	if err := handlers.EphemeralThink(s, i); err != nil {
+		return err
+	}
+
+	days := 30
+	if option, ok := utils.GetOpts(i.ApplicationCommandData())[usageDaysOption]; ok {
+		days = int(option.IntValue())
+	}
+
+	user := utils.GetUser(i.Interaction)
+	since := time.Now().AddDate(0, 0, -days+1)
+	usages, err := q.usageRepo.GetByMemberID(context.Background(), user.ID, since)
+	if err != nil {
+		return handlers.ErrorEdit(s, i.Interaction, "Error retrieving usage.", err)
+	}
+
+	totals := make(map[string]*entities.Usage)
+	var backends []string
+	for _, usage := range usages {
+		total, ok := totals[usage.Backend]
+		if !ok {
+			total = &entities.Usage{Backend: usage.Backend}
+			totals[usage.Backend] = total
+			backends = append(backends, usage.Backend)
+		}
+		total.Images += usage.Images
+		total.Megapixels += usage.Megapixels
+		total.GPUSeconds += usage.GPUSeconds
+		total.Anlas += usage.Anlas
+	}
+
+	embed := discordgo.MessageEmbed{
+		Title:       fmt.Sprintf("Usage for the last %d days", days),
+		Description: fmt.Sprintf("<@%s>", user.ID),
+	}
+	if len(backends) == 0 {
+		embed.Description += " has not generated anything yet."
+	}
+	for _, backend := range backends {
+		total := totals[backend]
+		value := fmt.Sprintf("Images: `%d`\nMegapixels: `%.1f`\nGeneration time: `%s`",
+			total.Images, total.Megapixels, (time.Duration(total.GPUSeconds) * time.Second).String())
+		if total.Anlas > 0 {
+			value += fmt.Sprintf("\nAnlas: `%d`", total.Anlas)
+		}
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:   backend,
+			Value:  value,
+			Inline: true,
+		})
+	}
+
+	if q.anlasBudget.Limited() && !handlers.IsOwner(i.Interaction) {
+		field, err := q.anlasBudgetField(user.ID)
+		if err != nil {
+			return handlers.ErrorEdit(s, i.Interaction, "Error retrieving usage.", err)
+		}
+		embed.Fields = append(embed.Fields, field)
+	}
+
+	_, err = handlers.EditInteractionResponse(s, i.Interaction, embed)
+	return err
+}
+
+// anlasBudgetField shows what the member spent on NovelAI against their daily and monthly budget
+func (q *SDQueue) anlasBudgetField(memberID string) (*discordgo.MessageEmbedField, error) {
+	today, month, err := q.usageRepo.AnlasSpent(context.Background(), memberID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	if q.anlasBudget.Daily > 0 {
+		lines = append(lines, fmt.Sprintf("Today: `%d / %d`", today, q.anlasBudget.Daily))
+	}
+	if q.anlasBudget.Monthly > 0 {
+		lines = append(lines, fmt.Sprintf("This month: `%d / %d`", month, q.anlasBudget.Monthly))
+	}
+	lines = append(lines, fmt.Sprintf("Left: `%d`", q.anlasBudget.Remaining(today, month)))
+
+	return &discordgo.MessageEmbedField{
+		Name:   "NovelAI budget (UTC)",
+		Value:  strings.Join(lines, "\n"),
+		Inline: true,
+	}, nil
+}
+
+const leaderboardSize = 10
+
+func (q *SDQueue) processStatsCommand(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	if err := handlers.EphemeralThink(s, i); err != nil {
+		return err
+	}
+
+	// an empty guild counts every guild, only the bot owner sees those outside of a server
+	if i.GuildID == "" && !handlers.IsOwner(i.Interaction) {
+		return handlers.ErrorEdit(s, i.Interaction, "You can only see stats in a server.")
+	}
+
+	optionMap := utils.GetOpts(i.ApplicationCommandData())
+
+	days := 30
+	if option, ok := optionMap[usageDaysOption]; ok {
+		days = int(option.IntValue())
+	}
+
+	var memberID string
+	if option, ok := optionMap[statsUserOption]; ok {
+		memberID = option.UserValue(nil).ID
+	}
+
+	since := time.Now().AddDate(0, 0, -days+1)
+	images, err := q.statsRepo.CountImages(context.Background(), i.GuildID, memberID, since)
+	if err != nil {
+		return handlers.ErrorEdit(s, i.Interaction, "Error retrieving stats.", err)
+	}
+
+	checkpoints, err := q.statsRepo.TopCheckpoints(context.Background(), i.GuildID, memberID, since, leaderboardSize)
+	if err != nil {
+		return handlers.ErrorEdit(s, i.Interaction, "Error retrieving stats.", err)
+	}
+
+	embed := discordgo.MessageEmbed{
+		Title:       fmt.Sprintf("Stats for the last %d days", days),
+		Description: fmt.Sprintf("`%d` images generated", images),
+	}
+	if memberID != "" {
+		embed.Description = fmt.Sprintf("<@%s>: %s", memberID, embed.Description)
+	}
+	if len(checkpoints) > 0 {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  "Top checkpoints",
+			Value: leaderboard(checkpoints, func(key string) string { return fmt.Sprintf("`%s`", cmp.Or(key, "unknown")) }),
+		})
+	}
+
+	_, err = handlers.EditInteractionResponse(s, i.Interaction, embed)
+	return err
+}
+
+func (q *SDQueue) processLeaderboardCommand(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	if err := handlers.ThinkResponse(s, i); err != nil {
+		return err
+	}
+
+	// an empty guild counts every guild, only the bot owner sees those outside of a server
+	if i.GuildID == "" && !handlers.IsOwner(i.Interaction) {
+		return handlers.ErrorEdit(s, i.Interaction, "You can only see stats in a server.")
+	}
+
+	days := 30
+	if option, ok := utils.GetOpts(i.ApplicationCommandData())[usageDaysOption]; ok {
+		days = int(option.IntValue())
+	}
+
+	since := time.Now().AddDate(0, 0, -days+1)
+	members, err := q.statsRepo.TopMembers(context.Background(), i.GuildID, since, leaderboardSize)
+	if err != nil {
+		return handlers.ErrorEdit(s, i.Interaction, "Error retrieving leaderboard.", err)
+	}
+
+	embed := discordgo.MessageEmbed{
+		Title:       fmt.Sprintf("Leaderboard for the last %d days", days),
+		Description: "No images generated yet.",
+	}
+	if len(members) > 0 {
+		embed.Description = leaderboard(members, func(key string) string { return fmt.Sprintf("<@%s>", key) })
+	}
+
+	_, err = handlers.EditInteractionResponse(s, i.Interaction, &discordgo.WebhookEdit{
+		Embeds:          &[]*discordgo.MessageEmbed{&embed},
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	return err
+}
+
+// leaderboard formats entries as a numbered list, using format to display each key
+func leaderboard(entries []*entities.StatsEntry, format func(key string) string) string {
+	var out strings.Builder
+	for rank, entry := range entries {
+		out.WriteString(fmt.Sprintf("%d. %s: `%d`\n", rank+1, format(entry.Key), entry.Images))
+	}
+	return shortenTo(out.String(), 1000)
+}
+
+// shortenTo truncates s to at most n bytes to fit in embed limits, cutting on a rune boundary so the result stays
+// valid UTF-8
+func shortenTo(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + "..."
+}
+
 func (q *SDQueue) processRawCommand(s *discordgo.Session, i *discordgo.InteractionCreate) error {
 	optionMap := utils.GetOpts(i.ApplicationCommandData())
 
+	if option, ok := optionMap[schemaOption]; ok && option.BoolValue() {
+		return q.processRawSchema(s, i)
+	}
+
 	params := entities.RawParams{
 		UseDefault: true,
 		Unsafe:     false,
@@ -997,6 +1625,10 @@ func (q *SDQueue) processRawCommand(s *discordgo.Session, i *discordgo.Interacti
 		params.Unsafe = option.BoolValue()
 	}
 
+	if option, ok := optionMap[dryRunOption]; ok {
+		params.DryRun = option.BoolValue()
+	}
+
 	if interactionBytes, err := json.Marshal(i.Interaction); err != nil {
 		log.Printf("Error marshalling interaction: %v", err)
 	} else {
@@ -1069,6 +1701,10 @@ func (q *SDQueue) processRawCommand(s *discordgo.Session, i *discordgo.Interacti
 
 	params.Debug = strings.Contains(attachment.Filename, "DEBUG")
 	if err := q.jsonToQueue(i, params); err != nil {
+		var invalid *ValidationError
+		if errors.As(err, &invalid) {
+			return errorInvalid(s, i.Interaction, invalid)
+		}
 		return handlers.ErrorEdit(s, i.Interaction, "Error adding imagine to queue.", err)
 	}
 
@@ -1127,6 +1763,10 @@ func (q *SDQueue) processRawModal(s *discordgo.Session, i *discordgo.Interaction
 		params.Debug = strings.Contains(data.Value, "{DEBUG}")
 		params.Blob = []byte(strings.ReplaceAll(data.Value, "{DEBUG}", ""))
 		if err := q.jsonToQueue(i, params); err != nil {
+			var invalid *ValidationError
+			if errors.As(err, &invalid) {
+				return errorInvalid(s, i.Interaction, invalid)
+			}
 			return handlers.ErrorEdit(s, i.Interaction, "Error adding imagine to queue.", err)
 		}
 	}
@@ -1143,15 +1783,39 @@ func (q *SDQueue) jsonToQueue(i *discordgo.InteractionCreate, params entities.Ra
 		item = q.NewItem(i.Interaction)
 	}
 
+	blob, err := normalizeJSON(params.Blob)
+	if err != nil {
+		return &ValidationError{Problems: []string{err.Error()}}
+	}
+	params.Blob = blob
+
+	if !params.Unsafe {
+		if problems := rawSchema().Validate(params.Blob); len(problems) > 0 {
+			return &ValidationError{Problems: problems}
+		}
+	}
+
 	item.Type = ItemTypeRaw
+	item.DryRun = params.DryRun
 	item.Raw = &entities.TextToImageRaw{TextToImageRequest: item.ImageGenerationRequest.TextToImageRequest, RawParams: params}
 
 	// Override Scripts by unmarshalling to Raw
-	err := json.Unmarshal(params.Blob, &item.Raw)
+	err = json.Unmarshal(params.Blob, &item.Raw)
 	if err != nil {
 		return err
 	}
 
+	// keep the scripts with the generation so rerolls send them again
+	if item.Raw.RawScripts != nil {
+		scripts, err := json.Marshal(item.Raw.RawScripts)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(scripts, &item.Raw.TextToImageRequest.Scripts); err != nil {
+			return fmt.Errorf("error reading alwayson_scripts: %w", err)
+		}
+	}
+
 	item.ImageGenerationRequest.TextToImageRequest = item.Raw.TextToImageRequest
 
 	position, err := q.Add(item)
@@ -1159,7 +1823,7 @@ func (q *SDQueue) jsonToQueue(i *discordgo.InteractionCreate, params entities.Ra
 		return err
 	}
 	message, err := handlers.EditInteractionResponse(q.botSession, i.Interaction,
-		fmt.Sprintf("I'm dreaming something up for you. You are currently #%d in line. Defaults: %v", position, params.UseDefault),
+		fmt.Sprintf("I'm dreaming something up for you. %s Defaults: %v", linePosition(item, position), params.UseDefault),
 		handlers.Components[handlers.Cancel],
 	)
 	if item.DiscordInteraction != nil && item.DiscordInteraction.Message == nil && message != nil {
@@ -1172,44 +1836,3 @@ func (q *SDQueue) jsonToQueue(i *discordgo.InteractionCreate, params entities.Ra
 
 type Command = string
 type CommandOption = string
-
-// If FieldType and ValueType are the same, then we attempt to assert FieldType to value.Value
-// Otherwise, we return the interface conversion to the caller to do manual type conversion
-//
-// Example:
-//
-//	if int64Val, ok := interfaceConvertAuto[int, int64](&queue.Steps, stepOption, optionMap, parameters); ok {
-//		queue.Steps = int(*int64Val)
-//	}
-//
-// (*discordgo.ApplicationCommandInteractionDataOption).IntValue() actually uses float64 for the interface conversion, so use float64 for integers, numbers, etc.
-// and then convert to the desired type.
-// Only string and float64 are supported for V as that's what the discordgo API returns.
-// If the field is nil, then we don't assign the value to the field.
-// Instead, we return *V and bool to indicate whether the conversion was successful.
-// This is useful for when we want to convert to a type that is not the same as the field type.
-func interfaceConvertAuto[F any, V string | float64](field *F, option CommandOption, optionMap map[CommandOption]*discordgo.ApplicationCommandInteractionDataOption, parameters map[CommandOption]string) (*V, bool) {
-	if value, ok := optionMap[option]; ok {
-		vToField, ok := value.Value.(F)
-		if ok && field != nil {
-			*field = vToField
-		}
-		valueType, ok := value.Value.(V)
-		return &valueType, ok
-	}
-	if value, ok := parameters[option]; ok {
-		if field != nil {
-			_, err := fmt.Sscanf(value, "%v", field)
-			if err != nil {
-				return nil, false
-			}
-		}
-		var out V
-		_, err := fmt.Sscanf(value, "%v", &out)
-		if err != nil {
-			return nil, false
-		}
-		return &out, true
-	}
-	return nil, false
-}
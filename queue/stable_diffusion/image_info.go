@@ -0,0 +1,82 @@
+package stable_diffusion
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"strings"
+
+	"stable_diffusion_bot/composite_renderer"
+	"stable_diffusion_bot/discord_bot/handlers"
+	"stable_diffusion_bot/utils"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// imageMetadata returns the generation parameters embedded in an image by the WebUI, NovelAI or its stealth
+// alpha channel encoding
+func imageMetadata(data []byte) (string, error) {
+	if texts, err := composite_renderer.TextChunks(data); err == nil {
+		if parameters := texts[composite_renderer.ParametersKey]; parameters != "" {
+			return parameters, nil
+		}
+		// NovelAI keeps the prompt in Description and the settings as JSON in Comment
+		if comment := texts["Comment"]; comment != "" {
+			return strings.TrimSpace(texts["Description"] + "\n" + comment), nil
+		}
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	return utils.DecodeStealthInfo(img)
+}
+
+// showImageMetadata reads the parameters of the images attached to a message that wasn't generated by the bot
+func (q *SDQueue) showImageMetadata(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	data := i.ApplicationCommandData()
+	var message *discordgo.Message
+	if data.Resolved != nil {
+		message = data.Resolved.Messages[data.TargetID]
+	}
+	if message == nil {
+		return handlers.ErrorEdit(s, i.Interaction, "Could not find a generation for this message.")
+	}
+
+	var embeds []*discordgo.MessageEmbed
+	for _, attachment := range message.Attachments {
+		if len(embeds) == 10 {
+			break
+		}
+		if !strings.HasPrefix(attachment.ContentType, "image") {
+			continue
+		}
+
+		image, err := utils.GetDataFromUrl(attachment.URL)
+		if err != nil {
+			return handlers.ErrorEdit(s, i.Interaction, "Error downloading image.", err)
+		}
+
+		metadata, err := imageMetadata(image)
+		if errors.Is(err, utils.ErrNoStealthInfo) {
+			continue
+		}
+		if err != nil {
+			return handlers.ErrorEdit(s, i.Interaction, fmt.Sprintf("Error reading the metadata of %s.", attachment.Filename), err)
+		}
+
+		embeds = append(embeds, &discordgo.MessageEmbed{
+			Title:       attachment.Filename,
+			Description: fmt.Sprintf("```\n%s\n```", shortenTo(metadata, 4000)),
+		})
+	}
+
+	if len(embeds) == 0 {
+		return handlers.ErrorEdit(s, i.Interaction, "This message has no generation or images with generation parameters.")
+	}
+
+	_, err := handlers.EditInteractionResponse(s, i.Interaction, &discordgo.WebhookEdit{Embeds: &embeds})
+	return err
+}
@@ -1,31 +1,25 @@
 package stable_diffusion
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
 
 	"stable_diffusion_bot/entities"
-	"stable_diffusion_bot/utils"
 )
 
 // TODO: Implement separate processing for Img2Img, possibly use github.com/SpenserCai/sd-webui-go/intersvc
 // Deprecated: still using processCurrentImagine
-func (q *SDQueue) processImg2ImgImagine() error {
-	// defer q.done()
-	return q.processCurrentImagine()
+func (q *SDQueue) processImg2ImgImagine(item *SDQueueItem) error {
+	return q.processCurrentImagine(item)
 }
 
-func (q *SDQueue) imageToImage() ([]string, error) {
-	queue := q.currentImagine
-	img2img := t2iToImg2Img(queue.TextToImageRequest)
-
-	err := calculateImg2ImgDimensions(queue, &img2img)
+func (q *SDQueue) imageToImage(queue *SDQueueItem) ([]string, error) {
+	img2img, err := img2imgRequest(queue)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := q.stableDiffusionAPI.ImageToImageRequest(&img2img)
+	resp, err := q.api(queue).ImageToImageRequest(queue.Context(), img2img)
 	if err != nil {
 		return nil, err
 	}
@@ -33,13 +27,27 @@ func (q *SDQueue) imageToImage() ([]string, error) {
 	return resp.Images, nil
 }
 
+// img2imgRequest builds the img2img request of the item with the attached image as its init image
+func img2imgRequest(queue *SDQueueItem) (*entities.ImageToImageRequest, error) {
+	img2img, err := entities.NewImageToImageRequest(queue.TextToImageRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	err = calculateImg2ImgDimensions(queue, img2img)
+	if err != nil {
+		return nil, err
+	}
+
+	return img2img, nil
+}
+
 func calculateImg2ImgDimensions(queue *SDQueueItem, img2img *entities.ImageToImageRequest) error {
 	if queue.Img2ImgItem.Image == nil {
 		return errors.New("no attached images found, skipping img2img generation")
 	}
 
-	bin := queue.Img2ImgItem.Image.Bytes()
-	width, height, err := utils.GetImageSize(bytes.NewReader(bin))
+	width, height, err := queue.Img2ImgItem.Image.Size()
 	if err != nil {
 		return fmt.Errorf("error getting image size: %w", err)
 	}
@@ -48,7 +56,8 @@ func calculateImg2ImgDimensions(queue *SDQueueItem, img2img *entities.ImageToIma
 	gcd := calculateGCD(width, height)
 	aspectRatio := fmt.Sprintf("%d:%d", width/gcd, height/gcd)
 
-	*img2img.Width, *img2img.Height = aspectRatioCalculation(aspectRatio, initializedWidth, initializedHeight)
+	width, height = aspectRatioCalculation(aspectRatio, initializedWidth, initializedHeight)
+	img2img.Width, img2img.Height = &width, &height
 
 	base64, err := queue.Img2ImgItem.Image.Base64()
 	if err != nil {
@@ -64,45 +73,3 @@ func calculateGCD(a, b int) int {
 	}
 	return a
 }
-
-func t2iToImg2Img(textToImage *entities.TextToImageRequest) entities.ImageToImageRequest {
-	img2img := entities.ImageToImageRequest{
-		Scripts:                           textToImage.Scripts,
-		BatchSize:                         textToImage.BatchSize,
-		CFGScale:                          &textToImage.CFGScale,
-		DenoisingStrength:                 &textToImage.DenoisingStrength,
-		Height:                            &textToImage.Height,
-		ImageCFGScale:                     &textToImage.CFGScale,
-		IncludeInitImages:                 nil,
-		InitImages:                        nil,
-		NIter:                             textToImage.NIter,
-		NegativePrompt:                    &textToImage.NegativePrompt,
-		OverrideSettings:                  textToImage.OverrideSettings,
-		OverrideSettingsRestoreAfterwards: textToImage.OverrideSettingsRestoreAfterwards,
-		Prompt:                            textToImage.Prompt,
-		RefinerCheckpoint:                 textToImage.RefinerCheckpoint,
-		RefinerSwitchAt:                   textToImage.RefinerSwitchAt,
-		RestoreFaces:                      &textToImage.RestoreFaces,
-		SChurn:                            textToImage.SChurn,
-		SMinUncond:                        textToImage.SMinUncond,
-		SNoise:                            textToImage.SNoise,
-		STmax:                             textToImage.STmax,
-		STmin:                             textToImage.STmin,
-		SamplerIndex:                      textToImage.SamplerIndex,
-		SamplerName:                       &textToImage.SamplerName,
-		SaveImages:                        textToImage.SaveImages,
-		ScriptArgs:                        textToImage.ScriptArgs,
-		ScriptName:                        textToImage.ScriptName,
-		Seed:                              &textToImage.Seed,
-		SeedResizeFromH:                   textToImage.SeedResizeFromH,
-		SeedResizeFromW:                   textToImage.SeedResizeFromW,
-		SendImages:                        textToImage.SendImages,
-		Steps:                             &textToImage.Steps,
-		Styles:                            textToImage.Styles,
-		Subseed:                           &textToImage.Subseed,
-		SubseedStrength:                   &textToImage.SubseedStrength,
-		Tiling:                            textToImage.Tiling,
-		Width:                             &textToImage.Width,
-	}
-	return img2img
-}
@@ -1,6 +1,7 @@
 package stable_diffusion
 
 import (
+	"context"
 	"log"
 	"time"
 
@@ -9,6 +10,7 @@ import (
 
 	"stable_diffusion_bot/api/stable_diffusion_api"
 	"stable_diffusion_bot/entities"
+	"stable_diffusion_bot/logging"
 	"stable_diffusion_bot/utils"
 )
 
@@ -31,7 +33,49 @@ type SDQueueItem struct {
 
 	Raw *entities.TextToImageRaw // raw JSON input
 
+	DryRun bool // post the request back instead of sending it, see SDQueue.isDryRun
+
 	Interrupt chan *discordgo.Interaction
+
+	timelapse  *timelapse  // live preview frames, set while generating
+	queued     time.Time   // when the item was added to the queue
+	heldUntil  time.Time   // when the item is queued, if it was held for quiet hours
+	seedTravel *seedTravel // frames to generate between the seed and subseed, see processSeedTravelCommand
+	timings    *timings    // how long each phase took, set while generating
+	backend    *backend    // where the item is generated, set when it's dispatched
+	started    time.Time   // when the item was dispatched to its backend
+	attempts   int         // how many times the item was retried after its backend died, see SDQueue.retry
+	recorded   bool        // the generation was saved, so a retry doesn't save it again
+	loras      []string    // the LoRAs picked in the command options as name:weight, see recordLoraUses
+	// logs collects the lines logged for the item while it's generated, to record with its failure. Log through it
+	// instead of the log package so the lines of generations running on other backends don't end up in it.
+	logs *logging.Capture
+
+	// channelDefaults are what was taken from the defaults of the channel, see applyChannelDefaults
+	channelDefaults []string
+	// references are the images of /reference, shown as thumbnails
+	references []*utils.Image
+	// refine is the step of the refinement chain this img2img continues, see processRefineSelect
+	refine *entities.RefineStep
+
+	// ctx is cancelled when the item is interrupted, aborting its requests to the API
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Context returns the context of the item while it's processed, requests made with it are aborted on interrupt
+func (item *SDQueueItem) Context() context.Context {
+	if item.ctx == nil {
+		return context.Background()
+	}
+	return item.ctx
+}
+
+// abort cancels the requests of the item still in flight
+func (item *SDQueueItem) abort() {
+	if item.cancel != nil {
+		item.cancel()
+	}
 }
 
 type Img2ImgItem struct {
@@ -56,7 +100,7 @@ func (q *SDQueueItem) Interaction() *discordgo.Interaction {
 }
 
 func (q *SDQueue) NewItem(interaction *discordgo.Interaction, options ...func(*SDQueueItem)) *SDQueueItem {
-	item := q.DefaultQueueItem()
+	item := q.defaultQueueItem(interaction)
 	item.DiscordInteraction = interaction
 
 	for _, option := range options {
@@ -90,31 +134,13 @@ const DefaultNegative = "ugly, tiling, poorly drawn hands, poorly drawn feet, po
 	"body out of frame, blurry, bad art, bad anatomy, blurred, text, watermark, grainy"
 
 func (q *SDQueue) DefaultQueueItem() *SDQueueItem {
-	defaultBatchCount, err := q.defaultBatchCount()
-	if err != nil {
-		log.Printf("Error getting default batch count: %v", err)
-		defaultBatchCount = 1
-	}
-
-	defaultBatchSize, err := q.defaultBatchSize()
-	if err != nil {
-		log.Printf("Error getting default batch size: %v", err)
-		defaultBatchSize = 4
-	}
-
-	defaultWidth, err := q.defaultWidth()
-	if err != nil {
-		log.Printf("Error getting default width: %v", err)
-		defaultWidth = 512
-	}
-
-	defaultHeight, err := q.defaultHeight()
-	if err != nil {
-		log.Printf("Error getting default height: %v", err)
-		defaultHeight = 512
-	}
+	return q.defaultQueueItem(nil)
+}
 
-	return &SDQueueItem{
+// defaultQueueItem starts an item from the defaults resolved for the interaction, see MergeDefaults.
+// The command options are set on top of it.
+func (q *SDQueue) defaultQueueItem(interaction *discordgo.Interaction) *SDQueueItem {
+	item := &SDQueueItem{
 		Type: ItemTypeImagine,
 
 		ImageGenerationRequest: &entities.ImageGenerationRequest{
@@ -122,20 +148,9 @@ func (q *SDQueue) DefaultQueueItem() *SDQueueItem {
 				CreatedAt: time.Now(),
 			},
 			TextToImageRequest: &entities.TextToImageRequest{
-				Width:             defaultWidth,
-				Height:            defaultHeight,
-				NegativePrompt:    DefaultNegative,
-				Steps:             20,
-				Seed:              -1,
-				SamplerName:       "Euler a",
-				EnableHr:          false,
-				HrUpscaler:        "R-ESRGAN 2x+",
-				HrSecondPassSteps: 20,
-				HrScale:           1.0,
-				DenoisingStrength: 0.7,
-				CFGScale:          7.0,
-				NIter:             defaultBatchCount,
-				BatchSize:         defaultBatchSize,
+				Seed:     -1,
+				EnableHr: false,
+				HrScale:  1.0,
 			},
 		},
 
@@ -147,4 +162,7 @@ func (q *SDQueue) DefaultQueueItem() *SDQueueItem {
 			ResizeMode:  entities.ResizeModeScaleToFit,
 		},
 	}
+	q.resolveDefaults(interaction).Apply(item.TextToImageRequest)
+
+	return item
 }
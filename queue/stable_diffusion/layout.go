@@ -0,0 +1,95 @@
+package stable_diffusion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"stable_diffusion_bot/discord_bot/handlers"
+	"stable_diffusion_bot/entities"
+	"stable_diffusion_bot/repositories"
+	"stable_diffusion_bot/utils"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// postIndividually reports whether the member, or the guild if the member hasn't chosen, posts images without a grid
+func (q *SDQueue) postIndividually(guildID, memberID string) bool {
+	setting, err := q.layoutSettingRepo.Resolve(context.Background(), guildID, memberID)
+	var notFound *repositories.NotFoundError
+	if err != nil {
+		if !errors.As(err, &notFound) {
+			log.Printf("Error getting layout settings for guild %s, member %s: %v", guildID, memberID, err)
+		}
+		return false
+	}
+	return setting.Individual
+}
+
+func (q *SDQueue) processLayoutCommand(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	if err := handlers.EphemeralThink(s, i); err != nil {
+		return err
+	}
+
+	data := i.ApplicationCommandData()
+	if len(data.Options) == 0 {
+		return handlers.ErrorEdit(s, i.Interaction, "You need to choose a subcommand.")
+	}
+
+	subcommand := data.Options[0]
+	optionMap := make(map[string]*discordgo.ApplicationCommandInteractionDataOption, len(subcommand.Options))
+	for _, opt := range subcommand.Options {
+		optionMap[opt.Name] = opt
+	}
+
+	setting := &entities.LayoutSetting{}
+	switch "layout_" + subcommand.Name {
+	case layoutMeOption:
+		setting.Scope = entities.SettingScopeMember
+		setting.ScopeID = utils.GetUser(i.Interaction).ID
+	case layoutServerOption:
+		if i.GuildID == "" || i.Member == nil {
+			return handlers.ErrorEdit(s, i.Interaction, "Server layout settings can only be changed in a server.")
+		}
+		if i.Member.Permissions&discordgo.PermissionAdministrator == 0 {
+			return handlers.ErrorEdit(s, i.Interaction, "Only administrators can change the layout settings of this server.")
+		}
+		setting.Scope = entities.SettingScopeGuild
+		setting.ScopeID = i.GuildID
+	default:
+		return handlers.ErrorEdit(s, i.Interaction, fmt.Sprintf("Unknown subcommand: %s", subcommand.Name))
+	}
+
+	option, ok := optionMap[individualOption]
+	if !ok {
+		current, err := q.layoutSettingRepo.Get(context.Background(), setting.Scope, setting.ScopeID)
+		if err == nil {
+			setting = current
+		}
+		_, err = handlers.EditInteractionResponse(s, i.Interaction, layoutMessage(setting))
+		return err
+	}
+
+	setting.Individual = option.BoolValue()
+	if _, err := q.layoutSettingRepo.Upsert(context.Background(), setting); err != nil {
+		return handlers.ErrorEdit(s, i.Interaction, "Error saving layout settings.", err)
+	}
+
+	_, err := handlers.EditInteractionResponse(s, i.Interaction, layoutMessage(setting))
+	return err
+}
+
+func layoutMessage(setting *entities.LayoutSetting) string {
+	subject := "Your generations"
+	if setting.Scope == entities.SettingScopeGuild {
+		subject = "Generations in this server"
+	}
+	if setting.Individual {
+		return subject + " post each image as its own attachment, up to 10 per message. Larger batches are still tiled into a grid."
+	}
+	if setting.Scope == entities.SettingScopeGuild {
+		return subject + " tile more than four images into a grid, unless the member chose otherwise."
+	}
+	return subject + " tile more than four images into a grid."
+}
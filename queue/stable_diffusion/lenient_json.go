@@ -0,0 +1,156 @@
+package stable_diffusion
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// normalizeJSON turns the JSON5-ish blobs members paste from examples into strict JSON. It removes comments and
+// trailing commas, quotes bare keys, converts single quoted strings and unwraps a ```json code block. Newlines are
+// kept so the line of a syntax error is the line the member wrote.
+func normalizeJSON(data []byte) ([]byte, error) {
+	data = bytes.TrimSpace(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")))
+	if fenced, ok := bytes.CutPrefix(data, []byte("```")); ok {
+		if fenced, ok = bytes.CutSuffix(fenced, []byte("```")); ok {
+			// drop the language after the opening fence but keep its newline
+			data = fenced[max(bytes.IndexByte(fenced, '\n'), 0):]
+		}
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case c == '"' || c == '\'':
+			end, err := copyString(out, data, i)
+			if err != nil {
+				return nil, err
+			}
+			i = end
+		case c == '/' && i+1 < len(data) && (data[i+1] == '/' || data[i+1] == '*'):
+			end, err := skipComment(out, data, i)
+			if err != nil {
+				return nil, err
+			}
+			i = end - 1
+		case c == ',':
+			if next := skipSpace(data, i+1); next == len(data) || data[next] == '}' || data[next] == ']' {
+				continue
+			}
+			out.WriteByte(c)
+		case isIdentifierStart(c):
+			end := i + 1
+			for end < len(data) && isIdentifierPart(data[end]) {
+				end++
+			}
+			if next := skipSpace(data, end); next < len(data) && data[next] == ':' {
+				out.WriteByte('"')
+				out.Write(data[i:end])
+				out.WriteByte('"')
+			} else {
+				out.Write(data[i:end])
+			}
+			i = end - 1
+		default:
+			out.WriteByte(c)
+		}
+	}
+
+	normalized := out.Bytes()
+	var value any
+	if err := json.Unmarshal(normalized, &value); err != nil {
+		var syntax *json.SyntaxError
+		if errors.As(err, &syntax) {
+			return nil, fmt.Errorf("invalid JSON on line %d: %v", lineOf(normalized, syntax.Offset), err)
+		}
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	return normalized, nil
+}
+
+// copyString writes the string starting at data[start] as a double quoted string and returns the index of its
+// closing quote
+func copyString(out *bytes.Buffer, data []byte, start int) (int, error) {
+	quote := data[start]
+	out.WriteByte('"')
+	for i := start + 1; i < len(data); i++ {
+		switch c := data[i]; {
+		case c == quote:
+			out.WriteByte('"')
+			return i, nil
+		case c == '\\' && i+1 < len(data):
+			i++
+			if data[i] == '\'' {
+				out.WriteByte('\'')
+			} else {
+				out.WriteByte('\\')
+				out.WriteByte(data[i])
+			}
+		case c == '"':
+			out.WriteString(`\"`)
+		case c == '\n':
+			return 0, fmt.Errorf("invalid JSON on line %d: the string isn't closed before the end of the line", lineOf(data, int64(start)))
+		default:
+			out.WriteByte(c)
+		}
+	}
+	return 0, fmt.Errorf("invalid JSON on line %d: the string is never closed", lineOf(data, int64(start)))
+}
+
+// skipComment returns the index after the comment starting at data[start], writing the newlines it spans
+func skipComment(out *bytes.Buffer, data []byte, start int) (int, error) {
+	if data[start+1] == '/' {
+		end := bytes.IndexByte(data[start:], '\n')
+		if end < 0 {
+			return len(data), nil
+		}
+		return start + end, nil
+	}
+	end := bytes.Index(data[start+2:], []byte("*/"))
+	if end < 0 {
+		return 0, fmt.Errorf("invalid JSON on line %d: the comment is never closed", lineOf(data, int64(start)))
+	}
+	end += start + 2
+	out.Write(bytes.Repeat([]byte("\n"), bytes.Count(data[start:end], []byte("\n"))))
+	return end + 2, nil
+}
+
+// skipSpace returns the index of the next character after i that isn't whitespace or part of a comment
+func skipSpace(data []byte, i int) int {
+	for i < len(data) {
+		switch {
+		case data[i] == ' ' || data[i] == '\t' || data[i] == '\n' || data[i] == '\r':
+			i++
+		case bytes.HasPrefix(data[i:], []byte("//")):
+			end := bytes.IndexByte(data[i:], '\n')
+			if end < 0 {
+				return len(data)
+			}
+			i += end
+		case bytes.HasPrefix(data[i:], []byte("/*")):
+			end := bytes.Index(data[i+2:], []byte("*/"))
+			if end < 0 {
+				return len(data)
+			}
+			i += end + 4
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+func isIdentifierStart(c byte) bool {
+	return c == '_' || c == '$' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isIdentifierPart(c byte) bool {
+	return isIdentifierStart(c) || '0' <= c && c <= '9' || c == '-'
+}
+
+func lineOf(data []byte, offset int64) int {
+	offset = min(offset, int64(len(data)))
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
@@ -0,0 +1,140 @@
+package stable_diffusion
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"stable_diffusion_bot/api/stable_diffusion_api"
+	"stable_diffusion_bot/discord_bot/handlers"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/sahilm/fuzzy"
+)
+
+// loraTag matches <lora:name> and <lora:name:weight>
+var loraTag = regexp.MustCompile(`<lora:([^:>]+)(?::[^>]*)?>`)
+
+// lintPrompt returns the mistakes in a prompt that the backend silently accepts but that change the image:
+// unbalanced attention brackets, misplaced BREAK keywords and LoRAs that aren't installed
+func lintPrompt(prompt string) []string {
+	var warnings []string
+	warnings = append(warnings, lintBrackets(prompt)...)
+	warnings = append(warnings, lintBreak(prompt)...)
+	warnings = append(warnings, lintLoras(prompt)...)
+	return warnings
+}
+
+// lintBrackets reports ( and [ that are never closed and ) and ] that close nothing. Escaped brackets like \( are
+// literal and LoRA tags are skipped.
+func lintBrackets(prompt string) []string {
+	var warnings []string
+	var open []rune
+	closing := map[rune]rune{')': '(', ']': '['}
+
+	runes := []rune(loraTag.ReplaceAllString(prompt, ""))
+	for i := 0; i < len(runes); i++ {
+		switch c := runes[i]; c {
+		case '\\':
+			i++
+		case '(', '[':
+			open = append(open, c)
+		case ')', ']':
+			if len(open) == 0 || open[len(open)-1] != closing[c] {
+				warnings = append(warnings, fmt.Sprintf("`%c` closes nothing, remove it or escape it as `\\%c`.", c, c))
+				continue
+			}
+			open = open[:len(open)-1]
+		}
+	}
+
+	for _, c := range []rune{'(', '['} {
+		if n := strings.Count(string(open), string(c)); n > 0 {
+			warnings = append(warnings, fmt.Sprintf("%d `%c` never closed, everything after it is weighted.", n, c))
+		}
+	}
+	return warnings
+}
+
+// lintBreak reports BREAK at either end of the prompt or twice in a row, where it does nothing, and a break between
+// commas that isn't in capitals, which is read as the word
+func lintBreak(prompt string) []string {
+	var warnings []string
+	words := strings.FieldsFunc(prompt, func(r rune) bool { return r == ' ' || r == ',' || r == '\n' })
+	if len(words) == 0 {
+		return nil
+	}
+
+	if words[0] == "BREAK" || words[len(words)-1] == "BREAK" {
+		warnings = append(warnings, "`BREAK` at the start or end of the prompt does nothing.")
+	}
+	for i := 1; i < len(words); i++ {
+		if words[i] == "BREAK" && words[i-1] == "BREAK" {
+			warnings = append(warnings, "`BREAK BREAK` adds an empty chunk, use a single `BREAK`.")
+			break
+		}
+	}
+
+	for _, tag := range strings.Split(prompt, ",") {
+		if tag = strings.TrimSpace(tag); strings.EqualFold(tag, "BREAK") && tag != "BREAK" {
+			warnings = append(warnings, fmt.Sprintf("`%s` is read as the word, only `BREAK` in capitals starts a new chunk.", tag))
+			break
+		}
+	}
+	return warnings
+}
+
+// lintLoras reports LoRA tags naming a LoRA the backend doesn't have, once the LoRAs are cached
+func lintLoras(prompt string) []string {
+	if stable_diffusion_api.LoraCache == nil {
+		return nil
+	}
+	loras := *stable_diffusion_api.LoraCache
+
+	var names []string
+	installed := make(map[string]bool, len(loras)*2)
+	for _, lora := range loras {
+		installed[strings.ToLower(lora.Name)] = true
+		installed[strings.ToLower(lora.Alias)] = true
+		names = append(names, lora.Name)
+	}
+
+	var warnings []string
+	for _, match := range loraTag.FindAllStringSubmatch(prompt, -1) {
+		if installed[strings.ToLower(match[1])] {
+			continue
+		}
+		warning := fmt.Sprintf("The LoRA `%s` isn't installed and is ignored.", match[1])
+		if matches := fuzzy.Find(match[1], names); len(matches) > 0 {
+			warning = fmt.Sprintf("The LoRA `%s` isn't installed and is ignored, did you mean `%s`?", match[1], matches[0].Str)
+		}
+		warnings = append(warnings, warning)
+	}
+	return warnings
+}
+
+// sendPromptWarnings tells the member about the mistakes in the prompts of their finished generation in a message
+// only they can see
+func (q *SDQueue) sendPromptWarnings(item *SDQueueItem) {
+	request := item.ImageGenerationRequest
+	if request == nil || request.TextToImageRequest == nil || item.DiscordInteraction == nil {
+		return
+	}
+
+	warnings := lintPrompt(request.Prompt)
+	for _, warning := range lintPrompt(request.NegativePrompt) {
+		warnings = append(warnings, "Negative prompt: "+warning)
+	}
+	if len(warnings) == 0 {
+		return
+	}
+
+	_, err := handlers.EphemeralFollowup(q.botSession, item.DiscordInteraction,
+		"Your prompt may not have done what you expected:\n- "+strings.Join(warnings, "\n- "),
+		discordgo.MessageFlagsEphemeral,
+	)
+	if err != nil {
+		log.Printf("Error sending prompt warnings: %v", err)
+	}
+}
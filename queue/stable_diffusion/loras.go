@@ -0,0 +1,197 @@
+package stable_diffusion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"stable_diffusion_bot/discord_bot/handlers"
+	"stable_diffusion_bot/entities"
+	"stable_diffusion_bot/repositories"
+	"stable_diffusion_bot/utils"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/sahilm/fuzzy"
+)
+
+// myLorasFallback is how many of the most used LoRAs are applied when the member has not pinned any
+const myLorasFallback = 3
+
+// splitLora separates a "name:weight" lora value, defaulting to a weight of 1
+func splitLora(value string) (string, float64) {
+	idx := strings.LastIndex(value, ":")
+	if idx < 0 {
+		return value, 1
+	}
+
+	weight, err := strconv.ParseFloat(value[idx+1:], 64)
+	if err != nil {
+		return value, 1
+	}
+
+	return value[:idx], weight
+}
+
+// myLoras returns the member's pinned LoRAs, or their most used ones if none are pinned
+func (q *SDQueue) myLoras(memberID string) ([]*entities.MemberLora, error) {
+	pinned, err := q.memberLoraRepo.GetPinned(context.Background(), memberID)
+	if err != nil || len(pinned) > 0 {
+		return pinned, err
+	}
+
+	return q.memberLoraRepo.List(context.Background(), memberID, myLorasFallback)
+}
+
+// recordLoraUses updates the member's quick list with the LoRAs used in a generation
+func (q *SDQueue) recordLoraUses(memberID string, loras []string) {
+	for _, lora := range loras {
+		name, weight := splitLora(lora)
+		if err := q.memberLoraRepo.RecordUse(context.Background(), memberID, name, weight); err != nil {
+			log.Printf("Error recording lora use of %v: %v", name, err)
+		}
+	}
+}
+
+// quickListChoices suggests LoRAs from the member's quick list that match input
+func (q *SDQueue) quickListChoices(memberID string, input string) []*discordgo.ApplicationCommandOptionChoice {
+	loras, err := q.memberLoraRepo.List(context.Background(), memberID, 25)
+	if err != nil {
+		log.Printf("Error retrieving lora quick list: %v", err)
+		return nil
+	}
+
+	names := make([]string, len(loras))
+	for idx, lora := range loras {
+		names[idx] = lora.Name
+	}
+
+	matches := make([]int, 0, len(loras))
+	if input == "" {
+		for idx := range loras {
+			matches = append(matches, idx)
+		}
+	} else {
+		for _, match := range fuzzy.Find(input, names) {
+			matches = append(matches, match.Index)
+		}
+	}
+
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	for _, idx := range matches {
+		lora := loras[idx]
+		icon := "🕘"
+		if lora.Pinned {
+			icon = "⭐"
+		}
+		weight := strconv.FormatFloat(lora.Weight, 'f', -1, 64)
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+			Name:  fmt.Sprintf("%s%s 🪄%s", icon, lora.Name, weight),
+			Value: lora.Name + ":" + weight,
+		})
+	}
+
+	return choices
+}
+
+func (q *SDQueue) processLorasCommand(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	if err := handlers.EphemeralThink(s, i); err != nil {
+		return err
+	}
+
+	data := i.ApplicationCommandData()
+	if len(data.Options) == 0 {
+		return handlers.ErrorEdit(s, i.Interaction, "You need to choose a subcommand.")
+	}
+
+	subcommand := data.Options[0]
+	optionMap := make(map[string]*discordgo.ApplicationCommandInteractionDataOption, len(subcommand.Options))
+	for _, opt := range subcommand.Options {
+		optionMap[opt.Name] = opt
+	}
+
+	user := utils.GetUser(i.Interaction)
+
+	switch "loras_" + subcommand.Name {
+	case lorasPinOption:
+		name, weight := splitLora(sanitizeTooltip(optionMap[loraOption].StringValue()))
+		if option, ok := optionMap[loraWeightOption]; ok {
+			weight = option.FloatValue()
+		}
+		if err := q.memberLoraRepo.Pin(context.Background(), user.ID, name, weight); err != nil {
+			return handlers.ErrorEdit(s, i.Interaction, "Error pinning lora.", err)
+		}
+		_, err := handlers.EditInteractionResponse(s, i.Interaction,
+			fmt.Sprintf("Pinned `%s` with weight `%v`. Apply your pinned loras with `/%s %s:True`", name, weight, ImagineCommand, myLorasOption))
+		return err
+	case lorasUnpinOption:
+		name, _ := splitLora(optionMap[loraOption].StringValue())
+		err := q.memberLoraRepo.Unpin(context.Background(), user.ID, name)
+		var notFound *repositories.NotFoundError
+		if errors.As(err, &notFound) {
+			return handlers.ErrorEdit(s, i.Interaction, fmt.Sprintf("`%s` is not pinned.", name))
+		}
+		if err != nil {
+			return handlers.ErrorEdit(s, i.Interaction, "Error unpinning lora.", err)
+		}
+		_, err = handlers.EditInteractionResponse(s, i.Interaction, fmt.Sprintf("Unpinned `%s`.", name))
+		return err
+	case lorasListOption:
+		loras, err := q.memberLoraRepo.List(context.Background(), user.ID, 25)
+		if err != nil {
+			return handlers.ErrorEdit(s, i.Interaction, "Error retrieving loras.", err)
+		}
+		if len(loras) == 0 {
+			_, err = handlers.EditInteractionResponse(s, i.Interaction, "You haven't used or pinned any loras yet.")
+			return err
+		}
+		var out strings.Builder
+		for _, lora := range loras {
+			icon := "🕘"
+			if lora.Pinned {
+				icon = "⭐"
+			}
+			out.WriteString(fmt.Sprintf("%s `%s:%v` used %d times\n", icon, lora.Name, lora.Weight, lora.Uses))
+		}
+		_, err = handlers.EditInteractionResponse(s, i.Interaction, shortenTo(out.String(), 2000))
+		return err
+	default:
+		return handlers.ErrorEdit(s, i.Interaction, fmt.Sprintf("Unknown subcommand: %s", subcommand.Name))
+	}
+}
+
+func (q *SDQueue) processLorasAutocomplete(_ *discordgo.Session, i *discordgo.InteractionCreate) error {
+	data := i.ApplicationCommandData()
+	if len(data.Options) == 0 {
+		return nil
+	}
+
+	for _, opt := range data.Options[0].Options {
+		if !opt.Focused || opt.Name != loraOption {
+			continue
+		}
+
+		if "loras_"+data.Options[0].Name == lorasPinOption {
+			return q.autocompleteLora(i, opt)
+		}
+
+		choices := q.quickListChoices(utils.GetUser(i.Interaction).ID, opt.StringValue())
+		if len(choices) == 0 {
+			choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+				Name:  "You don't have any pinned loras",
+				Value: "placeholder",
+			})
+		}
+
+		return handlers.Wrap(q.botSession.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+			Data: &discordgo.InteractionResponseData{
+				Choices: choices[:min(25, len(choices))],
+			},
+		}))
+	}
+
+	return nil
+}
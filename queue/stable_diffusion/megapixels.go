@@ -0,0 +1,59 @@
+package stable_diffusion
+
+import (
+	"fmt"
+
+	"stable_diffusion_bot/discord_bot/handlers"
+	"stable_diffusion_bot/utils"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// fitMegapixels scales the size and hires fix of the item down to the max_megapixels budget, so a single request
+// can't run the GPU out of memory for everyone. The bot owner's requests are left as they are.
+func (q *SDQueue) fitMegapixels(item *SDQueueItem) {
+	budget := q.settings().maxMegapixels
+	if budget <= 0 || item.TextToImageRequest == nil || item.DiscordInteraction == nil || handlers.IsOwner(item.DiscordInteraction) {
+		return
+	}
+
+	request := item.TextToImageRequest
+	beforeWidth, beforeHeight := outputSize(item)
+
+	request.Width, request.Height = utils.FitMegapixels(request.Width, request.Height, budget, 8)
+	if request.EnableHr {
+		if request.HrResizeX > 0 && request.HrResizeY > 0 {
+			request.HrResizeX, request.HrResizeY = utils.FitMegapixels(request.HrResizeX, request.HrResizeY, budget, 8)
+			request.HrScale = float64(request.HrResizeX) / float64(request.Width)
+		} else {
+			request.HrScale = utils.FitHiresScale(request.Width, request.Height, request.HrScale, budget)
+		}
+	}
+
+	width, height := outputSize(item)
+	if width == beforeWidth && height == beforeHeight {
+		return
+	}
+	item.logs.Printf("Scaled %v down from %dx%d to %dx%d to fit %g megapixels", item.DiscordInteraction.ID, beforeWidth, beforeHeight, width, height, budget)
+	_, err := handlers.EphemeralFollowup(q.botSession, item.DiscordInteraction,
+		fmt.Sprintf("Your image was scaled down from `%d x %d` to `%d x %d`, the largest this bot makes is %g megapixels.",
+			beforeWidth, beforeHeight, width, height, budget),
+		discordgo.MessageFlagsEphemeral,
+	)
+	if err != nil {
+		item.logs.Printf("Error sending megapixel notice: %v", err)
+	}
+}
+
+// outputSize is the size of the images the request makes, after hires fix
+func outputSize(item *SDQueueItem) (int, int) {
+	request := item.TextToImageRequest
+	switch {
+	case !request.EnableHr:
+		return request.Width, request.Height
+	case request.HrResizeX > 0 && request.HrResizeY > 0:
+		return request.HrResizeX, request.HrResizeY
+	default:
+		return scaleDimension(request.Width, request.HrScale), scaleDimension(request.Height, request.HrScale)
+	}
+}
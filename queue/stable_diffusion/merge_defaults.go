@@ -0,0 +1,185 @@
+package stable_diffusion
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"stable_diffusion_bot/entities"
+	"stable_diffusion_bot/repositories"
+	"stable_diffusion_bot/utils"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Defaults are the generation settings of one layer, fields left nil are taken from the layers below it.
+// Layers resolve in order: built-in, bot defaults, guild, member, then the command options set on the request.
+type Defaults struct {
+	Width             *int
+	Height            *int
+	BatchCount        *int
+	BatchSize         *int
+	Steps             *int
+	CFGScale          *float64
+	SamplerName       *string
+	NegativePrompt    *string
+	HrUpscaler        *string
+	HrSecondPassSteps *int64
+	DenoisingStrength *float64
+	// NegativeEmbeddings are appended to the negative prompt when the item is generated, see appendNegativeEmbeddings
+	NegativeEmbeddings *string
+}
+
+// builtinDefaults are used for any setting no other layer sets
+func builtinDefaults() Defaults {
+	return Defaults{
+		Width:             ptr(initializedWidth),
+		Height:            ptr(initializedHeight),
+		BatchCount:        ptr(initializedBatchCount),
+		BatchSize:         ptr(initializedBatchSize),
+		Steps:             ptr(20),
+		CFGScale:          ptr(7.0),
+		SamplerName:       ptr("Euler a"),
+		NegativePrompt:    ptr(DefaultNegative),
+		HrUpscaler:        ptr("R-ESRGAN 2x+"),
+		HrSecondPassSteps: ptr(int64(20)),
+		DenoisingStrength: ptr(0.7),
+	}
+}
+
+// settingsDefaults is the layer of stored default settings, where zero means unset. Negative embeddings replace the
+// built-in negative prompt of the layers below, and "none" stops adding the embeddings of the layers below.
+func settingsDefaults(settings *entities.DefaultSettings) Defaults {
+	if settings == nil {
+		return Defaults{}
+	}
+	defaults := Defaults{
+		Width:      nonZero(settings.Width),
+		Height:     nonZero(settings.Height),
+		BatchCount: nonZero(settings.BatchCount),
+		BatchSize:  nonZero(settings.BatchSize),
+	}
+	switch settings.NegativeEmbeddings {
+	case "":
+	case noNegativeEmbeddings:
+		defaults.NegativeEmbeddings = ptr("")
+	default:
+		defaults.NegativeEmbeddings = ptr(settings.NegativeEmbeddings)
+		defaults.NegativePrompt = ptr("")
+	}
+	return defaults
+}
+
+// requestDefaults is the layer of the options already set on the request, where zero means unset
+func requestDefaults(request *entities.TextToImageRequest) Defaults {
+	return Defaults{
+		Width:             nonZero(request.Width),
+		Height:            nonZero(request.Height),
+		BatchCount:        nonZero(request.NIter),
+		BatchSize:         nonZero(request.BatchSize),
+		Steps:             nonZero(request.Steps),
+		CFGScale:          nonZero(request.CFGScale),
+		SamplerName:       nonZero(request.SamplerName),
+		NegativePrompt:    nonZero(request.NegativePrompt),
+		HrUpscaler:        nonZero(request.HrUpscaler),
+		HrSecondPassSteps: nonZero(request.HrSecondPassSteps),
+		DenoisingStrength: nonZero(request.DenoisingStrength),
+	}
+}
+
+// MergeDefaults resolves the layers from lowest to highest priority, each set field overriding the layers before it
+func MergeDefaults(layers ...Defaults) Defaults {
+	var merged Defaults
+	for _, layer := range layers {
+		override(&merged.Width, layer.Width)
+		override(&merged.Height, layer.Height)
+		override(&merged.BatchCount, layer.BatchCount)
+		override(&merged.BatchSize, layer.BatchSize)
+		override(&merged.Steps, layer.Steps)
+		override(&merged.CFGScale, layer.CFGScale)
+		override(&merged.SamplerName, layer.SamplerName)
+		override(&merged.NegativePrompt, layer.NegativePrompt)
+		override(&merged.HrUpscaler, layer.HrUpscaler)
+		override(&merged.HrSecondPassSteps, layer.HrSecondPassSteps)
+		override(&merged.DenoisingStrength, layer.DenoisingStrength)
+		override(&merged.NegativeEmbeddings, layer.NegativeEmbeddings)
+	}
+	return merged
+}
+
+// Apply sets the fields of the request to the resolved defaults, leaving those the defaults don't set
+func (d Defaults) Apply(request *entities.TextToImageRequest) {
+	assign(&request.Width, d.Width)
+	assign(&request.Height, d.Height)
+	assign(&request.NIter, d.BatchCount)
+	assign(&request.BatchSize, d.BatchSize)
+	assign(&request.Steps, d.Steps)
+	assign(&request.CFGScale, d.CFGScale)
+	assign(&request.SamplerName, d.SamplerName)
+	assign(&request.NegativePrompt, d.NegativePrompt)
+	assign(&request.HrUpscaler, d.HrUpscaler)
+	assign(&request.HrSecondPassSteps, d.HrSecondPassSteps)
+	assign(&request.DenoisingStrength, d.DenoisingStrength)
+}
+
+// defaultLayers returns the built-in, bot, guild and member layers for the interaction. Guilds and members have
+// defaults when the default settings table has a row keyed by their ID.
+func (q *SDQueue) defaultLayers(interaction *discordgo.Interaction) []Defaults {
+	layers := []Defaults{builtinDefaults()}
+
+	botDefaults, err := q.GetBotDefaultSettings()
+	if err != nil {
+		log.Printf("Error getting bot default settings: %v", err)
+	}
+	layers = append(layers, settingsDefaults(botDefaults))
+
+	if interaction == nil {
+		return layers
+	}
+	var ids []string
+	if interaction.GuildID != "" {
+		ids = append(ids, interaction.GuildID)
+	}
+	if user := utils.GetUser(interaction); user != nil {
+		ids = append(ids, user.ID)
+	}
+	for _, id := range ids {
+		settings, err := q.defaultSettingsRepo.GetByMemberID(context.Background(), id)
+		if err != nil {
+			var notFound *repositories.NotFoundError
+			if !errors.As(err, &notFound) {
+				log.Printf("Error getting default settings of %s: %v", id, err)
+			}
+			continue
+		}
+		layers = append(layers, settingsDefaults(settings))
+	}
+	return layers
+}
+
+// resolveDefaults merges the layers below the command options of the interaction
+func (q *SDQueue) resolveDefaults(interaction *discordgo.Interaction) Defaults {
+	return MergeDefaults(q.defaultLayers(interaction)...)
+}
+
+func ptr[T any](v T) *T { return &v }
+
+func nonZero[T comparable](v T) *T {
+	var zero T
+	if v == zero {
+		return nil
+	}
+	return &v
+}
+
+func override[T any](dst **T, src *T) {
+	if src != nil {
+		*dst = src
+	}
+}
+
+func assign[T any](dst *T, src *T) {
+	if src != nil {
+		*dst = *src
+	}
+}
@@ -0,0 +1,72 @@
+package stable_diffusion
+
+import (
+	"testing"
+
+	"stable_diffusion_bot/entities"
+)
+
+func TestMergeDefaultsOrder(t *testing.T) {
+	bot := settingsDefaults(&entities.DefaultSettings{MemberID: botID, Width: 768, Height: 768, BatchCount: 1, BatchSize: 4})
+	guild := settingsDefaults(&entities.DefaultSettings{Width: 1024})
+	member := settingsDefaults(&entities.DefaultSettings{Height: 1216, BatchSize: 2})
+	options := requestDefaults(&entities.TextToImageRequest{Steps: 30, SamplerName: "DPM++ 2M", Height: 832})
+
+	merged := MergeDefaults(builtinDefaults(), bot, guild, member, options)
+
+	if *merged.Width != 1024 {
+		t.Errorf("width = %d, want the guild's 1024", *merged.Width)
+	}
+	if *merged.Height != 832 {
+		t.Errorf("height = %d, want the command option's 832", *merged.Height)
+	}
+	if *merged.BatchSize != 2 {
+		t.Errorf("batch size = %d, want the member's 2", *merged.BatchSize)
+	}
+	if *merged.BatchCount != 1 {
+		t.Errorf("batch count = %d, want the bot's 1", *merged.BatchCount)
+	}
+	if *merged.Steps != 30 || *merged.SamplerName != "DPM++ 2M" {
+		t.Errorf("steps and sampler = %d %q, want the command options' 30 \"DPM++ 2M\"", *merged.Steps, *merged.SamplerName)
+	}
+	if *merged.CFGScale != 7 || *merged.NegativePrompt != DefaultNegative {
+		t.Errorf("cfg scale and negative prompt = %g %q, want the built-in defaults", *merged.CFGScale, *merged.NegativePrompt)
+	}
+}
+
+func TestMergeDefaultsEmpty(t *testing.T) {
+	merged := MergeDefaults()
+	if merged != (Defaults{}) {
+		t.Errorf("merging no layers = %+v, want no fields set", merged)
+	}
+
+	merged = MergeDefaults(Defaults{Width: ptr(640)}, Defaults{}, settingsDefaults(nil))
+	if merged.Width == nil || *merged.Width != 640 {
+		t.Errorf("width = %v, empty layers shouldn't unset it", merged.Width)
+	}
+}
+
+func TestDefaultsApply(t *testing.T) {
+	request := &entities.TextToImageRequest{Prompt: "a cat", Width: 320, Seed: -1}
+	Defaults{Height: ptr(448), Steps: ptr(12), HrSecondPassSteps: ptr(int64(5))}.Apply(request)
+
+	if request.Width != 320 {
+		t.Errorf("width = %d, fields the defaults don't set should be kept", request.Width)
+	}
+	if request.Height != 448 || request.Steps != 12 || request.HrSecondPassSteps != 5 {
+		t.Errorf("height, steps and hires steps = %d %d %d, want 448 12 5", request.Height, request.Steps, request.HrSecondPassSteps)
+	}
+	if request.Prompt != "a cat" || request.Seed != -1 {
+		t.Errorf("prompt and seed = %q %d, settings without a layer should be kept", request.Prompt, request.Seed)
+	}
+}
+
+func TestRequestDefaultsIgnoresZero(t *testing.T) {
+	layer := requestDefaults(&entities.TextToImageRequest{CFGScale: 4.5})
+	if layer.CFGScale == nil || *layer.CFGScale != 4.5 {
+		t.Errorf("cfg scale = %v, want 4.5", layer.CFGScale)
+	}
+	if layer.Width != nil || layer.SamplerName != nil || layer.NegativePrompt != nil {
+		t.Errorf("zero fields should be unset, got %+v", layer)
+	}
+}
@@ -0,0 +1,83 @@
+package stable_diffusion
+
+import (
+	"math"
+
+	"stable_diffusion_bot/api/stable_diffusion_api"
+)
+
+// familySize is the size a family of checkpoints was trained at, and the hires fix scale that suits it
+type familySize struct {
+	side       int
+	hiresScale float64
+}
+
+var familySizes = map[stable_diffusion_api.ModelFamily]familySize{
+	stable_diffusion_api.FamilySD15: {side: 512, hiresScale: 2},
+	stable_diffusion_api.FamilySD2:  {side: 768, hiresScale: 1.5},
+	stable_diffusion_api.FamilySDXL: {side: 1024, hiresScale: 1.5},
+	stable_diffusion_api.FamilyFlux: {side: 1024, hiresScale: 1.5},
+}
+
+// Sizes within these multiples of the native area of the family are left as they are, so defaults like 768x768 for
+// SD1.5 and 1820x1024 for SDXL keep working
+const (
+	minNativeArea = 0.5
+	maxNativeArea = 2.5
+)
+
+// checkpointFamily returns the family of the checkpoint named name, first from model_families, then from the
+// checkpoint cache and its name
+func (q *SDQueue) checkpointFamily(name string) stable_diffusion_api.ModelFamily {
+	model := stable_diffusion_api.SDModel{Title: name}
+	if stable_diffusion_api.CheckpointCache != nil {
+		if cached, ok := stable_diffusion_api.CheckpointCache.Lookup(name); ok {
+			model = cached
+		}
+	}
+
+	families := q.settings().modelFamilies
+	for _, name := range []string{name, model.Title, model.ModelName} {
+		if family, ok := families[name]; ok {
+			return family
+		}
+	}
+	return model.Family()
+}
+
+// fitModelFamily scales sizes far from the native size of the family of the checkpoint to it, keeping the aspect
+// ratio, since SDXL makes bad images at the 512x512 SD1.5 defaults and SD1.5 repeats itself at 1024x1024. Hires fix
+// that was asked for without a scale gets the scale of the family.
+func (q *SDQueue) fitModelFamily(item *SDQueueItem) {
+	request := item.ImageGenerationRequest
+	textToImage := request.TextToImageRequest
+	if request.Checkpoint == nil {
+		return
+	}
+
+	family := q.checkpointFamily(*request.Checkpoint)
+	size, ok := familySizes[family]
+	if !ok {
+		return
+	}
+
+	if textToImage.Width > 0 && textToImage.Height > 0 {
+		native := float64(size.side * size.side)
+		area := float64(textToImage.Width * textToImage.Height)
+		if ratio := area / native; ratio < minNativeArea || ratio > maxNativeArea {
+			scale := math.Sqrt(native / area)
+			width, height := roundToStep(float64(textToImage.Width)*scale, 64), roundToStep(float64(textToImage.Height)*scale, 64)
+			item.logs.Printf("Resized %dx%d to %dx%d for %s checkpoint %q", textToImage.Width, textToImage.Height, width, height, family, *request.Checkpoint)
+			textToImage.Width, textToImage.Height = width, height
+		}
+	}
+
+	if textToImage.EnableHr && textToImage.HrScale <= 1 {
+		textToImage.HrScale = size.hiresScale
+	}
+}
+
+// roundToStep rounds value to the nearest multiple of step, no smaller than step
+func roundToStep(value float64, step int) int {
+	return max(step, int(math.Round(value/float64(step)))*step)
+}
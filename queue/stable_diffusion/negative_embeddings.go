@@ -0,0 +1,182 @@
+package stable_diffusion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"stable_diffusion_bot/api/stable_diffusion_api"
+	"stable_diffusion_bot/discord_bot/handlers"
+	"stable_diffusion_bot/entities"
+	"stable_diffusion_bot/repositories"
+	"stable_diffusion_bot/utils"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/sahilm/fuzzy"
+)
+
+const (
+	// noNegativeEmbeddings is stored for members who don't want the embeddings of their server
+	noNegativeEmbeddings = "none"
+	// clearNegativeEmbeddings removes the stored embeddings so the ones of the server are used again
+	clearNegativeEmbeddings = "clear"
+)
+
+// appendNegativeEmbeddings adds the resolved negative embeddings that are installed to the negative prompt, skipping
+// those it already has
+func (q *SDQueue) appendNegativeEmbeddings(item *SDQueueItem) {
+	resolved := q.resolveDefaults(item.DiscordInteraction)
+	if resolved.NegativeEmbeddings == nil || *resolved.NegativeEmbeddings == "" {
+		return
+	}
+
+	request := item.TextToImageRequest
+	for _, name := range splitEmbeddings(*resolved.NegativeEmbeddings) {
+		embedding, ok := installedEmbedding(name)
+		if !ok {
+			item.logs.Printf("Negative embedding %q isn't installed, skipping", name)
+			continue
+		}
+		if strings.Contains(strings.ToLower(request.NegativePrompt), strings.ToLower(embedding)) {
+			continue
+		}
+		if strings.TrimSpace(request.NegativePrompt) == "" {
+			request.NegativePrompt = embedding
+		} else {
+			request.NegativePrompt += ", " + embedding
+		}
+	}
+}
+
+// installedEmbedding returns the name the backend uses for the embedding, ignoring case
+func installedEmbedding(name string) (string, bool) {
+	if stable_diffusion_api.EmbeddingCache == nil {
+		return "", false
+	}
+	for _, embedding := range *stable_diffusion_api.EmbeddingCache {
+		if strings.EqualFold(embedding.Name, name) {
+			return embedding.Name, true
+		}
+	}
+	return "", false
+}
+
+func splitEmbeddings(embeddings string) []string {
+	var names []string
+	for _, name := range strings.Split(embeddings, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// parseEmbeddings returns the installed names of the embeddings, or why they can't be used
+func (q *SDQueue) parseEmbeddings(input string) (string, error) {
+	cache, err := stable_diffusion_api.EmbeddingCache.GetCache(q.stableDiffusionAPI)
+	if err != nil {
+		return "", fmt.Errorf("error retrieving embeddings: %w", err)
+	}
+	embeddings := *cache.(*stable_diffusion_api.EmbeddingModels)
+
+	var names, unknown []string
+	for _, name := range splitEmbeddings(input) {
+		if embedding, ok := installedEmbedding(name); ok {
+			names = append(names, embedding)
+			continue
+		}
+		problem := fmt.Sprintf("`%s`", name)
+		if matches := fuzzy.FindFrom(name, embeddings); len(matches) > 0 {
+			problem += fmt.Sprintf(", did you mean `%s`?", matches[0].Str)
+		}
+		unknown = append(unknown, problem)
+	}
+	if len(unknown) > 0 {
+		return "", fmt.Errorf("these embeddings aren't installed: %s", strings.Join(unknown, "; "))
+	}
+	if len(names) == 0 {
+		return "", errors.New("list the embeddings separated by commas")
+	}
+	return strings.Join(names, ", "), nil
+}
+
+func (q *SDQueue) processNegativeEmbeddingsCommand(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	if err := handlers.EphemeralThink(s, i); err != nil {
+		return err
+	}
+
+	data := i.ApplicationCommandData()
+	if len(data.Options) == 0 {
+		return handlers.ErrorEdit(s, i.Interaction, "You need to choose a subcommand.")
+	}
+
+	subcommand := data.Options[0]
+	optionMap := make(map[string]*discordgo.ApplicationCommandInteractionDataOption, len(subcommand.Options))
+	for _, opt := range subcommand.Options {
+		optionMap[opt.Name] = opt
+	}
+
+	var id, subject string
+	switch "negative_embeddings_" + subcommand.Name {
+	case negativeEmbeddingsMeOption:
+		id, subject = utils.GetUser(i.Interaction).ID, "your generations"
+	case negativeEmbeddingsServerOption:
+		if i.GuildID == "" || i.Member == nil {
+			return handlers.ErrorEdit(s, i.Interaction, "Server negative embeddings can only be changed in a server.")
+		}
+		if i.Member.Permissions&discordgo.PermissionAdministrator == 0 {
+			return handlers.ErrorEdit(s, i.Interaction, "Only administrators can change the negative embeddings of this server.")
+		}
+		id, subject = i.GuildID, "generations in this server"
+	default:
+		return handlers.ErrorEdit(s, i.Interaction, fmt.Sprintf("Unknown subcommand: %s", subcommand.Name))
+	}
+
+	settings, err := q.defaultSettingsRepo.GetByMemberID(context.Background(), id)
+	if err != nil {
+		var notFound *repositories.NotFoundError
+		if !errors.As(err, &notFound) {
+			return handlers.ErrorEdit(s, i.Interaction, "Error getting negative embeddings.", err)
+		}
+		settings = &entities.DefaultSettings{MemberID: id}
+	}
+
+	option, ok := optionMap[negativeEmbeddingsOption]
+	if !ok {
+		_, err := handlers.EditInteractionResponse(s, i.Interaction, negativeEmbeddingsMessage(subject, settings.NegativeEmbeddings))
+		return err
+	}
+
+	switch value := strings.TrimSpace(option.StringValue()); strings.ToLower(value) {
+	case clearNegativeEmbeddings:
+		settings.NegativeEmbeddings = ""
+	case noNegativeEmbeddings:
+		settings.NegativeEmbeddings = noNegativeEmbeddings
+	default:
+		names, err := q.parseEmbeddings(value)
+		if err != nil {
+			return handlers.ErrorEdit(s, i.Interaction, err)
+		}
+		settings.NegativeEmbeddings = names
+	}
+
+	if _, err := q.defaultSettingsRepo.Upsert(context.Background(), settings); err != nil {
+		return handlers.ErrorEdit(s, i.Interaction, "Error saving negative embeddings.", err)
+	}
+
+	_, err = handlers.EditInteractionResponse(s, i.Interaction, negativeEmbeddingsMessage(subject, settings.NegativeEmbeddings))
+	return err
+}
+
+func negativeEmbeddingsMessage(subject, embeddings string) string {
+	switch embeddings {
+	case "":
+		return fmt.Sprintf("No negative embeddings are chosen for %s, the ones chosen for the server or bot are used.", subject)
+	case noNegativeEmbeddings:
+		return fmt.Sprintf("No negative embeddings are added to %s.", subject)
+	default:
+		return fmt.Sprintf("`%s` are added to the negative prompt of %s, in place of the default negative prompt.",
+			strings.ReplaceAll(embeddings, ", ", "`, `"), subject)
+	}
+}
@@ -0,0 +1,106 @@
+package stable_diffusion
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"stable_diffusion_bot/api/stable_diffusion_api"
+	"stable_diffusion_bot/composite_renderer"
+)
+
+// options are the settings of the queue that can change while it's running, see Reconfigure
+type options struct {
+	compositor        composite_renderer.Renderer
+	restoreWindow     time.Duration
+	gridLabels        GridLabelMode
+	gridLabelStyle    composite_renderer.LabelOptions
+	upscaleComparison composite_renderer.CompareMode
+	stealthPNGInfo    bool
+	previewSize       int
+	archiveGrids      bool
+	dryRun            bool
+	timingFooter      bool
+	maxMegapixels     float64
+	modelFamilies     map[string]stable_diffusion_api.ModelFamily
+}
+
+// newOptions validates the runtime settings of cfg and builds the compositor
+func newOptions(cfg Config) (*options, error) {
+	if cfg.RestoreWindow <= 0 {
+		cfg.RestoreWindow = DefaultRestoreWindow
+	}
+
+	if format := cfg.Encoding.Format; format != "" {
+		if _, ok := composite_renderer.LookupFormat(format); !ok {
+			log.Printf("No encoder registered for image format %q, large images will fall back to jpeg", format)
+		}
+	}
+
+	switch cfg.UpscaleComparison {
+	case "":
+		cfg.UpscaleComparison = composite_renderer.CompareSideBySide
+	case composite_renderer.CompareNone, composite_renderer.CompareSideBySide, composite_renderer.CompareDiagonal:
+	default:
+		return nil, fmt.Errorf("unknown upscale comparison mode %q", cfg.UpscaleComparison)
+	}
+
+	switch cfg.GridLabels {
+	case GridLabelNone, GridLabelIndex, GridLabelSeed, GridLabelModel:
+	default:
+		return nil, fmt.Errorf("unknown grid label mode %q", cfg.GridLabels)
+	}
+
+	modelFamilies := make(map[string]stable_diffusion_api.ModelFamily, len(cfg.ModelFamilies))
+	for checkpoint, name := range cfg.ModelFamilies {
+		family, err := stable_diffusion_api.ParseModelFamily(name)
+		if err != nil {
+			return nil, fmt.Errorf("checkpoint %q: %w", checkpoint, err)
+		}
+		modelFamilies[checkpoint] = family
+	}
+
+	compositor, err := composite_renderer.NewRenderer(composite_renderer.CompositorConfig{
+		Encoding:      cfg.Encoding,
+		Collage:       cfg.Collage,
+		Backend:       cfg.Renderer,
+		BackendBinary: cfg.RendererBinary,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &options{
+		compositor:        compositor,
+		restoreWindow:     cfg.RestoreWindow,
+		gridLabels:        cfg.GridLabels,
+		gridLabelStyle:    cfg.GridLabelStyle,
+		upscaleComparison: cfg.UpscaleComparison,
+		stealthPNGInfo:    cfg.StealthPNGInfo,
+		previewSize:       cfg.PreviewSize,
+		archiveGrids:      cfg.ArchiveGrids,
+		dryRun:            cfg.DryRun,
+		timingFooter:      cfg.TimingFooter,
+		maxMegapixels:     cfg.MaxMegapixels,
+		modelFamilies:     modelFamilies,
+	}, nil
+}
+
+// settings returns the current runtime settings. Callers should keep the result for the whole operation so a
+// reload in between doesn't mix old and new settings.
+func (q *SDQueue) settings() *options {
+	return q.options.Load()
+}
+
+// Reconfigure applies the grid, encoding, label, upscale comparison, preview, archive, stealth, dry run, timing
+// footer, megapixel, model family and restore window settings of cfg while the queue keeps running. Repositories and
+// the API in cfg are ignored.
+// Generations already being posted finish with the previous settings.
+func (q *SDQueue) Reconfigure(cfg Config) error {
+	opts, err := newOptions(cfg)
+	if err != nil {
+		return err
+	}
+	q.options.Store(opts)
+	return nil
+}
@@ -0,0 +1,118 @@
+package stable_diffusion
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+
+	"stable_diffusion_bot/composite_renderer"
+	"stable_diffusion_bot/discord_bot/handlers"
+	"stable_diffusion_bot/entities"
+	"stable_diffusion_bot/utils"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// shouldStripMetadata reports whether the guild or the member opted out of sharing generation parameters
+func (q *SDQueue) shouldStripMetadata(guildID, memberID string) bool {
+	strip, err := q.privacySettingRepo.ShouldStripMetadata(context.Background(), guildID, memberID)
+	if err != nil {
+		// err on the side of privacy
+		log.Printf("Error getting privacy settings for guild %s, member %s: %v", guildID, memberID, err)
+		return true
+	}
+	return strip
+}
+
+// stripMetadata removes text chunks, EXIF and comments from each image. Images that fail to parse are kept as is
+func stripMetadata(images []io.Reader) []io.Reader {
+	for i, img := range images {
+		if img == nil {
+			continue
+		}
+
+		data, err := io.ReadAll(img)
+		if err != nil {
+			log.Printf("Error reading image %d to strip metadata: %v", i, err)
+		}
+
+		stripped, err := composite_renderer.StripMetadata(data)
+		if err != nil {
+			log.Printf("Error stripping metadata from image %d: %v", i, err)
+			images[i] = bytes.NewReader(data)
+			continue
+		}
+		images[i] = bytes.NewReader(stripped)
+	}
+
+	return images
+}
+
+func (q *SDQueue) processPrivacyCommand(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	if err := handlers.EphemeralThink(s, i); err != nil {
+		return err
+	}
+
+	data := i.ApplicationCommandData()
+	if len(data.Options) == 0 {
+		return handlers.ErrorEdit(s, i.Interaction, "You need to choose a subcommand.")
+	}
+
+	subcommand := data.Options[0]
+	optionMap := make(map[string]*discordgo.ApplicationCommandInteractionDataOption, len(subcommand.Options))
+	for _, opt := range subcommand.Options {
+		optionMap[opt.Name] = opt
+	}
+
+	setting := &entities.PrivacySetting{}
+	switch "privacy_" + subcommand.Name {
+	case privacyMeOption:
+		setting.Scope = entities.SettingScopeMember
+		setting.ScopeID = utils.GetUser(i.Interaction).ID
+	case privacyServerOption:
+		if i.GuildID == "" || i.Member == nil {
+			return handlers.ErrorEdit(s, i.Interaction, "Server privacy settings can only be changed in a server.")
+		}
+		if i.Member.Permissions&discordgo.PermissionAdministrator == 0 {
+			return handlers.ErrorEdit(s, i.Interaction, "Only administrators can change the privacy settings of this server.")
+		}
+		setting.Scope = entities.SettingScopeGuild
+		setting.ScopeID = i.GuildID
+	default:
+		return handlers.ErrorEdit(s, i.Interaction, fmt.Sprintf("Unknown subcommand: %s", subcommand.Name))
+	}
+
+	option, ok := optionMap[stripMetadataOption]
+	if !ok {
+		current, err := q.privacySettingRepo.Get(context.Background(), setting.Scope, setting.ScopeID)
+		if err == nil {
+			setting = current
+		}
+		_, err = handlers.EditInteractionResponse(s, i.Interaction, privacyMessage(setting))
+		return err
+	}
+
+	setting.StripMetadata = option.BoolValue()
+	if _, err := q.privacySettingRepo.Upsert(context.Background(), setting); err != nil {
+		return handlers.ErrorEdit(s, i.Interaction, "Error saving privacy settings.", err)
+	}
+
+	_, err := handlers.EditInteractionResponse(s, i.Interaction, privacyMessage(setting))
+	return err
+}
+
+func privacyMessage(setting *entities.PrivacySetting) string {
+	subject := "Your images"
+	if setting.Scope == entities.SettingScopeGuild {
+		subject = "Images generated in this server"
+	}
+	if setting.StripMetadata {
+		return subject + " are uploaded without generation parameters or other metadata."
+	}
+	if setting.Scope == entities.SettingScopeGuild {
+		return subject + " include their generation parameters, unless the member opted out."
+	}
+	return subject + " include their generation parameters, unless the server opted out."
+}
@@ -7,67 +7,127 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"runtime/debug"
 	"strconv"
 	"strings"
+	"time"
 
 	"stable_diffusion_bot/api/stable_diffusion_api"
 	"stable_diffusion_bot/discord_bot/handlers"
 	"stable_diffusion_bot/entities"
 	p "stable_diffusion_bot/gui/progress"
+	"stable_diffusion_bot/logging"
+	"stable_diffusion_bot/reporting"
 	"stable_diffusion_bot/utils"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/sahilm/fuzzy"
 )
 
-func (q *SDQueue) next() error {
-	if len(q.queue) == 0 {
-		return nil
-	}
-	if q.currentImagine != nil {
-		log.Printf("WARNING: we're trying to pull the next item in the queue, but currentImagine is not yet nil")
-		return errors.New("currentImagine is not nil")
-	}
-	q.currentImagine = <-q.queue
-	defer q.done()
+// next generates the item on the backend it was dispatched to, see dispatch
+func (q *SDQueue) next(item *SDQueueItem) error {
+	defer q.done(item.backend)
+
+	// a panic fails the item instead of stopping the queue, it runs before done frees the backend
+	var capture *logging.Capture
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			q.failPanicked(item, recovered, capture)
+		}
+	}()
 
-	if q.currentImagine.DiscordInteraction == nil {
+	if item.DiscordInteraction == nil {
 		// If the interaction is nil, we can't respond. Make sure to set the implementation before adding to the queue.
 		// Example: queue.DiscordInteraction = i.Interaction
-		log.Panicf("DiscordInteraction is nil! Make sure to set it before adding to the queue. Example: queue.DiscordInteraction = i.Interaction\n%v", q.currentImagine)
+		log.Panicf("DiscordInteraction is nil! Make sure to set it before adding to the queue. Example: queue.DiscordInteraction = i.Interaction\n%v", item)
 	}
 
 	q.mu.Lock()
-	if q.cancelledItems[q.currentImagine.DiscordInteraction.ID] {
-		delete(q.cancelledItems, q.currentImagine.DiscordInteraction.ID)
+	delete(q.pending, item.DiscordInteraction.ID)
+	if q.cancelledItems[item.DiscordInteraction.ID] {
+		delete(q.cancelledItems, item.DiscordInteraction.ID)
 		q.mu.Unlock()
 		return nil
 	}
 	q.mu.Unlock()
+	if !item.queued.IsZero() {
+		q.waits.Record(time.Since(item.queued))
+	}
 
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	item.ctx, item.cancel = ctx, cancel
+
+	capture = logging.StartCapture()
+	item.logs = capture
 	var err error
-	switch q.currentImagine.Type {
+	switch item.Type {
 	case ItemTypeImagine, ItemTypeRaw:
-		err = q.processCurrentImagine()
+		err = q.processCurrentImagine(item)
 	case ItemTypeReroll, ItemTypeVariation:
-		err = q.processVariation()
+		err = q.processVariation(item)
 	case ItemTypeImg2Img:
-		err = q.processImg2ImgImagine()
+		err = q.processImg2ImgImagine(item)
 	case ItemTypeUpscale:
-		err = q.processUpscaleImagine()
+		err = q.processUpscaleImagine(item)
 	default:
-		return handlers.ErrorEdit(q.botSession, q.currentImagine.DiscordInteraction, fmt.Errorf("unknown item type: %v", q.currentImagine.Type))
+		capture.Stop()
+		return handlers.ErrorEdit(q.botSession, item.DiscordInteraction, fmt.Errorf("unknown item type: %v", item.Type))
 	}
+	logs := capture.Stop()
 
+	if errors.Is(err, context.Canceled) {
+		// the progress message already says the generation was interrupted
+		item.logs.Printf("Generation #%s was interrupted", item.DiscordInteraction.ID)
+		return nil
+	}
 	if err != nil {
-		return handlers.ErrorEdit(q.botSession, q.currentImagine.DiscordInteraction, fmt.Errorf("error processing current item: %w", err))
+		if strings.Contains(err.Error(), handlers.DeadAPI) {
+			// stop dispatching to the backend right away instead of failing each item until the next check
+			q.checkBackend()
+			if q.retry(item) {
+				item.logs.Printf("Backend of generation #%s died, retrying it on another backend: %v", item.DiscordInteraction.ID, err)
+				_, _ = handlers.EditInteractionResponse(q.botSession, item.DiscordInteraction,
+					"The backend stopped responding, retrying the generation on another one...")
+				return nil
+			}
+		}
+		q.recordFailure(item, err, logs)
+		return handlers.ErrorEdit(q.botSession, item.DiscordInteraction, fmt.Errorf("error processing current item: %w", err))
 	}
 
 	return nil
 }
 
-func (q *SDQueue) processCurrentImagine() error {
-	queue := q.currentImagine
+// panicked is the error recorded for an item whose processing panicked
+type panicked struct {
+	value any
+}
+
+func (p panicked) Error() string {
+	return fmt.Sprintf("panic: %v", p.value)
+}
+
+// failPanicked records the item as failed and tells the member, so the queue moves on to the next item
+func (q *SDQueue) failPanicked(item *SDQueueItem, recovered any, capture *logging.Capture) {
+	item.logs.Printf("Recovered from panic while processing item: %v\n%s", recovered, debug.Stack())
+
+	var logs string
+	if capture != nil {
+		logs = capture.Stop()
+	}
+
+	if item.DiscordInteraction == nil {
+		reporting.Panic(recovered, map[string]string{"queue": "stable_diffusion", "type": itemTypeNames[item.Type]}, nil)
+		return
+	}
+
+	err := panicked{value: recovered}
+	q.recordFailure(item, err, logs)
+	_ = handlers.ErrorEdit(q.botSession, item.DiscordInteraction, fmt.Errorf("error processing current item: %w", err))
+}
+
+func (q *SDQueue) processCurrentImagine(queue *SDQueueItem) error {
 
 	request, err := queue.ImageGenerationRequest, error(nil)
 	if request == nil {
@@ -79,6 +139,8 @@ func (q *SDQueue) processCurrentImagine() error {
 		return fmt.Errorf("TextToImageRequest of type %v is nil", queue.Type)
 	}
 
+	fillBlankModels(q, queue)
+
 	// only set width and height if it is not a raw json request
 	if queue.Type != ItemTypeRaw || (queue.Type == ItemTypeRaw && queue.Raw != nil && queue.Raw.Unsafe) {
 		err = calculateDimensions(q, queue)
@@ -87,7 +149,11 @@ func (q *SDQueue) processCurrentImagine() error {
 		}
 	}
 
-	fillBlankModels(q, request)
+	q.fitMegapixels(queue)
+
+	if queue.Type != ItemTypeRaw {
+		q.appendNegativeEmbeddings(queue)
+	}
 
 	initializeScripts(queue)
 
@@ -99,9 +165,65 @@ func (q *SDQueue) processCurrentImagine() error {
 	return nil
 }
 
-func (q *SDQueue) done() {
+// recordFailure persists the failed request, the error body and what was logged while processing it so recurring
+// backend errors can be looked up with /errors
+func (q *SDQueue) recordFailure(queue *SDQueueItem, err error, logs string) {
+	var request []byte
+	var marshalErr error
+	switch {
+	case queue.Raw != nil:
+		request, marshalErr = json.Marshal(queue.Raw)
+	case queue.ImageGenerationRequest != nil:
+		request, marshalErr = json.Marshal(queue.ImageGenerationRequest)
+	}
+	if marshalErr != nil {
+		queue.logs.Printf("Error marshalling failed request: %v", marshalErr)
+	}
+
+	var memberID string
+	if user := utils.GetUser(queue.DiscordInteraction); user != nil {
+		memberID = user.ID
+	}
+
+	failure := &entities.FailedGeneration{
+		InteractionID: queue.DiscordInteraction.ID,
+		GuildID:       queue.DiscordInteraction.GuildID,
+		MemberID:      memberID,
+		Backend:       q.api(queue).Host(),
+		Request:       string(request),
+		Error:         handlers.Scrub(err.Error()),
+		Log:           handlers.Scrub(logs),
+	}
+
+	tags := map[string]string{
+		"queue":   "stable_diffusion",
+		"type":    itemTypeNames[queue.Type],
+		"backend": failure.Backend,
+	}
+	extra := map[string]any{
+		"interaction_id": failure.InteractionID,
+		"member_id":      memberID,
+		"guild_id":       queue.DiscordInteraction.GuildID,
+		"request":        failure.Request,
+		"log":            failure.Log,
+	}
+	var p panicked
+	if errors.As(err, &p) {
+		reporting.Panic(p.value, tags, extra)
+	} else {
+		reporting.Error(err, tags, extra)
+	}
+
+	_, err = q.failedGenerationRepo.Create(context.Background(), failure)
+	if err != nil {
+		queue.logs.Printf("Error recording failed generation: %v", err)
+	}
+}
+
+// done frees the backend the item was dispatched to for the next one
+func (q *SDQueue) done(b *backend) {
 	q.mu.Lock()
-	q.currentImagine = nil
+	b.current = nil
 	q.mu.Unlock()
 }
 
@@ -127,17 +249,17 @@ func (q *SDQueue) getPreviousGeneration(queue *SDQueueItem) (*entities.ImageGene
 	sortOrder := queue.InteractionIndex
 	messageID := queue.DiscordInteraction.Message.ID
 
-	log.Printf("Reimagining interaction: %v, Message: %v", interactionID, messageID)
+	queue.logs.Printf("Reimagining interaction: %v, Message: %v", interactionID, messageID)
 
 	var err error
 	queue.ImageGenerationRequest, err = q.imageGenerationRepo.GetByMessageAndSort(context.Background(), messageID, sortOrder)
 	if err != nil {
-		log.Printf("Error getting image generation: %v", err)
+		queue.logs.Printf("Error getting image generation: %v", err)
 
 		return nil, err
 	}
 
-	log.Printf("Found generation: %v", queue.ImageGenerationRequest)
+	queue.logs.Printf("Found generation: %v", queue.ImageGenerationRequest)
 
 	return queue.ImageGenerationRequest, nil
 }
@@ -364,24 +486,18 @@ func safeDereference(s *string) string {
 
 func calculateDimensions(q *SDQueue, queue *SDQueueItem) (err error) {
 	textToImage := queue.TextToImageRequest
-	if textToImage.Width == 0 {
-		textToImage.Width, err = q.defaultWidth()
-		if err != nil {
-			return fmt.Errorf("error getting default width: %w", err)
-		}
-	}
-
-	if textToImage.Height == 0 {
-		textToImage.Height, err = q.defaultHeight()
-		if err != nil {
-			return fmt.Errorf("error getting default height: %w", err)
-		}
-	}
+	// only the dimensions are filled in here, so raw requests keep the rest as they were sent
+	resolved := MergeDefaults(append(q.defaultLayers(queue.DiscordInteraction), requestDefaults(textToImage))...)
+	textToImage.Width, textToImage.Height = *resolved.Width, *resolved.Height
 
 	if queue.AspectRatio != "" && queue.AspectRatio != "1:1" {
 		textToImage.Width, textToImage.Height = aspectRatioCalculation(queue.AspectRatio, textToImage.Width, textToImage.Height)
 	}
 
+	if queue.Type != ItemTypeRaw {
+		q.fitModelFamily(queue)
+	}
+
 	if textToImage.EnableHr && textToImage.HrScale > 1.0 {
 		textToImage.HrResizeX = int(float64(textToImage.Width) * textToImage.HrScale)
 		textToImage.HrResizeY = int(float64(textToImage.Height) * textToImage.HrScale)
@@ -393,11 +509,12 @@ func calculateDimensions(q *SDQueue, queue *SDQueueItem) (err error) {
 	return
 }
 
-// fillBlankModels fills in the blank models with the current models from the config
-func fillBlankModels(q *SDQueue, request *entities.ImageGenerationRequest) {
-	config, err := q.stableDiffusionAPI.GetConfig()
+// fillBlankModels fills in the blank models with the current models of the backend of the item
+func fillBlankModels(q *SDQueue, item *SDQueueItem) {
+	request := item.ImageGenerationRequest
+	config, err := q.api(item).GetConfig()
 	if err != nil {
-		log.Printf("Error getting config: %v", err)
+		item.logs.Printf("Error getting config: %v", err)
 	} else {
 		if !ptrStringNotBlank(request.Checkpoint) {
 			request.Checkpoint = config.SDModelCheckpoint
@@ -416,7 +533,7 @@ func initializeScripts(queue *SDQueueItem) {
 	request := queue.ImageGenerationRequest
 	textToImage := request.TextToImageRequest
 	if queue.ADetailerString != "" {
-		log.Printf("q.currentImagine.ADetailerString: %v", queue.ADetailerString)
+		queue.logs.Printf("q.currentImagine.ADetailerString: %v", queue.ADetailerString)
 		request.Scripts.ADetailer = entities.NewADetailer()
 		textToImage.Scripts.ADetailer.AppendSegModelByString(queue.ADetailerString, request)
 	}
@@ -428,9 +545,9 @@ func initializeScripts(queue *SDQueueItem) {
 	if request.Scripts.ADetailer != nil {
 		jsonMarshalScripts, err := json.MarshalIndent(&request.Scripts.ADetailer, "", "  ")
 		if err != nil {
-			log.Printf("Error marshalling scripts: %v", err)
+			queue.logs.Printf("Error marshalling scripts: %v", err)
 		} else {
-			log.Println("Final scripts (Adetailer): ", string(jsonMarshalScripts))
+			queue.logs.Println("Final scripts (Adetailer): ", string(jsonMarshalScripts))
 		}
 	}
 }
@@ -439,22 +556,31 @@ func initializeControlnet(queue *SDQueueItem) {
 	request := queue.ImageGenerationRequest
 	textToImage := request.TextToImageRequest
 
-	var controlnetImage string
+	var image *utils.Image
 	switch {
 	case queue.ControlnetItem.Image != nil:
-		controlnetImage = queue.ControlnetItem.Image.String()
+		image = queue.ControlnetItem.Image
 	case queue.Img2ImgItem.Image != nil:
 		// not needed for Img2Img as it automatically uses it if InputImage is null, only used for width/height
-		controlnetImage = queue.Img2ImgItem.Image.String()
+		image = queue.Img2ImgItem.Image
 	default:
 		queue.ControlnetItem.Enabled = false
 	}
-	width, height, err := utils.GetBase64ImageSize(controlnetImage)
+
+	var controlnetImage string
 	var controlnetResolution int
-	if err != nil {
-		log.Printf("Error getting image size: %v", err)
-	} else {
-		controlnetResolution = between(max(width, height), min(request.Width, request.Height), 1024)
+	if image != nil {
+		var err error
+		controlnetImage, err = image.Base64()
+		if err != nil {
+			queue.logs.Printf("Error converting controlnet image to base64: %v", err)
+		}
+		width, height, err := image.Size()
+		if err != nil {
+			queue.logs.Printf("Error getting image size: %v", err)
+		} else {
+			controlnetResolution = between(max(width, height), min(request.Width, request.Height), 1024)
+		}
 	}
 
 	textToImage.Scripts.ControlNet = &entities.ControlNet{
@@ -480,5 +606,5 @@ func initializeControlnet(queue *SDQueueItem) {
 		request.Scripts.ControlNet = nil
 	}
 
-	log.Printf("q.currentImagine.ControlnetItem.Enabled: %v", queue.ControlnetItem.Enabled)
+	queue.logs.Printf("q.currentImagine.ControlnetItem.Enabled: %v", queue.ControlnetItem.Enabled)
 }
@@ -5,37 +5,141 @@ import (
 	"log"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"stable_diffusion_bot/api/stable_diffusion_api"
 	"stable_diffusion_bot/composite_renderer"
 	"stable_diffusion_bot/entities"
+	"stable_diffusion_bot/maintenance"
+	"stable_diffusion_bot/prompt_template"
 	"stable_diffusion_bot/queue"
+	"stable_diffusion_bot/repositories/channel_defaults"
 	"stable_diffusion_bot/repositories/default_settings"
+	"stable_diffusion_bot/repositories/deleted_messages"
+	"stable_diffusion_bot/repositories/failed_generations"
+	"stable_diffusion_bot/repositories/guild_quiet_hours"
+	"stable_diffusion_bot/repositories/guild_watermarks"
 	"stable_diffusion_bot/repositories/image_generations"
+	"stable_diffusion_bot/repositories/layout_settings"
+	"stable_diffusion_bot/repositories/member_loras"
+	"stable_diffusion_bot/repositories/privacy_settings"
+	"stable_diffusion_bot/repositories/prompt_snippets"
+	"stable_diffusion_bot/repositories/refine_steps"
+	"stable_diffusion_bot/repositories/seed_bookmarks"
+	"stable_diffusion_bot/repositories/stats"
+	"stable_diffusion_bot/repositories/usage"
+	"stable_diffusion_bot/utils"
 
 	"github.com/bwmarrin/discordgo"
 )
 
 type SDQueue struct {
-	botSession          *discordgo.Session
-	stableDiffusionAPI  stable_diffusion_api.StableDiffusionAPI
-	queue               chan *SDQueueItem
-	currentImagine      *SDQueueItem
-	mu                  sync.Mutex
-	imageGenerationRepo image_generations.Repository
-	compositor          composite_renderer.Renderer
-	defaultSettingsRepo default_settings.Repository
-	botDefaultSettings  *entities.DefaultSettings
-	cancelledItems      map[string]bool
+	botSession           *discordgo.Session
+	stableDiffusionAPI   stable_diffusion_api.StableDiffusionAPI
+	queue                chan *SDQueueItem
+	mu                   sync.Mutex
+	imageGenerationRepo  image_generations.Repository
+	defaultSettingsRepo  default_settings.Repository
+	failedGenerationRepo failed_generations.Repository
+	usageRepo            usage.Repository
+	deletedMessageRepo   deleted_messages.Repository
+	statsRepo            stats.Repository
+	seedBookmarkRepo     seed_bookmarks.Repository
+	memberLoraRepo       member_loras.Repository
+	guildWatermarkRepo   guild_watermarks.Repository
+	guildQuietHoursRepo  guild_quiet_hours.Repository
+	privacySettingRepo   privacy_settings.Repository
+	layoutSettingRepo    layout_settings.Repository
+	promptSnippetRepo    prompt_snippets.Repository
+	channelDefaultRepo   channel_defaults.Repository
+	refineStepRepo       refine_steps.Repository
+	anlasBudget          entities.AnlasBudget
+	novelAIQueue         queue.Summarizer
+	novelAIReferencer    queue.Referencer
+	options              atomic.Pointer[options]
+	botDefaultSettings   *entities.DefaultSettings
+	cancelledItems       map[string]bool
+
+	// pending are the items waiting in the queue, held are the interactions told the backends are down
+	pending     map[string]*SDQueueItem
+	retries     []*SDQueueItem // items whose backend died, dispatched before the queue, see retry
+	held        map[string]*discordgo.Interaction
+	backendDown bool // every backend is down
+	paused      bool // set through the admin API, items stay queued until resumed
+
+	// backends are where items are generated, starting with stableDiffusionAPI. workers are the items being generated
+	backends []*backend
+	workers  sync.WaitGroup
+	waits    queue.Waits
+
+	// capabilities are the features the backend serves, see SetCapabilities
+	capabilities stable_diffusion_api.Capabilities
+
+	timelapses *recentCache[*timelapse]
+	fullRes    *recentCache[[][]byte]
+	batches    *recentCache[[][]byte]
 
 	stop chan os.Signal
 }
 
 type Config struct {
-	StableDiffusionAPI  stable_diffusion_api.StableDiffusionAPI
-	ImageGenerationRepo image_generations.Repository
-	DefaultSettingsRepo default_settings.Repository
+	StableDiffusionAPI   stable_diffusion_api.StableDiffusionAPI
+	ImageGenerationRepo  image_generations.Repository
+	DefaultSettingsRepo  default_settings.Repository
+	FailedGenerationRepo failed_generations.Repository
+	UsageRepo            usage.Repository
+	DeletedMessageRepo   deleted_messages.Repository
+	StatsRepo            stats.Repository
+	SeedBookmarkRepo     seed_bookmarks.Repository
+	MemberLoraRepo       member_loras.Repository
+	GuildWatermarkRepo   guild_watermarks.Repository
+	GuildQuietHoursRepo  guild_quiet_hours.Repository
+	PrivacySettingRepo   privacy_settings.Repository
+	LayoutSettingRepo    layout_settings.Repository
+	PromptSnippetRepo    prompt_snippets.Repository
+	ChannelDefaultRepo   channel_defaults.Repository
+	RefineStepRepo       refine_steps.Repository
+	// Backends are more APIs with the same models as StableDiffusionAPI, items are generated on whichever is idle
+	Backends []stable_diffusion_api.StableDiffusionAPI
+	// AnlasBudget is shown in /usage, the NovelAI queue enforces it. It can't be changed while the queue is running
+	AnlasBudget entities.AnlasBudget
+	// NovelAIQueue is shown next to this queue in /status queues, nil when NovelAI isn't set up
+	NovelAIQueue queue.Summarizer
+	// NovelAIReferencer generates /reference with NovelAI, nil when NovelAI isn't set up
+	NovelAIReferencer queue.Referencer
+	// RestoreWindow is how long deleted generations can be restored by an admin. Default is DefaultRestoreWindow
+	RestoreWindow time.Duration
+	// GridLabels selects what is drawn on each tile when more than four images are tiled. Default is GridLabelNone
+	GridLabels GridLabelMode
+	// GridLabelStyle sets the font, margin and colors of grid labels. Labels is ignored
+	GridLabelStyle composite_renderer.LabelOptions
+	// Encoding sets the output format and upload budget of images. WebP and AVIF need a registered encoder
+	Encoding composite_renderer.EncodeOptions
+	// Collage sets the columns, gutter and background of grids with more than four images
+	Collage composite_renderer.CollageOptions
+	// Renderer selects the backend that tiles grids, see composite_renderer.Backend. Default is the Go compositor
+	Renderer       composite_renderer.Backend
+	RendererBinary string
+	// UpscaleComparison adds a before and after crop to upscales. Default is composite_renderer.CompareSideBySide
+	UpscaleComparison composite_renderer.CompareMode
+	// StealthPNGInfo also hides the parameters in the alpha channel, which survives services that strip text chunks
+	StealthPNGInfo bool
+	// PreviewSize is the longest side in pixels of the images shown in the message, the full resolution images are
+	// sent with a button instead. Default is 0, which attaches the full resolution images
+	PreviewSize int
+	// ArchiveGrids attaches the full resolution images of grids as a ZIP named with their seeds, if it fits
+	ArchiveGrids bool
+	// DryRun posts the request JSON of every generation back instead of sending it to the API
+	DryRun bool
+	// TimingFooter appends how long each phase of a generation took to the footer of its embed
+	TimingFooter bool
+	// MaxMegapixels is the largest image generated for members other than the bot owner, including hires fix.
+	// Default is 0, which doesn't limit them
+	MaxMegapixels float64
+	// ModelFamilies sets the family of checkpoints by title or model name, for those whose family can't be told from
+	// their config file or name, e.g. "myMerge": "sdxl"
+	ModelFamilies map[string]string
 }
 
 func New(cfg Config) (queue.Queue[*SDQueueItem], error) {
@@ -51,14 +155,97 @@ func New(cfg Config) (queue.Queue[*SDQueueItem], error) {
 		return nil, errors.New("missing default settings repository")
 	}
 
-	return &SDQueue{
-		stableDiffusionAPI:  cfg.StableDiffusionAPI,
-		imageGenerationRepo: cfg.ImageGenerationRepo,
-		queue:               make(chan *SDQueueItem, 100),
-		compositor:          composite_renderer.Compositor(),
-		defaultSettingsRepo: cfg.DefaultSettingsRepo,
-		cancelledItems:      make(map[string]bool),
-	}, nil
+	if cfg.FailedGenerationRepo == nil {
+		return nil, errors.New("missing failed generation repository")
+	}
+
+	if cfg.UsageRepo == nil {
+		return nil, errors.New("missing usage repository")
+	}
+
+	if cfg.DeletedMessageRepo == nil {
+		return nil, errors.New("missing deleted message repository")
+	}
+
+	if cfg.StatsRepo == nil {
+		return nil, errors.New("missing stats repository")
+	}
+
+	if cfg.SeedBookmarkRepo == nil {
+		return nil, errors.New("missing seed bookmark repository")
+	}
+
+	if cfg.MemberLoraRepo == nil {
+		return nil, errors.New("missing member lora repository")
+	}
+
+	if cfg.GuildWatermarkRepo == nil {
+		return nil, errors.New("missing guild watermark repository")
+	}
+
+	if cfg.GuildQuietHoursRepo == nil {
+		return nil, errors.New("missing guild quiet hours repository")
+	}
+
+	if cfg.PrivacySettingRepo == nil {
+		return nil, errors.New("missing privacy setting repository")
+	}
+
+	if cfg.LayoutSettingRepo == nil {
+		return nil, errors.New("missing layout setting repository")
+	}
+
+	if cfg.PromptSnippetRepo == nil {
+		return nil, errors.New("missing prompt snippet repository")
+	}
+
+	if cfg.ChannelDefaultRepo == nil {
+		return nil, errors.New("missing channel default repository")
+	}
+
+	if cfg.RefineStepRepo == nil {
+		return nil, errors.New("missing refine step repository")
+	}
+
+	opts, err := newOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &SDQueue{
+		stableDiffusionAPI:   cfg.StableDiffusionAPI,
+		imageGenerationRepo:  cfg.ImageGenerationRepo,
+		queue:                make(chan *SDQueueItem, 100),
+		defaultSettingsRepo:  cfg.DefaultSettingsRepo,
+		failedGenerationRepo: cfg.FailedGenerationRepo,
+		usageRepo:            cfg.UsageRepo,
+		deletedMessageRepo:   cfg.DeletedMessageRepo,
+		statsRepo:            cfg.StatsRepo,
+		seedBookmarkRepo:     cfg.SeedBookmarkRepo,
+		memberLoraRepo:       cfg.MemberLoraRepo,
+		guildWatermarkRepo:   cfg.GuildWatermarkRepo,
+		guildQuietHoursRepo:  cfg.GuildQuietHoursRepo,
+		privacySettingRepo:   cfg.PrivacySettingRepo,
+		layoutSettingRepo:    cfg.LayoutSettingRepo,
+		promptSnippetRepo:    cfg.PromptSnippetRepo,
+		channelDefaultRepo:   cfg.ChannelDefaultRepo,
+		refineStepRepo:       cfg.RefineStepRepo,
+		anlasBudget:          cfg.AnlasBudget,
+		novelAIQueue:         cfg.NovelAIQueue,
+		novelAIReferencer:    cfg.NovelAIReferencer,
+		cancelledItems:       make(map[string]bool),
+		pending:              make(map[string]*SDQueueItem),
+		held:                 make(map[string]*discordgo.Interaction),
+		timelapses:           newRecentCache[*timelapse](maxTimelapses),
+		fullRes:              newRecentCache[[][]byte](maxFullResMessages),
+		batches:              newRecentCache[[][]byte](maxBatchMessages),
+		backends:             []*backend{{api: cfg.StableDiffusionAPI}},
+	}
+	for _, api := range cfg.Backends {
+		q.backends = append(q.backends, &backend{api: api})
+	}
+	q.options.Store(opts)
+	return q, nil
 }
 
 func (q *SDQueue) Commands() []*discordgo.ApplicationCommand { return q.commands() }
@@ -76,11 +263,53 @@ const (
 	ItemTypeRaw // raw JSON
 )
 
+// expandPrompts replaces the variables and snippets in the prompts of item, so the prompts it's stored with are the
+// ones that were generated
+func (q *SDQueue) expandPrompts(item *SDQueueItem) error {
+	if item.ImageGenerationRequest == nil || item.TextToImageRequest == nil {
+		return nil
+	}
+	request := item.TextToImageRequest
+	return prompt_template.ExpandAll(prompt_template.InteractionVars(item.DiscordInteraction, q.promptSnippetRepo),
+		&request.Prompt, &request.NegativePrompt, request.HrPrompt, request.HrNegativePrompt)
+}
+
 func (q *SDQueue) Add(queue *SDQueueItem) (int, error) {
+	if err := maintenance.Check(); err != nil {
+		return -1, err
+	}
+	if err := q.expandPrompts(queue); err != nil {
+		return -1, err
+	}
+	if err := q.checkFeatures(queue); err != nil {
+		return -1, err
+	}
+	if err := checkSampler(queue); err != nil {
+		return -1, err
+	}
+	if err := validateItem(queue); err != nil {
+		return -1, err
+	}
+	until, err := q.checkQuietHours(queue)
+	if err != nil {
+		return -1, err
+	}
 	if len(q.queue) == cap(q.queue) {
 		return -1, errors.New("queue is full")
 	}
 
+	if queue.DiscordInteraction != nil {
+		q.mu.Lock()
+		queue.queued = time.Now()
+		q.pending[queue.DiscordInteraction.ID] = queue
+		q.mu.Unlock()
+	}
+
+	if !until.IsZero() {
+		q.hold(queue, until)
+		return 0, nil
+	}
+
 	q.queue <- queue
 
 	linePosition := len(q.queue)
@@ -88,6 +317,41 @@ func (q *SDQueue) Add(queue *SDQueueItem) (int, error) {
 	return linePosition, nil
 }
 
+// Status is a snapshot of the queue for health checks
+type Status struct {
+	Pending    int  `json:"pending"`
+	Capacity   int  `json:"capacity"`
+	Processing bool `json:"processing"`
+	Paused     bool `json:"paused"`
+}
+
+func (q *SDQueue) Status() Status {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return Status{
+		Pending:    len(q.retries) + len(q.queue),
+		Capacity:   cap(q.queue),
+		Processing: len(q.runningItems()) > 0,
+		Paused:     q.paused,
+	}
+}
+
+func (q *SDQueue) Summary() queue.Summary {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	summary := queue.Summary{
+		Name:        "Stable Diffusion",
+		Depth:       len(q.retries) + len(q.queue),
+		Paused:      q.paused,
+		AverageWait: q.waits.Average(),
+	}
+	if running := q.runningItems(); len(running) > 0 {
+		summary.Current = utils.GetUser(running[0].DiscordInteraction)
+		summary.Started = running[0].started
+	}
+	return summary
+}
+
 func (q *SDQueue) Start(botSession *discordgo.Session) {
 	q.botSession = botSession
 
@@ -100,26 +364,32 @@ func (q *SDQueue) Start(botSession *discordgo.Session) {
 
 	q.botDefaultSettings = botDefaultSettings
 
-	var once bool
+	q.purgeDeleted()
+	purge := time.NewTicker(time.Hour)
+	defer purge.Stop()
+
+	q.checkBackend()
+	backend := time.NewTicker(backendCheckInterval)
+	defer backend.Stop()
 
 Polling:
 	for {
 		select {
 		case <-q.stop:
 			break Polling
+		case <-purge.C:
+			q.purgeDeleted()
+		case <-backend.C:
+			q.checkBackend()
 		case <-time.After(1 * time.Second):
-			if q.currentImagine == nil {
-				if err := q.next(); err != nil {
-					log.Printf("Error processing next item: %v", err)
-				}
-				once = false
-			} else if !once {
-				log.Printf("Waiting for current imagine to finish...\n")
-				once = true
+			if !q.backendAvailable() || q.isPaused() {
+				continue
 			}
+			q.dispatch()
 		}
 	}
 
+	q.workers.Wait()
 	log.Println("Polling stopped for Stable Diffusion")
 }
 
@@ -134,6 +404,7 @@ func (q *SDQueue) Stop() {
 func (q *SDQueue) Remove(messageInteraction *discordgo.MessageInteractionMetadata) error {
 	q.mu.Lock()
 	q.cancelledItems[messageInteraction.ID] = true
+	delete(q.pending, messageInteraction.ID)
 	q.mu.Unlock()
 
 	return nil
@@ -142,17 +413,18 @@ func (q *SDQueue) Remove(messageInteraction *discordgo.MessageInteractionMetadat
 func (q *SDQueue) Interrupt(i *discordgo.Interaction) error {
 	q.mu.Lock()
 	defer q.mu.Unlock()
-	if q.currentImagine == nil {
+	current := q.runningItem(i)
+	if current == nil {
 		return errors.New("there is no generation currently in progress")
 	}
 
 	// Mark the item as cancelled
-	log.Printf("Interrupting generation #%s\n", q.currentImagine.DiscordInteraction.ID)
-	if q.currentImagine.Interrupt == nil {
-		q.currentImagine.Interrupt = make(chan *discordgo.Interaction)
+	log.Printf("Interrupting generation #%s\n", current.DiscordInteraction.ID)
+	if current.Interrupt == nil {
+		current.Interrupt = make(chan *discordgo.Interaction)
 	}
-	q.currentImagine.Interrupt <- i
-	close(q.currentImagine.Interrupt)
+	current.Interrupt <- i
+	close(current.Interrupt)
 
 	return nil
 }
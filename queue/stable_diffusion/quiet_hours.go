@@ -0,0 +1,187 @@
+package stable_diffusion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"stable_diffusion_bot/discord_bot/handlers"
+	"stable_diffusion_bot/entities"
+	"stable_diffusion_bot/maintenance"
+	"stable_diffusion_bot/repositories"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// quietHoursMessage is shown instead of queueing requests in guilds that disable generation during quiet hours
+const quietHoursMessage = "Generation is paused in this server during quiet hours."
+
+// guildQuietHours returns the quiet hours of the guild, or nil if it has none
+func (q *SDQueue) guildQuietHours(guildID string) *entities.GuildQuietHours {
+	if guildID == "" {
+		return nil
+	}
+
+	quietHours, err := q.guildQuietHoursRepo.GetByGuildID(context.Background(), guildID)
+	if err != nil {
+		var notFound *repositories.NotFoundError
+		if !errors.As(err, &notFound) {
+			log.Printf("Error getting quiet hours for guild %s: %v", guildID, err)
+		}
+		return nil
+	}
+
+	return quietHours
+}
+
+// checkQuietHours returns when the item may run if its guild is in quiet hours, zero otherwise.
+// Guilds that disable generation during quiet hours get a *maintenance.Error with the end of the window instead.
+func (q *SDQueue) checkQuietHours(item *SDQueueItem) (time.Time, error) {
+	if item.DiscordInteraction == nil {
+		return time.Time{}, nil
+	}
+	quietHours := q.guildQuietHours(item.DiscordInteraction.GuildID)
+	if quietHours == nil {
+		return time.Time{}, nil
+	}
+	until, ok := quietHours.Until(time.Now())
+	if !ok {
+		return time.Time{}, nil
+	}
+	if quietHours.Mode == entities.QuietHoursOff {
+		return time.Time{}, &maintenance.Error{
+			State: maintenance.State{Message: quietHoursMessage, Until: until},
+			Title: "Quiet hours",
+		}
+	}
+	return until, nil
+}
+
+// hold adds the item to the queue once quiet hours end. It's pending in the meantime so it can be cancelled.
+func (q *SDQueue) hold(item *SDQueueItem, until time.Time) {
+	item.heldUntil = until
+	time.AfterFunc(time.Until(until), func() {
+		log.Printf("Quiet hours ended, queueing held generation #%s", item.DiscordInteraction.ID)
+		q.queue <- item
+	})
+}
+
+// linePosition tells the member where their item is in line, or when it will run if it's held for quiet hours
+func linePosition(item *SDQueueItem, position int) string {
+	if !item.heldUntil.IsZero() {
+		return fmt.Sprintf("This server is in quiet hours, your request will run at <t:%d:t> (<t:%d:R>).",
+			item.heldUntil.Unix(), item.heldUntil.Unix())
+	}
+	return fmt.Sprintf("You are currently #%d in line.", position)
+}
+
+// parseClock parses HH:MM into minutes since midnight
+func parseClock(value string) (int, error) {
+	parsed, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a time as HH:MM", value)
+	}
+	return parsed.Hour()*60 + parsed.Minute(), nil
+}
+
+func formatClock(minutes int) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+func describeQuietHours(quietHours *entities.GuildQuietHours) string {
+	action := "held until they end"
+	if quietHours.Mode == entities.QuietHoursOff {
+		action = "disabled"
+	}
+	description := fmt.Sprintf("Quiet hours are from %s to %s (%s), generations are %s.",
+		formatClock(quietHours.Start), formatClock(quietHours.End), quietHours.Timezone, action)
+	if until, ok := quietHours.Until(time.Now()); ok {
+		description += fmt.Sprintf("\nQuiet hours are on until <t:%d:t>.", until.Unix())
+	}
+	return description
+}
+
+func (q *SDQueue) processQuietHoursCommand(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	if err := handlers.EphemeralThink(s, i); err != nil {
+		return err
+	}
+
+	if i.GuildID == "" {
+		return handlers.ErrorEdit(s, i.Interaction, "Quiet hours can only be set in a server.")
+	}
+
+	data := i.ApplicationCommandData()
+	if len(data.Options) == 0 {
+		return handlers.ErrorEdit(s, i.Interaction, "You need to choose a subcommand.")
+	}
+
+	subcommand := data.Options[0]
+	optionMap := make(map[string]*discordgo.ApplicationCommandInteractionDataOption, len(subcommand.Options))
+	for _, opt := range subcommand.Options {
+		optionMap[opt.Name] = opt
+	}
+
+	switch "quiet_hours_" + subcommand.Name {
+	case quietHoursSetOption:
+		quietHours := &entities.GuildQuietHours{
+			GuildID:  i.GuildID,
+			Timezone: "UTC",
+			Mode:     entities.QuietHoursHold,
+		}
+		var err error
+		if option, ok := optionMap[quietHoursStartOption]; ok {
+			if quietHours.Start, err = parseClock(option.StringValue()); err != nil {
+				return handlers.ErrorEdit(s, i.Interaction, "Invalid start.", err)
+			}
+		}
+		if option, ok := optionMap[quietHoursEndOption]; ok {
+			if quietHours.End, err = parseClock(option.StringValue()); err != nil {
+				return handlers.ErrorEdit(s, i.Interaction, "Invalid end.", err)
+			}
+		}
+		if quietHours.Start == quietHours.End {
+			return handlers.ErrorEdit(s, i.Interaction, "Quiet hours must start and end at different times.")
+		}
+		if option, ok := optionMap[quietHoursTimezoneOption]; ok {
+			location, err := time.LoadLocation(option.StringValue())
+			if err != nil {
+				return handlers.ErrorEdit(s, i.Interaction, fmt.Sprintf("Unknown timezone `%s`.", option.StringValue()))
+			}
+			quietHours.Timezone = location.String()
+		}
+		if option, ok := optionMap[quietHoursModeOption]; ok {
+			quietHours.Mode = option.StringValue()
+		}
+
+		if _, err := q.guildQuietHoursRepo.Upsert(context.Background(), quietHours); err != nil {
+			return handlers.ErrorEdit(s, i.Interaction, "Error saving quiet hours.", err)
+		}
+
+		_, err = handlers.EditInteractionResponse(s, i.Interaction, describeQuietHours(quietHours))
+		return err
+	case quietHoursShowOption:
+		quietHours := q.guildQuietHours(i.GuildID)
+		if quietHours == nil {
+			_, err := handlers.EditInteractionResponse(s, i.Interaction, "This server has no quiet hours.")
+			return err
+		}
+		_, err := handlers.EditInteractionResponse(s, i.Interaction, describeQuietHours(quietHours))
+		return err
+	case quietHoursClearOption:
+		err := q.guildQuietHoursRepo.Delete(context.Background(), i.GuildID)
+		var notFound *repositories.NotFoundError
+		if errors.As(err, &notFound) {
+			return handlers.ErrorEdit(s, i.Interaction, "This server has no quiet hours.")
+		}
+		if err != nil {
+			return handlers.ErrorEdit(s, i.Interaction, "Error removing quiet hours.", err)
+		}
+		_, err = handlers.EditInteractionResponse(s, i.Interaction,
+			"Removed the quiet hours, generations held until they end stay queued.")
+		return err
+	default:
+		return handlers.ErrorEdit(s, i.Interaction, fmt.Sprintf("Unknown subcommand: %s", subcommand.Name))
+	}
+}
@@ -0,0 +1,43 @@
+package stable_diffusion
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sync"
+
+	"stable_diffusion_bot/discord_bot/handlers"
+	"stable_diffusion_bot/entities"
+	"stable_diffusion_bot/jsonschema"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// rawSchema describes the JSON accepted by /raw. Blobs are validated against it unless they're sent as unsafe.
+var rawSchema = sync.OnceValue(func() *jsonschema.Schema {
+	schema := jsonschema.Generate(reflect.TypeFor[entities.TextToImageRaw]())
+	schema.Title = "Raw txt2img request"
+	return schema
+})
+
+func (q *SDQueue) processRawSchema(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	if err := handlers.EphemeralThink(s, i); err != nil {
+		return err
+	}
+
+	schema, err := json.MarshalIndent(rawSchema(), "", "  ")
+	if err != nil {
+		return handlers.ErrorEdit(s, i.Interaction, "Error generating the schema.", err)
+	}
+
+	_, err = handlers.EditInteractionResponse(s, i.Interaction,
+		"The JSON Schema of `/raw` requests. Point your editor at it to check your requests as you write them.",
+		&discordgo.WebhookEdit{
+			Files: []*discordgo.File{{
+				Name:        "raw.schema.json",
+				ContentType: "application/schema+json",
+				Reader:      bytes.NewReader(schema),
+			}},
+		})
+	return err
+}
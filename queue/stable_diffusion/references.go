@@ -0,0 +1,188 @@
+package stable_diffusion
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/bwmarrin/discordgo"
+
+	"stable_diffusion_bot/discord_bot/handlers"
+	"stable_diffusion_bot/entities"
+	"stable_diffusion_bot/queue"
+	"stable_diffusion_bot/utils"
+)
+
+const (
+	// maxReferences is the number of ControlNet units the extension has by default
+	maxReferences = 3
+	// defaultReferenceStrength matches the default reference strength of NovelAI's vibe transfer
+	defaultReferenceStrength = 0.6
+
+	referenceImageOption    = "image"
+	referenceStrengthOption = "strength"
+	referenceBackendOption  = "backend"
+
+	referenceBackendStableDiffusion = "stable_diffusion"
+	referenceBackendNovelAI         = "novelai"
+
+	// referenceModule guides the generation with the image itself, so it doesn't need a ControlNet model
+	referenceModule = "reference_only"
+)
+
+// minReferenceStrength isn't 0, as ControlNet leaves out a weight of 0 and uses 1 instead
+var minReferenceStrength = 0.05
+
+// referenceOptionName is the name of the image or strength option of the nth reference, e.g. image, image_2, image_3
+func referenceOptionName(name string, n int) string {
+	if n == 1 {
+		return name
+	}
+	return fmt.Sprintf("%s_%d", name, n)
+}
+
+func referenceOptions() []*discordgo.ApplicationCommandOption {
+	options := []*discordgo.ApplicationCommandOption{
+		commandOptions[promptOption],
+	}
+	for n := range maxReferences {
+		options = append(options, &discordgo.ApplicationCommandOption{
+			Type:        discordgo.ApplicationCommandOptionAttachment,
+			Name:        referenceOptionName(referenceImageOption, n+1),
+			Description: fmt.Sprintf("Image %d to generate something like", n+1),
+			Required:    n == 0,
+		})
+	}
+	for n := range maxReferences {
+		options = append(options, &discordgo.ApplicationCommandOption{
+			Type:        discordgo.ApplicationCommandOptionNumber,
+			Name:        referenceOptionName(referenceStrengthOption, n+1),
+			Description: fmt.Sprintf("How much image %d guides the result. Default is %v", n+1, defaultReferenceStrength),
+			MinValue:    &minReferenceStrength,
+			MaxValue:    1,
+		})
+	}
+	return append(options,
+		&discordgo.ApplicationCommandOption{
+			Type:        discordgo.ApplicationCommandOptionString,
+			Name:        referenceBackendOption,
+			Description: "Generate with ControlNet on Stable Diffusion or vibe transfer on NovelAI. Default is Stable Diffusion",
+			Choices: []*discordgo.ApplicationCommandOptionChoice{
+				{Name: "Stable Diffusion", Value: referenceBackendStableDiffusion},
+				{Name: "NovelAI", Value: referenceBackendNovelAI},
+			},
+		},
+		commandOptions[negativeOption],
+	)
+}
+
+// referenceControlNet is a reference only ControlNet unit for each reference, weighted by its strength
+func referenceControlNet(references []queue.Reference) (*entities.ControlNet, error) {
+	controlNet := &entities.ControlNet{}
+	for n, reference := range references {
+		image, err := reference.Image.Base64()
+		if err != nil {
+			return nil, fmt.Errorf("error reading image %d: %w", n+1, err)
+		}
+		controlNet.Args = append(controlNet.Args, &entities.ControlNetParameters{
+			InputImage:  &image,
+			Module:      referenceModule,
+			Model:       "None",
+			Weight:      reference.Strength,
+			ResizeMode:  entities.ResizeModeScaleToFit,
+			ControlMode: entities.ControlModeBalanced,
+		})
+	}
+	return controlNet, nil
+}
+
+func (q *SDQueue) processReferenceCommand(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	if err := handlers.ThinkResponse(s, i); err != nil {
+		return err
+	}
+
+	optionMap := utils.GetOpts(i.ApplicationCommandData())
+
+	option, ok := optionMap[promptOption]
+	if !ok {
+		return handlers.ErrorEdit(s, i.Interaction, "You need to provide a prompt.")
+	}
+	prompt := option.StringValue()
+
+	var negative string
+	if option, ok := optionMap[negativeOption]; ok {
+		negative = option.StringValue()
+	}
+
+	attachments, err := utils.GetAttachments(i)
+	var attachmentErr *utils.AttachmentError
+	if errors.As(err, &attachmentErr) {
+		return handlers.ErrorEdit(s, i.Interaction, attachmentErr.Error())
+	}
+	if err != nil {
+		return handlers.ErrorEdit(s, i.Interaction, "Error getting attachments.", err)
+	}
+
+	var references []queue.Reference
+	for n := 1; n <= maxReferences; n++ {
+		option, ok := optionMap[referenceOptionName(referenceImageOption, n)]
+		if !ok {
+			continue
+		}
+		attachment, ok := attachments[option.Value.(string)]
+		if !ok {
+			return handlers.ErrorEdit(s, i.Interaction, fmt.Sprintf("Could not find image %d.", n))
+		}
+		reference := queue.Reference{Image: attachment.Image, Strength: defaultReferenceStrength}
+		if option, ok := optionMap[referenceOptionName(referenceStrengthOption, n)]; ok {
+			reference.Strength = option.FloatValue()
+		}
+		references = append(references, reference)
+	}
+	if len(references) == 0 {
+		return handlers.ErrorEdit(s, i.Interaction, "You need to provide at least one image.")
+	}
+
+	if option, ok := optionMap[referenceBackendOption]; ok && option.StringValue() == referenceBackendNovelAI {
+		if q.novelAIReferencer == nil {
+			return handlers.ErrorEdit(s, i.Interaction, "NovelAI isn't set up on this bot.")
+		}
+		return q.novelAIReferencer.GenerateFromReferences(s, i.Interaction, prompt, negative, references)
+	}
+
+	item := q.NewItem(i.Interaction, WithPrompt(prompt))
+	item.Type = ItemTypeImagine
+	if negative != "" {
+		item.NegativePrompt = negative
+	}
+	item.Scripts.ControlNet, err = referenceControlNet(references)
+	if err != nil {
+		return handlers.ErrorEdit(s, i.Interaction, "Error reading the images.", err)
+	}
+	for _, reference := range references {
+		item.references = append(item.references, reference.Image)
+	}
+
+	position, err := q.Add(item)
+	var invalid *ValidationError
+	if errors.As(err, &invalid) {
+		return errorInvalid(s, i.Interaction, invalid)
+	}
+	if err != nil {
+		return handlers.ErrorEdit(s, i.Interaction, "Error adding imagine to queue.", err)
+	}
+
+	message, err := handlers.EditInteractionResponse(s, i.Interaction,
+		fmt.Sprintf("I'm dreaming up something like your images. %s\n<@%s> asked me to imagine \n```\n%s\n```",
+			linePosition(item, position), utils.GetUser(i.Interaction).ID, item.Prompt),
+		handlers.Components[handlers.Cancel],
+	)
+	if err != nil {
+		return err
+	}
+	if item.DiscordInteraction.Message == nil && message != nil {
+		log.Printf("Setting message ID for interaction %v", item.DiscordInteraction.ID)
+		item.DiscordInteraction.Message = message
+	}
+	return nil
+}
@@ -0,0 +1,352 @@
+package stable_diffusion
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"stable_diffusion_bot/composite_renderer"
+	"stable_diffusion_bot/discord_bot/handlers"
+	"stable_diffusion_bot/entities"
+	"stable_diffusion_bot/repositories"
+	"stable_diffusion_bot/utils"
+)
+
+const (
+	RefineButton         customID = "imagine_refine"
+	RefineSelect         customID = "imagine_refine_select"
+	RefineTimelineButton customID = "imagine_refine_timeline"
+)
+
+// refineStrengths are the denoising strengths offered when refining, from touching up the image to redrawing most of it
+var refineStrengths = []struct {
+	strength float64
+	label    string
+}{
+	{0.3, "Touch up"},
+	{0.45, "Refine details"},
+	{0.6, "Rework"},
+	{0.75, "Reimagine"},
+}
+
+// refineComponents is the row of a generation with the Refine button, and the Timeline button if it's part of a chain
+func refineComponents(timeline bool) discordgo.ActionsRow {
+	row := discordgo.ActionsRow{
+		Components: []discordgo.MessageComponent{
+			discordgo.Button{
+				Label:    "Refine",
+				Style:    discordgo.SecondaryButton,
+				CustomID: RefineButton,
+				Emoji: &discordgo.ComponentEmoji{
+					Name: "🪄",
+				},
+			},
+		},
+	}
+	if timeline {
+		row.Components = append(row.Components, discordgo.Button{
+			Label:    "Timeline",
+			Style:    discordgo.SecondaryButton,
+			CustomID: RefineTimelineButton,
+			Emoji: &discordgo.ComponentEmoji{
+				Name: "🧭",
+			},
+		})
+	}
+	return row
+}
+
+// processRefineButton asks which image to refine and by how much. The value of each option is the message, sort
+// order and denoising strength separated by colons, as the select is sent in a message of its own.
+func (q *SDQueue) processRefineButton(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	generations, err := q.imageGenerationRepo.GetAllByMessage(context.Background(), i.Message.ID)
+	if err != nil || len(generations) == 0 {
+		return handlers.ErrorEphemeral(s, i.Interaction, "Could not find the generation of this message.", err)
+	}
+
+	var sortOrders []int
+	for _, generation := range generations {
+		if generation.SortOrder > 0 {
+			sortOrders = append(sortOrders, generation.SortOrder)
+		}
+	}
+	if len(sortOrders) == 0 {
+		// img2img generations are only recorded once
+		sortOrders = []int{0}
+	}
+
+	var options []discordgo.SelectMenuOption
+	for _, sortOrder := range sortOrders[:min(len(sortOrders), 4)] {
+		for _, choice := range refineStrengths {
+			label := fmt.Sprintf("%s (%v)", choice.label, choice.strength)
+			if len(sortOrders) > 1 {
+				label = fmt.Sprintf("Image %d: %s", sortOrder, label)
+			}
+			options = append(options, discordgo.SelectMenuOption{
+				Label: label,
+				Value: fmt.Sprintf("%s:%d:%v", i.Message.ID, sortOrder, choice.strength),
+			})
+		}
+	}
+
+	return handlers.Wrap(s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags:   discordgo.MessageFlagsEphemeral,
+			Content: "How much should I change it? The result can be refined again.",
+			Components: []discordgo.MessageComponent{
+				discordgo.ActionsRow{
+					Components: []discordgo.MessageComponent{
+						discordgo.SelectMenu{
+							CustomID:    RefineSelect,
+							Placeholder: "Denoising strength",
+							MinValues:   &minValues,
+							MaxValues:   1,
+							Options:     options,
+						},
+					},
+				},
+			},
+		},
+	}))
+}
+
+// parseRefineValue reads the message, sort order and denoising strength of a RefineSelect option
+func parseRefineValue(value string) (messageID string, sortOrder int, strength float64, err error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 3 {
+		return "", 0, 0, fmt.Errorf("invalid refine option %q", value)
+	}
+	sortOrder, err = strconv.Atoi(parts[1])
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("invalid sort order in refine option %q: %w", value, err)
+	}
+	strength, err = strconv.ParseFloat(parts[2], 64)
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("invalid denoising strength in refine option %q: %w", value, err)
+	}
+	return parts[0], sortOrder, strength, nil
+}
+
+// processRefineSelect queues the chosen image as the init image of an img2img generation with the same settings
+func (q *SDQueue) processRefineSelect(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	values := i.MessageComponentData().Values
+	if len(values) == 0 {
+		return handlers.ErrorEphemeral(s, i.Interaction, "You need to choose how much to change the image.")
+	}
+	messageID, sortOrder, strength, err := parseRefineValue(values[0])
+	if err != nil {
+		return handlers.ErrorEphemeral(s, i.Interaction, "Error reading the chosen option.", err)
+	}
+
+	if err := handlers.ThinkResponse(s, i); err != nil {
+		return err
+	}
+
+	parent, err := q.imageGenerationRepo.GetByMessageAndSort(context.Background(), messageID, sortOrder)
+	if err != nil {
+		return handlers.ErrorEdit(s, i.Interaction, "Could not find the generation to refine.", err)
+	}
+	channelID := cmp.Or(parent.ChannelID, i.ChannelID)
+	image, err := q.generationImage(s, channelID, messageID, sortOrder)
+	if err != nil {
+		return handlers.ErrorEdit(s, i.Interaction, "Could not find the image to refine.", err)
+	}
+
+	textToImage := *parent.TextToImageRequest
+	textToImage.NIter, textToImage.BatchSize = 1, 1
+	textToImage.Seed, textToImage.SubseedStrength = -1, 0
+	// the image is already at its final size
+	textToImage.EnableHr = false
+	textToImage.DenoisingStrength = strength
+
+	step := &entities.RefineStep{
+		ParentMessageID:   messageID,
+		ParentSortOrder:   sortOrder,
+		RootMessageID:     messageID,
+		Step:              1,
+		DenoisingStrength: strength,
+	}
+	previous, err := q.refineStepRepo.GetByMessageID(context.Background(), messageID)
+	var notFound *repositories.NotFoundError
+	switch {
+	case err == nil:
+		step.RootMessageID = previous.RootMessageID
+		step.Step = previous.Step + 1
+	case !errors.As(err, &notFound):
+		log.Printf("Error getting the refine step of message %s: %v", messageID, err)
+	}
+
+	item := &SDQueueItem{
+		Type: ItemTypeImg2Img,
+		ImageGenerationRequest: &entities.ImageGenerationRequest{
+			GenerationInfo: entities.GenerationInfo{
+				CreatedAt: time.Now(),
+			},
+			TextToImageRequest: &textToImage,
+		},
+		DiscordInteraction: i.Interaction,
+		Img2ImgItem: Img2ImgItem{
+			Image:             image,
+			DenoisingStrength: strength,
+		},
+		ControlnetItem: ControlnetItem{
+			ControlMode: entities.ControlModeBalanced,
+			ResizeMode:  entities.ResizeModeScaleToFit,
+		},
+		refine: step,
+	}
+
+	position, err := q.Add(item)
+	var invalid *ValidationError
+	if errors.As(err, &invalid) {
+		return errorInvalid(s, i.Interaction, invalid)
+	}
+	if err != nil {
+		return handlers.ErrorEdit(s, i.Interaction, "Error adding refinement to queue.", err)
+	}
+
+	message, err := handlers.EditInteractionResponse(s, i.Interaction,
+		fmt.Sprintf("I'm refining that for you, step %d with a denoising strength of `%v`. %s\n<@%s> asked me to imagine \n```\n%s\n```",
+			step.Step, strength, linePosition(item, position), utils.GetUser(i.Interaction).ID, item.Prompt),
+		handlers.Components[handlers.Cancel],
+	)
+	if err != nil {
+		return err
+	}
+	if message != nil {
+		item.DiscordInteraction.Message = message
+	}
+	return nil
+}
+
+// recordRefineStep adds the finished refinement to its chain
+func (q *SDQueue) recordRefineStep(item *SDQueueItem) {
+	step := item.refine
+	request := item.ImageGenerationRequest
+	step.MessageID = request.MessageID
+	step.GuildID = request.GuildID
+	step.ChannelID = request.ChannelID
+	if _, err := q.refineStepRepo.Create(context.Background(), step); err != nil {
+		log.Printf("Error recording refine step %d of message %s: %v", step.Step, step.RootMessageID, err)
+	}
+}
+
+// generationImage returns an image of a generation, from the full resolution images kept in memory for recent
+// generations, or else from the attachments of its message. A grid posted as a single image can only be refined
+// while it's kept in memory.
+func (q *SDQueue) generationImage(s *discordgo.Session, channelID, messageID string, sortOrder int) (*utils.Image, error) {
+	index := max(sortOrder-1, 0)
+	for _, cache := range []*recentCache[[][]byte]{q.fullRes, q.batches} {
+		if originals, ok := cache.get(messageID); ok && index < len(originals) {
+			return utils.ImageFromBytes(originals[index]), nil
+		}
+	}
+
+	message, err := s.ChannelMessage(channelID, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving message %s: %w", messageID, err)
+	}
+	var attachments []*discordgo.MessageAttachment
+	for _, attachment := range message.Attachments {
+		if strings.HasPrefix(attachment.ContentType, "image") && !strings.HasPrefix(attachment.Filename, "thumbnail") {
+			attachments = append(attachments, attachment)
+		}
+	}
+
+	var attachment *discordgo.MessageAttachment
+	switch {
+	case len(attachments) > 1 && index < len(attachments):
+		attachment = attachments[index]
+	case len(attachments) == 1 && index == 0:
+		attachment = attachments[0]
+	default:
+		return nil, errors.New("the images of grids are only kept for recent generations while the bot is running")
+	}
+
+	return utils.DownloadAttachment(attachment, utils.AttachmentLimits{})
+}
+
+// processRefineTimelineButton shows the steps of the chain the generation is part of, with their images side by side
+func (q *SDQueue) processRefineTimelineButton(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	if err := handlers.EphemeralThink(s, i); err != nil {
+		return err
+	}
+
+	step, err := q.refineStepRepo.GetByMessageID(context.Background(), i.Message.ID)
+	var notFound *repositories.NotFoundError
+	if errors.As(err, &notFound) {
+		return handlers.ErrorEdit(s, i.Interaction, "This generation wasn't refined from another one.")
+	}
+	if err != nil {
+		return handlers.ErrorEdit(s, i.Interaction, "Error retrieving the refinement chain.", err)
+	}
+	steps, err := q.refineStepRepo.ListByRootMessageID(context.Background(), step.RootMessageID)
+	if err != nil || len(steps) == 0 {
+		return handlers.ErrorEdit(s, i.Interaction, "Error retrieving the refinement chain.", err)
+	}
+
+	first := steps[0]
+	guildID := cmp.Or(first.GuildID, "@me")
+	link := func(channelID, messageID string) string {
+		return fmt.Sprintf("https://discord.com/channels/%s/%s/%s", guildID, channelID, messageID)
+	}
+
+	var lines []string
+	var images []io.Reader
+	var captions []string
+	lines = append(lines, fmt.Sprintf("**Start**: %s", link(first.ChannelID, first.RootMessageID)))
+	if image, err := q.generationImage(s, first.ChannelID, first.RootMessageID, first.ParentSortOrder); err != nil {
+		log.Printf("Error getting the image of message %s for the timeline: %v", first.RootMessageID, err)
+	} else {
+		images, captions = append(images, image), append(captions, "Start")
+	}
+	// the first tile is the start of the chain
+	for _, step := range steps[max(len(steps)-(maxContactSheetCount-1), 0):] {
+		lines = append(lines, fmt.Sprintf("**Step %d**: denoising `%v` %s", step.Step, step.DenoisingStrength, link(step.ChannelID, step.MessageID)))
+		image, err := q.generationImage(s, step.ChannelID, step.MessageID, 0)
+		if err != nil {
+			log.Printf("Error getting the image of message %s for the timeline: %v", step.MessageID, err)
+			continue
+		}
+		images = append(images, image)
+		captions = append(captions, fmt.Sprintf("Step %d (%v)", step.Step, step.DenoisingStrength))
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       "Refinement timeline",
+		Description: shortenTo(strings.Join(lines, "\n"), 4096),
+	}
+	webhook := &discordgo.WebhookEdit{Embeds: &[]*discordgo.MessageEmbed{embed}}
+
+	if len(images) > 0 {
+		sheet, err := composite_renderer.ContactSheet(images, captions, composite_renderer.ContactSheetOptions{})
+		if err != nil {
+			log.Printf("Error rendering the timeline: %v", err)
+		} else {
+			format := composite_renderer.Format{Extension: "png", ContentType: "image/png"}
+			if reencoder, ok := q.settings().compositor.(composite_renderer.Reencoder); ok {
+				limit := utils.UploadLimit(s, i.GuildID)
+				sheet, format, err = reencoder.Reencode(sheet, limit-limit/20)
+			}
+			if err != nil {
+				log.Printf("Error encoding the timeline: %v", err)
+			} else {
+				name := "timeline." + format.Extension
+				embed.Image = &discordgo.MessageEmbedImage{URL: "attachment://" + name}
+				webhook.Files = []*discordgo.File{{Name: name, ContentType: format.ContentType, Reader: sheet}}
+			}
+		}
+	}
+
+	_, err = handlers.EditInteractionResponse(s, i.Interaction, webhook)
+	return err
+}
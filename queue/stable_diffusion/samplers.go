@@ -0,0 +1,106 @@
+package stable_diffusion
+
+import (
+	"fmt"
+
+	"stable_diffusion_bot/api/stable_diffusion_api"
+	"stable_diffusion_bot/discord_bot/handlers"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/sahilm/fuzzy"
+)
+
+// checkSampler replaces the sampler and scheduler of the item with the names the backend uses, so an unknown name
+// is rejected when it's queued instead of by the backend once it's generated. Names like "DPM++ 2M Karras" are split
+// into the sampler and scheduler on backends that choose them separately.
+func checkSampler(item *SDQueueItem) error {
+	if item.ImageGenerationRequest == nil || item.TextToImageRequest == nil {
+		return nil
+	}
+	request := item.TextToImageRequest
+
+	var scheduler stable_diffusion_api.SchedulerName
+	if request.Scheduler != nil && *request.Scheduler != "" {
+		var err error
+		scheduler, err = stable_diffusion_api.ParseScheduler(*request.Scheduler)
+		if err != nil {
+			return err
+		}
+	}
+
+	if request.SamplerName != "" {
+		sampler, err := stable_diffusion_api.ParseSampler(request.SamplerName)
+		if err != nil {
+			split, implied, ok := stable_diffusion_api.SplitSampler(request.SamplerName)
+			if !ok {
+				return err
+			}
+			if scheduler != "" && scheduler != implied {
+				return fmt.Errorf("the sampler `%s` already uses the `%s` scheduler, choose `%s` to use the `%s` scheduler",
+					request.SamplerName, implied, split, scheduler)
+			}
+			sampler, scheduler = split, implied
+		}
+		request.SamplerName = string(sampler)
+	}
+
+	if request.HrSamplerName != nil && *request.HrSamplerName != "" {
+		if _, err := stable_diffusion_api.ParseSampler(*request.HrSamplerName); err != nil {
+			return fmt.Errorf("hires fix: %w", err)
+		}
+	}
+
+	if scheduler != "" {
+		name := string(scheduler)
+		request.Scheduler = &name
+	}
+	return nil
+}
+
+// samplerNames are the samplers followed by each sampler with each scheduler, e.g. "DPM++ 2M Karras"
+func (q *SDQueue) samplerNames() ([]string, error) {
+	cache, err := stable_diffusion_api.SamplerCache.GetCache(q.stableDiffusionAPI)
+	if err != nil {
+		return nil, err
+	}
+	samplers := *cache.(*stable_diffusion_api.Samplers)
+
+	names := make([]string, 0, len(samplers))
+	for _, sampler := range samplers {
+		names = append(names, sampler.Name)
+	}
+	if stable_diffusion_api.SchedulerCache == nil {
+		return names, nil
+	}
+	for _, sampler := range samplers {
+		for _, scheduler := range *stable_diffusion_api.SchedulerCache {
+			names = append(names, sampler.Name+" "+scheduler.Label)
+		}
+	}
+	return names, nil
+}
+
+func (q *SDQueue) autocompleteSampler(i *discordgo.InteractionCreate, opt *discordgo.ApplicationCommandInteractionDataOption) error {
+	names, err := q.samplerNames()
+	if err != nil {
+		return fmt.Errorf("error retrieving %v cache: %w", opt.Name, err)
+	}
+
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	if input := opt.StringValue(); input != "" {
+		for _, match := range fuzzy.Find(input, names) {
+			choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: match.Str, Value: match.Str})
+		}
+	} else {
+		for _, name := range names {
+			choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: name, Value: name})
+		}
+	}
+
+	return handlers.Wrap(q.botSession.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{
+			Choices: choices[:min(25, len(choices))],
+		},
+	}))
+}
@@ -0,0 +1,257 @@
+package stable_diffusion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"stable_diffusion_bot/discord_bot/handlers"
+	"stable_diffusion_bot/entities"
+	"stable_diffusion_bot/repositories"
+	"stable_diffusion_bot/repositories/image_generations"
+	"stable_diffusion_bot/utils"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/sahilm/fuzzy"
+)
+
+// seedBookmarkPrefix marks a seed option value as a bookmark name, e.g. seed:name:good-face-seed
+const seedBookmarkPrefix = "name:"
+
+var seedNameRegex = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// resolveSeed parses a seed option, looking up the member's bookmark if it is prefixed with seedBookmarkPrefix
+func (q *SDQueue) resolveSeed(memberID string, value string) (int64, error) {
+	value = strings.TrimSpace(value)
+	if name, ok := strings.CutPrefix(value, seedBookmarkPrefix); ok {
+		bookmark, err := q.seedBookmarkRepo.Get(context.Background(), memberID, strings.ToLower(name))
+		if err != nil {
+			return 0, fmt.Errorf("unknown seed bookmark %q: %w", name, err)
+		}
+		return bookmark.Seed, nil
+	}
+
+	seed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("seed must be a number or %s<bookmark>: %w", seedBookmarkPrefix, err)
+	}
+
+	return seed, nil
+}
+
+// validateSeedName normalizes a bookmark name, which is limited to lowercase letters, digits, dashes and underscores
+func validateSeedName(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if !seedNameRegex.MatchString(name) {
+		return "", errors.New("bookmark names can only contain letters, numbers, dashes and underscores, up to 32 characters")
+	}
+	return name, nil
+}
+
+func (q *SDQueue) saveSeed(s *discordgo.Session, i *discordgo.InteractionCreate, name string, seed int64) error {
+	name, err := validateSeedName(name)
+	if err != nil {
+		return handlers.ErrorEdit(s, i.Interaction, err.Error())
+	}
+
+	if seed < 0 {
+		return handlers.ErrorEdit(s, i.Interaction, "Only a fixed seed can be saved, not a random one.")
+	}
+
+	_, err = q.seedBookmarkRepo.Save(context.Background(), &entities.SeedBookmark{
+		MemberID: utils.GetUser(i.Interaction).ID,
+		Name:     name,
+		Seed:     seed,
+	})
+	if err != nil {
+		return handlers.ErrorEdit(s, i.Interaction, "Error saving seed.", err)
+	}
+
+	_, err = handlers.EditInteractionResponse(s, i.Interaction,
+		fmt.Sprintf("Saved seed `%d` as `%s`. Use it with `/%s seed:%s%s`", seed, name, ImagineCommand, seedBookmarkPrefix, name))
+	return err
+}
+
+func (q *SDQueue) processSeedCommand(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	if err := handlers.EphemeralThink(s, i); err != nil {
+		return err
+	}
+
+	data := i.ApplicationCommandData()
+	if len(data.Options) == 0 {
+		return handlers.ErrorEdit(s, i.Interaction, "You need to choose a subcommand.")
+	}
+
+	subcommand := data.Options[0]
+	optionMap := make(map[string]*discordgo.ApplicationCommandInteractionDataOption, len(subcommand.Options))
+	for _, opt := range subcommand.Options {
+		optionMap[opt.Name] = opt
+	}
+
+	user := utils.GetUser(i.Interaction)
+
+	switch "seed_" + subcommand.Name {
+	case seedSaveOption:
+		var seed int64 = -1
+		if option, ok := optionMap[seedValueOption]; ok {
+			seed = option.IntValue()
+		} else {
+			generations, err := q.imageGenerationRepo.GetByMemberID(context.Background(), user.ID, image_generations.ListOptions{Limit: 1})
+			if err != nil || len(generations) == 0 {
+				return handlers.ErrorEdit(s, i.Interaction, "You don't have a generation to take the seed from, provide a value instead.", err)
+			}
+			seed = generations[0].Seed
+		}
+		return q.saveSeed(s, i, optionMap[seedNameOption].StringValue(), seed)
+	case seedListOption:
+		bookmarks, err := q.seedBookmarkRepo.List(context.Background(), user.ID)
+		if err != nil {
+			return handlers.ErrorEdit(s, i.Interaction, "Error retrieving seeds.", err)
+		}
+		if len(bookmarks) == 0 {
+			_, err = handlers.EditInteractionResponse(s, i.Interaction, "You haven't saved any seeds yet.")
+			return err
+		}
+		var out strings.Builder
+		for _, bookmark := range bookmarks {
+			out.WriteString(fmt.Sprintf("`%s`: `%d`\n", bookmark.Name, bookmark.Seed))
+		}
+		_, err = handlers.EditInteractionResponse(s, i.Interaction, shortenTo(out.String(), 2000))
+		return err
+	case seedDeleteOption:
+		name := strings.ToLower(optionMap[seedNameOption].StringValue())
+		err := q.seedBookmarkRepo.Delete(context.Background(), user.ID, name)
+		var notFound *repositories.NotFoundError
+		if errors.As(err, &notFound) {
+			return handlers.ErrorEdit(s, i.Interaction, fmt.Sprintf("You don't have a seed named `%s`.", name))
+		}
+		if err != nil {
+			return handlers.ErrorEdit(s, i.Interaction, "Error deleting seed.", err)
+		}
+		_, err = handlers.EditInteractionResponse(s, i.Interaction, fmt.Sprintf("Deleted seed `%s`.", name))
+		return err
+	default:
+		return handlers.ErrorEdit(s, i.Interaction, fmt.Sprintf("Unknown subcommand: %s", subcommand.Name))
+	}
+}
+
+// processSaveSeedButton asks for a bookmark name for one of the images of the generation
+func (q *SDQueue) processSaveSeedButton(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	return handlers.Wrap(s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseModal,
+		Data: &discordgo.InteractionResponseData{
+			CustomID: SaveSeedModal,
+			Title:    "Save seed",
+			Components: []discordgo.MessageComponent{
+				components[SeedNameInput],
+				components[SeedImageInput],
+			},
+		},
+	}))
+}
+
+func (q *SDQueue) processSaveSeedModal(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	if err := handlers.EphemeralThink(s, i); err != nil {
+		return err
+	}
+
+	if i.Message == nil {
+		return handlers.ErrorEdit(s, i.Interaction, "Could not find the generation to save the seed from.")
+	}
+
+	modalData := getModalData(i.ModalSubmitData())
+
+	sortOrder := 1
+	if input, ok := modalData[SeedImageInput]; ok && input.Value != "" {
+		image, err := strconv.Atoi(strings.TrimSpace(input.Value))
+		if err != nil || image < 1 {
+			return handlers.ErrorEdit(s, i.Interaction, "The image number must be a positive number.")
+		}
+		sortOrder = image
+	}
+
+	generation, err := q.imageGenerationRepo.GetByMessageAndSort(context.Background(), i.Message.ID, sortOrder)
+	if err != nil {
+		log.Printf("Error getting generation %d of message %s: %v", sortOrder, i.Message.ID, err)
+		return handlers.ErrorEdit(s, i.Interaction, fmt.Sprintf("Could not find image %d of this generation.", sortOrder))
+	}
+
+	var name string
+	if input, ok := modalData[SeedNameInput]; ok {
+		name = input.Value
+	}
+
+	return q.saveSeed(s, i, name, generation.Seed)
+}
+
+func (q *SDQueue) processSeedAutocomplete(_ *discordgo.Session, i *discordgo.InteractionCreate) error {
+	data := i.ApplicationCommandData()
+	if len(data.Options) == 0 {
+		return nil
+	}
+
+	for _, opt := range data.Options[0].Options {
+		if opt.Focused && opt.Name == seedNameOption {
+			return q.autocompleteSeed(i, opt, "")
+		}
+	}
+
+	return nil
+}
+
+// autocompleteSeed suggests the member's bookmarks, keeping a numeric input as the first choice
+func (q *SDQueue) autocompleteSeed(i *discordgo.InteractionCreate, opt *discordgo.ApplicationCommandInteractionDataOption, prefix string) error {
+	input := strings.TrimPrefix(opt.StringValue(), seedBookmarkPrefix)
+
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	if _, err := strconv.ParseInt(input, 10, 64); err == nil {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: input, Value: input})
+	}
+
+	bookmarks, err := q.seedBookmarkRepo.List(context.Background(), utils.GetUser(i.Interaction).ID)
+	if err != nil {
+		log.Printf("Error retrieving seed bookmarks: %v", err)
+	}
+
+	names := make([]string, len(bookmarks))
+	for idx, bookmark := range bookmarks {
+		names[idx] = bookmark.Name
+	}
+
+	matches := make([]int, 0, len(bookmarks))
+	if input == "" {
+		for idx := range bookmarks {
+			matches = append(matches, idx)
+		}
+	} else {
+		for _, match := range fuzzy.Find(input, names) {
+			matches = append(matches, match.Index)
+		}
+	}
+
+	for _, idx := range matches[:min(len(matches), 25-len(choices))] {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+			Name:  fmt.Sprintf("%s (%d)", bookmarks[idx].Name, bookmarks[idx].Seed),
+			Value: prefix + bookmarks[idx].Name,
+		})
+	}
+
+	if len(choices) == 0 {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+			Name:  "Type a seed, or save one with /seed save to pick it here",
+			Value: "-1",
+		})
+	}
+
+	err = q.botSession.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{
+			Choices: choices[:min(25, len(choices))],
+		},
+	})
+	return handlers.Wrap(err)
+}
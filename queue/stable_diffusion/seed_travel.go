@@ -0,0 +1,148 @@
+package stable_diffusion
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+
+	"stable_diffusion_bot/discord_bot/handlers"
+	"stable_diffusion_bot/entities"
+	"stable_diffusion_bot/utils"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	defaultSeedTravelFrames = 8
+	minSeedTravelFrames     = 2
+)
+
+// seedTravel generates frames that blend from the seed of the item into its subseed, raising the subseed strength
+// from 0 to 1. The frames are posted as a batch, so they're tiled into a grid and can be animated.
+type seedTravel struct {
+	frames int
+}
+
+// seedTravelInference generates each frame with its own request, as a batch can't vary the subseed strength
+func (q *SDQueue) seedTravelInference(item *SDQueueItem) (*entities.TextToImageResponse, error) {
+	frames := item.seedTravel.frames
+	request := *item.TextToImageRequest
+	request.NIter, request.BatchSize = 1, 1
+
+	merged := new(entities.TextToImageResponse)
+	var seeds, subseeds []int64
+	for frame := range frames {
+		request.SubseedStrength = float64(frame) / float64(frames-1)
+		response, err := q.api(item).TextToImageRequest(item.Context(), &request)
+		if err != nil {
+			return nil, fmt.Errorf("error generating frame %d of %d: %w", frame+1, frames, err)
+		}
+		if len(response.Images) == 0 {
+			return nil, fmt.Errorf("frame %d of %d has no image", frame+1, frames)
+		}
+		if frame == 0 {
+			merged.Parameters, merged.Info, merged.RawInfo = response.Parameters, response.Info, response.RawInfo
+			merged.Info.Infotexts = nil
+		}
+
+		merged.Images = append(merged.Images, response.Images[0])
+		seeds = append(seeds, request.Seed)
+		subseeds = append(subseeds, request.Subseed)
+		if len(response.Info.Infotexts) > 0 {
+			merged.Info.Infotexts = append(merged.Info.Infotexts, response.Info.Infotexts[0])
+		}
+	}
+	merged.Seeds, merged.Subseeds = &seeds, &subseeds
+	return merged, nil
+}
+
+// randomSeed picks the seed the backend would for -1, so every frame of a seed travel uses the same one
+func randomSeed() int64 {
+	return rand.Int64N(1 << 32)
+}
+
+func (q *SDQueue) processSeedTravelCommand(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	if err := handlers.ThinkResponse(s, i); err != nil {
+		return err
+	}
+
+	optionMap := utils.GetOpts(i.ApplicationCommandData())
+	memberID := utils.GetUser(i.Interaction).ID
+
+	option, ok := optionMap[promptOption]
+	if !ok {
+		return handlers.ErrorEdit(s, i.Interaction, "You need to provide a prompt.")
+	}
+	item := q.NewItem(i.Interaction, WithPrompt(option.StringValue()))
+	item.Type = ItemTypeImagine
+
+	frames := defaultSeedTravelFrames
+	if option, ok := optionMap[seedTravelFramesOption]; ok {
+		frames = int(option.IntValue())
+	}
+	item.seedTravel = &seedTravel{frames: frames}
+	item.NIter, item.BatchSize = frames, 1
+
+	item.Seed, item.Subseed = randomSeed(), randomSeed()
+	for name, seed := range map[CommandOption]*int64{seedOption: &item.Seed, seedTravelToOption: &item.Subseed} {
+		option, ok := optionMap[name]
+		if !ok {
+			continue
+		}
+		value, err := q.resolveSeed(memberID, option.StringValue())
+		if err != nil {
+			return handlers.ErrorEdit(s, i.Interaction, "Invalid seed.", err)
+		}
+		if value >= 0 {
+			*seed = value
+		}
+	}
+
+	if option, ok := optionMap[negativeOption]; ok {
+		item.NegativePrompt = option.StringValue()
+	}
+	if option, ok := optionMap[samplerOption]; ok {
+		item.SamplerName = option.StringValue()
+	}
+	if option, ok := optionMap[stepOption]; ok {
+		item.Steps = int(option.IntValue())
+	}
+	if option, ok := optionMap[cfgScaleOption]; ok {
+		item.CFGScale = option.FloatValue()
+	}
+	if option, ok := optionMap[aspectRatio]; ok {
+		item.AspectRatio = option.StringValue()
+	}
+	if option, ok := optionMap[seedResizeWidthOption]; ok {
+		width := option.IntValue()
+		item.SeedResizeFromW = &width
+	}
+	if option, ok := optionMap[seedResizeHeightOption]; ok {
+		height := option.IntValue()
+		item.SeedResizeFromH = &height
+	}
+
+	position, err := q.Add(item)
+	var invalid *ValidationError
+	if errors.As(err, &invalid) {
+		return errorInvalid(s, i.Interaction, invalid)
+	}
+	if err != nil {
+		return handlers.ErrorEdit(s, i.Interaction, "Error adding seed travel to queue.", err)
+	}
+
+	message, err := handlers.EditInteractionResponse(s, i.Interaction,
+		fmt.Sprintf("I'm travelling from seed `%d` to `%d` in %d frames. %s\n<@%s> asked me to imagine \n```\n%s\n```",
+			item.Seed, item.Subseed, frames, linePosition(item, position), memberID, item.Prompt),
+		handlers.Components[handlers.Cancel],
+	)
+	if err != nil {
+		return err
+	}
+	if item.DiscordInteraction.Message == nil && message != nil {
+		log.Printf("Setting message ID for interaction %v", item.DiscordInteraction.ID)
+		item.DiscordInteraction.Message = message
+	}
+	return nil
+}
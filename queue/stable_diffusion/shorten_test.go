@@ -0,0 +1,24 @@
+package stable_diffusion
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func TestShortenToRuneBoundary(t *testing.T) {
+	for _, tt := range []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"short", 10, "short"},
+		{"abcdef", 3, "abc..."},
+		{"ab日本", 4, "ab..."},
+		{"日本語", 6, "日本..."},
+	} {
+		got := shortenTo(tt.s, tt.n)
+		if got != tt.want || !utf8.ValidString(got) {
+			t.Errorf("shortenTo(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package stable_diffusion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+
+	"stable_diffusion_bot/discord_bot/handlers"
+	"stable_diffusion_bot/entities"
+	"stable_diffusion_bot/repositories"
+)
+
+// Subcommands and options of /snippets
+const (
+	snippetsSetOption    = "snippets_set"
+	snippetsRemoveOption = "snippets_remove"
+	snippetsListOption   = "snippets_list"
+
+	snippetNameOption = "name"
+	snippetTextOption = "text"
+)
+
+var snippetNameRegex = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+func snippetsOptions() []*discordgo.ApplicationCommandOption {
+	nameOption := &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionString,
+		Name:        snippetNameOption,
+		Description: "Name of the snippet, used in prompts as {snippet:name}",
+		Required:    true,
+		MaxLength:   32,
+	}
+	return []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        strings.TrimPrefix(snippetsSetOption, "snippets_"),
+			Description: "Save a snippet for this server, it can use {user}, {date}, {random:a|b} and other snippets",
+			Options: []*discordgo.ApplicationCommandOption{
+				nameOption,
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        snippetTextOption,
+					Description: "Text the snippet expands to",
+					Required:    true,
+					MaxLength:   1000,
+				},
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        strings.TrimPrefix(snippetsRemoveOption, "snippets_"),
+			Description: "Remove a snippet of this server",
+			Options:     []*discordgo.ApplicationCommandOption{nameOption},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        strings.TrimPrefix(snippetsListOption, "snippets_"),
+			Description: "List the snippets of this server",
+		},
+	}
+}
+
+func (q *SDQueue) processSnippetsCommand(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	if err := handlers.EphemeralThink(s, i); err != nil {
+		return err
+	}
+
+	data := i.ApplicationCommandData()
+	if len(data.Options) == 0 {
+		return handlers.ErrorEdit(s, i.Interaction, "You need to choose a subcommand.")
+	}
+	if i.GuildID == "" || i.Member == nil {
+		return handlers.ErrorEdit(s, i.Interaction, "Snippets can only be used in a server.")
+	}
+
+	subcommand := data.Options[0]
+	optionMap := make(map[string]*discordgo.ApplicationCommandInteractionDataOption, len(subcommand.Options))
+	for _, opt := range subcommand.Options {
+		optionMap[opt.Name] = opt
+	}
+
+	option := "snippets_" + subcommand.Name
+	if option != snippetsListOption && i.Member.Permissions&discordgo.PermissionAdministrator == 0 {
+		return handlers.ErrorEdit(s, i.Interaction, "Only administrators can change the snippets of this server.")
+	}
+
+	var name string
+	if opt, ok := optionMap[snippetNameOption]; ok {
+		name = strings.ToLower(strings.TrimSpace(opt.StringValue()))
+	}
+
+	switch option {
+	case snippetsSetOption:
+		if !snippetNameRegex.MatchString(name) {
+			return handlers.ErrorEdit(s, i.Interaction, "Snippet names can only contain letters, numbers, dashes and underscores, up to 32 characters.")
+		}
+		_, err := q.promptSnippetRepo.Save(context.Background(), &entities.PromptSnippet{
+			GuildID: i.GuildID,
+			Name:    name,
+			Text:    strings.TrimSpace(optionMap[snippetTextOption].StringValue()),
+		})
+		if err != nil {
+			return handlers.ErrorEdit(s, i.Interaction, "Error saving snippet.", err)
+		}
+		_, err = handlers.EditInteractionResponse(s, i.Interaction,
+			fmt.Sprintf("Saved snippet `%s`. Use it in prompts with `{snippet:%s}`", name, name))
+		return err
+	case snippetsRemoveOption:
+		err := q.promptSnippetRepo.Delete(context.Background(), i.GuildID, name)
+		var notFound *repositories.NotFoundError
+		if errors.As(err, &notFound) {
+			return handlers.ErrorEdit(s, i.Interaction, fmt.Sprintf("This server doesn't have a snippet named `%s`.", name))
+		}
+		if err != nil {
+			return handlers.ErrorEdit(s, i.Interaction, "Error removing snippet.", err)
+		}
+		_, err = handlers.EditInteractionResponse(s, i.Interaction, fmt.Sprintf("Removed snippet `%s`.", name))
+		return err
+	case snippetsListOption:
+		snippets, err := q.promptSnippetRepo.List(context.Background(), i.GuildID)
+		if err != nil {
+			return handlers.ErrorEdit(s, i.Interaction, "Error retrieving snippets.", err)
+		}
+		if len(snippets) == 0 {
+			_, err = handlers.EditInteractionResponse(s, i.Interaction, "This server doesn't have any snippets yet.")
+			return err
+		}
+		var out strings.Builder
+		for _, snippet := range snippets {
+			out.WriteString(fmt.Sprintf("`{snippet:%s}`: %s\n", snippet.Name, snippet.Text))
+		}
+		_, err = handlers.EditInteractionResponse(s, i.Interaction, shortenTo(out.String(), 2000))
+		return err
+	default:
+		return handlers.ErrorEdit(s, i.Interaction, fmt.Sprintf("Unknown subcommand: %s", subcommand.Name))
+	}
+}
@@ -0,0 +1,70 @@
+package stable_diffusion
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"stable_diffusion_bot/discord_bot/handlers"
+	"stable_diffusion_bot/queue"
+)
+
+// Subcommands of /status
+const statusQueuesOption = "queues"
+
+func statusOptions() []*discordgo.ApplicationCommandOption {
+	return []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        statusQueuesOption,
+			Description: "Show what the Stable Diffusion and NovelAI queues are generating and how long they take",
+		},
+	}
+}
+
+func (q *SDQueue) processStatusCommand(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	data := i.ApplicationCommandData()
+	if len(data.Options) == 0 || data.Options[0].Name != statusQueuesOption {
+		return handlers.ErrorEphemeral(s, i.Interaction, "You need to choose a subcommand.")
+	}
+
+	summaries := []queue.Summary{q.Summary()}
+	if q.novelAIQueue != nil {
+		summaries = append(summaries, q.novelAIQueue.Summary())
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:     "Queues",
+		Timestamp: time.Now().Format(time.RFC3339),
+	}
+	for _, summary := range summaries {
+		embed.Fields = append(embed.Fields, summaryField(summary))
+	}
+
+	return handlers.Wrap(s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags:  discordgo.MessageFlagsEphemeral,
+			Embeds: []*discordgo.MessageEmbed{embed},
+		},
+	}))
+}
+
+// summaryField shows the current item, depth and average wait of a queue
+func summaryField(summary queue.Summary) *discordgo.MessageEmbedField {
+	current := "Idle"
+	if summary.Current != nil {
+		current = fmt.Sprintf("%s for %s", summary.Current.Mention(), time.Since(summary.Started).Round(time.Second))
+	}
+
+	name := summary.Name
+	if summary.Paused {
+		name += " (paused)"
+	}
+	return &discordgo.MessageEmbedField{
+		Name:   name,
+		Value:  fmt.Sprintf("**Current**: %s\n**Waiting**: `%d`\n**Average wait**: %s", current, summary.Depth, summary.AverageWait.Round(time.Second)),
+		Inline: true,
+	}
+}
@@ -4,15 +4,21 @@ import (
 	"bytes"
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"image"
+	"image/png"
 	"io"
 	"log"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
 
 	"stable_diffusion_bot/api/stable_diffusion_api"
+	"stable_diffusion_bot/audit"
+	"stable_diffusion_bot/composite_renderer"
 	"stable_diffusion_bot/discord_bot/handlers"
 	"stable_diffusion_bot/entities"
 	"stable_diffusion_bot/utils"
@@ -21,33 +27,49 @@ import (
 func (q *SDQueue) processImagineGrid(queue *SDQueueItem) error {
 	request := queue.ImageGenerationRequest
 	textToImage := request.TextToImageRequest
+	if q.isDryRun(queue) {
+		return q.postDryRun(queue)
+	}
+
+	queue.timings = newTimings(queue.queued)
+	defer queue.timings.log(queue)
+
+	switchStart := time.Now()
 	config, originalConfig, err := q.switchToModels(queue)
 	if err != nil {
 		return fmt.Errorf("error switching to models: %w", err)
 	}
+	queue.timings.since(phaseModelSwitch, switchStart)
 
-	log.Printf("Processing imagine #%s: %v\n", queue.DiscordInteraction.ID, textToImage.Prompt)
+	queue.logs.Printf("Processing imagine #%s: %v\n", queue.DiscordInteraction.ID, textToImage.Prompt)
 
 	embed, webhook, err := showInitialMessage(queue, q)
 	if err != nil {
 		return err
 	}
 
-	request, err = q.recordToRepository(request, err)
-	if err != nil {
-		return fmt.Errorf("error recording to repository: %w", err)
+	if !queue.recorded {
+		request, err = q.recordToRepository(request, err)
+		if err != nil {
+			return fmt.Errorf("error recording to repository: %w", err)
+		}
+		queue.recorded = true
 	}
 
 	generationDone := make(chan bool, 1)
 	defer close(generationDone)
 
+	queue.timelapse = new(timelapse)
 	go q.updateProgressBar(queue, generationDone, webhook)
 
+	start := time.Now()
 	switch queue.Type {
 	case ItemTypeImagine, ItemTypeReroll, ItemTypeVariation, ItemTypeRaw:
 		response, err := q.textInference(queue)
 		generationDone <- true
+		queue.timings.since(phaseInference, start)
 		if err != nil {
+			q.revertInterrupted(queue, err, config, originalConfig)
 			return fmt.Errorf("error inferencing generation: %w", err)
 		}
 
@@ -56,27 +78,35 @@ func (q *SDQueue) processImagineGrid(queue *SDQueueItem) error {
 		}
 
 		q.recordSeeds(response, request, config)
+		q.recordUsage(queue, len(response.Images), time.Since(start))
 
 		err = q.showFinalMessage(queue, response, embed, webhook)
 		if err != nil {
 			return err
 		}
 	case ItemTypeImg2Img:
-		images, err := q.imageToImage()
+		images, err := q.imageToImage(queue)
 		generationDone <- true
+		queue.timings.since(phaseInference, start)
 		if err != nil {
+			q.revertInterrupted(queue, err, config, originalConfig)
 			return err
 		}
 
+		q.recordUsage(queue, len(images), time.Since(start))
+
 		err = q.showFinalMessage(queue, &entities.TextToImageResponse{Images: images}, embed, webhook)
 		if err != nil {
 			return err
 		}
+		if queue.refine != nil {
+			q.recordRefineStep(queue)
+		}
 	default:
 		return fmt.Errorf("unknown queue type: %v", queue.Type)
 	}
 
-	err = q.revertModels(config, originalConfig)
+	err = q.revertModels(queue, config, originalConfig)
 	if err != nil {
 		return handlers.ErrorFollowupEphemeral(q.botSession, queue.DiscordInteraction, fmt.Sprintf("Error reverting models: %v", err))
 	}
@@ -127,6 +157,8 @@ func (q *SDQueue) storeMessageInteraction(queue *SDQueueItem, message *discordgo
 	queue.DiscordInteraction.Message = message
 
 	request.InteractionID = queue.DiscordInteraction.ID
+	request.GuildID = queue.DiscordInteraction.GuildID
+	request.ChannelID = queue.DiscordInteraction.ChannelID
 	request.MessageID = queue.DiscordInteraction.Message.ID
 	request.MemberID = utils.GetUser(queue.DiscordInteraction).ID
 	request.SortOrder = 0
@@ -137,42 +169,232 @@ func (q *SDQueue) storeMessageInteraction(queue *SDQueueItem, message *discordgo
 func (q *SDQueue) showFinalMessage(queue *SDQueueItem, response *entities.TextToImageResponse, embed *discordgo.MessageEmbed, webhook *discordgo.WebhookEdit) error {
 	request := queue.ImageGenerationRequest
 	totalImages := totalImageCount(request)
+	settings := q.settings()
 
+	start := time.Now()
 	imageBuffers, thumbnailBuffers := retrieveImagesFromResponse(response, queue)
+	start = queue.timings.since(phaseDecode, start)
 
 	mention := fmt.Sprintf("<@%v>", utils.GetUser(queue.DiscordInteraction).ID)
 	// get new embed from generationEmbedDetails as q.imageGenerationRepo.Create has filled in newGeneration.CreatedAt and interrupted
 	embed = generationEmbedDetails(embed, queue, queue.Interrupt != nil)
 
+	// End the timelapse on the finished image
+	hasTimelapse := queue.timelapse.len() > 0 && len(response.Images) > 0
+	if hasTimelapse {
+		queue.timelapse.add(&response.Images[0])
+	}
+
+	amount := min(len(imageBuffers), totalImages)
+	imageBuffers = q.applyWatermark(request.GuildID, imageBuffers[:amount])
+	var parameters []string
+	if q.shouldStripMetadata(request.GuildID, request.MemberID) {
+		imageBuffers = stripMetadata(imageBuffers)
+		thumbnailBuffers = stripMetadata(thumbnailBuffers)
+	} else {
+		imageBuffers = q.withParameters(imageBuffers, response.Info.Infotexts)
+		parameters = response.Info.Infotexts
+	}
+
+	// Keep the full resolution images to send on request when the message only shows previews,
+	// and the images of a batch to animate them
+	var originals [][]byte
+	if settings.previewSize > 0 || amount > 1 {
+		originals, imageBuffers = readOriginals(imageBuffers)
+	}
+	hasFullRes := settings.previewSize > 0 && len(originals) > 0
+	hasBatch := len(originals) > 1
+	// img2img and debug generations can't be made again from their parameters alone
+	tryOnNovelAI := q.novelAIQueue != nil && queue.Type != ItemTypeImg2Img && (queue.Raw == nil || !queue.Raw.Debug)
+
 	webhook = &discordgo.WebhookEdit{
 		Content:    &mention,
-		Components: rerollVariationComponents(min(len(imageBuffers), totalImages), queue.Type == ItemTypeImg2Img || (queue.Raw != nil && queue.Raw.Debug)),
+		Components: rerollVariationComponents(amount, queue.Type == ItemTypeImg2Img || (queue.Raw != nil && queue.Raw.Debug), hasTimelapse, hasFullRes, hasBatch, tryOnNovelAI),
+	}
+	if queue.Raw == nil || !queue.Raw.Debug {
+		*webhook.Components = append(*webhook.Components, refineComponents(queue.refine != nil))
 	}
 
-	if err := utils.EmbedImages(webhook, embed, imageBuffers[:min(len(imageBuffers), totalImages)], thumbnailBuffers, q.compositor); err != nil {
+	if err := utils.EmbedImagesWithOptions(webhook, embed, imageBuffers, thumbnailBuffers, settings.compositor, utils.EmbedOptions{
+		Labels:      q.gridLabelOptions(response, len(imageBuffers)),
+		UploadLimit: utils.UploadLimit(q.botSession, request.GuildID),
+		PreviewSize: settings.previewSize,
+		Archive:     settings.archiveGrids,
+		ImageNames:  seedNames(response, len(imageBuffers)),
+		Individual:  q.postIndividually(request.GuildID, request.MemberID),
+		Parameters:  parameters,
+	}); err != nil {
 		return fmt.Errorf("error creating image embed: %w", err)
 	}
+	start = queue.timings.since(phaseCompositing, start)
+	if settings.timingFooter {
+		appendTimings(embed, queue.timings)
+	}
 
-	_, err := handlers.EditInteractionResponse(q.botSession, queue.DiscordInteraction, webhook)
-	return err
+	message, err := handlers.EditInteractionResponse(q.botSession, queue.DiscordInteraction, webhook)
+	if err != nil {
+		return err
+	}
+	queue.timings.since(phaseUpload, start)
+
+	if hasTimelapse {
+		q.timelapses.store(message.ID, queue.timelapse)
+	}
+	if hasFullRes {
+		q.fullRes.store(message.ID, originals)
+	}
+	if hasBatch {
+		q.batches.store(message.ID, originals)
+	}
+	q.sendPromptWarnings(queue)
+	return nil
+}
+
+// seedNames names n images by their position and seed, e.g. 1-seed-1234
+func seedNames(response *entities.TextToImageResponse, n int) []string {
+	names := make([]string, n)
+	for i := range names {
+		names[i] = strconv.Itoa(i + 1)
+		if response.Seeds != nil && i < len(*response.Seeds) {
+			names[i] = fmt.Sprintf("%d-seed-%d", i+1, (*response.Seeds)[i])
+		}
+	}
+	return names
+}
+
+// GridLabelMode selects the label drawn on each tile of a grid
+type GridLabelMode string
+
+const (
+	GridLabelNone  GridLabelMode = ""
+	GridLabelIndex GridLabelMode = "index"
+	GridLabelSeed  GridLabelMode = "seed"
+	GridLabelModel GridLabelMode = "model"
+)
+
+// gridLabelOptions returns the labels for n tiled images, or nil if grid labels are disabled.
+func (q *SDQueue) gridLabelOptions(response *entities.TextToImageResponse, n int) *composite_renderer.LabelOptions {
+	settings := q.settings()
+	if settings.gridLabels == GridLabelNone {
+		return nil
+	}
+
+	opts := settings.gridLabelStyle
+	opts.Labels = composite_renderer.IndexLabels(n)
+	for i := range opts.Labels {
+		switch settings.gridLabels {
+		case GridLabelSeed:
+			if response.Seeds != nil && i < len(*response.Seeds) {
+				opts.Labels[i] = fmt.Sprintf("#%d %d", i+1, (*response.Seeds)[i])
+			}
+		case GridLabelModel:
+			if response.Info.SDModelName != nil {
+				opts.Labels[i] = fmt.Sprintf("#%d %s", i+1, *response.Info.SDModelName)
+			}
+		}
+	}
+
+	return &opts
 }
 
 func (q *SDQueue) recordSeeds(response *entities.TextToImageResponse, request *entities.ImageGenerationRequest, config *entities.Config) {
 	log.Printf("Seeds: %v Subseeds:%v", response.Seeds, response.Subseeds)
+	if response.Seeds == nil || response.Subseeds == nil {
+		return
+	}
+
+	extraNetworks := response.Info.ExtraNetworks()
+	checkpointSHA256 := lookupCheckpointSHA256(response.Info.SDModelName, response.Info.SDModelHash)
+
+	generations := make([]*entities.ImageGenerationRequest, 0, len(*response.Seeds))
 	for idx := range *response.Seeds {
-		subGeneration := request
+		textToImage := *request.TextToImageRequest
+		subGeneration := &entities.ImageGenerationRequest{
+			GenerationInfo:     request.GenerationInfo,
+			TextToImageRequest: &textToImage,
+		}
 		subGeneration.SortOrder = idx + 1
 		subGeneration.Seed = (*response.Seeds)[idx]
-		subGeneration.Subseed = (*response.Subseeds)[idx]
+		if idx < len(*response.Subseeds) {
+			subGeneration.Subseed = (*response.Subseeds)[idx]
+		}
 		subGeneration.Checkpoint = response.Info.SDModelName
 		subGeneration.VAE = response.Info.SDVaeName
 		subGeneration.Hypernetwork = config.SDHypernetwork
+		subGeneration.CheckpointHash = response.Info.SDModelHash
+		subGeneration.CheckpointSHA256 = checkpointSHA256
+		subGeneration.VAEHash = response.Info.SDVaeHash
+		subGeneration.ExtraNetworks = extraNetworks
+		if idx > 0 {
+			// the raw request is shared by the whole batch, only keep it on the first image
+			subGeneration.RawRequest = nil
+			subGeneration.RawInfo = nil
+		}
+
+		generations = append(generations, subGeneration)
+	}
+
+	_, err := q.imageGenerationRepo.CreateBatch(context.Background(), generations)
+	if err != nil {
+		log.Printf("Error creating image generation records: %v\n", err)
+		return
+	}
+
+	// the embed reads from the original request, keep it in sync with the last sub-generation
+	if len(generations) > 0 {
+		last := generations[len(generations)-1]
+		request.GenerationInfo = last.GenerationInfo
+		request.Seed = last.Seed
+		request.Subseed = last.Subseed
+	}
+}
+
+// recordUsage adds the generation to the member's daily usage ledger
+func (q *SDQueue) recordUsage(queue *SDQueueItem, images int, elapsed time.Duration) {
+	request := queue.ImageGenerationRequest
+	images = min(images, totalImageCount(request))
+
+	// hr_scale-only requests leave HrResizeX and HrResizeY at 0
+	width, height := outputSize(queue)
+
+	user := utils.GetUser(queue.DiscordInteraction)
+	if user == nil {
+		return
+	}
+
+	err := q.usageRepo.Record(context.Background(), &entities.Usage{
+		MemberID:   user.ID,
+		Backend:    entities.BackendStableDiffusion,
+		Images:     images,
+		Megapixels: float64(width*height*images) / 1_000_000,
+		GPUSeconds: elapsed.Seconds(),
+	})
+	if err != nil {
+		queue.logs.Printf("Error recording usage: %v", err)
+	}
 
-		_, createErr := q.imageGenerationRepo.Create(context.Background(), subGeneration)
-		if createErr != nil {
-			log.Printf("Error creating image generation record: %v\n", createErr)
+	q.recordLoraUses(user.ID, queue.loras)
+}
+
+// lookupCheckpointSHA256 finds the full SHA256 of the checkpoint from the cache, as the response only includes the short hash
+func lookupCheckpointSHA256(name, hash *string) *string {
+	if stable_diffusion_api.CheckpointCache == nil {
+		return nil
+	}
+
+	for _, model := range *stable_diffusion_api.CheckpointCache {
+		if model.Sha256 == nil {
+			continue
+		}
+		if hash != nil && model.Hash != nil && *model.Hash == *hash {
+			return model.Sha256
+		}
+		if name != nil && model.ModelName == *name {
+			return model.Sha256
 		}
 	}
+
+	return nil
 }
 
 func totalImageCount(request *entities.ImageGenerationRequest) int {
@@ -192,19 +414,24 @@ func totalImageCount(request *entities.ImageGenerationRequest) int {
 func retrieveImagesFromResponse(response *entities.TextToImageResponse, item *SDQueueItem) (images, thumbnails []io.Reader) {
 	images = make([]io.Reader, len(response.Images))
 
-	for idx, image := range response.Images {
-		decodedImage, decodeErr := base64.StdEncoding.DecodeString(image)
+	_ = utils.ForEach(len(response.Images), func(idx int) error {
+		decodedImage, decodeErr := base64.StdEncoding.DecodeString(response.Images[idx])
 		if decodeErr != nil {
-			log.Printf("Error decoding image: %v\n", decodeErr)
+			item.logs.Printf("Error decoding image: %v\n", decodeErr)
 		}
 
 		images[idx] = bytes.NewBuffer(decodedImage)
-	}
+		return nil
+	})
 
 	if image := item.ControlnetItem.Image; image != nil {
 		thumbnails = append(thumbnails, image)
 	}
 
+	for _, image := range item.references {
+		thumbnails = append(thumbnails, image)
+	}
+
 	if image := item.Img2ImgItem.Image; image != nil {
 		thumbnails = append(thumbnails, image)
 	}
@@ -212,32 +439,101 @@ func retrieveImagesFromResponse(response *entities.TextToImageResponse, item *SD
 	generation := item.ImageGenerationRequest
 	totalImages := totalImageCount(generation)
 	if len(images) > totalImages {
-		log.Printf("received extra images: len(imageBufs): %v, controlnet: %v", len(images), item.ControlnetItem.Enabled)
+		item.logs.Printf("received extra images: len(imageBufs): %v, controlnet: %v", len(images), item.ControlnetItem.Enabled)
 		thumbnails = append(thumbnails, images[totalImages:]...)
 	}
 
 	return images, thumbnails
 }
 
+// withParameters writes each infotext into the parameters text chunk of the image with the same index,
+// so the images can be read by the WebUI's PNG Info tab. Images that aren't PNGs are kept as is. This covers the
+// full resolution images and archives, attachments are given theirs again once tiled, see EmbedOptions.Parameters.
+func (q *SDQueue) withParameters(images []io.Reader, infotexts []string) []io.Reader {
+	for i, img := range images {
+		if img == nil || i >= len(infotexts) || infotexts[i] == "" {
+			continue
+		}
+
+		data, err := io.ReadAll(img)
+		if err != nil {
+			log.Printf("Error reading image %d for png info: %v", i, err)
+		}
+
+		if q.settings().stealthPNGInfo {
+			data = withStealthInfo(data, infotexts[i])
+		}
+
+		withInfo, err := composite_renderer.SetTextChunk(data, composite_renderer.ParametersKey, infotexts[i])
+		if err != nil {
+			log.Printf("Error writing png info to image %d: %v", i, err)
+			images[i] = bytes.NewReader(data)
+			continue
+		}
+		images[i] = bytes.NewReader(withInfo)
+	}
+
+	return images
+}
+
+// withStealthInfo hides info in the alpha channel of the PNG in data, returning data as is on failure
+func withStealthInfo(data []byte, info string) []byte {
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil || format != "png" {
+		return data
+	}
+
+	stealth, err := utils.EncodeStealthInfo(img, info)
+	if err != nil {
+		log.Printf("Error writing stealth png info: %v", err)
+		return data
+	}
+
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, stealth); err != nil {
+		log.Printf("Error encoding stealth png info: %v", err)
+		return data
+	}
+	return buf.Bytes()
+}
+
 func (q *SDQueue) textInference(queue *SDQueueItem) (response *entities.TextToImageResponse, err error) {
 	generation := queue.ImageGenerationRequest
 	switch queue.Type {
 	case ItemTypeRaw:
-		if q.currentImagine.Raw.Unsafe {
-			response, err = q.stableDiffusionAPI.TextToImageRaw(q.currentImagine.Raw.Blob)
-		} else {
-			marshal, marshalErr := q.currentImagine.Raw.Marshal()
-			if marshalErr != nil {
-				return nil, fmt.Errorf("error marshalling raw: %w", marshalErr)
-			}
-			response, err = q.stableDiffusionAPI.TextToImageRaw(marshal)
+		var payload []byte
+		payload, err = rawPayload(queue.Raw)
+		if err != nil {
+			return nil, err
 		}
+		response, err = q.api(queue).TextToImageRaw(queue.Context(), payload)
+		if err != nil {
+			return nil, err
+		}
+		rawRequest := string(payload)
+		generation.RawRequest = &rawRequest
+		generation.RawInfo = &response.RawInfo
 	default:
-		response, err = q.stableDiffusionAPI.TextToImageRequest(generation.TextToImageRequest)
+		if queue.seedTravel != nil {
+			return q.seedTravelInference(queue)
+		}
+		response, err = q.api(queue).TextToImageRequest(queue.Context(), generation.TextToImageRequest)
 	}
 	return response, err
 }
 
+// rawPayload returns the exact JSON that is sent to the API for a raw request
+func rawPayload(raw *entities.TextToImageRaw) ([]byte, error) {
+	if raw.Unsafe {
+		return raw.Blob, nil
+	}
+	marshal, err := raw.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling raw: %w", err)
+	}
+	return marshal, nil
+}
+
 func (q *SDQueue) recordToRepository(request *entities.ImageGenerationRequest, err error) (*entities.ImageGenerationRequest, error) {
 	var ok bool
 	if request.Prompt, ok = strings.CutSuffix(request.Prompt, "{DEBUG}"); ok {
@@ -257,6 +553,8 @@ func (q *SDQueue) recordToRepository(request *entities.ImageGenerationRequest, e
 func (q *SDQueue) updateProgressBar(item *SDQueueItem, generationDone chan bool, webhook *discordgo.WebhookEdit) {
 	request := item.ImageGenerationRequest
 	timeout := time.NewTimer(5 * time.Minute)
+	// backendMemory is cleared after the first error so backends without /sdapi/v1/memory don't log every second
+	backendMemory := true
 	for {
 		select {
 		case <-generationDone:
@@ -265,7 +563,8 @@ func (q *SDQueue) updateProgressBar(item *SDQueueItem, generationDone chan bool,
 			if !ok {
 				return
 			}
-			err := q.stableDiffusionAPI.Interrupt()
+			err := q.api(item).Interrupt()
+			item.abort()
 			if err != nil {
 				_ = handlers.ErrorEdit(q.botSession, item.DiscordInteraction, fmt.Sprintf("Error interrupting: %v", err))
 				return
@@ -275,14 +574,17 @@ func (q *SDQueue) updateProgressBar(item *SDQueueItem, generationDone chan bool,
 				return
 			}
 			if item.DiscordInteraction.Message == nil && message != nil {
-				log.Printf("Setting item.DiscordInteraction.Message to message from EditInteractionResponse: %v", message)
+				item.logs.Printf("Setting item.DiscordInteraction.Message to message from EditInteractionResponse: %v", message)
 				item.DiscordInteraction.Message = message
 			}
 			return
 		case <-time.After(1 * time.Second):
-			progress, progressErr := q.stableDiffusionAPI.GetCurrentProgress()
+			progress, progressErr := q.api(item).GetCurrentProgress(item.Context())
+			if errors.Is(progressErr, context.Canceled) {
+				return
+			}
 			if progressErr != nil {
-				log.Printf("Error getting current progress: %v", progressErr)
+				item.logs.Printf("Error getting current progress: %v", progressErr)
 				_ = handlers.ErrorEdit(q.botSession, item.DiscordInteraction, fmt.Sprintf("Error getting current progress: %v", progressErr))
 				return
 			}
@@ -291,42 +593,54 @@ func (q *SDQueue) updateProgressBar(item *SDQueueItem, generationDone chan bool,
 				continue
 			}
 
+			item.timelapse.add(progress.CurrentImage)
+
 			var ram, cuda *entities.ReadableMemory
-			mem, err := q.stableDiffusionAPI.GetMemory()
-			if err != nil {
-				log.Printf("Error getting memory: %v", err)
-			} else {
-				ram = mem.RAM.Readable()
-				cuda = mem.Cuda.Readable()
+			if backendMemory {
+				mem, err := q.api(item).GetMemory(item.Context())
+				if err != nil {
+					item.logs.Printf("Error getting memory, not showing the memory of the backend for this generation: %v", err)
+					backendMemory = false
+				} else {
+					ram = mem.RAM.Readable()
+					cuda = mem.Cuda.Readable()
+				}
 			}
 
-			mem, err = stable_diffusion_api.GetMemory()
+			mem, err := stable_diffusion_api.GetMemory()
 			if err != nil {
-				log.Printf("Error getting memory: %v", err)
-			} else {
-				ram = mem.RAM.Readable()
+				item.logs.Printf("Error getting memory: %v", err)
+			} else if local := mem.RAM.Readable(); local != nil {
+				ram = local
 			}
 
 			progressContent := imagineMessageSimple(request, utils.GetUser(item.DiscordInteraction), progress.Progress, ram, cuda)
 
-			// TODO: Use handlers.Responses[handlers.EditInteractionResponse] instead and adjust to return errors
-			_, progressErr = q.botSession.InteractionResponseEdit(item.DiscordInteraction, &discordgo.WebhookEdit{
-				Content: &progressContent,
-			})
+			progressErr = handlers.EditProgress(q.botSession, item.DiscordInteraction, progressContent)
 			if progressErr != nil {
-				log.Printf("Error editing interaction: %v", progressErr)
+				item.logs.Printf("Error editing interaction: %v", progressErr)
 				return
 			}
 		case <-timeout.C:
-			log.Printf("Timeout reached")
+			item.logs.Printf("Timeout reached")
 			_ = handlers.ErrorEdit(q.botSession, item.DiscordInteraction, "Timeout reached")
 			return
 		}
 	}
 }
 
+// revertInterrupted switches back to the original models when err is from an interrupt, which otherwise skips it
+func (q *SDQueue) revertInterrupted(item *SDQueueItem, err error, config, originalConfig *entities.Config) {
+	if !errors.Is(err, context.Canceled) {
+		return
+	}
+	if err := q.revertModels(item, config, originalConfig); err != nil {
+		item.logs.Printf("Error reverting models after interrupt: %v", err)
+	}
+}
+
 func (q *SDQueue) switchToModels(queue *SDQueueItem) (config, originalConfig *entities.Config, err error) {
-	config, err = q.stableDiffusionAPI.GetConfig()
+	config, err = q.api(queue).GetConfig()
 	originalConfig = config
 	if err != nil {
 		return nil, nil, fmt.Errorf("error getting config: %w", err)
@@ -340,16 +654,16 @@ func (q *SDQueue) switchToModels(queue *SDQueueItem) (config, originalConfig *en
 	return config, originalConfig, nil
 }
 
-func (q *SDQueue) revertModels(config *entities.Config, originalConfig *entities.Config) error {
+func (q *SDQueue) revertModels(item *SDQueueItem, config *entities.Config, originalConfig *entities.Config) error {
 	if !ptrStringCompare(config.SDModelCheckpoint, originalConfig.SDModelCheckpoint) ||
 		!ptrStringCompare(config.SDVae, originalConfig.SDVae) ||
 		!ptrStringCompare(config.SDHypernetwork, originalConfig.SDHypernetwork) {
-		log.Printf("Switching back to original models: %v, %v, %v",
+		item.logs.Printf("Switching back to original models: %v, %v, %v",
 			safeDereference(originalConfig.SDModelCheckpoint),
 			safeDereference(originalConfig.SDVae),
 			safeDereference(originalConfig.SDHypernetwork),
 		)
-		return q.stableDiffusionAPI.UpdateConfiguration(entities.Config{
+		return q.api(item).UpdateConfiguration(entities.Config{
 			SDModelCheckpoint: originalConfig.SDModelCheckpoint,
 			SDVae:             originalConfig.SDVae,
 			SDHypernetwork:    originalConfig.SDHypernetwork,
@@ -375,7 +689,7 @@ func (q *SDQueue) updateModels(c *SDQueueItem, config *entities.Config) (*entiti
 		}
 
 		// Insert code to update the configuration here
-		err = q.stableDiffusionAPI.UpdateConfiguration(
+		err = q.api(c).UpdateConfiguration(
 			q.lookupModel(request, config,
 				[]stable_diffusion_api.Cacheable{
 					stable_diffusion_api.CheckpointCache,
@@ -385,13 +699,49 @@ func (q *SDQueue) updateModels(c *SDQueueItem, config *entities.Config) (*entiti
 		if err != nil {
 			return nil, fmt.Errorf("error updating configuration: %w", err)
 		}
-		config, err = q.stableDiffusionAPI.GetConfig()
+		previous := config
+		config, err = q.api(c).GetConfig()
 		if err != nil {
 			return nil, fmt.Errorf("error getting config: %w", err)
 		}
+		q.auditModelSwitch(c, previous, config)
 		request.Checkpoint = config.SDModelCheckpoint
 		request.VAE = config.SDVae
 		request.Hypernetwork = config.SDHypernetwork
 	}
 	return config, nil
 }
+
+// auditModelSwitch posts the models a generation switched to, each as a field with the model it replaced
+func (q *SDQueue) auditModelSwitch(item *SDQueueItem, previous, config *entities.Config) {
+	var fields []*discordgo.MessageEmbedField
+	for _, model := range []struct {
+		name          string
+		before, after *string
+	}{
+		{"Checkpoint", previous.SDModelCheckpoint, config.SDModelCheckpoint},
+		{"VAE", previous.SDVae, config.SDVae},
+		{"Hypernetwork", previous.SDHypernetwork, config.SDHypernetwork},
+	} {
+		if !ptrStringCompare(model.before, model.after) {
+			fields = append(fields, &discordgo.MessageEmbedField{
+				Name:  model.name,
+				Value: fmt.Sprintf("`%v` -> `%v`", safeDereference(model.before), safeDereference(model.after)),
+			})
+		}
+	}
+	if len(fields) == 0 {
+		return
+	}
+
+	event := audit.Event{
+		Kind:        audit.ModelSwitched,
+		Description: fmt.Sprintf("Switched models on %s for a generation", q.api(item).Host()),
+		GuildID:     item.DiscordInteraction.GuildID,
+		Fields:      fields,
+	}
+	if user := utils.GetUser(item.DiscordInteraction); user != nil {
+		event.UserID = user.ID
+	}
+	audit.Post(event)
+}
@@ -0,0 +1,111 @@
+package stable_diffusion
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"log"
+	"sync"
+
+	"stable_diffusion_bot/composite_renderer"
+	"stable_diffusion_bot/discord_bot/handlers"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// maxTimelapseFrames caps the preview frames kept per generation, every other frame is dropped when reached
+	maxTimelapseFrames = 64
+	// maxTimelapses is how many recent generations keep their frames in memory
+	maxTimelapses = 32
+)
+
+// timelapse collects the live preview frames of a generation
+type timelapse struct {
+	mu     sync.Mutex
+	frames [][]byte
+	last   string
+}
+
+// add decodes a base64 preview and appends it if it differs from the previous one
+func (t *timelapse) add(preview *string) {
+	if t == nil || preview == nil || *preview == "" {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if *preview == t.last {
+		return
+	}
+
+	frame, err := base64.StdEncoding.DecodeString(*preview)
+	if err != nil {
+		log.Printf("Error decoding preview frame: %v", err)
+		return
+	}
+	t.last = *preview
+
+	if len(t.frames) >= maxTimelapseFrames {
+		for i := range len(t.frames) / 2 {
+			t.frames[i] = t.frames[i*2+1]
+		}
+		t.frames = t.frames[:len(t.frames)/2]
+	}
+	t.frames = append(t.frames, frame)
+}
+
+func (t *timelapse) readers() []io.Reader {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	readers := make([]io.Reader, len(t.frames))
+	for i, frame := range t.frames {
+		readers[i] = bytes.NewReader(frame)
+	}
+	return readers
+}
+
+func (t *timelapse) len() int {
+	if t == nil {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.frames)
+}
+
+// processTimelapseButton renders the preview frames of the generation into a WebM, or a GIF if ffmpeg isn't installed
+func (q *SDQueue) processTimelapseButton(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	if err := handlers.EphemeralThink(s, i); err != nil {
+		return err
+	}
+
+	if i.Message == nil {
+		return handlers.ErrorEdit(s, i.Interaction, "Could not find the generation to show the timelapse of.")
+	}
+
+	t, ok := q.timelapses.get(i.Message.ID)
+	if !ok || t.len() < 2 {
+		return handlers.ErrorEdit(s, i.Interaction, "No timelapse is available. Previews are only kept for recent generations while the bot is running.")
+	}
+
+	file := &discordgo.File{Name: "timelapse.webm", ContentType: "video/webm"}
+	animation, err := composite_renderer.AnimateWebM(context.Background(), t.readers(), composite_renderer.AnimateOptions{})
+	if err != nil {
+		log.Printf("Falling back to a GIF timelapse: %v", err)
+		file = &discordgo.File{Name: "timelapse.gif", ContentType: "image/gif"}
+		animation, err = composite_renderer.Animate(t.readers(), composite_renderer.AnimateOptions{})
+		if err != nil {
+			return handlers.ErrorEdit(s, i.Interaction, "Error rendering timelapse.", err)
+		}
+	}
+	file.Reader = animation
+
+	_, err = handlers.EditInteractionResponse(s, i.Interaction, &discordgo.WebhookEdit{
+		Files: []*discordgo.File{file},
+	})
+	return err
+}
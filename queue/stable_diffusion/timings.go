@@ -0,0 +1,98 @@
+package stable_diffusion
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Phases of a generation, in the order they happen
+const (
+	phaseQueueWait   = "queue wait"
+	phaseModelSwitch = "model switch"
+	phaseInference   = "inference"
+	phaseDecode      = "decode"
+	phaseCompositing = "compositing"
+	phaseUpload      = "upload"
+)
+
+type phaseTiming struct {
+	name     string
+	duration time.Duration
+}
+
+// timings records how long each phase of a generation took
+type timings struct {
+	phases []phaseTiming
+}
+
+// newTimings starts the timings of an item with how long it waited in the queue
+func newTimings(queued time.Time) *timings {
+	t := new(timings)
+	if !queued.IsZero() {
+		t.add(phaseQueueWait, time.Since(queued))
+	}
+	return t
+}
+
+func (t *timings) add(name string, duration time.Duration) {
+	if t == nil {
+		return
+	}
+	t.phases = append(t.phases, phaseTiming{name: name, duration: duration})
+}
+
+// since records the time elapsed since start as the named phase and returns the current time, so phases can be
+// chained, e.g. start = t.since(phaseDecode, start)
+func (t *timings) since(name string, start time.Time) time.Time {
+	t.add(name, time.Since(start))
+	return time.Now()
+}
+
+// String formats the phases as "queue wait 1.2s · inference 8.4s"
+func (t *timings) String() string {
+	if t == nil {
+		return ""
+	}
+	parts := make([]string, len(t.phases))
+	for i, phase := range t.phases {
+		parts[i] = fmt.Sprintf("%s %s", phase.name, roundDuration(phase.duration))
+	}
+	return strings.Join(parts, " · ")
+}
+
+// log writes the timings of the item with its interaction ID
+func (t *timings) log(item *SDQueueItem) {
+	if t == nil || len(t.phases) == 0 {
+		return
+	}
+	item.logs.Printf("Timings of #%s: %s", item.DiscordInteraction.ID, t)
+}
+
+func roundDuration(d time.Duration) time.Duration {
+	switch {
+	case d >= time.Second:
+		return d.Round(100 * time.Millisecond)
+	case d >= time.Millisecond:
+		return d.Round(time.Millisecond)
+	default:
+		return d
+	}
+}
+
+// appendTimings adds the phases recorded so far to the footer of the embed. The upload isn't included as the
+// footer is sent with it.
+func appendTimings(embed *discordgo.MessageEmbed, t *timings) {
+	if embed == nil || t == nil || len(t.phases) == 0 {
+		return
+	}
+	if embed.Footer == nil {
+		embed.Footer = &discordgo.MessageEmbedFooter{}
+	}
+	if embed.Footer.Text != "" {
+		embed.Footer.Text += "\n"
+	}
+	embed.Footer.Text += t.String()
+}
@@ -2,23 +2,32 @@ package stable_diffusion
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"maps"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
 
 	"stable_diffusion_bot/api/stable_diffusion_api"
+	"stable_diffusion_bot/composite_renderer"
 	"stable_diffusion_bot/discord_bot/handlers"
 	"stable_diffusion_bot/entities"
 	"stable_diffusion_bot/utils"
 )
 
-func (q *SDQueue) processUpscaleImagine() error {
-	queue := q.currentImagine
+const (
+	upscaler      = "R-ESRGAN 2x+"
+	upscaleFactor = 2
+)
+
+func (q *SDQueue) processUpscaleImagine(queue *SDQueueItem) error {
 	var err error
 	queue.ImageGenerationRequest, err = q.getPreviousGeneration(queue)
 	if err != nil {
@@ -31,10 +40,19 @@ func (q *SDQueue) processUpscaleImagine() error {
 		return handlers.ErrorEdit(q.botSession, queue.DiscordInteraction, fmt.Errorf("textToImageRequest of type %v is nil", queue.Type))
 	}
 
+	if q.isDryRun(queue) {
+		return q.postDryRun(queue)
+	}
+
+	queue.timings = newTimings(queue.queued)
+	defer queue.timings.log(queue)
+
+	start := time.Now()
 	config, originalConfig, err := q.switchToModels(queue)
 	if err != nil {
 		return handlers.ErrorEdit(q.botSession, queue.DiscordInteraction, fmt.Errorf("error switching to models: %w", err))
 	}
+	start = queue.timings.since(phaseModelSwitch, start)
 
 	newContent := upscaleMessageContent(utils.GetUser(queue.DiscordInteraction), 0, 0)
 	embed := generationEmbedDetails(&discordgo.MessageEmbed{}, queue, queue.Interrupt != nil)
@@ -52,20 +70,28 @@ func (q *SDQueue) processUpscaleImagine() error {
 
 	go q.updateUpscaleProgress(queue, generationDone)
 
-	resp, err := q.upscale(request)
+	resp, err := q.upscale(queue)
 	generationDone <- true
+	queue.timings.since(phaseInference, start)
+	if errors.Is(err, context.Canceled) {
+		q.revertInterrupted(queue, err, config, originalConfig)
+		return err
+	}
 	if err != nil {
-		log.Printf("Error processing image upscale: %v\n", err)
+		queue.logs.Printf("Error processing image upscale: %v\n", err)
 		return handlers.ErrorEdit(q.botSession, queue.DiscordInteraction, "I'm sorry, but I had a problem upscaling your image.", err)
 	}
 
-	log.Printf("Successfully upscaled image: %v, Message: %v, Upscale Index: %d", queue.DiscordInteraction.ID, queue.DiscordInteraction.Message.ID, queue.InteractionIndex)
+	queue.logs.Printf("Successfully upscaled image: %v, Message: %v, Upscale Index: %d", queue.DiscordInteraction.ID, queue.DiscordInteraction.Message.ID, queue.InteractionIndex)
 
-	if err := q.finalUpscaleMessage(queue, resp, embed); err != nil {
+	message, err := q.finalUpscaleMessage(queue, resp, embed)
+	if err != nil {
 		return handlers.ErrorEdit(q.botSession, queue.DiscordInteraction, fmt.Errorf("error finalizing upscale message: %w", err))
 	}
 
-	err = q.revertModels(config, originalConfig)
+	q.recordUpscale(queue, message)
+
+	err = q.revertModels(queue, config, originalConfig)
 	if err != nil {
 		return handlers.ErrorEdit(q.botSession, queue.DiscordInteraction, fmt.Sprintf("Error reverting models: %v", err))
 	}
@@ -73,7 +99,12 @@ func (q *SDQueue) processUpscaleImagine() error {
 	return nil
 }
 
-func (q *SDQueue) upscale(request *entities.ImageGenerationRequest) (*stable_diffusion_api.UpscaleResponse, error) {
+func (q *SDQueue) upscale(item *SDQueueItem) (*stable_diffusion_api.UpscaleResponse, error) {
+	return q.api(item).UpscaleImage(item.Context(), upscaleRequest(item.ImageGenerationRequest))
+}
+
+// upscaleRequest regenerates a single image of the generation with the face model as a fallback and upscales it
+func upscaleRequest(request *entities.ImageGenerationRequest) *stable_diffusion_api.UpscaleRequest {
 	textToImage := request.TextToImageRequest
 	// Use face segm model if we're upscaling but there's no ADetailer models
 	if textToImage.Scripts.ADetailer == nil {
@@ -84,24 +115,64 @@ func (q *SDQueue) upscale(request *entities.ImageGenerationRequest) (*stable_dif
 	textToImage.BatchSize = 1
 	textToImage.NIter = 1
 
-	return q.stableDiffusionAPI.UpscaleImage(&stable_diffusion_api.UpscaleRequest{
+	return &stable_diffusion_api.UpscaleRequest{
 		ResizeMode:         0,
-		UpscalingResize:    2,
-		Upscaler1:          "R-ESRGAN 2x+",
+		UpscalingResize:    upscaleFactor,
+		Upscaler1:          upscaler,
 		TextToImageRequest: textToImage,
-	})
+	}
+}
+
+// recordUpscale stores the upscale as a child of the generation it was made from
+func (q *SDQueue) recordUpscale(queue *SDQueueItem, message *discordgo.Message) {
+	source := queue.ImageGenerationRequest
+	if source == nil || message == nil {
+		return
+	}
+
+	textToImage := *source.TextToImageRequest
+	upscale := &entities.ImageGenerationRequest{
+		GenerationInfo:     source.GenerationInfo,
+		TextToImageRequest: &textToImage,
+	}
+	upscale.ID = 0
+	upscale.InteractionID = queue.DiscordInteraction.ID
+	upscale.GuildID = queue.DiscordInteraction.GuildID
+	upscale.ChannelID = queue.DiscordInteraction.ChannelID
+	upscale.MessageID = message.ID
+	upscale.SortOrder = 0
+	upscale.Processed = true
+	upscale.CreatedAt = time.Time{}
+	upscale.RawRequest = nil
+	upscale.RawInfo = nil
+	if user := utils.GetUser(queue.DiscordInteraction); user != nil {
+		upscale.MemberID = user.ID
+	}
+
+	parentID := source.ID
+	name := upscaler
+	factor := float64(upscaleFactor)
+	upscale.ParentID = &parentID
+	upscale.Upscaler = &name
+	upscale.UpscaleFactor = &factor
+
+	if _, err := q.imageGenerationRepo.Create(context.Background(), upscale); err != nil {
+		queue.logs.Printf("Error recording upscale of generation %d: %v", source.ID, err)
+	}
 }
 
-func (q *SDQueue) finalUpscaleMessage(queue *SDQueueItem, resp *stable_diffusion_api.UpscaleResponse, embed *discordgo.MessageEmbed) error {
+func (q *SDQueue) finalUpscaleMessage(queue *SDQueueItem, resp *stable_diffusion_api.UpscaleResponse, embed *discordgo.MessageEmbed) (*discordgo.Message, error) {
 	textToImage := queue.ImageGenerationRequest.TextToImageRequest
 
+	start := time.Now()
 	decodedImage, decodeErr := base64.StdEncoding.DecodeString(resp.Image)
 	if decodeErr != nil {
-		return fmt.Errorf("error decoding image: %w", decodeErr)
+		return nil, fmt.Errorf("error decoding image: %w", decodeErr)
 	}
 	if len(decodedImage) == 0 {
-		return fmt.Errorf("decoded image is empty")
+		return nil, fmt.Errorf("decoded image is empty")
 	}
+	start = queue.timings.since(phaseDecode, start)
 
 	var scriptsString string
 	var scripts []string
@@ -116,6 +187,7 @@ func (q *SDQueue) finalUpscaleMessage(queue *SDQueueItem, resp *stable_diffusion
 		if textToImage.Scripts.CFGRescale != nil {
 			scripts = append(scripts, "CFGRescale")
 		}
+		scripts = append(scripts, slices.Sorted(maps.Keys(textToImage.Scripts.Extensions))...)
 	} else {
 		for script := range queue.Raw.RawScripts {
 			scripts = append(scripts, script)
@@ -143,13 +215,33 @@ func (q *SDQueue) finalUpscaleMessage(queue *SDQueueItem, resp *stable_diffusion
 		},
 	}
 
-	if err := utils.EmbedImages(webhook, embed, []io.Reader{bytes.NewBuffer(decodedImage)}, nil, q.compositor); err != nil {
-		log.Printf("Error creating image embed: %v\n", err)
-		return err
+	images := []io.Reader{bytes.NewBuffer(decodedImage)}
+	if comparison := q.upscaleComparisonImage(resp.Original, decodedImage); comparison != nil {
+		images = append(images, comparison)
+	}
+	images = q.applyWatermark(queue.DiscordInteraction.GuildID, images)
+	if q.shouldStripMetadata(queue.DiscordInteraction.GuildID, utils.GetUser(queue.DiscordInteraction).ID) {
+		images = stripMetadata(images)
+	} else {
+		images = q.withParameters(images, []string{resp.Infotext})
+	}
+	if err := utils.EmbedImagesWithOptions(webhook, embed, images, nil, q.settings().compositor, utils.EmbedOptions{
+		UploadLimit: utils.UploadLimit(q.botSession, queue.DiscordInteraction.GuildID),
+	}); err != nil {
+		queue.logs.Printf("Error creating image embed: %v\n", err)
+		return nil, err
+	}
+	start = queue.timings.since(phaseCompositing, start)
+	if q.settings().timingFooter {
+		appendTimings(embed, queue.timings)
 	}
 
-	_, err := handlers.EditInteractionResponse(q.botSession, queue.DiscordInteraction, webhook)
-	return err
+	message, err := handlers.EditInteractionResponse(q.botSession, queue.DiscordInteraction, webhook)
+	if err != nil {
+		return nil, err
+	}
+	queue.timings.since(phaseUpload, start)
+	return message, nil
 }
 
 func (q *SDQueue) updateUpscaleProgress(queue *SDQueueItem, generationDone chan bool) {
@@ -164,8 +256,13 @@ func (q *SDQueue) updateUpscaleProgress(queue *SDQueueItem, generationDone chan
 		select {
 		case <-generationDone:
 			return
-		case queue.DiscordInteraction = <-queue.Interrupt:
-			err := q.stableDiffusionAPI.Interrupt()
+		case interaction, ok := <-queue.Interrupt:
+			if !ok {
+				return
+			}
+			queue.DiscordInteraction = interaction
+			err := q.api(queue).Interrupt()
+			queue.abort()
 			if err != nil {
 				_ = handlers.ErrorEdit(q.botSession, queue.DiscordInteraction, fmt.Sprintf("Error interrupting: %v", err))
 				return
@@ -175,13 +272,17 @@ func (q *SDQueue) updateUpscaleProgress(queue *SDQueueItem, generationDone chan
 				return
 			}
 			if queue.DiscordInteraction.Message == nil && message != nil {
-				log.Printf("Setting c.DiscordInteraction.Message to message from channel c.Interrupt: %v", message)
+				queue.logs.Printf("Setting c.DiscordInteraction.Message to message from channel c.Interrupt: %v", message)
 				queue.DiscordInteraction.Message = message
 			}
+			return
 		case <-time.After(1 * time.Second):
-			progress, progressErr := q.stableDiffusionAPI.GetCurrentProgress()
+			progress, progressErr := q.api(queue).GetCurrentProgress(queue.Context())
+			if errors.Is(progressErr, context.Canceled) {
+				return
+			}
 			if progressErr != nil {
-				log.Printf("Error getting current progress: %v", progressErr)
+				queue.logs.Printf("Error getting current progress: %v", progressErr)
 				return
 			}
 
@@ -199,17 +300,38 @@ func (q *SDQueue) updateUpscaleProgress(queue *SDQueueItem, generationDone chan
 			lastProgress = progress.Progress
 			progressContent := upscaleMessageContent(utils.GetUser(queue.DiscordInteraction), fetchProgress, upscaleProgress)
 
-			_, progressErr = q.botSession.InteractionResponseEdit(queue.DiscordInteraction, &discordgo.WebhookEdit{
-				Content: &progressContent,
-			})
+			progressErr = handlers.EditProgress(q.botSession, queue.DiscordInteraction, progressContent)
 			if progressErr != nil {
-				log.Printf("Error editing interaction: %v", progressErr)
+				queue.logs.Printf("Error editing interaction: %v", progressErr)
 				return
 			}
 		case <-timeout.C:
-			log.Printf("Timeout reached")
+			queue.logs.Printf("Timeout reached")
 			_ = handlers.ErrorEdit(q.botSession, queue.DiscordInteraction, "Timeout reached")
 			return
 		}
 	}
 }
+
+// upscaleComparisonImage renders the before and after crop of an upscale, or returns nil if it's disabled or fails
+func (q *SDQueue) upscaleComparisonImage(original string, upscaled []byte) io.Reader {
+	mode := q.settings().upscaleComparison
+	if mode == composite_renderer.CompareNone || original == "" {
+		return nil
+	}
+
+	decodedOriginal, err := base64.StdEncoding.DecodeString(original)
+	if err != nil {
+		log.Printf("Error decoding original image for comparison: %v", err)
+		return nil
+	}
+
+	comparison, err := composite_renderer.Compare(bytes.NewReader(decodedOriginal), bytes.NewReader(upscaled),
+		composite_renderer.CompareOptions{Mode: mode})
+	if err != nil {
+		log.Printf("Error rendering upscale comparison: %v", err)
+		return nil
+	}
+
+	return comparison
+}
@@ -0,0 +1,159 @@
+package stable_diffusion
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"stable_diffusion_bot/discord_bot/handlers"
+	"stable_diffusion_bot/utils"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Limits of the requests accepted by Add, beyond which the backend rejects them, runs out of memory or takes so long
+// that the queue stalls
+const (
+	minDimension    = 64
+	maxDimension    = 2048
+	maxSteps        = 150
+	minCFGScale     = 1
+	maxCFGScale     = 30
+	maxBatchImages  = 16
+	maxPromptLength = 4000
+)
+
+// ValidationError lists what's wrong with a request, so members can fix it instead of waiting for the backend to
+// reject it
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "This request can't be generated:\n- " + strings.Join(e.Problems, "\n- ")
+}
+
+func (e *ValidationError) addf(format string, args ...any) {
+	e.Problems = append(e.Problems, fmt.Sprintf(format, args...))
+}
+
+// validateItem returns a *ValidationError if the item would be rejected by the backend. Fields that are unset are
+// filled from the defaults later and aren't checked.
+func validateItem(item *SDQueueItem) error {
+	if item.ImageGenerationRequest == nil || item.TextToImageRequest == nil {
+		return nil
+	}
+	request := item.TextToImageRequest
+	invalid := new(ValidationError)
+
+	if length := len([]rune(request.Prompt)); length > maxPromptLength {
+		invalid.addf("The prompt is %d characters long, shorten it to %d.", length, maxPromptLength)
+	}
+	if length := len([]rune(request.NegativePrompt)); length > maxPromptLength {
+		invalid.addf("The negative prompt is %d characters long, shorten it to %d.", length, maxPromptLength)
+	}
+
+	for _, dimension := range []struct {
+		name  string
+		value int
+	}{
+		{"width", request.Width},
+		{"height", request.Height},
+		{"hires width", request.HrResizeX},
+		{"hires height", request.HrResizeY},
+	} {
+		switch {
+		case dimension.value == 0:
+		case dimension.value < minDimension || dimension.value > maxDimension:
+			invalid.addf("The %s must be between %d and %d, not %d.", dimension.name, minDimension, maxDimension, dimension.value)
+		case dimension.value%8 != 0:
+			invalid.addf("The %s must be divisible by 8, try %d instead of %d.", dimension.name, (dimension.value+4)&^7, dimension.value)
+		}
+	}
+
+	if request.Steps < 0 || request.Steps > maxSteps {
+		invalid.addf("Steps must be between 1 and %d, not %d.", maxSteps, request.Steps)
+	}
+	if request.CFGScale != 0 && (request.CFGScale < minCFGScale || request.CFGScale > maxCFGScale) {
+		invalid.addf("The CFG scale must be between %d and %d, not %g.", minCFGScale, maxCFGScale, request.CFGScale)
+	}
+	if request.DenoisingStrength < 0 || request.DenoisingStrength > 1 {
+		invalid.addf("The denoising strength must be between 0 and 1, not %g.", request.DenoisingStrength)
+	}
+	if request.SubseedStrength < 0 || request.SubseedStrength > 1 {
+		invalid.addf("The subseed strength must be between 0 and 1, not %g.", request.SubseedStrength)
+	}
+	for _, dimension := range []struct {
+		name  string
+		value *int64
+	}{
+		{"seed resize width", request.SeedResizeFromW},
+		{"seed resize height", request.SeedResizeFromH},
+	} {
+		if dimension.value != nil && *dimension.value != -1 && (*dimension.value < minDimension || *dimension.value > maxDimension) {
+			invalid.addf("The %s must be between %d and %d, not %d.", dimension.name, minDimension, maxDimension, *dimension.value)
+		}
+	}
+
+	if request.BatchSize < 0 || request.NIter < 0 {
+		invalid.addf("The batch size and count can't be negative.")
+	} else if images := max(request.BatchSize, 1) * max(request.NIter, 1); images > maxBatchImages {
+		invalid.addf("A request can make at most %d images, a batch size of %d and count of %d make %d.",
+			maxBatchImages, max(request.BatchSize, 1), max(request.NIter, 1), images)
+	}
+
+	if len(invalid.Problems) > 0 {
+		return invalid
+	}
+	return nil
+}
+
+// validateAttachment returns why an attachment can't be used as the image of the option, or "" if it can
+func validateAttachment(option string, attachment *discordgo.MessageAttachment) string {
+	if attachment == nil {
+		return fmt.Sprintf("Attach an image to %s.", option)
+	}
+	if !strings.HasPrefix(attachment.ContentType, "image/") {
+		return fmt.Sprintf("The %s attachment `%s` is not an image, attach a PNG, JPEG or WebP.", option, attachment.Filename)
+	}
+	if attachment.Size > utils.MaxAttachmentSize {
+		return fmt.Sprintf("The %s attachment `%s` is %d MiB, attach an image smaller than %d MiB.",
+			option, attachment.Filename, attachment.Size>>20, utils.MaxAttachmentSize>>20)
+	}
+	return ""
+}
+
+// validateAttachments checks the images given to the options of the command
+func validateAttachments(i *discordgo.InteractionCreate, options ...CommandOption) error {
+	data := i.ApplicationCommandData()
+	optionMap := utils.GetOpts(data)
+
+	invalid := new(ValidationError)
+	for _, name := range options {
+		option, ok := optionMap[name]
+		if !ok {
+			continue
+		}
+		var attachment *discordgo.MessageAttachment
+		if id, ok := option.Value.(string); ok && data.Resolved != nil {
+			attachment = data.Resolved.Attachments[id]
+		}
+		if problem := validateAttachment(name, attachment); problem != "" {
+			invalid.Problems = append(invalid.Problems, problem)
+		}
+	}
+
+	if len(invalid.Problems) > 0 {
+		return invalid
+	}
+	return nil
+}
+
+// errorInvalid shows the member what's wrong with their request. The public thinking response is replaced with a
+// message only they can see, as nothing will be generated.
+func errorInvalid(s *discordgo.Session, i *discordgo.Interaction, invalid *ValidationError) error {
+	if err := s.InteractionResponseDelete(i); err != nil {
+		log.Printf("Error deleting response to invalid request: %v", err)
+	}
+	return handlers.ErrorFollowupEphemeral(s, i, invalid)
+}
@@ -7,8 +7,8 @@ import (
 	"stable_diffusion_bot/discord_bot/handlers"
 )
 
-func (q *SDQueue) processVariation() error {
-	c, err := q.currentImagine, error(nil)
+func (q *SDQueue) processVariation(c *SDQueueItem) error {
+	var err error
 	c.ImageGenerationRequest, err = q.getPreviousGeneration(c)
 	request := c.ImageGenerationRequest
 	if err != nil {
@@ -42,7 +42,7 @@ func (q *SDQueue) processVariation() error {
 	// set the time to now since time from database is from the past
 	request.CreatedAt = time.Now()
 
-	fillBlankModels(q, request)
+	fillBlankModels(q, c)
 
 	err = q.processImagineGrid(c)
 	if err != nil {
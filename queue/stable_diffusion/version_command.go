@@ -0,0 +1,34 @@
+package stable_diffusion
+
+import (
+	"cmp"
+
+	"github.com/bwmarrin/discordgo"
+
+	"stable_diffusion_bot/discord_bot/handlers"
+	"stable_diffusion_bot/version"
+)
+
+// processVersionCommand shows which build is running, so bug reports can name it
+func (q *SDQueue) processVersionCommand(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	info := version.Get()
+	commit := cmp.Or(info.Commit, "unknown")
+	if info.Modified {
+		commit += " (modified)"
+	}
+	return handlers.Wrap(s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags: discordgo.MessageFlagsEphemeral,
+			Embeds: []*discordgo.MessageEmbed{{
+				Title: "stable_diffusion_bot " + info.Version,
+				Fields: []*discordgo.MessageEmbedField{
+					{Name: "Commit", Value: "`" + commit + "`"},
+					{Name: "Built", Value: cmp.Or(info.Date, "unknown"), Inline: true},
+					{Name: "Go", Value: info.Go, Inline: true},
+				},
+				Footer: &discordgo.MessageEmbedFooter{Text: "Include this when reporting a bug"},
+			}},
+		},
+	}))
+}
@@ -0,0 +1,170 @@
+package stable_diffusion
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image/png"
+	"io"
+	"log"
+
+	"stable_diffusion_bot/composite_renderer"
+	"stable_diffusion_bot/discord_bot/handlers"
+	"stable_diffusion_bot/entities"
+	"stable_diffusion_bot/repositories"
+	"stable_diffusion_bot/utils"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// maxWatermarkImageSize is the largest PNG accepted as a watermark
+const maxWatermarkImageSize = 1 << 20
+
+// guildWatermark returns the watermark of the guild, or nil if it has none
+func (q *SDQueue) guildWatermark(guildID string) *composite_renderer.Watermark {
+	if guildID == "" {
+		return nil
+	}
+
+	watermark, err := q.guildWatermarkRepo.GetByGuildID(context.Background(), guildID)
+	if err != nil {
+		var notFound *repositories.NotFoundError
+		if !errors.As(err, &notFound) {
+			log.Printf("Error getting watermark for guild %s: %v", guildID, err)
+		}
+		return nil
+	}
+
+	wm := &composite_renderer.Watermark{
+		Text:    watermark.Text,
+		Corner:  composite_renderer.Corner(watermark.Corner),
+		Opacity: watermark.Opacity,
+	}
+	if len(watermark.Image) > 0 {
+		wm.Image, err = png.Decode(bytes.NewReader(watermark.Image))
+		if err != nil {
+			log.Printf("Error decoding watermark image for guild %s: %v", guildID, err)
+		}
+	}
+
+	return wm
+}
+
+// applyWatermark draws the guild watermark on each image. Images that fail to render are kept as is
+func (q *SDQueue) applyWatermark(guildID string, images []io.Reader) []io.Reader {
+	wm := q.guildWatermark(guildID)
+	if wm == nil {
+		return images
+	}
+
+	for i, img := range images {
+		if img == nil {
+			continue
+		}
+
+		// keep a copy in case the image can't be decoded
+		data, err := io.ReadAll(img)
+		if err != nil {
+			log.Printf("Error reading image %d for watermark: %v", i, err)
+			images[i] = bytes.NewReader(data)
+			continue
+		}
+
+		watermarked, err := composite_renderer.ApplyWatermark(bytes.NewReader(data), wm)
+		if err != nil {
+			log.Printf("Error applying watermark to image %d: %v", i, err)
+			images[i] = bytes.NewReader(data)
+			continue
+		}
+		images[i] = watermarked
+	}
+
+	return images
+}
+
+func (q *SDQueue) processWatermarkCommand(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	if err := handlers.EphemeralThink(s, i); err != nil {
+		return err
+	}
+
+	if i.GuildID == "" {
+		return handlers.ErrorEdit(s, i.Interaction, "Watermarks can only be set in a server.")
+	}
+
+	data := i.ApplicationCommandData()
+	if len(data.Options) == 0 {
+		return handlers.ErrorEdit(s, i.Interaction, "You need to choose a subcommand.")
+	}
+
+	subcommand := data.Options[0]
+	optionMap := make(map[string]*discordgo.ApplicationCommandInteractionDataOption, len(subcommand.Options))
+	for _, opt := range subcommand.Options {
+		optionMap[opt.Name] = opt
+	}
+
+	switch "watermark_" + subcommand.Name {
+	case watermarkSetOption:
+		watermark := &entities.GuildWatermark{
+			GuildID: i.GuildID,
+			Corner:  string(composite_renderer.CornerBottomRight),
+			Opacity: 0.5,
+		}
+		if option, ok := optionMap[watermarkTextOption]; ok {
+			watermark.Text = option.StringValue()
+		}
+		if option, ok := optionMap[watermarkCornerOption]; ok {
+			watermark.Corner = option.StringValue()
+		}
+		if option, ok := optionMap[watermarkOpacityOption]; ok {
+			watermark.Opacity = option.FloatValue()
+		}
+		if option, ok := optionMap[watermarkImageOption]; ok {
+			attachment, ok := data.Resolved.Attachments[option.Value.(string)]
+			if !ok {
+				return handlers.ErrorEdit(s, i.Interaction, "Could not find the watermark image.")
+			}
+			image, err := utils.DownloadAttachment(attachment, utils.AttachmentLimits{
+				MaxBytes: maxWatermarkImageSize,
+				Formats:  []string{"image/png"},
+			})
+			var attachmentErr *utils.AttachmentError
+			if errors.As(err, &attachmentErr) {
+				return handlers.ErrorEdit(s, i.Interaction, attachmentErr.Error())
+			}
+			if err != nil {
+				return handlers.ErrorEdit(s, i.Interaction, "Error downloading the watermark image.", err)
+			}
+			watermark.Image = image.Bytes()
+		}
+		if watermark.Text == "" && watermark.Image == nil {
+			return handlers.ErrorEdit(s, i.Interaction, "You need to provide a text or an image.")
+		}
+
+		if _, err := q.guildWatermarkRepo.Upsert(context.Background(), watermark); err != nil {
+			return handlers.ErrorEdit(s, i.Interaction, "Error saving watermark.", err)
+		}
+
+		kind := fmt.Sprintf("`%s`", watermark.Text)
+		if watermark.Image != nil {
+			kind = "image"
+		}
+		_, err := handlers.EditInteractionResponse(s, i.Interaction,
+			fmt.Sprintf("Images generated in this server will have a %s watermark in the %s corner at %.0f%% opacity.",
+				kind, watermark.Corner, watermark.Opacity*100))
+		return err
+	case watermarkClearOption:
+		err := q.guildWatermarkRepo.Delete(context.Background(), i.GuildID)
+		var notFound *repositories.NotFoundError
+		if errors.As(err, &notFound) {
+			return handlers.ErrorEdit(s, i.Interaction, "This server has no watermark.")
+		}
+		if err != nil {
+			return handlers.ErrorEdit(s, i.Interaction, "Error removing watermark.", err)
+		}
+		_, err = handlers.EditInteractionResponse(s, i.Interaction, "Removed the watermark.")
+		return err
+	default:
+		return handlers.ErrorEdit(s, i.Interaction, fmt.Sprintf("Unknown subcommand: %s", subcommand.Name))
+	}
+}
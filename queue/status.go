@@ -0,0 +1,56 @@
+package queue
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Summary is a snapshot of a queue for /status queues
+type Summary struct {
+	Name string
+	// Current is who the item being processed is for, nil when the queue is idle
+	Current *discordgo.User
+	// Started is when the current item was taken from the queue
+	Started time.Time
+	Depth   int
+	Paused  bool
+	// AverageWait is how long the recent items waited before they were processed, 0 before any were
+	AverageWait time.Duration
+}
+
+type Summarizer interface {
+	Summary() Summary
+}
+
+// waitSamples is how many of the most recent items the average wait is taken from
+const waitSamples = 20
+
+// Waits are how long the most recent items waited in a queue
+type Waits struct {
+	mu    sync.Mutex
+	waits []time.Duration
+}
+
+func (w *Waits) Record(wait time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.waits = append(w.waits, max(wait, 0))
+	if len(w.waits) > waitSamples {
+		w.waits = w.waits[len(w.waits)-waitSamples:]
+	}
+}
+
+func (w *Waits) Average() time.Duration {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.waits) == 0 {
+		return 0
+	}
+	var total time.Duration
+	for _, wait := range w.waits {
+		total += wait
+	}
+	return total / time.Duration(len(w.waits))
+}
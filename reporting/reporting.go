@@ -0,0 +1,158 @@
+package reporting
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+)
+
+// flushTimeout is how long pending reports are given to be sent before a panic crashes the bot
+const flushTimeout = 2 * time.Second
+
+type Level string
+
+const (
+	LevelError Level = "error"
+	LevelFatal Level = "fatal"
+)
+
+// Event is a failure with the context of the request it happened in
+type Event struct {
+	Level   Level             `json:"level"`
+	Message string            `json:"message"`
+	Stack   string            `json:"stack,omitempty"`
+	Tags    map[string]string `json:"tags,omitempty"`
+	Extra   map[string]any    `json:"extra,omitempty"`
+	Time    time.Time         `json:"time"`
+}
+
+// Reporter sends events to an error tracker. Report must not block on the network.
+type Reporter interface {
+	Report(event Event)
+	// Flush waits up to timeout for reported events to be sent
+	Flush(timeout time.Duration)
+}
+
+type Config struct {
+	// SentryDSN reports to Sentry
+	SentryDSN string
+	// WebhookURL POSTs each event as JSON
+	WebhookURL string
+	// Environment tells deployments apart, e.g. production
+	Environment string
+	// Release is the version of the bot that sent the report
+	Release string
+	// Scrub removes secrets from the text of events before they're sent
+	Scrub func(string) string
+}
+
+var (
+	reporters atomic.Pointer[[]Reporter]
+	scrub     atomic.Pointer[func(string) string]
+)
+
+// Setup reports to Sentry and the webhook of cfg, whichever are set. Without either, reports are discarded.
+func Setup(cfg Config) error {
+	var configured []Reporter
+	if cfg.SentryDSN != "" {
+		sentry, err := newSentryReporter(cfg)
+		if err != nil {
+			return fmt.Errorf("error setting up Sentry: %w", err)
+		}
+		configured = append(configured, sentry)
+	}
+	if cfg.WebhookURL != "" {
+		configured = append(configured, newWebhookReporter(cfg))
+	}
+	reporters.Store(&configured)
+	if cfg.Scrub != nil {
+		scrub.Store(&cfg.Scrub)
+	}
+	return nil
+}
+
+// Error reports a failed request, tags are indexed by the tracker while extra is attached as is
+func Error(err error, tags map[string]string, extra map[string]any) {
+	if err == nil {
+		return
+	}
+	report(Event{Level: LevelError, Message: err.Error(), Tags: tags, Extra: extra, Time: time.Now()})
+}
+
+// Panic reports a recovered panic with the stack of the goroutine that panicked
+func Panic(recovered any, tags map[string]string, extra map[string]any) {
+	report(Event{
+		Level:   LevelFatal,
+		Message: fmt.Sprintf("panic: %v", recovered),
+		Stack:   string(debug.Stack()),
+		Tags:    tags,
+		Extra:   extra,
+		Time:    time.Now(),
+	})
+}
+
+// Repanic reports a panic and panics again, so the crash still happens but is heard about. Defer it directly:
+//
+//	defer reporting.Repanic(map[string]string{"goroutine": "main"})
+func Repanic(tags map[string]string) {
+	recovered := recover()
+	if recovered == nil {
+		return
+	}
+	Panic(recovered, tags, nil)
+	Flush(flushTimeout)
+	panic(recovered)
+}
+
+// Flush waits for reported events to be sent, call it before exiting
+func Flush(timeout time.Duration) {
+	if configured := reporters.Load(); configured != nil {
+		for _, reporter := range *configured {
+			reporter.Flush(timeout)
+		}
+	}
+}
+
+func report(event Event) {
+	configured := reporters.Load()
+	if configured == nil || len(*configured) == 0 {
+		return
+	}
+	if fn := scrub.Load(); fn != nil {
+		event = scrubbed(event, *fn)
+	}
+	for _, reporter := range *configured {
+		reporter.Report(event)
+	}
+}
+
+// scrubbed copies the event with fn applied to its message, stack, tags and the strings among its extras
+func scrubbed(event Event, fn func(string) string) Event {
+	event.Message = fn(event.Message)
+	event.Stack = fn(event.Stack)
+	if event.Tags != nil {
+		tags := make(map[string]string, len(event.Tags))
+		for key, value := range event.Tags {
+			tags[key] = fn(value)
+		}
+		event.Tags = tags
+	}
+	if event.Extra != nil {
+		extra := make(map[string]any, len(event.Extra))
+		for key, value := range event.Extra {
+			switch value := value.(type) {
+			case string:
+				extra[key] = fn(value)
+			case error:
+				extra[key] = fn(value.Error())
+			case fmt.Stringer:
+				extra[key] = fn(value.String())
+			default:
+				extra[key] = value
+			}
+		}
+		event.Extra = extra
+	}
+	return event
+}
@@ -0,0 +1,41 @@
+package reporting
+
+import (
+	"errors"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// sentryReporter sends events through the Sentry SDK, which queues and sends them in the background
+type sentryReporter struct{}
+
+func newSentryReporter(cfg Config) (*sentryReporter, error) {
+	err := sentry.Init(sentry.ClientOptions{
+		Dsn:         cfg.SentryDSN,
+		Environment: cfg.Environment,
+		Release:     cfg.Release,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &sentryReporter{}, nil
+}
+
+func (sentryReporter) Report(event Event) {
+	sentry.WithScope(func(scope *sentry.Scope) {
+		scope.SetLevel(sentry.Level(event.Level))
+		scope.SetTags(event.Tags)
+		if len(event.Extra) > 0 {
+			scope.SetContext("request", event.Extra)
+		}
+		if event.Stack != "" {
+			scope.SetContext("panic", sentry.Context{"stack": event.Stack})
+		}
+		sentry.CaptureException(errors.New(event.Message))
+	})
+}
+
+func (sentryReporter) Flush(timeout time.Duration) {
+	sentry.Flush(timeout)
+}
@@ -0,0 +1,91 @@
+package reporting
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// webhookBuffer is how many events wait to be sent before new ones are dropped, so a failing webhook can't back
+// up generations
+const webhookBuffer = 64
+
+// webhookReporter POSTs events as JSON from a single goroutine
+type webhookReporter struct {
+	url         string
+	environment string
+	release     string
+	client      *http.Client
+	events      chan Event
+	pending     sync.WaitGroup
+}
+
+// webhookPayload is the body of each POST
+type webhookPayload struct {
+	Event
+	Environment string `json:"environment,omitempty"`
+	Release     string `json:"release,omitempty"`
+}
+
+func newWebhookReporter(cfg Config) *webhookReporter {
+	w := &webhookReporter{
+		url:         cfg.WebhookURL,
+		environment: cfg.Environment,
+		release:     cfg.Release,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		events:      make(chan Event, webhookBuffer),
+	}
+	go w.send()
+	return w
+}
+
+func (w *webhookReporter) Report(event Event) {
+	w.pending.Add(1)
+	select {
+	case w.events <- event:
+	default:
+		w.pending.Done()
+		log.Printf("Dropping error report, %d reports are still waiting to be sent", webhookBuffer)
+	}
+}
+
+func (w *webhookReporter) Flush(timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		w.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+	}
+}
+
+func (w *webhookReporter) send() {
+	for event := range w.events {
+		if err := w.post(event); err != nil {
+			log.Printf("Error sending error report to webhook: %v", err)
+		}
+		w.pending.Done()
+	}
+}
+
+func (w *webhookReporter) post(event Event) error {
+	body, err := json.Marshal(webhookPayload{Event: event, Environment: w.environment, Release: w.release})
+	if err != nil {
+		return err
+	}
+	resp, err := w.client.Post(w.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
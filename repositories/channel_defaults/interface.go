@@ -0,0 +1,15 @@
+package channel_defaults
+
+import (
+	"context"
+
+	"stable_diffusion_bot/entities"
+)
+
+type Repository interface {
+	// Upsert replaces the defaults of the channel
+	Upsert(ctx context.Context, defaults *entities.ChannelDefault) (*entities.ChannelDefault, error)
+	GetByChannelID(ctx context.Context, channelID string) (*entities.ChannelDefault, error)
+	ListByGuildID(ctx context.Context, guildID string) ([]*entities.ChannelDefault, error)
+	Delete(ctx context.Context, guildID string, channelID string) error
+}
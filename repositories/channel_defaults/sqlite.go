@@ -0,0 +1,128 @@
+package channel_defaults
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+
+	"stable_diffusion_bot/clock"
+	"stable_diffusion_bot/entities"
+	"stable_diffusion_bot/repositories"
+)
+
+const upsertChannelDefaultQuery string = `
+INSERT INTO channel_defaults (guild_id, channel_id, checkpoint, vae, style, updated_at) VALUES (?, ?, ?, ?, ?, ?)
+ON CONFLICT (channel_id) DO UPDATE SET
+    guild_id = excluded.guild_id,
+    checkpoint = excluded.checkpoint,
+    vae = excluded.vae,
+    style = excluded.style,
+    updated_at = excluded.updated_at;
+`
+
+const getChannelDefaultQuery string = `
+SELECT guild_id, channel_id, checkpoint, vae, style, updated_at FROM channel_defaults WHERE channel_id = ?;
+`
+
+const listChannelDefaultsQuery string = `
+SELECT guild_id, channel_id, checkpoint, vae, style, updated_at FROM channel_defaults WHERE guild_id = ? ORDER BY updated_at;
+`
+
+const deleteChannelDefaultQuery string = `
+DELETE FROM channel_defaults WHERE guild_id = ? AND channel_id = ?;
+`
+
+type sqliteRepo struct {
+	dbConn    *sql.DB
+	clock     clock.Clock
+	writeLock *sync.Mutex
+}
+
+type Config struct {
+	DB *sql.DB
+}
+
+func NewRepository(cfg *Config) (Repository, error) {
+	if cfg.DB == nil {
+		return nil, errors.New("missing DB parameter")
+	}
+
+	newRepo := &sqliteRepo{
+		dbConn:    cfg.DB,
+		clock:     clock.NewClock(),
+		writeLock: repositories.WriteLock(cfg.DB),
+	}
+
+	return newRepo, nil
+}
+
+func (repo *sqliteRepo) Upsert(ctx context.Context, defaults *entities.ChannelDefault) (*entities.ChannelDefault, error) {
+	repo.writeLock.Lock()
+	defer repo.writeLock.Unlock()
+
+	defaults.UpdatedAt = repo.clock.Now()
+
+	_, err := repo.dbConn.ExecContext(ctx, upsertChannelDefaultQuery,
+		defaults.GuildID, defaults.ChannelID, defaults.Checkpoint, defaults.VAE, defaults.Style, defaults.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return defaults, nil
+}
+
+func (repo *sqliteRepo) GetByChannelID(ctx context.Context, channelID string) (*entities.ChannelDefault, error) {
+	var defaults entities.ChannelDefault
+	err := repo.dbConn.QueryRowContext(ctx, getChannelDefaultQuery, channelID).Scan(
+		&defaults.GuildID, &defaults.ChannelID, &defaults.Checkpoint, &defaults.VAE, &defaults.Style, &defaults.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, repositories.NewNotFoundError(fmt.Sprintf("defaults for channel %s", channelID))
+		}
+		return nil, err
+	}
+
+	return &defaults, nil
+}
+
+func (repo *sqliteRepo) ListByGuildID(ctx context.Context, guildID string) ([]*entities.ChannelDefault, error) {
+	rows, err := repo.dbConn.QueryContext(ctx, listChannelDefaultsQuery, guildID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []*entities.ChannelDefault
+	for rows.Next() {
+		var defaults entities.ChannelDefault
+		err := rows.Scan(&defaults.GuildID, &defaults.ChannelID, &defaults.Checkpoint, &defaults.VAE, &defaults.Style, &defaults.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, &defaults)
+	}
+
+	return list, rows.Err()
+}
+
+func (repo *sqliteRepo) Delete(ctx context.Context, guildID string, channelID string) error {
+	repo.writeLock.Lock()
+	defer repo.writeLock.Unlock()
+
+	res, err := repo.dbConn.ExecContext(ctx, deleteChannelDefaultQuery, guildID, channelID)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return repositories.NewNotFoundError(fmt.Sprintf("defaults for channel %s", channelID))
+	}
+
+	return nil
+}
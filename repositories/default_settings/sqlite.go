@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"sync"
 
 	"stable_diffusion_bot/clock"
 	"stable_diffusion_bot/entities"
@@ -12,16 +13,17 @@ import (
 )
 
 const upsertSetting string = `
-INSERT OR REPLACE INTO default_settings (member_id, width, height, batch_count, batch_size) VALUES (?, ?, ?, ?, ?);
+INSERT OR REPLACE INTO default_settings (member_id, width, height, batch_count, batch_size, negative_embeddings) VALUES (?, ?, ?, ?, ?, ?);
 `
 
 const getSettingByMemberID string = `
-SELECT member_id, width, height, batch_count, batch_size FROM default_settings WHERE member_id = ?;
+SELECT member_id, width, height, batch_count, batch_size, negative_embeddings FROM default_settings WHERE member_id = ?;
 `
 
 type sqliteRepo struct {
-	dbConn *sql.DB
-	clock  clock.Clock
+	dbConn    *sql.DB
+	clock     clock.Clock
+	writeLock *sync.Mutex
 }
 
 type Config struct {
@@ -34,16 +36,20 @@ func NewRepository(cfg *Config) (Repository, error) {
 	}
 
 	newRepo := &sqliteRepo{
-		dbConn: cfg.DB,
-		clock:  clock.NewClock(),
+		dbConn:    cfg.DB,
+		clock:     clock.NewClock(),
+		writeLock: repositories.WriteLock(cfg.DB),
 	}
 
 	return newRepo, nil
 }
 
 func (repo *sqliteRepo) Upsert(ctx context.Context, setting *entities.DefaultSettings) (*entities.DefaultSettings, error) {
+	repo.writeLock.Lock()
+	defer repo.writeLock.Unlock()
+
 	_, err := repo.dbConn.ExecContext(ctx, upsertSetting,
-		setting.MemberID, setting.Width, setting.Height, setting.BatchCount, setting.BatchSize)
+		setting.MemberID, setting.Width, setting.Height, setting.BatchCount, setting.BatchSize, setting.NegativeEmbeddings)
 	if err != nil {
 		return nil, err
 	}
@@ -55,7 +61,7 @@ func (repo *sqliteRepo) GetByMemberID(ctx context.Context, memberID string) (*en
 	var setting entities.DefaultSettings
 
 	err := repo.dbConn.QueryRowContext(ctx, getSettingByMemberID, memberID).Scan(
-		&setting.MemberID, &setting.Width, &setting.Height, &setting.BatchCount, &setting.BatchSize)
+		&setting.MemberID, &setting.Width, &setting.Height, &setting.BatchCount, &setting.BatchSize, &setting.NegativeEmbeddings)
 
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -0,0 +1,15 @@
+package deleted_messages
+
+import (
+	"context"
+	"time"
+
+	"stable_diffusion_bot/entities"
+)
+
+type Repository interface {
+	Create(ctx context.Context, message *entities.DeletedMessage) (*entities.DeletedMessage, error)
+	Get(ctx context.Context, messageID string) (*entities.DeletedMessage, error)
+	Delete(ctx context.Context, messageID string) error
+	Purge(ctx context.Context, before time.Time) (int64, error)
+}
@@ -0,0 +1,162 @@
+package deleted_messages
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"stable_diffusion_bot/clock"
+	"stable_diffusion_bot/entities"
+	"stable_diffusion_bot/repositories"
+)
+
+const insertDeletedMessageQuery string = `
+INSERT OR REPLACE INTO deleted_messages (message_id, guild_id, channel_id, member_id, deleted_by, content, embeds, deleted_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?);
+`
+
+const insertDeletedFileQuery string = `
+INSERT INTO deleted_message_files (message_id, name, content_type, data) VALUES (?, ?, ?, ?);
+`
+
+const getDeletedMessageQuery string = `
+SELECT message_id, guild_id, channel_id, member_id, deleted_by, content, embeds, deleted_at FROM deleted_messages WHERE message_id = ?;
+`
+
+const getDeletedFilesQuery string = `
+SELECT name, content_type, data FROM deleted_message_files WHERE message_id = ? ORDER BY id;
+`
+
+const deleteDeletedMessageQuery string = `
+DELETE FROM deleted_message_files WHERE message_id = ?1;
+DELETE FROM deleted_messages WHERE message_id = ?1;
+`
+
+const purgeDeletedMessagesQuery string = `
+DELETE FROM deleted_message_files WHERE message_id IN (SELECT message_id FROM deleted_messages WHERE deleted_at < ?1);
+DELETE FROM deleted_messages WHERE deleted_at < ?1;
+`
+
+type sqliteRepo struct {
+	dbConn    *sql.DB
+	clock     clock.Clock
+	writeLock *sync.Mutex
+}
+
+type Config struct {
+	DB *sql.DB
+}
+
+func NewRepository(cfg *Config) (Repository, error) {
+	if cfg.DB == nil {
+		return nil, errors.New("missing DB parameter")
+	}
+
+	newRepo := &sqliteRepo{
+		dbConn:    cfg.DB,
+		clock:     clock.NewClock(),
+		writeLock: repositories.WriteLock(cfg.DB),
+	}
+
+	return newRepo, nil
+}
+
+// Create archives a message and its files, replacing any previous archive of the same message
+func (repo *sqliteRepo) Create(ctx context.Context, message *entities.DeletedMessage) (*entities.DeletedMessage, error) {
+	repo.writeLock.Lock()
+	defer repo.writeLock.Unlock()
+
+	if message.DeletedAt.IsZero() {
+		message.DeletedAt = repo.clock.Now()
+	}
+
+	embeds, err := json.Marshal(message.Embeds)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := repo.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, insertDeletedMessageQuery,
+		message.MessageID, message.GuildID, message.ChannelID, message.MemberID, message.DeletedBy,
+		message.Content, string(embeds), message.DeletedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range message.Files {
+		_, err = tx.ExecContext(ctx, insertDeletedFileQuery, message.MessageID, file.Name, file.ContentType, file.Data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return message, nil
+}
+
+func (repo *sqliteRepo) Get(ctx context.Context, messageID string) (*entities.DeletedMessage, error) {
+	var message entities.DeletedMessage
+	var embeds string
+
+	err := repo.dbConn.QueryRowContext(ctx, getDeletedMessageQuery, messageID).Scan(
+		&message.MessageID, &message.GuildID, &message.ChannelID, &message.MemberID, &message.DeletedBy,
+		&message.Content, &embeds, &message.DeletedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, repositories.NewNotFoundError(fmt.Sprintf("deleted message %s", messageID))
+		}
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(embeds), &message.Embeds); err != nil {
+		return nil, err
+	}
+
+	rows, err := repo.dbConn.QueryContext(ctx, getDeletedFilesQuery, messageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var file entities.DeletedFile
+		if err := rows.Scan(&file.Name, &file.ContentType, &file.Data); err != nil {
+			return nil, err
+		}
+		message.Files = append(message.Files, file)
+	}
+
+	return &message, rows.Err()
+}
+
+func (repo *sqliteRepo) Delete(ctx context.Context, messageID string) error {
+	repo.writeLock.Lock()
+	defer repo.writeLock.Unlock()
+
+	_, err := repo.dbConn.ExecContext(ctx, deleteDeletedMessageQuery, messageID)
+	return err
+}
+
+// Purge removes archives of messages deleted before the given time
+func (repo *sqliteRepo) Purge(ctx context.Context, before time.Time) (int64, error) {
+	repo.writeLock.Lock()
+	defer repo.writeLock.Unlock()
+
+	res, err := repo.dbConn.ExecContext(ctx, purgeDeletedMessagesQuery, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
@@ -0,0 +1,13 @@
+package failed_generations
+
+import (
+	"context"
+
+	"stable_diffusion_bot/entities"
+)
+
+type Repository interface {
+	Create(ctx context.Context, failure *entities.FailedGeneration) (*entities.FailedGeneration, error)
+	// GetRecent returns the latest failures of the guild, of every guild if guildID is empty
+	GetRecent(ctx context.Context, guildID string, limit int) ([]*entities.FailedGeneration, error)
+}
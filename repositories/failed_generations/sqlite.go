@@ -0,0 +1,91 @@
+package failed_generations
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+
+	"stable_diffusion_bot/clock"
+	"stable_diffusion_bot/entities"
+	"stable_diffusion_bot/repositories"
+)
+
+const insertFailureQuery string = `
+INSERT INTO failed_generations (interaction_id, guild_id, member_id, backend, request, error, log, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?);
+`
+
+// getRecentFailuresQuery matches every guild when the guild is empty
+const getRecentFailuresQuery string = `
+SELECT id, interaction_id, guild_id, member_id, backend, request, error, log, created_at FROM failed_generations
+WHERE (?1 = '' OR guild_id = ?1) ORDER BY created_at DESC LIMIT ?2;
+`
+
+type sqliteRepo struct {
+	dbConn    *sql.DB
+	clock     clock.Clock
+	writeLock *sync.Mutex
+}
+
+type Config struct {
+	DB *sql.DB
+}
+
+func NewRepository(cfg *Config) (Repository, error) {
+	if cfg.DB == nil {
+		return nil, errors.New("missing DB parameter")
+	}
+
+	newRepo := &sqliteRepo{
+		dbConn:    cfg.DB,
+		clock:     clock.NewClock(),
+		writeLock: repositories.WriteLock(cfg.DB),
+	}
+
+	return newRepo, nil
+}
+
+func (repo *sqliteRepo) Create(ctx context.Context, failure *entities.FailedGeneration) (*entities.FailedGeneration, error) {
+	repo.writeLock.Lock()
+	defer repo.writeLock.Unlock()
+
+	if failure.CreatedAt.IsZero() {
+		failure.CreatedAt = repo.clock.Now()
+	}
+
+	res, err := repo.dbConn.ExecContext(ctx, insertFailureQuery,
+		failure.InteractionID, failure.GuildID, failure.MemberID, failure.Backend, failure.Request, failure.Error, failure.Log, failure.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	lastID, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	failure.ID = lastID
+
+	return failure, nil
+}
+
+func (repo *sqliteRepo) GetRecent(ctx context.Context, guildID string, limit int) ([]*entities.FailedGeneration, error) {
+	rows, err := repo.dbConn.QueryContext(ctx, getRecentFailuresQuery, guildID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var failures []*entities.FailedGeneration
+	for rows.Next() {
+		var failure entities.FailedGeneration
+		err := rows.Scan(&failure.ID, &failure.InteractionID, &failure.GuildID, &failure.MemberID, &failure.Backend,
+			&failure.Request, &failure.Error, &failure.Log, &failure.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		failures = append(failures, &failure)
+	}
+
+	return failures, rows.Err()
+}
@@ -0,0 +1,14 @@
+package guild_quiet_hours
+
+import (
+	"context"
+
+	"stable_diffusion_bot/entities"
+)
+
+type Repository interface {
+	// Upsert replaces the quiet hours of the guild
+	Upsert(ctx context.Context, quietHours *entities.GuildQuietHours) (*entities.GuildQuietHours, error)
+	GetByGuildID(ctx context.Context, guildID string) (*entities.GuildQuietHours, error)
+	Delete(ctx context.Context, guildID string) error
+}
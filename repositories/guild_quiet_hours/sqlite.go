@@ -0,0 +1,104 @@
+package guild_quiet_hours
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+
+	"stable_diffusion_bot/clock"
+	"stable_diffusion_bot/entities"
+	"stable_diffusion_bot/repositories"
+)
+
+const upsertQuietHoursQuery string = `
+INSERT INTO guild_quiet_hours (guild_id, start_minute, end_minute, timezone, mode, updated_at) VALUES (?, ?, ?, ?, ?, ?)
+ON CONFLICT (guild_id) DO UPDATE SET
+    start_minute = excluded.start_minute,
+    end_minute = excluded.end_minute,
+    timezone = excluded.timezone,
+    mode = excluded.mode,
+    updated_at = excluded.updated_at;
+`
+
+const getQuietHoursQuery string = `
+SELECT guild_id, start_minute, end_minute, timezone, mode, updated_at FROM guild_quiet_hours WHERE guild_id = ?;
+`
+
+const deleteQuietHoursQuery string = `
+DELETE FROM guild_quiet_hours WHERE guild_id = ?;
+`
+
+type sqliteRepo struct {
+	dbConn    *sql.DB
+	clock     clock.Clock
+	writeLock *sync.Mutex
+}
+
+type Config struct {
+	DB *sql.DB
+}
+
+func NewRepository(cfg *Config) (Repository, error) {
+	if cfg.DB == nil {
+		return nil, errors.New("missing DB parameter")
+	}
+
+	newRepo := &sqliteRepo{
+		dbConn:    cfg.DB,
+		clock:     clock.NewClock(),
+		writeLock: repositories.WriteLock(cfg.DB),
+	}
+
+	return newRepo, nil
+}
+
+func (repo *sqliteRepo) Upsert(ctx context.Context, quietHours *entities.GuildQuietHours) (*entities.GuildQuietHours, error) {
+	repo.writeLock.Lock()
+	defer repo.writeLock.Unlock()
+
+	quietHours.UpdatedAt = repo.clock.Now()
+
+	_, err := repo.dbConn.ExecContext(ctx, upsertQuietHoursQuery,
+		quietHours.GuildID, quietHours.Start, quietHours.End, quietHours.Timezone, quietHours.Mode, quietHours.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return quietHours, nil
+}
+
+func (repo *sqliteRepo) GetByGuildID(ctx context.Context, guildID string) (*entities.GuildQuietHours, error) {
+	var quietHours entities.GuildQuietHours
+	err := repo.dbConn.QueryRowContext(ctx, getQuietHoursQuery, guildID).Scan(
+		&quietHours.GuildID, &quietHours.Start, &quietHours.End, &quietHours.Timezone, &quietHours.Mode, &quietHours.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, repositories.NewNotFoundError(fmt.Sprintf("quiet hours for guild %s", guildID))
+		}
+		return nil, err
+	}
+
+	return &quietHours, nil
+}
+
+func (repo *sqliteRepo) Delete(ctx context.Context, guildID string) error {
+	repo.writeLock.Lock()
+	defer repo.writeLock.Unlock()
+
+	res, err := repo.dbConn.ExecContext(ctx, deleteQuietHoursQuery, guildID)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return repositories.NewNotFoundError(fmt.Sprintf("quiet hours for guild %s", guildID))
+	}
+
+	return nil
+}
@@ -0,0 +1,14 @@
+package guild_watermarks
+
+import (
+	"context"
+
+	"stable_diffusion_bot/entities"
+)
+
+type Repository interface {
+	// Upsert replaces the watermark of the guild
+	Upsert(ctx context.Context, watermark *entities.GuildWatermark) (*entities.GuildWatermark, error)
+	GetByGuildID(ctx context.Context, guildID string) (*entities.GuildWatermark, error)
+	Delete(ctx context.Context, guildID string) error
+}
@@ -0,0 +1,104 @@
+package guild_watermarks
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+
+	"stable_diffusion_bot/clock"
+	"stable_diffusion_bot/entities"
+	"stable_diffusion_bot/repositories"
+)
+
+const upsertWatermarkQuery string = `
+INSERT INTO guild_watermarks (guild_id, text, image, corner, opacity, updated_at) VALUES (?, ?, ?, ?, ?, ?)
+ON CONFLICT (guild_id) DO UPDATE SET
+    text = excluded.text,
+    image = excluded.image,
+    corner = excluded.corner,
+    opacity = excluded.opacity,
+    updated_at = excluded.updated_at;
+`
+
+const getWatermarkQuery string = `
+SELECT guild_id, text, image, corner, opacity, updated_at FROM guild_watermarks WHERE guild_id = ?;
+`
+
+const deleteWatermarkQuery string = `
+DELETE FROM guild_watermarks WHERE guild_id = ?;
+`
+
+type sqliteRepo struct {
+	dbConn    *sql.DB
+	clock     clock.Clock
+	writeLock *sync.Mutex
+}
+
+type Config struct {
+	DB *sql.DB
+}
+
+func NewRepository(cfg *Config) (Repository, error) {
+	if cfg.DB == nil {
+		return nil, errors.New("missing DB parameter")
+	}
+
+	newRepo := &sqliteRepo{
+		dbConn:    cfg.DB,
+		clock:     clock.NewClock(),
+		writeLock: repositories.WriteLock(cfg.DB),
+	}
+
+	return newRepo, nil
+}
+
+func (repo *sqliteRepo) Upsert(ctx context.Context, watermark *entities.GuildWatermark) (*entities.GuildWatermark, error) {
+	repo.writeLock.Lock()
+	defer repo.writeLock.Unlock()
+
+	watermark.UpdatedAt = repo.clock.Now()
+
+	_, err := repo.dbConn.ExecContext(ctx, upsertWatermarkQuery,
+		watermark.GuildID, watermark.Text, watermark.Image, watermark.Corner, watermark.Opacity, watermark.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return watermark, nil
+}
+
+func (repo *sqliteRepo) GetByGuildID(ctx context.Context, guildID string) (*entities.GuildWatermark, error) {
+	var watermark entities.GuildWatermark
+	err := repo.dbConn.QueryRowContext(ctx, getWatermarkQuery, guildID).Scan(
+		&watermark.GuildID, &watermark.Text, &watermark.Image, &watermark.Corner, &watermark.Opacity, &watermark.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, repositories.NewNotFoundError(fmt.Sprintf("watermark for guild %s", guildID))
+		}
+		return nil, err
+	}
+
+	return &watermark, nil
+}
+
+func (repo *sqliteRepo) Delete(ctx context.Context, guildID string) error {
+	repo.writeLock.Lock()
+	defer repo.writeLock.Unlock()
+
+	res, err := repo.dbConn.ExecContext(ctx, deleteWatermarkQuery, guildID)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return repositories.NewNotFoundError(fmt.Sprintf("watermark for guild %s", guildID))
+	}
+
+	return nil
+}
@@ -2,12 +2,52 @@ package image_generations
 
 import (
 	"context"
+	"time"
 
 	"stable_diffusion_bot/entities"
 )
 
 type Repository interface {
 	Create(ctx context.Context, generation *entities.ImageGenerationRequest) (*entities.ImageGenerationRequest, error)
+	CreateBatch(ctx context.Context, generations []*entities.ImageGenerationRequest) ([]*entities.ImageGenerationRequest, error)
 	GetByMessage(ctx context.Context, messageID string) (*entities.ImageGenerationRequest, error)
 	GetByMessageAndSort(ctx context.Context, messageID string, sortOrder int) (*entities.ImageGenerationRequest, error)
+	GetAllByMessage(ctx context.Context, messageID string) ([]*entities.ImageGenerationRequest, error)
+	GetChildren(ctx context.Context, parentID int64) ([]*entities.ImageGenerationRequest, error)
+	ResolveMessageLink(ctx context.Context, link string) ([]*entities.ImageGenerationRequest, error)
+	GetByMemberID(ctx context.Context, memberID string, opts ListOptions) ([]*entities.ImageGenerationRequest, error)
+	CountByMemberID(ctx context.Context, memberID string, guildID string) (int, error)
+	SoftDeleteByMessage(ctx context.Context, messageID string) error
+	RestoreByMessage(ctx context.Context, messageID string, newMessageID string) error
+	PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
+	// Export calls fn with every generation matching opts, oldest first, stopping at the first error
+	Export(ctx context.Context, opts ExportOptions, fn func(*entities.ImageGenerationRequest) error) error
 }
+
+// ExportOptions filters the generations of Export. Empty fields match everything, deleted generations are skipped.
+type ExportOptions struct {
+	GuildID  string
+	MemberID string
+	Since    time.Time
+}
+
+type Order int
+
+const (
+	OrderNewest Order = iota
+	OrderOldest
+)
+
+// ListOptions paginates queries that return multiple generations. A zero Limit uses DefaultLimit.
+// GuildID scopes the query to a single guild, leave it empty for the global view.
+type ListOptions struct {
+	Limit   int
+	Offset  int
+	Order   Order
+	GuildID string
+}
+
+const (
+	DefaultLimit = 25
+	MaxLimit     = 100
+)
@@ -5,9 +5,14 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"sync"
+	"time"
 
 	"stable_diffusion_bot/clock"
 	"stable_diffusion_bot/entities"
+	"stable_diffusion_bot/repositories"
+	"stable_diffusion_bot/utils"
 )
 
 const insertGenerationQuery string = `
@@ -17,33 +22,67 @@ INSERT INTO image_generations (interaction_id, message_id, member_id, sort_order
                                batch_count, batch_size, seed, subseed, 
                                subseed_strength, sampler_name, cfg_scale, steps, processed, created_at, 
                                always_on_scripts, 
-                               checkpoint, vae, hypernetwork) VALUES
-                            (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
+                               checkpoint, vae, hypernetwork, 
+                               guild_id, channel_id, 
+                               checkpoint_hash, checkpoint_sha256, vae_hash, extra_networks, 
+                               raw_request, raw_info, 
+                               parent_id, upscaler, upscale_factor, 
+                               schema_version, 
+                               backend, anlas) VALUES
+                            (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
 `
 
-const getGenerationByMessageID string = `
+// selectGenerationColumns must be kept in the same order as scanGeneration
+const selectGenerationColumns string = `
 SELECT id, interaction_id, message_id, member_id, sort_order, prompt,
        negative_prompt, width, height, restore_faces, 
        enable_hr, hr_scale, hr_upscaler, hires_width, hires_height, 
        denoising_strength, batch_count, batch_size, seed, subseed, 
        subseed_strength, sampler_name, cfg_scale, steps, processed, created_at, 
        always_on_scripts, 
-       checkpoint, vae, hypernetwork FROM image_generations WHERE message_id = ?;
-`
+       checkpoint, vae, hypernetwork, 
+       guild_id, channel_id, 
+       checkpoint_hash, checkpoint_sha256, vae_hash, extra_networks, 
+       raw_request, raw_info, 
+       parent_id, upscaler, upscale_factor, 
+       schema_version, 
+       backend, anlas FROM image_generations`
 
-const getGenerationByMessageIDAndSortOrder string = `
-SELECT id, interaction_id, message_id, member_id, sort_order, prompt,
-       negative_prompt, width, height, restore_faces, 
-       enable_hr, hr_scale, hr_upscaler, hires_width, hires_height, 
-       denoising_strength, batch_count, batch_size, seed, subseed, 
-       subseed_strength, sampler_name, cfg_scale, steps, processed, created_at, 
-       always_on_scripts, 
-       checkpoint, vae, hypernetwork FROM image_generations WHERE message_id = ? AND sort_order = ?;
+const getGenerationByMessageID string = selectGenerationColumns + ` WHERE message_id = ? AND deleted_at IS NULL;`
+
+const getGenerationByMessageIDAndSortOrder string = selectGenerationColumns + ` WHERE message_id = ? AND sort_order = ? AND deleted_at IS NULL;`
+
+const getGenerationsByMessageID string = selectGenerationColumns + ` WHERE message_id = ? AND deleted_at IS NULL ORDER BY sort_order;`
+
+// guildScope matches every guild when the guild ID parameter is empty
+const guildScope string = ` AND (?1 = '' OR guild_id = ?1)`
+
+const getGenerationsByMemberIDNewest string = selectGenerationColumns + ` WHERE member_id = ?2 AND deleted_at IS NULL` + guildScope + ` ORDER BY created_at DESC, id DESC LIMIT ?3 OFFSET ?4;`
+
+const getGenerationsByMemberIDOldest string = selectGenerationColumns + ` WHERE member_id = ?2 AND deleted_at IS NULL` + guildScope + ` ORDER BY created_at ASC, id ASC LIMIT ?3 OFFSET ?4;`
+
+const countGenerationsByMemberID string = `SELECT COUNT(*) FROM image_generations WHERE member_id = ?2 AND deleted_at IS NULL` + guildScope + `;`
+
+const getGenerationsByParentID string = selectGenerationColumns + ` WHERE parent_id = ? AND deleted_at IS NULL ORDER BY created_at;`
+
+const softDeleteGenerationsByMessageID string = `UPDATE image_generations SET deleted_at = ? WHERE message_id = ? AND deleted_at IS NULL;`
+
+const restoreGenerationsByMessageID string = `UPDATE image_generations SET deleted_at = NULL, message_id = ? WHERE message_id = ? AND deleted_at IS NOT NULL;`
+
+const exportGenerations string = selectGenerationColumns + ` WHERE deleted_at IS NULL AND (?1 = '' OR guild_id = ?1) AND (?2 = '' OR member_id = ?2) AND created_at >= ?3 ORDER BY created_at, id;`
+
+const purgeDeletedGenerations string = `DELETE FROM image_generations WHERE deleted_at IS NOT NULL AND deleted_at < ?;`
+
+// incrementDailyStats keeps the daily_stats rollup in step with image_generations
+const incrementDailyStats string = `
+INSERT INTO daily_stats (day, guild_id, member_id, checkpoint, images) VALUES (?, ?, ?, ?, 1)
+ON CONFLICT (day, guild_id, member_id, checkpoint) DO UPDATE SET images = images + 1;
 `
 
 type sqliteRepo struct {
-	dbConn *sql.DB
-	clock  clock.Clock
+	dbConn    *sql.DB
+	clock     clock.Clock
+	writeLock *sync.Mutex
 }
 
 type Config struct {
@@ -56,77 +95,341 @@ func NewRepository(cfg *Config) (Repository, error) {
 	}
 
 	newRepo := &sqliteRepo{
-		dbConn: cfg.DB,
-		clock:  clock.NewClock(),
+		dbConn:    cfg.DB,
+		clock:     clock.NewClock(),
+		writeLock: repositories.WriteLock(cfg.DB),
 	}
 
 	return newRepo, nil
 }
 
 func (repo *sqliteRepo) Create(ctx context.Context, generation *entities.ImageGenerationRequest) (*entities.ImageGenerationRequest, error) {
+	repo.writeLock.Lock()
+	defer repo.writeLock.Unlock()
+
 	if generation.CreatedAt.IsZero() {
 		generation.CreatedAt = repo.clock.Now()
 	}
 
+	tx, err := repo.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// nolint
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, insertGenerationQuery, generationArgs(generation)...)
+	if err != nil {
+		return nil, err
+	}
+
+	lastID, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := updateDailyStats(ctx, tx, generation); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	generation.ID = lastID
+
+	return generation, nil
+}
+
+// updateDailyStats counts generation in the daily rollup if it represents an image.
+// The parent row of a batch (sort order 0) is skipped as each image is recorded separately.
+func updateDailyStats(ctx context.Context, tx *sql.Tx, generation *entities.ImageGenerationRequest) error {
+	if generation.SortOrder == 0 && generation.ParentID == nil {
+		return nil
+	}
+
+	var checkpoint string
+	if generation.Checkpoint != nil {
+		checkpoint = *generation.Checkpoint
+	}
+
+	_, err := tx.ExecContext(ctx, incrementDailyStats,
+		generation.CreatedAt.UTC().Format(time.DateOnly), generation.GuildID, generation.MemberID, checkpoint)
+	return err
+}
+
+// CreateBatch inserts all generations in a single transaction using a prepared statement.
+// Either every generation is recorded or none are.
+func (repo *sqliteRepo) CreateBatch(ctx context.Context, generations []*entities.ImageGenerationRequest) ([]*entities.ImageGenerationRequest, error) {
+	repo.writeLock.Lock()
+	defer repo.writeLock.Unlock()
+
+	if len(generations) == 0 {
+		return generations, nil
+	}
+
+	tx, err := repo.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// nolint
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, insertGenerationQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	now := repo.clock.Now()
+	ids := make([]int64, len(generations))
+	for i, generation := range generations {
+		if generation.CreatedAt.IsZero() {
+			generation.CreatedAt = now
+		}
+
+		res, err := stmt.ExecContext(ctx, generationArgs(generation)...)
+		if err != nil {
+			return nil, err
+		}
+
+		ids[i], err = res.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := updateDailyStats(ctx, tx, generation); err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, generation := range generations {
+		generation.ID = ids[i]
+	}
+
+	return generations, nil
+}
+
+// generationArgs returns the arguments for insertGenerationQuery in column order, and marks generation as stored
+// with the current schema. Generations without a backend are recorded as Stable Diffusion.
+func generationArgs(generation *entities.ImageGenerationRequest) []any {
+	generation.SchemaVersion = entities.GenerationSchemaVersion
+	if generation.Backend == "" {
+		generation.Backend = entities.BackendStableDiffusion
+	}
+
 	marshalAlwaysonScripts, err := json.Marshal(generation.Scripts)
 	if err != nil {
 		marshalAlwaysonScripts = []byte("{}")
 	}
-	marshalAlwaysonScriptstoString := string(marshalAlwaysonScripts)
-	res, err := repo.dbConn.ExecContext(ctx, insertGenerationQuery,
+
+	marshalExtraNetworks, err := json.Marshal(generation.ExtraNetworks)
+	if err != nil || generation.ExtraNetworks == nil {
+		marshalExtraNetworks = []byte("[]")
+	}
+
+	return []any{
 		generation.InteractionID, generation.MessageID, generation.MemberID, generation.SortOrder, generation.Prompt,
 		generation.NegativePrompt, generation.Width, generation.Height, generation.RestoreFaces,
 		generation.EnableHr, generation.HrScale, generation.HrUpscaler, generation.HrResizeX, generation.HrResizeY, generation.DenoisingStrength,
 		generation.NIter, generation.BatchSize, generation.Seed, generation.Subseed,
 		generation.SubseedStrength, generation.SamplerName, generation.CFGScale, generation.Steps, generation.Processed, generation.CreatedAt,
-		marshalAlwaysonScriptstoString,
+		string(marshalAlwaysonScripts),
 		generation.Checkpoint, generation.VAE, generation.Hypernetwork,
-	)
+		generation.GuildID, generation.ChannelID,
+		generation.CheckpointHash, generation.CheckpointSHA256, generation.VAEHash, string(marshalExtraNetworks),
+		generation.RawRequest, generation.RawInfo,
+		generation.ParentID, generation.Upscaler, generation.UpscaleFactor,
+		entities.GenerationSchemaVersion,
+		generation.Backend, generation.Anlas,
+	}
+}
+
+func (repo *sqliteRepo) GetByMessage(ctx context.Context, messageID string) (*entities.ImageGenerationRequest, error) {
+	generation, err := scanGeneration(repo.dbConn.QueryRowContext(ctx, getGenerationByMessageID, messageID), entities.NewADetailer())
 	if err != nil {
 		return nil, err
 	}
 
-	lastID, err := res.LastInsertId()
+	return generation, nil
+}
+
+func (repo *sqliteRepo) GetByMessageAndSort(ctx context.Context, messageID string, sortOrder int) (*entities.ImageGenerationRequest, error) {
+	generation, err := scanGeneration(repo.dbConn.QueryRowContext(ctx, getGenerationByMessageIDAndSortOrder, messageID, sortOrder), nil)
 	if err != nil {
 		return nil, err
 	}
 
-	generation.ID = lastID
-
 	return generation, nil
 }
 
-func (repo *sqliteRepo) GetByMessage(ctx context.Context, messageID string) (*entities.ImageGenerationRequest, error) {
-	var generation = entities.ImageGenerationRequest{TextToImageRequest: &entities.TextToImageRequest{}}
-	var alwaysonScriptsString string
+// GetAllByMessage returns the parent generation and every sub-generation recorded for a message, ordered by sort order
+func (repo *sqliteRepo) GetAllByMessage(ctx context.Context, messageID string) ([]*entities.ImageGenerationRequest, error) {
+	rows, err := repo.dbConn.QueryContext(ctx, getGenerationsByMessageID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-	err := repo.dbConn.QueryRowContext(ctx, getGenerationByMessageID, messageID).Scan(
-		&generation.ID, &generation.InteractionID, &generation.MessageID, &generation.MemberID, &generation.SortOrder, &generation.Prompt,
-		&generation.NegativePrompt, &generation.Width, &generation.Height, &generation.RestoreFaces,
-		&generation.EnableHr, &generation.HrScale, &generation.HrUpscaler, &generation.HrResizeX, &generation.HrResizeY, &generation.DenoisingStrength,
-		&generation.NIter, &generation.BatchSize, &generation.Seed, &generation.Subseed,
-		&generation.SubseedStrength, &generation.SamplerName, &generation.CFGScale, &generation.Steps, &generation.Processed, &generation.CreatedAt,
-		&alwaysonScriptsString,
-		&generation.Checkpoint, &generation.VAE, &generation.Hypernetwork,
-	)
+	var generations []*entities.ImageGenerationRequest
+	for rows.Next() {
+		generation, err := scanGeneration(rows, nil)
+		if err != nil {
+			return nil, err
+		}
+		generations = append(generations, generation)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(generations) == 0 {
+		return nil, repositories.NewNotFoundError(fmt.Sprintf("generations for message ID %s", messageID))
+	}
+
+	return generations, nil
+}
+
+// GetChildren returns the generations derived from parentID, such as upscales
+func (repo *sqliteRepo) GetChildren(ctx context.Context, parentID int64) ([]*entities.ImageGenerationRequest, error) {
+	rows, err := repo.dbConn.QueryContext(ctx, getGenerationsByParentID, parentID)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
+
+	var generations []*entities.ImageGenerationRequest
+	for rows.Next() {
+		generation, err := scanGeneration(rows, nil)
+		if err != nil {
+			return nil, err
+		}
+		generations = append(generations, generation)
+	}
+
+	return generations, rows.Err()
+}
+
+func (repo *sqliteRepo) GetByMemberID(ctx context.Context, memberID string, opts ListOptions) ([]*entities.ImageGenerationRequest, error) {
+	query := getGenerationsByMemberIDNewest
+	if opts.Order == OrderOldest {
+		query = getGenerationsByMemberIDOldest
+	}
 
-	generation.Scripts.ADetailer = entities.NewADetailer()
-	err = json.Unmarshal([]byte(alwaysonScriptsString), &generation.Scripts)
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	limit = min(limit, MaxLimit)
+
+	rows, err := repo.dbConn.QueryContext(ctx, query, opts.GuildID, memberID, limit, max(opts.Offset, 0))
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	return &generation, nil
+	var generations []*entities.ImageGenerationRequest
+	for rows.Next() {
+		generation, err := scanGeneration(rows, nil)
+		if err != nil {
+			return nil, err
+		}
+		generations = append(generations, generation)
+	}
+
+	return generations, rows.Err()
 }
 
-func (repo *sqliteRepo) GetByMessageAndSort(ctx context.Context, messageID string, sortOrder int) (*entities.ImageGenerationRequest, error) {
+func (repo *sqliteRepo) CountByMemberID(ctx context.Context, memberID string, guildID string) (int, error) {
+	var count int
+	err := repo.dbConn.QueryRowContext(ctx, countGenerationsByMemberID, guildID, memberID).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// SoftDeleteByMessage marks every generation of a message as deleted without removing the rows
+func (repo *sqliteRepo) SoftDeleteByMessage(ctx context.Context, messageID string) error {
+	repo.writeLock.Lock()
+	defer repo.writeLock.Unlock()
+
+	_, err := repo.dbConn.ExecContext(ctx, softDeleteGenerationsByMessageID, repo.clock.Now(), messageID)
+	return err
+}
+
+// RestoreByMessage clears the deleted mark and moves the generations to the message they were reposted as
+func (repo *sqliteRepo) RestoreByMessage(ctx context.Context, messageID string, newMessageID string) error {
+	repo.writeLock.Lock()
+	defer repo.writeLock.Unlock()
+
+	_, err := repo.dbConn.ExecContext(ctx, restoreGenerationsByMessageID, newMessageID, messageID)
+	return err
+}
+
+// PurgeDeleted permanently removes generations that were soft-deleted before the given time
+func (repo *sqliteRepo) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	repo.writeLock.Lock()
+	defer repo.writeLock.Unlock()
+
+	res, err := repo.dbConn.ExecContext(ctx, purgeDeletedGenerations, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+// ResolveMessageLink returns the generations associated with a Discord message link
+func (repo *sqliteRepo) Export(ctx context.Context, opts ExportOptions, fn func(*entities.ImageGenerationRequest) error) error {
+	rows, err := repo.dbConn.QueryContext(ctx, exportGenerations, opts.GuildID, opts.MemberID, opts.Since)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		generation, err := scanGeneration(rows, nil)
+		if err != nil {
+			return err
+		}
+		if err := fn(generation); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func (repo *sqliteRepo) ResolveMessageLink(ctx context.Context, link string) ([]*entities.ImageGenerationRequest, error) {
+	_, _, messageID, err := utils.ParseMessageLink(link)
+	if err != nil {
+		return nil, err
+	}
+
+	return repo.GetAllByMessage(ctx, messageID)
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// scanGeneration reads a row selected with selectGenerationColumns.
+// adetailer is used as the default ADetailer script before the stored scripts are unmarshalled.
+func scanGeneration(row scanner, adetailer *entities.ADetailer) (*entities.ImageGenerationRequest, error) {
 	var generation = entities.ImageGenerationRequest{TextToImageRequest: &entities.TextToImageRequest{}}
 	var alwaysonScriptsString string
+	var extraNetworksString string
 
-	err := repo.dbConn.QueryRowContext(ctx, getGenerationByMessageIDAndSortOrder, messageID, sortOrder).Scan(
+	err := row.Scan(
 		&generation.ID, &generation.InteractionID, &generation.MessageID, &generation.MemberID, &generation.SortOrder, &generation.Prompt,
 		&generation.NegativePrompt, &generation.Width, &generation.Height, &generation.RestoreFaces,
 		&generation.EnableHr, &generation.HrScale, &generation.HrUpscaler, &generation.HrResizeX, &generation.HrResizeY, &generation.DenoisingStrength,
@@ -134,14 +437,33 @@ func (repo *sqliteRepo) GetByMessageAndSort(ctx context.Context, messageID strin
 		&generation.SubseedStrength, &generation.SamplerName, &generation.CFGScale, &generation.Steps, &generation.Processed, &generation.CreatedAt,
 		&alwaysonScriptsString,
 		&generation.Checkpoint, &generation.VAE, &generation.Hypernetwork,
+		&generation.GuildID, &generation.ChannelID,
+		&generation.CheckpointHash, &generation.CheckpointSHA256, &generation.VAEHash, &extraNetworksString,
+		&generation.RawRequest, &generation.RawInfo,
+		&generation.ParentID, &generation.Upscaler, &generation.UpscaleFactor,
+		&generation.SchemaVersion,
+		&generation.Backend, &generation.Anlas,
 	)
+	if err != nil {
+		return nil, err
+	}
+
+	stored := &storedGeneration{
+		generation:    &generation,
+		scripts:       []byte(alwaysonScriptsString),
+		extraNetworks: []byte(extraNetworksString),
+	}
+	if err := stored.upgrade(); err != nil {
+		return nil, fmt.Errorf("error upgrading generation %d: %w", generation.ID, err)
+	}
 
+	err = json.Unmarshal(stored.extraNetworks, &generation.ExtraNetworks)
 	if err != nil {
 		return nil, err
 	}
 
-	// generation.NewADetailer()
-	err = json.Unmarshal([]byte(alwaysonScriptsString), &generation.Scripts)
+	generation.Scripts.ADetailer = adetailer
+	err = json.Unmarshal(stored.scripts, &generation.Scripts)
 	if err != nil {
 		return nil, err
 	}
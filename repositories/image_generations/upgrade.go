@@ -0,0 +1,142 @@
+package image_generations
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"stable_diffusion_bot/entities"
+)
+
+// storedGeneration is a row as it was stored. The JSON columns are kept raw so upgrades can change their shape
+// before they're unmarshalled.
+type storedGeneration struct {
+	generation    *entities.ImageGenerationRequest
+	scripts       []byte
+	extraNetworks []byte
+}
+
+// upgrades convert a row from the schema version of their index to the next one. Add one whenever
+// entities.GenerationSchemaVersion is raised. Rows are upgraded each time they're read and are never rewritten.
+var upgrades = []func(*storedGeneration) error{
+	upgradeUnversioned,
+}
+
+func init() {
+	if len(upgrades) != entities.GenerationSchemaVersion {
+		panic(fmt.Sprintf("%d generation upgrades for schema version %d", len(upgrades), entities.GenerationSchemaVersion))
+	}
+}
+
+// upgrade runs the upgrades from the version the row was stored with to entities.GenerationSchemaVersion
+func (s *storedGeneration) upgrade() error {
+	version := s.generation.SchemaVersion
+	if version > entities.GenerationSchemaVersion {
+		return fmt.Errorf("stored with schema version %d, newer than %d of this bot", version, entities.GenerationSchemaVersion)
+	}
+	for ; version < entities.GenerationSchemaVersion; version++ {
+		if err := upgrades[version](s); err != nil {
+			return fmt.Errorf("schema version %d: %w", version, err)
+		}
+	}
+	s.generation.SchemaVersion = version
+	return nil
+}
+
+// upgradeUnversioned fixes rows stored before records were versioned: empty JSON columns, CFG Rescale args written
+// as an object instead of the list the extension takes, and the enable flags A1111 accepts in front of ADetailer
+// args, none of which unmarshal into entities.Scripts.
+func upgradeUnversioned(s *storedGeneration) error {
+	if isBlankJSON(s.extraNetworks) {
+		s.extraNetworks = []byte("[]")
+	}
+	if isBlankJSON(s.scripts) {
+		s.scripts = []byte("{}")
+		return nil
+	}
+
+	var scripts map[string]json.RawMessage
+	if err := json.Unmarshal(s.scripts, &scripts); err != nil {
+		return err
+	}
+	for title, script := range scripts {
+		var upgraded json.RawMessage
+		var err error
+		switch {
+		case strings.EqualFold(title, "CFG Rescale Extension"):
+			upgraded, err = upgradeArgs(script, cfgRescaleArgs)
+		case strings.EqualFold(title, "ADetailer"):
+			upgraded, err = upgradeArgs(script, adetailerArgs)
+		default:
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", title, err)
+		}
+		scripts[title] = upgraded
+	}
+
+	upgraded, err := json.Marshal(scripts)
+	if err != nil {
+		return err
+	}
+	s.scripts = upgraded
+	return nil
+}
+
+// upgradeArgs replaces the args of script with the result of fn
+func upgradeArgs(script json.RawMessage, fn func(json.RawMessage) (json.RawMessage, error)) (json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(script, &fields); err != nil || fields == nil {
+		return script, err
+	}
+	args, ok := fields["args"]
+	if !ok || isBlankJSON(args) {
+		return script, nil
+	}
+
+	upgraded, err := fn(args)
+	if err != nil {
+		return nil, err
+	}
+	fields["args"] = upgraded
+	return json.Marshal(fields)
+}
+
+// cfgRescaleArgs turns {"CfgRescale": 0.7, "AutoColorFix": false, ...} into [0.7, false, ...]
+func cfgRescaleArgs(args json.RawMessage) (json.RawMessage, error) {
+	if !bytes.HasPrefix(bytes.TrimSpace(args), []byte("{")) {
+		return args, nil
+	}
+	var parameters struct {
+		CfgRescale   float64
+		AutoColorFix bool
+		FixStrength  float64
+		KeepOriginal bool
+	}
+	if err := json.Unmarshal(args, &parameters); err != nil {
+		return nil, err
+	}
+	return json.Marshal(entities.CFGRescaleParameters(parameters))
+}
+
+// adetailerArgs drops the ad_enable and skip_img2img flags from [true, false, {...}], keeping the units
+func adetailerArgs(args json.RawMessage) (json.RawMessage, error) {
+	var units []json.RawMessage
+	if err := json.Unmarshal(args, &units); err != nil {
+		return nil, err
+	}
+	kept := units[:0]
+	for _, unit := range units {
+		if bytes.HasPrefix(bytes.TrimSpace(unit), []byte("{")) {
+			kept = append(kept, unit)
+		}
+	}
+	return json.Marshal(kept)
+}
+
+func isBlankJSON(data []byte) bool {
+	data = bytes.TrimSpace(data)
+	return len(data) == 0 || bytes.Equal(data, []byte("null"))
+}
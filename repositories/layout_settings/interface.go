@@ -0,0 +1,14 @@
+package layout_settings
+
+import (
+	"context"
+
+	"stable_diffusion_bot/entities"
+)
+
+type Repository interface {
+	Upsert(ctx context.Context, setting *entities.LayoutSetting) (*entities.LayoutSetting, error)
+	Get(ctx context.Context, scope string, scopeID string) (*entities.LayoutSetting, error)
+	// Resolve returns the setting of the member if they chose one, otherwise the setting of the guild
+	Resolve(ctx context.Context, guildID string, memberID string) (*entities.LayoutSetting, error)
+}
@@ -0,0 +1,87 @@
+package layout_settings
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+
+	"stable_diffusion_bot/clock"
+	"stable_diffusion_bot/entities"
+	"stable_diffusion_bot/repositories"
+)
+
+const upsertLayoutSettingQuery string = `
+INSERT INTO layout_settings (scope, scope_id, individual, updated_at) VALUES (?, ?, ?, ?)
+ON CONFLICT (scope, scope_id) DO UPDATE SET individual = excluded.individual, updated_at = excluded.updated_at;
+`
+
+const getLayoutSettingQuery string = `
+SELECT scope, scope_id, individual, updated_at FROM layout_settings WHERE scope = ? AND scope_id = ?;
+`
+
+const resolveLayoutSettingQuery string = `
+SELECT scope, scope_id, individual, updated_at FROM layout_settings
+WHERE (scope = 'member' AND scope_id = ?) OR (scope = 'guild' AND scope_id = ?)
+ORDER BY scope = 'member' DESC LIMIT 1;
+`
+
+type sqliteRepo struct {
+	dbConn    *sql.DB
+	clock     clock.Clock
+	writeLock *sync.Mutex
+}
+
+type Config struct {
+	DB *sql.DB
+}
+
+func NewRepository(cfg *Config) (Repository, error) {
+	if cfg.DB == nil {
+		return nil, errors.New("missing DB parameter")
+	}
+
+	newRepo := &sqliteRepo{
+		dbConn:    cfg.DB,
+		clock:     clock.NewClock(),
+		writeLock: repositories.WriteLock(cfg.DB),
+	}
+
+	return newRepo, nil
+}
+
+func (repo *sqliteRepo) Upsert(ctx context.Context, setting *entities.LayoutSetting) (*entities.LayoutSetting, error) {
+	repo.writeLock.Lock()
+	defer repo.writeLock.Unlock()
+
+	setting.UpdatedAt = repo.clock.Now()
+
+	_, err := repo.dbConn.ExecContext(ctx, upsertLayoutSettingQuery, setting.Scope, setting.ScopeID, setting.Individual, setting.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return setting, nil
+}
+
+func (repo *sqliteRepo) Get(ctx context.Context, scope string, scopeID string) (*entities.LayoutSetting, error) {
+	return repo.scan(repo.dbConn.QueryRowContext(ctx, getLayoutSettingQuery, scope, scopeID), fmt.Sprintf("%s %s", scope, scopeID))
+}
+
+func (repo *sqliteRepo) Resolve(ctx context.Context, guildID string, memberID string) (*entities.LayoutSetting, error) {
+	return repo.scan(repo.dbConn.QueryRowContext(ctx, resolveLayoutSettingQuery, memberID, guildID), fmt.Sprintf("guild %s or member %s", guildID, memberID))
+}
+
+func (repo *sqliteRepo) scan(row *sql.Row, subject string) (*entities.LayoutSetting, error) {
+	var setting entities.LayoutSetting
+	err := row.Scan(&setting.Scope, &setting.ScopeID, &setting.Individual, &setting.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, repositories.NewNotFoundError("layout setting for " + subject)
+		}
+		return nil, err
+	}
+
+	return &setting, nil
+}
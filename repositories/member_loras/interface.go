@@ -0,0 +1,18 @@
+package member_loras
+
+import (
+	"context"
+
+	"stable_diffusion_bot/entities"
+)
+
+type Repository interface {
+	// RecordUse counts a use of the LoRA. The weight is remembered unless the LoRA is pinned
+	RecordUse(ctx context.Context, memberID string, name string, weight float64) error
+	Pin(ctx context.Context, memberID string, name string, weight float64) error
+	Unpin(ctx context.Context, memberID string, name string) error
+	// List returns pinned LoRAs first, followed by the most used
+	List(ctx context.Context, memberID string, limit int) ([]*entities.MemberLora, error)
+	// GetPinned returns only the pinned LoRAs
+	GetPinned(ctx context.Context, memberID string) ([]*entities.MemberLora, error)
+}
@@ -0,0 +1,124 @@
+package member_loras
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+
+	"stable_diffusion_bot/clock"
+	"stable_diffusion_bot/entities"
+	"stable_diffusion_bot/repositories"
+)
+
+const recordUseQuery string = `
+INSERT INTO member_loras (member_id, name, weight, uses, pinned, last_used_at) VALUES (?, ?, ?, 1, FALSE, ?)
+ON CONFLICT (member_id, name) DO UPDATE SET
+    uses = uses + 1,
+    last_used_at = excluded.last_used_at,
+    weight = CASE WHEN pinned THEN weight ELSE excluded.weight END;
+`
+
+const pinQuery string = `
+INSERT INTO member_loras (member_id, name, weight, uses, pinned, last_used_at) VALUES (?, ?, ?, 0, TRUE, ?)
+ON CONFLICT (member_id, name) DO UPDATE SET pinned = TRUE, weight = excluded.weight;
+`
+
+const unpinQuery string = `
+UPDATE member_loras SET pinned = FALSE WHERE member_id = ? AND name = ? AND pinned;
+`
+
+const selectMemberLoraColumns string = `SELECT member_id, name, weight, uses, pinned, last_used_at FROM member_loras`
+
+const listQuery string = selectMemberLoraColumns + ` WHERE member_id = ? ORDER BY pinned DESC, uses DESC, last_used_at DESC LIMIT ?;`
+
+const getPinnedQuery string = selectMemberLoraColumns + ` WHERE member_id = ? AND pinned ORDER BY name;`
+
+type sqliteRepo struct {
+	dbConn    *sql.DB
+	clock     clock.Clock
+	writeLock *sync.Mutex
+}
+
+type Config struct {
+	DB *sql.DB
+}
+
+func NewRepository(cfg *Config) (Repository, error) {
+	if cfg.DB == nil {
+		return nil, errors.New("missing DB parameter")
+	}
+
+	newRepo := &sqliteRepo{
+		dbConn:    cfg.DB,
+		clock:     clock.NewClock(),
+		writeLock: repositories.WriteLock(cfg.DB),
+	}
+
+	return newRepo, nil
+}
+
+func (repo *sqliteRepo) RecordUse(ctx context.Context, memberID string, name string, weight float64) error {
+	repo.writeLock.Lock()
+	defer repo.writeLock.Unlock()
+
+	_, err := repo.dbConn.ExecContext(ctx, recordUseQuery, memberID, name, weight, repo.clock.Now())
+	return err
+}
+
+func (repo *sqliteRepo) Pin(ctx context.Context, memberID string, name string, weight float64) error {
+	repo.writeLock.Lock()
+	defer repo.writeLock.Unlock()
+
+	_, err := repo.dbConn.ExecContext(ctx, pinQuery, memberID, name, weight, repo.clock.Now())
+	return err
+}
+
+func (repo *sqliteRepo) Unpin(ctx context.Context, memberID string, name string) error {
+	repo.writeLock.Lock()
+	defer repo.writeLock.Unlock()
+
+	res, err := repo.dbConn.ExecContext(ctx, unpinQuery, memberID, name)
+	if err != nil {
+		return err
+	}
+
+	unpinned, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if unpinned == 0 {
+		return repositories.NewNotFoundError(fmt.Sprintf("pinned lora %s", name))
+	}
+
+	return nil
+}
+
+func (repo *sqliteRepo) List(ctx context.Context, memberID string, limit int) ([]*entities.MemberLora, error) {
+	return repo.query(ctx, listQuery, memberID, limit)
+}
+
+func (repo *sqliteRepo) GetPinned(ctx context.Context, memberID string) ([]*entities.MemberLora, error) {
+	return repo.query(ctx, getPinnedQuery, memberID)
+}
+
+func (repo *sqliteRepo) query(ctx context.Context, query string, args ...any) ([]*entities.MemberLora, error) {
+	rows, err := repo.dbConn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var loras []*entities.MemberLora
+	for rows.Next() {
+		var lora entities.MemberLora
+		err := rows.Scan(&lora.MemberID, &lora.Name, &lora.Weight, &lora.Uses, &lora.Pinned, &lora.LastUsedAt)
+		if err != nil {
+			return nil, err
+		}
+		loras = append(loras, &lora)
+	}
+
+	return loras, rows.Err()
+}
@@ -0,0 +1,14 @@
+package privacy_settings
+
+import (
+	"context"
+
+	"stable_diffusion_bot/entities"
+)
+
+type Repository interface {
+	Upsert(ctx context.Context, setting *entities.PrivacySetting) (*entities.PrivacySetting, error)
+	Get(ctx context.Context, scope string, scopeID string) (*entities.PrivacySetting, error)
+	// ShouldStripMetadata reports whether either the guild or the member opted to strip metadata
+	ShouldStripMetadata(ctx context.Context, guildID string, memberID string) (bool, error)
+}
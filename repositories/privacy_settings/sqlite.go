@@ -0,0 +1,87 @@
+package privacy_settings
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+
+	"stable_diffusion_bot/clock"
+	"stable_diffusion_bot/entities"
+	"stable_diffusion_bot/repositories"
+)
+
+const upsertPrivacySettingQuery string = `
+INSERT INTO privacy_settings (scope, scope_id, strip_metadata, updated_at) VALUES (?, ?, ?, ?)
+ON CONFLICT (scope, scope_id) DO UPDATE SET strip_metadata = excluded.strip_metadata, updated_at = excluded.updated_at;
+`
+
+const getPrivacySettingQuery string = `
+SELECT scope, scope_id, strip_metadata, updated_at FROM privacy_settings WHERE scope = ? AND scope_id = ?;
+`
+
+const shouldStripMetadataQuery string = `
+SELECT EXISTS (
+    SELECT 1 FROM privacy_settings WHERE strip_metadata
+    AND ((scope = 'guild' AND scope_id = ?) OR (scope = 'member' AND scope_id = ?))
+);
+`
+
+type sqliteRepo struct {
+	dbConn    *sql.DB
+	clock     clock.Clock
+	writeLock *sync.Mutex
+}
+
+type Config struct {
+	DB *sql.DB
+}
+
+func NewRepository(cfg *Config) (Repository, error) {
+	if cfg.DB == nil {
+		return nil, errors.New("missing DB parameter")
+	}
+
+	newRepo := &sqliteRepo{
+		dbConn:    cfg.DB,
+		clock:     clock.NewClock(),
+		writeLock: repositories.WriteLock(cfg.DB),
+	}
+
+	return newRepo, nil
+}
+
+func (repo *sqliteRepo) Upsert(ctx context.Context, setting *entities.PrivacySetting) (*entities.PrivacySetting, error) {
+	repo.writeLock.Lock()
+	defer repo.writeLock.Unlock()
+
+	setting.UpdatedAt = repo.clock.Now()
+
+	_, err := repo.dbConn.ExecContext(ctx, upsertPrivacySettingQuery, setting.Scope, setting.ScopeID, setting.StripMetadata, setting.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return setting, nil
+}
+
+func (repo *sqliteRepo) Get(ctx context.Context, scope string, scopeID string) (*entities.PrivacySetting, error) {
+	var setting entities.PrivacySetting
+	err := repo.dbConn.QueryRowContext(ctx, getPrivacySettingQuery, scope, scopeID).Scan(
+		&setting.Scope, &setting.ScopeID, &setting.StripMetadata, &setting.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, repositories.NewNotFoundError(fmt.Sprintf("privacy setting for %s %s", scope, scopeID))
+		}
+		return nil, err
+	}
+
+	return &setting, nil
+}
+
+func (repo *sqliteRepo) ShouldStripMetadata(ctx context.Context, guildID string, memberID string) (bool, error) {
+	var strip bool
+	err := repo.dbConn.QueryRowContext(ctx, shouldStripMetadataQuery, guildID, memberID).Scan(&strip)
+	return strip, err
+}
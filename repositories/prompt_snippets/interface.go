@@ -0,0 +1,15 @@
+package prompt_snippets
+
+import (
+	"context"
+
+	"stable_diffusion_bot/entities"
+)
+
+type Repository interface {
+	// Save creates the snippet or overwrites the text of an existing snippet with the same name
+	Save(ctx context.Context, snippet *entities.PromptSnippet) (*entities.PromptSnippet, error)
+	Get(ctx context.Context, guildID string, name string) (*entities.PromptSnippet, error)
+	List(ctx context.Context, guildID string) ([]*entities.PromptSnippet, error)
+	Delete(ctx context.Context, guildID string, name string) error
+}
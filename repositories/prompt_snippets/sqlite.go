@@ -0,0 +1,121 @@
+package prompt_snippets
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+
+	"stable_diffusion_bot/clock"
+	"stable_diffusion_bot/entities"
+	"stable_diffusion_bot/repositories"
+)
+
+const saveSnippetQuery string = `
+INSERT INTO prompt_snippets (guild_id, name, text, updated_at) VALUES (?, ?, ?, ?)
+ON CONFLICT (guild_id, name) DO UPDATE SET text = excluded.text, updated_at = excluded.updated_at;
+`
+
+const getSnippetQuery string = `
+SELECT guild_id, name, text, updated_at FROM prompt_snippets WHERE guild_id = ? AND name = ?;
+`
+
+const listSnippetsQuery string = `
+SELECT guild_id, name, text, updated_at FROM prompt_snippets WHERE guild_id = ? ORDER BY name;
+`
+
+const deleteSnippetQuery string = `
+DELETE FROM prompt_snippets WHERE guild_id = ? AND name = ?;
+`
+
+type sqliteRepo struct {
+	dbConn    *sql.DB
+	clock     clock.Clock
+	writeLock *sync.Mutex
+}
+
+type Config struct {
+	DB *sql.DB
+}
+
+func NewRepository(cfg *Config) (Repository, error) {
+	if cfg.DB == nil {
+		return nil, errors.New("missing DB parameter")
+	}
+
+	newRepo := &sqliteRepo{
+		dbConn:    cfg.DB,
+		clock:     clock.NewClock(),
+		writeLock: repositories.WriteLock(cfg.DB),
+	}
+
+	return newRepo, nil
+}
+
+func (repo *sqliteRepo) Save(ctx context.Context, snippet *entities.PromptSnippet) (*entities.PromptSnippet, error) {
+	repo.writeLock.Lock()
+	defer repo.writeLock.Unlock()
+
+	snippet.UpdatedAt = repo.clock.Now()
+
+	_, err := repo.dbConn.ExecContext(ctx, saveSnippetQuery, snippet.GuildID, snippet.Name, snippet.Text, snippet.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return snippet, nil
+}
+
+func (repo *sqliteRepo) Get(ctx context.Context, guildID string, name string) (*entities.PromptSnippet, error) {
+	var snippet entities.PromptSnippet
+	err := repo.dbConn.QueryRowContext(ctx, getSnippetQuery, guildID, name).Scan(
+		&snippet.GuildID, &snippet.Name, &snippet.Text, &snippet.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, repositories.NewNotFoundError(fmt.Sprintf("snippet %s", name))
+		}
+		return nil, err
+	}
+
+	return &snippet, nil
+}
+
+func (repo *sqliteRepo) List(ctx context.Context, guildID string) ([]*entities.PromptSnippet, error) {
+	rows, err := repo.dbConn.QueryContext(ctx, listSnippetsQuery, guildID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snippets []*entities.PromptSnippet
+	for rows.Next() {
+		var snippet entities.PromptSnippet
+		if err := rows.Scan(&snippet.GuildID, &snippet.Name, &snippet.Text, &snippet.UpdatedAt); err != nil {
+			return nil, err
+		}
+		snippets = append(snippets, &snippet)
+	}
+
+	return snippets, rows.Err()
+}
+
+func (repo *sqliteRepo) Delete(ctx context.Context, guildID string, name string) error {
+	repo.writeLock.Lock()
+	defer repo.writeLock.Unlock()
+
+	res, err := repo.dbConn.ExecContext(ctx, deleteSnippetQuery, guildID, name)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return repositories.NewNotFoundError(fmt.Sprintf("snippet %s", name))
+	}
+
+	return nil
+}
@@ -0,0 +1,14 @@
+package refine_steps
+
+import (
+	"context"
+
+	"stable_diffusion_bot/entities"
+)
+
+type Repository interface {
+	Create(ctx context.Context, step *entities.RefineStep) (*entities.RefineStep, error)
+	GetByMessageID(ctx context.Context, messageID string) (*entities.RefineStep, error)
+	// ListByRootMessageID returns the steps of a chain in order
+	ListByRootMessageID(ctx context.Context, rootMessageID string) ([]*entities.RefineStep, error)
+}
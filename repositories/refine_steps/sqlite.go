@@ -0,0 +1,111 @@
+package refine_steps
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+
+	"stable_diffusion_bot/clock"
+	"stable_diffusion_bot/entities"
+	"stable_diffusion_bot/repositories"
+)
+
+const insertRefineStepQuery string = `
+INSERT INTO refine_steps (message_id, guild_id, channel_id, parent_message_id, parent_sort_order, root_message_id, step, denoising_strength, created_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);
+`
+
+const selectRefineStepColumns string = `
+SELECT message_id, guild_id, channel_id, parent_message_id, parent_sort_order, root_message_id, step, denoising_strength, created_at FROM refine_steps
+`
+
+const getRefineStepQuery string = selectRefineStepColumns + `WHERE message_id = ?;`
+
+const listRefineStepsQuery string = selectRefineStepColumns + `WHERE root_message_id = ? ORDER BY step, created_at;`
+
+type sqliteRepo struct {
+	dbConn    *sql.DB
+	clock     clock.Clock
+	writeLock *sync.Mutex
+}
+
+type Config struct {
+	DB *sql.DB
+}
+
+func NewRepository(cfg *Config) (Repository, error) {
+	if cfg.DB == nil {
+		return nil, errors.New("missing DB parameter")
+	}
+
+	newRepo := &sqliteRepo{
+		dbConn:    cfg.DB,
+		clock:     clock.NewClock(),
+		writeLock: repositories.WriteLock(cfg.DB),
+	}
+
+	return newRepo, nil
+}
+
+func (repo *sqliteRepo) Create(ctx context.Context, step *entities.RefineStep) (*entities.RefineStep, error) {
+	repo.writeLock.Lock()
+	defer repo.writeLock.Unlock()
+
+	step.CreatedAt = repo.clock.Now()
+
+	_, err := repo.dbConn.ExecContext(ctx, insertRefineStepQuery,
+		step.MessageID, step.GuildID, step.ChannelID, step.ParentMessageID, step.ParentSortOrder, step.RootMessageID,
+		step.Step, step.DenoisingStrength, step.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return step, nil
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanStep(row scanner) (*entities.RefineStep, error) {
+	var step entities.RefineStep
+	err := row.Scan(&step.MessageID, &step.GuildID, &step.ChannelID, &step.ParentMessageID, &step.ParentSortOrder,
+		&step.RootMessageID, &step.Step, &step.DenoisingStrength, &step.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &step, nil
+}
+
+func (repo *sqliteRepo) GetByMessageID(ctx context.Context, messageID string) (*entities.RefineStep, error) {
+	step, err := scanStep(repo.dbConn.QueryRowContext(ctx, getRefineStepQuery, messageID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, repositories.NewNotFoundError(fmt.Sprintf("refine step for message %s", messageID))
+		}
+		return nil, err
+	}
+
+	return step, nil
+}
+
+func (repo *sqliteRepo) ListByRootMessageID(ctx context.Context, rootMessageID string) ([]*entities.RefineStep, error) {
+	rows, err := repo.dbConn.QueryContext(ctx, listRefineStepsQuery, rootMessageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var steps []*entities.RefineStep
+	for rows.Next() {
+		step, err := scanStep(rows)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, step)
+	}
+
+	return steps, rows.Err()
+}
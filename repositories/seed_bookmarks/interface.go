@@ -0,0 +1,15 @@
+package seed_bookmarks
+
+import (
+	"context"
+
+	"stable_diffusion_bot/entities"
+)
+
+type Repository interface {
+	// Save creates the bookmark or overwrites the seed of an existing bookmark with the same name
+	Save(ctx context.Context, bookmark *entities.SeedBookmark) (*entities.SeedBookmark, error)
+	Get(ctx context.Context, memberID string, name string) (*entities.SeedBookmark, error)
+	List(ctx context.Context, memberID string) ([]*entities.SeedBookmark, error)
+	Delete(ctx context.Context, memberID string, name string) error
+}
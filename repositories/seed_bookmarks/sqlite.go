@@ -0,0 +1,121 @@
+package seed_bookmarks
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+
+	"stable_diffusion_bot/clock"
+	"stable_diffusion_bot/entities"
+	"stable_diffusion_bot/repositories"
+)
+
+const saveBookmarkQuery string = `
+INSERT INTO seed_bookmarks (member_id, name, seed, created_at) VALUES (?, ?, ?, ?)
+ON CONFLICT (member_id, name) DO UPDATE SET seed = excluded.seed, created_at = excluded.created_at;
+`
+
+const getBookmarkQuery string = `
+SELECT member_id, name, seed, created_at FROM seed_bookmarks WHERE member_id = ? AND name = ?;
+`
+
+const listBookmarksQuery string = `
+SELECT member_id, name, seed, created_at FROM seed_bookmarks WHERE member_id = ? ORDER BY name;
+`
+
+const deleteBookmarkQuery string = `
+DELETE FROM seed_bookmarks WHERE member_id = ? AND name = ?;
+`
+
+type sqliteRepo struct {
+	dbConn    *sql.DB
+	clock     clock.Clock
+	writeLock *sync.Mutex
+}
+
+type Config struct {
+	DB *sql.DB
+}
+
+func NewRepository(cfg *Config) (Repository, error) {
+	if cfg.DB == nil {
+		return nil, errors.New("missing DB parameter")
+	}
+
+	newRepo := &sqliteRepo{
+		dbConn:    cfg.DB,
+		clock:     clock.NewClock(),
+		writeLock: repositories.WriteLock(cfg.DB),
+	}
+
+	return newRepo, nil
+}
+
+func (repo *sqliteRepo) Save(ctx context.Context, bookmark *entities.SeedBookmark) (*entities.SeedBookmark, error) {
+	repo.writeLock.Lock()
+	defer repo.writeLock.Unlock()
+
+	bookmark.CreatedAt = repo.clock.Now()
+
+	_, err := repo.dbConn.ExecContext(ctx, saveBookmarkQuery, bookmark.MemberID, bookmark.Name, bookmark.Seed, bookmark.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return bookmark, nil
+}
+
+func (repo *sqliteRepo) Get(ctx context.Context, memberID string, name string) (*entities.SeedBookmark, error) {
+	var bookmark entities.SeedBookmark
+	err := repo.dbConn.QueryRowContext(ctx, getBookmarkQuery, memberID, name).Scan(
+		&bookmark.MemberID, &bookmark.Name, &bookmark.Seed, &bookmark.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, repositories.NewNotFoundError(fmt.Sprintf("seed bookmark %s", name))
+		}
+		return nil, err
+	}
+
+	return &bookmark, nil
+}
+
+func (repo *sqliteRepo) List(ctx context.Context, memberID string) ([]*entities.SeedBookmark, error) {
+	rows, err := repo.dbConn.QueryContext(ctx, listBookmarksQuery, memberID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bookmarks []*entities.SeedBookmark
+	for rows.Next() {
+		var bookmark entities.SeedBookmark
+		if err := rows.Scan(&bookmark.MemberID, &bookmark.Name, &bookmark.Seed, &bookmark.CreatedAt); err != nil {
+			return nil, err
+		}
+		bookmarks = append(bookmarks, &bookmark)
+	}
+
+	return bookmarks, rows.Err()
+}
+
+func (repo *sqliteRepo) Delete(ctx context.Context, memberID string, name string) error {
+	repo.writeLock.Lock()
+	defer repo.writeLock.Unlock()
+
+	res, err := repo.dbConn.ExecContext(ctx, deleteBookmarkQuery, memberID, name)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return repositories.NewNotFoundError(fmt.Sprintf("seed bookmark %s", name))
+	}
+
+	return nil
+}
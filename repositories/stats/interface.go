@@ -0,0 +1,16 @@
+package stats
+
+import (
+	"context"
+	"time"
+
+	"stable_diffusion_bot/entities"
+)
+
+// Repository reads the daily_stats rollup, which is maintained by image_generations on write.
+// An empty guildID or memberID matches every guild or member.
+type Repository interface {
+	CountImages(ctx context.Context, guildID string, memberID string, since time.Time) (int, error)
+	TopMembers(ctx context.Context, guildID string, since time.Time, limit int) ([]*entities.StatsEntry, error)
+	TopCheckpoints(ctx context.Context, guildID string, memberID string, since time.Time, limit int) ([]*entities.StatsEntry, error)
+}
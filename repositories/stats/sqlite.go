@@ -0,0 +1,83 @@
+package stats
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"stable_diffusion_bot/entities"
+)
+
+// statsScope matches every guild or member when the parameter is empty
+const statsScope string = ` WHERE day >= ?1 AND (?2 = '' OR guild_id = ?2) AND (?3 = '' OR member_id = ?3)`
+
+const countImagesQuery string = `SELECT COALESCE(SUM(images), 0) FROM daily_stats` + statsScope + `;`
+
+const topMembersQuery string = `SELECT member_id, SUM(images) AS total FROM daily_stats` + statsScope +
+	` GROUP BY member_id ORDER BY total DESC, member_id LIMIT ?4;`
+
+const topCheckpointsQuery string = `SELECT checkpoint, SUM(images) AS total FROM daily_stats` + statsScope +
+	` GROUP BY checkpoint ORDER BY total DESC, checkpoint LIMIT ?4;`
+
+type sqliteRepo struct {
+	dbConn *sql.DB
+}
+
+type Config struct {
+	DB *sql.DB
+}
+
+func NewRepository(cfg *Config) (Repository, error) {
+	if cfg.DB == nil {
+		return nil, errors.New("missing DB parameter")
+	}
+
+	newRepo := &sqliteRepo{
+		dbConn: cfg.DB,
+	}
+
+	return newRepo, nil
+}
+
+func (repo *sqliteRepo) CountImages(ctx context.Context, guildID string, memberID string, since time.Time) (int, error) {
+	var count int
+	err := repo.dbConn.QueryRowContext(ctx, countImagesQuery, day(since), guildID, memberID).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (repo *sqliteRepo) TopMembers(ctx context.Context, guildID string, since time.Time, limit int) ([]*entities.StatsEntry, error) {
+	return repo.query(ctx, topMembersQuery, day(since), guildID, "", limit)
+}
+
+func (repo *sqliteRepo) TopCheckpoints(ctx context.Context, guildID string, memberID string, since time.Time, limit int) ([]*entities.StatsEntry, error) {
+	return repo.query(ctx, topCheckpointsQuery, day(since), guildID, memberID, limit)
+}
+
+func (repo *sqliteRepo) query(ctx context.Context, query string, args ...any) ([]*entities.StatsEntry, error) {
+	rows, err := repo.dbConn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*entities.StatsEntry
+	for rows.Next() {
+		var entry entities.StatsEntry
+		if err := rows.Scan(&entry.Key, &entry.Images); err != nil {
+			return nil, err
+		}
+		entries = append(entries, &entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// day formats since the same way as the rollup rows, which are keyed by UTC day
+func day(since time.Time) string {
+	return since.UTC().Format(time.DateOnly)
+}
@@ -0,0 +1,16 @@
+package usage
+
+import (
+	"context"
+	"time"
+
+	"stable_diffusion_bot/entities"
+)
+
+type Repository interface {
+	// Record adds the usage to the member's running totals for the day and backend
+	Record(ctx context.Context, usage *entities.Usage) error
+	GetByMemberID(ctx context.Context, memberID string, since time.Time) ([]*entities.Usage, error)
+	// AnlasSpent returns the Anlas the member spent on NovelAI on the UTC day and month of now
+	AnlasSpent(ctx context.Context, memberID string, now time.Time) (today, month int64, err error)
+}
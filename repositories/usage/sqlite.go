@@ -0,0 +1,97 @@
+package usage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	"stable_diffusion_bot/clock"
+	"stable_diffusion_bot/entities"
+	"stable_diffusion_bot/repositories"
+)
+
+const dayFormat = "2006-01-02"
+
+const recordUsageQuery string = `
+INSERT INTO usage (member_id, day, backend, images, megapixels, gpu_seconds, anlas) VALUES (?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (member_id, day, backend) DO UPDATE SET
+    images = images + excluded.images,
+    megapixels = megapixels + excluded.megapixels,
+    gpu_seconds = gpu_seconds + excluded.gpu_seconds,
+    anlas = anlas + excluded.anlas;
+`
+
+const getUsageByMemberIDQuery string = `
+SELECT member_id, day, backend, images, megapixels, gpu_seconds, anlas FROM usage WHERE member_id = ? AND day >= ? ORDER BY day DESC, backend;
+`
+
+const anlasSpentQuery string = `
+SELECT COALESCE(SUM(CASE WHEN day = ? THEN anlas END), 0), COALESCE(SUM(anlas), 0) FROM usage WHERE member_id = ? AND backend = ? AND day >= ?;
+`
+
+type sqliteRepo struct {
+	dbConn    *sql.DB
+	clock     clock.Clock
+	writeLock *sync.Mutex
+}
+
+type Config struct {
+	DB *sql.DB
+}
+
+func NewRepository(cfg *Config) (Repository, error) {
+	if cfg.DB == nil {
+		return nil, errors.New("missing DB parameter")
+	}
+
+	newRepo := &sqliteRepo{
+		dbConn:    cfg.DB,
+		clock:     clock.NewClock(),
+		writeLock: repositories.WriteLock(cfg.DB),
+	}
+
+	return newRepo, nil
+}
+
+func (repo *sqliteRepo) Record(ctx context.Context, usage *entities.Usage) error {
+	repo.writeLock.Lock()
+	defer repo.writeLock.Unlock()
+
+	if usage.Day == "" {
+		usage.Day = repo.clock.Now().UTC().Format(dayFormat)
+	}
+
+	_, err := repo.dbConn.ExecContext(ctx, recordUsageQuery,
+		usage.MemberID, usage.Day, usage.Backend, usage.Images, usage.Megapixels, usage.GPUSeconds, usage.Anlas)
+	return err
+}
+
+func (repo *sqliteRepo) GetByMemberID(ctx context.Context, memberID string, since time.Time) ([]*entities.Usage, error) {
+	rows, err := repo.dbConn.QueryContext(ctx, getUsageByMemberIDQuery, memberID, since.UTC().Format(dayFormat))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var usages []*entities.Usage
+	for rows.Next() {
+		var usage entities.Usage
+		err := rows.Scan(&usage.MemberID, &usage.Day, &usage.Backend, &usage.Images, &usage.Megapixels, &usage.GPUSeconds, &usage.Anlas)
+		if err != nil {
+			return nil, err
+		}
+		usages = append(usages, &usage)
+	}
+
+	return usages, rows.Err()
+}
+
+func (repo *sqliteRepo) AnlasSpent(ctx context.Context, memberID string, now time.Time) (today, month int64, err error) {
+	now = now.UTC()
+	startOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	err = repo.dbConn.QueryRowContext(ctx, anlasSpentQuery,
+		now.Format(dayFormat), memberID, entities.BackendNovelAI, startOfMonth.Format(dayFormat)).Scan(&today, &month)
+	return today, month, err
+}
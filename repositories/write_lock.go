@@ -0,0 +1,15 @@
+package repositories
+
+import (
+	"database/sql"
+	"sync"
+)
+
+var writeLocks sync.Map
+
+// WriteLock returns the mutex shared by every repository writing to db.
+// SQLite only allows a single writer, serializing writes here avoids "database is locked" errors.
+func WriteLock(db *sql.DB) *sync.Mutex {
+	lock, _ := writeLocks.LoadOrStore(db, new(sync.Mutex))
+	return lock.(*sync.Mutex)
+}
@@ -0,0 +1,285 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/png"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// MaxAttachmentSize is the largest attachment downloaded by default
+	MaxAttachmentSize = 16 << 20
+	// MaxAttachmentPixels is the most pixels an attachment is decoded with by default, so a small file can't
+	// decompress into gigabytes
+	MaxAttachmentPixels = 64 << 20
+)
+
+// AttachmentFormats are the content types accepted by default
+var AttachmentFormats = []string{"image/png", "image/jpeg", "image/webp"}
+
+// AttachmentLimits are the checks DownloadAttachment runs on an attachment. The zero value uses the defaults.
+type AttachmentLimits struct {
+	// MaxBytes is the largest file accepted. Default is MaxAttachmentSize
+	MaxBytes int
+	// MaxPixels is the most pixels accepted. Default is MaxAttachmentPixels
+	MaxPixels int
+	// Formats are the sniffed content types accepted. Default is AttachmentFormats
+	Formats []string
+}
+
+func (l AttachmentLimits) withDefaults() AttachmentLimits {
+	if l.MaxBytes <= 0 {
+		l.MaxBytes = MaxAttachmentSize
+	}
+	if l.MaxPixels <= 0 {
+		l.MaxPixels = MaxAttachmentPixels
+	}
+	if len(l.Formats) == 0 {
+		l.Formats = AttachmentFormats
+	}
+	return l
+}
+
+// AttachmentError is returned for attachments that can't be used as an image. Its message is written for members.
+type AttachmentError struct {
+	Filename string
+	Reason   string
+}
+
+func (e *AttachmentError) Error() string {
+	if e.Filename == "" {
+		return fmt.Sprintf("The attachment %s.", e.Reason)
+	}
+	return fmt.Sprintf("The attachment `%s` %s.", e.Filename, e.Reason)
+}
+
+var attachmentClient = &http.Client{Timeout: time.Minute}
+
+// DownloadAttachmentData downloads attachment as it is, failing once it's larger than maxBytes.
+// maxBytes <= 0 uses MaxAttachmentSize.
+func DownloadAttachmentData(attachment *discordgo.MessageAttachment, maxBytes int) ([]byte, error) {
+	if maxBytes <= 0 {
+		maxBytes = MaxAttachmentSize
+	}
+	if attachment.Size > maxBytes {
+		return nil, &AttachmentError{attachment.Filename, fmt.Sprintf("is larger than %s", byteSize(maxBytes))}
+	}
+
+	response, err := attachmentClient.Get(attachment.URL)
+	if err != nil {
+		return nil, fmt.Errorf("error downloading %s: %w", attachment.Filename, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error downloading %s: %s", attachment.Filename, response.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(response.Body, int64(maxBytes)+1))
+	if err != nil {
+		return nil, fmt.Errorf("error downloading %s: %w", attachment.Filename, err)
+	}
+	if len(data) > maxBytes {
+		return nil, &AttachmentError{attachment.Filename, fmt.Sprintf("is larger than %s", byteSize(maxBytes))}
+	}
+	return data, nil
+}
+
+// DownloadAttachment downloads attachment and returns it as a PNG, turned upright if its EXIF orientation says so.
+// Its size, pixel count and sniffed content type are checked against limits instead of trusting what Discord reports.
+// WebP is kept as it is when no decoder is registered for it.
+func DownloadAttachment(attachment *discordgo.MessageAttachment, limits AttachmentLimits) (*Image, error) {
+	limits = limits.withDefaults()
+	data, err := DownloadAttachmentData(attachment, limits.MaxBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	converted, err := IngestImage(data, limits)
+	if err != nil {
+		var ingest *AttachmentError
+		if errors.As(err, &ingest) {
+			ingest.Filename = attachment.Filename
+		}
+		return nil, err
+	}
+	return ImageFromBytes(converted), nil
+}
+
+// IngestImage checks data against limits and returns it as an upright PNG, see DownloadAttachment
+func IngestImage(data []byte, limits AttachmentLimits) ([]byte, error) {
+	limits = limits.withDefaults()
+
+	contentType := http.DetectContentType(data)
+	if !slices.Contains(limits.Formats, contentType) {
+		return nil, &AttachmentError{Reason: fmt.Sprintf("is %s, attach %s", describeContentType(contentType), describeFormats(limits.Formats))}
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if errors.Is(err, image.ErrFormat) && contentType == "image/webp" {
+		return data, nil
+	}
+	if err != nil {
+		return nil, &AttachmentError{Reason: "could not be read as an image"}
+	}
+	if config.Width*config.Height > limits.MaxPixels {
+		return nil, &AttachmentError{Reason: fmt.Sprintf("is %dx%d, larger than %.0f megapixels", config.Width, config.Height, float64(limits.MaxPixels)/1_000_000)}
+	}
+
+	orientation := exifOrientation(data)
+	if format == "png" && orientation <= 1 {
+		return data, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, &AttachmentError{Reason: "could not be read as an image"}
+	}
+
+	var out bytes.Buffer
+	if err := png.Encode(&out, orient(img, orientation)); err != nil {
+		return nil, fmt.Errorf("error converting image to png: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+// exifOrientation returns the orientation tag of a JPEG, or 0 if it has none
+func exifOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 0
+	}
+	for offset := 2; offset+4 <= len(data); {
+		if data[offset] != 0xFF {
+			return 0
+		}
+		marker := data[offset+1]
+		length := int(binary.BigEndian.Uint16(data[offset+2:]))
+		// the image data follows the start of scan, there's no EXIF after it
+		if marker == 0xDA || length < 2 || offset+2+length > len(data) {
+			return 0
+		}
+		segment := data[offset+4 : offset+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return tiffOrientation(segment[6:])
+		}
+		offset += 2 + length
+	}
+	return 0
+}
+
+// tiffOrientation reads tag 0x0112 from the first IFD of the TIFF header of an EXIF segment
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 0
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+	return 0
+}
+
+// orient turns img upright for an EXIF orientation from 2 to 8, other orientations return img as it is
+func orient(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	src := toNRGBA(img)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+
+	dstW, dstH := w, h
+	if orientation >= 5 {
+		dstW, dstH = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dstW, dstH))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			copy(dst.Pix[dst.PixOffset(dx, dy):][:4], src.Pix[src.PixOffset(src.Rect.Min.X+x, src.Rect.Min.Y+y):][:4])
+		}
+	}
+	return dst
+}
+
+// formatNames are how content types are written to members
+var formatNames = map[string]string{"png": "PNG", "jpeg": "JPEG", "webp": "WebP", "gif": "GIF", "bmp": "BMP"}
+
+func formatName(contentType string) string {
+	_, subtype, _ := strings.Cut(contentType, "/")
+	if name, ok := formatNames[subtype]; ok {
+		return name
+	}
+	return strings.ToUpper(subtype)
+}
+
+func describeContentType(contentType string) string {
+	if !strings.HasPrefix(contentType, "image/") {
+		return "not an image"
+	}
+	return "a " + formatName(contentType)
+}
+
+func describeFormats(formats []string) string {
+	names := make([]string, len(formats))
+	for i, format := range formats {
+		names[i] = formatName(format)
+	}
+	if len(names) == 1 {
+		return "a " + names[0]
+	}
+	return "a " + strings.Join(names[:len(names)-1], ", ") + " or " + names[len(names)-1]
+}
+
+func byteSize(n int) string {
+	if n >= 1<<20 {
+		return fmt.Sprintf("%d MiB", n>>20)
+	}
+	return fmt.Sprintf("%d KiB", n>>10)
+}
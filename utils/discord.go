@@ -2,7 +2,10 @@ package utils
 
 import (
 	"errors"
+	"fmt"
 	"reflect"
+	"regexp"
+	"strings"
 
 	"github.com/bwmarrin/discordgo"
 )
@@ -72,3 +75,15 @@ func GetReference(s *discordgo.Session, r *discordgo.MessageReference) (*discord
 	}
 	return retrieve, nil
 }
+
+var messageLinkRegex = regexp.MustCompile(`^https?://(?:(?:ptb|canary)\.)?discord(?:app)?\.com/channels/(@me|\d+)/(\d+)/(\d+)/?$`)
+
+// ParseMessageLink extracts the guild, channel and message IDs from a Discord message link.
+// Links to direct messages return "@me" as the guild ID.
+func ParseMessageLink(link string) (guildID, channelID, messageID string, err error) {
+	matches := messageLinkRegex.FindStringSubmatch(strings.TrimSpace(link))
+	if matches == nil {
+		return "", "", "", fmt.Errorf("invalid message link: %q", link)
+	}
+	return matches[1], matches[2], matches[3], nil
+}
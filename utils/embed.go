@@ -1,10 +1,15 @@
 package utils
 
 import (
+	"archive/zip"
+	"bytes"
 	"errors"
 	"fmt"
+	"image"
 	"io"
+	"log"
 	"slices"
+	"strconv"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
@@ -16,6 +21,34 @@ import (
 // If there are more than four images, they will be tiled into a single image.
 // images and thumbnails are expected to be in bytes and not base64 encoded.
 func EmbedImages(webhook *discordgo.WebhookEdit, embed *discordgo.MessageEmbed, images, thumbnails []io.Reader, compositor composite_renderer.Renderer) error {
+	return EmbedImagesWithOptions(webhook, embed, images, thumbnails, compositor, EmbedOptions{})
+}
+
+// EmbedOptions configures EmbedImagesWithOptions.
+type EmbedOptions struct {
+	// Labels are drawn on each tile when images are tiled, if the compositor implements composite_renderer.LabelRenderer
+	Labels *composite_renderer.LabelOptions
+	// UploadLimit is the upload limit of the channel, see UploadLimit. Default is composite_renderer.DiscordUploadLimit
+	UploadLimit int
+	// PreviewSize downscales each attachment so its longest side is at most this many pixels. Default keeps the full size
+	PreviewSize int
+	// Archive attaches the full resolution images as a ZIP when they are tiled into a grid, if it fits the upload limit
+	Archive bool
+	// ImageNames names the files in the archive, without extension. Default is the image index
+	ImageNames []string
+	// Individual uploads more than four images as separate attachments instead of tiling them, if they fit in one message
+	Individual bool
+	// Parameters are written to the parameters text chunk of each PNG attachment once it's tiled and re-encoded, which
+	// drop it. A grid gets the parameters of its first image like the WebUI's. JPEG attachments go without
+	Parameters []string
+}
+
+// maxAttachments is the most files Discord allows on one message
+const maxAttachments = 10
+
+// EmbedImagesWithOptions is EmbedImages with labels and an upload limit.
+// If the compositor implements composite_renderer.Reencoder, attachments are re-encoded to fit the upload limit.
+func EmbedImagesWithOptions(webhook *discordgo.WebhookEdit, embed *discordgo.MessageEmbed, images, thumbnails []io.Reader, compositor composite_renderer.Renderer, opts EmbedOptions) error {
 	if webhook == nil {
 		return errors.New("imageEmbedFromBuffers called with nil webhook")
 	}
@@ -38,31 +71,58 @@ func EmbedImages(webhook *discordgo.WebhookEdit, embed *discordgo.MessageEmbed,
 	embeds := make([]*discordgo.MessageEmbed, 1, embedCount+1)
 	embeds[0] = embed
 
+	reencoder, _ := compositor.(composite_renderer.Reencoder)
+	var configuredLimit int
+	if reencoder != nil {
+		configuredLimit = reencoder.EncodeOptions().MaxBytes
+	}
+	totalBudget := uploadBudget(configuredLimit, opts.UploadLimit)
+
+	var thumbnailTile io.Reader
 	thumbnails = slices.DeleteFunc(thumbnails, func(i io.Reader) bool { return i == nil })
 	if len(thumbnails) > 0 {
-		thumbnailTile, err := compositor.TileImages(thumbnails)
+		var err error
+		thumbnailTile, err = compositor.TileImages(thumbnails)
 		if err != nil {
 			return fmt.Errorf("error tiling thumbnails: %w", err)
 		}
-
-		if thumbnailTile != nil {
-			embed.Thumbnail = &discordgo.MessageEmbedThumbnail{
-				URL: "attachment://thumbnail.png",
-			}
-			files = append(files, &discordgo.File{
-				Name:   "thumbnail.png",
-				Reader: thumbnailTile,
-			})
-		}
 	}
 
 	images = slices.DeleteFunc(images, func(i io.Reader) bool { return i == nil })
-	if len(images) > 4 { // Tile images if more than four
+	// Discord shows up to four embeds of the same URL as a gallery, more individual images are posted as plain attachments
+	individual := opts.Individual && len(images) > 4 && len(images)+min(len(thumbnails), 1) <= maxAttachments
+	if len(images) > 4 && !individual { // Tile images if more than four
 		if compositor == nil {
 			return errors.New("compositor is required for tiling more than four images")
 		}
 
-		primaryTile, err := compositor.TileImages(images)
+		if opts.Archive {
+			var archive []byte
+			var err error
+			archive, images, err = zipImages(images, opts.ImageNames)
+			if err != nil {
+				return fmt.Errorf("error archiving images: %w", err)
+			}
+			// leave at least half of the upload limit for the grid and thumbnail
+			if len(archive) <= totalBudget/2 {
+				files = append(files, &discordgo.File{
+					Name:        nowFormatted + ".zip",
+					ContentType: "application/zip",
+					Reader:      bytes.NewReader(archive),
+				})
+				totalBudget -= len(archive)
+			} else {
+				log.Printf("Not attaching a %d byte archive, it doesn't fit the upload limit", len(archive))
+			}
+		}
+
+		var primaryTile io.Reader
+		var err error
+		if labeler, ok := compositor.(composite_renderer.LabelRenderer); ok && opts.Labels != nil {
+			primaryTile, err = labeler.TileLabeledImages(images, opts.Labels)
+		} else {
+			primaryTile, err = compositor.TileImages(images)
+		}
 		if err != nil {
 			return fmt.Errorf("error tiling primary images: %w", err)
 		}
@@ -75,19 +135,78 @@ func EmbedImages(webhook *discordgo.WebhookEdit, embed *discordgo.MessageEmbed,
 		}
 	}
 
+	if opts.PreviewSize > 0 {
+		err := ForEach(len(images), func(i int) error {
+			preview, err := composite_renderer.Thumbnail(images[i], opts.PreviewSize)
+			if err != nil {
+				return fmt.Errorf("error creating preview of image %d: %w", i, err)
+			}
+			images[i] = preview
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// Split the upload budget evenly between all attachments
+	budget := totalBudget / max(len(images)+min(len(thumbnails), 1), 1)
+
+	if thumbnailTile != nil {
+		thumbnail, format, err := reencode(reencoder, thumbnailTile, budget)
+		if err != nil {
+			return fmt.Errorf("error encoding thumbnail: %w", err)
+		}
+		thumbnailName := "thumbnail." + format.Extension
+		embed.Thumbnail = &discordgo.MessageEmbedThumbnail{
+			URL: "attachment://" + thumbnailName,
+		}
+		files = append(files, &discordgo.File{
+			Name:        thumbnailName,
+			ContentType: format.ContentType,
+			Reader:      thumbnail,
+		})
+	}
+
+	// Encode the attachments concurrently, each one is searched for the best quality that fits the budget
+	formats := make([]composite_renderer.Format, len(images))
+	err := ForEach(len(images), func(i int) error {
+		if images[i] == nil {
+			return nil
+		}
+		var err error
+		images[i], formats[i], err = reencode(reencoder, images[i], budget)
+		if err != nil {
+			return fmt.Errorf("error encoding image %d: %w", i, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := range images {
+		if images[i] != nil && i < len(opts.Parameters) && opts.Parameters[i] != "" && formats[i].Name == "png" {
+			images[i] = withParameters(images[i], opts.Parameters[i])
+		}
+	}
+
 	// Create separate embeds for four or fewer images
 	for i, imgBuf := range images {
 		if imgBuf == nil {
 			continue
 		}
 
-		imgName := fmt.Sprintf("%v-%d.png", nowFormatted, i)
+		imgName := fmt.Sprintf("%v-%d.%s", nowFormatted, i, formats[i].Extension)
 		files = append(files, &discordgo.File{
 			Name:        imgName,
-			ContentType: "image/png",
+			ContentType: formats[i].ContentType,
 			Reader:      imgBuf,
 		})
 
+		if individual {
+			continue
+		}
 		embeds = append(embeds, &discordgo.MessageEmbed{
 			Type: discordgo.EmbedTypeImage,
 			URL:  "https://github.com/ellypaws/sd-discord-bot",
@@ -101,3 +220,106 @@ func EmbedImages(webhook *discordgo.WebhookEdit, embed *discordgo.MessageEmbed,
 	webhook.Files = files
 	return nil
 }
+
+// withParameters writes parameters into the text chunk of the PNG read by r, returning it as is on failure
+func withParameters(r io.Reader, parameters string) io.Reader {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		log.Printf("Error reading image for png info: %v", err)
+		return bytes.NewReader(data)
+	}
+	withInfo, err := composite_renderer.SetTextChunk(data, composite_renderer.ParametersKey, parameters)
+	if err != nil {
+		log.Printf("Error writing png info: %v", err)
+		return bytes.NewReader(data)
+	}
+	return bytes.NewReader(withInfo)
+}
+
+// zipImages stores the images uncompressed in a ZIP archive, as they are already compressed.
+// It returns readers over the same images, as reading them consumes the originals.
+func zipImages(images []io.Reader, names []string) ([]byte, []io.Reader, error) {
+	buf := new(bytes.Buffer)
+	archive := zip.NewWriter(buf)
+	for i, img := range images {
+		data, err := io.ReadAll(img)
+		if err != nil {
+			return nil, nil, err
+		}
+		images[i] = bytes.NewReader(data)
+
+		name := strconv.Itoa(i + 1)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		extension := "png"
+		if _, format, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+			if f, ok := composite_renderer.LookupFormat(format); ok {
+				extension = f.Extension
+			}
+		}
+
+		w, err := archive.CreateHeader(&zip.FileHeader{Name: name + "." + extension, Method: zip.Store, Modified: time.Now()})
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, err := w.Write(data); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, nil, err
+	}
+	return buf.Bytes(), images, nil
+}
+
+// reencode fits r in budget if reencoder is set, otherwise r is assumed to be a PNG.
+func reencode(reencoder composite_renderer.Reencoder, r io.Reader, budget int) (io.Reader, composite_renderer.Format, error) {
+	if reencoder == nil {
+		return r, composite_renderer.Format{Name: "png", Extension: "png", ContentType: "image/png"}, nil
+	}
+	return reencoder.Reencode(r, budget)
+}
+
+// uploadBudget returns the smaller of the configured and detected limits, leaving room for the rest of the request
+func uploadBudget(configured, detected int) int {
+	limit := composite_renderer.DiscordUploadLimit
+	switch {
+	case configured > 0 && detected > 0:
+		limit = min(configured, detected)
+	case configured > 0:
+		limit = configured
+	case detected > 0:
+		limit = detected
+	}
+	return limit - limit/20
+}
+
+// UploadLimit returns the attachment size limit of the guild based on its boost tier.
+// Direct messages and guilds that can't be retrieved use composite_renderer.DiscordUploadLimit.
+func UploadLimit(s *discordgo.Session, guildID string) int {
+	if s == nil || guildID == "" {
+		return composite_renderer.DiscordUploadLimit
+	}
+
+	var guild *discordgo.Guild
+	var err error
+	if s.State != nil {
+		guild, err = s.State.Guild(guildID)
+	}
+	if guild == nil || err != nil {
+		guild, err = s.Guild(guildID)
+		if err != nil {
+			return composite_renderer.DiscordUploadLimit
+		}
+	}
+
+	switch guild.PremiumTier {
+	case discordgo.PremiumTier3:
+		return 100 << 20
+	case discordgo.PremiumTier2:
+		return 50 << 20
+	default:
+		return composite_renderer.DiscordUploadLimit
+	}
+}
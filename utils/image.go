@@ -35,6 +35,19 @@ func AsyncImage(url string) *Image {
 	return result
 }
 
+// ImageFromBytes returns an *Image holding data that was already downloaded
+func ImageFromBytes(data []byte) *Image {
+	result := asyncPool.Get()
+	result.reset()
+
+	go func() {
+		defer close(result.ch)
+		result.ch <- io.NopCloser(bytes.NewReader(data))
+	}()
+
+	return result
+}
+
 // Download starts the download of the image from the given URL.
 // It resets any previous buffered data to overwrite it with the new data.
 func (r *Image) Download(url string) {
@@ -104,6 +117,21 @@ func (r *Image) Base64() (string, error) {
 	return out.String(), nil
 }
 
+// Size returns the width and height of the image, decoding only its header
+func (r *Image) Size() (int, int, error) {
+	r.flush()
+
+	if r.err != nil {
+		return 0, 0, r.err
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(r.buffer.Bytes()))
+	if err != nil {
+		return 0, 0, err
+	}
+	return config.Width, config.Height, nil
+}
+
 // startDownload starts the download of the image from the given URL.
 // It resets any previous buffered data to overwrite it with the new data.
 // Callers should call reset before calling this method.
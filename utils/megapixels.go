@@ -0,0 +1,46 @@
+package utils
+
+import "math"
+
+// Megapixels is the size of a width by height image in millions of pixels, as recorded in the usage ledger
+func Megapixels(width, height int) float64 {
+	return float64(width) * float64(height) / 1_000_000
+}
+
+// FitMegapixels scales width and height down to at most megapixels, keeping their aspect ratio and rounding down to
+// a multiple of step. Sizes that fit, and a budget of 0, are returned as they are.
+func FitMegapixels(width, height int, megapixels float64, step int) (int, int) {
+	if megapixels <= 0 || width <= 0 || height <= 0 || Megapixels(width, height) <= megapixels {
+		return width, height
+	}
+	scale := math.Sqrt(megapixels / Megapixels(width, height))
+	return fitStep(float64(width)*scale, step), fitStep(float64(height)*scale, step)
+}
+
+// ScaleMegapixels scales width and height up or down to about megapixels, keeping their aspect ratio and rounding down
+// to a multiple of step
+func ScaleMegapixels(width, height int, megapixels float64, step int) (int, int) {
+	if megapixels <= 0 || width <= 0 || height <= 0 {
+		return width, height
+	}
+	scale := math.Sqrt(megapixels / Megapixels(width, height))
+	return fitStep(float64(width)*scale, step), fitStep(float64(height)*scale, step)
+}
+
+// FitHiresScale lowers scale so width and height upscaled by it fit in megapixels, rounded down to 0.05 and no lower
+// than 1. A budget of 0 returns scale as it is.
+func FitHiresScale(width, height int, scale, megapixels float64) float64 {
+	if megapixels <= 0 || width <= 0 || height <= 0 {
+		return scale
+	}
+	limit := math.Sqrt(megapixels / Megapixels(width, height))
+	if scale <= limit {
+		return scale
+	}
+	return max(1, math.Floor(limit*20)/20)
+}
+
+func fitStep(value float64, step int) int {
+	step = max(step, 1)
+	return max(step, int(value)/step*step)
+}
@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	neturl "net/url"
+)
+
+// ProxyTransport returns a transport like http.DefaultTransport that sends requests through proxyURL, an http,
+// https, socks5 or socks5h URL. Without proxyURL it uses HTTP_PROXY, HTTPS_PROXY and NO_PROXY like the default.
+func ProxyTransport(proxyURL string) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxyURL == "" {
+		return transport, nil
+	}
+	u, err := neturl.Parse(proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q, use http, https, socks5 or socks5h", u.Scheme)
+	}
+	transport.Proxy = http.ProxyURL(u)
+	return transport, nil
+}
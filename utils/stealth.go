@@ -0,0 +1,176 @@
+package utils
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"io"
+)
+
+// Signatures of NovelAI style stealth metadata, hidden in the least significant bits of the image read column by column.
+const (
+	stealthAlphaInfo = "stealth_pnginfo"
+	stealthAlphaComp = "stealth_pngcomp"
+	stealthRGBInfo   = "stealth_rgbinfo"
+	stealthRGBComp   = "stealth_rgbcomp"
+)
+
+var ErrNoStealthInfo = errors.New("no stealth metadata found")
+
+// maxStealthInfo is the most metadata read from an image once decompressed, so a payload can't inflate to gigabytes
+const maxStealthInfo = 1 << 20
+
+// stealthBits reads the least significant bits of an image in column-major order, from the alpha channel or from
+// the red, green and blue channels.
+type stealthBits struct {
+	img    *image.NRGBA
+	rgb    bool
+	offset int
+}
+
+func (b *stealthBits) next() (byte, bool) {
+	bounds := b.img.Bounds()
+	channel := 0
+	pixel := b.offset
+	if b.rgb {
+		channel, pixel = b.offset%3, b.offset/3
+	} else {
+		channel = 3
+	}
+	if pixel >= bounds.Dx()*bounds.Dy() {
+		return 0, false
+	}
+	b.offset++
+
+	x, y := bounds.Min.X+pixel/bounds.Dy(), bounds.Min.Y+pixel%bounds.Dy()
+	return b.img.Pix[b.img.PixOffset(x, y)+channel] & 1, true
+}
+
+// remaining is how many bits are left to read
+func (b *stealthBits) remaining() int {
+	bounds := b.img.Bounds()
+	total := bounds.Dx() * bounds.Dy()
+	if b.rgb {
+		total *= 3
+	}
+	return total - b.offset
+}
+
+// read returns the next n bytes, false if the image doesn't hold that many
+func (b *stealthBits) read(n int) ([]byte, bool) {
+	if n < 0 || n > b.remaining()/8 {
+		return nil, false
+	}
+	out := make([]byte, n)
+	for i := range n * 8 {
+		bit, ok := b.next()
+		if !ok {
+			return nil, false
+		}
+		out[i/8] |= bit << (7 - i%8)
+	}
+	return out, true
+}
+
+// DecodeStealthInfo recovers the metadata hidden in the image by NovelAI or the stealth-pnginfo extension.
+// It returns ErrNoStealthInfo if the image carries none.
+func DecodeStealthInfo(img image.Image) (string, error) {
+	nrgba := toNRGBA(img)
+
+	for _, rgb := range []bool{false, true} {
+		bits := &stealthBits{img: nrgba, rgb: rgb}
+		signature, ok := bits.read(len(stealthAlphaInfo))
+		if !ok {
+			return "", ErrNoStealthInfo
+		}
+
+		var compressed bool
+		switch string(signature) {
+		case stealthAlphaInfo, stealthRGBInfo:
+		case stealthAlphaComp, stealthRGBComp:
+			compressed = true
+		default:
+			continue
+		}
+		if (string(signature) == stealthRGBInfo || string(signature) == stealthRGBComp) != rgb {
+			continue
+		}
+
+		header, ok := bits.read(4)
+		if !ok {
+			return "", errors.New("truncated stealth metadata")
+		}
+		length := int(binary.BigEndian.Uint32(header))
+		if length%8 != 0 {
+			return "", errors.New("invalid stealth metadata length")
+		}
+		data, ok := bits.read(length / 8)
+		if !ok {
+			return "", errors.New("truncated stealth metadata")
+		}
+
+		if compressed {
+			reader, err := gzip.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return "", err
+			}
+			data, err = io.ReadAll(io.LimitReader(reader, maxStealthInfo+1))
+			if err != nil {
+				return "", err
+			}
+			if len(data) > maxStealthInfo {
+				return "", errors.New("stealth metadata is too large")
+			}
+		}
+		return string(data), nil
+	}
+
+	return "", ErrNoStealthInfo
+}
+
+// EncodeStealthInfo hides info in the alpha channel of a copy of img, gzip compressed like NovelAI does.
+// The result must be saved losslessly with its alpha channel, e.g. as a PNG.
+func EncodeStealthInfo(img image.Image, info string) (*image.NRGBA, error) {
+	payload := new(bytes.Buffer)
+	writer := gzip.NewWriter(payload)
+	if _, err := writer.Write([]byte(info)); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, 0, len(stealthAlphaComp)+4+payload.Len())
+	data = append(data, stealthAlphaComp...)
+	data = binary.BigEndian.AppendUint32(data, uint32(payload.Len()*8))
+	data = append(data, payload.Bytes()...)
+
+	out := image.NewNRGBA(img.Bounds())
+	draw.Draw(out, out.Bounds(), img, img.Bounds().Min, draw.Src)
+
+	bounds := out.Bounds()
+	if len(data)*8 > bounds.Dx()*bounds.Dy() {
+		return nil, errors.New("image is too small to hold the metadata")
+	}
+
+	for i := range len(data) * 8 {
+		bit := data[i/8] >> (7 - i%8) & 1
+		x, y := bounds.Min.X+i/bounds.Dy(), bounds.Min.Y+i%bounds.Dy()
+		a := &out.Pix[out.PixOffset(x, y)+3]
+		*a = *a&^1 | bit
+	}
+
+	return out, nil
+}
+
+func toNRGBA(img image.Image) *image.NRGBA {
+	if nrgba, ok := img.(*image.NRGBA); ok {
+		return nrgba
+	}
+	nrgba := image.NewNRGBA(img.Bounds())
+	draw.Draw(nrgba, nrgba.Bounds(), img, img.Bounds().Min, draw.Src)
+	return nrgba
+}
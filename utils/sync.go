@@ -2,6 +2,8 @@ package utils
 
 import (
 	"sync"
+
+	"stable_diffusion_bot/composite_renderer"
 )
 
 type pool[T any] struct {
@@ -21,3 +23,8 @@ func (p *pool[T]) Get() T {
 func (p *pool[T]) Put(x T) {
 	p.pool.Put(x)
 }
+
+// ForEach calls fn for 0 to n-1 on up to GOMAXPROCS goroutines and returns the error of the lowest index
+func ForEach(n int, fn func(i int) error) error {
+	return composite_renderer.ForEach(n, fn)
+}
@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"net/http"
+)
+
+// HeaderTransport sets header on every request sent through base, replacing the values the request already had.
+// A nil base is http.DefaultTransport.
+func HeaderTransport(base http.RoundTripper, header http.Header) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if len(header) == 0 {
+		return base
+	}
+	return &headerTransport{base: base, header: header}
+}
+
+type headerTransport struct {
+	base   http.RoundTripper
+	header http.Header
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for key, values := range t.header {
+		req.Header[key] = values
+	}
+	return t.base.RoundTrip(req)
+}
@@ -19,15 +19,37 @@ func GetOpts(data discordgo.ApplicationCommandInteractionData) map[string]*disco
 }
 
 // keyValue matches --key value, --key=value, or --key "value with spaces"
-var keyValue = regexp.MustCompile(`\B(?:--|—)+(\w+)(?:[ =]([\w./\\:]+|"[^"]+"))?`)
+var keyValue = regexp.MustCompile(`\B(?:--|—)+(\w+)(?:[ =]([\w./\\:][\w./\\:-]*|-\d+|"[^"]+"))?`)
 
-func ExtractKeyValuePairsFromPrompt(prompt string) (parameters map[string]string, sanitized string) {
+// bareKeyValue matches key=value or key="value with spaces" at the start of a word
+var bareKeyValue = regexp.MustCompile(`(^|\s)(\w+)=([\w./\\:][\w./\\:-]*|-[\d.]+|"[^"]+")`)
+
+// ExtractKeyValuePairsFromPrompt removes the parameters written as --key value or key=value from the prompt.
+// Keys are renamed to the name aliases maps them to, e.g. ar to aspect_ratio. Only the keys of aliases are taken
+// from key=value, so other words with an equals sign stay in the prompt.
+func ExtractKeyValuePairsFromPrompt(prompt string, aliases map[string]string) (parameters map[string]string, sanitized string) {
 	parameters = make(map[string]string)
-	sanitized = keyValue.ReplaceAllString(prompt, "")
-	sanitized = strings.TrimSpace(sanitized)
-	for _, match := range keyValue.FindAllStringSubmatch(prompt, -1) {
-		parameters[match[1]] = match[2]
+	add := func(key, value string) {
+		if alias, ok := aliases[strings.ToLower(key)]; ok {
+			key = alias
+		}
+		parameters[key] = strings.Trim(value, `"`)
 	}
+
+	sanitized = keyValue.ReplaceAllStringFunc(prompt, func(match string) string {
+		submatch := keyValue.FindStringSubmatch(match)
+		add(submatch[1], submatch[2])
+		return ""
+	})
+	sanitized = bareKeyValue.ReplaceAllStringFunc(sanitized, func(match string) string {
+		submatch := bareKeyValue.FindStringSubmatch(match)
+		if _, ok := aliases[strings.ToLower(submatch[2])]; !ok {
+			return match
+		}
+		add(submatch[2], submatch[3])
+		return submatch[1]
+	})
+	sanitized = strings.TrimSpace(sanitized)
 	return
 }
 
@@ -37,7 +59,7 @@ func ExtractKeyValuePairsFromPrompt(prompt string) (parameters map[string]string
 //
 // Example:
 //
-//	if int64Val, ok := interfaceConvertAuto[int, int64](&queue.Steps, stepOption, optionMap, parameters); ok {
+//	if int64Val, ok := InterfaceConvertAuto[int, int64](&queue.Steps, stepOption, optionMap, parameters); ok {
 //		queue.Steps = int(*int64Val)
 //	}
 //
@@ -57,15 +79,19 @@ func InterfaceConvertAuto[F any, V string | float64](field *F, option string, op
 		return &valueType, ok
 	}
 	if value, ok := parameters[option]; ok {
-		if field != nil {
+		// strings are assigned whole, Sscanf would stop at the first space of a quoted value
+		if field, ok := any(field).(*string); ok && field != nil {
+			*field = value
+		} else if field != nil {
 			_, err := fmt.Sscanf(value, "%v", field)
 			if err != nil {
 				return nil, false
 			}
 		}
 		var out V
-		_, err := fmt.Sscanf(value, "%v", &out)
-		if err != nil {
+		if out, ok := any(&out).(*string); ok {
+			*out = value
+		} else if _, err := fmt.Sscanf(value, "%v", &out); err != nil {
 			return nil, false
 		}
 		return &out, true
@@ -78,6 +104,8 @@ type AttachmentImage struct {
 	Image      *Image
 }
 
+// GetAttachments downloads the attachments of the command with DownloadAttachment, by their snowflake. An
+// *AttachmentError is returned for the first attachment that isn't a usable image.
 func GetAttachments(i *discordgo.InteractionCreate) (map[string]AttachmentImage, error) {
 	if i.ApplicationCommandData().Resolved == nil {
 		return nil, nil
@@ -88,16 +116,28 @@ func GetAttachments(i *discordgo.InteractionCreate) (map[string]AttachmentImage,
 		return nil, nil
 	}
 
-	attachments := make(map[string]AttachmentImage, len(resolved))
-	for snowflake, attachment := range resolved {
-		log.Printf("Attachment[%v]: %#v", snowflake, attachment.URL)
-		if !strings.HasPrefix(attachment.ContentType, "image") {
-			log.Printf("Attachment[%v] is not an image, removing from queue.", snowflake)
-			continue
+	snowflakes := make([]string, 0, len(resolved))
+	for snowflake := range resolved {
+		snowflakes = append(snowflakes, snowflake)
+	}
+	images := make([]AttachmentImage, len(snowflakes))
+	err := ForEach(len(snowflakes), func(idx int) error {
+		attachment := resolved[snowflakes[idx]]
+		log.Printf("Attachment[%v]: %#v", snowflakes[idx], attachment.URL)
+		image, err := DownloadAttachment(attachment, AttachmentLimits{})
+		if err != nil {
+			return err
 		}
-
-		attachments[snowflake] = AttachmentImage{attachment, AsyncImage(attachment.URL)}
+		images[idx] = AttachmentImage{attachment, image}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
+	attachments := make(map[string]AttachmentImage, len(resolved))
+	for idx, snowflake := range snowflakes {
+		attachments[snowflake] = images[idx]
+	}
 	return attachments, nil
 }
@@ -0,0 +1,78 @@
+package version
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// Set at build time, e.g.
+//
+//	go build -ldflags "-X stable_diffusion_bot/version.Version=v1.2.3 -X stable_diffusion_bot/version.Commit=$(git rev-parse HEAD)"
+//
+// Commit and Date default to the VCS information the Go toolchain embeds when building from a git checkout.
+var (
+	Version = "dev"
+	Commit  = ""
+	Date    = ""
+)
+
+// Info is the build of the running binary
+type Info struct {
+	Version string
+	Commit  string
+	Date    string
+	// Modified is set when the working tree had uncommitted changes
+	Modified bool
+	Go       string
+}
+
+var info = sync.OnceValue(func() Info {
+	i := Info{Version: Version, Commit: Commit, Date: Date, Go: runtime.Version()}
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return i
+	}
+	for _, setting := range build.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			if i.Commit == "" {
+				i.Commit = setting.Value
+			}
+		case "vcs.time":
+			if i.Date == "" {
+				i.Date = setting.Value
+			}
+		case "vcs.modified":
+			i.Modified = setting.Value == "true"
+		}
+	}
+	return i
+})
+
+// Get returns the build of the running binary
+func Get() Info { return info() }
+
+// String returns the version with its short commit and build date, e.g. "v1.2.3 (1a2b3c4, 2024-07-07)"
+func String() string { return Get().String() }
+
+func (i Info) String() string {
+	commit := i.Commit
+	if len(commit) > 7 {
+		commit = commit[:7]
+	}
+	if commit == "" {
+		commit = "unknown commit"
+	} else if i.Modified {
+		commit += "-dirty"
+	}
+	if date, err := time.Parse(time.RFC3339, i.Date); err == nil {
+		return fmt.Sprintf("%s (%s, %s)", i.Version, commit, date.UTC().Format(time.DateOnly))
+	}
+	if i.Date != "" {
+		return fmt.Sprintf("%s (%s, %s)", i.Version, commit, i.Date)
+	}
+	return fmt.Sprintf("%s (%s)", i.Version, commit)
+}